@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchDeepPipeline(t *testing.T) {
+	ctx := context.Background()
+	conns := connectBoth()
+
+	for _, conn := range conns {
+		defer conn.Close(ctx)
+	}
+
+	for _, conn := range conns {
+		const depth = 500
+
+		batch := &pgx.Batch{}
+		for i := range depth {
+			batch.Queue("SELECT $1::bigint", int64(i))
+		}
+
+		results := conn.SendBatch(ctx, batch)
+		for i := range depth {
+			var value int64
+			err := results.QueryRow().Scan(&value)
+			require.NoError(t, err, "batch query %d", i)
+			assert.EqualValues(t, i, value)
+		}
+		require.NoError(t, results.Close())
+	}
+
+	assertNoOutOfSync(t)
+}
+
+func TestBatchPipelineError(t *testing.T) {
+	ctx := context.Background()
+	conns := connectBoth()
+
+	for _, conn := range conns {
+		defer conn.Close(ctx)
+	}
+
+	for _, conn := range conns {
+		batch := &pgx.Batch{}
+		batch.Queue("SELECT $1::bigint", int64(1))
+		batch.Queue("SELECT * FROM pgx_pipeline_missing_table WHERE id = $1", int64(2))
+		batch.Queue("SELECT $1::bigint", int64(3))
+
+		results := conn.SendBatch(ctx, batch)
+
+		var value int64
+		err := results.QueryRow().Scan(&value)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, value)
+
+		// The error aborts the rest of the pipeline.
+		_, err = results.Exec()
+		assert.Error(t, err)
+		_, err = results.Exec()
+		assert.Error(t, err)
+
+		results.Close()
+
+		// The connection recovers at Sync.
+		err = conn.QueryRow(ctx, "SELECT $1::bigint", int64(4)).Scan(&value)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 4, value)
+	}
+
+	assertNoOutOfSync(t)
+}
+
+func TestBatchPipelineSameConnection(t *testing.T) {
+	ctx := context.Background()
+
+	conn, err := connectNormal()
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS pgx_pipeline (id BIGINT)")
+	require.NoError(t, err)
+	defer conn.Exec(ctx, "DROP TABLE IF EXISTS pgx_pipeline")
+
+	// The whole pipeline runs on one server connection, so
+	// the SELECT sees the row inserted right before it.
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT pg_backend_pid()")
+	batch.Queue("INSERT INTO pgx_pipeline (id) VALUES ($1)", int64(1))
+	batch.Queue("SELECT COUNT(*) FROM pgx_pipeline WHERE id = $1", int64(1))
+	batch.Queue("SELECT pg_backend_pid()")
+
+	results := conn.SendBatch(ctx, batch)
+
+	var first, last int32
+	var count int64
+	require.NoError(t, results.QueryRow().Scan(&first))
+	_, err = results.Exec()
+	require.NoError(t, err)
+	require.NoError(t, results.QueryRow().Scan(&count))
+	require.NoError(t, results.QueryRow().Scan(&last))
+	require.NoError(t, results.Close())
+
+	assert.EqualValues(t, 1, count)
+	assert.Equal(t, first, last)
+
+	assertNoOutOfSync(t)
+}
@@ -6,23 +6,28 @@ use std::fs::read_to_string;
 use std::path::{Path, PathBuf};
 use tracing::{error, info, warn};
 
-use crate::sharding::ShardedSchema;
+use crate::sharding::{RoutingRelationship, ShardedSchema};
 use crate::util::random_string;
 use crate::{
-    EnumeratedDatabase, Memory, OmnishardedTable, PassthroughAuth, PreparedStatements, QueryParser,
-    QueryParserEngine, QueryParserLevel, ReadWriteSplit, RewriteMode, Role, ShardedMappingKey,
+    EnumeratedDatabase, FlexibleType, Memory, OmnishardedTable, PassthroughAuth,
+    PreparedStatements, QueryParser, QueryParserEngine, QueryParserLevel, ReadWriteSplit,
+    RewriteMode, Role, ShardedMappingConfig, ShardedMappingKey, ShardedMappingKindDeprecated,
     ShardedTableConfig, SystemCatalogsBehavior, system_catalogs,
 };
 
 use super::database::Database;
 use super::error::Error;
 use super::general::General;
-use super::networking::{MultiTenant, Tcp, TlsVerifyMode};
+use super::maintenance::MaintenanceWindow;
+use super::networking::{MultiTenant, SniRoute, Tcp, TlsVerifyMode};
 use super::otel::Otel;
 use super::pooling::PoolerMode;
+use super::query_routing::QueryRoutingRule;
 use super::replication::{MirrorConfig, Mirroring, MirroringLevel, ReplicaLag, Replication};
 use super::rewrite::Rewrite;
 use super::sharding::{OmnishardedTables, ShardedMappingDeprecated};
+use super::stats_export::StatsExport;
+use super::userlist::UserList;
 use super::users::{Admin, Plugin, Users};
 use super::vault::Vault;
 
@@ -42,6 +47,9 @@ pub struct ConfigAndUsers {
     /// Raw, unparsed text of `users.toml`.
     /// None when the file is missing.
     pub users_text: Option<String>,
+    /// Users loaded from `auth_file`.
+    #[serde(skip)]
+    pub userlist: UserList,
 }
 
 impl ConfigAndUsers {
@@ -91,6 +99,24 @@ impl ConfigAndUsers {
             Users::default()
         };
 
+        let userlist = if let Some(path) = &config.general.auth_file {
+            let userlist = match UserList::load(path) {
+                Ok(userlist) => userlist,
+                Err(error) => {
+                    error!("failed to load {}: {}", path.display(), error);
+                    return Err(error);
+                }
+            };
+            info!(
+                "loaded {} users from \"{}\"",
+                userlist.len(),
+                path.display()
+            );
+            userlist
+        } else {
+            UserList::default()
+        };
+
         // Override admin set in pgdog.toml
         // with what's in users.toml.
         if let Some(admin) = users.admin.take() {
@@ -111,6 +137,7 @@ impl ConfigAndUsers {
             users_path: users_path.to_owned(),
             config_text,
             users_text,
+            userlist,
         };
 
         Ok(config_and_users)
@@ -182,6 +209,7 @@ impl Default for ConfigAndUsers {
             users_path: PathBuf::from("users.toml"),
             config_text: None,
             users_text: None,
+            userlist: UserList::default(),
         }
     }
 }
@@ -260,6 +288,18 @@ pub struct Config {
     #[serde(default)]
     pub sharded_schemas: Vec<ShardedSchema>,
 
+    /// Routing relationships let PgDog route queries on child tables that don't have the sharding key, using the sharding key of the parent row they reference.
+    #[serde(default)]
+    pub routing_relationships: Vec<RoutingRelationship>,
+
+    /// Query routing rules send queries matching a pattern to a specific destination, like the primary, the replicas, a shard or the slow pool.
+    #[serde(default)]
+    pub query_routing_rules: Vec<QueryRoutingRule>,
+
+    /// Route clients to a database by the hostname they connected to, sent with TLS SNI. Clients connecting with a listed hostname use its database, regardless of their connection string.
+    #[serde(default)]
+    pub sni_routes: Vec<SniRoute>,
+
     /// Replica lag configuration.
     #[serde(default, deserialize_with = "ReplicaLag::deserialize_optional")]
     pub replica_lag: Option<ReplicaLag>,
@@ -274,6 +314,12 @@ pub struct Config {
     #[serde(default)]
     pub mirroring: Vec<Mirroring>,
 
+    /// Maintenance windows lower pool sizes or pause specific users on a schedule, giving the database headroom for maintenance like `VACUUM FULL` or index builds.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/>
+    #[serde(default)]
+    pub maintenance_windows: Vec<MaintenanceWindow>,
+
     /// Memory settings control buffer sizes used by PgDog for network I/O and task execution.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/memory/>
@@ -286,6 +332,12 @@ pub struct Config {
     #[serde(default)]
     pub otel: Otel,
 
+    /// Periodic export of stats snapshots to object storage.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/>
+    #[serde(default)]
+    pub stats_export: StatsExport,
+
     /// HashiCorp Vault settings, required for users configured with `server_auth = "vault"`.
     pub vault: Option<Vault>,
 
@@ -327,6 +379,7 @@ impl Config {
                 entry.push(OmnishardedTable {
                     name: t.clone(),
                     sticky_routing: table.sticky,
+                    two_phase_commit: table.two_phase_commit,
                 });
             }
         }
@@ -352,6 +405,7 @@ impl Config {
                         entry.push(OmnishardedTable {
                             name: table.to_string(),
                             sticky_routing,
+                            two_phase_commit: false,
                         });
                     }
                 }
@@ -509,6 +563,52 @@ impl Config {
             _ => (),
         }
 
+        for rule in &self.query_routing_rules {
+            if !checks.contains_key(&rule.database) {
+                warn!(
+                    r#"query routing rule is for database "{}" which doesn't exist"#,
+                    rule.database
+                );
+            }
+
+            if rule.regex.is_none() && rule.query.is_none() && rule.application_name.is_none() {
+                warn!(
+                    r#"query routing rule for database "{}" should have "regex", "query" or "application_name""#,
+                    rule.database
+                );
+            }
+        }
+
+        for route in &self.sni_routes {
+            if !checks.contains_key(&route.database) {
+                warn!(
+                    r#"SNI route for "{}" is for database "{}" which doesn't exist"#,
+                    route.hostname, route.database
+                );
+            }
+        }
+
+        if self.stats_export.bucket.is_some() && self.stats_export.interval == 0 {
+            warn!(r#"stats_export "interval" is 0, stats snapshots won't be exported"#);
+        }
+
+        if !self.sni_routes.is_empty() && self.general.tls_certificate.is_none() {
+            warn!("\"sni_routes\" are configured but TLS is disabled, they won't be used");
+        }
+
+        for window in &self.maintenance_windows {
+            if !checks.contains_key(&window.database) {
+                warn!(
+                    r#"maintenance window "{}" is for database "{}" which doesn't exist"#,
+                    window.schedule, window.database
+                );
+            }
+        }
+
+        if self.general.auth_query.is_some() && self.general.auth_user.is_none() {
+            warn!(r#""auth_query" is set but "auth_user" isn't, users won't be looked up"#);
+        }
+
         if !self.general.two_phase_commit && self.rewrite.enabled {
             if self.rewrite.shard_key == RewriteMode::Rewrite {
                 warn!(
@@ -535,7 +635,8 @@ impl Config {
                     QueryParserLevel::On => true,
                     QueryParserLevel::Off
                     | QueryParserLevel::SessionControl
-                    | QueryParserLevel::SessionControlAndLocks => false,
+                    | QueryParserLevel::SessionControlAndLocks
+                    | QueryParserLevel::Shadow => false,
                     QueryParserLevel::Auto => check.have_replicas || check.sharded,
                 };
                 if !parser_enabled {
@@ -688,6 +789,84 @@ impl Config {
             tmp
         );
     }
+
+    /// Sharded tables in `database` with a range rule on `column` bounded by exactly
+    /// `[start, end)`, and the shard the rule points to.
+    pub fn range_rules(
+        &self,
+        database: &str,
+        column: &str,
+        start: &FlexibleType,
+        end: &FlexibleType,
+    ) -> Vec<(&ShardedTableConfig, usize)> {
+        let matches = |rule_start: &Option<FlexibleType>, rule_end: &Option<FlexibleType>| {
+            rule_start.as_ref() == Some(start) && rule_end.as_ref() == Some(end)
+        };
+
+        self.sharded_tables
+            .iter()
+            .filter(|table| table.database == database && table.column == column)
+            .filter_map(|table| {
+                let rule = table.mapping.iter().flatten().find_map(|rule| match rule {
+                    ShardedMappingConfig::Range(range) if matches(&range.start, &range.end) => {
+                        Some(range.shard)
+                    }
+                    _ => None,
+                });
+
+                let deprecated = || {
+                    self.sharded_mappings.iter().find_map(|mapping| {
+                        (mapping.database == database
+                            && mapping.column == column
+                            && mapping.kind == ShardedMappingKindDeprecated::Range
+                            && (mapping.table.is_none() || mapping.table == table.name)
+                            && matches(&mapping.start, &mapping.end))
+                        .then_some(mapping.shard)
+                    })
+                };
+
+                rule.or_else(deprecated).map(|shard| (table, shard))
+            })
+            .collect()
+    }
+
+    /// Point the range rules found by [`Self::range_rules`] to `shard`.
+    pub fn move_range(
+        &mut self,
+        database: &str,
+        column: &str,
+        start: &FlexibleType,
+        end: &FlexibleType,
+        shard: usize,
+    ) {
+        let matches = |rule_start: &Option<FlexibleType>, rule_end: &Option<FlexibleType>| {
+            rule_start.as_ref() == Some(start) && rule_end.as_ref() == Some(end)
+        };
+
+        for table in self
+            .sharded_tables
+            .iter_mut()
+            .filter(|table| table.database == database && table.column == column)
+        {
+            for rule in table.mapping.iter_mut().flatten() {
+                if let ShardedMappingConfig::Range(range) = rule
+                    && matches(&range.start, &range.end)
+                {
+                    range.shard = shard;
+                }
+            }
+        }
+
+        for mapping in self.sharded_mappings.iter_mut().filter(|mapping| {
+            mapping.database == database
+                && mapping.column == column
+                && mapping.kind == ShardedMappingKindDeprecated::Range
+        }) {
+            if matches(&mapping.start, &mapping.end) {
+                mapping.shard = shard;
+            }
+        }
+    }
 }
 
 #[cfg(test)]
@@ -890,6 +1069,35 @@ exposure = 0.75
         );
     }
 
+    #[test]
+    fn test_database_lb_weight() {
+        let source = r#"
+[[databases]]
+name = "prod"
+host = "10.0.0.1"
+
+[[databases]]
+name = "prod"
+host = "10.0.0.2"
+role = "replica"
+lb_weight = 2
+
+[[databases]]
+name = "prod"
+host = "10.0.0.3"
+role = "replica"
+weight = 6
+"#;
+
+        let config: Config = toml::from_str(source).unwrap();
+        let weights = config
+            .databases
+            .iter()
+            .map(|database| database.lb_weight)
+            .collect::<Vec<_>>();
+        assert_eq!(weights, vec![255, 2, 6]);
+    }
+
     #[test]
     fn test_admin_override_from_users_toml() {
         let pgdog_config = r#"
@@ -987,6 +1195,7 @@ tables = ["table_a", "table_b"]
 database = "db1"
 tables = ["table_c"]
 sticky = true
+two_phase_commit = true
 
 [[omnisharded_tables]]
 database = "db2"
@@ -1009,6 +1218,8 @@ tables = ["table_x"]
         assert!(!db1_tables[1].sticky_routing);
         assert_eq!(db1_tables[2].name, "table_c");
         assert!(db1_tables[2].sticky_routing);
+        assert!(db1_tables[2].two_phase_commit);
+        assert!(!db1_tables[0].two_phase_commit);
 
         let db2_tables = tables.get("db2").unwrap();
         assert_eq!(db2_tables.len(), 1);
@@ -1644,4 +1855,57 @@ column = "legacy_id"
 
         assert_eq!(config.sharded_tables[4].mapping, None);
     }
+
+    #[test]
+    fn test_move_range() {
+        let range = |start: i64, end: i64, shard| {
+            ShardedMappingConfig::Range(ShardedMappingRange {
+                start: Some(FlexibleType::Integer(start)),
+                end: Some(FlexibleType::Integer(end)),
+                shard,
+            })
+        };
+        let table = |name: &str, mapping| ShardedTableConfig {
+            database: "prod".into(),
+            name: Some(name.into()),
+            column: "tenant_id".into(),
+            mapping: Some(mapping),
+            ..Default::default()
+        };
+
+        let mut config = Config {
+            sharded_tables: vec![
+                table("users", vec![range(0, 100, 0), range(100, 200, 1)]),
+                table("orders", vec![range(0, 100, 0), range(100, 200, 1)]),
+                table("events", vec![range(0, 50, 0)]),
+            ],
+            ..Default::default()
+        };
+
+        let (start, end) = (FlexibleType::Integer(0), FlexibleType::Integer(100));
+        let rules = config.range_rules("prod", "tenant_id", &start, &end);
+        assert_eq!(
+            rules
+                .iter()
+                .map(|(table, shard)| (table.name.as_deref().unwrap(), *shard))
+                .collect::<Vec<_>>(),
+            vec![("users", 0), ("orders", 0)]
+        );
+        assert!(config.range_rules("prod", "id", &start, &end).is_empty());
+
+        config.move_range("prod", "tenant_id", &start, &end, 2);
+        let rules = config.range_rules("prod", "tenant_id", &start, &end);
+        assert!(rules.iter().all(|(_, shard)| *shard == 2));
+        assert_eq!(rules.len(), 2);
+
+        // Other ranges stay where they are.
+        assert_eq!(
+            config.sharded_tables[0].mapping.as_ref().unwrap()[1],
+            range(100, 200, 1)
+        );
+        assert_eq!(
+            config.sharded_tables[2].mapping.as_ref().unwrap()[0],
+            range(0, 50, 0)
+        );
+    }
 }
@@ -6,7 +6,8 @@ use std::{
     str::FromStr,
 };
 
-use super::pooling::PoolerMode;
+use super::general::NoticeSeverity;
+use super::pooling::{PoolerMode, QueueOrder};
 
 /// How aggressive the query parser should be in determining read vs. write queries.
 ///
@@ -50,6 +51,8 @@ pub enum LoadBalancingStrategy {
     LeastActiveConnections,
     /// Weighted round-robin, distributing requests proportionally to configured weights.
     WeightedRoundRobin,
+    /// Prefer replicas with lower query and health check latency, using a moving average.
+    LatencyAware,
 }
 
 impl FromStr for LoadBalancingStrategy {
@@ -61,6 +64,7 @@ impl FromStr for LoadBalancingStrategy {
             "roundrobin" => Ok(Self::RoundRobin),
             "leastactiveconnections" => Ok(Self::LeastActiveConnections),
             "weightedroundrobin" => Ok(Self::WeightedRoundRobin),
+            "latencyaware" => Ok(Self::LatencyAware),
             _ => Err(format!("Invalid load balancing strategy: {}", s)),
         }
     }
@@ -129,7 +133,7 @@ pub struct Database {
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#role>
     #[serde(default)]
     pub role: Role,
-    /// IP address or DNS name of the machine where the PostgreSQL server is running.
+    /// IP address or DNS name of the machine where the PostgreSQL server is running. If it starts with `/`, it's the directory containing the PostgreSQL UNIX socket, e.g. `/var/run/postgresql`.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#host>
     pub host: String,
@@ -175,10 +179,34 @@ pub struct Database {
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#pooler_mode>
     pub pooler_mode: Option<PoolerMode>,
+    /// Overrides the `client_queue_order` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#client_queue_order>
+    pub client_queue_order: Option<QueueOrder>,
+    /// Overrides the `server_queue_order` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#server_queue_order>
+    pub server_queue_order: Option<QueueOrder>,
+    /// Overrides the `fair_share_window` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#fair_share_window>
+    pub fair_share_window: Option<u64>,
+    /// Overrides the `max_waiting_clients` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#max_waiting_clients>
+    pub max_waiting_clients: Option<usize>,
+    /// Overrides the `autoscale_max_pool_size` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#autoscale_max_pool_size>
+    pub autoscale_max_pool_size: Option<usize>,
     /// This setting configures the `statement_timeout` connection parameter on all connections to Postgres for this database.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#statement_timeout>
     pub statement_timeout: Option<u64>,
+    /// Maximum `statement_timeout` clients are allowed to `SET`, in milliseconds. Higher values, including `0` (no timeout), are lowered to this value and the client receives a `NOTICE`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#max_statement_timeout>
+    pub max_statement_timeout: Option<u64>,
     /// This setting configures the `lock_timeout` connection parameter on all connections to Postgres for this database.
     /// Aborts any statement that waits longer than the specified duration to acquire a lock.
     /// Unlike `statement_timeout`, this only counts time spent waiting for locks, not execution time.
@@ -189,10 +217,22 @@ pub struct Database {
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#idle_timeout>
     pub idle_timeout: Option<u64>,
+    /// Overrides the `client_idle_timeout` setting for this database. Clients idle outside of a transaction for longer than this are disconnected.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#client_idle_timeout>
+    pub client_idle_timeout: Option<u64>,
     /// Sets the `default_transaction_read_only` connection parameter to `on` on all server connections to this database. Clients can still override it with `SET`.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#read_only>
     pub read_only: Option<bool>,
+    /// Overrides the `catalog_reads_on_replicas` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#catalog_reads_on_replicas>
+    pub catalog_reads_on_replicas: Option<bool>,
+    /// Overrides the `min_notice_severity` setting for this database.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#min_notice_severity>
+    pub min_notice_severity: Option<NoticeSeverity>,
     /// Overrides the `server_lifetime` setting. Server connections older than this will be closed when returned to the pool.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#server_lifetime>
@@ -201,12 +241,42 @@ pub struct Database {
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#server_lifetime_jitter>
     pub server_lifetime_jitter: Option<u64>,
+    /// Size of a separate connection pool for long-running queries, e.g. analytics and reports. Queries with the `pgdog_pool: slow` comment, and all queries from users with `slow_pool = true`, use this pool instead, so they can't take all server connections away from regular traffic.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#slow_pool_size>
+    pub slow_pool_size: Option<usize>,
+    /// Overrides the `checkout_timeout` setting for the slow pool.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#slow_checkout_timeout>
+    pub slow_checkout_timeout: Option<u64>,
+    /// Overrides the `statement_timeout` setting for the slow pool.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#slow_statement_timeout>
+    pub slow_statement_timeout: Option<u64>,
+    /// Queries that always use the slow pool. Queries are compared by fingerprint, i.e., ignoring constants, comments and formatting, so `SELECT * FROM report WHERE id = 1` matches the same query with any `id`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/databases/#slow_queries>
+    #[serde(default)]
+    pub slow_queries: Vec<String>,
+    /// Functions that must run on the primary, e.g. functions that write. `SELECT` queries calling them always go to the primary. Names match unqualified or as `schema.name`.
+    #[serde(default)]
+    pub primary_only_functions: Vec<String>,
+    /// Tables that must be read from the primary. `SELECT` queries reading them always go to the primary. Names match unqualified or as `schema.name`.
+    #[serde(default)]
+    pub primary_only_tables: Vec<String>,
+    /// Built-in functions PgDog sends to the primary because they write, e.g. `currval`, that are safe to call on replicas for this database. Names match unqualified or as `schema.name`.
+    #[serde(default)]
+    pub replica_safe_functions: Vec<String>,
     /// Used for resharding only; this database will not serve regular traffic.
     #[serde(default)]
     pub resharding_only: bool,
-    /// Used for weighted load balancing.
-    #[serde(default = "Database::lb_weight")]
+    /// Share of read queries sent to this host with the `weighted_round_robin` load balancing strategy, relative to the other hosts. Can also be set as `weight`. Changes take effect on `RELOAD`.
+    ///
+    /// _Default:_ `255`
+    #[serde(default = "Database::lb_weight", alias = "weight")]
     pub lb_weight: u8,
+    /// Availability zone of this host, e.g. `us-east-1a`. Read queries prefer hosts in the same zone as PgDog, set with `general.zone`.
+    pub zone: Option<String>,
 }
 
 impl Database {
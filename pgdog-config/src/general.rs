@@ -3,13 +3,13 @@ use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 use std::env;
 use std::fmt;
-use std::net::Ipv4Addr;
+use std::net::{IpAddr, Ipv4Addr};
 use std::path::PathBuf;
 use std::str::FromStr;
 use std::time::Duration;
 
 use crate::UniqueIdFunction;
-use crate::pooling::ConnectionRecovery;
+use crate::pooling::{ConnectionRecovery, QueueOrder};
 use crate::{
     CopyFormat, CutoverTimeoutAction, LoadSchema, QueryParserEngine, QueryParserLevel,
     SystemCatalogsBehavior,
@@ -17,7 +17,7 @@ use crate::{
 
 use super::auth::{AuthType, PassthroughAuth};
 use super::database::{LoadBalancingStrategy, ReadWriteSplit, ReadWriteStrategy};
-use super::networking::TlsVerifyMode;
+use super::networking::{Cidr, ClientKeepaliveMessage, GssEncryption, TlsVerifyMode};
 use super::pooling::{PoolerMode, PreparedStatements};
 
 /// Format to use for PgDog application logs.
@@ -65,10 +65,43 @@ pub enum QuerySizeLimitAction {
     /// Log a warning with a sample of the query (default).
     #[default]
     Warn,
+    /// Log a warning and send a `NOTICE` to the client, but run the query.
+    Notice,
     /// Reject the message before reading it into memory and disconnect the client.
     Block,
 }
 
+/// Severity of notices sent by Postgres, from least to most severe.
+#[derive(
+    Serialize,
+    Deserialize,
+    Debug,
+    Copy,
+    Clone,
+    PartialEq,
+    Eq,
+    PartialOrd,
+    Ord,
+    Hash,
+    Default,
+    JsonSchema,
+    FromStr,
+)]
+#[serde(rename_all = "snake_case", deny_unknown_fields)]
+pub enum NoticeSeverity {
+    /// `DEBUG1` to `DEBUG5`. Send all notices to clients (default).
+    #[default]
+    Debug,
+    /// `LOG`.
+    Log,
+    /// `INFO`.
+    Info,
+    /// `NOTICE`.
+    Notice,
+    /// `WARNING`.
+    Warning,
+}
+
 /// General settings are relevant to the operations of the pooler itself, or apply to all database pools.
 ///
 /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/>
@@ -95,6 +128,48 @@ pub struct General {
     #[serde(default = "General::port")]
     pub port: u16,
 
+    /// Reply to clients requesting GSSAPI encryption on the TCP listener, which PgDog doesn't support. `decline` lets the client continue with TLS or without encryption on the same connection, like libpq does with `gssencmode=prefer`. `reject` sends an error and closes the connection, so clients with `gssencmode=require` report why they can't connect.
+    ///
+    /// _Default:_ `decline`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#gss_encryption>
+    #[serde(default)]
+    pub gss_encryption: GssEncryption,
+
+    /// Directory where PgDog creates a UNIX domain socket to listen for connections, in addition to TCP. The socket file is named `.s.PGSQL.<port>`, like in Postgres, so clients can connect with `host=<directory>`.
+    ///
+    /// **Note:** This setting cannot be changed at runtime.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#unix_socket_dir>
+    #[serde(default = "General::unix_socket_dir")]
+    pub unix_socket_dir: Option<PathBuf>,
+
+    /// Access permissions of the UNIX domain socket. Connecting requires write access, so the default `0o770` only allows the owner and group of the PgDog process. Clients connecting over the socket don't have an IP address and never match `trusted_networks`.
+    ///
+    /// **Note:** This setting cannot be changed at runtime.
+    ///
+    /// _Default:_ `0o770`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#unix_socket_permissions>
+    #[serde(default = "General::unix_socket_permissions")]
+    pub unix_socket_permissions: u32,
+
+    /// Authenticate clients connecting over the UNIX domain socket by their operating system user, like Postgres `peer` authentication. The user of the client process must have the same name as the user it's connecting as, and no password is asked for. Clients of other operating system users are rejected.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#unix_socket_peer_auth>
+    #[serde(default = "General::unix_socket_peer_auth")]
+    pub unix_socket_peer_auth: bool,
+
+    /// Reply to clients requesting GSSAPI encryption on the UNIX domain socket. Accepts the same values as `gss_encryption`.
+    ///
+    /// _Default:_ `decline`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#unix_socket_gss_encryption>
+    #[serde(default)]
+    pub unix_socket_gss_encryption: GssEncryption,
+
     /// Number of Tokio threads to spawn at pooler startup. In multi-core systems, the recommended setting is two (2) per virtual CPU. The value `0` means to spawn no threads and use the current thread runtime.
     ///
     /// **Note:** This setting cannot be changed at runtime.
@@ -131,6 +206,12 @@ pub struct General {
     #[serde(default)]
     pub pooler_mode: PoolerMode,
 
+    /// Default maximum number of server connections per database pool in [session mode](https://docs.pgdog.dev/features/session-mode/), used instead of [`default_pool_size`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#default_pool_size). Session mode pins a server connection to each client until it disconnects, so these pools usually need to be sized by the number of clients. `pool_size` configured for a database or user takes precedence.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#session_pool_size>
+    #[serde(default)]
+    pub session_pool_size: Option<usize>,
+
     /// Frequency of healthchecks performed by PgDog to ensure connections provided to clients from the pool are working.
     ///
     /// _Default:_ `30000`
@@ -156,6 +237,22 @@ pub struct General {
     #[serde(default = "General::idle_healthcheck_delay")]
     pub idle_healthcheck_delay: u64,
 
+    /// Shortest interval between idle healthchecks. Hosts that recently failed a healthcheck are checked this often, so their recovery is detected quickly. The interval then doubles after every successful healthcheck, up to `idle_healthcheck_max_interval`. Intervals are randomized by up to 10% so hosts aren't all checked at the same time.
+    ///
+    /// _Default:_ same as `idle_healthcheck_interval`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#idle_healthcheck_min_interval>
+    #[serde(default)]
+    pub idle_healthcheck_min_interval: Option<u64>,
+
+    /// Longest interval between idle healthchecks. Hosts that are consistently healthy are checked less and less often, up to this interval.
+    ///
+    /// _Default:_ same as `idle_healthcheck_interval`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#idle_healthcheck_max_interval>
+    #[serde(default)]
+    pub idle_healthcheck_max_interval: Option<u64>,
+
     /// Maximum amount of time to wait for a healthcheck query to complete.
     ///
     /// _Default:_ `5000`
@@ -189,6 +286,26 @@ pub struct General {
     #[serde(default = "General::ban_replica_lag_bytes")]
     pub ban_replica_lag_bytes: u64,
 
+    /// Stop sending read queries to a replica while its replication lag (in milliseconds) exceeds this threshold. Unlike `ban_replica_lag`, the replica is used again as soon as it catches up.
+    #[serde(default = "General::max_replica_lag")]
+    pub max_replica_lag: u64,
+
+    /// Stop sending read queries to a replica while its replication lag (in bytes) exceeds this threshold. Unlike `ban_replica_lag_bytes`, the replica is used again as soon as it catches up.
+    #[serde(default = "General::max_replica_lag_bytes")]
+    pub max_replica_lag_bytes: u64,
+
+    /// After a client's write commits, send its reads to the primary for this long (in milliseconds), so it doesn't read stale data from a replica that hasn't replayed the write yet. `0` disables it.
+    ///
+    /// _Default:_ `0`
+    #[serde(default = "General::read_your_writes_window")]
+    pub read_your_writes_window: u64,
+
+    /// Send reads to the primary when all replicas are banned, instead of returning an error to the client. Replicas stay banned until `ban_timeout` expires, so reads don't wait on them in the meantime. A replica is banned on errors even if it's the only one.
+    ///
+    /// _Default:_ `false`
+    #[serde(default = "General::read_fallback_to_primary")]
+    pub read_fallback_to_primary: bool,
+
     /// How long to allow for `ROLLBACK` queries to run on server connections with unfinished transactions.
     ///
     /// _Default:_ `5000`
@@ -205,6 +322,9 @@ pub struct General {
     #[serde(default = "General::load_balancing_strategy")]
     pub load_balancing_strategy: LoadBalancingStrategy,
 
+    /// Availability zone PgDog is running in. Replicas with the same `zone` are preferred for read queries; the others are used only if those are banned or saturated. Set to `auto` to detect it from the EC2 or GCP instance metadata at startup.
+    pub zone: Option<String>,
+
     /// How aggressive the query parser should be in determining read vs. write queries.
     ///
     /// _Default:_ `conservative`
@@ -221,6 +341,14 @@ pub struct General {
     #[serde(default)]
     pub read_write_split: ReadWriteSplit,
 
+    /// Send queries that only read system catalogs, i.e. tables in `pg_catalog` and `information_schema`, to replicas, even if the client would otherwise be sent to the primary. Queries inside transactions are not affected.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#catalog_reads_on_replicas>
+    #[serde(default)]
+    pub catalog_reads_on_replicas: bool,
+
     /// Path to the TLS certificate PgDog will use to setup TLS connections with clients.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#tls_certificate>
@@ -273,6 +401,16 @@ pub struct General {
     #[serde(default = "General::default_shutdown_termination_timeout")]
     pub shutdown_termination_timeout: Option<u64>,
 
+    /// How long clients should wait before reconnecting, in milliseconds. Sent to clients in the hint of the `admin_shutdown` error when shutting down, e.g. `reconnect_delay_ms=5000`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#shutdown_reconnect_delay>
+    pub shutdown_reconnect_delay: Option<u64>,
+
+    /// Another PgDog instance clients should reconnect to, e.g. `pgdog-2.internal:6432`. Sent to clients in the hint of the `admin_shutdown` error when shutting down, e.g. `alternate_endpoint=pgdog-2.internal:6432`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#shutdown_reconnect_endpoint>
+    pub shutdown_reconnect_endpoint: Option<String>,
+
     /// Broadcast IP address used for multi-instance coordination (e.g., schema cache invalidation across nodes).
     pub broadcast_address: Option<Ipv4Addr>,
 
@@ -306,7 +444,7 @@ pub struct General {
     /// Protects the query parser from very large SQL texts; other
     /// protocol messages (e.g. `Bind`, `CopyData`) are not affected.
     /// Depending on the setting `query_size_limit_action` oversized messages are
-    /// either logged or blocked.
+    /// logged, reported to the client with a `NOTICE`, or blocked.
     ///
     /// _Default:_ `None` (disabled)
     ///
@@ -322,6 +460,14 @@ pub struct General {
     #[serde(default = "General::query_size_limit_action")]
     pub query_size_limit_action: QuerySizeLimitAction,
 
+    /// Notices sent by Postgres that are less severe than this aren't forwarded to clients, except `INFO`, which is always sent, like in Postgres. Notices from queries that ran on multiple shards are sent once, no matter this setting.
+    ///
+    /// _Default:_ `debug`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#min_notice_severity>
+    #[serde(default = "General::min_notice_severity")]
+    pub min_notice_severity: NoticeSeverity,
+
     /// The port used for the OpenMetrics HTTP endpoint.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#openmetrics_port>
@@ -416,6 +562,22 @@ pub struct General {
     #[serde(default = "General::default_query_timeout")]
     pub query_timeout: u64,
 
+    /// Maximum number of times a statement executed outside of an explicit transaction is retried after failing with `serialization_failure` (`40001`) or `deadlock_detected` (`40P01`). `0` disables retries.
+    ///
+    /// _Default:_ `0`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#serialization_retry_max_attempts>
+    #[serde(default)]
+    pub serialization_retry_max_attempts: usize,
+
+    /// Base delay in milliseconds between serialization failure retries. Each successive attempt doubles the delay, capped at 32×.
+    ///
+    /// _Default:_ `10`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#serialization_retry_min_delay>
+    #[serde(default = "General::serialization_retry_min_delay")]
+    pub serialization_retry_min_delay: u64,
+
     /// Maximum amount of time a client is allowed to wait for a connection from the pool.
     ///
     /// _Default:_ `5000`
@@ -460,6 +622,36 @@ pub struct General {
     #[serde(default = "General::default_client_idle_in_transaction_timeout")]
     pub client_idle_in_transaction_timeout: u64,
 
+    /// Roll back transactions of clients that have been idle inside them for this amount of time and return their server connections to the pool. The client stays connected and receives an error on its next query, until it ends the transaction with `ROLLBACK` or `COMMIT`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#idle_in_transaction_timeout>
+    #[serde(default = "General::default_idle_in_transaction_timeout")]
+    pub idle_in_transaction_timeout: u64,
+
+    /// Send a `NOTICE` to clients whose transactions took longer than this, in milliseconds, and count them in the `transaction_duration_exceeded_total` metric. Transactions aren't interrupted, so this shows which clients a transaction time limit would affect before one is enforced.
+    ///
+    /// _Default:_ none (disabled)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#transaction_duration_notice>
+    #[serde(default)]
+    pub transaction_duration_notice: Option<u64>,
+
+    /// Send a keepalive message to clients that have been idle for this amount of time, in milliseconds, and every interval after that, so NAT gateways and load balancers between them and PgDog don't drop their connections. Doesn't affect `client_idle_timeout`.
+    ///
+    /// _Default:_ none (disabled)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#client_keepalive_interval>
+    #[serde(default)]
+    pub client_keepalive_interval: Option<u64>,
+
+    /// Message sent to idle clients as a keepalive: `parameter_status` repeats the client's `application_name`, `notice` is a `NoticeResponse` without any fields.
+    ///
+    /// _Default:_ `parameter_status`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#client_keepalive_message>
+    #[serde(default)]
+    pub client_keepalive_message: ClientKeepaliveMessage,
+
     /// Maximum amount of time a server connection is allowed to exist.
     ///
     /// _Default:_ `86400000`
@@ -504,10 +696,63 @@ pub struct General {
     #[serde(default)]
     pub auth_type: AuthType,
 
+    /// Query used to look up the password of users that aren't configured in `users.toml`. It's executed on the primary of the database the client is connecting to, as [`auth_user`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_user), with the user name bound to `$1`. It must return the user name and its password, in plain text, as an md5 hash or as a SCRAM-SHA-256 verifier, e.g., `SELECT usename, passwd FROM pgdog.user_lookup($1)`.
+    ///
+    /// **Note:** md5 hashes require [`auth_type`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_type) to be `md5`. Users authenticated with a SCRAM-SHA-256 verifier require [`auth_type`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_type) to be `scram`, and Postgres must accept their server connections without a password, e.g., via `trust`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_query>
+    #[serde(default)]
+    pub auth_query: Option<String>,
+
+    /// User configured in `users.toml` that runs [`auth_query`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_query).
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_user>
+    #[serde(default)]
+    pub auth_user: Option<String>,
+
+    /// Path to a pgbouncer-format `userlist.txt` with additional users allowed to connect. Passwords can be in plain text, md5 hashes or SCRAM-SHA-256 verifiers. Users in `users.toml` take precedence, and users from this file can connect to any database configured in `pgdog.toml`.
+    ///
+    /// **Note:** md5 hashes require [`auth_type`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_type) to be `md5` and SCRAM-SHA-256 verifiers require it to be `scram`. Postgres must accept server connections of users with SCRAM-SHA-256 verifiers without a password, e.g., via `trust`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_file>
+    #[serde(default)]
+    pub auth_file: Option<PathBuf>,
+
+    /// Client networks, in CIDR notation, allowed to connect without a password, e.g., `["127.0.0.1/32", "10.0.5.0/24"]`. If [`auth_type`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#auth_type) is `trust`, clients from any other network are rejected. The admin database always requires its password.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#trusted_networks>
+    #[serde(default)]
+    #[schemars(with = "Vec<String>")]
+    pub trusted_networks: Vec<Cidr>,
+
     /// Disable cross-shard queries globally. When enabled, queries touching more than one shard are rejected.
     #[serde(default)]
     pub cross_shard_disabled: bool,
 
+    /// Return rows of cross-shard queries ordered by shard number, i.e. all rows from shard 0, followed by all rows from shard 1, and so on. Rows are buffered in memory until all shards finish executing the query. `ORDER BY` in the query, if any, takes precedence.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#order_by_shard>
+    #[serde(default)]
+    pub order_by_shard: bool,
+
+    /// Add a field with the shard number and connection pool to errors returned by Postgres, so clients can tell which shard failed. The field uses the `g` code in the ErrorResponse message, e.g., `shard=3 pool=pgdog@10.0.0.3:5432/prod`. Clients ignore fields they don't recognize.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#error_shard_field>
+    #[serde(default)]
+    pub error_shard_field: bool,
+
+    /// Seed for the random number generator used in routing decisions: load balancing between replicas, picking a shard for omnisharded queries, mirror exposure, and connection lifetime and healthcheck jitter. With a seed set, these decisions repeat in the same order, which helps integration tests assert routing behavior. Not meant for production use.
+    ///
+    /// _Default:_ `None` (random)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#routing_seed>
+    #[serde(default)]
+    pub routing_seed: Option<u64>,
+
     /// Overrides the TTL set on DNS records received from DNS servers.
     ///
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#dns_ttl>
@@ -586,6 +831,16 @@ pub struct General {
     #[serde(default)]
     pub two_phase_commit_auto: Option<bool>,
 
+    /// Run DDL statements sent to multiple shards inside a two-phase commit transaction, so schema changes are applied to all shards or none of them. Requires [`two_phase_commit`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#two_phase_commit).
+    ///
+    /// **Note:** Statements that can't run inside a transaction block, like `CREATE INDEX CONCURRENTLY` or `VACUUM`, are not affected.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#two_phase_commit_ddl>
+    #[serde(default)]
+    pub two_phase_commit_ddl: bool,
+
     /// Directory where the two-phase commit write-ahead log is stored.
     ///
     /// **Note:** This setting cannot be changed at runtime. PgDog acquires an exclusive `flock` on `<dir>/.lock` at startup. If the directory cannot be created or written to, or another PgDog process already holds the lock, the WAL is disabled and a warning is logged: 2PC will continue to function but will not be durable across restarts.
@@ -642,6 +897,110 @@ pub struct General {
     #[serde(default = "General::connection_recovery")]
     pub connection_recovery: ConnectionRecovery,
 
+    /// Prefer giving a client the same server connection it used last time, if that connection is idle. Improves plan and buffer cache locality on the server for tenant-scoped workloads. Falls back to any idle connection otherwise.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#connection_affinity>
+    #[serde(default)]
+    pub connection_affinity: bool,
+
+    /// Order in which clients waiting for a server connection are served. `fifo` is fair to clients, `lifo` serves the most recent clients first, which keeps latency low for most clients under overload at the expense of a few.
+    ///
+    /// _Default:_ `fifo`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#client_queue_order>
+    #[serde(default)]
+    pub client_queue_order: QueueOrder,
+
+    /// Order in which idle server connections are given to clients. `lifo` reuses the most recently used connections, letting the rest expire with `idle_timeout`. `fifo` spreads traffic evenly across all connections.
+    ///
+    /// _Default:_ `lifo`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#server_queue_order>
+    #[serde(default = "General::server_queue_order")]
+    pub server_queue_order: QueueOrder,
+
+    /// Request protocol 3.2 when connecting to Postgres. Postgres 18 and later use it to send longer cancellation keys; older servers downgrade the connection to 3.0. Some proxies and poolers between PgDog and Postgres reject protocol 3.2 startup messages, so it's off unless enabled.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#server_protocol_3_2>
+    #[serde(default = "General::server_protocol_3_2")]
+    pub server_protocol_3_2: bool,
+
+    /// Enables fair scheduling of server connections between tenants sharing a pool. Clients are grouped into tenants by `fair_share_tenant`. When clients are waiting for a connection, the one whose tenant held server connections for the least time during this rolling window, in milliseconds, is served first, so one tenant's long transactions can't monopolize the pool.
+    ///
+    /// _Default:_ none (disabled)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#fair_share_window>
+    #[serde(default)]
+    pub fair_share_window: Option<u64>,
+
+    /// Startup parameter that groups clients sharing a pool into tenants for `fair_share_window`. The value the client connected with is used, so changing it with `SET` doesn't move the client to another tenant. Clients that don't send it are grouped by the user they logged in as.
+    ///
+    /// _Default:_ `application_name`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#fair_share_tenant>
+    #[serde(default = "General::fair_share_tenant")]
+    pub fair_share_tenant: String,
+
+    /// Maximum number of clients that can wait for a server connection in each pool. When the queue is full, new clients get an error (SQLSTATE `53300`) immediately instead of waiting for `checkout_timeout`, so applications can shed load.
+    ///
+    /// _Default:_ none (unlimited)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#max_waiting_clients>
+    #[serde(default)]
+    pub max_waiting_clients: Option<usize>,
+
+    /// Clients with these `application_name`s are served before other clients when they wait for a server connection. Takes precedence over the user's `priority`.
+    ///
+    /// _Default:_ none
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#high_priority_applications>
+    #[serde(default)]
+    pub high_priority_applications: Vec<String>,
+
+    /// Clients with these `application_name`s, e.g. background jobs, are served after other clients when they wait for a server connection and can only use `low_priority_pool_percent` of the pool. Takes precedence over the user's `priority`.
+    ///
+    /// _Default:_ none
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#low_priority_applications>
+    #[serde(default)]
+    pub low_priority_applications: Vec<String>,
+
+    /// Percentage of each pool's connections that low priority clients can use at the same time, so they can't starve other clients.
+    ///
+    /// _Default:_ `50`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#low_priority_pool_percent>
+    #[serde(default = "General::low_priority_pool_percent")]
+    pub low_priority_pool_percent: u8,
+
+    /// Settings clients can change with `-c` in the `options` startup parameter, e.g. `options=-c statement_timeout=5s`. Other settings passed this way are ignored. PgDog settings like `pgdog.role` are always allowed.
+    ///
+    /// _Default:_ none (all settings are allowed)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#allowed_startup_options>
+    #[serde(default)]
+    pub allowed_startup_options: Option<Vec<String>>,
+
+    /// Enables pool autoscaling. Each pool starts with `pool_size` connections and grows up to this many when clients wait for connections longer than `autoscale_wait_target`, then shrinks back towards `pool_size` when they are mostly unused. Pools are re-evaluated every `stats_period`.
+    ///
+    /// _Default:_ none (disabled)
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#autoscale_max_pool_size>
+    #[serde(default)]
+    pub autoscale_max_pool_size: Option<usize>,
+
+    /// 95th percentile of checkout wait time, in milliseconds, above which the autoscaler grows the pool.
+    ///
+    /// _Default:_ `10`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#autoscale_wait_target>
+    #[serde(default = "General::autoscale_wait_target")]
+    pub autoscale_wait_target: u64,
+
     /// Controls whether to disconnect clients upon encountering connection pool errors.
     ///
     /// **Note:** Set this to `drop` if your clients are async / use pipelining mode.
@@ -674,6 +1033,14 @@ pub struct General {
     #[serde(default = "General::lsn_check_delay")]
     pub lsn_check_delay: u64,
 
+    /// For how long to keep LSN and replica lag samples of each server, in milliseconds. They are exported as JSON by the OpenMetrics endpoint at `/lsn`. Set to `0` to only export the latest sample.
+    ///
+    /// _Default:_ `300000`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#lsn_history>
+    #[serde(default = "General::lsn_history")]
+    pub lsn_history: u64,
+
     /// Minimum ID for unique ID generator.
     #[serde(default)]
     pub unique_id_min: u64,
@@ -698,6 +1065,12 @@ pub struct General {
     #[serde(default)]
     pub omnisharded_sticky: bool,
 
+    /// Maximum number of parent rows, per database, for which PgDog remembers the shard. Used to route queries on child tables configured in `[[routing_relationships]]`. The least recently used rows are forgotten first.
+    ///
+    /// _Default:_ `100000`
+    #[serde(default = "General::routing_relationships_cache_limit")]
+    pub routing_relationships_cache_limit: usize,
+
     /// Which format to use for `COPY` statements during resharding.
     ///
     /// **Note:** Text format is required when migrating from `INTEGER` to `BIGINT` primary keys during resharding.
@@ -813,22 +1186,36 @@ impl Default for General {
         Self {
             host: Self::host(),
             port: Self::port(),
+            gss_encryption: GssEncryption::default(),
+            unix_socket_dir: Self::unix_socket_dir(),
+            unix_socket_permissions: Self::unix_socket_permissions(),
+            unix_socket_peer_auth: Self::unix_socket_peer_auth(),
+            unix_socket_gss_encryption: GssEncryption::default(),
             workers: Self::workers(),
             default_pool_size: Self::default_pool_size(),
             min_pool_size: Self::min_pool_size(),
             pooler_mode: Self::pooler_mode(),
+            session_pool_size: None,
             healthcheck_interval: Self::healthcheck_interval(),
             idle_healthcheck_interval: Self::idle_healthcheck_interval(),
             idle_healthcheck_delay: Self::idle_healthcheck_delay(),
+            idle_healthcheck_min_interval: None,
+            idle_healthcheck_max_interval: None,
             healthcheck_timeout: Self::healthcheck_timeout(),
             healthcheck_port: Self::healthcheck_port(),
             ban_timeout: Self::ban_timeout(),
             ban_replica_lag: Self::ban_replica_lag(),
             ban_replica_lag_bytes: Self::ban_replica_lag_bytes(),
+            max_replica_lag: Self::max_replica_lag(),
+            max_replica_lag_bytes: Self::max_replica_lag_bytes(),
+            read_your_writes_window: Self::read_your_writes_window(),
+            read_fallback_to_primary: Self::read_fallback_to_primary(),
             rollback_timeout: Self::rollback_timeout(),
             load_balancing_strategy: Self::load_balancing_strategy(),
+            zone: Self::zone(),
             read_write_strategy: Self::read_write_strategy(),
             read_write_split: Self::read_write_split(),
+            catalog_reads_on_replicas: bool::default(),
             tls_certificate: Self::tls_certificate(),
             tls_private_key: Self::tls_private_key(),
             tls_client_required: bool::default(),
@@ -837,6 +1224,8 @@ impl Default for General {
             tls_client_ca_certificate: Self::tls_client_ca_certificate(),
             shutdown_timeout: Self::default_shutdown_timeout(),
             shutdown_termination_timeout: Self::default_shutdown_termination_timeout(),
+            shutdown_reconnect_delay: None,
+            shutdown_reconnect_endpoint: None,
             broadcast_address: Self::broadcast_address(),
             broadcast_port: Self::broadcast_port(),
             query_log: Self::query_log(),
@@ -845,6 +1234,7 @@ impl Default for General {
             log_query_sample_length: Self::log_query_sample_length(),
             query_size_limit: Self::default_query_size_limit(),
             query_size_limit_action: Self::query_size_limit_action(),
+            min_notice_severity: Self::min_notice_severity(),
             openmetrics_port: Self::openmetrics_port(),
             openmetrics_namespace: Self::openmetrics_namespace(),
             prepared_statements: Self::prepared_statements(),
@@ -859,16 +1249,29 @@ impl Default for General {
             connect_attempt_delay: Self::default_connect_attempt_delay(),
             connect_attempts: Self::connect_attempts(),
             query_timeout: Self::default_query_timeout(),
+            serialization_retry_max_attempts: usize::default(),
+            serialization_retry_min_delay: Self::serialization_retry_min_delay(),
             checkout_timeout: Self::checkout_timeout(),
             client_login_timeout: Self::client_login_timeout(),
             dry_run: Self::dry_run(),
             idle_timeout: Self::idle_timeout(),
             client_idle_timeout: Self::default_client_idle_timeout(),
             client_idle_in_transaction_timeout: Self::default_client_idle_in_transaction_timeout(),
+            idle_in_transaction_timeout: Self::default_idle_in_transaction_timeout(),
+            transaction_duration_notice: None,
+            client_keepalive_interval: None,
+            client_keepalive_message: ClientKeepaliveMessage::default(),
             mirror_queue: Self::mirror_queue(),
             mirror_exposure: Self::mirror_exposure(),
             auth_type: Self::auth_type(),
+            auth_query: None,
+            auth_user: None,
+            auth_file: None,
+            trusted_networks: Vec::new(),
             cross_shard_disabled: Self::cross_shard_disabled(),
+            order_by_shard: bool::default(),
+            error_shard_field: bool::default(),
+            routing_seed: None,
             dns_ttl: Self::default_dns_ttl(),
             pub_sub_channel_size: Self::pub_sub_channel_size(),
             log_format: Self::log_format(),
@@ -879,6 +1282,7 @@ impl Default for General {
             log_dedup_threshold: 0,
             two_phase_commit: bool::default(),
             two_phase_commit_auto: None,
+            two_phase_commit_ddl: false,
             two_phase_commit_wal_dir: Self::two_phase_commit_wal_dir(),
             two_phase_commit_wal_segment_size: Self::two_phase_commit_wal_segment_size(),
             two_phase_commit_wal_fsync_interval: Self::two_phase_commit_wal_fsync_interval(),
@@ -889,13 +1293,28 @@ impl Default for General {
             server_lifetime_jitter: Self::server_lifetime_jitter(),
             stats_period: Self::stats_period(),
             connection_recovery: Self::connection_recovery(),
+            connection_affinity: bool::default(),
+            client_queue_order: QueueOrder::default(),
+            server_queue_order: Self::server_queue_order(),
+            server_protocol_3_2: Self::server_protocol_3_2(),
+            fair_share_window: None,
+            fair_share_tenant: Self::fair_share_tenant(),
+            max_waiting_clients: None,
+            high_priority_applications: vec![],
+            low_priority_applications: vec![],
+            low_priority_pool_percent: Self::low_priority_pool_percent(),
+            allowed_startup_options: None,
+            autoscale_max_pool_size: None,
+            autoscale_wait_target: Self::autoscale_wait_target(),
             client_connection_recovery: Self::client_connection_recovery(),
             lsn_check_interval: Self::lsn_check_interval(),
             lsn_check_timeout: Self::lsn_check_timeout(),
             lsn_check_delay: Self::lsn_check_delay(),
+            lsn_history: Self::lsn_history(),
             unique_id_min: u64::default(),
             system_catalogs: Self::default_system_catalogs(),
             omnisharded_sticky: bool::default(),
+            routing_relationships_cache_limit: Self::routing_relationships_cache_limit(),
             resharding_copy_format: CopyFormat::default(),
             resharding_parallel_copies: Self::resharding_parallel_copies(),
             resharding_copy_retry_max_attempts: Self::resharding_copy_retry_max_attempts(),
@@ -962,6 +1381,22 @@ impl General {
         Self::env_or_default("PGDOG_PORT", 6432)
     }
 
+    fn unix_socket_dir() -> Option<PathBuf> {
+        Self::env_option_string("PGDOG_UNIX_SOCKET_DIR").map(PathBuf::from)
+    }
+
+    fn unix_socket_permissions() -> u32 {
+        // Octal, like chmod.
+        env::var("PGDOG_UNIX_SOCKET_PERMISSIONS")
+            .ok()
+            .and_then(|v| u32::from_str_radix(v.trim_start_matches("0o"), 8).ok())
+            .unwrap_or(0o770)
+    }
+
+    fn unix_socket_peer_auth() -> bool {
+        Self::env_bool_or_default("PGDOG_UNIX_SOCKET_PEER_AUTH", false)
+    }
+
     fn workers() -> usize {
         Self::env_or_default("PGDOG_WORKERS", 2)
     }
@@ -1015,6 +1450,26 @@ impl General {
         Self::env_or_default("PGDOG_BAN_REPLICA_LAG_BYTES", i64::MAX as u64)
     }
 
+    fn max_replica_lag() -> u64 {
+        Self::env_or_default("PGDOG_MAX_REPLICA_LAG", i64::MAX as u64)
+    }
+
+    fn max_replica_lag_bytes() -> u64 {
+        Self::env_or_default("PGDOG_MAX_REPLICA_LAG_BYTES", i64::MAX as u64)
+    }
+
+    fn read_your_writes_window() -> u64 {
+        Self::env_or_default("PGDOG_READ_YOUR_WRITES_WINDOW", 0)
+    }
+
+    fn low_priority_pool_percent() -> u8 {
+        Self::env_or_default("PGDOG_LOW_PRIORITY_POOL_PERCENT", 50)
+    }
+
+    fn read_fallback_to_primary() -> bool {
+        Self::env_bool_or_default("PGDOG_READ_FALLBACK_TO_PRIMARY", false)
+    }
+
     fn unique_id_function() -> UniqueIdFunction {
         Self::env_enum_or_default("PGDOG_UNIQUE_ID_FUNCTION")
     }
@@ -1090,6 +1545,13 @@ impl General {
         )
     }
 
+    fn default_idle_in_transaction_timeout() -> u64 {
+        Self::env_or_default(
+            "PGDOG_IDLE_IN_TRANSACTION_TIMEOUT",
+            crate::MAX_DURATION.as_millis() as u64,
+        )
+    }
+
     fn default_query_timeout() -> u64 {
         Self::env_or_default(
             "PGDOG_QUERY_TIMEOUT",
@@ -1117,6 +1579,16 @@ impl General {
         Duration::from_millis(self.client_idle_in_transaction_timeout)
     }
 
+    pub fn idle_in_transaction_timeout(&self) -> Duration {
+        Duration::from_millis(self.idle_in_transaction_timeout)
+    }
+
+    pub fn client_keepalive_interval(&self) -> Duration {
+        self.client_keepalive_interval
+            .map(Duration::from_millis)
+            .unwrap_or(Duration::MAX)
+    }
+
     fn load_balancing_strategy() -> LoadBalancingStrategy {
         Self::env_enum_or_default("PGDOG_LOAD_BALANCING_STRATEGY")
     }
@@ -1140,6 +1612,10 @@ impl General {
         1
     }
 
+    fn serialization_retry_min_delay() -> u64 {
+        10
+    }
+
     fn resharding_copy_retry_max_attempts() -> usize {
         5
     }
@@ -1191,6 +1667,10 @@ impl General {
         )
     }
 
+    fn lsn_history() -> u64 {
+        Self::env_or_default("PGDOG_LSN_HISTORY", 300_000)
+    }
+
     pub fn lsn_checks_enabled(&self) -> bool {
         self.lsn_check_delay < crate::MAX_DURATION.as_millis() as u64
     }
@@ -1259,10 +1739,18 @@ impl General {
         Self::env_enum_or_default("PGDOG_QUERY_SIZE_LIMIT_ACTION")
     }
 
+    fn min_notice_severity() -> NoticeSeverity {
+        Self::env_enum_or_default("PGDOG_MIN_NOTICE_SEVERITY")
+    }
+
     pub fn openmetrics_port() -> Option<u16> {
         Self::env_option("PGDOG_OPENMETRICS_PORT")
     }
 
+    fn zone() -> Option<String> {
+        Self::env_option_string("PGDOG_ZONE")
+    }
+
     pub fn openmetrics_namespace() -> Option<String> {
         Self::env_option_string("PGDOG_OPENMETRICS_NAMESPACE")
     }
@@ -1321,6 +1809,10 @@ impl General {
         Self::env_or_default("PGDOG_PREPARED_STATEMENTS_LIMIT", i64::MAX as usize)
     }
 
+    pub fn routing_relationships_cache_limit() -> usize {
+        100_000
+    }
+
     pub fn query_cache_limit() -> usize {
         Self::env_or_default("PGDOG_QUERY_CACHE_LIMIT", 1_000)
     }
@@ -1356,6 +1848,22 @@ impl General {
         Self::env_or_default("PGDOG_SERVER_LIFETIME_JITTER", 0)
     }
 
+    pub fn server_queue_order() -> QueueOrder {
+        QueueOrder::Lifo
+    }
+
+    pub fn server_protocol_3_2() -> bool {
+        Self::env_bool_or_default("PGDOG_SERVER_PROTOCOL_3_2", false)
+    }
+
+    fn fair_share_tenant() -> String {
+        "application_name".into()
+    }
+
+    fn autoscale_wait_target() -> u64 {
+        10
+    }
+
     pub fn connection_recovery() -> ConnectionRecovery {
         Self::env_enum_or_default("PGDOG_CONNECTION_RECOVERY")
     }
@@ -1402,6 +1910,20 @@ impl General {
         None
     }
 
+    /// Path to the UNIX domain socket clients can connect to, if any.
+    pub fn unix_socket_path(&self) -> Option<PathBuf> {
+        self.unix_socket_dir
+            .as_ref()
+            .map(|dir| dir.join(format!(".s.PGSQL.{}", self.port)))
+    }
+
+    /// Is the client connecting from a trusted network?
+    pub fn trusted_network(&self, addr: IpAddr) -> bool {
+        self.trusted_networks
+            .iter()
+            .any(|network| network.contains(addr))
+    }
+
     pub fn passthrough_auth(&self) -> bool {
         self.tls().is_some()
             && matches!(
@@ -1568,6 +2090,39 @@ mod tests {
         assert_eq!(General::port(), 6432);
     }
 
+    #[test]
+    fn test_env_unix_socket() {
+        let _guard = set_env_var("PGDOG_UNIX_SOCKET_DIR", "/var/run/pgdog");
+        let _guard = set_env_var("PGDOG_UNIX_SOCKET_PERMISSIONS", "0700");
+        let _guard = set_env_var("PGDOG_UNIX_SOCKET_PEER_AUTH", "true");
+
+        assert_eq!(
+            General::unix_socket_dir(),
+            Some(PathBuf::from("/var/run/pgdog"))
+        );
+        assert_eq!(General::unix_socket_permissions(), 0o700);
+        assert!(General::unix_socket_peer_auth());
+
+        let general = General {
+            unix_socket_dir: General::unix_socket_dir(),
+            port: 6433,
+            ..Default::default()
+        };
+        assert_eq!(
+            general.unix_socket_path(),
+            Some(PathBuf::from("/var/run/pgdog/.s.PGSQL.6433"))
+        );
+
+        let _guard = remove_env_var("PGDOG_UNIX_SOCKET_DIR");
+        let _guard = remove_env_var("PGDOG_UNIX_SOCKET_PERMISSIONS");
+        let _guard = remove_env_var("PGDOG_UNIX_SOCKET_PEER_AUTH");
+
+        assert_eq!(General::unix_socket_dir(), None);
+        assert_eq!(General::unix_socket_permissions(), 0o770);
+        assert!(!General::unix_socket_peer_auth());
+        assert_eq!(General::default().unix_socket_path(), None);
+    }
+
     #[test]
     fn test_lsn_checks_enabled() {
         let mut general = General::default();
@@ -5,19 +5,23 @@ pub mod data_types;
 pub mod database;
 pub mod error;
 pub mod general;
+pub mod maintenance;
 pub mod memory;
 pub mod networking;
 pub mod otel;
 pub mod overrides;
 pub mod pooling;
+pub mod query_routing;
 pub mod replication;
 pub mod rewrite;
 pub mod sharding;
+pub mod stats_export;
 pub mod system_catalogs;
 #[cfg(test)]
 #[path = "../../pgdog/src/test_utils.rs"]
 pub(crate) mod test_utils;
 pub mod url;
+pub mod userlist;
 pub mod users;
 pub mod util;
 pub mod vault;
@@ -29,16 +33,22 @@ pub use database::{
     Database, EnumeratedDatabase, LoadBalancingStrategy, ReadWriteSplit, ReadWriteStrategy, Role,
 };
 pub use error::Error;
-pub use general::{General, LogFormat, QuerySizeLimitAction};
+pub use general::{General, LogFormat, NoticeSeverity, QuerySizeLimitAction};
+pub use maintenance::{CronSchedule, MaintenanceWindow};
 pub use memory::*;
-pub use networking::{MultiTenant, Tcp, TlsVerifyMode};
+pub use networking::{
+    Cidr, ClientKeepaliveMessage, GssEncryption, MultiTenant, SniRoute, Tcp, TlsVerifyMode,
+};
 pub use otel::Otel;
 pub use overrides::Overrides;
-pub use pooling::{PoolerMode, PreparedStatements};
+pub use pooling::{ClientProfile, PoolerMode, PreparedStatements, Priority, QueueOrder};
+pub use query_routing::{QueryRoutingPool, QueryRoutingRule};
 pub use replication::*;
 pub use rewrite::{Rewrite, RewriteMode};
 pub use sharding::*;
+pub use stats_export::{StatsExport, StatsExportProvider};
 pub use system_catalogs::system_catalogs;
+pub use userlist::UserList;
 pub use users::{Admin, Plugin, ServerAuth, User, Users};
 pub use vault::{Vault, VaultAuthMethod};
 
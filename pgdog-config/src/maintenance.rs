@@ -0,0 +1,253 @@
+//! Scheduled maintenance windows.
+
+use std::fmt::Display;
+use std::str::FromStr;
+
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+
+use crate::Error;
+
+/// Maintenance windows give the database headroom for operations like `VACUUM FULL` or index builds by lowering the pool size or pausing specific users on a schedule. Settings are restored automatically when the window ends.
+///
+/// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/>
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, JsonSchema)]
+#[serde(deny_unknown_fields)]
+pub struct MaintenanceWindow {
+    /// Name of the database this window applies to. This should be a `name` configured in the [`databases`](https://docs.pgdog.dev/configuration/pgdog.toml/databases/) section of `pgdog.toml`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/#database>
+    pub database: String,
+
+    /// Cron expression (`minute hour day-of-month month day-of-week`) of when the window starts, evaluated in UTC, e.g., `0 3 * * 0` for 3 AM every Sunday.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/#schedule>
+    #[schemars(with = "String")]
+    pub schedule: CronSchedule,
+
+    /// How long the window lasts, in milliseconds.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/#duration>
+    pub duration: u64,
+
+    /// Maximum number of server connections per pool while the window is active. Pools that are already smaller are not changed.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/#pool_size>
+    pub pool_size: Option<usize>,
+
+    /// Users whose connection pools are paused while the window is active. Their clients wait until the window ends.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/maintenance_windows/#paused_users>
+    #[serde(default)]
+    pub paused_users: Vec<String>,
+}
+
+/// Parsed cron expression with five fields: minute, hour,
+/// day of month, month and day of week.
+///
+/// Each field supports `*`, single values, ranges (`1-5`), steps (`*/15`, `0-30/10`)
+/// and lists (`1,15`). Day of week is `0-7`, with both `0` and `7` meaning Sunday.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(try_from = "String", into = "String")]
+pub struct CronSchedule {
+    expression: String,
+    minutes: u64,
+    hours: u64,
+    days: u64,
+    months: u64,
+    weekdays: u64,
+    // Per cron convention, if both day fields are restricted,
+    // either one matching is enough.
+    any_day: bool,
+}
+
+impl CronSchedule {
+    /// Does the schedule fire at this time?
+    ///
+    /// `weekday` is `0-6`, starting on Sunday.
+    pub fn matches(&self, minute: u32, hour: u32, day: u32, month: u32, weekday: u32) -> bool {
+        let day_matches = bit(self.days, day);
+        let weekday_matches = bit(self.weekdays, weekday);
+
+        let days = if self.any_day {
+            day_matches || weekday_matches
+        } else {
+            day_matches && weekday_matches
+        };
+
+        bit(self.minutes, minute) && bit(self.hours, hour) && bit(self.months, month) && days
+    }
+}
+
+fn bit(set: u64, value: u32) -> bool {
+    value < 64 && set & (1 << value) != 0
+}
+
+/// Parse one cron field into a bitset of allowed values.
+fn parse_field(field: &str, min: u32, max: u32) -> Result<u64, Error> {
+    let error = || Error::ParseError(format!("invalid cron field \"{}\"", field));
+    let mut set = 0;
+
+    for part in field.split(',') {
+        let (range, step) = match part.split_once('/') {
+            Some((range, step)) => (range, step.parse::<u32>().map_err(|_| error())?),
+            None => (part, 1),
+        };
+
+        let (start, end) = if range == "*" {
+            (min, max)
+        } else if let Some((start, end)) = range.split_once('-') {
+            (
+                start.parse().map_err(|_| error())?,
+                end.parse().map_err(|_| error())?,
+            )
+        } else {
+            let value = range.parse().map_err(|_| error())?;
+            // A single value with a step, e.g. `5/15`, runs until the end of the range.
+            if part.contains('/') {
+                (value, max)
+            } else {
+                (value, value)
+            }
+        };
+
+        if step == 0 || start < min || end > max || start > end {
+            return Err(error());
+        }
+
+        for value in (start..=end).step_by(step as usize) {
+            set |= 1 << value;
+        }
+    }
+
+    Ok(set)
+}
+
+impl FromStr for CronSchedule {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let fields = s.split_whitespace().collect::<Vec<_>>();
+
+        let [minutes, hours, days, months, weekdays] = fields[..] else {
+            return Err(Error::ParseError(format!(
+                "cron expression \"{}\" must have 5 fields",
+                s
+            )));
+        };
+
+        let mut weekdays_set = parse_field(weekdays, 0, 7)?;
+        // 7 is Sunday, same as 0.
+        if weekdays_set & (1 << 7) != 0 {
+            weekdays_set = (weekdays_set | 1) & !(1 << 7);
+        }
+
+        Ok(Self {
+            expression: s.to_owned(),
+            minutes: parse_field(minutes, 0, 59)?,
+            hours: parse_field(hours, 0, 23)?,
+            days: parse_field(days, 1, 31)?,
+            months: parse_field(months, 1, 12)?,
+            weekdays: weekdays_set,
+            any_day: !days.starts_with('*') && !weekdays.starts_with('*'),
+        })
+    }
+}
+
+impl TryFrom<String> for CronSchedule {
+    type Error = Error;
+
+    fn try_from(value: String) -> Result<Self, Self::Error> {
+        value.parse()
+    }
+}
+
+impl From<CronSchedule> for String {
+    fn from(value: CronSchedule) -> Self {
+        value.expression
+    }
+}
+
+impl Display for CronSchedule {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{}", self.expression)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_cron_schedule() {
+        // 3:30 AM on Sundays.
+        let schedule: CronSchedule = "30 3 * * 0".parse().unwrap();
+        assert!(schedule.matches(30, 3, 12, 5, 0));
+        assert!(!schedule.matches(31, 3, 12, 5, 0));
+        assert!(!schedule.matches(30, 3, 12, 5, 1));
+
+        // 7 is Sunday too.
+        let schedule: CronSchedule = "30 3 * * 7".parse().unwrap();
+        assert!(schedule.matches(30, 3, 12, 5, 0));
+
+        // Steps, ranges and lists.
+        let schedule: CronSchedule = "*/15 1-3,22 * 1,6 1-5".parse().unwrap();
+        assert!(schedule.matches(45, 22, 1, 6, 3));
+        assert!(!schedule.matches(40, 22, 1, 6, 3));
+        assert!(!schedule.matches(0, 4, 1, 6, 3));
+        assert!(!schedule.matches(0, 1, 1, 7, 3));
+        assert!(!schedule.matches(0, 1, 1, 6, 6));
+
+        // Day of month or day of week.
+        let schedule: CronSchedule = "0 0 1 * 1".parse().unwrap();
+        assert!(schedule.matches(0, 0, 1, 2, 4));
+        assert!(schedule.matches(0, 0, 9, 2, 1));
+        assert!(!schedule.matches(0, 0, 9, 2, 4));
+    }
+
+    #[test]
+    fn test_cron_schedule_invalid() {
+        for expression in [
+            "",
+            "* * * *",
+            "60 * * * *",
+            "* * 0 * *",
+            "*/0 * * * *",
+            "5-1 * * * *",
+            "a * * * *",
+        ] {
+            assert!(
+                expression.parse::<CronSchedule>().is_err(),
+                "{}",
+                expression
+            );
+        }
+    }
+
+    #[test]
+    fn test_maintenance_window_toml() {
+        let window: MaintenanceWindow = toml::from_str(
+            r#"
+database = "prod"
+schedule = "0 3 * * 0"
+duration = 3600000
+pool_size = 5
+paused_users = ["analytics"]
+"#,
+        )
+        .unwrap();
+
+        assert_eq!(window.schedule.to_string(), "0 3 * * 0");
+        assert_eq!(window.pool_size, Some(5));
+        assert_eq!(window.paused_users, vec!["analytics".to_string()]);
+
+        let error = toml::from_str::<MaintenanceWindow>(
+            r#"
+database = "prod"
+schedule = "0 25 * * 0"
+duration = 3600000
+"#,
+        );
+        assert!(error.is_err());
+    }
+}
@@ -30,6 +30,14 @@ pub struct Memory {
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/memory/#stack_size>
     #[serde(default = "default_stack_size")]
     pub stack_size: usize,
+
+    /// `DataRow` and `CopyData` messages larger than this, in bytes, are forwarded from the server to the client in parts as they arrive, instead of being read into memory first. Only applies to queries sent to a single shard. `0` disables streaming.
+    ///
+    /// _Default:_ `16777216`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/memory/#message_stream_threshold>
+    #[serde(default = "default_message_stream_threshold")]
+    pub message_stream_threshold: usize,
 }
 
 impl Default for Memory {
@@ -38,6 +46,7 @@ impl Default for Memory {
             net_buffer: default_net_buffer(),
             message_buffer: default_message_buffer(),
             stack_size: default_stack_size(),
+            message_stream_threshold: default_message_stream_threshold(),
         }
     }
 }
@@ -54,3 +63,8 @@ fn default_message_buffer() -> usize {
 fn default_stack_size() -> usize {
     2 * 1024 * 1024
 }
+
+// Default: 16MiB.
+fn default_message_stream_threshold() -> usize {
+    16 * 1024 * 1024
+}
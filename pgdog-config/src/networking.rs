@@ -1,7 +1,10 @@
 use serde::{Deserialize, Serialize};
+use std::fmt::Display;
+use std::net::IpAddr;
 use std::str::FromStr;
 use std::time::Duration;
 
+use crate::Error;
 use crate::util::human_duration_optional;
 use schemars::JsonSchema;
 
@@ -149,6 +152,103 @@ impl Tcp {
     }
 }
 
+/// Message sent to idle clients to keep their connections alive.
+///
+/// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#client_keepalive_message>
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, Default, PartialEq, Eq, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum ClientKeepaliveMessage {
+    /// `ParameterStatus` repeating the client's current `application_name`.
+    #[default]
+    ParameterStatus,
+    /// `NoticeResponse` without any fields.
+    Notice,
+}
+
+/// Reply to clients requesting GSSAPI encryption, which PgDog doesn't support.
+///
+/// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#gss_encryption>
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, Default, PartialEq, Eq, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum GssEncryption {
+    /// Decline it, the client continues with TLS or without encryption on the same connection.
+    #[default]
+    Decline,
+    /// Send an error and close the connection. Clients that prefer GSS encryption
+    /// reconnect without it, clients that require it report the error.
+    Reject,
+}
+
+/// IP network in CIDR notation, e.g., `10.0.0.0/8` or `::1/128`.
+/// An address without a prefix length matches only itself.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(try_from = "String", into = "String")]
+pub struct Cidr {
+    network: IpAddr,
+    prefix: u8,
+}
+
+impl Cidr {
+    /// Is the address inside this network?
+    pub fn contains(&self, addr: IpAddr) -> bool {
+        // IPv4 clients of a dual-stack listener show up as IPv4-mapped IPv6 addresses.
+        match (self.network, addr.to_canonical()) {
+            (IpAddr::V4(network), IpAddr::V4(addr)) => {
+                let mask = u32::MAX.checked_shl(32 - self.prefix as u32).unwrap_or(0);
+                u32::from(network) & mask == u32::from(addr) & mask
+            }
+            (IpAddr::V6(network), IpAddr::V6(addr)) => {
+                let mask = u128::MAX.checked_shl(128 - self.prefix as u32).unwrap_or(0);
+                u128::from(network) & mask == u128::from(addr) & mask
+            }
+            _ => false,
+        }
+    }
+}
+
+impl FromStr for Cidr {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let error = || Error::ParseError(format!("invalid network \"{}\"", s));
+        let (network, prefix) = s.split_once('/').unwrap_or((s, ""));
+        let network: IpAddr = network.trim().parse().map_err(|_| error())?;
+        let max = if network.is_ipv4() { 32 } else { 128 };
+
+        let prefix = if prefix.is_empty() {
+            max
+        } else {
+            prefix.trim().parse().map_err(|_| error())?
+        };
+
+        if prefix > max {
+            return Err(error());
+        }
+
+        Ok(Self { network, prefix })
+    }
+}
+
+impl TryFrom<String> for Cidr {
+    type Error = Error;
+
+    fn try_from(value: String) -> Result<Self, Self::Error> {
+        value.parse()
+    }
+}
+
+impl From<Cidr> for String {
+    fn from(value: Cidr) -> Self {
+        value.to_string()
+    }
+}
+
+impl Display for Cidr {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{}/{}", self.network, self.prefix)
+    }
+}
+
 /// multi-tenant routing configuration, mapping queries to shards via a tenant identifier column.
 #[derive(Serialize, Deserialize, PartialEq, Debug, Clone)]
 #[serde(rename_all = "snake_case")]
@@ -157,3 +257,42 @@ pub struct MultiTenant {
     /// Name of the column carrying the tenant identifier used to route queries.
     pub column: String,
 }
+
+/// Route clients to a database by the hostname they connected to, sent with TLS SNI. Lets multiple databases share one address, e.g. `tenant-a.db.example.com` and `tenant-b.db.example.com`.
+#[derive(Serialize, Deserialize, PartialEq, Debug, Clone, JsonSchema)]
+#[serde(deny_unknown_fields)]
+pub struct SniRoute {
+    /// Hostname sent by the client with TLS SNI, e.g. `tenant-a.db.example.com`. Compared case-insensitively.
+    pub hostname: String,
+    /// Name of the database used by clients connecting with this hostname, regardless of the database in their connection string. This should be a `name` configured in the [`databases`](https://docs.pgdog.dev/configuration/pgdog.toml/databases/) section of `pgdog.toml`.
+    pub database: String,
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_cidr() {
+        let cidr: Cidr = "10.0.5.0/24".parse().unwrap();
+        assert!(cidr.contains("10.0.5.17".parse().unwrap()));
+        assert!(cidr.contains("::ffff:10.0.5.17".parse().unwrap()));
+        assert!(!cidr.contains("10.0.6.1".parse().unwrap()));
+        assert!(!cidr.contains("::1".parse().unwrap()));
+
+        let cidr: Cidr = "127.0.0.1".parse().unwrap();
+        assert_eq!(cidr.to_string(), "127.0.0.1/32");
+        assert!(cidr.contains("127.0.0.1".parse().unwrap()));
+        assert!(!cidr.contains("127.0.0.2".parse().unwrap()));
+
+        let cidr: Cidr = "::1/128".parse().unwrap();
+        assert!(cidr.contains("::1".parse().unwrap()));
+
+        let cidr: Cidr = "0.0.0.0/0".parse().unwrap();
+        assert!(cidr.contains("192.168.1.1".parse().unwrap()));
+
+        for invalid in ["10.0.0.0/33", "localhost", "10.0.0.0/abc", "::/129"] {
+            assert!(invalid.parse::<Cidr>().is_err(), "{}", invalid);
+        }
+    }
+}
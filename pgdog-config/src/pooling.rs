@@ -56,6 +56,58 @@ impl FromStr for PreparedStatements {
     }
 }
 
+/// Client driver, enabling workarounds for its quirks.
+///
+/// <https://docs.pgdog.dev/configuration/users.toml/users/#client_profile>
+#[derive(
+    Serialize, Deserialize, Debug, Clone, Copy, Default, PartialEq, Eq, Ord, PartialOrd, JsonSchema,
+)]
+#[serde(rename_all = "snake_case")]
+pub enum ClientProfile {
+    /// No driver-specific workarounds (default).
+    #[default]
+    Generic,
+    /// PostgreSQL JDBC driver. Sends queries as unnamed statements until `prepareThreshold` is reached, so unnamed statements are cached and rewritten.
+    Jdbc,
+    /// Npgsql (.NET). Resets connections returned to its pool with `DISCARD ALL` and prepares statements again afterwards, so `DISCARD` forgets the client's prepared statements.
+    Npgsql,
+    /// asyncpg (Python). With its statement cache disabled, it prepares and executes unnamed statements in separate requests, so unnamed statements are cached and rewritten.
+    Asyncpg,
+    /// lib/pq (Go). Runs all parameterized queries as unnamed statements, so they are cached and rewritten.
+    Pq,
+}
+
+impl ClientProfile {
+    /// Prepared statements mode for this driver.
+    ///
+    /// Drivers relying on unnamed statements upgrade `extended` to `extended_anonymous`.
+    pub fn prepared_statements(&self, level: PreparedStatements) -> PreparedStatements {
+        match (self, level) {
+            (Self::Jdbc | Self::Asyncpg | Self::Pq, PreparedStatements::Extended) => {
+                PreparedStatements::ExtendedAnonymous
+            }
+            _ => level,
+        }
+    }
+
+    /// `DISCARD` closes all prepared statements of the client.
+    pub fn discard_closes_prepared(&self) -> bool {
+        matches!(self, Self::Npgsql)
+    }
+}
+
+impl std::fmt::Display for ClientProfile {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Generic => write!(f, "generic"),
+            Self::Jdbc => write!(f, "jdbc"),
+            Self::Npgsql => write!(f, "npgsql"),
+            Self::Asyncpg => write!(f, "asyncpg"),
+            Self::Pq => write!(f, "pq"),
+        }
+    }
+}
+
 /// connection pooling mode for database pools.
 ///
 /// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#pooler_mode>
@@ -141,3 +193,84 @@ impl FromStr for ConnectionRecovery {
         }
     }
 }
+
+/// Order in which connection pool queues are served.
+///
+/// <https://docs.pgdog.dev/configuration/pgdog.toml/general/#client_queue_order>
+#[derive(
+    Serialize, Deserialize, Debug, Clone, Copy, Default, PartialEq, Eq, Ord, PartialOrd, JsonSchema,
+)]
+#[serde(rename_all = "snake_case")]
+pub enum QueueOrder {
+    /// First in, first out: the oldest entry in the queue is served first.
+    #[default]
+    Fifo,
+    /// Last in, first out: the newest entry in the queue is served first.
+    Lifo,
+}
+
+impl std::fmt::Display for QueueOrder {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Fifo => write!(f, "fifo"),
+            Self::Lifo => write!(f, "lifo"),
+        }
+    }
+}
+
+impl FromStr for QueueOrder {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_lowercase().as_str() {
+            "fifo" => Ok(Self::Fifo),
+            "lifo" => Ok(Self::Lifo),
+            _ => Err(format!("Invalid queue order: {}", s)),
+        }
+    }
+}
+
+/// Priority of clients waiting for a server connection.
+///
+/// <https://docs.pgdog.dev/configuration/users.toml/users/#priority>
+#[derive(
+    Serialize, Deserialize, Debug, Clone, Copy, Default, PartialEq, Eq, Ord, PartialOrd, JsonSchema,
+)]
+#[serde(rename_all = "snake_case")]
+pub enum Priority {
+    /// Served before other clients when the pool is contended.
+    High,
+    /// Served in queue order.
+    #[default]
+    Normal,
+    /// Served after other clients and limited to `low_priority_pool_percent` of the pool's connections.
+    Low,
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_client_profile_prepared_statements() {
+        use PreparedStatements::*;
+
+        assert_eq!(
+            ClientProfile::Jdbc.prepared_statements(Extended),
+            ExtendedAnonymous
+        );
+        assert_eq!(ClientProfile::Pq.prepared_statements(Full), Full);
+        assert_eq!(
+            ClientProfile::Asyncpg.prepared_statements(Disabled),
+            Disabled
+        );
+        assert_eq!(
+            ClientProfile::Npgsql.prepared_statements(Extended),
+            Extended
+        );
+        assert_eq!(
+            ClientProfile::Generic.prepared_statements(Extended),
+            Extended
+        );
+    }
+}
@@ -0,0 +1,42 @@
+//! Query-pattern routing rules.
+
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+
+use crate::Role;
+
+/// Query routing rules send queries matching a pattern to a specific destination, e.g. pin a problematic ORM-generated query to the primary, without changing the application. Rules are checked in order and the first one that matches is used.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Default, JsonSchema)]
+#[serde(deny_unknown_fields)]
+pub struct QueryRoutingRule {
+    /// Name of the database this rule applies to. This should be a `name` configured in the [`databases`](https://docs.pgdog.dev/configuration/pgdog.toml/databases/) section of `pgdog.toml`.
+    pub database: String,
+
+    /// Regular expression matched against the query text, comments included.
+    pub regex: Option<String>,
+
+    /// Query matched by fingerprint, i.e., ignoring constants, comments and formatting, so `SELECT * FROM users WHERE id = 1` matches the same query with any `id`.
+    pub query: Option<String>,
+
+    /// Client `application_name` matched by this rule, e.g. `reporting_*`. `*` matches any number of characters. Combined with `regex` or `query`, both have to match.
+    pub application_name: Option<String>,
+
+    /// Send matching queries to the primary or the replicas.
+    pub role: Option<Role>,
+
+    /// Send matching queries to this shard.
+    pub shard: Option<usize>,
+
+    /// Send matching queries to this connection pool.
+    pub pool: Option<QueryRoutingPool>,
+}
+
+/// Connection pool used by queries matching a routing rule.
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, PartialEq, Eq, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum QueryRoutingPool {
+    /// Regular connection pool, even if the user or `slow_queries` would use the slow pool.
+    Default,
+    /// Pool for long-running queries, configured with `slow_pool_size`.
+    Slow,
+}
@@ -1,6 +1,7 @@
 use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 use std::fmt;
+use std::path::PathBuf;
 use std::str::FromStr;
 
 /// Controls what PgDog does when encountering a query that would require a rewrite.
@@ -81,6 +82,22 @@ pub struct Rewrite {
     #[serde(default = "Rewrite::default_split_inserts")]
     pub split_inserts: RewriteMode,
 
+    /// Minimum number of values in an `IN` list on the sharding key before the list is partitioned by shard, so each shard only receives the values it owns. Only applies to `SELECT` queries sent over the simple protocol. `0` disables splitting.
+    ///
+    /// _Default:_ `0`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#split_in_lists>
+    #[serde(default)]
+    pub split_in_lists: usize,
+
+    /// Behavior for `IN (SELECT ...)` subqueries reading sharded tables: `error` rejects, `rewrite` runs the subquery on all shards first and passes its rows to the outer query as a list of values, `ignore` forwards unchanged and each shard evaluates the subquery against its own rows.
+    ///
+    /// _Default:_ `ignore`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#subqueries>
+    #[serde(default = "Rewrite::default_subqueries")]
+    pub subqueries: RewriteMode,
+
     /// Behavior for `INSERT` missing a `BIGINT` primary key: `error` rejects, `rewrite` auto-injects `pgdog.unique_id()`, `ignore` allows without modification.
     ///
     /// _Default:_ `ignore`
@@ -88,6 +105,38 @@ pub struct Rewrite {
     /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#primary_key>
     #[serde(default = "Rewrite::default_primary_key")]
     pub primary_key: RewriteMode,
+
+    /// Retry statements the server rejected because they can't take parameters (e.g. some utility statements) with the parameter values inlined as quoted literals.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#inline_parameters>
+    #[serde(default)]
+    pub inline_parameters: bool,
+
+    /// Number of sequence values to allocate in advance for `INSERT` statements into unsharded tables that rely on a `nextval()` column default. Values are served by PgDog without asking Postgres. Only applies to queries sent over the simple protocol. `currval()` and `lastval()` don't see cached values, so queries calling them are rejected while the cache is enabled. `0` disables the cache.
+    ///
+    /// _Default:_ `0`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#sequence_cache>
+    #[serde(default)]
+    pub sequence_cache: usize,
+
+    /// File where unused sequence values are saved during shutdown and loaded from on startup, so they are not lost during restarts.
+    ///
+    /// _Default:_ none
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#sequence_cache_file>
+    #[serde(default)]
+    pub sequence_cache_file: Option<PathBuf>,
+
+    /// Columns, besides `BIGINT` primary keys, that get `pgdog.unique_id()` in `INSERT` statements into sharded tables when they are missing, set to `DEFAULT` or set with `nextval()`, e.g. `BIGSERIAL` columns that would otherwise collide between shards. Entries are `column` or `table.column`. Follows the `primary_key` setting.
+    ///
+    /// _Default:_ none
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/rewrite/#unique_id_columns>
+    #[serde(default)]
+    pub unique_id_columns: Vec<String>,
 }
 
 impl Default for Rewrite {
@@ -96,7 +145,13 @@ impl Default for Rewrite {
             enabled: false,
             shard_key: Self::default_shard_key(),
             split_inserts: Self::default_split_inserts(),
+            split_in_lists: 0,
+            subqueries: Self::default_subqueries(),
             primary_key: Self::default_primary_key(),
+            inline_parameters: false,
+            sequence_cache: 0,
+            sequence_cache_file: None,
+            unique_id_columns: vec![],
         }
     }
 }
@@ -113,4 +168,18 @@ impl Rewrite {
     const fn default_primary_key() -> RewriteMode {
         RewriteMode::Ignore
     }
+
+    const fn default_subqueries() -> RewriteMode {
+        RewriteMode::Ignore
+    }
+
+    /// The column is listed in `unique_id_columns`, by itself or with its table.
+    pub fn unique_id_column(&self, table: &str, column: &str) -> bool {
+        self.unique_id_columns
+            .iter()
+            .any(|entry| match entry.split_once('.') {
+                Some((entry_table, entry_column)) => entry_table == table && entry_column == column,
+                None => entry == column,
+            })
+    }
 }
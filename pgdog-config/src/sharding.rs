@@ -80,6 +80,14 @@ pub struct ShardedTableConfig {
     #[serde(default)]
     pub hasher: Hasher,
 
+    /// Shard UUIDv7 values by the timestamp in their first 48 bits instead of the whole value, so rows created around the same time stay on the same shard. The timestamp is matched as a UTC string like `2026-05-14 10:00:00.123`, so it works with `rolling` and string `range` mappings. Requires the `uuid` data type; other UUID versions are rejected.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/sharded_tables/#uuid_timestamp>
+    #[serde(default)]
+    pub uuid_timestamp: bool,
+
     /// Explicit value-to-shard routing rules for the column. When omitted (the
     /// default), PgDog shards by hashing the column value instead. Each entry is
     /// a [`ShardedMappingConfig`]; see it for the list/range/default forms.
@@ -89,6 +97,15 @@ pub struct ShardedTableConfig {
 }
 
 impl ShardedTableConfig {
+    /// Data type mapping rules are matched against.
+    pub fn mapping_data_type(&self) -> DataType {
+        if self.uuid_timestamp && self.data_type == DataType::Uuid {
+            DataType::Varchar
+        } else {
+            self.data_type
+        }
+    }
+
     /// Load centroids from file, if provided.
     ///
     /// Centroids can be very large vectors (1000+ columns).
@@ -120,9 +137,9 @@ impl ShardedTableConfig {
 
 /// A single value-to-shard routing rule within a table's `mapping`.
 ///
-/// When routing a value, PgDog matches list rules first, then range rules, then
-/// falls back to the default rule. A value matched by nothing, with no default
-/// rule present, is sent to all shards.
+/// When routing a value, PgDog matches directory rules first, then list rules, then
+/// range rules, then rolling rules, then falls back to the default rule. A value matched by nothing,
+/// with no default rule present, is sent to all shards.
 ///
 /// <https://docs.pgdog.dev/configuration/pgdog.toml/sharded_tables/#shard-by-list-and-range>
 #[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash, JsonSchema)]
@@ -137,6 +154,10 @@ pub enum ShardedMappingConfig {
     List(ShardedMappingList),
     /// Match a contiguous range, `start` inclusive and `end` exclusive (`PARTITION BY RANGE`).
     Range(ShardedMappingRange),
+    /// Match timestamps in ranges of fixed length that roll forward automatically.
+    Rolling(ShardedMappingRolling),
+    /// Look up the shard of each value in a directory kept outside the config.
+    Directory(ShardedMappingDirectory),
 }
 
 /// Hash function used to map a sharding key value to a shard number.
@@ -150,6 +171,9 @@ pub enum Hasher {
     Postgres,
     /// SHA-1 based hashing.
     Sha1,
+    /// PostgreSQL hash function, placed on shards with jump consistent hashing
+    /// instead of modulo. Adding a shard moves only about `1/N` of the keys.
+    Jump,
 }
 
 /// Data type of the sharding column.
@@ -293,6 +317,71 @@ pub struct ShardedMappingRange {
     pub end: Option<FlexibleType>,
 }
 
+/// A rolling rule: routes timestamps to shards one `interval` at a time, starting at
+/// `start`. Each range goes to the next shard in `shards`, so new ranges don't need to be
+/// added to the config by hand. The column must be a `varchar` sharding key holding
+/// timestamps, e.g. `2026-05-14 10:00:00`, or a `uuid` key with `uuid_timestamp` enabled;
+/// timestamps without a time zone are treated as UTC.
+#[derive(Serialize, Deserialize, PartialEq, Debug, Clone, Hash, Eq, JsonSchema)]
+#[serde(rename_all = "snake_case", deny_unknown_fields)]
+pub struct ShardedMappingRolling {
+    /// Start of the first range, e.g. `2026-01-01`. Earlier timestamps don't match this rule.
+    /// Monthly ranges must start on the first day of a month.
+    pub start: String,
+    /// Length of each range.
+    pub interval: RollingInterval,
+    /// Shards the ranges are assigned to, in turn, starting with the first one.
+    pub shards: Vec<usize>,
+    /// Statement executed on the range's shard before the range starts, e.g. to create
+    /// a partition. `{start}` and `{end}` are replaced with the range bounds, `{suffix}`
+    /// with a name suffix like `2026_05`. It runs again after restarts, so it must be idempotent.
+    pub ddl: Option<String>,
+    /// Number of ranges after the current one to run `ddl` for ahead of time.
+    #[serde(default = "ShardedMappingRolling::premake")]
+    pub premake: usize,
+}
+
+impl ShardedMappingRolling {
+    fn premake() -> usize {
+        1
+    }
+}
+
+/// A directory rule: routes values listed in a lookup table to their shard. The directory
+/// is stored in a Postgres table or a local file and reloaded periodically, so individual
+/// values, e.g. tenants, can be moved between shards without changing the config.
+/// Directory rules are matched before all other rules.
+#[derive(Serialize, Deserialize, PartialEq, Debug, Clone, Hash, Eq, JsonSchema)]
+#[serde(rename_all = "snake_case", deny_unknown_fields)]
+pub struct ShardedMappingDirectory {
+    /// Table with `key` and `shard` columns, read from the primary of the first shard,
+    /// e.g. `pgdog.tenants`. Keys are compared as text.
+    pub table: Option<String>,
+    /// File with one `key,shard` pair per line. Empty lines and lines starting with `#` are ignored.
+    pub path: Option<PathBuf>,
+    /// How often to reload the directory, in milliseconds. Files are only read again if they changed.
+    #[serde(default = "ShardedMappingDirectory::refresh_interval")]
+    pub refresh_interval: u64,
+}
+
+impl ShardedMappingDirectory {
+    fn refresh_interval() -> u64 {
+        10_000
+    }
+}
+
+/// Length of each range in a rolling rule.
+#[derive(Serialize, Deserialize, PartialEq, Debug, Clone, Copy, Hash, Eq, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum RollingInterval {
+    /// One day.
+    Day,
+    /// Seven days.
+    Week,
+    /// One calendar month.
+    Month,
+}
+
 /// A sharding key value that can be an integer, UUID, or string.
 #[derive(
     Serialize, Deserialize, PartialEq, Debug, Clone, Eq, Hash, JsonSchema, derive_more::Display,
@@ -339,25 +428,95 @@ pub struct OmnishardedTables {
     /// If true, queries to these tables are pinned to the same shard for the duration of the client connection.
     #[serde(default)]
     pub sticky: bool,
+    /// If true, writes to these tables are sent to all shards inside a two-phase commit transaction, so every copy is changed or none are. Requires [`two_phase_commit`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#two_phase_commit).
+    #[serde(default)]
+    pub two_phase_commit: bool,
 }
 
 #[derive(PartialEq, Debug, Clone, Default)]
 pub struct OmnishardedTable {
     pub name: String,
     pub sticky_routing: bool,
+    pub two_phase_commit: bool,
+}
+
+/// Child table that doesn't have the sharding key, but references a parent table that does, e.g. `order_items.order_id` referencing `orders.id`. Statements on the child table are routed to the shard of the parent row.
+///
+/// **Note:** PgDog learns which shard a parent row is on from `INSERT` statements into the parent table that contain both the sharding key and the referenced column. Until it does, statements on the child table are sent to all shards, and inserts into it return an error.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash, Default, JsonSchema)]
+#[serde(rename_all = "snake_case", deny_unknown_fields)]
+pub struct RoutingRelationship {
+    /// The name of the database in `[[databases]]` section in which the tables are located.
+    pub database: String,
+
+    /// The name of the PostgreSQL schema where the tables are located. If not specified, tables in all schemas match.
+    #[serde(default)]
+    pub schema: Option<String>,
+
+    /// The name of the child table, e.g. `order_items`.
+    pub table: String,
+
+    /// The column in the child table referencing the parent table, e.g. `order_id`.
+    pub column: String,
+
+    /// The name of the parent table, e.g. `orders`. It must be configured in `[[sharded_tables]]`.
+    pub parent_table: String,
+
+    /// The column in the parent table referenced by the child table.
+    ///
+    /// _Default:_ `id`
+    #[serde(default = "RoutingRelationship::parent_column")]
+    pub parent_column: String,
+
+    /// The data type of the referenced column.
+    ///
+    /// _Default:_ `bigint`
+    #[serde(default)]
+    pub data_type: DataType,
+}
+
+impl RoutingRelationship {
+    fn parent_column() -> String {
+        "id".into()
+    }
+
+    /// Statements on this table and column are routed by the parent row.
+    pub fn is_child(&self, schema: Option<&str>, table: &str, column: &str) -> bool {
+        self.column == column && self.is_child_table(schema, table)
+    }
+
+    /// Rows of this table are stored with their parent row.
+    pub fn is_child_table(&self, schema: Option<&str>, table: &str) -> bool {
+        self.table == table && self.schema_matches(schema)
+    }
+
+    /// Inserts into this table tell us where parent rows are.
+    pub fn is_parent(&self, schema: Option<&str>, table: &str) -> bool {
+        self.parent_table == table && self.schema_matches(schema)
+    }
+
+    fn schema_matches(&self, schema: Option<&str>) -> bool {
+        match (self.schema.as_deref(), schema) {
+            (Some(expected), Some(schema)) => expected == schema,
+            _ => true,
+        }
+    }
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, Hash, Default, JsonSchema)]
 pub struct ShardedSchema {
     /// Database name.
     pub database: String,
-    /// Schema name.
+    /// Schema name. A name ending with `*` matches all schemas starting with the rest of it, e.g. `tenant_*`.
     pub name: Option<String>,
     #[serde(default)]
     pub shard: usize,
     /// All shards.
     #[serde(default)]
     pub all: bool,
+    /// Pick the shard by hashing the schema name instead of using `shard`.
+    #[serde(default)]
+    pub hash: bool,
 }
 
 impl ShardedSchema {
@@ -370,6 +529,11 @@ impl ShardedSchema {
         self.name.as_deref().unwrap_or("*")
     }
 
+    /// Prefix matched by a `tenant_*` style name.
+    pub fn prefix(&self) -> Option<&str> {
+        self.name.as_deref()?.strip_suffix('*')
+    }
+
     pub fn shard(&self) -> Option<usize> {
         if self.all { None } else { Some(self.shard) }
     }
@@ -433,6 +597,8 @@ pub enum QueryParserLevel {
     SessionControl,
     /// Control & advisory locks.
     SessionControlAndLocks,
+    /// Parse every query and record the routing decision, but route as if the parser was disabled.
+    Shadow,
 }
 
 /// Underlying parser implementation used to analyze SQL queries.
@@ -0,0 +1,165 @@
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+
+/// Object storage service stats snapshots are written to.
+#[derive(JsonSchema, Serialize, Deserialize, Debug, Clone, Copy, PartialEq, Eq, Default)]
+#[serde(rename_all = "snake_case")]
+pub enum StatsExportProvider {
+    /// Amazon S3 or any S3-compatible service, e.g. MinIO or Cloudflare R2.
+    #[default]
+    S3,
+    /// Google Cloud Storage, using the service account attached to the instance.
+    Gcs,
+}
+
+/// Periodic export of stats snapshots to object storage.
+///
+/// When `bucket` is set, PgDog writes the output of `SHOW STATS`, `SHOW POOLS`
+/// and `SHOW REPLICATION` to the bucket as gzip-compressed JSON on an interval,
+/// providing a durable history of its stats without a metrics stack.
+///
+/// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/>
+#[derive(JsonSchema, Serialize, Deserialize, Debug, Clone, PartialEq)]
+#[serde(deny_unknown_fields)]
+pub struct StatsExport {
+    /// Object storage service: `s3` for Amazon S3 and S3-compatible services, or `gcs` for Google Cloud Storage.
+    ///
+    /// _Default:_ `s3`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#provider>
+    #[serde(default)]
+    pub provider: StatsExportProvider,
+
+    /// Bucket snapshots are written to. When not set, the export is disabled.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#bucket>
+    #[serde(default)]
+    pub bucket: Option<String>,
+
+    /// Prefix of snapshot object names. Snapshots are named `<prefix><YYYY>/<MM>/<DD>/<HHMMSS>-<instance id>.json.gz`.
+    ///
+    /// _Default:_ `pgdog/`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#prefix>
+    #[serde(default = "StatsExport::prefix")]
+    pub prefix: String,
+
+    /// How often, in milliseconds, to write a snapshot. Set to `0` to disable the export.
+    ///
+    /// _Default:_ `60000`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#interval>
+    #[serde(default = "StatsExport::interval")]
+    pub interval: u64,
+
+    /// AWS region of the S3 bucket.
+    ///
+    /// _Default:_ `us-east-1`
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#region>
+    #[serde(default = "StatsExport::region")]
+    pub region: String,
+
+    /// URL of the object storage service, e.g. `http://minio:9000` for MinIO. Buckets are addressed with path-style URLs.
+    ///
+    /// _Default:_ `https://s3.<region>.amazonaws.com` for S3, `https://storage.googleapis.com` for GCS
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#endpoint>
+    #[serde(default)]
+    pub endpoint: Option<String>,
+
+    /// S3 access key ID. When not set, credentials are loaded the same way as other AWS tools, e.g. from the environment or the instance role.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#access_key_id>
+    #[serde(default)]
+    pub access_key_id: Option<String>,
+
+    /// S3 secret access key, used with `access_key_id`.
+    ///
+    /// <https://docs.pgdog.dev/configuration/pgdog.toml/stats_export/#secret_access_key>
+    #[serde(default)]
+    pub secret_access_key: Option<String>,
+}
+
+impl Default for StatsExport {
+    fn default() -> Self {
+        Self {
+            provider: StatsExportProvider::default(),
+            bucket: None,
+            prefix: Self::prefix(),
+            interval: Self::interval(),
+            region: Self::region(),
+            endpoint: None,
+            access_key_id: None,
+            secret_access_key: None,
+        }
+    }
+}
+
+impl StatsExport {
+    fn prefix() -> String {
+        "pgdog/".into()
+    }
+
+    fn interval() -> u64 {
+        60_000
+    }
+
+    fn region() -> String {
+        "us-east-1".into()
+    }
+
+    /// The export is enabled with a bucket and a non-zero interval.
+    pub fn enabled(&self) -> bool {
+        self.bucket.is_some() && self.interval > 0
+    }
+
+    /// Object storage service URL.
+    pub fn endpoint(&self) -> String {
+        self.endpoint
+            .clone()
+            .unwrap_or_else(|| match self.provider {
+                StatsExportProvider::S3 => format!("https://s3.{}.amazonaws.com", self.region),
+                StatsExportProvider::Gcs => "https://storage.googleapis.com".into(),
+            })
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_stats_export_from_toml() {
+        let export: StatsExport = toml::from_str(
+            r#"
+            provider = "gcs"
+            bucket = "pgdog-stats"
+            interval = 30000
+            "#,
+        )
+        .unwrap();
+
+        assert_eq!(export.provider, StatsExportProvider::Gcs);
+        assert_eq!(export.bucket.as_deref(), Some("pgdog-stats"));
+        assert_eq!(export.interval, 30_000);
+        assert_eq!(export.prefix, "pgdog/");
+        assert_eq!(export.endpoint(), "https://storage.googleapis.com");
+        assert!(export.enabled());
+
+        let export: StatsExport = toml::from_str("").unwrap();
+        assert_eq!(export, StatsExport::default());
+        assert!(export.bucket.is_none());
+        assert!(!export.enabled());
+        assert_eq!(export.endpoint(), "https://s3.us-east-1.amazonaws.com");
+
+        let export: StatsExport = toml::from_str(
+            r#"
+            bucket = "pgdog-stats"
+            interval = 0
+            "#,
+        )
+        .unwrap();
+        assert!(!export.enabled());
+    }
+}
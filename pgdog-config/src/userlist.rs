@@ -0,0 +1,169 @@
+//! pgbouncer's `userlist.txt`.
+//!
+//! Each line contains a quoted user name and password, e.g.:
+//!
+//! ```text
+//! "alice" "md5d4f6b1b2c3a4e5f60718293a4b5c6d7e"
+//! "bob" "SCRAM-SHA-256$4096:c2FsdA==$c3RvcmVk:c2VydmVy"
+//! ```
+//!
+//! Passwords can be in plain text, md5 hashes or SCRAM-SHA-256 verifiers.
+//! A double quote inside a quoted value is written as `""`.
+
+use std::collections::HashMap;
+use std::fs::read_to_string;
+use std::path::Path;
+
+use crate::{Error, User};
+
+/// Users loaded from a pgbouncer-format `userlist.txt`.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct UserList {
+    passwords: HashMap<String, String>,
+}
+
+impl UserList {
+    /// Load users from file.
+    pub fn load(path: &Path) -> Result<Self, Error> {
+        read_to_string(path)?.parse()
+    }
+
+    /// Number of users.
+    pub fn len(&self) -> usize {
+        self.passwords.len()
+    }
+
+    /// No users loaded.
+    pub fn is_empty(&self) -> bool {
+        self.passwords.is_empty()
+    }
+
+    /// Create the user config entry for this database.
+    ///
+    /// SCRAM-SHA-256 verifiers are used as the password hash, everything else,
+    /// including md5 hashes, as the password.
+    pub fn user(&self, name: &str, database: &str) -> Option<User> {
+        let password = self.passwords.get(name)?;
+
+        let mut user = User {
+            name: name.to_owned(),
+            database: database.to_owned(),
+            ..Default::default()
+        };
+
+        if password.starts_with("SCRAM-SHA-256$") {
+            user.password_hash = Some(password.clone());
+        } else if !password.is_empty() {
+            user.password = Some(password.clone());
+        }
+
+        Some(user)
+    }
+}
+
+/// Read the quoted values of one line.
+fn parse_line(line: &str) -> Result<Vec<String>, Error> {
+    let error = || Error::ParseError(format!("invalid userlist.txt line: {}", line));
+    let mut values = vec![];
+    let mut chars = line.chars().peekable();
+
+    loop {
+        while chars.next_if(|c| c.is_whitespace()).is_some() {}
+
+        match chars.next() {
+            None => break,
+            Some('"') => (),
+            Some(_) => return Err(error()),
+        }
+
+        let mut value = String::new();
+
+        loop {
+            match chars.next() {
+                Some('"') if chars.next_if_eq(&'"').is_some() => value.push('"'),
+                Some('"') => break,
+                Some(c) => value.push(c),
+                None => return Err(error()),
+            }
+        }
+
+        values.push(value);
+    }
+
+    Ok(values)
+}
+
+impl std::str::FromStr for UserList {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let mut passwords = HashMap::new();
+
+        for line in s.lines() {
+            let line = line.trim();
+
+            if line.is_empty() || line.starts_with(';') || line.starts_with('#') {
+                continue;
+            }
+
+            // pgbouncer ignores anything after the password.
+            let mut values = parse_line(line)?.into_iter();
+            let (Some(name), Some(password)) = (values.next(), values.next()) else {
+                return Err(Error::ParseError(format!(
+                    "invalid userlist.txt line: {}",
+                    line
+                )));
+            };
+
+            passwords.insert(name, password);
+        }
+
+        Ok(Self { passwords })
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_userlist() {
+        let userlist: UserList = r#"
+;; Migrated from pgbouncer.
+"alice" "md5d4f6b1b2c3a4e5f60718293a4b5c6d7e"
+"bob"   "SCRAM-SHA-256$4096:c2FsdA==$c3RvcmVk:c2VydmVy"
+"carol" "pass""word" ""
+"#
+        .parse()
+        .unwrap();
+
+        assert_eq!(userlist.len(), 3);
+
+        let alice = userlist.user("alice", "prod").unwrap();
+        assert_eq!(alice.database, "prod");
+        assert_eq!(
+            alice.password.as_deref(),
+            Some("md5d4f6b1b2c3a4e5f60718293a4b5c6d7e")
+        );
+        assert!(alice.password_hash.is_none());
+
+        let bob = userlist.user("bob", "prod").unwrap();
+        assert!(bob.password.is_none());
+        assert_eq!(
+            bob.password_hash.as_deref(),
+            Some("SCRAM-SHA-256$4096:c2FsdA==$c3RvcmVk:c2VydmVy")
+        );
+
+        let carol = userlist.user("carol", "prod").unwrap();
+        assert_eq!(carol.password.as_deref(), Some("pass\"word"));
+
+        assert!(userlist.user("dave", "prod").is_none());
+    }
+
+    #[test]
+    fn test_userlist_invalid() {
+        for text in [r#""alice""#, r#"alice "secret""#, r#""alice" "secret"#] {
+            assert!(text.parse::<UserList>().is_err(), "{}", text);
+        }
+    }
+}
@@ -6,7 +6,7 @@ use std::sync::LazyLock;
 use tracing::warn;
 
 use super::core::Config;
-use super::pooling::PoolerMode;
+use super::pooling::{ClientProfile, PoolerMode, Priority};
 use crate::util::random_string;
 use schemars::JsonSchema;
 
@@ -190,6 +190,8 @@ pub enum ServerAuth {
     RdsIam,
     /// Generate an Azure Workload Identity auth token per connection attempt.
     AzureWorkloadIdentity,
+    /// Use a GCP IAM access token of the attached service account, e.g., for Cloud SQL or AlloyDB.
+    GcpIam,
     /// Fetch dynamic credentials from HashiCorp Vault (database secrets engine).
     /// Vault generates a new username and password on each lease.
     VaultDynamic,
@@ -204,6 +206,7 @@ impl Display for ServerAuth {
             Self::Password => "password",
             Self::RdsIam => "rds_iam",
             Self::AzureWorkloadIdentity => "azure_workload_identity",
+            Self::GcpIam => "gcp_iam",
             Self::VaultDynamic => "vault_dynamic",
             Self::VaultStatic => "vault_static",
         };
@@ -215,7 +218,11 @@ impl ServerAuth {
     pub fn is_external_identity(&self) -> bool {
         matches!(
             self,
-            Self::RdsIam | Self::AzureWorkloadIdentity | Self::VaultDynamic | Self::VaultStatic
+            Self::RdsIam
+                | Self::AzureWorkloadIdentity
+                | Self::GcpIam
+                | Self::VaultDynamic
+                | Self::VaultStatic
         )
     }
 }
@@ -297,10 +304,25 @@ pub struct User {
     ///
     /// <https://docs.pgdog.dev/configuration/users.toml/users/#min_pool_size>
     pub min_pool_size: Option<usize>,
+    /// Maximum number of clients that can be connected as this user to each of its databases at the same time. Clients over the limit are disconnected with a `too_many_connections` (`53300`) error.
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#max_client_connections>
+    pub max_client_connections: Option<usize>,
+    /// Maximum number of clients that can be connected as this user to all of its databases combined. If more than one entry for this user sets it, the lowest value is used. Clients over the limit are disconnected with a `too_many_connections` (`53300`) error.
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#max_user_client_connections>
+    pub max_user_client_connections: Option<usize>,
     /// Overrides [`pooler_mode`](https://docs.pgdog.dev/configuration/pgdog.toml/general/) for this user. This allows users in [session mode](https://docs.pgdog.dev/features/session-mode/) to connect to the same PgDog instance as users in [transaction mode](https://docs.pgdog.dev/features/transaction-mode/).
     ///
     /// <https://docs.pgdog.dev/configuration/users.toml/users/#pooler_mode>
     pub pooler_mode: Option<PoolerMode>,
+    /// Client driver used by this user, e.g., `jdbc` or `npgsql`. Enables workarounds for the driver's quirks, without changing global settings for everyone else.
+    ///
+    /// _Default:_ `generic`
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#client_profile>
+    #[serde(default)]
+    pub client_profile: ClientProfile,
     /// Which user to connect with when creating backend connections from PgDog to PostgreSQL. By default, the user configured in `name` is used. This setting allows you to override this configuration and use a different user.
     ///
     /// **Note:** Values specified in `pgdog.toml` take priority over this configuration.
@@ -313,6 +335,12 @@ pub struct User {
     ///
     /// <https://docs.pgdog.dev/configuration/users.toml/users/#server_password>
     pub server_password: Option<String>,
+    /// Role PgDog switches to with `SET ROLE` on backend connections. Combined with [`server_user`](https://docs.pgdog.dev/configuration/users.toml/users/#server_user), this allows many users to connect to PostgreSQL with one shared role, while queries keep running with each user's own privileges.
+    ///
+    /// **Note:** Clients can still run `SET ROLE` or `RESET ROLE` themselves and use any role `server_user` is a member of.
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#server_role>
+    pub server_role: Option<String>,
     /// Backend auth mode for server connections.
     #[serde(default)]
     pub server_auth: ServerAuth,
@@ -361,6 +389,13 @@ pub struct User {
     pub replication_mode: bool,
     /// Sharding target database for replication.
     pub replication_sharding: Option<String>,
+    /// Allow this user's clients to connect with the `replication` startup parameter, e.g. `pg_recvlogical` or `pg_receivewal`. Their replication connections are forwarded to the server using the pool's credentials, so physical replication exposes the WAL of the whole instance.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#replication>
+    #[serde(default)]
+    pub replication: bool,
     /// Overrides [`idle_timeout`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#idle_timeout) for this user. Server connections that have been idle for this long, without affecting [`min_pool_size`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#min_pool_size), will be closed.
     ///
     /// <https://docs.pgdog.dev/configuration/users.toml/users/#idle_timeout>
@@ -370,6 +405,20 @@ pub struct User {
     /// Schema owner with elevated DDL privileges.
     #[serde(default)]
     pub schema_admin: bool,
+    /// All queries from this user use the database's slow pool, if it has one.
+    ///
+    /// _Default:_ `false`
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#slow_pool>
+    #[serde(default)]
+    pub slow_pool: bool,
+    /// Priority of this user's clients when they wait for a server connection. `high` priority clients are served first and `low` priority ones can only use `low_priority_pool_percent` of the pool.
+    ///
+    /// _Default:_ `normal`
+    ///
+    /// <https://docs.pgdog.dev/configuration/users.toml/users/#priority>
+    #[serde(default)]
+    pub priority: Priority,
     /// Disable cross-shard queries for this user.
     pub cross_shard_disabled: Option<bool>,
     /// Overrides [`two_phase_commit`](https://docs.pgdog.dev/configuration/pgdog.toml/general/#two_phase_commit) for this user.
@@ -804,6 +853,22 @@ vault_refresh_percent = 60
         assert!(ServerAuth::VaultDynamic.is_external_identity());
     }
 
+    #[test]
+    fn test_gcp_iam_server_auth() {
+        let user: User = toml::from_str(
+            r#"
+name = "sa@project.iam"
+database = "pgdog"
+server_auth = "gcp_iam"
+"#,
+        )
+        .unwrap();
+
+        assert_eq!(user.server_auth, ServerAuth::GcpIam);
+        assert!(user.is_external_identity());
+        assert_eq!(ServerAuth::GcpIam.to_string(), "gcp_iam");
+    }
+
     #[test]
     fn test_vault_refresh_percent_out_of_range_resets_to_default() {
         let mut users = Users {
@@ -21,6 +21,8 @@ pub struct Stats {
     pub queries: usize,
     /// Errors.
     pub errors: usize,
+    /// Statements retried after a serialization failure or deadlock.
+    pub retries: usize,
     /// Total transaction time.
     pub transaction_time: Duration,
     /// Last transaction time.
@@ -40,6 +42,9 @@ pub struct Stats {
     pub prepared_statements: usize,
     /// Client is locked to a particular server.
     pub locked: bool,
+    /// Client is locked to its server by session state, e.g. advisory locks,
+    /// WITH HOLD cursors or temporary tables, views and sequences.
+    pub pinned: bool,
 }
 
 impl Default for Stats {
@@ -57,6 +62,7 @@ impl Stats {
             transactions_2pc: 0,
             queries: 0,
             errors: 0,
+            retries: 0,
             transaction_time: Duration::from_secs(0),
             last_transaction_time: Duration::from_secs(0),
             query_time: Duration::from_secs(0),
@@ -66,6 +72,7 @@ impl Stats {
             memory_stats: MemoryStats::default(),
             prepared_statements: 0,
             locked: false,
+            pinned: false,
         }
     }
 }
@@ -81,6 +88,7 @@ impl Add for Stats {
             transactions_2pc: self.transactions_2pc.saturating_add(rhs.transactions_2pc),
             queries: self.queries.saturating_add(rhs.queries),
             errors: self.errors.saturating_add(rhs.errors),
+            retries: self.retries.saturating_add(rhs.retries),
             transaction_time: self.transaction_time.saturating_add(rhs.transaction_time),
             last_transaction_time: self.last_transaction_time.max(rhs.last_transaction_time),
             query_time: self.query_time.saturating_add(rhs.query_time),
@@ -90,6 +98,7 @@ impl Add for Stats {
             memory_stats: self.memory_stats + rhs.memory_stats,
             prepared_statements: self.prepared_statements + rhs.prepared_statements,
             locked: rhs.locked, // Not summed either
+            pinned: rhs.pinned,
         }
     }
 }
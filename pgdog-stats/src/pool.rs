@@ -3,7 +3,10 @@ use std::{
     time::Duration,
 };
 
-use pgdog_config::{PoolerMode, PreparedStatements, pooling::ConnectionRecovery};
+use pgdog_config::{
+    PoolerMode, PreparedStatements,
+    pooling::{ConnectionRecovery, QueueOrder},
+};
 use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 
@@ -42,6 +45,8 @@ pub struct Counts {
     pub bind_count: usize,
     /// Number of times the pool had to rollback unfinished transactions.
     pub rollbacks: usize,
+    /// Number of transactions rolled back because the client was idle in them for too long.
+    pub idle_xact_timeouts: usize,
     /// Number of times the pool sent the health check query.
     pub healthchecks: usize,
     /// Total count of Close messages sent to server connections.
@@ -85,6 +90,9 @@ impl Sub for Counts {
             parse_count: self.parse_count.saturating_sub(rhs.parse_count),
             bind_count: self.bind_count.saturating_sub(rhs.bind_count),
             rollbacks: self.rollbacks.saturating_sub(rhs.rollbacks),
+            idle_xact_timeouts: self
+                .idle_xact_timeouts
+                .saturating_sub(rhs.idle_xact_timeouts),
             healthchecks: self.healthchecks.saturating_sub(rhs.healthchecks),
             close: self.close.saturating_sub(rhs.close),
             errors: self.errors.saturating_sub(rhs.errors),
@@ -119,6 +127,9 @@ impl Add for Counts {
             parse_count: self.parse_count.saturating_add(rhs.parse_count),
             bind_count: self.bind_count.saturating_add(rhs.bind_count),
             rollbacks: self.rollbacks.saturating_add(rhs.rollbacks),
+            idle_xact_timeouts: self
+                .idle_xact_timeouts
+                .saturating_add(rhs.idle_xact_timeouts),
             healthchecks: self.healthchecks.saturating_add(rhs.healthchecks),
             close: self.close.saturating_add(rhs.close),
             errors: self.errors.saturating_add(rhs.errors),
@@ -154,6 +165,7 @@ impl Div<usize> for Counts {
             parse_count: self.parse_count.checked_div(rhs).unwrap_or(0),
             bind_count: self.bind_count.checked_div(rhs).unwrap_or(0),
             rollbacks: self.rollbacks.checked_div(rhs).unwrap_or(0),
+            idle_xact_timeouts: self.idle_xact_timeouts.checked_div(rhs).unwrap_or(0),
             healthchecks: self.healthchecks.checked_div(rhs).unwrap_or(0),
             close: self.close.checked_div(rhs).unwrap_or(0),
             errors: self.errors.checked_div(rhs).unwrap_or(0),
@@ -171,6 +183,74 @@ impl Div<usize> for Counts {
     }
 }
 
+/// Upper bounds of the wait time histogram buckets, in microseconds.
+/// The last bucket catches everything slower.
+const WAIT_BUCKETS: [u64; 17] = [
+    100, 250, 500, 1_000, 2_500, 5_000, 10_000, 25_000, 50_000, 100_000, 250_000, 500_000,
+    1_000_000, 2_500_000, 5_000_000, 10_000_000, 30_000_000,
+];
+
+/// Histogram of the time clients spent waiting for a connection.
+#[derive(Debug, Clone, Default, Copy, Serialize, Deserialize, JsonSchema, PartialEq)]
+pub struct WaitHistogram {
+    buckets: [usize; WAIT_BUCKETS.len() + 1],
+}
+
+impl WaitHistogram {
+    /// Record a wait.
+    pub fn record(&mut self, wait: Duration) {
+        let micros = wait.as_micros();
+        let bucket = WAIT_BUCKETS
+            .iter()
+            .position(|bound| micros <= *bound as u128)
+            .unwrap_or(WAIT_BUCKETS.len());
+        self.buckets[bucket] += 1;
+    }
+
+    /// Number of recorded waits.
+    pub fn count(&self) -> usize {
+        self.buckets.iter().sum()
+    }
+
+    /// Estimate the percentile (0-100) using the upper bound of the
+    /// bucket it falls into. Waits slower than the last bucket
+    /// are reported as the last bucket's bound.
+    pub fn percentile(&self, percentile: f64) -> Duration {
+        let count = self.count();
+        if count == 0 {
+            return Duration::ZERO;
+        }
+
+        let rank = ((percentile / 100.0) * count as f64).ceil().max(1.0) as usize;
+        let mut seen = 0;
+
+        for (bucket, bucket_count) in self.buckets.iter().enumerate() {
+            seen += bucket_count;
+            if seen >= rank {
+                let bound = WAIT_BUCKETS
+                    .get(bucket)
+                    .or(WAIT_BUCKETS.last())
+                    .copied()
+                    .unwrap_or_default();
+                return Duration::from_micros(bound);
+            }
+        }
+
+        Duration::ZERO
+    }
+}
+
+impl Sub for WaitHistogram {
+    type Output = WaitHistogram;
+
+    fn sub(mut self, rhs: Self) -> Self::Output {
+        for (bucket, other) in self.buckets.iter_mut().zip(rhs.buckets) {
+            *bucket = bucket.saturating_sub(other);
+        }
+        self
+    }
+}
+
 #[derive(Debug, Clone, Default, Copy, Serialize, Deserialize, JsonSchema)]
 pub struct Stats {
     // Total counts.
@@ -180,6 +260,13 @@ pub struct Stats {
     last_counts: Counts,
     // Average counts.
     pub averages: Counts,
+    /// Wait times since the pool started.
+    pub wait_histogram: WaitHistogram,
+    /// Wait times at last average calculation.
+    #[serde(skip)]
+    last_wait_histogram: WaitHistogram,
+    /// Wait times during the last stats period.
+    pub recent_wait_histogram: WaitHistogram,
 }
 
 impl Stats {
@@ -222,7 +309,10 @@ impl Stats {
             self.averages.reads = diff.reads.checked_div(diff.xact_count).unwrap_or_default();
             self.averages.writes = diff.writes.checked_div(diff.xact_count).unwrap_or_default();
 
+            self.recent_wait_histogram = self.wait_histogram - self.last_wait_histogram;
+
             self.last_counts = self.counts;
+            self.last_wait_histogram = self.wait_histogram;
         }
     }
 }
@@ -304,6 +394,10 @@ pub struct Config {
     pub idle_healthcheck_interval: Duration, // ms
     /// Idle healthcheck delay.
     pub idle_healthcheck_delay: Duration, // ms
+    /// Shortest idle healthcheck interval, used after failures.
+    pub idle_healthcheck_min_interval: Duration, // ms
+    /// Longest idle healthcheck interval, used for healthy hosts.
+    pub idle_healthcheck_max_interval: Duration, // ms
     /// Read timeout (dangerous).
     pub read_timeout: Duration, // ms
     /// Write timeout (dangerous).
@@ -336,6 +430,8 @@ pub struct Config {
     pub lsn_check_timeout: Duration,
     /// LSN check delay.
     pub lsn_check_delay: Duration,
+    /// How long to keep LSN samples.
+    pub lsn_history: Duration,
     /// Automatic role detection enabled.
     pub role_detection: bool,
     /// Used for resharding only.
@@ -344,6 +440,22 @@ pub struct Config {
     pub lb_weight: u8,
     /// Prepared statements level.
     pub prepared_statements_level: PreparedStatements,
+    /// Prefer the server connection the client used last time.
+    pub connection_affinity: bool,
+    /// Order in which waiting clients are served.
+    pub client_queue_order: QueueOrder,
+    /// Order in which idle server connections are handed out.
+    pub server_queue_order: QueueOrder,
+    /// Rolling window used to share server connections fairly between tenants.
+    pub fair_share_window: Option<Duration>,
+    /// Maximum number of clients waiting for a connection.
+    pub max_waiting_clients: Option<usize>,
+    /// Percentage of connections low priority clients can use.
+    pub low_priority_pool_percent: u8,
+    /// Largest size the autoscaler can grow the pool to.
+    pub autoscale_max: Option<usize>,
+    /// Checkout wait time above which the autoscaler grows the pool.
+    pub autoscale_wait_target: Duration,
 }
 
 impl Default for Config {
@@ -363,6 +475,8 @@ impl Default for Config {
             healthcheck_interval: Duration::from_millis(30_000),
             idle_healthcheck_interval: Duration::from_millis(5_000),
             idle_healthcheck_delay: Duration::from_millis(5_000),
+            idle_healthcheck_min_interval: Duration::from_millis(5_000),
+            idle_healthcheck_max_interval: Duration::from_millis(5_000),
             read_timeout: Duration::MAX,
             write_timeout: Duration::MAX,
             query_timeout: Duration::MAX,
@@ -380,10 +494,46 @@ impl Default for Config {
             lsn_check_interval: Duration::from_millis(5_000),
             lsn_check_timeout: Duration::from_millis(5_000),
             lsn_check_delay: Duration::from_millis(5_000),
+            lsn_history: Duration::from_millis(300_000),
             role_detection: false,
             resharding_only: false,
             lb_weight: 255,
             prepared_statements_level: PreparedStatements::default(),
+            connection_affinity: false,
+            client_queue_order: QueueOrder::Fifo,
+            server_queue_order: QueueOrder::Lifo,
+            fair_share_window: None,
+            max_waiting_clients: None,
+            low_priority_pool_percent: 50,
+            autoscale_max: None,
+            autoscale_wait_target: Duration::from_millis(10),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_wait_histogram_percentile() {
+        let mut histogram = WaitHistogram::default();
+        assert_eq!(histogram.percentile(99.0), Duration::ZERO);
+
+        for _ in 0..90 {
+            histogram.record(Duration::from_micros(50));
+        }
+        for _ in 0..9 {
+            histogram.record(Duration::from_millis(20));
         }
+        histogram.record(Duration::from_secs(60));
+
+        assert_eq!(histogram.count(), 100);
+        assert_eq!(histogram.percentile(50.0), Duration::from_micros(100));
+        assert_eq!(histogram.percentile(95.0), Duration::from_millis(25));
+        assert_eq!(histogram.percentile(100.0), Duration::from_secs(30));
+
+        let recent = histogram - WaitHistogram::default();
+        assert_eq!(recent, histogram);
     }
 }
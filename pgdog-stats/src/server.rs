@@ -16,6 +16,7 @@ pub struct Counts {
     pub transactions_2pc: usize,
     pub queries: usize,
     pub rollbacks: usize,
+    pub idle_xact_timeouts: usize,
     pub errors: usize,
     pub prepared_statements: usize,
     pub query_time: Duration,
@@ -47,6 +48,7 @@ impl Add<Counts> for PoolCounts {
             parse_count: self.parse_count + rhs.parse,
             bind_count: self.bind_count + rhs.bind,
             rollbacks: self.rollbacks + rhs.rollbacks,
+            idle_xact_timeouts: self.idle_xact_timeouts + rhs.idle_xact_timeouts,
             healthchecks: self.healthchecks + rhs.healthchecks,
             close: self.close + rhs.close,
             errors: self.errors + rhs.errors,
@@ -73,6 +75,9 @@ impl Add for Counts {
             transactions_2pc: self.transactions_2pc.saturating_add(rhs.transactions_2pc),
             queries: self.queries.saturating_add(rhs.queries),
             rollbacks: self.rollbacks.saturating_add(rhs.rollbacks),
+            idle_xact_timeouts: self
+                .idle_xact_timeouts
+                .saturating_add(rhs.idle_xact_timeouts),
             errors: self.errors.saturating_add(rhs.errors),
             prepared_statements: self.prepared_statements + rhs.prepared_statements,
             query_time: self.query_time.saturating_add(rhs.query_time),
@@ -0,0 +1,67 @@
+//! Shard-level kill switch.
+//!
+//! Rejects all queries to one shard of a database, cancelling the ones already running,
+//! while the other shards keep serving.
+//!
+
+use crate::backend::shard_kill_switch;
+
+use super::prelude::*;
+
+/// Disable/enable a shard.
+pub struct DisableShard {
+    database: String,
+    shard: usize,
+    enable: bool,
+}
+
+#[async_trait]
+impl Command for DisableShard {
+    fn parse(sql: &str) -> Result<Self, Error> {
+        let parts = sql.split_whitespace().collect::<Vec<_>>();
+
+        match parts[..] {
+            [cmd @ ("disable" | "enable"), "shard", database, shard] => Ok(Self {
+                database: database.to_owned(),
+                shard: shard.parse()?,
+                enable: cmd == "enable",
+            }),
+            _ => Err(Error::Syntax),
+        }
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        if self.enable {
+            shard_kill_switch::enable(&self.database, self.shard);
+        } else {
+            shard_kill_switch::disable(&self.database, self.shard).await?;
+        }
+
+        Ok(vec![])
+    }
+
+    fn name(&self) -> String {
+        let cmd = if self.enable { "ENABLE" } else { "DISABLE" };
+        format!("{} SHARD {} {}", cmd, self.database, self.shard)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_parse() {
+        let cmd = DisableShard::parse("disable shard prod 1").unwrap();
+        assert_eq!(cmd.database, "prod");
+        assert_eq!(cmd.shard, 1);
+        assert!(!cmd.enable);
+
+        let cmd = DisableShard::parse("enable shard prod 1").unwrap();
+        assert!(cmd.enable);
+        assert_eq!(cmd.name(), "ENABLE SHARD prod 1");
+
+        assert!(DisableShard::parse("disable shard prod").is_err());
+        assert!(DisableShard::parse("disable shard prod one").is_err());
+    }
+}
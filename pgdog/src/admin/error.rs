@@ -37,6 +37,27 @@ pub enum Error {
     #[error("address is not valid")]
     InvalidAddress,
 
+    #[error("no such database: {0}")]
+    NoSuchDatabase(String),
+
+    #[error("no such shard: {0}")]
+    NoSuchShard(usize),
+
+    #[error("no such client: {0}")]
+    NoSuchClient(i32),
+
+    #[error("no such server: {0}")]
+    NoSuchServer(i32),
+
+    #[error("no range rule matches {0}")]
+    NoSuchRange(String),
+
+    #[error("can't move range: {0}")]
+    InvalidMove(String),
+
+    #[error("{0}")]
+    Sharding(#[from] crate::frontend::router::sharding::Error),
+
     #[error("{0}")]
     Replication(Box<crate::backend::replication::logical::Error>),
 }
@@ -0,0 +1,124 @@
+//! `KILL CLIENT` and `KILL SERVER` commands.
+//!
+//! Disconnect a stuck or misbehaving client, or close a server connection.
+//! The client receives a FATAL error and the query it's running is cancelled
+//! right away, so the server connection can be cleaned up.
+
+use crate::backend::databases::databases;
+use crate::backend::pool::inner::Kill as KillResult;
+use crate::frontend::comms::comms;
+use crate::net::messages::FrontendPid;
+use tracing::error;
+
+use super::prelude::*;
+
+/// Kill a client or a server connection.
+pub enum Kill {
+    /// Client `id` from `SHOW CLIENTS`.
+    Client(i32),
+    /// Server `remote_pid` from `SHOW SERVERS`.
+    Server(i32),
+}
+
+#[async_trait]
+impl Command for Kill {
+    fn name(&self) -> String {
+        match self {
+            Self::Client(id) => format!("KILL CLIENT {}", id),
+            Self::Server(pid) => format!("KILL SERVER {}", pid),
+        }
+    }
+
+    fn parse(sql: &str) -> Result<Self, Error> {
+        let parts = sql.split_whitespace().collect::<Vec<_>>();
+
+        match parts[..] {
+            ["kill", "client", id] => Ok(Self::Client(id.parse()?)),
+            ["kill", "server", pid] => Ok(Self::Server(pid.parse()?)),
+            _ => Err(Error::Syntax),
+        }
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        match *self {
+            Self::Client(id) => {
+                let client = FrontendPid::from(id);
+                if !comms().connected(client) {
+                    return Err(Error::NoSuchClient(id));
+                }
+                // Cancel while the client still holds the server connection.
+                cancel(client).await;
+                comms().kill(client);
+            }
+
+            Self::Server(pid) => {
+                let mut found = false;
+
+                // Postgres pids are only unique per host,
+                // so this closes all connections that match.
+                for cluster in databases().all().values() {
+                    for shard in cluster.shards() {
+                        for (_, _, _, pool) in shard.pools_with_classes() {
+                            match pool.kill(pid) {
+                                Some(KillResult::Closed) => found = true,
+                                // The client disconnects and returns the server,
+                                // which is then closed.
+                                Some(KillResult::CheckedOut(client)) => {
+                                    cancel(client).await;
+                                    comms().kill(client);
+                                    found = true;
+                                }
+                                None => (),
+                            }
+                        }
+                    }
+                }
+
+                if !found {
+                    return Err(Error::NoSuchServer(pid));
+                }
+            }
+        }
+
+        Ok(vec![])
+    }
+}
+
+/// Cancel the query the client is running, so it doesn't
+/// hold on to the server connection until the query finishes.
+async fn cancel(client: FrontendPid) {
+    if let Err(err) = databases().cancel(client).await {
+        error!("failed to cancel query of killed client: {}", err);
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_parse() {
+        let kill = Kill::parse("kill client 15").unwrap();
+        assert!(matches!(kill, Kill::Client(15)));
+        assert_eq!(kill.name(), "KILL CLIENT 15");
+
+        let kill = Kill::parse("kill server 1234").unwrap();
+        assert!(matches!(kill, Kill::Server(1234)));
+
+        assert!(Kill::parse("kill client").is_err());
+        assert!(Kill::parse("kill client one").is_err());
+        assert!(Kill::parse("kill pool 1").is_err());
+    }
+
+    #[tokio::test]
+    async fn test_kill_unknown() {
+        assert!(matches!(
+            Kill::Client(i32::MAX).execute().await,
+            Err(Error::NoSuchClient(_))
+        ));
+        assert!(matches!(
+            Kill::Server(i32::MAX).execute().await,
+            Err(Error::NoSuchServer(_))
+        ));
+    }
+}
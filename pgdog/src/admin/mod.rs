@@ -7,8 +7,10 @@ use crate::net::messages::Message;
 pub mod ban;
 pub mod copy_data;
 pub mod cutover;
+pub mod disable_shard;
 pub mod error;
 pub mod healthcheck;
+pub mod kill;
 pub mod maintenance_mode;
 pub mod named_row;
 pub mod parser;
@@ -21,6 +23,8 @@ pub mod replicate;
 pub mod reset_prepared;
 pub mod reset_query_cache;
 pub mod reshard;
+pub mod reshard_move;
+pub mod reshard_status;
 pub mod schema_sync;
 pub mod server;
 pub mod set;
@@ -29,6 +33,7 @@ pub mod show_bans;
 pub mod show_client_memory;
 pub mod show_clients;
 pub mod show_config;
+pub mod show_fair_share;
 pub mod show_instance_id;
 pub mod show_listeners;
 pub mod show_lists;
@@ -39,9 +44,11 @@ pub mod show_prepared_statements;
 pub mod show_query_cache;
 pub mod show_replication;
 pub mod show_replication_slots;
+pub mod show_schema_diff;
 pub mod show_schema_sync;
 pub mod show_server_memory;
 pub mod show_servers;
+pub mod show_shard_of;
 pub mod show_stats;
 pub mod show_table_copies;
 pub mod show_tasks;
@@ -53,8 +60,10 @@ pub mod stop_task;
 pub use ban::*;
 pub use copy_data::*;
 pub use cutover::*;
+pub use disable_shard::*;
 pub use error::Error;
 pub use healthcheck::*;
+pub use kill::*;
 pub use maintenance_mode::*;
 pub use named_row::*;
 pub use parser::*;
@@ -66,6 +75,8 @@ pub use replicate::*;
 pub use reset_prepared::*;
 pub use reset_query_cache::*;
 pub use reshard::*;
+pub use reshard_move::*;
+pub use reshard_status::*;
 pub use schema_sync::*;
 pub use server::*;
 pub use set::*;
@@ -74,6 +85,7 @@ pub use show_bans::*;
 pub use show_client_memory::*;
 pub use show_clients::*;
 pub use show_config::*;
+pub use show_fair_share::*;
 pub use show_instance_id::*;
 pub use show_listeners::*;
 pub use show_lists::*;
@@ -84,9 +96,11 @@ pub use show_prepared_statements::*;
 pub use show_query_cache::*;
 pub use show_replication::*;
 pub use show_replication_slots::*;
+pub use show_schema_diff::*;
 pub use show_schema_sync::*;
 pub use show_server_memory::*;
 pub use show_servers::*;
+pub use show_shard_of::*;
 pub use show_stats::*;
 pub use show_table_copies::*;
 pub use show_tasks::*;
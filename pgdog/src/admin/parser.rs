@@ -12,8 +12,10 @@ pub enum ParseResult {
     Reload(Reload),
     ShowPools(ShowPools),
     ShowBans(ShowBans),
+    ShowFairShare(ShowFairShare),
     ShowConfig(ShowConfig),
     ShowServers(ShowServers),
+    ShowShardOf(ShowShardOf),
     ShowPeers(ShowPeers),
     ShowQueryCache(ShowQueryCache),
     ResetPrepared(ResetPrepared),
@@ -33,6 +35,7 @@ pub enum ParseResult {
     ShowClientMemory(ShowClientMemory),
     ShowTableCopies(ShowTableCopies),
     ShowReplicationSlots(ShowReplicationSlots),
+    ShowSchemaDiff(ShowSchemaDiff),
     ShowSchemaSync(ShowSchemaSync),
     Set(Set),
     Ban(Ban),
@@ -40,12 +43,16 @@ pub enum ParseResult {
     MaintenanceMode(MaintenanceMode),
     Healthcheck(Healthcheck),
     Reshard(Reshard),
+    ReshardMove(ReshardMove),
+    ReshardStatus(ReshardStatus),
     SchemaSync(SchemaSync),
     CopyData(CopyData),
     Replicate(Replicate),
     ShowTasks(ShowTasks),
     StopTask(StopTask),
     Cutover(Cutover),
+    DisableShard(DisableShard),
+    Kill(Kill),
 }
 
 impl ParseResult {
@@ -60,8 +67,10 @@ impl ParseResult {
             Reload(reload) => reload.execute().await,
             ShowPools(show_pools) => show_pools.execute().await,
             ShowBans(show_bans) => show_bans.execute().await,
+            ShowFairShare(show_fair_share) => show_fair_share.execute().await,
             ShowConfig(show_config) => show_config.execute().await,
             ShowServers(show_servers) => show_servers.execute().await,
+            ShowShardOf(cmd) => cmd.execute().await,
             ShowPeers(show_peers) => show_peers.execute().await,
             ShowQueryCache(show_query_cache) => show_query_cache.execute().await,
             ResetPrepared(cmd) => cmd.execute().await,
@@ -81,6 +90,7 @@ impl ParseResult {
             ShowClientMemory(show_client_memory) => show_client_memory.execute().await,
             ShowTableCopies(show_table_copies) => show_table_copies.execute().await,
             ShowReplicationSlots(cmd) => cmd.execute().await,
+            ShowSchemaDiff(cmd) => cmd.execute().await,
             ShowSchemaSync(cmd) => cmd.execute().await,
             Set(set) => set.execute().await,
             Ban(ban) => ban.execute().await,
@@ -88,12 +98,16 @@ impl ParseResult {
             MaintenanceMode(maintenance_mode) => maintenance_mode.execute().await,
             Healthcheck(healthcheck) => healthcheck.execute().await,
             Reshard(reshard) => reshard.execute().await,
+            ReshardMove(cmd) => cmd.execute().await,
+            ReshardStatus(cmd) => cmd.execute().await,
             SchemaSync(cmd) => cmd.execute().await,
             CopyData(cmd) => cmd.execute().await,
             Replicate(cmd) => cmd.execute().await,
             ShowTasks(cmd) => cmd.execute().await,
             StopTask(cmd) => cmd.execute().await,
             Cutover(cmd) => cmd.execute().await,
+            DisableShard(cmd) => cmd.execute().await,
+            Kill(cmd) => cmd.execute().await,
         }
     }
 
@@ -108,8 +122,10 @@ impl ParseResult {
             Reload(reload) => reload.name(),
             ShowPools(show_pools) => show_pools.name(),
             ShowBans(show_bans) => show_bans.name(),
+            ShowFairShare(show_fair_share) => show_fair_share.name(),
             ShowConfig(show_config) => show_config.name(),
             ShowServers(show_servers) => show_servers.name(),
+            ShowShardOf(cmd) => cmd.name(),
             ShowPeers(show_peers) => show_peers.name(),
             ShowQueryCache(show_query_cache) => show_query_cache.name(),
             ResetPrepared(cmd) => cmd.name(),
@@ -129,6 +145,7 @@ impl ParseResult {
             ShowClientMemory(show_client_memory) => show_client_memory.name(),
             ShowTableCopies(show_table_copies) => show_table_copies.name(),
             ShowReplicationSlots(cmd) => cmd.name(),
+            ShowSchemaDiff(cmd) => cmd.name(),
             ShowSchemaSync(cmd) => cmd.name(),
             Set(set) => set.name(),
             Ban(ban) => ban.name(),
@@ -136,12 +153,16 @@ impl ParseResult {
             MaintenanceMode(maintenance_mode) => maintenance_mode.name(),
             Healthcheck(healthcheck) => healthcheck.name(),
             Reshard(reshard) => reshard.name(),
+            ReshardMove(cmd) => cmd.name(),
+            ReshardStatus(cmd) => cmd.name(),
             SchemaSync(cmd) => cmd.name(),
             CopyData(cmd) => cmd.name(),
             Replicate(cmd) => cmd.name(),
             ShowTasks(cmd) => cmd.name(),
             StopTask(cmd) => cmd.name(),
             Cutover(cmd) => cmd.name(),
+            DisableShard(cmd) => cmd.name(),
+            Kill(cmd) => cmd.name(),
         }
     }
 }
@@ -152,7 +173,10 @@ pub struct Parser;
 impl Parser {
     /// Parse the query and return a command we can execute.
     pub fn parse(sql: &str) -> Result<ParseResult, Error> {
-        let sql = sql.trim().replace(";", "").to_lowercase();
+        // Sharding keys can contain semicolons.
+        let query = sql.trim().trim_end_matches(';').trim_end();
+        let original = sql.trim().replace(";", "");
+        let sql = original.to_lowercase();
         let mut iter = sql.split(" ");
 
         Ok(match iter.next().ok_or(Error::Syntax)?.trim() {
@@ -166,8 +190,10 @@ impl Parser {
                 "clients" => ParseResult::ShowClients(ShowClients::parse(&sql)?),
                 "pools" => ParseResult::ShowPools(ShowPools::parse(&sql)?),
                 "bans" => ParseResult::ShowBans(ShowBans::parse(&sql)?),
+                "fair_share" => ParseResult::ShowFairShare(ShowFairShare::parse(&sql)?),
                 "config" => ParseResult::ShowConfig(ShowConfig::parse(&sql)?),
                 "servers" => ParseResult::ShowServers(ShowServers::parse(&sql)?),
+                "shard_of" => ParseResult::ShowShardOf(ShowShardOf::parse(query)?),
                 "server" => match iter.next().ok_or(Error::Syntax)?.trim() {
                     "memory" => ParseResult::ShowServerMemory(ShowServerMemory::parse(&sql)?),
                     command => {
@@ -196,6 +222,13 @@ impl Parser {
                 "replication_slots" => {
                     ParseResult::ShowReplicationSlots(ShowReplicationSlots::parse(&sql)?)
                 }
+                "schema" => match iter.next().ok_or(Error::Syntax)?.trim() {
+                    "diff" => ParseResult::ShowSchemaDiff(ShowSchemaDiff::parse(&sql)?),
+                    command => {
+                        debug!("unknown admin show schema command: '{}'", command);
+                        return Err(Error::Syntax);
+                    }
+                },
                 "schema_sync" => ParseResult::ShowSchemaSync(ShowSchemaSync::parse(&sql)?),
                 "table_copies" => ParseResult::ShowTableCopies(ShowTableCopies::parse(&sql)?),
                 "tasks" => ParseResult::ShowTasks(ShowTasks::parse(&sql)?),
@@ -219,7 +252,11 @@ impl Parser {
                     return Err(Error::Syntax);
                 }
             },
-            "reshard" => ParseResult::Reshard(Reshard::parse(&sql)?),
+            "reshard" => match iter.next().map(|word| word.trim()) {
+                Some("status") => ParseResult::ReshardStatus(ReshardStatus::parse(&sql)?),
+                Some("move") => ParseResult::ReshardMove(ReshardMove::parse(&original)?),
+                _ => ParseResult::Reshard(Reshard::parse(&sql)?),
+            },
             "schema_sync" => ParseResult::SchemaSync(SchemaSync::parse(&sql)?),
             "copy_data" => ParseResult::CopyData(CopyData::parse(&sql)?),
             "replicate" => ParseResult::Replicate(Replicate::parse(&sql)?),
@@ -227,6 +264,8 @@ impl Parser {
             "cutover" => ParseResult::Cutover(Cutover::parse(&sql)?),
             "probe" => ParseResult::Probe(Probe::parse(&sql)?),
             "maintenance" => ParseResult::MaintenanceMode(MaintenanceMode::parse(&sql)?),
+            "disable" | "enable" => ParseResult::DisableShard(DisableShard::parse(&sql)?),
+            "kill" => ParseResult::Kill(Kill::parse(&sql)?),
             // TODO: This is not ready yet. We have a race and
             // also the changed settings need to be propagated
             // into the pools.
@@ -241,7 +280,7 @@ impl Parser {
 
 #[cfg(test)]
 mod tests {
-    use super::{Error, ParseResult, Parser};
+    use super::{Command, Error, ParseResult, Parser};
 
     #[test]
     fn parses_show_clients_command() {
@@ -249,6 +288,41 @@ mod tests {
         assert!(matches!(result, Ok(ParseResult::ShowClients(_))));
     }
 
+    #[test]
+    fn parses_show_shard_of_command() {
+        let result = Parser::parse("SHOW SHARD_OF prod users 'Alice';");
+        match result {
+            Ok(ParseResult::ShowShardOf(cmd)) => {
+                assert_eq!(cmd.name(), "SHOW SHARD_OF");
+            }
+            _ => panic!("expected SHOW SHARD_OF"),
+        }
+
+        let result = Parser::parse("SHOW SHARD_OF prod users 'a;b c';");
+        assert!(matches!(result, Ok(ParseResult::ShowShardOf(_))));
+    }
+
+    #[test]
+    fn parses_reshard_commands() {
+        let result = Parser::parse("RESHARD STATUS;");
+        assert!(matches!(result, Ok(ParseResult::ReshardStatus(_))));
+
+        let result = Parser::parse("RESHARD MOVE prod tenant_id 'A' 'M' TO 1");
+        assert!(matches!(result, Ok(ParseResult::ReshardMove(_))));
+
+        let result = Parser::parse("RESHARD prod prod_sharded all_tables");
+        assert!(matches!(result, Ok(ParseResult::Reshard(_))));
+    }
+
+    #[test]
+    fn parses_show_schema_diff_command() {
+        let result = Parser::parse("SHOW SCHEMA DIFF;");
+        assert!(matches!(result, Ok(ParseResult::ShowSchemaDiff(_))));
+
+        let result = Parser::parse("SHOW SCHEMA");
+        assert!(matches!(result, Err(Error::Syntax)));
+    }
+
     #[test]
     fn parses_reset_query_cache_command() {
         let result = Parser::parse("RESET QUERY_CACHE");
@@ -285,6 +359,12 @@ mod tests {
         assert!(matches!(result, Ok(ParseResult::ShowBans(_))));
     }
 
+    #[test]
+    fn parses_show_fair_share_command() {
+        let result = Parser::parse("SHOW FAIR_SHARE;");
+        assert!(matches!(result, Ok(ParseResult::ShowFairShare(_))));
+    }
+
     #[test]
     fn parses_cutover_command() {
         assert!(matches!(
@@ -296,4 +376,28 @@ mod tests {
             Ok(ParseResult::Cutover(_))
         ));
     }
+
+    #[test]
+    fn parses_disable_shard_command() {
+        assert!(matches!(
+            Parser::parse("DISABLE SHARD prod 1;"),
+            Ok(ParseResult::DisableShard(_))
+        ));
+        assert!(matches!(
+            Parser::parse("ENABLE SHARD prod 1"),
+            Ok(ParseResult::DisableShard(_))
+        ));
+    }
+
+    #[test]
+    fn parses_kill_command() {
+        assert!(matches!(
+            Parser::parse("KILL CLIENT 1;"),
+            Ok(ParseResult::Kill(_))
+        ));
+        assert!(matches!(
+            Parser::parse("KILL SERVER 1234"),
+            Ok(ParseResult::Kill(_))
+        ));
+    }
 }
@@ -1,5 +1,8 @@
 //! Pause pool(s), closing backend connections and making clients
 //! wait indefinitely.
+//!
+//! Connections already checked out finish their transactions
+//! before being closed. Progress is reported in `SHOW POOLS`.
 
 use crate::backend::databases::databases;
 
@@ -43,6 +46,8 @@ impl Command for Pause {
     }
 
     async fn execute(&self) -> Result<Vec<Message>, Error> {
+        let mut found = false;
+
         for (name, cluster) in databases().all() {
             if let Some(ref user) = self.user
                 && &name.user != user
@@ -54,8 +59,9 @@ impl Command for Pause {
             {
                 continue;
             }
+            found = true;
             for shard in cluster.shards() {
-                for pool in shard.pools() {
+                for pool in shard.pools().into_iter().chain(shard.slow_pools()) {
                     if self.resume {
                         pool.resume();
                     } else {
@@ -65,6 +71,10 @@ impl Command for Pause {
             }
         }
 
+        if !found && let Some(ref database) = self.database {
+            return Err(Error::NoSuchDatabase(database.clone()));
+        }
+
         Ok(vec![])
     }
 
@@ -0,0 +1,179 @@
+//! RESHARD MOVE <database> <column> <start> <end> TO <shard>
+//!
+//! Move the rows of a range rule to another shard and point the rule to it.
+//! Traffic to the database is paused while the rows are copied.
+
+use pgdog_config::FlexibleType;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::api::move_range::{MoveRangeTask, MoveTable};
+use crate::api::run_task;
+use crate::backend::databases::databases;
+use crate::config::config;
+
+use super::prelude::*;
+
+pub struct ReshardMove {
+    database: String,
+    column: String,
+    start: FlexibleType,
+    end: FlexibleType,
+    shard: usize,
+}
+
+#[async_trait]
+impl Command for ReshardMove {
+    fn name(&self) -> String {
+        "RESHARD MOVE".into()
+    }
+
+    /// Parse the command. Range bounds are case-sensitive,
+    /// so this expects the query as the client sent it.
+    fn parse(sql: &str) -> Result<Self, Error> {
+        let parts = sql.split_whitespace().collect::<Vec<_>>();
+
+        match parts[..] {
+            [reshard, mv, database, column, start, end, to, shard]
+                if reshard.eq_ignore_ascii_case("reshard")
+                    && mv.eq_ignore_ascii_case("move")
+                    && to.eq_ignore_ascii_case("to") =>
+            {
+                Ok(Self {
+                    database: database.to_owned(),
+                    column: column.to_owned(),
+                    start: bound(start),
+                    end: bound(end),
+                    shard: shard.parse()?,
+                })
+            }
+            _ => Err(Error::Syntax),
+        }
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        let shards = databases()
+            .schema_owner(&self.database)
+            .map_err(|_| Error::NoSuchDatabase(self.database.clone()))?
+            .shards()
+            .len();
+
+        if self.shard >= shards {
+            return Err(Error::NoSuchShard(self.shard));
+        }
+
+        let config = config();
+        let rules = config
+            .config
+            .range_rules(&self.database, &self.column, &self.start, &self.end);
+
+        let Some((_, from)) = rules.first().copied() else {
+            return Err(Error::NoSuchRange(format!(
+                "[{}, {}) on column \"{}\"",
+                self.start, self.end, self.column
+            )));
+        };
+
+        if rules.iter().any(|(_, shard)| *shard != from) {
+            return Err(Error::InvalidMove(
+                "tables with this range are on different shards".into(),
+            ));
+        }
+
+        if from == self.shard {
+            return Err(Error::InvalidMove(format!(
+                "range is already on shard {}",
+                from
+            )));
+        }
+
+        let tables = rules
+            .iter()
+            .map(|(table, _)| {
+                table
+                    .name
+                    .clone()
+                    .map(|name| MoveTable {
+                        schema: table.schema.clone(),
+                        name,
+                    })
+                    .ok_or_else(|| {
+                        Error::InvalidMove(format!(
+                            "rule on column \"{}\" doesn't have a table name",
+                            self.column
+                        ))
+                    })
+            })
+            .collect::<Result<Vec<_>, _>>()?;
+
+        info!(
+            r#"moving range [{}, {}) of "{}" in database "{}" from shard {} to shard {}"#,
+            self.start, self.end, self.column, self.database, from, self.shard
+        );
+
+        let task_id = run_task(
+            MoveRangeTask::builder()
+                .database(self.database.clone())
+                .column(self.column.clone())
+                .start(self.start.clone())
+                .end(self.end.clone())
+                .tables(tables)
+                .from(from)
+                .to(self.shard)
+                .build(),
+        )
+        .id();
+
+        let mut dr = DataRow::new();
+        dr.add(task_id.to_string());
+
+        Ok(vec![
+            RowDescription::new(&[Field::text("task_id")]).message()?,
+            dr.message()?,
+        ])
+    }
+}
+
+/// Range bound. Quoted values are strings (or UUIDs), unquoted ones
+/// are integers if they parse as one.
+fn bound(value: &str) -> FlexibleType {
+    if let Some(value) = value
+        .strip_prefix('\'')
+        .and_then(|value| value.strip_suffix('\''))
+    {
+        return match Uuid::parse_str(value) {
+            Ok(uuid) => FlexibleType::Uuid(uuid),
+            Err(_) => FlexibleType::String(value.to_owned()),
+        };
+    }
+
+    if let Ok(value) = value.parse::<i64>() {
+        FlexibleType::Integer(value)
+    } else if let Ok(uuid) = Uuid::parse_str(value) {
+        FlexibleType::Uuid(uuid)
+    } else {
+        FlexibleType::String(value.to_owned())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_parse() {
+        let cmd = ReshardMove::parse("RESHARD MOVE prod tenant_id 0 100 TO 2").unwrap();
+        assert_eq!(cmd.database, "prod");
+        assert_eq!(cmd.column, "tenant_id");
+        assert_eq!(cmd.start, FlexibleType::Integer(0));
+        assert_eq!(cmd.end, FlexibleType::Integer(100));
+        assert_eq!(cmd.shard, 2);
+
+        let cmd = ReshardMove::parse("reshard move prod region 'Asia' 'Europe' to 1").unwrap();
+        assert_eq!(cmd.start, FlexibleType::String("Asia".into()));
+        assert_eq!(cmd.end, FlexibleType::String("Europe".into()));
+
+        assert!(ReshardMove::parse("RESHARD MOVE prod tenant_id 0 100 2").is_err());
+        assert!(ReshardMove::parse("RESHARD MOVE prod tenant_id 0 100 TO two").is_err());
+    }
+}
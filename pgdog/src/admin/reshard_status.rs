@@ -0,0 +1,86 @@
+//! RESHARD STATUS
+//!
+//! Progress of resharding and range moves: what stage each one is in,
+//! and how far replication is behind, if it's running.
+
+use std::time::SystemTime;
+
+use crate::api::tasks_storage;
+use crate::backend::replication::logical::status::ReplicationSlots;
+use crate::net::data_row::Data;
+use crate::util::human_duration_display;
+
+use super::prelude::*;
+
+pub struct ReshardStatus;
+
+#[async_trait]
+impl Command for ReshardStatus {
+    fn name(&self) -> String {
+        "RESHARD STATUS".into()
+    }
+
+    fn parse(_sql: &str) -> Result<Self, Error> {
+        Ok(ReshardStatus)
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        let rd = RowDescription::new(&[
+            Field::bigint("id"),
+            Field::text("task"),
+            Field::text("status"),
+            Field::text("stage"),
+            Field::text("elapsed"),
+            Field::bigint("lag_bytes"),
+        ]);
+        let mut messages = vec![rd.message()?];
+        let now = SystemTime::now();
+
+        // Replication slots aren't tied to tasks, so report the worst one.
+        let lag = ReplicationSlots::get()
+            .iter()
+            .map(|entry| entry.value().lag)
+            .max();
+
+        for task in tasks_storage().tasks().into_iter().rev() {
+            let state = &task.state;
+            if !state.name.starts_with("reshard ") && !state.name.starts_with("move_range ") {
+                continue;
+            }
+
+            // The most recent subtask knows best what's going on,
+            // e.g. which table is being copied.
+            let stage = task
+                .subtasks
+                .iter()
+                .rev()
+                .find_map(|sub| sub.state.inner_status.as_ref())
+                .or(state.inner_status.as_ref())
+                .cloned()
+                .unwrap_or_default();
+
+            let end = if state.is_terminal() {
+                state.updated_at
+            } else {
+                now
+            };
+            let elapsed = end.duration_since(state.started_at).unwrap_or_default();
+
+            let mut row = DataRow::new();
+            row.add(task.id)
+                .add(state.name.as_str())
+                .add(state.status.to_string().as_str())
+                .add(stage.as_str())
+                .add(human_duration_display(elapsed).as_str());
+
+            match lag {
+                Some(lag) if !state.is_terminal() => row.add(lag),
+                _ => row.add(Data::null()),
+            };
+
+            messages.push(row.message()?);
+        }
+
+        Ok(messages)
+    }
+}
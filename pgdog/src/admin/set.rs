@@ -138,6 +138,10 @@ impl Command for Set {
                 config.config.general.two_phase_commit_auto = Self::from_json(&self.value)?;
             }
 
+            "two_phase_commit_ddl" => {
+                config.config.general.two_phase_commit_ddl = Self::from_json(&self.value)?;
+            }
+
             "rewrite_shard_key_updates" => {
                 config.config.rewrite.shard_key = self
                     .value
@@ -152,6 +156,13 @@ impl Command for Set {
                     .map_err(|_| Error::Syntax)?;
             }
 
+            "rewrite_subqueries" => {
+                config.config.rewrite.subqueries = self
+                    .value
+                    .parse::<RewriteMode>()
+                    .map_err(|_| Error::Syntax)?;
+            }
+
             "rewrite_primary_key" => {
                 config.config.rewrite.primary_key = self
                     .value
@@ -191,6 +202,10 @@ impl Command for Set {
                 config.config.general.client_idle_in_transaction_timeout = self.value.parse()?;
             }
 
+            "idle_in_transaction_timeout" => {
+                config.config.general.idle_in_transaction_timeout = self.value.parse()?;
+            }
+
             "reload_schema_on_ddl" => {
                 config.config.general.reload_schema_on_ddl = Self::from_json(&self.value)?;
             }
@@ -211,6 +226,13 @@ impl Command for Set {
                 config.config.general.connect_timeout = self.value.parse()?;
             }
 
+            "routing_seed" => {
+                config.config.general.routing_seed = match self.value.as_str() {
+                    "none" => None,
+                    value => Some(value.parse()?),
+                };
+            }
+
             _ => return Ok(vec![]),
         }
 
@@ -242,4 +264,14 @@ mod test {
         assert_eq!(cmd.name, "query_timeout");
         assert_eq!(cmd.value, "5000");
     }
+
+    #[test]
+    fn test_set_routing_seed() {
+        let cmd = Set::parse("SET routing_seed TO 42").unwrap();
+        assert_eq!(cmd.name, "routing_seed");
+        assert_eq!(cmd.value, "42");
+
+        let cmd = Set::parse("SET routing_seed TO 'none'").unwrap();
+        assert_eq!(cmd.value, "none");
+    }
 }
@@ -45,7 +45,7 @@ impl Command for ShowClientMemory {
             row.add(client.key.pid())
                 .add(database)
                 .add(user)
-                .add(client.addr.ip().to_string().as_str())
+                .add(client.addr.host().as_str())
                 .add(client.addr.port() as i64)
                 .add(memory.buffer.reallocs as i64)
                 .add(memory.buffer.reclaims as i64)
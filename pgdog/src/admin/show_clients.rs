@@ -5,13 +5,35 @@ use std::collections::HashSet;
 use chrono::DateTime;
 
 use super::prelude::*;
+use crate::frontend::ConnectedClient;
 use crate::frontend::comms::comms;
 use crate::net::messages::*;
 use crate::util::format_time;
 
+/// Columns that can be used in the `WHERE` clause.
+const FILTERABLE: &[&str] = &[
+    "id",
+    "user",
+    "database",
+    "addr",
+    "port",
+    "state",
+    "replication",
+    "application_name",
+];
+
 /// Show clients command.
+///
+/// Supports selecting columns, filtering and pagination, e.g.:
+///
+/// ```text
+/// SHOW CLIENTS id, state WHERE database = 'pgdog' AND state = 'waiting' LIMIT 100 OFFSET 100
+/// ```
 pub struct ShowClients {
     filter: NamedRow,
+    conditions: Vec<(String, String)>,
+    limit: Option<usize>,
+    offset: usize,
 }
 
 #[async_trait]
@@ -21,6 +43,12 @@ impl Command for ShowClients {
     }
 
     fn parse(sql: &str) -> Result<Self, Error> {
+        let (sql, limit, offset) = Self::pagination(sql)?;
+        let (sql, conditions) = match sql.split_once(" where ") {
+            Some((sql, conditions)) => (sql, Self::conditions(conditions)?),
+            None => (sql, vec![]),
+        };
+
         let parts = sql
             .split(|c| [' ', ','].contains(&c))
             .collect::<Vec<&str>>();
@@ -44,9 +72,11 @@ impl Command for ShowClients {
             Field::numeric("bytes_received"),
             Field::numeric("bytes_sent"),
             Field::numeric("errors"),
+            Field::numeric("retries"),
             Field::text("application_name"),
             Field::bool("locked"),
             Field::numeric("prepared_statements"),
+            Field::bool("pinned"),
         ];
 
         let mut mandatory = HashSet::from([
@@ -65,14 +95,30 @@ impl Command for ShowClients {
 
         let filter = NamedRow::new(&fields, &mandatory);
 
-        Ok(ShowClients { filter })
+        Ok(ShowClients {
+            filter,
+            conditions,
+            limit,
+            offset,
+        })
     }
 
     async fn execute(&self) -> Result<Vec<Message>, Error> {
         let mut rows = vec![];
-        let clients = comms().clients();
+        let mut clients = comms()
+            .clients()
+            .into_values()
+            .filter(|client| self.matches(client))
+            .collect::<Vec<_>>();
+
+        // Stable order, so pagination makes sense.
+        clients.sort_by_key(|client| client.key.pid());
 
-        for client in clients.values() {
+        for client in clients
+            .iter()
+            .skip(self.offset)
+            .take(self.limit.unwrap_or(usize::MAX))
+        {
             let user = client.paramters.get_default("user", "postgres");
             let row = self
                 .filter
@@ -80,7 +126,7 @@ impl Command for ShowClients {
                 .add("id", client.key.pid())
                 .add("user", user)
                 .add("database", client.paramters.get_default("database", user))
-                .add("addr", client.addr.ip().to_string())
+                .add("addr", client.addr.host())
                 .add("port", client.addr.port().to_string())
                 .add("state", client.stats.state.to_string())
                 .add(
@@ -114,12 +160,14 @@ impl Command for ShowClients {
                 .add("bytes_received", client.stats.bytes_received)
                 .add("bytes_sent", client.stats.bytes_sent)
                 .add("errors", client.stats.errors)
+                .add("retries", client.stats.retries)
                 .add(
                     "application_name",
                     client.paramters.get_default("application_name", ""),
                 )
                 .add("locked", client.stats.locked)
                 .add("prepared_statements", client.stats.prepared_statements)
+                .add("pinned", client.stats.pinned)
                 .data_row();
             rows.push(row.message()?);
         }
@@ -130,3 +178,100 @@ impl Command for ShowClients {
         Ok(messages)
     }
 }
+
+impl ShowClients {
+    /// Parse `LIMIT n [OFFSET m]` at the end of the command.
+    fn pagination(sql: &str) -> Result<(&str, Option<usize>, usize), Error> {
+        let (sql, offset) = match sql.rsplit_once(" offset ") {
+            Some((sql, offset)) => (sql, offset.trim().parse()?),
+            None => (sql, 0),
+        };
+
+        let (sql, limit) = match sql.rsplit_once(" limit ") {
+            Some((sql, limit)) => (sql, Some(limit.trim().parse()?)),
+            None => (sql, None),
+        };
+
+        Ok((sql, limit, offset))
+    }
+
+    /// Parse `column = 'value' [AND ...]` conditions.
+    fn conditions(sql: &str) -> Result<Vec<(String, String)>, Error> {
+        sql.split(" and ")
+            .map(|condition| {
+                let (column, value) = condition.split_once('=').ok_or(Error::Syntax)?;
+                let column = column.trim();
+
+                if !FILTERABLE.contains(&column) {
+                    return Err(Error::Syntax);
+                }
+
+                let value = value.trim().trim_matches('\'');
+
+                Ok((column.to_string(), value.to_string()))
+            })
+            .collect()
+    }
+
+    /// Client matches all conditions in the `WHERE` clause.
+    fn matches(&self, client: &ConnectedClient) -> bool {
+        self.conditions.iter().all(|(column, value)| {
+            let user = client.paramters.get_default("user", "postgres");
+            let actual = match column.as_str() {
+                "id" => client.key.pid().to_string(),
+                "user" => user.to_string(),
+                "database" => client.paramters.get_default("database", user).to_string(),
+                "addr" => client.addr.host(),
+                "port" => client.addr.port().to_string(),
+                "state" => client.stats.state.to_string(),
+                "replication" => if client.paramters.get("replication").is_some() {
+                    "logical"
+                } else {
+                    "none"
+                }
+                .to_string(),
+                "application_name" => client
+                    .paramters
+                    .get_default("application_name", "")
+                    .to_string(),
+                _ => return false,
+            };
+
+            // Admin commands are lowercased by the parser.
+            actual.eq_ignore_ascii_case(value)
+        })
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_parse_where_limit() {
+        let command = ShowClients::parse(
+            "show clients id, state where database = 'pgdog' and state = 'waiting' limit 100 offset 200",
+        )
+        .unwrap();
+
+        assert_eq!(
+            command.conditions,
+            vec![
+                ("database".to_string(), "pgdog".to_string()),
+                ("state".to_string(), "waiting".to_string()),
+            ]
+        );
+        assert_eq!(command.limit, Some(100));
+        assert_eq!(command.offset, 200);
+        assert_eq!(command.filter.row_description().fields.len(), 6);
+
+        let command = ShowClients::parse("show clients limit 5").unwrap();
+        assert!(command.conditions.is_empty());
+        assert_eq!(command.limit, Some(5));
+        assert_eq!(command.offset, 0);
+
+        assert!(ShowClients::parse("show clients where bytes_sent = 5").is_err());
+        assert!(ShowClients::parse("show clients where database").is_err());
+        assert!(ShowClients::parse("show clients limit many").is_err());
+    }
+}
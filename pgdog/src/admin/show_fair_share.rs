@@ -0,0 +1,67 @@
+use crate::{
+    backend::databases::databases,
+    net::messages::{DataRow, Field, Protocol, RowDescription},
+};
+
+// SHOW FAIR_SHARE command.
+use super::prelude::*;
+
+/// Show how much of each pool's server connection time every tenant used
+/// during the fair share window.
+pub struct ShowFairShare;
+
+#[async_trait]
+impl Command for ShowFairShare {
+    fn name(&self) -> String {
+        "SHOW FAIR_SHARE".into()
+    }
+
+    fn parse(_sql: &str) -> Result<Self, Error> {
+        Ok(ShowFairShare {})
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        let rd = RowDescription::new(&[
+            Field::bigint("id"),
+            Field::text("database"),
+            Field::text("user"),
+            Field::text("addr"),
+            Field::numeric("port"),
+            Field::numeric("shard"),
+            Field::text("role"),
+            Field::text("tenant"),
+            Field::numeric("cl_waiting"),
+            Field::numeric("sv_active"),
+            Field::numeric("used_ms"),
+            Field::double("share"),
+        ]);
+
+        let mut messages = vec![rd.message()?];
+
+        for (user, cluster) in databases().all() {
+            for (shard_num, shard) in cluster.shards().iter().enumerate() {
+                for (role, _ban, pool) in shard.pools_with_roles_and_bans() {
+                    for share in pool.fair_shares() {
+                        let mut row = DataRow::new();
+                        row.add(pool.id() as i64)
+                            .add(user.database.as_str())
+                            .add(user.user.as_str())
+                            .add(pool.addr().host.as_str())
+                            .add(pool.addr().port as i64)
+                            .add(shard_num as i64)
+                            .add(role.to_string())
+                            .add(share.tenant.as_deref().unwrap_or_default())
+                            .add(share.waiting)
+                            .add(share.checked_out)
+                            .add(share.used.as_millis() as i64)
+                            .add(share.share);
+
+                        messages.push(row.message()?);
+                    }
+                }
+            }
+        }
+
+        Ok(messages)
+    }
+}
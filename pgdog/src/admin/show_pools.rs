@@ -44,16 +44,26 @@ impl Command for ShowPools {
             Field::numeric("force_closed"),
             Field::bool("online"),
             Field::bool("schema_admin"),
+            Field::text("pause_state"),
+            Field::numeric("pool_size"),
+            Field::numeric("autoscale_events"),
+            Field::text("last_autoscale"),
+            Field::text("pool_class"),
+            Field::numeric("wait_p50_us"),
+            Field::numeric("wait_p95_us"),
+            Field::numeric("wait_p99_us"),
         ]);
         let mut messages = vec![rd.message()?];
         for (user, cluster) in databases().all() {
             for (shard_num, shard) in cluster.shards().iter().enumerate() {
-                for (role, ban, pool) in shard.pools_with_roles_and_bans() {
+                for (class, role, ban, pool) in shard.pools_with_classes() {
                     let mut row = DataRow::new();
                     let state = pool.state();
                     let maxwait = state.maxwait.as_secs() as i64;
                     let maxwait_us = state.maxwait.subsec_micros() as i64;
+                    let waits = &state.stats.recent_wait_histogram;
                     let idle_in_transaction = backend::stats::idle_in_transaction(&pool);
+                    let autoscaler = pool.autoscaler();
 
                     row.add(pool.id() as i64)
                         .add(user.database.as_str())
@@ -78,7 +88,15 @@ impl Command for ShowPools {
                         .add(state.out_of_sync)
                         .add(state.force_close)
                         .add(state.online)
-                        .add(cluster.schema_admin());
+                        .add(cluster.schema_admin())
+                        .add(state.pause_state())
+                        .add(state.config.max)
+                        .add(autoscaler.events())
+                        .add(autoscaler.last().map(|event| event.to_string()))
+                        .add(class.to_string())
+                        .add(waits.percentile(50.0).as_micros() as i64)
+                        .add(waits.percentile(95.0).as_micros() as i64)
+                        .add(waits.percentile(99.0).as_micros() as i64);
 
                     messages.push(row.message()?);
                 }
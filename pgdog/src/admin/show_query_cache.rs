@@ -34,6 +34,8 @@ impl Command for ShowQueryCache {
                 Field::numeric("hits"),
                 Field::numeric("direct"),
                 Field::numeric("multi"),
+                Field::numeric("shadow_match"),
+                Field::numeric("shadow_mismatch"),
             ])
             .message()?,
         ];
@@ -50,7 +52,9 @@ impl Command for ShowQueryCache {
                 .add(&*query.0)
                 .add(stats.hits)
                 .add(stats.direct)
-                .add(stats.multi);
+                .add(stats.multi)
+                .add(stats.shadow_match)
+                .add(stats.shadow_mismatch);
             messages.push(data_row.message()?);
         }
 
@@ -0,0 +1,216 @@
+//! SHOW SCHEMA DIFF
+//!
+//! Compare tables, columns and indexes across shards and list
+//! the ones that aren't the same everywhere. The definition used
+//! by most shards is assumed to be the correct one.
+
+use std::collections::{BTreeMap, BTreeSet, HashMap};
+
+use crate::backend::{self, databases::databases, pool::Request};
+
+use super::prelude::*;
+
+static OBJECTS: &str = include_str!("show_schema_diff.sql");
+
+/// Object type and name, e.g. `("column", "public.users.id")`.
+type Key = (String, String);
+
+/// Schema objects on one shard.
+type Objects = BTreeMap<Key, String>;
+
+/// Row returned by the schema query.
+struct Object {
+    key: Key,
+    definition: String,
+}
+
+impl From<DataRow> for Object {
+    fn from(value: DataRow) -> Self {
+        Self {
+            key: (
+                value.get_text(0).unwrap_or_default(),
+                value.get_text(1).unwrap_or_default(),
+            ),
+            definition: value.get_text(2).unwrap_or_default(),
+        }
+    }
+}
+
+/// Object that doesn't match the other shards.
+#[derive(Debug, PartialEq)]
+struct Drift {
+    shard: usize,
+    kind: String,
+    name: String,
+    /// `None` if the object is missing on this shard.
+    definition: Option<String>,
+    /// `None` if the object shouldn't exist.
+    expected: Option<String>,
+}
+
+pub struct ShowSchemaDiff;
+
+#[async_trait]
+impl Command for ShowSchemaDiff {
+    fn name(&self) -> String {
+        "SHOW SCHEMA DIFF".into()
+    }
+
+    fn parse(_sql: &str) -> Result<Self, Error> {
+        Ok(ShowSchemaDiff)
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        let rd = RowDescription::new(&[
+            Field::text("database"),
+            Field::bigint("shard"),
+            Field::text("type"),
+            Field::text("name"),
+            Field::text("definition"),
+            Field::text("expected"),
+        ]);
+        let mut messages = vec![rd.message()?];
+
+        for cluster in databases().schema_owners() {
+            if cluster.shards().len() < 2 {
+                continue;
+            }
+
+            let mut shards = vec![];
+            for shard in cluster.shards() {
+                let mut server = shard
+                    .primary(&Request::default())
+                    .await
+                    .map_err(backend::Error::from)?;
+                let objects = server
+                    .fetch_all::<Object>(OBJECTS)
+                    .await?
+                    .into_iter()
+                    .map(|object| (object.key, object.definition))
+                    .collect::<Objects>();
+                shards.push(objects);
+            }
+
+            for drift in diff(&shards) {
+                let mut row = DataRow::new();
+                row.add(cluster.name())
+                    .add(drift.shard as i64)
+                    .add(drift.kind.as_str())
+                    .add(drift.name.as_str())
+                    .add(drift.definition)
+                    .add(drift.expected);
+                messages.push(row.message()?);
+            }
+        }
+
+        Ok(messages)
+    }
+}
+
+/// Find objects that differ between shards.
+fn diff(shards: &[Objects]) -> Vec<Drift> {
+    let keys = shards
+        .iter()
+        .flat_map(|objects| objects.keys())
+        .collect::<BTreeSet<_>>();
+    let mut drift = vec![];
+
+    for key in keys {
+        let definitions = shards
+            .iter()
+            .map(|objects| objects.get(key))
+            .collect::<Vec<_>>();
+
+        // Missing objects count as a definition too, so an object
+        // created on one shard only is reported as extra.
+        let mut counts: HashMap<Option<&String>, usize> = HashMap::new();
+        for definition in &definitions {
+            *counts.entry(*definition).or_default() += 1;
+        }
+
+        if counts.len() == 1 {
+            continue;
+        }
+
+        // Break ties in favor of the lowest shard.
+        let expected = definitions
+            .iter()
+            .rev()
+            .max_by_key(|definition| counts[*definition])
+            .copied()
+            .flatten();
+
+        for (shard, definition) in definitions.into_iter().enumerate() {
+            if definition != expected {
+                drift.push(Drift {
+                    shard,
+                    kind: key.0.clone(),
+                    name: key.1.clone(),
+                    definition: definition.cloned(),
+                    expected: expected.cloned(),
+                });
+            }
+        }
+    }
+
+    drift
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    fn objects(objects: &[(&str, &str, &str)]) -> Objects {
+        objects
+            .iter()
+            .map(|(kind, name, definition)| {
+                ((kind.to_string(), name.to_string()), definition.to_string())
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_diff() {
+        let table = ("table", "public.users", "table");
+        let id = ("column", "public.users.id", "bigint NOT NULL");
+        let shards = vec![
+            objects(&[table, id, ("column", "public.users.email", "text")]),
+            objects(&[table, id, ("column", "public.users.email", "text")]),
+            objects(&[
+                table,
+                id,
+                ("column", "public.users.email", "character varying(255)"),
+                ("index", "public.users_email_idx", "CREATE INDEX ..."),
+            ]),
+        ];
+
+        let drift = diff(&shards);
+        assert_eq!(
+            drift,
+            vec![
+                Drift {
+                    shard: 2,
+                    kind: "column".into(),
+                    name: "public.users.email".into(),
+                    definition: Some("character varying(255)".into()),
+                    expected: Some("text".into()),
+                },
+                Drift {
+                    shard: 2,
+                    kind: "index".into(),
+                    name: "public.users_email_idx".into(),
+                    definition: Some("CREATE INDEX ...".into()),
+                    expected: None,
+                },
+            ]
+        );
+
+        assert!(diff(&[objects(&[table, id]), objects(&[table, id])]).is_empty());
+
+        // Tie: the first shard wins.
+        let drift = diff(&[objects(&[table]), objects(&[])]);
+        assert_eq!(drift.len(), 1);
+        assert_eq!(drift[0].shard, 1);
+        assert_eq!(drift[0].expected.as_deref(), Some("table"));
+    }
+}
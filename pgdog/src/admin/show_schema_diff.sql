@@ -0,0 +1,41 @@
+SELECT 'table'                                                    AS "type",
+       n.nspname || '.' || c.relname                              AS "name",
+       CASE c.relkind
+         WHEN 'r' THEN 'table'
+         WHEN 'v' THEN 'view'
+         WHEN 'm' THEN 'materialized view'
+         WHEN 'f' THEN 'foreign table'
+         WHEN 'p' THEN 'partitioned table'
+       end                                                        AS "definition"
+FROM   pg_catalog.pg_class c
+       JOIN pg_catalog.pg_namespace n
+         ON n.oid = c.relnamespace
+WHERE  c.relkind IN ( 'r', 'p', 'v', 'm', 'f' )
+       AND n.nspname !~ '^pg_'
+       AND n.nspname NOT IN ( 'information_schema', 'pgdog' )
+UNION ALL
+SELECT 'column',
+       n.nspname || '.' || c.relname || '.' || a.attname,
+       pg_catalog.format_type(a.atttypid, a.atttypmod)
+       || CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+       || COALESCE(' DEFAULT ' || pg_catalog.pg_get_expr(d.adbin, d.adrelid), '')
+FROM   pg_catalog.pg_attribute a
+       JOIN pg_catalog.pg_class c
+         ON c.oid = a.attrelid
+       JOIN pg_catalog.pg_namespace n
+         ON n.oid = c.relnamespace
+       LEFT JOIN pg_catalog.pg_attrdef d
+              ON d.adrelid = a.attrelid
+                 AND d.adnum = a.attnum
+WHERE  c.relkind IN ( 'r', 'p', 'v', 'm', 'f' )
+       AND a.attnum > 0
+       AND NOT a.attisdropped
+       AND n.nspname !~ '^pg_'
+       AND n.nspname NOT IN ( 'information_schema', 'pgdog' )
+UNION ALL
+SELECT 'index',
+       schemaname || '.' || indexname,
+       indexdef
+FROM   pg_catalog.pg_indexes
+WHERE  schemaname !~ '^pg_'
+       AND schemaname NOT IN ( 'information_schema', 'pgdog' );
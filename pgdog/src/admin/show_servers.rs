@@ -66,6 +66,7 @@ impl Command for ShowServers {
                     Field::text("last_received"),
                     Field::numeric("age"),
                     Field::text("application_name"),
+                    Field::text("server_version"),
                 ],
                 &mandatory,
             ),
@@ -118,6 +119,10 @@ impl Command for ShowServers {
                 )
                 .add("age", age.as_secs() as i64)
                 .add("application_name", server.application_name.as_str())
+                .add(
+                    "server_version",
+                    server.server_version.map(|version| version.to_string()),
+                )
                 .data_row();
             messages.push(dr.message()?);
         }
@@ -0,0 +1,122 @@
+//! SHOW SHARD_OF <database> <table>[.<column>] <key>
+//!
+//! Find out which shard a sharding key belongs to, using the current configuration.
+//!
+
+use crate::backend::databases::databases;
+
+use super::prelude::*;
+
+pub struct ShowShardOf {
+    database: String,
+    table: String,
+    column: Option<String>,
+    key: String,
+}
+
+#[async_trait]
+impl Command for ShowShardOf {
+    fn name(&self) -> String {
+        "SHOW SHARD_OF".into()
+    }
+
+    /// Parse the command. Sharding keys are case-sensitive,
+    /// so this expects the query as the client sent it.
+    ///
+    /// The key is the rest of the command. It can be quoted like a string
+    /// literal, so it can contain spaces and semicolons.
+    fn parse(sql: &str) -> Result<Self, Error> {
+        let mut rest = sql.trim();
+        let mut words = [""; 4];
+        for word in words.iter_mut() {
+            let (next, tail) = rest.split_once(char::is_whitespace).ok_or(Error::Syntax)?;
+            *word = next;
+            rest = tail.trim_start();
+        }
+
+        let [show, shard_of, database, table] = words;
+        if !show.eq_ignore_ascii_case("show") || !shard_of.eq_ignore_ascii_case("shard_of") {
+            return Err(Error::Syntax);
+        }
+
+        let (table, column) = match table.split_once('.') {
+            Some((table, column)) => (table, Some(column.to_owned())),
+            None => (table, None),
+        };
+
+        Ok(Self {
+            database: database.to_owned(),
+            table: table.to_owned(),
+            column,
+            key: Self::key(rest)?,
+        })
+    }
+
+    async fn execute(&self) -> Result<Vec<Message>, Error> {
+        let schema = databases()
+            .sharding_schema(&self.database)
+            .ok_or_else(|| Error::NoSuchDatabase(self.database.clone()))?;
+        let shard = schema.shard_of(&self.table, self.column.as_deref(), &self.key)?;
+
+        let mut dr = DataRow::new();
+        dr.add(&self.database)
+            .add(&self.table)
+            .add(&self.key)
+            .add(shard.to_string());
+
+        Ok(vec![
+            RowDescription::new(&[
+                Field::text("database"),
+                Field::text("table"),
+                Field::text("key"),
+                Field::text("shard"),
+            ])
+            .message()?,
+            dr.message()?,
+        ])
+    }
+}
+
+impl ShowShardOf {
+    /// Remove quotes from the key, if it's quoted.
+    fn key(key: &str) -> Result<String, Error> {
+        match key.strip_prefix('\'') {
+            Some(quoted) => quoted
+                .strip_suffix('\'')
+                .map(|key| key.replace("''", "'"))
+                .ok_or(Error::Syntax),
+            None if key.is_empty() || key.contains(char::is_whitespace) => Err(Error::Syntax),
+            None => Ok(key.to_owned()),
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_parse() {
+        let cmd = ShowShardOf::parse("SHOW SHARD_OF prod users 12345").unwrap();
+        assert_eq!(cmd.database, "prod");
+        assert_eq!(cmd.table, "users");
+        assert!(cmd.column.is_none());
+        assert_eq!(cmd.key, "12345");
+
+        let cmd = ShowShardOf::parse("show shard_of prod users.email 'Alice@example.com'").unwrap();
+        assert_eq!(cmd.table, "users");
+        assert_eq!(cmd.column.as_deref(), Some("email"));
+        assert_eq!(cmd.key, "Alice@example.com");
+
+        assert!(ShowShardOf::parse("SHOW SHARD_OF prod users").is_err());
+
+        let cmd = ShowShardOf::parse("SHOW SHARD_OF prod users  'New York; NY'").unwrap();
+        assert_eq!(cmd.key, "New York; NY");
+
+        let cmd = ShowShardOf::parse("SHOW SHARD_OF prod users 'O''Brien'").unwrap();
+        assert_eq!(cmd.key, "O'Brien");
+
+        assert!(ShowShardOf::parse("SHOW SHARD_OF prod users New York").is_err());
+        assert!(ShowShardOf::parse("SHOW SHARD_OF prod users 'New York").is_err());
+    }
+}
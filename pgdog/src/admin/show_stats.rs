@@ -47,6 +47,7 @@ impl Command for ShowStats {
                         Field::numeric(&format!("{}_errors", prefix)),
                         Field::numeric(&format!("{}_cleaned", prefix)),
                         Field::numeric(&format!("{}_rollbacks", prefix)),
+                        Field::numeric(&format!("{}_idle_xact_timeouts", prefix)),
                         Field::numeric(&format!("{}_connect_time", prefix)),
                         Field::numeric(&format!("{}_connect_count", prefix)),
                         Field::numeric(&format!("{}_reads", prefix)),
@@ -97,6 +98,7 @@ impl Command for ShowStats {
                             .add(stat.errors)
                             .add(stat.cleaned)
                             .add(stat.rollbacks)
+                            .add(stat.idle_xact_timeouts)
                             .add(millis(stat.connect_time))
                             .add(stat.connect_count)
                             .add(stat.reads)
@@ -121,6 +121,14 @@ async fn show_pools_reports_schema_admin_flag() {
         "force_closed",
         "online",
         "schema_admin",
+        "pause_state",
+        "pool_size",
+        "autoscale_events",
+        "last_autoscale",
+        "pool_class",
+        "wait_p50_us",
+        "wait_p95_us",
+        "wait_p99_us",
     ];
     assert_eq!(actual_names, expected_names);
 
@@ -11,6 +11,7 @@ use async_task::{AsyncTaskWaiter, AsyncTasksStorage, TaskError};
 
 pub mod async_task;
 pub mod copy_data;
+pub mod move_range;
 pub mod replication;
 pub mod resharding;
 pub mod schema_sync;
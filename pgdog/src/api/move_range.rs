@@ -0,0 +1,400 @@
+//! Move a range of sharding keys to another shard.
+//!
+//! Driven by the admin `RESHARD MOVE` command. Traffic to the database is
+//! paused while the rows in the range are copied from the shard that owns
+//! them to the destination and deleted from the source, both in one
+//! transaction per shard, committed with two-phase commit. Once committed,
+//! the range rule is pointed at the new shard and traffic resumes. Clients
+//! wait instead of erroring, so this is meant for hot ranges that copy in
+//! seconds; moving most of a database should use `RESHARD` to a new cluster
+//! instead.
+
+use std::fmt::Display;
+use std::time::Duration;
+
+use pgdog_config::FlexibleType;
+use tokio::{
+    select,
+    time::{sleep, timeout},
+};
+use tracing::{error, info};
+
+use crate::api::Task;
+use crate::api::async_task::AsyncTaskContext;
+use crate::backend::databases::{self, databases};
+use crate::backend::pool::{Address, Pool};
+use crate::backend::replication::logical::Error;
+use crate::backend::{ConnectReason, Server, ServerOptions};
+use crate::config::{Role, config};
+use crate::frontend::client::query_engine::two_pc::{
+    TwoPcPhase, TwoPcTransaction, statement::phase_control,
+};
+use crate::net::{CopyData, CopyDone, ErrorResponse, FromBytes, Protocol, Query, ToBytes};
+use crate::util::escape_identifier;
+
+/// How often to check that paused pools got their connections back.
+const PAUSE_CHECK_INTERVAL: Duration = Duration::from_millis(100);
+
+/// How often to report the number of copied rows.
+const PROGRESS_ROWS: usize = 10_000;
+
+/// Table moved along with the range.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct MoveTable {
+    pub schema: Option<String>,
+    pub name: String,
+}
+
+impl Display for MoveTable {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        if let Some(ref schema) = self.schema {
+            write!(f, "\"{}\".", escape_identifier(schema))?;
+        }
+        write!(f, "\"{}\"", escape_identifier(&self.name))
+    }
+}
+
+/// Move rows in `[start, end)` of `column` from shard `from` to shard `to`,
+/// then point the range rule to `to`.
+#[derive(Display, Debug, bon::Builder)]
+#[display("move_range {database} {column} [{start}, {end}) {from} -> {to}")]
+pub(crate) struct MoveRangeTask {
+    pub database: String,
+    pub column: String,
+    pub start: FlexibleType,
+    pub end: FlexibleType,
+    /// Tables with the range rule. They move together so joins
+    /// between them stay on one shard.
+    pub tables: Vec<MoveTable>,
+    pub from: usize,
+    pub to: usize,
+}
+
+/// Stages of the move, reported as the task's status.
+#[derive(Debug, Clone, PartialEq, Eq, Display)]
+pub(crate) enum MoveRangeStatus {
+    /// Waiting for clients to finish their transactions.
+    #[display("pausing")]
+    Pausing,
+    #[display("copying {table}: {rows} rows")]
+    Copying { table: String, rows: usize },
+    #[display("deleting {table}")]
+    Deleting { table: String },
+    #[display("committing")]
+    Committing,
+    /// Pointing the range rule to the destination shard.
+    #[display("cutting over")]
+    CuttingOver,
+}
+
+impl Task for MoveRangeTask {
+    type Status = MoveRangeStatus;
+    type Output = ();
+    type Error = Error;
+
+    // Pools stay paused if the task is aborted, so give it
+    // time to roll back and resume them.
+    fn cancel_timeout() -> Duration {
+        Duration::from_secs(60)
+    }
+
+    async fn run(self, ctx: AsyncTaskContext<Self>) -> Result<(), Error> {
+        let token = ctx.cancellation_token();
+        let (source, destination) = (self.primary(self.from)?, self.primary(self.to)?);
+
+        ctx.set_status(MoveRangeStatus::Pausing);
+        self.pause(true);
+
+        let result = async {
+            select! {
+                result = self.paused() => result?,
+                _ = token.cancelled() => return Err(Error::MoveRangeAborted),
+            }
+
+            let mut source =
+                Server::connect(&source, ServerOptions::default(), ConnectReason::Other).await?;
+            let mut destination =
+                Server::connect(&destination, ServerOptions::default(), ConnectReason::Other)
+                    .await?;
+
+            // Nothing is visible until both shards commit. On error before
+            // they are prepared, dropping the connections rolls both back.
+            source.execute_checked("BEGIN").await?;
+            destination.execute_checked("BEGIN").await?;
+
+            for table in &self.tables {
+                select! {
+                    result = self.copy(&ctx, table, &mut source, &mut destination) => result?,
+                    _ = token.cancelled() => return Err(Error::MoveRangeAborted),
+                }
+
+                ctx.set_status(MoveRangeStatus::Deleting {
+                    table: table.to_string(),
+                });
+                source
+                    .execute_checked(format!("DELETE FROM {} WHERE {}", table, self.filter()))
+                    .await?;
+            }
+
+            ctx.set_status(MoveRangeStatus::Committing);
+            self.commit(&mut source, &mut destination).await?;
+
+            ctx.set_status(MoveRangeStatus::CuttingOver);
+            databases::move_range(
+                &self.database,
+                &self.column,
+                &self.start,
+                &self.end,
+                self.to,
+            )
+            .await?;
+
+            Ok(())
+        }
+        .await;
+
+        self.pause(false);
+
+        if result.is_ok() {
+            info!("[{}] range moved", self);
+        }
+
+        result
+    }
+}
+
+impl MoveRangeTask {
+    /// Address of the shard's primary.
+    fn primary(&self, shard: usize) -> Result<Address, Error> {
+        let cluster = databases().schema_owner(&self.database)?;
+
+        cluster
+            .shards()
+            .get(shard)
+            .and_then(|shard| {
+                shard
+                    .pools_with_roles_and_bans()
+                    .into_iter()
+                    .find(|(role, _, _)| *role == Role::Primary)
+            })
+            .map(|(_, _, pool)| pool.addr().clone())
+            .ok_or(Error::NoPrimary)
+    }
+
+    /// All pools of the database, for all users.
+    fn pools(&self) -> Vec<Pool> {
+        databases()
+            .all()
+            .iter()
+            .filter(|(user, _)| user.database == self.database)
+            .flat_map(|(_, cluster)| cluster.shards().to_vec())
+            .flat_map(|shard| shard.pools().into_iter().chain(shard.slow_pools()))
+            .collect()
+    }
+
+    fn pause(&self, pause: bool) {
+        for pool in self.pools() {
+            if pause {
+                pool.pause();
+            } else {
+                pool.resume();
+            }
+        }
+    }
+
+    /// Wait for clients to return their connections, for up to `cutover_timeout`.
+    /// A client holding a transaction open would block the move forever otherwise.
+    async fn paused(&self) -> Result<(), Error> {
+        let cutover_timeout = config().config.general.cutover_timeout;
+
+        timeout(Duration::from_millis(cutover_timeout), async {
+            while self.pools().iter().any(|pool| pool.state().checked_out > 0) {
+                sleep(PAUSE_CHECK_INTERVAL).await;
+            }
+        })
+        .await
+        .map_err(|_| Error::MoveRangePauseTimeout(cutover_timeout))
+    }
+
+    /// Commit both transactions with two-phase commit, so the rows are
+    /// either moved or left where they were.
+    async fn commit(&self, source: &mut Server, destination: &mut Server) -> Result<(), Error> {
+        let transaction = TwoPcTransaction::new();
+        let control = |shard, phase| phase_control(transaction, shard, phase);
+
+        destination
+            .execute_checked(control(self.to, TwoPcPhase::Phase1))
+            .await?;
+
+        if let Err(err) = source
+            .execute_checked(control(self.from, TwoPcPhase::Phase1))
+            .await
+        {
+            destination
+                .execute_checked(control(self.to, TwoPcPhase::Rollback))
+                .await?;
+            return Err(err.into());
+        }
+
+        // Both shards will commit now, even if the connection breaks.
+        for (server, shard) in [(destination, self.to), (source, self.from)] {
+            if let Err(err) = server
+                .execute_checked(control(shard, TwoPcPhase::Phase2))
+                .await
+            {
+                error!(
+                    "[{}] transaction is prepared but not committed on shard {}, \
+                     it needs to be committed by hand: {}",
+                    self,
+                    shard,
+                    control(shard, TwoPcPhase::Phase2)
+                );
+                return Err(err.into());
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Columns we can insert into, i.e. without generated columns.
+    async fn columns(&self, table: &MoveTable, source: &mut Server) -> Result<String, Error> {
+        let columns: Vec<String> = source
+            .fetch_all(format!(
+                "SELECT attname::text FROM pg_attribute \
+                 WHERE attrelid = '{}'::regclass AND attnum > 0 \
+                 AND NOT attisdropped AND attgenerated = '' \
+                 ORDER BY attnum",
+                table.to_string().replace('\'', "''")
+            ))
+            .await?;
+
+        Ok(columns
+            .iter()
+            .map(|column| format!("\"{}\"", escape_identifier(column)))
+            .collect::<Vec<_>>()
+            .join(", "))
+    }
+
+    /// Rows in the range.
+    fn filter(&self) -> String {
+        let column = format!("\"{}\"", escape_identifier(&self.column));
+
+        format!(
+            "{column} >= {} AND {column} < {}",
+            literal(&self.start),
+            literal(&self.end)
+        )
+    }
+
+    /// Stream rows in the range from the source to the destination.
+    async fn copy(
+        &self,
+        ctx: &AsyncTaskContext<Self>,
+        table: &MoveTable,
+        source: &mut Server,
+        destination: &mut Server,
+    ) -> Result<(), Error> {
+        let status = |rows| MoveRangeStatus::Copying {
+            table: table.to_string(),
+            rows,
+        };
+        ctx.set_status(status(0));
+
+        // Generated columns can't be copied into.
+        let columns = self.columns(table, source).await?;
+        let copy_in = Query::new(format!("COPY {} ({}) FROM STDIN", table, columns));
+        let copy_out = Query::new(format!(
+            "COPY (SELECT {} FROM {} WHERE {}) TO STDOUT",
+            columns,
+            table,
+            self.filter()
+        ));
+
+        destination.send(&vec![copy_in.into()].into()).await?;
+        expect(destination, 'G').await?;
+        source.send(&vec![copy_out.into()].into()).await?;
+        expect(source, 'H').await?;
+
+        let mut rows = 0;
+        loop {
+            let message = source.read().await?;
+            match message.code() {
+                'd' => {
+                    let data = CopyData::from_bytes(message.to_bytes())?;
+                    destination.send_one(&data.into()).await?;
+                    rows += 1;
+
+                    if rows % PROGRESS_ROWS == 0 {
+                        destination.flush().await?;
+                        ctx.set_status(status(rows));
+                    }
+                }
+                'c' | 'C' | 'N' | 'S' => (),
+                'Z' => break,
+                'E' => return Err(ErrorResponse::from_bytes(message.to_bytes())?.into()),
+                c => return Err(Error::OutOfSync(c)),
+            }
+        }
+
+        destination.send_one(&CopyDone.into()).await?;
+        destination.flush().await?;
+        expect(destination, 'Z').await?;
+
+        ctx.set_status(status(rows));
+
+        Ok(())
+    }
+}
+
+/// Read messages until the expected one, skipping command completions
+/// and asynchronous messages.
+async fn expect(server: &mut Server, code: char) -> Result<(), Error> {
+    loop {
+        let message = server.read().await?;
+        match message.code() {
+            c if c == code => return Ok(()),
+            'C' | 'N' | 'S' => (),
+            'E' => return Err(ErrorResponse::from_bytes(message.to_bytes())?.into()),
+            c => return Err(Error::OutOfSync(c)),
+        }
+    }
+}
+
+/// Range bound as an SQL literal.
+fn literal(value: &FlexibleType) -> String {
+    match value {
+        FlexibleType::Integer(value) => value.to_string(),
+        FlexibleType::Uuid(value) => format!("'{}'", value),
+        FlexibleType::String(value) => format!("'{}'", value.replace('\'', "''")),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_sql() {
+        let task = MoveRangeTask::builder()
+            .database("prod".into())
+            .column("tenant_id".into())
+            .start(FlexibleType::String("a".into()))
+            .end(FlexibleType::String("o'b".into()))
+            .tables(vec![])
+            .from(0)
+            .to(1)
+            .build();
+
+        assert_eq!(
+            task.filter(),
+            r#""tenant_id" >= 'a' AND "tenant_id" < 'o''b'"#
+        );
+        assert_eq!(literal(&FlexibleType::Integer(-5)), "-5");
+
+        let table = MoveTable {
+            schema: Some("public".into()),
+            name: "users".into(),
+        };
+        assert_eq!(table.to_string(), r#""public"."users""#);
+    }
+}
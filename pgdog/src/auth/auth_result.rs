@@ -19,6 +19,10 @@ pub enum AuthResult {
     NoUserOrDatabase,
     /// Client didn't provide password message.
     NoPasswordMessage,
+    /// Client isn't connecting from a trusted network.
+    NoTrustedNetwork,
+    /// Operating system user of a UNIX socket client doesn't match.
+    NoPeerMatch,
 }
 
 impl AuthResult {
@@ -46,6 +50,8 @@ impl Display for AuthResult {
             }
             Self::NoUserOrDatabase => write!(f, "no user or database in config"),
             Self::NoPasswordMessage => write!(f, "client did not send password message"),
+            Self::NoTrustedNetwork => write!(f, "client network is not trusted"),
+            Self::NoPeerMatch => write!(f, "operating system user does not match"),
         }
     }
 }
@@ -43,13 +43,20 @@ impl<'a> Client<'a> {
     }
 
     fn encrypt(&self, password: &str) -> String {
-        let mut md5 = Context::new();
-        md5.consume(password);
-        md5.consume(self.user);
-        let first_pass = md5.compute();
+        // Stored md5 hashes, e.g. from pgbouncer's userlist.txt,
+        // are already the first pass.
+        let first_pass = match md5_hash(password) {
+            Some(hash) => hash.to_owned(),
+            None => {
+                let mut md5 = Context::new();
+                md5.consume(password);
+                md5.consume(self.user);
+                format!("{:x}", md5.compute())
+            }
+        };
 
         let mut md5 = Context::new();
-        md5.consume(format!("{:x}", first_pass));
+        md5.consume(first_pass);
         md5.consume(self.salt);
         format!("md5{:x}", md5.compute())
     }
@@ -73,6 +80,13 @@ impl<'a> Client<'a> {
     }
 }
 
+/// Get the hex digest if the password is an md5 hash, i.e. `md5` followed by 32 hex digits.
+pub fn md5_hash(password: &str) -> Option<&str> {
+    password
+        .strip_prefix("md5")
+        .filter(|hash| hash.len() == 32 && hash.bytes().all(|b| b.is_ascii_hexdigit()))
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -181,6 +195,17 @@ mod tests {
         assert!(!client.check(&hash));
     }
 
+    #[test]
+    fn check_accepts_stored_md5_hash() {
+        let salt = [9u8, 8, 7, 6];
+        let stored = format!("md5{:x}", md5::compute("hunter2alice"));
+        let client = Client::new_salt("alice", &[stored], &salt).unwrap();
+        let hash = reference_hash("alice", "hunter2", &salt);
+        assert!(client.check(&hash));
+        assert_eq!(client.encrypted().unwrap(), hash);
+        assert!(md5_hash("md5short").is_none());
+    }
+
     #[test]
     fn check_is_user_specific() {
         // Same password, different user → different MD5; check must reject.
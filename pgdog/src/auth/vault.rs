@@ -212,6 +212,45 @@ pub(crate) async fn fetch_secret<T: DeserializeOwned>(
         .await
         .map_err(|err| error(format!("request to \"{}\" failed: {}", url, err)))?;
 
+    parse_response(&url, response).await
+}
+
+/// Response from `sys/leases/renew`.
+#[derive(Deserialize)]
+pub(crate) struct LeaseResponse {
+    /// Seconds the lease was extended by. Vault may grant less than
+    /// requested once the lease approaches its max TTL.
+    pub(crate) lease_duration: u64,
+}
+
+/// Renew a lease issued by a Vault secrets engine, asking Vault
+/// to extend it by `increment`.
+pub(crate) async fn renew_lease(
+    vault: &Vault,
+    lease_id: &str,
+    increment: Duration,
+) -> Result<LeaseResponse, Error> {
+    let token = vault_token(vault).await?;
+    let url = format!("{}/v1/sys/leases/renew", vault.url.trim_end_matches('/'));
+
+    let response = client(vault)?
+        .put(&url)
+        .header("X-Vault-Token", token)
+        .json(&json!({ "lease_id": lease_id, "increment": increment.as_secs() }))
+        .send()
+        .await
+        .map_err(|err| error(format!("request to \"{}\" failed: {}", url, err)))?;
+
+    parse_response(&url, response).await
+}
+
+/// Check the response status and parse the JSON body.
+///
+/// A `403` drops the cached client token, so the next attempt logs in again.
+async fn parse_response<T: DeserializeOwned>(
+    url: &str,
+    response: reqwest::Response,
+) -> Result<T, Error> {
     let status = response.status();
 
     if status == reqwest::StatusCode::FORBIDDEN {
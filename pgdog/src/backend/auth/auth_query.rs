@@ -0,0 +1,175 @@
+//! Look up passwords of users that aren't in `users.toml`
+//! by running `auth_query` against the backend, as `auth_user`.
+//!
+//! This is equivalent to pgbouncer's `auth_query` and is typically used with
+//! a security-definer function returning the SCRAM verifier from `pg_authid`.
+
+use std::collections::HashSet;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use tracing::debug;
+
+use crate::backend::{Error, databases::databases, pool::Request};
+use crate::config::{General, User};
+use crate::net::{
+    Bind, DataRow, ErrorResponse, Execute, FromBytes, Parse, ProtocolMessage, Sync, ToBytes,
+    messages::Parameter,
+};
+
+/// Users added to the config by this module or from `auth_file`, so we look
+/// them up again on every login and pick up password changes.
+static LOOKED_UP: Lazy<Mutex<HashSet<(String, String)>>> = Lazy::new(|| Mutex::new(HashSet::new()));
+
+/// Was this user added by `auth_query` or from `auth_file`?
+pub(crate) fn looked_up(user: &str, database: &str) -> bool {
+    LOOKED_UP
+        .lock()
+        .contains(&(user.to_owned(), database.to_owned()))
+}
+
+/// Record that this user was added by `auth_query` or from `auth_file`.
+pub(crate) fn mark_looked_up(user: &str, database: &str) {
+    LOOKED_UP
+        .lock()
+        .insert((user.to_owned(), database.to_owned()));
+}
+
+/// Run `auth_query` for the user and return its config entry.
+///
+/// Returns `None` if `auth_query` isn't configured or the user doesn't exist.
+pub(crate) async fn lookup(
+    general: &General,
+    user: &str,
+    database: &str,
+) -> Result<Option<User>, Error> {
+    let (Some(query), Some(auth_user)) = (&general.auth_query, &general.auth_user) else {
+        return Ok(None);
+    };
+
+    // The auth user can't look itself up.
+    if auth_user == user {
+        return Ok(None);
+    }
+
+    let cluster = databases().cluster((auth_user.as_str(), database))?;
+    let mut server = cluster.primary(0, &Request::default()).await?;
+
+    debug!(
+        r#"looking up user "{}" with auth_query [{}]"#,
+        user,
+        server.addr()
+    );
+
+    server
+        .send(
+            &vec![
+                ProtocolMessage::Parse(Parse::new_anonymous(query)),
+                ProtocolMessage::Bind(Bind::new_params("", &[Parameter::new(user.as_bytes())])),
+                ProtocolMessage::Execute(Execute::new()),
+                ProtocolMessage::Sync(Sync),
+            ]
+            .into(),
+        )
+        .await?;
+
+    let mut row = None;
+    let mut error = None;
+
+    loop {
+        let message = server.read().await?;
+
+        match message.code() {
+            'D' if row.is_none() => row = Some(DataRow::from_bytes(message.to_bytes())?),
+            'E' => error = Some(ErrorResponse::from_bytes(message.to_bytes())?),
+            'Z' => break,
+            _ => (),
+        }
+    }
+
+    if let Some(error) = error {
+        return Err(Error::ExecutionError(Box::new(error)));
+    }
+
+    Ok(row.and_then(|row| user_from_row(&row, user, database)))
+}
+
+/// Create the user config entry from the `auth_query` result.
+fn user_from_row(row: &DataRow, user: &str, database: &str) -> Option<User> {
+    let name = row.get_text(0)?;
+    let password = row.get_text(1)?;
+
+    if name != user || password.is_empty() {
+        return None;
+    }
+
+    let mut entry = User {
+        name,
+        database: database.to_owned(),
+        ..Default::default()
+    };
+
+    // md5 hashes are used as the password, see `auth::md5`.
+    if password.starts_with("SCRAM-SHA-256$") {
+        entry.password_hash = Some(password);
+    } else {
+        entry.password = Some(password);
+    }
+
+    Some(entry)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::net::data_row::Data;
+
+    #[test]
+    fn test_user_from_row_scram() {
+        let verifier = "SCRAM-SHA-256$4096:c2FsdA==$c3RvcmVk:c2VydmVy";
+        let mut row = DataRow::new();
+        row.add("alice").add(verifier);
+
+        let user = user_from_row(&row, "alice", "pgdog").unwrap();
+        assert_eq!(user.name, "alice");
+        assert_eq!(user.database, "pgdog");
+        assert_eq!(user.password_hash.as_deref(), Some(verifier));
+        assert!(user.password.is_none());
+    }
+
+    #[test]
+    fn test_user_from_row_plain() {
+        let mut row = DataRow::new();
+        row.add("alice").add("secret");
+
+        let user = user_from_row(&row, "alice", "pgdog").unwrap();
+        assert_eq!(user.password.as_deref(), Some("secret"));
+        assert!(user.password_hash.is_none());
+    }
+
+    #[test]
+    fn test_user_from_row_md5() {
+        let mut row = DataRow::new();
+        row.add("alice").add("md5d4f6b1b2c3a4e5f60718293a4b5c6d7e");
+
+        let user = user_from_row(&row, "alice", "pgdog").unwrap();
+        assert_eq!(
+            user.password.as_deref(),
+            Some("md5d4f6b1b2c3a4e5f60718293a4b5c6d7e")
+        );
+        assert!(user.password_hash.is_none());
+    }
+
+    #[test]
+    fn test_user_from_row_rejected() {
+        // Different user.
+        let mut row = DataRow::new();
+        row.add("bob").add("secret");
+        assert!(user_from_row(&row, "alice", "pgdog").is_none());
+
+        // No password.
+        let mut row = DataRow::new();
+        row.add("alice").add(Data::null());
+        assert!(user_from_row(&row, "alice", "pgdog").is_none());
+    }
+}
@@ -63,6 +63,8 @@ mod tests {
             vault_path: Default::default(),
             vault_refresh_percent: None,
             configured_role: Role::Auto,
+            server_role: None,
+            zone: None,
         };
 
         let (b64_token, expires_at) = token(addr).await.unwrap();
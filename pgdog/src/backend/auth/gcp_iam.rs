@@ -0,0 +1,104 @@
+use std::env;
+use std::time::{Duration, SystemTime};
+
+use serde::Deserialize;
+
+use crate::backend::{Error, pool::Address};
+
+/// Metadata server used when `GCE_METADATA_HOST` isn't set.
+const METADATA_HOST: &str = "metadata.google.internal";
+
+/// Scope required to log into Cloud SQL and AlloyDB with IAM database authentication.
+const SCOPE: &str = "https://www.googleapis.com/auth/sqlservice.login";
+
+/// Access token returned by the metadata server.
+#[derive(Debug, Deserialize)]
+struct AccessToken {
+    access_token: String,
+    expires_in: u64,
+}
+
+/// Fetch a fresh GCP IAM access token for `addr` from the metadata server
+/// of the service account attached to this instance (GCE, GKE Workload Identity, Cloud Run).
+///
+/// This is the raw fetcher passed to [`TokenCache::get_or_fetch`] and
+/// called by the monitor's refresh loop. Callers should never invoke it
+/// directly — go through [`TokenCache::global`] instead.
+pub(crate) async fn token(addr: Address) -> Result<(String, SystemTime), Error> {
+    let host = env::var("GCE_METADATA_HOST").unwrap_or_else(|_| METADATA_HOST.to_owned());
+    let url = format!(
+        "http://{}/computeMetadata/v1/instance/service-accounts/default/token",
+        host
+    );
+
+    let error = |message: String| {
+        Error::GcpIamToken(format!(
+            "{} for {}@{}:{}",
+            message, addr.user, addr.host, addr.port
+        ))
+    };
+
+    let response = reqwest::Client::new()
+        .get(&url)
+        .header("Metadata-Flavor", "Google")
+        .query(&[("scopes", SCOPE)])
+        .send()
+        .await
+        .map_err(|err| error(format!("request to \"{}\" failed: {}", url, err)))?;
+
+    let status = response.status();
+    if !status.is_success() {
+        return Err(error(format!("metadata server returned {}", status)));
+    }
+
+    let token: AccessToken = response
+        .json()
+        .await
+        .map_err(|err| error(format!("invalid metadata server response: {}", err)))?;
+
+    let expires_at = SystemTime::now() + Duration::from_secs(token.expires_in);
+    Ok((token.access_token, expires_at))
+}
+
+#[cfg(test)]
+mod tests {
+    use wiremock::matchers::{header, method, path, query_param};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+    use crate::config::ServerAuth;
+    use crate::test_utils::set_env_var;
+
+    #[tokio::test]
+    async fn test_token_from_metadata_server() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("GET"))
+            .and(path(
+                "/computeMetadata/v1/instance/service-accounts/default/token",
+            ))
+            .and(header("Metadata-Flavor", "Google"))
+            .and(query_param("scopes", SCOPE))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "access_token": "ya29.token",
+                "expires_in": 3599,
+                "token_type": "Bearer",
+            })))
+            .mount(&server)
+            .await;
+
+        let _host = set_env_var("GCE_METADATA_HOST", server.address().to_string());
+
+        let addr = Address {
+            host: "10.0.0.5".into(),
+            port: 5432,
+            user: "sa@project.iam".into(),
+            server_auth: ServerAuth::GcpIam,
+            ..Default::default()
+        };
+
+        let (token, expires_at) = token(addr).await.unwrap();
+        assert_eq!(token, "ya29.token");
+        assert!(expires_at > SystemTime::now() + Duration::from_secs(3000));
+    }
+}
@@ -1,3 +1,5 @@
+pub mod auth_query;
 pub mod azure_workload_identity;
+pub mod gcp_iam;
 pub mod rds_iam;
 pub mod vault;
@@ -104,6 +104,8 @@ mod tests {
             vault_path: Default::default(),
             vault_refresh_percent: None,
             configured_role: Role::Auto,
+            server_role: None,
+            zone: None,
         }
     }
 
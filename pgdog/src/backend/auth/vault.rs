@@ -5,7 +5,10 @@
 //! Vault generates the username, so credentials are cached in the global
 //! [`TokenCache`](crate::backend::pool::token_cache::TokenCache) via
 //! [`TokenCache::credentials_or_fetch`] and proactively refreshed by the pool
-//! monitor after a configured percentage of the lease.
+//! monitor after a configured percentage of the lease. Renewable leases are
+//! extended in place, so existing server connections keep their credentials;
+//! new credentials are only fetched once Vault stops extending the lease
+//! (e.g. it reached its max TTL) or renewal fails.
 //!
 //! Pools configured with `server_auth = "vault_static"` fetch the current
 //! password for a Vault static database role instead.
@@ -19,12 +22,15 @@
 //! The Vault login/token cache itself lives in
 //! [`crate::auth::vault`], shared with static role client-auth verification.
 
+use std::collections::HashMap;
 use std::time::{Duration, Instant};
 
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
 use serde::Deserialize;
-use tracing::info;
+use tracing::{info, warn};
 
-use crate::auth::vault::{StaticSecretResponse, error, fetch_secret};
+use crate::auth::vault::{StaticSecretResponse, error, fetch_secret, renew_lease};
 use crate::backend::pool::token_cache::{Credentials, FetchedCredentials};
 use crate::backend::{Error, pool::Address};
 use crate::config::config;
@@ -32,10 +38,40 @@ use pgdog_config::vault::DEFAULT_REFRESH_PERCENT;
 
 #[derive(Deserialize)]
 struct SecretResponse {
+    #[serde(default)]
+    lease_id: String,
+    #[serde(default)]
+    renewable: bool,
     lease_duration: u64,
     data: SecretData,
 }
 
+/// Renewable lease backing the dynamic credentials of a pool.
+#[derive(Clone, Debug)]
+struct Lease {
+    id: String,
+    duration: Duration,
+}
+
+/// Leases of dynamic credentials, keyed by pool address.
+static LEASES: Lazy<Mutex<HashMap<String, Lease>>> = Lazy::new(|| Mutex::new(HashMap::new()));
+
+fn lease_key(addr: &Address) -> String {
+    format!(
+        "{}@{}:{}/{}",
+        addr.user, addr.host, addr.port, addr.database_name
+    )
+}
+
+/// Outcome of a proactive dynamic credentials refresh.
+#[derive(Debug)]
+pub(crate) enum Refresh {
+    /// The lease was extended; credentials didn't change.
+    Renewed { refresh_at: Instant },
+    /// Vault issued new credentials.
+    Rotated(FetchedCredentials),
+}
+
 #[derive(Deserialize)]
 struct SecretData {
     username: String,
@@ -83,6 +119,18 @@ pub(crate) async fn credentials(addr: Address) -> Result<FetchedCredentials, Err
 
     let lease = Duration::from_secs(secret.lease_duration);
 
+    if secret.renewable && !secret.lease_id.is_empty() {
+        LEASES.lock().insert(
+            lease_key(&addr),
+            Lease {
+                id: secret.lease_id,
+                duration: lease,
+            },
+        );
+    } else {
+        LEASES.lock().remove(&lease_key(&addr));
+    }
+
     info!(
         user = %addr.user,
         vault_user = %secret.data.username,
@@ -103,6 +151,57 @@ pub(crate) async fn credentials(addr: Address) -> Result<FetchedCredentials, Err
     })
 }
 
+/// Proactively refresh dynamic database credentials for `addr`.
+///
+/// Called by the monitor's refresh loop. Renews the current lease when
+/// Vault allows it, so the pool keeps its credentials and existing server
+/// connections aren't recycled. Fetches new credentials when there is no
+/// renewable lease, renewal fails, or Vault grants a shorter extension than
+/// the original lease, which means it's approaching its max TTL.
+pub(crate) async fn refresh(addr: Address) -> Result<Refresh, Error> {
+    let lease = LEASES.lock().get(&lease_key(&addr)).cloned();
+
+    if let Some(lease) = lease {
+        let (vault, _) = vault_and_path(&addr)?;
+
+        match renew_lease(&vault, &lease.id, lease.duration).await {
+            Ok(renewed) if Duration::from_secs(renewed.lease_duration) >= lease.duration => {
+                info!(
+                    user = %addr.user,
+                    ttl_secs = renewed.lease_duration,
+                    "renewed Vault credentials lease"
+                );
+
+                return Ok(Refresh::Renewed {
+                    refresh_at: scheduled_refresh(
+                        Instant::now(),
+                        lease.duration,
+                        addr.vault_refresh_percent,
+                    ),
+                });
+            }
+
+            Ok(renewed) => {
+                info!(
+                    user = %addr.user,
+                    ttl_secs = renewed.lease_duration,
+                    "Vault credentials lease is near its max TTL, rotating credentials"
+                );
+            }
+
+            Err(err) => {
+                warn!(
+                    user = %addr.user,
+                    "failed to renew Vault credentials lease, rotating credentials: {}",
+                    err
+                );
+            }
+        }
+    }
+
+    credentials(addr).await.map(Refresh::Rotated)
+}
+
 /// Minimum time between refresh attempts for a Vault static role.
 ///
 /// This floor guards against hammering Vault when the
@@ -190,6 +289,8 @@ mod tests {
             vault_refresh_percent: None,
             database_number: 0,
             configured_role: Role::Primary,
+            server_role: None,
+            zone: None,
         }
     }
 
@@ -314,6 +415,120 @@ mod tests {
         assert!(msg.contains("internal error"), "expected body in: {msg}");
     }
 
+    // ── refresh(): lease renewal ──────────────────────────────────────────────
+
+    async fn mock_dynamic_role(server: &MockServer, lease_id: &str, username: &str) {
+        Mock::given(method("POST"))
+            .and(path("/v1/auth/approle/login"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(json!({
+                "auth": { "client_token": "s.tok", "lease_duration": 3600 }
+            })))
+            .mount(server)
+            .await;
+
+        Mock::given(method("GET"))
+            .and(path("/v1/database/creds/pgdog-role"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(json!({
+                "lease_id": lease_id,
+                "renewable": true,
+                "lease_duration": 600,
+                "data": { "username": username, "password": "super-secret" }
+            })))
+            .mount(server)
+            .await;
+    }
+
+    fn make_lease_addr(port: u16) -> Address {
+        Address {
+            port,
+            ..make_addr(Some("database/creds/pgdog-role"))
+        }
+    }
+
+    #[tokio::test]
+    async fn test_refresh_renews_lease() {
+        setup();
+        let server = MockServer::start().await;
+        mock_dynamic_role(&server, "database/creds/pgdog-role/abc", "v-pgdog-abc").await;
+
+        Mock::given(method("PUT"))
+            .and(path("/v1/sys/leases/renew"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(json!({
+                "lease_id": "database/creds/pgdog-role/abc",
+                "renewable": true,
+                "lease_duration": 600
+            })))
+            .mount(&server)
+            .await;
+
+        let _guard = crate::test_utils::set_env_var("VAULT_SECRET_ID", "my-secret");
+        *VAULT_TOKEN.lock() = None;
+        set_vault_config(approle_vault(&server.uri()));
+
+        let addr = make_lease_addr(6001);
+        credentials(addr.clone()).await.unwrap();
+
+        let refresh = refresh(addr).await.unwrap();
+        assert!(
+            matches!(refresh, Refresh::Renewed { .. }),
+            "expected renewal, got {refresh:?}"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_refresh_rotates_near_max_ttl() {
+        setup();
+        let server = MockServer::start().await;
+        mock_dynamic_role(&server, "database/creds/pgdog-role/def", "v-pgdog-def").await;
+
+        // Vault caps the extension at the lease's max TTL.
+        Mock::given(method("PUT"))
+            .and(path("/v1/sys/leases/renew"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(json!({
+                "lease_id": "database/creds/pgdog-role/def",
+                "renewable": true,
+                "lease_duration": 30
+            })))
+            .mount(&server)
+            .await;
+
+        let _guard = crate::test_utils::set_env_var("VAULT_SECRET_ID", "my-secret");
+        *VAULT_TOKEN.lock() = None;
+        set_vault_config(approle_vault(&server.uri()));
+
+        let addr = make_lease_addr(6002);
+        credentials(addr.clone()).await.unwrap();
+
+        match refresh(addr).await.unwrap() {
+            Refresh::Rotated(fetched) => {
+                assert_eq!(fetched.credentials.username.as_deref(), Some("v-pgdog-def"));
+            }
+            other => panic!("expected rotation, got {other:?}"),
+        }
+    }
+
+    #[tokio::test]
+    async fn test_refresh_rotates_when_renewal_fails() {
+        setup();
+        let server = MockServer::start().await;
+        mock_dynamic_role(&server, "database/creds/pgdog-role/ghi", "v-pgdog-ghi").await;
+
+        Mock::given(method("PUT"))
+            .and(path("/v1/sys/leases/renew"))
+            .respond_with(ResponseTemplate::new(400).set_body_string("lease not found"))
+            .mount(&server)
+            .await;
+
+        let _guard = crate::test_utils::set_env_var("VAULT_SECRET_ID", "my-secret");
+        *VAULT_TOKEN.lock() = None;
+        set_vault_config(approle_vault(&server.uri()));
+
+        let addr = make_lease_addr(6003);
+        credentials(addr.clone()).await.unwrap();
+
+        assert!(matches!(refresh(addr).await.unwrap(), Refresh::Rotated(_)));
+    }
+
     // ── static_backend_credentials(): config-level error cases ────────────────
 
     #[tokio::test]
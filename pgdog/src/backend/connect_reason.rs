@@ -9,6 +9,7 @@ pub enum ConnectReason {
     PubSub,
     Probe,
     Healthcheck,
+    Prewarm,
     #[default]
     Other,
 }
@@ -23,6 +24,7 @@ impl Display for ConnectReason {
             Self::PubSub => "pub/sub",
             Self::Probe => "probe",
             Self::Healthcheck => "healthcheck",
+            Self::Prewarm => "prewarm",
             Self::Other => "other",
         };
 
@@ -5,14 +5,14 @@ use std::ops::Deref;
 use std::sync::Arc;
 
 use arc_swap::ArcSwap;
-use futures::future::try_join_all;
+use futures::future::{join_all, try_join_all};
 use indexmap::IndexMap;
 use once_cell::sync::Lazy;
 use parking_lot::lock_api::MutexGuard;
 use parking_lot::{Mutex, RawMutex};
 use pgdog_config::users::PasswordKind;
 use pgdog_config::{
-    QueryParser, ShardedMappingConfig, ShardedMappingKey, ShardedMappingKeyRef,
+    FlexibleType, QueryParser, ShardedMappingConfig, ShardedMappingKey, ShardedMappingKeyRef,
     ShardedMappingKindDeprecated, ShardedMappingList, ShardedMappingRange, ShardedTableConfig,
 };
 use tracing::{debug, error, info, warn};
@@ -23,17 +23,18 @@ use crate::config::PoolerMode;
 use crate::frontend::PreparedStatements;
 use crate::frontend::client::query_engine::two_pc::Manager;
 use crate::frontend::router::parser::Cache;
-use crate::frontend::router::sharding::{Mapping, ShardedTable};
+use crate::frontend::router::sharding::{Mapping, ShardedTable, relationships};
 use crate::{
     backend::pool::PoolConfig,
     config::{
         ConfigAndUsers, Role, ShardedMappingDeprecated, User as ConfigUser, config, load, set,
     },
     net::{messages::FrontendPid, tls},
+    random,
 };
 
 use super::{
-    Cluster, ClusterShardConfig, Error, ShardedTables,
+    Cluster, ClusterShardConfig, Error, ShardedTables, ShardingSchema, maintenance_window,
     pool::{Address, ClusterConfig, Config},
     reload_notify,
     replication::ReplicationConfig,
@@ -70,6 +71,8 @@ pub fn replace_databases(new_databases: Databases, reload: bool) -> Result<(), E
     if reload {
         // Move whatever connections we can over to new pools.
         old_databases.move_conns_to(&new_databases)?;
+        // Re-create the idle connections we couldn't move in the background.
+        new_databases.prewarm_from(&old_databases);
     }
     // 3. Launch new databases first.
     new_databases.launch();
@@ -106,6 +109,9 @@ pub fn init() -> Result<(), Error> {
     // Resize query cache
     Cache::resize(config.config.general.query_cache_limit);
 
+    // (Re)start the routing random number sequence.
+    random::seed(config.config.general.routing_seed);
+
     // Start two-pc manager.
     let _monitor = Manager::get();
 
@@ -154,6 +160,9 @@ pub fn reload() -> Result<(), Error> {
     // Resize query cache.
     Cache::resize(new_config.config.general.query_cache_limit);
 
+    // (Re)start the routing random number sequence.
+    random::seed(new_config.config.general.routing_seed);
+
     Ok(())
 }
 
@@ -213,13 +222,38 @@ pub(crate) fn add(user: ConfigUser) -> Result<AuthResult, Error> {
     }
 }
 
+/// Add or update a user found with `auth_query` or in `auth_file`.
+///
+/// Pools are only reloaded if the user is new or its password changed.
+pub(crate) fn add_looked_up(user: ConfigUser) -> Result<(), Error> {
+    {
+        let _lock = lock();
+        let mut config = (*config()).clone();
+
+        if let Some(existing) = config.users.find(&user)
+            && existing.password == user.password
+            && existing.password_hash == user.password_hash
+        {
+            return Ok(());
+        }
+
+        debug!(
+            r#"adding looked up user "{}" to database "{}""#,
+            user.name, user.database
+        );
+
+        config.users.add_or_replace(user);
+        set(config)?;
+    }
+
+    reload_from_existing()
+}
+
 /// Swap database configs between source and destination.
 /// Both databases keep their names, but their configs (host, port, etc.) are exchanged.
 /// User database references are also swapped.
 /// Persists changes to disk (best effort).
 pub async fn cutover(source: &str, destination: &str) -> Result<(), Error> {
-    use tokio::fs::{copy, write};
-
     let config = {
         let _lock = lock();
 
@@ -232,48 +266,112 @@ pub async fn cutover(source: &str, destination: &str) -> Result<(), Error> {
 
         replace_databases(databases, true)?;
 
+        // Parent rows live on other hosts now.
+        relationships::forget(source);
+        relationships::forget(destination);
+
         config
     };
 
     info!(r#"databases swapped: "{}" <-> "{}""#, source, destination);
 
     if config.config.general.cutover_save_config {
-        if let Err(err) = copy(
-            &config.config_path,
-            config.config_path.clone().with_extension("bak.toml"),
-        )
-        .await
-        {
-            warn!(
-                "{} is read-only, skipping config persistence (err: {})",
-                config
-                    .config_path
-                    .parent()
-                    .map(|path| path.to_owned())
-                    .unwrap_or_default()
-                    .display(),
-                err
-            );
-            return Ok(());
-        }
+        save_config(&config).await?;
+    }
+
+    Ok(())
+}
+
+/// Back up the config files as `pgdog.bak.toml` and `users.bak.toml`
+/// and write the new config to disk. Returns `false` if the config
+/// directory is read-only.
+async fn save_config(config: &ConfigAndUsers) -> Result<bool, Error> {
+    use tokio::fs::{copy, write};
+
+    if let Err(err) = copy(
+        &config.config_path,
+        config.config_path.clone().with_extension("bak.toml"),
+    )
+    .await
+    {
+        warn!(
+            "{} is read-only, skipping config persistence (err: {})",
+            config
+                .config_path
+                .parent()
+                .map(|path| path.to_owned())
+                .unwrap_or_default()
+                .display(),
+            err
+        );
+        return Ok(false);
+    }
+
+    copy(
+        &config.users_path,
+        &config.users_path.clone().with_extension("bak.toml"),
+    )
+    .await?;
+
+    write(
+        &config.config_path,
+        toml::to_string_pretty(&config.config)?.as_bytes(),
+    )
+    .await?;
+
+    write(
+        &config.users_path,
+        toml::to_string_pretty(&config.users)?.as_bytes(),
+    )
+    .await?;
+
+    Ok(true)
+}
+
+/// Point a range rule to another shard, used by `RESHARD MOVE` once
+/// the rows are on the new shard. Connections and pause state are kept.
+///
+/// The config is saved to disk, so a reload or restart doesn't
+/// route the range back to the shard it was deleted from.
+pub async fn move_range(
+    database: &str,
+    column: &str,
+    start: &FlexibleType,
+    end: &FlexibleType,
+    shard: usize,
+) -> Result<(), Error> {
+    let config = {
+        let _lock = lock();
+
+        let mut config = config().deref().clone();
+        config
+            .config
+            .move_range(database, column, start, end, shard);
+        let config = set(config)?;
+
+        replace_databases(from_config(&config), true)?;
+
+        // Parent rows in the range moved to another shard.
+        relationships::forget(database);
+
+        config
+    };
+
+    info!(
+        r#"range [{}, {}) of "{}" in database "{}" moved to shard {}"#,
+        start, end, column, database, shard
+    );
 
-        copy(
-            &config.users_path,
-            &config.users_path.clone().with_extension("bak.toml"),
-        )
-        .await?;
-
-        write(
-            &config.config_path,
-            toml::to_string_pretty(&config.config)?.as_bytes(),
-        )
-        .await?;
-
-        write(
-            &config.users_path,
-            toml::to_string_pretty(&config.users)?.as_bytes(),
-        )
-        .await?;
+    if !save_config(&config).await? {
+        error!(
+            r#"range [{}, {}) of "{}" in database "{}" moved to shard {} but not saved, update {} by hand"#,
+            start,
+            end,
+            column,
+            database,
+            shard,
+            config.config_path.display()
+        );
     }
 
     Ok(())
@@ -405,6 +503,14 @@ impl Databases {
         None
     }
 
+    /// Get the sharding configuration for the database.
+    pub fn sharding_schema(&self, database: &str) -> Option<ShardingSchema> {
+        self.databases
+            .iter()
+            .find(|(user, _)| user.database == database)
+            .map(|(_, cluster)| cluster.sharding_schema())
+    }
+
     /// Get all clusters and databases.
     pub fn all(&self) -> &HashMap<User, Cluster> {
         &self.databases
@@ -412,11 +518,10 @@ impl Databases {
 
     /// Cancel a query running on one of the databases proxied by the pooler.
     pub async fn cancel(&self, id: FrontendPid) -> Result<(), Error> {
-        for cluster in self.databases.values() {
-            cluster.cancel(id).await?;
-        }
-
-        Ok(())
+        join_all(self.databases.values().map(|cluster| cluster.cancel(id)))
+            .await
+            .into_iter()
+            .collect()
     }
 
     /// Move all connections we can from old databases config to new
@@ -437,6 +542,39 @@ impl Databases {
         Ok(moved)
     }
 
+    /// Open as many connections in each pool as the matching pool in the
+    /// previous configuration had idle, so clients don't pay for
+    /// connecting to Postgres after a reload.
+    fn prewarm_from(&self, previous: &Databases) {
+        for (user, cluster) in &self.databases {
+            let Some(previous) = previous.databases.get(user) else {
+                continue;
+            };
+
+            for (shard, previous_shard) in cluster.shards().iter().zip(previous.shards()) {
+                let previous_pools = previous_shard.pools_with_classes();
+
+                for (class, _, _, pool) in shard.pools_with_classes() {
+                    let addr = pool.addr();
+                    let idle = previous_pools
+                        .iter()
+                        .find(|(previous_class, _, _, previous)| {
+                            let previous = previous.addr();
+                            *previous_class == class
+                                && previous.host == addr.host
+                                && previous.port == addr.port
+                                && previous.database_name == addr.database_name
+                                && previous.user == addr.user
+                        })
+                        .map(|(_, _, _, previous)| previous.state().idle)
+                        .unwrap_or_default();
+
+                    pool.prewarm(idle);
+                }
+            }
+        }
+    }
+
     /// Shutdown all pools.
     fn shutdown(&self) {
         for cluster in self.all().values() {
@@ -498,7 +636,9 @@ fn resolve_sharded_table(
     let mapping = mapping.map(|configs| {
         let tname = config.name.as_deref().unwrap_or("*");
         let column = &config.column;
-        for error in crate::backend::validation::validate(&configs, config.data_type, num_shards) {
+        for error in
+            crate::backend::validation::validate(&configs, config.mapping_data_type(), num_shards)
+        {
             warn!("sharded table name=\"{tname}\", column=\"{column}\": {error}");
         }
         Mapping::new(configs)
@@ -514,6 +654,7 @@ fn resolve_sharded_table(
         data_type: config.data_type,
         centroid_probes: config.centroid_probes,
         hasher: config.hasher.clone(),
+        uuid_timestamp: config.uuid_timestamp,
         mapping: mapping.flatten(),
     }
 }
@@ -561,6 +702,7 @@ fn new_pool(user: &crate::config::User, config: &crate::config::Config) -> Optio
     let databases = config.databases();
 
     let shards = databases.get(&user.database).cloned()?;
+    let pool_size = maintenance_window::pool_size(&user.database);
 
     let mut shard_configs = vec![];
     for user_databases in shards {
@@ -570,18 +712,47 @@ fn new_pool(user: &crate::config::User, config: &crate::config::Config) -> Optio
             .find(|d| d.role == Role::Primary)
             .map(|primary| PoolConfig {
                 address: Address::new(primary, user, primary.number),
-                config: Config::new(general, primary, user, has_single_replica),
+                config: Config::new(general, primary, user, has_single_replica)
+                    .limit_pool_size(pool_size),
             });
         let replicas = user_databases
             .iter()
             .filter(|d| matches!(d.role, Role::Replica | Role::Auto)) // Auto role is assumed read-only until proven otherwise.
             .map(|replica| PoolConfig {
                 address: Address::new(replica, user, replica.number),
-                config: Config::new(general, replica, user, has_single_replica),
+                config: Config::new(general, replica, user, has_single_replica)
+                    .limit_pool_size(pool_size),
+            })
+            .collect::<Vec<_>>();
+
+        let slow_primary = primary.as_ref().and_then(|primary| {
+            user_databases
+                .iter()
+                .find(|d| d.role == Role::Primary)
+                .and_then(|database| primary.config.slow(database))
+                .map(|config| PoolConfig {
+                    address: primary.address.clone(),
+                    config,
+                })
+        });
+        let slow_replicas = user_databases
+            .iter()
+            .filter(|d| matches!(d.role, Role::Replica | Role::Auto))
+            .zip(replicas.iter())
+            .filter_map(|(database, replica)| {
+                replica.config.slow(database).map(|config| PoolConfig {
+                    address: replica.address.clone(),
+                    config,
+                })
             })
             .collect::<Vec<_>>();
 
-        shard_configs.push(ClusterShardConfig { primary, replicas });
+        shard_configs.push(ClusterShardConfig {
+            primary,
+            replicas,
+            slow_primary,
+            slow_replicas,
+        });
     }
 
     let sharded_tables: Vec<_> = config
@@ -605,7 +776,7 @@ fn new_pool(user: &crate::config::User, config: &crate::config::Config) -> Optio
         general.omnisharded_sticky,
         general.system_catalogs,
     );
-    let sharded_schemas = ShardedSchemas::new(sharded_schemas);
+    let sharded_schemas = ShardedSchemas::new(sharded_schemas, shard_configs.len());
     let query_parser = config
         .query_parsers
         .iter()
@@ -679,6 +850,18 @@ pub fn from_config(config: &ConfigAndUsers) -> Databases {
         }
     }
 
+    // The user's client limit applies to all of its databases.
+    let mut user_limits = HashMap::<String, usize>::new();
+    for user in &config.users.users {
+        if let Some(limit) = user.max_user_client_connections {
+            let entry = user_limits.entry(user.name.clone()).or_insert(limit);
+            *entry = (*entry).min(limit);
+        }
+    }
+    for (user, cluster) in &mut databases {
+        cluster.set_max_user_client_connections(user_limits.get(&user.user).copied());
+    }
+
     // Duplicate schema owner check.
     let mut dupl_schema_owners = HashMap::<String, usize>::new();
     for (user, cluster) in &mut databases {
@@ -1835,6 +2018,66 @@ mod tests {
         assert_eq!(databases.all().len(), 6);
     }
 
+    #[test]
+    fn test_max_user_client_connections_shared_by_databases() {
+        let config = Config {
+            databases: ["db1", "db2", "db3"]
+                .into_iter()
+                .map(|name| Database {
+                    name: name.to_string(),
+                    host: "localhost".to_string(),
+                    role: Role::Primary,
+                    ..Default::default()
+                })
+                .collect(),
+            ..Default::default()
+        };
+
+        let users = crate::config::Users {
+            users: vec![
+                crate::config::User {
+                    name: "tenant".to_string(),
+                    databases: vec!["db1".to_string(), "db2".to_string()],
+                    password: Some("pass".to_string()),
+                    max_user_client_connections: Some(10),
+                    ..Default::default()
+                },
+                crate::config::User {
+                    name: "tenant".to_string(),
+                    database: "db3".to_string(),
+                    password: Some("pass".to_string()),
+                    max_client_connections: Some(3),
+                    max_user_client_connections: Some(5),
+                    ..Default::default()
+                },
+                crate::config::User {
+                    name: "other".to_string(),
+                    database: "db1".to_string(),
+                    password: Some("pass".to_string()),
+                    ..Default::default()
+                },
+            ],
+            ..Default::default()
+        };
+
+        let databases = from_config(&ConfigAndUsers {
+            config,
+            users,
+            ..Default::default()
+        });
+
+        // The lowest limit applies to all of the user's databases.
+        for database in ["db1", "db2", "db3"] {
+            let cluster = databases.cluster(("tenant", database)).unwrap();
+            assert_eq!(cluster.max_user_client_connections(), Some(5));
+        }
+        let cluster = databases.cluster(("tenant", "db3")).unwrap();
+        assert_eq!(cluster.max_client_connections(), Some(3));
+
+        let cluster = databases.cluster(("other", "db1")).unwrap();
+        assert_eq!(cluster.max_user_client_connections(), None);
+    }
+
     #[test]
     fn test_databases_list_with_nonexistent_database_skipped() {
         let config = Config {
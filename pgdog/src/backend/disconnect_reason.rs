@@ -14,6 +14,8 @@ pub enum DisconnectReason {
     Healthcheck,
     PubSub,
     CredentialsRefresh,
+    Autoscale,
+    Killed,
     #[default]
     Other,
 }
@@ -34,6 +36,8 @@ impl Display for DisconnectReason {
             Self::Healthcheck => "standalone healthcheck",
             Self::PubSub => "pub/sub",
             Self::CredentialsRefresh => "credentials refresh",
+            Self::Autoscale => "pool shrank",
+            Self::Killed => "killed by admin",
         };
 
         write!(f, "{}", reason)
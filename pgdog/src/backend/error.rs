@@ -117,6 +117,9 @@ pub enum Error {
     #[error("Azure Workload Identity token generation failed: {0}")]
     AzureWorkloadIdentityToken(String),
 
+    #[error("GCP IAM token generation failed: {0}")]
+    GcpIamToken(String),
+
     #[error("Vault credentials fetch failed: {0}")]
     VaultCredentials(String),
 
@@ -143,6 +146,9 @@ pub enum Error {
 
     #[error("cannot ignore response for message type: {0}")]
     UnsupportedHandleIgnore(char),
+
+    #[error("{0}")]
+    Sharding(#[from] crate::frontend::router::sharding::Error),
 }
 
 impl From<crate::frontend::Error> for Error {
@@ -160,6 +166,7 @@ impl Error {
             Error::Pool(PoolError::CheckoutTimeout) => true,
             Error::Pool(PoolError::AllReplicasDown) => true,
             Error::Pool(PoolError::Banned) => true,
+            Error::Pool(PoolError::TooManyWaiting(_)) => true,
             _ => false,
         }
     }
@@ -0,0 +1,215 @@
+//! Scheduled maintenance windows.
+//!
+//! While a window is active, pools of its database are capped at a lower
+//! `pool_size` and pools of the configured users are paused, giving the
+//! database headroom for maintenance like `VACUUM FULL` or index builds.
+//! Everything is restored when the window ends.
+//!
+use std::collections::HashSet;
+use std::sync::Arc;
+use std::time::Duration;
+
+use arc_swap::ArcSwap;
+use chrono::{DateTime, Datelike, DurationRound, TimeDelta, Timelike, Utc};
+use once_cell::sync::Lazy;
+use pgdog_config::MaintenanceWindow;
+use tokio::time::sleep;
+use tracing::{error, info, warn};
+
+use super::databases::{databases, reload_from_existing};
+use crate::config::config;
+
+/// Longest window we look back for, in milliseconds (one week).
+const MAX_DURATION: u64 = 7 * 24 * 60 * 60 * 1000;
+
+/// Windows that are currently active.
+static ACTIVE: Lazy<ArcSwap<Vec<MaintenanceWindow>>> = Lazy::new(|| ArcSwap::from_pointee(vec![]));
+
+/// Pool size limit for the database, if it's in an active maintenance window.
+pub(crate) fn pool_size(database: &str) -> Option<usize> {
+    ACTIVE
+        .load()
+        .iter()
+        .filter(|window| window.database == database)
+        .filter_map(|window| window.pool_size)
+        .min()
+}
+
+/// Start checking maintenance windows every minute.
+pub fn start() {
+    crate::tasks::spawn("maintenance windows", async move {
+        let shutdown = crate::tasks::shutdown_signal();
+        // Pools we paused, so we only resume those.
+        let mut paused = HashSet::new();
+
+        loop {
+            if let Err(err) = run(Utc::now(), &mut paused) {
+                error!("maintenance window error: {}", err);
+            }
+
+            tokio::select! {
+                _ = sleep(until_next_minute(Utc::now())) => {}
+                _ = shutdown.cancelled() => break,
+            }
+        }
+    });
+}
+
+/// Activate and deactivate maintenance windows.
+fn run(now: DateTime<Utc>, paused: &mut HashSet<(String, String)>) -> Result<(), super::Error> {
+    let config = config();
+    let active = active(&config.config.maintenance_windows, now);
+
+    if active != **ACTIVE.load() {
+        for window in ACTIVE.load().iter().filter(|w| !active.contains(w)) {
+            info!(
+                r#"maintenance window "{}" for database "{}" ended"#,
+                window.schedule, window.database
+            );
+        }
+
+        for window in active.iter().filter(|w| !ACTIVE.load().contains(w)) {
+            warn!(
+                r#"maintenance window "{}" for database "{}" started"#,
+                window.schedule, window.database
+            );
+        }
+
+        ACTIVE.store(Arc::new(active));
+
+        // Pool sizes are applied when pools are created.
+        reload_from_existing()?;
+    }
+
+    let should_pause = ACTIVE
+        .load()
+        .iter()
+        .flat_map(|window| {
+            window
+                .paused_users
+                .iter()
+                .map(|user| (user.clone(), window.database.clone()))
+        })
+        .collect::<HashSet<_>>();
+
+    // Pause state survives reloads, so only changes need to be applied.
+    for (user, cluster) in databases().all() {
+        let key = (user.user.clone(), user.database.clone());
+        let pause = should_pause.contains(&key);
+
+        if pause == paused.contains(&key) {
+            continue;
+        }
+
+        for shard in cluster.shards() {
+            for pool in shard.pools() {
+                if pause {
+                    pool.pause();
+                } else {
+                    pool.resume();
+                }
+            }
+        }
+
+        if pause {
+            paused.insert(key);
+        } else {
+            paused.remove(&key);
+        }
+    }
+
+    Ok(())
+}
+
+/// Windows that started less than `duration` ago.
+fn active(windows: &[MaintenanceWindow], now: DateTime<Utc>) -> Vec<MaintenanceWindow> {
+    let Ok(minute) = now.duration_trunc(TimeDelta::minutes(1)) else {
+        return vec![];
+    };
+
+    windows
+        .iter()
+        .filter(|window| {
+            let duration = TimeDelta::milliseconds(window.duration.min(MAX_DURATION) as i64);
+            let mut start = minute;
+
+            while now - start < duration {
+                if window.schedule.matches(
+                    start.minute(),
+                    start.hour(),
+                    start.day(),
+                    start.month(),
+                    start.weekday().num_days_from_sunday(),
+                ) {
+                    return true;
+                }
+                start -= TimeDelta::minutes(1);
+            }
+
+            false
+        })
+        .cloned()
+        .collect()
+}
+
+/// How long to wait until the start of the next minute.
+fn until_next_minute(now: DateTime<Utc>) -> Duration {
+    let elapsed = Duration::from_secs(now.second() as u64)
+        + Duration::from_nanos(now.nanosecond() as u64 % 1_000_000_000);
+    Duration::from_secs(60).saturating_sub(elapsed)
+}
+
+#[cfg(test)]
+mod test {
+    use chrono::TimeZone;
+
+    use super::*;
+
+    fn window(schedule: &str, duration: u64) -> MaintenanceWindow {
+        MaintenanceWindow {
+            database: "pgdog".into(),
+            schedule: schedule.parse().unwrap(),
+            duration,
+            pool_size: Some(2),
+            paused_users: vec![],
+        }
+    }
+
+    #[test]
+    fn test_active() {
+        // Every day at 3 AM, for one hour.
+        let windows = vec![window("0 3 * * *", 3_600_000)];
+
+        let at = |hour, minute, second| {
+            Utc.with_ymd_and_hms(2024, 5, 12, hour, minute, second)
+                .unwrap()
+        };
+
+        assert!(active(&windows, at(2, 59, 59)).is_empty());
+        assert_eq!(active(&windows, at(3, 0, 0)).len(), 1);
+        assert_eq!(active(&windows, at(3, 30, 15)).len(), 1);
+        assert_eq!(active(&windows, at(3, 59, 59)).len(), 1);
+        assert!(active(&windows, at(4, 0, 0)).is_empty());
+    }
+
+    #[test]
+    fn test_active_across_days() {
+        // Saturdays at 11 PM, for two hours.
+        let windows = vec![window("0 23 * * 6", 7_200_000)];
+
+        // 2024-05-11 is a Saturday.
+        let saturday = Utc.with_ymd_and_hms(2024, 5, 11, 23, 10, 0).unwrap();
+        let sunday = Utc.with_ymd_and_hms(2024, 5, 12, 0, 30, 0).unwrap();
+        let later = Utc.with_ymd_and_hms(2024, 5, 12, 1, 0, 0).unwrap();
+
+        assert_eq!(active(&windows, saturday).len(), 1);
+        assert_eq!(active(&windows, sunday).len(), 1);
+        assert!(active(&windows, later).is_empty());
+    }
+
+    #[test]
+    fn test_until_next_minute() {
+        let now = Utc.with_ymd_and_hms(2024, 5, 12, 3, 0, 45).unwrap();
+        assert_eq!(until_next_minute(now), Duration::from_secs(15));
+    }
+}
@@ -6,17 +6,24 @@ pub mod databases;
 pub mod disconnect_reason;
 pub mod error;
 pub mod maintenance_mode;
+pub mod maintenance_window;
 pub mod pool;
 pub mod prepared_statements;
 pub mod protocol;
 pub mod pub_sub;
 pub mod reload_notify;
 pub mod replication;
+pub mod rolling_ranges;
 pub mod schema;
+pub mod sequence_cache;
 pub mod server;
 pub mod server_options;
+pub mod server_version;
+pub mod shard_directory;
+pub mod shard_kill_switch;
 pub mod stats;
 pub mod validation;
+pub mod zone;
 
 pub use connect_reason::ConnectReason;
 pub use disconnect_reason::DisconnectReason;
@@ -29,4 +36,5 @@ pub use replication::ShardedTables;
 pub use schema::Schema;
 pub use server::Server;
 pub use server_options::ServerOptions;
+pub use server_version::ServerVersion;
 pub use stats::Stats;
@@ -1,6 +1,7 @@
 //! Server address.
 use std::net::{SocketAddr, ToSocketAddrs};
 use std::ops::Deref;
+use std::path::PathBuf;
 
 use pgdog_config::Role;
 use pgdog_config::users::PasswordKind;
@@ -9,7 +10,7 @@ use url::Url;
 
 use super::{Password, password::PasswordSource};
 use crate::backend::Error;
-use crate::backend::auth::{azure_workload_identity, rds_iam, vault};
+use crate::backend::auth::{azure_workload_identity, gcp_iam, rds_iam, vault};
 use crate::backend::pool::dns_cache::DnsCache;
 use crate::backend::pool::token_cache::TokenCache;
 use crate::config::{Database, ServerAuth, User, config};
@@ -43,6 +44,12 @@ pub struct Address {
     /// Role given to the database at configuration time.
     /// For automatic roles, this can change at runtime.
     pub configured_role: Role,
+    /// Role set with `SET ROLE` on server connections.
+    #[serde(default)]
+    pub server_role: Option<String>,
+    /// Availability zone of the server.
+    #[serde(default)]
+    pub zone: Option<String>,
 }
 
 impl From<Address> for pgdog_stats::Address {
@@ -99,6 +106,8 @@ impl Address {
             vault_refresh_percent: user.vault_refresh_percent,
             database_number,
             configured_role: database.role,
+            server_role: user.server_role.clone(),
+            zone: database.zone.clone(),
         }
     }
 
@@ -137,6 +146,13 @@ impl Address {
                 vec![Password::new(&token, PasswordSource::AzureIdentity)]
             }
 
+            ServerAuth::GcpIam => {
+                let token = TokenCache::global()
+                    .get_or_fetch(self, gcp_iam::token)
+                    .await?;
+                vec![Password::new(&token, PasswordSource::GcpIam)]
+            }
+
             ServerAuth::VaultDynamic => {
                 let credentials = TokenCache::global()
                     .credentials_or_fetch(self, vault::credentials)
@@ -182,6 +198,17 @@ impl Address {
             .ok_or(Error::DnsResolutionFailed(self.host.clone()))
     }
 
+    /// The host is a directory containing the Postgres UNIX socket,
+    /// e.g. `/var/run/postgresql`, same as libpq.
+    pub fn is_unix_socket(&self) -> bool {
+        self.host.starts_with('/')
+    }
+
+    /// Path to the Postgres UNIX socket, e.g. `/var/run/postgresql/.s.PGSQL.5432`.
+    pub(crate) fn unix_socket_path(&self) -> PathBuf {
+        PathBuf::from(&self.host).join(format!(".s.PGSQL.{}", self.port))
+    }
+
     /// A replacement for [`PartialEq`] which accounts for
     /// differences that do not require us to close connections to Postgres
     /// when reloading the config.
@@ -213,6 +240,8 @@ impl Address {
             vault_refresh_percent: None,
             database_number: 0,
             configured_role: Role::Primary,
+            server_role: None,
+            zone: None,
         }
     }
 }
@@ -297,6 +326,19 @@ mod test {
         assert_eq!(address.passwords.first().unwrap(), "hunter3");
     }
 
+    #[test]
+    fn test_unix_socket() {
+        let mut addr = Address::new_test();
+        assert!(!addr.is_unix_socket());
+
+        addr.host = "/var/run/postgresql".into();
+        assert!(addr.is_unix_socket());
+        assert_eq!(
+            addr.unix_socket_path(),
+            PathBuf::from("/var/run/postgresql/.s.PGSQL.5432")
+        );
+    }
+
     #[test]
     fn test_rds_iam_does_not_use_static_password() {
         let database = Database {
@@ -354,6 +396,36 @@ mod test {
         assert_eq!(address.server_auth, ServerAuth::AzureWorkloadIdentity);
     }
 
+    #[test]
+    fn test_server_user_and_role() {
+        let database = Database {
+            name: "pgdog".into(),
+            host: "127.0.0.1".into(),
+            port: 6432,
+            ..Default::default()
+        };
+
+        let user = User {
+            name: "service_a".into(),
+            password: Some("user-pass".into()),
+            server_user: Some("app_rw".into()),
+            server_password: Some("server-pass".into()),
+            server_role: Some("service_a".into()),
+            database: "pgdog".into(),
+            ..Default::default()
+        };
+
+        let address = Address::new(&database, &user, 0);
+        assert_eq!(address.user, "app_rw");
+        assert_eq!(address.passwords.first().unwrap(), "server-pass");
+        assert_eq!(address.server_role.as_deref(), Some("service_a"));
+
+        // Connections can't be moved between pools with different roles.
+        let mut other = address.clone();
+        other.server_role = None;
+        assert!(!address.compatible(&other));
+    }
+
     // ── TryFrom<Url> ─────────────────────────────────────────────────────────
 
     #[test]
@@ -0,0 +1,275 @@
+//! Pool autoscaling.
+//!
+//! Every `stats_period`, we look at how long clients waited for a connection
+//! and how many connections were actually in use, and resize the pool between
+//! `pool_size` and `autoscale_max_pool_size`. The pool grows quickly when clients
+//! are waiting and shrinks slowly when connections are mostly idle.
+
+use std::{
+    fmt::Display,
+    time::{Duration, SystemTime},
+};
+
+/// Why the pool was resized.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum ScalingReason {
+    /// Clients waited too long for a connection.
+    WaitTime { p95: Duration, target: Duration },
+    /// All connections are in use and clients are waiting.
+    Saturated { waiting: usize },
+    /// Most connections are unused.
+    Underused { busy: f64 },
+}
+
+/// Pool was resized by the autoscaler.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct ScalingEvent {
+    /// Pool size before.
+    pub from: usize,
+    /// Pool size after.
+    pub to: usize,
+    /// Why it was resized.
+    pub reason: ScalingReason,
+    /// When it was resized.
+    pub at: SystemTime,
+}
+
+impl Display for ScalingEvent {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let direction = if self.to > self.from {
+            "grew"
+        } else {
+            "shrank"
+        };
+        write!(f, "{} from {} to {}, ", direction, self.from, self.to)?;
+
+        match self.reason {
+            ScalingReason::WaitTime { p95, target } => write!(
+                f,
+                "p95 wait {:.3}ms above {:.3}ms target",
+                p95.as_secs_f64() * 1000.0,
+                target.as_secs_f64() * 1000.0
+            ),
+            ScalingReason::Saturated { waiting } => {
+                write!(f, "all connections in use, {} clients waiting", waiting)
+            }
+            ScalingReason::Underused { busy } => {
+                write!(f, "{:.1} of {} connections in use", busy, self.from)
+            }
+        }
+    }
+}
+
+/// Pool measurements taken every `stats_period`.
+#[derive(Debug, Clone, Copy, Default)]
+pub(super) struct Sample {
+    /// Current pool size.
+    pub(super) size: usize,
+    /// 95th percentile of checkout wait time during the period.
+    pub(super) wait_p95: Duration,
+    /// Connections checked out right now.
+    pub(super) checked_out: usize,
+    /// Clients waiting right now.
+    pub(super) waiting: usize,
+    /// Total time connections spent in transactions, since the pool started.
+    pub(super) xact_time: Duration,
+}
+
+/// Pool autoscaler state.
+#[derive(Debug, Clone, Default)]
+pub struct Autoscaler {
+    xact_time: Duration,
+    events: usize,
+    last: Option<ScalingEvent>,
+}
+
+impl Autoscaler {
+    /// Number of times the pool was resized.
+    pub fn events(&self) -> usize {
+        self.events
+    }
+
+    /// The last time the pool was resized.
+    pub fn last(&self) -> Option<ScalingEvent> {
+        self.last
+    }
+
+    /// Decide the size of the pool for the next period.
+    pub(super) fn evaluate(
+        &mut self,
+        sample: Sample,
+        bounds: (usize, usize),
+        target: Duration,
+        period: Duration,
+    ) -> Option<ScalingEvent> {
+        let (min, max) = bounds;
+        let size = sample.size;
+
+        // Average number of connections in a transaction during the period.
+        let xact_time = sample.xact_time.saturating_sub(self.xact_time);
+        self.xact_time = sample.xact_time;
+        let busy = if period.is_zero() {
+            0.0
+        } else {
+            xact_time.as_secs_f64() / period.as_secs_f64()
+        }
+        .max(sample.checked_out as f64);
+
+        let saturated = sample.waiting > 0 && sample.checked_out >= size;
+
+        let (to, reason) = if sample.wait_p95 > target && size < max {
+            let to = (size + (size / 4).max(1)).min(max);
+            (
+                to,
+                ScalingReason::WaitTime {
+                    p95: sample.wait_p95,
+                    target,
+                },
+            )
+        } else if saturated && size < max {
+            let to = (size + (size / 4).max(1)).min(max);
+            (
+                to,
+                ScalingReason::Saturated {
+                    waiting: sample.waiting,
+                },
+            )
+        } else if sample.waiting == 0 && busy < size as f64 / 2.0 && size > min {
+            let to = size.saturating_sub((size / 10).max(1)).max(min);
+            (to, ScalingReason::Underused { busy })
+        } else {
+            return None;
+        };
+
+        let event = ScalingEvent {
+            from: size,
+            to,
+            reason,
+            at: SystemTime::now(),
+        };
+
+        self.events += 1;
+        self.last = Some(event);
+
+        Some(event)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    const PERIOD: Duration = Duration::from_secs(15);
+    const TARGET: Duration = Duration::from_millis(10);
+
+    fn sample(size: usize) -> Sample {
+        Sample {
+            size,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_grows_on_wait_time() {
+        let mut autoscaler = Autoscaler::default();
+
+        let event = autoscaler
+            .evaluate(
+                Sample {
+                    wait_p95: Duration::from_millis(50),
+                    checked_out: 10,
+                    ..sample(10)
+                },
+                (10, 20),
+                TARGET,
+                PERIOD,
+            )
+            .unwrap();
+        assert_eq!((event.from, event.to), (10, 12));
+        assert_eq!(
+            event.to_string(),
+            "grew from 10 to 12, p95 wait 50.000ms above 10.000ms target"
+        );
+
+        // Never above the max.
+        let event = autoscaler
+            .evaluate(
+                Sample {
+                    waiting: 3,
+                    checked_out: 19,
+                    ..sample(19)
+                },
+                (10, 20),
+                TARGET,
+                PERIOD,
+            )
+            .unwrap();
+        assert_eq!(event.to, 20);
+        assert!(matches!(
+            event.reason,
+            ScalingReason::Saturated { waiting: 3 }
+        ));
+
+        assert!(
+            autoscaler
+                .evaluate(
+                    Sample {
+                        wait_p95: Duration::from_millis(50),
+                        checked_out: 20,
+                        ..sample(20)
+                    },
+                    (10, 20),
+                    TARGET,
+                    PERIOD,
+                )
+                .is_none()
+        );
+        assert_eq!(autoscaler.events(), 2);
+    }
+
+    #[test]
+    fn test_shrinks_when_underused() {
+        let mut autoscaler = Autoscaler::default();
+
+        // 30s in transactions over 15s: 2 connections busy on average.
+        let event = autoscaler
+            .evaluate(
+                Sample {
+                    xact_time: Duration::from_secs(30),
+                    ..sample(20)
+                },
+                (10, 20),
+                TARGET,
+                PERIOD,
+            )
+            .unwrap();
+        assert_eq!((event.from, event.to), (20, 18));
+        assert_eq!(
+            event.to_string(),
+            "shrank from 20 to 18, 2.0 of 20 connections in use"
+        );
+
+        // Busy: 150s over 15s is 10 connections out of 18.
+        assert!(
+            autoscaler
+                .evaluate(
+                    Sample {
+                        xact_time: Duration::from_secs(180),
+                        ..sample(18)
+                    },
+                    (10, 20),
+                    TARGET,
+                    PERIOD,
+                )
+                .is_none()
+        );
+
+        // Never below the min.
+        assert!(
+            autoscaler
+                .evaluate(sample(10), (10, 20), TARGET, PERIOD)
+                .is_none()
+        );
+        assert_eq!(autoscaler.last().unwrap().to, 18);
+    }
+}
@@ -14,8 +14,11 @@ static PREPARED: Lazy<Vec<Query>> = Lazy::new(|| vec![Query::new("DEALLOCATE ALL
 static DIRTY: Lazy<Vec<Query>> = Lazy::new(|| {
     vec![
         Query::new("RESET ALL"),                       // Reset all parameters.
+        Query::new("RESET SESSION AUTHORIZATION"),     // Not reset by RESET ALL.
+        Query::new("RESET ROLE"),                      // Not reset by RESET ALL.
         Query::new("SELECT pg_advisory_unlock_all()"), // Remove all advisory locks.
         Query::new("DISCARD TEMP"),                    // Drop all temporary tables.
+        Query::new("CLOSE ALL"),                       // Close WITH HOLD cursors.
     ]
 });
 
@@ -139,4 +142,9 @@ impl Cleanup {
     pub fn is_deallocate(&self) -> bool {
         self.deallocate
     }
+
+    /// The whole session state is discarded.
+    pub fn is_reset(&self) -> bool {
+        self.reset
+    }
 }
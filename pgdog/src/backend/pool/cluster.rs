@@ -1,14 +1,15 @@
 //! A collection of replicas and a primary.
 
-use futures::future::try_join_all;
+use futures::future::{join_all, try_join_all};
 use parking_lot::Mutex;
 use pgdog_config::{
-    LoadSchema, PreparedStatements, QueryParser, QueryParserEngine, QueryParserLevel, Rewrite,
-    RewriteMode, users::PasswordKind,
+    ClientProfile, LoadSchema, NoticeSeverity, PreparedStatements, Priority, QueryParser,
+    QueryParserEngine, QueryParserLevel, Rewrite, RewriteMode, users::PasswordKind,
 };
-use std::{sync::Arc, time::Duration};
+use std::{collections::HashSet, sync::Arc, time::Duration};
+use tracing::warn;
 
-use crate::frontend::router::sharding::ShardedTable;
+use crate::frontend::router::sharding::{self, ContextBuilder, Relationships, ShardedTable};
 use crate::{
     backend::{
         Schema, ShardedTables,
@@ -18,7 +19,10 @@ use crate::{
     config::{
         ConnectionRecovery, MultiTenant, PoolerMode, ReadWriteSplit, ReadWriteStrategy, User,
     },
-    frontend::{ClientRequest, RegexParser},
+    frontend::{
+        ClientRequest, RegexParser,
+        router::parser::{self, LazyFingerprint, PrimaryOnly, QueryRoutingRules, fingerprint},
+    },
     net::{Query, messages::FrontendPid},
 };
 
@@ -47,15 +51,27 @@ pub struct Cluster {
     pooler_mode: PoolerMode,
     sharded_tables: ShardedTables,
     sharded_schemas: ShardedSchemas,
+    relationships: Relationships,
     replication_sharding: Option<String>,
     multi_tenant: Option<MultiTenant>,
     rw_strategy: ReadWriteStrategy,
     rw_split: ReadWriteSplit,
+    catalog_reads_on_replicas: bool,
+    min_notice_severity: NoticeSeverity,
+    max_statement_timeout: Option<u64>,
+    serialization_retry_max_attempts: usize,
+    serialization_retry_min_delay: Duration,
     schema_admin: bool,
+    slow_pool: bool,
+    priority: Priority,
+    slow_queries: Arc<HashSet<String>>,
+    primary_only: Arc<PrimaryOnly>,
+    query_routing_rules: Arc<QueryRoutingRules>,
     stats: Arc<Mutex<MirrorStats>>,
     cross_shard_disabled: bool,
     two_phase_commit: bool,
     two_phase_commit_auto: bool,
+    two_phase_commit_ddl: bool,
     pub(super) readiness: Arc<Readiness>,
     rewrite: Rewrite,
     prepared_statements: PreparedStatements,
@@ -77,17 +93,25 @@ pub struct Cluster {
     resharding_replication_retry_min_delay: Duration,
     regex_parser: RegexParser,
     identity: Option<String>,
+    client_profile: ClientProfile,
+    max_client_connections: Option<usize>,
+    max_user_client_connections: Option<usize>,
+    replication: bool,
 }
 
 /// Sharding configuration from the cluster.
 #[derive(Debug, Clone, Default)]
 pub struct ShardingSchema {
+    /// Database name.
+    pub database: String,
     /// Number of shards.
     pub shards: usize,
     /// Sharded tables.
     pub tables: ShardedTables,
     /// Schemas.
     pub schemas: ShardedSchemas,
+    /// Child tables routed by their parent row.
+    pub relationships: Relationships,
     /// Rewrite config.
     pub rewrite: Rewrite,
     /// Query parser engine.
@@ -100,12 +124,56 @@ impl ShardingSchema {
     pub fn tables(&self) -> &ShardedTables {
         &self.tables
     }
+
+    /// Find the shard a sharding key belongs to. If the table is sharded
+    /// on more than one column, `column` picks which one to use.
+    ///
+    /// Entries without a table name shard every table with their column,
+    /// so they're used if the table isn't listed by name. Without `column`,
+    /// that's only possible if there is just one of them.
+    pub fn shard_of(
+        &self,
+        table: &str,
+        column: Option<&str>,
+        key: &str,
+    ) -> Result<parser::Shard, sharding::Error> {
+        let tables = self.tables.tables();
+        let matches_column =
+            |candidate: &&ShardedTable| column.is_none_or(|column| candidate.column == column);
+
+        let named = tables
+            .iter()
+            .filter(|candidate| candidate.name.as_deref() == Some(table))
+            .find(matches_column);
+
+        let sharded_table = match named {
+            Some(sharded_table) => sharded_table,
+            None => {
+                let mut unnamed = tables
+                    .iter()
+                    .filter(|candidate| candidate.name.is_none())
+                    .filter(matches_column);
+                match (unnamed.next(), unnamed.next()) {
+                    (Some(sharded_table), None) => sharded_table,
+                    _ => return Err(sharding::Error::TableNotSharded(table.to_owned())),
+                }
+            }
+        };
+
+        ContextBuilder::new(sharded_table)
+            .data(key)
+            .shards(self.shards)
+            .build()?
+            .apply()
+    }
 }
 
 #[derive(Debug)]
 pub struct ClusterShardConfig {
     pub primary: Option<PoolConfig>,
     pub replicas: Vec<PoolConfig>,
+    pub slow_primary: Option<PoolConfig>,
+    pub slow_replicas: Vec<PoolConfig>,
 }
 
 impl ClusterShardConfig {
@@ -137,11 +205,23 @@ pub struct ClusterConfig<'a> {
     pub multi_tenant: &'a Option<MultiTenant>,
     pub rw_strategy: ReadWriteStrategy,
     pub rw_split: ReadWriteSplit,
+    pub catalog_reads_on_replicas: bool,
+    pub min_notice_severity: NoticeSeverity,
+    pub max_statement_timeout: Option<u64>,
+    pub serialization_retry_max_attempts: usize,
+    pub serialization_retry_min_delay: u64,
     pub schema_admin: bool,
+    pub slow_pool: bool,
+    pub priority: Priority,
+    pub slow_queries: &'a [String],
+    pub primary_only: PrimaryOnly,
+    pub query_routing_rules: QueryRoutingRules,
     pub cross_shard_disabled: bool,
     pub two_pc: bool,
     pub two_pc_auto: bool,
+    pub two_pc_ddl: bool,
     pub sharded_schemas: ShardedSchemas,
+    pub relationships: Relationships,
     pub rewrite: &'a Rewrite,
     pub prepared_statements: &'a PreparedStatements,
     pub dry_run: bool,
@@ -164,6 +244,9 @@ pub struct ClusterConfig<'a> {
     pub regex_parser_limit: usize,
     pub pub_sub_enabled: bool,
     pub identity: &'a Option<String>,
+    pub client_profile: ClientProfile,
+    pub max_client_connections: Option<usize>,
+    pub replication: bool,
 }
 
 impl<'a> ClusterConfig<'a> {
@@ -196,7 +279,54 @@ impl<'a> ClusterConfig<'a> {
             multi_tenant,
             rw_strategy: general.read_write_strategy,
             rw_split: general.read_write_split,
+            catalog_reads_on_replicas: config
+                .databases
+                .iter()
+                .filter(|database| database.name == user.database)
+                .find_map(|database| database.catalog_reads_on_replicas)
+                .unwrap_or(general.catalog_reads_on_replicas),
+            min_notice_severity: config
+                .databases
+                .iter()
+                .filter(|database| database.name == user.database)
+                .find_map(|database| database.min_notice_severity)
+                .unwrap_or(general.min_notice_severity),
+            max_statement_timeout: config
+                .databases
+                .iter()
+                .filter(|database| database.name == user.database)
+                .find_map(|database| database.max_statement_timeout),
+            serialization_retry_max_attempts: general.serialization_retry_max_attempts,
+            serialization_retry_min_delay: general.serialization_retry_min_delay,
             schema_admin: user.schema_admin,
+            slow_pool: user.slow_pool,
+            priority: user.priority,
+            slow_queries: config
+                .databases
+                .iter()
+                .filter(|database| database.name == user.database)
+                .map(|database| database.slow_queries.as_slice())
+                .find(|queries| !queries.is_empty())
+                .unwrap_or_default(),
+            primary_only: config
+                .databases
+                .iter()
+                .filter(|database| database.name == user.database)
+                .map(|database| {
+                    PrimaryOnly::new(
+                        &database.primary_only_functions,
+                        &database.primary_only_tables,
+                        &database.replica_safe_functions,
+                    )
+                })
+                .find(|primary_only| !primary_only.is_empty())
+                .unwrap_or_default(),
+            query_routing_rules: QueryRoutingRules::new(
+                config
+                    .query_routing_rules
+                    .iter()
+                    .filter(|rule| rule.database == user.database),
+            ),
             cross_shard_disabled: user
                 .cross_shard_disabled
                 .unwrap_or(general.cross_shard_disabled),
@@ -204,7 +334,18 @@ impl<'a> ClusterConfig<'a> {
             two_pc_auto: user
                 .two_phase_commit_auto
                 .unwrap_or(general.two_phase_commit_auto.unwrap_or(false)), // Disable by default.
+            two_pc_ddl: general.two_phase_commit_ddl,
             sharded_schemas,
+            relationships: Relationships::new(
+                &user.database,
+                config
+                    .routing_relationships
+                    .iter()
+                    .filter(|relationship| relationship.database == user.database)
+                    .cloned()
+                    .collect(),
+                general.routing_relationships_cache_limit,
+            ),
             rewrite,
             prepared_statements: &general.prepared_statements,
             dry_run: general.dry_run,
@@ -228,6 +369,9 @@ impl<'a> ClusterConfig<'a> {
             regex_parser_limit: general.regex_parser_limit,
             pub_sub_enabled: general.pub_sub_enabled(),
             identity: &user.identity,
+            client_profile: user.client_profile,
+            max_client_connections: user.max_client_connections,
+            replication: user.replication,
         }
     }
 }
@@ -247,11 +391,23 @@ impl Cluster {
             multi_tenant,
             rw_strategy,
             rw_split,
+            catalog_reads_on_replicas,
+            min_notice_severity,
+            max_statement_timeout,
+            serialization_retry_max_attempts,
+            serialization_retry_min_delay,
             schema_admin,
+            slow_pool,
+            priority,
+            slow_queries,
+            primary_only,
+            query_routing_rules,
             cross_shard_disabled,
             two_pc,
             two_pc_auto,
+            two_pc_ddl,
             sharded_schemas,
+            relationships,
             rewrite,
             prepared_statements,
             dry_run,
@@ -274,6 +430,9 @@ impl Cluster {
             regex_parser_limit,
             pub_sub_enabled,
             identity,
+            client_profile,
+            max_client_connections,
+            replication,
         } = config;
 
         let identifier = Arc::new(DatabaseUser {
@@ -291,6 +450,8 @@ impl Cluster {
                         number,
                         primary: &config.primary,
                         replicas: &config.replicas,
+                        slow_primary: &config.slow_primary,
+                        slow_replicas: &config.slow_replicas,
                         lb_strategy,
                         rw_split,
                         identifier: identifier.clone(),
@@ -303,15 +464,38 @@ impl Cluster {
             pooler_mode,
             sharded_tables,
             sharded_schemas,
+            relationships,
             replication_sharding,
             multi_tenant: multi_tenant.clone(),
             rw_strategy,
             rw_split,
+            catalog_reads_on_replicas,
+            min_notice_severity,
+            max_statement_timeout,
+            serialization_retry_max_attempts,
+            serialization_retry_min_delay: Duration::from_millis(serialization_retry_min_delay),
             schema_admin,
+            slow_pool,
+            priority,
+            slow_queries: Arc::new(
+                slow_queries
+                    .iter()
+                    .filter_map(|query| match fingerprint(query) {
+                        Ok(fingerprint) => Some(fingerprint),
+                        Err(err) => {
+                            warn!("ignoring slow query \"{}\": {}", query, err);
+                            None
+                        }
+                    })
+                    .collect(),
+            ),
+            primary_only: Arc::new(primary_only),
+            query_routing_rules: Arc::new(query_routing_rules),
             stats: Arc::new(Mutex::new(MirrorStats::default())),
             cross_shard_disabled,
             two_phase_commit: two_pc && shards.len() > 1,
             two_phase_commit_auto: two_pc_auto && shards.len() > 1,
+            two_phase_commit_ddl: two_pc_ddl && shards.len() > 1,
             readiness: Arc::new(Readiness::default()),
             rewrite: rewrite.clone(),
             prepared_statements: *prepared_statements,
@@ -335,6 +519,10 @@ impl Cluster {
             ),
             regex_parser: RegexParser::new(regex_parser_limit, query_parser),
             identity: identity.clone(),
+            client_profile,
+            max_client_connections,
+            max_user_client_connections: None,
+            replication,
         }
     }
 
@@ -345,6 +533,7 @@ impl Cluster {
         cluster.rewrite.enabled = false;
         cluster.rewrite.shard_key = RewriteMode::Ignore;
         cluster.rewrite.split_inserts = RewriteMode::Ignore;
+        cluster.rewrite.subqueries = RewriteMode::Ignore;
         cluster
     }
 
@@ -379,13 +568,16 @@ impl Cluster {
         Ok(())
     }
 
-    /// Cancel a query executed by one of the shards.
+    /// Cancel a query executed by this client on any of the shards.
+    ///
+    /// Cross-shard queries hold a server connection in every shard they touch,
+    /// so the cancel request is sent to all of them concurrently. One shard failing
+    /// to receive it doesn't prevent the others from being cancelled.
     pub async fn cancel(&self, id: FrontendPid) -> Result<(), super::super::Error> {
-        for shard in &self.shards {
-            shard.cancel(id).await?;
-        }
-
-        Ok(())
+        join_all(self.shards.iter().map(|shard| shard.cancel(id)))
+            .await
+            .into_iter()
+            .collect()
     }
 
     /// Get all shards.
@@ -441,6 +633,26 @@ impl Cluster {
         &self.prepared_statements
     }
 
+    /// Client driver workarounds.
+    pub fn client_profile(&self) -> ClientProfile {
+        self.client_profile
+    }
+
+    /// Maximum number of clients connected to this cluster.
+    pub fn max_client_connections(&self) -> Option<usize> {
+        self.max_client_connections
+    }
+
+    /// Maximum number of clients connected as this user to all databases.
+    pub fn max_user_client_connections(&self) -> Option<usize> {
+        self.max_user_client_connections
+    }
+
+    /// Clients can open replication connections.
+    pub fn replication(&self) -> bool {
+        self.replication
+    }
+
     pub fn connection_recovery(&self) -> &ConnectionRecovery {
         &self.connection_recovery
     }
@@ -488,11 +700,45 @@ impl Cluster {
         self.schema_admin
     }
 
+    /// All queries from this user should use the slow pool.
+    pub fn slow_pool(&self) -> bool {
+        self.slow_pool
+    }
+
+    /// Priority of this user's clients waiting for a server connection.
+    pub fn priority(&self) -> Priority {
+        self.priority
+    }
+
+    /// The query is listed in `slow_queries` and should use the slow pool.
+    ///
+    /// Fingerprinting parses the query, so this is free only when no slow queries
+    /// are configured.
+    pub fn slow_query(&self, query: &LazyFingerprint<'_>) -> bool {
+        if self.slow_queries.is_empty() {
+            return false;
+        }
+
+        query
+            .fingerprint()
+            .is_some_and(|fingerprint| self.slow_queries.contains(fingerprint))
+    }
+
+    /// At least one shard has a separate pool for long-running queries.
+    pub fn has_slow_pool(&self) -> bool {
+        self.shards.iter().any(|shard| shard.has_slow_pool())
+    }
+
     /// Change schema owner attribute.
     pub fn toggle_schema_admin(&mut self, owner: bool) {
         self.schema_admin = owner;
     }
 
+    /// Set the client limit shared by all databases of the user.
+    pub fn set_max_user_client_connections(&mut self, limit: Option<usize>) {
+        self.max_user_client_connections = limit;
+    }
+
     pub fn stats(&self) -> Arc<Mutex<MirrorStats>> {
         self.stats.clone()
     }
@@ -507,7 +753,7 @@ impl Cluster {
     pub(crate) fn use_query_parser(&self, request: &ClientRequest) -> bool {
         match self.query_parser() {
             QueryParserLevel::Off => false,
-            QueryParserLevel::On => true,
+            QueryParserLevel::On | QueryParserLevel::Shadow => true,
             QueryParserLevel::SessionControl | QueryParserLevel::SessionControlAndLocks => {
                 self.regex_parser.use_parser(request)
             }
@@ -516,6 +762,7 @@ impl Cluster {
                     || self.router_needed()
                     || self.dry_run()
                     || self.prepared_statements() == &PreparedStatements::Full
+                    || self.rewrite.sequence_cache > 0
                     || self.regex_parser.use_parser(request)
             }
         }
@@ -533,12 +780,19 @@ impl Cluster {
             .and_then(|database| databases().replication(database))
     }
 
+    /// Routing relationships between child and parent tables.
+    pub fn relationships(&self) -> &Relationships {
+        &self.relationships
+    }
+
     /// Get all data required for sharding.
     pub fn sharding_schema(&self) -> ShardingSchema {
         ShardingSchema {
+            database: self.identifier.database.clone(),
             shards: self.shards.len(),
             tables: self.sharded_tables.clone(),
             schemas: self.sharded_schemas.clone(),
+            relationships: self.relationships.clone(),
             rewrite: self.rewrite.clone(),
             query_parser_engine: self.query_parser_engine,
             log_min_duration_parse: self.log_min_duration_parse,
@@ -554,7 +808,11 @@ impl Cluster {
         match self.load_schema {
             LoadSchema::On => true,
             LoadSchema::Off => false,
-            LoadSchema::Auto => self.shards.len() > 1 || self.multi_tenant().is_some(),
+            LoadSchema::Auto => {
+                self.shards.len() > 1
+                    || self.multi_tenant().is_some()
+                    || self.rewrite.sequence_cache > 0
+            }
         }
     }
 
@@ -581,6 +839,41 @@ impl Cluster {
         self.rw_split == ReadWriteSplit::ExcludePrimary
     }
 
+    /// Route queries that only read system catalogs to replicas.
+    pub(crate) fn catalog_reads_on_replicas(&self) -> bool {
+        self.catalog_reads_on_replicas
+    }
+
+    /// Notices less severe than this aren't sent to clients.
+    pub(crate) fn min_notice_severity(&self) -> NoticeSeverity {
+        self.min_notice_severity
+    }
+
+    /// Functions and tables that always route to the primary.
+    pub(crate) fn primary_only(&self) -> &PrimaryOnly {
+        &self.primary_only
+    }
+
+    /// Rules routing queries by regex or fingerprint.
+    pub(crate) fn query_routing_rules(&self) -> &QueryRoutingRules {
+        &self.query_routing_rules
+    }
+
+    /// Maximum `statement_timeout` clients can set, in milliseconds.
+    pub fn max_statement_timeout(&self) -> Option<u64> {
+        self.max_statement_timeout
+    }
+
+    /// Maximum retries for statements that failed with a serialization failure or deadlock.
+    pub fn serialization_retry_max_attempts(&self) -> usize {
+        self.serialization_retry_max_attempts
+    }
+
+    /// Base delay between serialization failure retries. Doubles each attempt, capped at 32×.
+    pub fn serialization_retry_min_delay(&self) -> &Duration {
+        &self.serialization_retry_min_delay
+    }
+
     /// Cross-shard queries disabled for this cluster.
     pub fn cross_shard_disabled(&self) -> bool {
         self.cross_shard_disabled
@@ -597,6 +890,12 @@ impl Cluster {
         self.two_phase_commit_auto && self.two_pc_enabled()
     }
 
+    /// Two-phase commit transactions started automatically
+    /// for cross-shard DDL.
+    pub fn two_pc_ddl_enabled(&self) -> bool {
+        self.two_phase_commit_ddl && self.two_pc_enabled()
+    }
+
     /// How many parallel COPY commands can we
     /// run to re-shard this cluster.
     pub fn resharding_parallel_copies(&self) -> usize {
@@ -702,6 +1001,8 @@ mod test {
                         number,
                         primary,
                         replicas,
+                        slow_primary: &None,
+                        slow_replicas: &[],
                         lb_strategy: LoadBalancingStrategy::Random,
                         rw_split: ReadWriteSplit::IncludePrimary,
                         identifier: identifier.clone(),
@@ -754,29 +1055,39 @@ mod test {
                         OmnishardedTable {
                             name: "sharded_omni".into(),
                             sticky_routing: false,
+                            two_phase_commit: false,
                         },
                         OmnishardedTable {
                             name: "sharded_omni_sticky".into(),
                             sticky_routing: true,
+                            two_phase_commit: false,
+                        },
+                        OmnishardedTable {
+                            name: "sharded_omni_2pc".into(),
+                            sticky_routing: false,
+                            two_phase_commit: true,
                         },
                     ],
                     config.config.general.omnisharded_sticky,
                     config.config.general.system_catalogs,
                 ),
-                sharded_schemas: ShardedSchemas::new(vec![
-                    ShardedSchema {
-                        database: "pgdog".into(),
-                        name: Some("shard_0".into()),
-                        shard: 0,
-                        ..Default::default()
-                    },
-                    ShardedSchema {
-                        database: "pgdog".into(),
-                        name: Some("shard_1".into()),
-                        shard: 1,
-                        ..Default::default()
-                    },
-                ]),
+                sharded_schemas: ShardedSchemas::new(
+                    vec![
+                        ShardedSchema {
+                            database: "pgdog".into(),
+                            name: Some("shard_0".into()),
+                            shard: 0,
+                            ..Default::default()
+                        },
+                        ShardedSchema {
+                            database: "pgdog".into(),
+                            name: Some("shard_1".into()),
+                            shard: 1,
+                            ..Default::default()
+                        },
+                    ],
+                    shards.len(),
+                ),
                 shards,
                 identifier,
                 prepared_statements: config.config.general.prepared_statements,
@@ -790,6 +1101,7 @@ mod test {
                 rewrite: config.config.rewrite.clone(),
                 two_phase_commit: config.config.general.two_phase_commit,
                 two_phase_commit_auto: config.config.general.two_phase_commit_auto.unwrap_or(false),
+                two_phase_commit_ddl: config.config.general.two_phase_commit_ddl,
                 ..Default::default()
             }
         }
@@ -801,6 +1113,12 @@ mod test {
             cluster
         }
 
+        pub fn new_test_replication(config: &ConfigAndUsers) -> Cluster {
+            let mut cluster = Self::new_test(config);
+            cluster.replication = true;
+            cluster
+        }
+
         pub fn new_test_session_mode(config: &ConfigAndUsers) -> Cluster {
             let mut cluster = Self::new_test(config);
             cluster.pooler_mode = PoolerMode::Session;
@@ -829,6 +1147,8 @@ mod test {
                     },
                     config: Config::default(),
                 }],
+                slow_primary: &None,
+                slow_replicas: &[],
                 lb_strategy: LoadBalancingStrategy::Random,
                 rw_split: ReadWriteSplit::IncludePrimary,
                 identifier: cluster.identifier.clone(),
@@ -852,6 +1172,8 @@ mod test {
                         config: Config::default(),
                     }),
                     replicas: &[],
+                    slow_primary: &None,
+                    slow_replicas: &[],
                     lb_strategy: LoadBalancingStrategy::default(),
                     rw_split: ReadWriteSplit::default(),
                     identifier: identifier.clone(),
@@ -869,6 +1191,7 @@ mod test {
                 rewrite: config.config.rewrite.clone(),
                 two_phase_commit: config.config.general.two_phase_commit,
                 two_phase_commit_auto: config.config.general.two_phase_commit_auto.unwrap_or(false),
+                two_phase_commit_ddl: config.config.general.two_phase_commit_ddl,
                 ..Default::default()
             }
         }
@@ -886,6 +1209,8 @@ mod test {
                     },
                     config: Config::default(),
                 }],
+                slow_primary: &None,
+                slow_replicas: &[],
                 lb_strategy: LoadBalancingStrategy::default(),
                 rw_split: ReadWriteSplit::default(),
                 identifier,
@@ -903,6 +1228,90 @@ mod test {
         pub(crate) fn set_rw_split(&mut self, rw_split: ReadWriteSplit) {
             self.rw_split = rw_split;
         }
+
+        pub(crate) fn set_catalog_reads_on_replicas(&mut self, enabled: bool) {
+            self.catalog_reads_on_replicas = enabled;
+        }
+
+        pub(crate) fn set_primary_only(&mut self, primary_only: PrimaryOnly) {
+            self.primary_only = Arc::new(primary_only);
+        }
+
+        pub(crate) fn set_query_routing_rules(&mut self, rules: QueryRoutingRules) {
+            self.query_routing_rules = Arc::new(rules);
+        }
+    }
+
+    #[test]
+    fn test_shard_of() {
+        use crate::frontend::router::{parser::Shard, sharding::Error};
+        use pgdog_config::SystemCatalogsBehavior;
+
+        let config = ConfigAndUsers::default();
+        let schema = Cluster::new_test(&config).sharding_schema();
+
+        let shard = schema.shard_of("sharded", None, "1234").unwrap();
+        assert!(matches!(shard, Shard::Direct(0 | 1)));
+        assert_eq!(
+            schema.shard_of("sharded", Some("id"), "1234").unwrap(),
+            shard
+        );
+
+        assert!(matches!(
+            schema.shard_of("users", None, "1234"),
+            Err(Error::TableNotSharded(_))
+        ));
+        assert!(matches!(
+            schema.shard_of("sharded", Some("email"), "1234"),
+            Err(Error::TableNotSharded(_))
+        ));
+
+        // Entries without a name shard any table with the column.
+        let unnamed = |column: &str| ShardedTable {
+            database: "pgdog".into(),
+            column: column.into(),
+            data_type: DataType::Bigint,
+            centroid_probes: 1,
+            hasher: Hasher::Postgres,
+            ..Default::default()
+        };
+        let mut schema = schema;
+        schema.tables = ShardedTables::new(
+            vec![unnamed("tenant_id")],
+            vec![],
+            false,
+            SystemCatalogsBehavior::default(),
+        );
+        let shard = schema.shard_of("users", None, "1234").unwrap();
+        assert!(matches!(shard, Shard::Direct(0 | 1)));
+        assert_eq!(
+            schema
+                .shard_of("orders", Some("tenant_id"), "1234")
+                .unwrap(),
+            shard
+        );
+        assert!(matches!(
+            schema.shard_of("users", Some("id"), "1234"),
+            Err(Error::TableNotSharded(_))
+        ));
+
+        // Ambiguous without a column.
+        schema.tables = ShardedTables::new(
+            vec![unnamed("tenant_id"), unnamed("account_id")],
+            vec![],
+            false,
+            SystemCatalogsBehavior::default(),
+        );
+        assert!(matches!(
+            schema.shard_of("users", None, "1234"),
+            Err(Error::TableNotSharded(_))
+        ));
+        assert_eq!(
+            schema
+                .shard_of("users", Some("account_id"), "1234")
+                .unwrap(),
+            shard
+        );
     }
 
     #[test]
@@ -1092,6 +1501,62 @@ mod test {
         assert!(cluster.ready());
     }
 
+    #[tokio::test]
+    async fn test_cancel_cross_shard() {
+        use tokio::time::{Duration, timeout};
+
+        use crate::{backend::pool::Request, net::messages::FrontendPid};
+
+        let config = ConfigAndUsers::default();
+        let cluster = Cluster::new_test(&config);
+        cluster.launch();
+
+        let id = FrontendPid::new();
+        let request = Request::new(id, false);
+
+        let mut handles = vec![];
+        for shard in 0..cluster.shards().len() {
+            let mut server = cluster.primary(shard, &request).await.unwrap();
+            handles.push(tokio::spawn(async move {
+                server.execute("SELECT pg_sleep(10)").await
+            }));
+        }
+
+        tokio::time::sleep(Duration::from_millis(100)).await;
+        cluster.cancel(id).await.unwrap();
+
+        for handle in handles {
+            let result = timeout(Duration::from_secs(2), handle)
+                .await
+                .expect("query on every shard should be cancelled")
+                .unwrap();
+            assert!(result.is_err());
+        }
+
+        cluster.shutdown();
+    }
+
+    #[test]
+    fn test_slow_query() {
+        use std::collections::HashSet;
+
+        use crate::frontend::router::parser::{LazyFingerprint, fingerprint};
+
+        let mut cluster = Cluster::new_test(&config());
+        let slow_query =
+            |cluster: &Cluster, query| cluster.slow_query(&LazyFingerprint::new(query));
+        assert!(!slow_query(&cluster, "SELECT * FROM report WHERE id = 1"));
+
+        let report = fingerprint("SELECT * FROM report WHERE id = 1").unwrap();
+        cluster.slow_queries = Arc::new(HashSet::from([report]));
+        assert!(slow_query(&cluster, "SELECT * FROM report WHERE id = 2"));
+        assert!(slow_query(
+            &cluster,
+            "/* pgdog_shard: 0 */ SELECT * FROM report WHERE id = 3"
+        ));
+        assert!(!slow_query(&cluster, "SELECT * FROM users WHERE id = 1"));
+    }
+
     #[test]
     fn test_use_query_parser_set() {
         let mut cluster = Cluster::new_test(&config());
@@ -5,7 +5,7 @@ use std::{
     time::Duration,
 };
 
-use pgdog_config::Role;
+use pgdog_config::{PoolerMode, Role};
 use serde::{Deserialize, Serialize};
 
 use crate::config::{Database, General, User};
@@ -76,6 +76,16 @@ impl Config {
         self.idle_healthcheck_delay
     }
 
+    /// Shortest idle healthcheck interval.
+    pub fn idle_healthcheck_min_interval(&self) -> Duration {
+        self.idle_healthcheck_min_interval
+    }
+
+    /// Longest idle healthcheck interval.
+    pub fn idle_healthcheck_max_interval(&self) -> Duration {
+        self.idle_healthcheck_max_interval
+    }
+
     /// Ban timeout.
     pub fn ban_timeout(&self) -> Duration {
         self.ban_timeout
@@ -97,6 +107,18 @@ impl Config {
 
     /// Create from database/user configuration.
     pub fn new(general: &General, database: &Database, user: &User, is_only_replica: bool) -> Self {
+        let pooler_mode = user
+            .pooler_mode
+            .unwrap_or(database.pooler_mode.unwrap_or(general.pooler_mode));
+
+        // Session mode pools can be sized separately.
+        let default_pool_size = match pooler_mode {
+            PoolerMode::Session => general
+                .session_pool_size
+                .unwrap_or(general.default_pool_size),
+            _ => general.default_pool_size,
+        };
+
         Self {
             inner: pgdog_stats::Config {
                 min: user
@@ -104,7 +126,7 @@ impl Config {
                     .unwrap_or(database.min_pool_size.unwrap_or(general.min_pool_size)),
                 max: user
                     .pool_size
-                    .unwrap_or(database.pool_size.unwrap_or(general.default_pool_size)),
+                    .unwrap_or(database.pool_size.unwrap_or(default_pool_size)),
                 max_age: Duration::from_millis(
                     user.server_lifetime
                         .unwrap_or(database.server_lifetime.unwrap_or(general.server_lifetime)),
@@ -119,6 +141,18 @@ impl Config {
                 healthcheck_interval: Duration::from_millis(general.healthcheck_interval),
                 idle_healthcheck_interval: Duration::from_millis(general.idle_healthcheck_interval),
                 idle_healthcheck_delay: Duration::from_millis(general.idle_healthcheck_delay),
+                idle_healthcheck_min_interval: Duration::from_millis(
+                    general
+                        .idle_healthcheck_min_interval
+                        .unwrap_or(general.idle_healthcheck_interval)
+                        .min(general.idle_healthcheck_interval),
+                ),
+                idle_healthcheck_max_interval: Duration::from_millis(
+                    general
+                        .idle_healthcheck_max_interval
+                        .unwrap_or(general.idle_healthcheck_interval)
+                        .max(general.idle_healthcheck_interval),
+                ),
                 healthcheck_timeout: Duration::from_millis(general.healthcheck_timeout),
                 ban_timeout: Duration::from_millis(general.ban_timeout),
                 rollback_timeout: Duration::from_millis(general.rollback_timeout),
@@ -131,9 +165,7 @@ impl Config {
                     .or(database.lock_timeout)
                     .map(Duration::from_millis),
                 replication_mode: user.replication_mode,
-                pooler_mode: user
-                    .pooler_mode
-                    .unwrap_or(database.pooler_mode.unwrap_or(general.pooler_mode)),
+                pooler_mode,
                 connect_timeout: Duration::from_millis(general.connect_timeout),
                 connect_attempts: general.connect_attempts,
                 connect_attempt_delay: general.connect_attempt_delay(),
@@ -153,14 +185,68 @@ impl Config {
                 lsn_check_interval: Duration::from_millis(general.lsn_check_interval),
                 lsn_check_timeout: Duration::from_millis(general.lsn_check_timeout),
                 lsn_check_delay: Duration::from_millis(general.lsn_check_delay),
+                lsn_history: Duration::from_millis(general.lsn_history),
                 role_detection: database.role == Role::Auto,
                 resharding_only: database.resharding_only,
                 lb_weight: database.lb_weight,
-                prepared_statements_level: general.prepared_statements,
+                prepared_statements_level: user
+                    .client_profile
+                    .prepared_statements(general.prepared_statements),
+                connection_affinity: general.connection_affinity,
+                client_queue_order: database
+                    .client_queue_order
+                    .unwrap_or(general.client_queue_order),
+                server_queue_order: database
+                    .server_queue_order
+                    .unwrap_or(general.server_queue_order),
+                fair_share_window: database
+                    .fair_share_window
+                    .or(general.fair_share_window)
+                    .map(Duration::from_millis),
+                max_waiting_clients: database.max_waiting_clients.or(general.max_waiting_clients),
+                low_priority_pool_percent: general.low_priority_pool_percent,
+                autoscale_max: database
+                    .autoscale_max_pool_size
+                    .or(general.autoscale_max_pool_size),
+                autoscale_wait_target: Duration::from_millis(general.autoscale_wait_target),
                 ..Default::default()
             },
         }
     }
+
+    /// Configuration for the slow pool, if the database has one.
+    ///
+    /// The slow pool uses the same settings as the regular pool,
+    /// except for its size and timeouts.
+    pub fn slow(&self, database: &Database) -> Option<Self> {
+        let max = database.slow_pool_size?;
+        let mut config = *self;
+
+        config.inner.max = max;
+        config.inner.min = 0;
+        config.inner.autoscale_max = None;
+
+        if let Some(checkout_timeout) = database.slow_checkout_timeout {
+            config.inner.checkout_timeout = Duration::from_millis(checkout_timeout);
+        }
+
+        if let Some(statement_timeout) = database.slow_statement_timeout {
+            config.inner.statement_timeout = Some(Duration::from_millis(statement_timeout));
+        }
+
+        Some(config)
+    }
+
+    /// Cap the pool size, e.g., during a maintenance window.
+    pub fn limit_pool_size(mut self, pool_size: Option<usize>) -> Self {
+        if let Some(pool_size) = pool_size {
+            self.inner.max = self.inner.max.min(pool_size);
+            self.inner.min = self.inner.min.min(self.inner.max);
+            self.inner.autoscale_max = self.inner.autoscale_max.map(|max| max.min(pool_size));
+        }
+
+        self
+    }
 }
 
 #[cfg(test)]
@@ -189,6 +275,35 @@ mod test {
         assert!(config.role_detection);
     }
 
+    #[test]
+    fn test_session_pool_size() {
+        let general = General {
+            default_pool_size: 10,
+            session_pool_size: Some(100),
+            ..Default::default()
+        };
+        let database = create_database(Role::Primary);
+
+        let user = User::default();
+        let config = Config::new(&general, &database, &user, false);
+        assert_eq!(config.max, 10);
+
+        let user = User {
+            pooler_mode: Some(PoolerMode::Session),
+            ..Default::default()
+        };
+        let config = Config::new(&general, &database, &user, false);
+        assert_eq!(config.max, 100);
+
+        let user = User {
+            pooler_mode: Some(PoolerMode::Session),
+            pool_size: Some(20),
+            ..Default::default()
+        };
+        let config = Config::new(&general, &database, &user, false);
+        assert_eq!(config.max, 20);
+    }
+
     #[test]
     fn test_user_takes_precedence_over_database() {
         let general = General::default();
@@ -287,4 +402,32 @@ mod test {
 
         assert!(!config.role_detection);
     }
+
+    #[test]
+    fn test_slow_pool() {
+        let general = General {
+            default_pool_size: 10,
+            checkout_timeout: 5_000,
+            ..Default::default()
+        };
+        let user = User::default();
+
+        let database = create_database(Role::Primary);
+        let config = Config::new(&general, &database, &user, false);
+        assert!(config.slow(&database).is_none());
+
+        let database = Database {
+            slow_pool_size: Some(2),
+            slow_statement_timeout: Some(60_000),
+            ..create_database(Role::Primary)
+        };
+        let config = Config::new(&general, &database, &user, false);
+        let slow = config.slow(&database).unwrap();
+
+        assert_eq!(slow.max, 2);
+        assert_eq!(slow.min, 0);
+        assert_eq!(slow.checkout_timeout, Duration::from_millis(5_000));
+        assert_eq!(slow.statement_timeout, Some(Duration::from_millis(60_000)));
+        assert_eq!(config.max, 10);
+    }
 }
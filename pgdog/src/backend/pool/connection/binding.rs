@@ -8,10 +8,14 @@ use crate::{
             two_pc::{TwoPcTransaction, statement::phase_control},
         },
     },
-    net::{FrontendPid, ProtocolMessage, Query, parameter::Parameters},
+    net::{
+        ErrorResponse, FromBytes, FrontendPid, ProtocolMessage, Query, ToBytes,
+        parameter::Parameters,
+    },
     state::State,
 };
 
+use bytes::Bytes;
 use futures::future::join_all;
 
 use super::*;
@@ -84,9 +88,16 @@ impl Binding {
         }
     }
 
-    pub(super) async fn read(&mut self) -> Result<Message, Error> {
+    /// Read a message from the server(s).
+    ///
+    /// Errors are counted against the shard that returned them,
+    /// using the `cluster` the client is connected to.
+    pub(super) async fn read(&mut self, cluster: Option<&Cluster>) -> Result<Message, Error> {
         match self {
-            Binding::Direct(guard, _) => guard.read().await,
+            Binding::Direct(guard, shard) => {
+                let message = guard.read().await?;
+                Self::shard_error(cluster, *shard, guard, message)
+            }
 
             Binding::NotConnected => loop {
                 debug!("binding suspended");
@@ -109,15 +120,21 @@ impl Binding {
                             return Ok(message);
                         }
                         let mut read = false;
-                        for server in shards.iter_mut() {
+                        for (position, server) in shards.iter_mut().enumerate() {
                             if !server.has_more_messages() {
                                 continue;
                             }
 
                             let message = server.read().await?;
+                            let message = Self::shard_error(
+                                cluster,
+                                state.shard_index(position),
+                                server,
+                                message,
+                            )?;
 
                             read = true;
-                            if let Some(message) = state.forward(message)? {
+                            if let Some(message) = state.forward_from(position, message)? {
                                 return Ok(message);
                             }
                         }
@@ -137,6 +154,61 @@ impl Binding {
         }
     }
 
+    /// Same as [`Self::read`], except large `DataRow` and `CopyData` messages
+    /// are returned in parts when connected to a single server.
+    pub(super) async fn read_partial(
+        &mut self,
+        cluster: Option<&Cluster>,
+        threshold: usize,
+    ) -> Result<Message, Error> {
+        match self {
+            Binding::Direct(guard, shard) => {
+                let message = guard.read_partial(threshold).await?;
+                Self::shard_error(cluster, *shard, guard, message)
+            }
+
+            _ => self.read(cluster).await,
+        }
+    }
+
+    /// Read the next part of a message returned by [`Self::read_partial`].
+    pub(super) async fn read_chunk(&mut self) -> Result<Option<Bytes>, Error> {
+        match self {
+            Binding::Direct(guard, _) => Ok(guard.read_chunk().await?),
+            _ => Ok(None),
+        }
+    }
+
+    /// Count an error returned by a server against its shard and,
+    /// if enabled, tag it with the shard number and pool.
+    fn shard_error(
+        cluster: Option<&Cluster>,
+        shard: usize,
+        server: &Guard,
+        message: Message,
+    ) -> Result<Message, Error> {
+        if message.code() != 'E' {
+            return Ok(message);
+        }
+
+        if let Some(shard) = cluster.and_then(|cluster| cluster.shards().get(shard)) {
+            shard.error();
+        }
+
+        if !config().config.general.error_shard_field {
+            return Ok(message);
+        }
+
+        let mut error = ErrorResponse::from_bytes(message.to_bytes())?;
+        error.shard = Some(format!("shard={} pool={}", shard, server.addr()));
+        let tagged = error.message()?;
+
+        Ok(match message.source().backend_id() {
+            Some(id) => tagged.backend(id),
+            None => tagged,
+        })
+    }
+
     /// Send an entire buffer of messages to the servers(s).
     pub async fn send(&mut self, client_request: &ClientRequest) -> Result<(), Error> {
         match self {
@@ -150,6 +222,22 @@ impl Binding {
                 let mut shards_sent = servers.len();
                 let mut futures = Vec::new();
 
+                // Each shard gets its own version of the query
+                // with only the IN list values it owns.
+                let split_requests = client_request
+                    .route()
+                    .in_list_split()
+                    .map(|split| {
+                        (0..servers.len())
+                            .map(|position| {
+                                split.query(state.shard_index(position)).map(|query| {
+                                    ClientRequest::from(vec![ProtocolMessage::from(query.clone())])
+                                })
+                            })
+                            .collect::<Vec<_>>()
+                    })
+                    .unwrap_or_default();
+
                 for (position, server) in servers.iter_mut().enumerate() {
                     // Map positional index to actual shard number.
                     // When only a subset of shards is connected (Shard::Multi binding),
@@ -168,7 +256,11 @@ impl Binding {
                     };
 
                     if send {
-                        futures.push(server.send(client_request));
+                        let request = split_requests
+                            .get(position)
+                            .and_then(|request| request.as_ref())
+                            .unwrap_or(client_request);
+                        futures.push(server.send(request));
                     }
                 }
 
@@ -442,6 +534,19 @@ impl Binding {
         }
     }
 
+    /// Enforce a client deadline on all servers, or restore
+    /// `statement_timeout` changed by the previous one.
+    pub async fn deadline(&mut self, timeout: Option<Duration>) -> Result<(), Error> {
+        match self {
+            Binding::Direct(server, ..) => server.deadline(timeout).await,
+            Binding::MultiShard(servers, _) => {
+                let futures = servers.iter_mut().map(|server| server.deadline(timeout));
+                join_all(futures).await.into_iter().collect()
+            }
+            _ => Ok(()),
+        }
+    }
+
     /// Handle transaction end.
     pub fn transaction_params_hook(&mut self, rollback: bool) {
         match self {
@@ -479,6 +584,17 @@ impl Binding {
         }
     }
 
+    /// Client was idle in transaction for too long.
+    pub fn idle_xact_timeout(&mut self) {
+        match self {
+            Binding::Direct(server, ..) => server.stats_mut().idle_xact_timeout(),
+            Binding::MultiShard(servers, _) => servers
+                .iter_mut()
+                .for_each(|server| server.stats_mut().idle_xact_timeout()),
+            _ => (),
+        }
+    }
+
     pub(super) fn dirty(&mut self) {
         match self {
             Binding::Direct(server, ..) => server.mark_dirty(true),
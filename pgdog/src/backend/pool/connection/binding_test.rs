@@ -276,4 +276,46 @@ mod tests {
             _ => panic!("not an error"),
         };
     }
+
+    #[tokio::test]
+    async fn test_error_shard_field() {
+        use crate::frontend::ClientRequest;
+        use crate::net::{ErrorResponse, FromBytes, Protocol, Query, ToBytes};
+
+        let mut cfg = crate::config::ConfigAndUsers::default();
+        cfg.config.general.error_shard_field = true;
+        crate::config::set(cfg).unwrap();
+
+        let server = Box::new(test_server().await);
+        let pool = Pool::new(&PoolConfig {
+            address: server.addr().clone(),
+            config: crate::backend::pool::Config::default(),
+        });
+        let addr = server.addr().to_string();
+
+        let guard = crate::backend::pool::Guard::new(pool, server, Instant::now());
+        let mut binding = Binding::Direct(guard, 3);
+
+        binding
+            .send(&ClientRequest::from(vec![
+                Query::new("SELECT * FROM table_does_not_exist").into(),
+            ]))
+            .await
+            .unwrap();
+
+        let message = binding.read(None).await.unwrap();
+        assert_eq!(message.code(), 'E');
+        assert!(message.source().backend_id().is_some());
+
+        let error = ErrorResponse::from_bytes(message.to_bytes()).unwrap();
+        assert_eq!(error.code, "42P01");
+        assert_eq!(
+            error.shard.as_deref(),
+            Some(format!("shard=3 pool={}", addr).as_str())
+        );
+
+        assert_eq!(binding.read(None).await.unwrap().code(), 'Z');
+
+        crate::config::set(crate::config::ConfigAndUsers::default()).unwrap();
+    }
 }
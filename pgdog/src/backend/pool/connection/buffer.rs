@@ -2,12 +2,12 @@
 
 use std::{
     cmp::Ordering,
-    collections::{HashSet, VecDeque},
+    collections::{BTreeMap, HashSet, VecDeque},
 };
 
 use crate::{
     frontend::router::parser::{
-        Aggregate, DistinctBy, DistinctColumn, Limit, OrderBy,
+        Aggregate, DistinctBy, DistinctColumn, Having, Limit, OrderBy,
         rewrite::statement::aggregate::AggregateRewritePlan,
     },
     net::{
@@ -26,6 +26,32 @@ pub(super) struct Buffer {
     buffer: VecDeque<DataRow>,
     full: bool,
     distinct: HashSet<DataRow>,
+    /// Rows kept in shard order, moved to the buffer once it's full.
+    shards: BTreeMap<usize, Vec<DataRow>>,
+    /// Rows merged from shards as they arrive.
+    merge: Option<Merge>,
+}
+
+/// Merge of rows each shard returns sorted by the ORDER BY columns.
+#[derive(Default, Debug, Clone)]
+struct Merge {
+    order_by: Vec<OrderBy>,
+    distinct: Option<DistinctBy>,
+    limit: Limit,
+    /// Rows received from each shard, by position.
+    cursors: Vec<Cursor>,
+    /// Rows merged so far, before OFFSET and LIMIT.
+    merged: usize,
+    /// Rows returned to the client.
+    returned: usize,
+}
+
+/// Rows received from a shard that aren't merged yet.
+#[derive(Default, Debug, Clone)]
+struct Cursor {
+    rows: VecDeque<DataRow>,
+    /// The shard sent all of its rows.
+    done: bool,
 }
 
 impl Buffer {
@@ -38,19 +64,170 @@ impl Buffer {
         Ok(())
     }
 
+    /// Add message received from the shard to the buffer.
+    /// Rows are returned in shard order.
+    pub(super) fn add_shard(&mut self, shard: usize, message: Message) -> Result<(), super::Error> {
+        let dr = DataRow::from_bytes(message.to_bytes())?;
+
+        self.shards.entry(shard).or_default().push(dr);
+
+        Ok(())
+    }
+
     /// Mark the buffer as full. It will start returning messages now.
     /// Caller is responsible for sorting the buffer if needed.
     pub(super) fn full(&mut self) {
+        for (_, rows) in std::mem::take(&mut self.shards) {
+            self.buffer.extend(rows);
+        }
         self.full = true;
     }
 
     pub(super) fn reset(&mut self) {
         self.buffer.clear();
+        self.shards.clear();
+        self.merge = None;
         self.full = false;
     }
 
     /// Sort the buffer.
     pub(super) fn sort(&mut self, columns: &[OrderBy], decoder: &Decoder) {
+        let order_by = Self::order_by(columns, decoder);
+        self.buffer.make_contiguous().sort_by(order_by);
+    }
+
+    /// Start merging rows from `shards` shards, unless we already are.
+    /// Shards return rows already sorted by the ORDER BY columns, so we only
+    /// need to repeatedly pick the smallest row among them, instead of sorting
+    /// all of them again.
+    pub(super) fn start_merge(
+        &mut self,
+        shards: usize,
+        order_by: &[OrderBy],
+        distinct: &Option<DistinctBy>,
+        limit: &Limit,
+    ) {
+        self.merge.get_or_insert_with(|| Merge {
+            order_by: order_by.to_vec(),
+            distinct: distinct.clone(),
+            limit: *limit,
+            cursors: vec![Cursor::default(); shards],
+            ..Default::default()
+        });
+    }
+
+    /// Add a row received from the shard at `position` to the merge.
+    pub(super) fn merge_row(
+        &mut self,
+        position: usize,
+        message: Message,
+        decoder: &Decoder,
+    ) -> Result<(), super::Error> {
+        let dr = DataRow::from_bytes(message.to_bytes())?;
+
+        if let Some(cursor) = self
+            .merge
+            .as_mut()
+            .and_then(|merge| merge.cursors.get_mut(position))
+        {
+            cursor.rows.push_back(dr);
+        }
+        self.merge(decoder);
+
+        Ok(())
+    }
+
+    /// The shard at `position` sent all of its rows.
+    pub(super) fn merge_done(&mut self, position: usize, decoder: &Decoder) {
+        if let Some(cursor) = self
+            .merge
+            .as_mut()
+            .and_then(|merge| merge.cursors.get_mut(position))
+        {
+            cursor.done = true;
+        }
+        self.merge(decoder);
+    }
+
+    /// Number of merged rows returned to the client.
+    pub(super) fn merged(&self) -> usize {
+        self.merge.as_ref().map(|merge| merge.returned).unwrap_or(0)
+    }
+
+    /// Move rows to the buffer for as long as we know their order, i.e. every
+    /// shard that's still sending rows has one to compare with. Text is
+    /// compared byte by byte, same as when sorting.
+    fn merge(&mut self, decoder: &Decoder) {
+        let Some(merge) = self.merge.as_mut() else {
+            return;
+        };
+
+        let Merge {
+            order_by,
+            distinct,
+            limit,
+            cursors,
+            merged,
+            returned,
+        } = merge;
+
+        let order_by = Self::order_by(order_by, decoder);
+        let offset = limit.offset.unwrap_or(0);
+
+        while cursors
+            .iter()
+            .all(|cursor| cursor.done || !cursor.rows.is_empty())
+        {
+            // The rest won't be returned.
+            if limit.limit.is_some_and(|limit| *returned >= limit) {
+                for cursor in cursors.iter_mut() {
+                    cursor.rows.clear();
+                }
+                break;
+            }
+
+            // There are only a few shards, so finding the smallest
+            // row with a linear scan is cheaper than maintaining a heap.
+            // Ties go to the lower shard.
+            let Some(position) = cursors
+                .iter()
+                .enumerate()
+                .filter_map(|(position, cursor)| cursor.rows.front().map(|row| (position, row)))
+                .reduce(|min, next| {
+                    if order_by(next.1, min.1) == Ordering::Less {
+                        next
+                    } else {
+                        min
+                    }
+                })
+                .map(|(position, _)| position)
+            else {
+                break;
+            };
+
+            let Some(row) = cursors[position].rows.pop_front() else {
+                break;
+            };
+
+            if let Some(distinct) = distinct
+                && !Self::unique(&mut self.distinct, &row, distinct, decoder)
+            {
+                continue;
+            }
+
+            *merged += 1;
+            if *merged > offset {
+                self.buffer.push_back(row);
+                *returned += 1;
+            }
+        }
+    }
+
+    /// Compare rows using the ORDER BY columns.
+    fn order_by<'a>(
+        columns: &[OrderBy],
+        decoder: &'a Decoder,
+    ) -> impl Fn(&DataRow, &DataRow) -> Ordering + 'a {
         // Calculate column indices once, since
         // fetching indices by name is O(number of columns).
         let mut cols = vec![];
@@ -80,8 +257,7 @@ impl Buffer {
             };
         }
 
-        // Sort rows.
-        let order_by = move |a: &DataRow, b: &DataRow| -> Ordering {
+        move |a: &DataRow, b: &DataRow| -> Ordering {
             cols.iter()
                 .filter_map(|col| {
                     let index = col.index();
@@ -126,9 +302,7 @@ impl Buffer {
                 })
                 .reduce(Ordering::then)
                 .unwrap_or(Ordering::Equal)
-        };
-
-        self.buffer.make_contiguous().sort_by(order_by);
+        }
     }
 
     /// Execute aggregate functions.
@@ -154,12 +328,29 @@ impl Buffer {
             buffer
         };
 
+        Self::having(&mut rows, decoder, plan.having());
         Self::drop_helper_columns(&mut rows, plan);
         self.buffer = rows;
 
         Ok(())
     }
 
+    /// Remove groups that don't match the HAVING clause.
+    fn having(rows: &mut VecDeque<DataRow>, decoder: &Decoder, having: &Having) {
+        if having.is_empty() {
+            return;
+        }
+
+        rows.retain(|row| {
+            having.conditions().iter().all(|condition| {
+                match row.get_column(condition.column(), decoder) {
+                    Ok(Some(column)) => condition.matches(&column.value),
+                    _ => false,
+                }
+            })
+        });
+    }
+
     fn drop_helper_columns(rows: &mut VecDeque<DataRow>, plan: &AggregateRewritePlan) {
         if plan.is_noop() {
             return;
@@ -174,42 +365,50 @@ impl Buffer {
 
     pub(super) fn distinct(&mut self, distinct: &Option<DistinctBy>, decoder: &Decoder) {
         if let Some(distinct) = distinct {
-            match distinct {
-                DistinctBy::Row => {
-                    self.buffer.retain(|row| self.distinct.insert(row.clone()));
-                }
+            self.buffer
+                .retain(|row| Self::unique(&mut self.distinct, row, distinct, decoder));
+        }
+    }
 
-                DistinctBy::Columns(columns) => {
-                    self.buffer.retain(|row| {
-                        let mut dr = DataRow::new();
-                        for col in columns {
-                            match col {
-                                DistinctColumn::Index(index) => {
-                                    if let Some(data) = row.column(*index) {
-                                        dr.add(data);
-                                    }
-                                }
+    /// The row is the first one with its DISTINCT columns.
+    fn unique(
+        seen: &mut HashSet<DataRow>,
+        row: &DataRow,
+        distinct: &DistinctBy,
+        decoder: &Decoder,
+    ) -> bool {
+        match distinct {
+            DistinctBy::Row => seen.insert(row.clone()),
 
-                                DistinctColumn::Name(name) => {
-                                    if let Some(index) = decoder.rd().field_index(name)
-                                        && let Some(data) = row.column(index)
-                                    {
-                                        dr.add(data);
-                                    }
-                                }
+            DistinctBy::Columns(columns) => {
+                let mut dr = DataRow::new();
+                for col in columns {
+                    match col {
+                        DistinctColumn::Index(index) => {
+                            if let Some(data) = row.column(*index) {
+                                dr.add(data);
                             }
                         }
 
-                        self.distinct.insert(dr)
-                    });
+                        DistinctColumn::Name(name) => {
+                            if let Some(index) = decoder.rd().field_index(name)
+                                && let Some(data) = row.column(index)
+                            {
+                                dr.add(data);
+                            }
+                        }
+                    }
                 }
+
+                seen.insert(dr)
             }
         }
     }
 
-    /// Take messages from buffer.
+    /// Take messages from buffer. Merged rows are returned as soon as
+    /// we know their order.
     pub(super) fn take(&mut self) -> Option<Message> {
-        if self.full {
+        if self.full || self.merge.is_some() {
             self.buffer.pop_front().and_then(|s| s.message().ok())
         } else {
             None
@@ -239,9 +438,32 @@ impl Buffer {
 #[cfg(test)]
 mod test {
     use super::*;
+    use crate::frontend::router::parser::{HavingCondition, HavingOp};
     use crate::net::{Datum, Field, Format, RowDescription};
     use bytes::Bytes;
 
+    #[test]
+    fn test_shard_order_buffer() {
+        let mut buf = Buffer::default();
+
+        for (shard, value) in [(1, 10_i64), (0, 1), (2, 20), (1, 11), (0, 2)] {
+            let mut dr = DataRow::new();
+            dr.add(value);
+            buf.add_shard(shard, dr.message().unwrap()).unwrap();
+        }
+
+        assert!(buf.take().is_none());
+        buf.full();
+
+        let mut values = vec![];
+        while let Some(message) = buf.take() {
+            let dr = DataRow::from_bytes(message.to_bytes()).unwrap();
+            values.push(dr.get::<i64>(0, Format::Text).unwrap());
+        }
+
+        assert_eq!(values, vec![1, 2, 10, 11, 20]);
+    }
+
     #[test]
     fn test_sort_buffer() {
         let mut buf = Buffer::default();
@@ -272,6 +494,93 @@ mod test {
         assert_eq!(i, 26);
     }
 
+    fn merged_rows(buf: &mut Buffer) -> Vec<(i64, String)> {
+        std::iter::from_fn(|| buf.take())
+            .map(|message| {
+                let dr = DataRow::from_bytes(message.to_bytes()).unwrap();
+                (
+                    dr.get::<i64>(0, Format::Text).unwrap(),
+                    dr.get::<String>(1, Format::Text).unwrap(),
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_merge_buffer() {
+        let mut buf = Buffer::default();
+        let rd = RowDescription::new(&[Field::bigint("id"), Field::text("shard")]);
+        let decoder = Decoder::from(&rd);
+        buf.start_merge(3, &[OrderBy::Asc(1)], &None, &Limit::default());
+
+        // Each shard returns its rows already sorted,
+        // and all of them have a row with the same id.
+        for shard in 0..3_i64 {
+            for id in (shard..30).step_by(3).chain([30]) {
+                let mut dr = DataRow::new();
+                dr.add(id).add(shard.to_string());
+                buf.merge_row(shard as usize, dr.message().unwrap(), &decoder)
+                    .unwrap();
+            }
+        }
+
+        // Rows are returned once every shard has one to compare with.
+        let rows = merged_rows(&mut buf);
+        let ids = rows.iter().map(|(id, _)| *id).collect::<Vec<_>>();
+        let expected = (0..30).chain([30]).collect::<Vec<_>>();
+        assert_eq!(ids, expected);
+
+        for shard in 0..3 {
+            buf.merge_done(shard, &decoder);
+        }
+        let rows = [rows, merged_rows(&mut buf)].concat();
+        assert_eq!(rows.len(), 33);
+        assert_eq!(buf.merged(), 33);
+
+        // Rows with equal values keep shard order.
+        let shards = rows[30..].iter().map(|(_, shard)| shard.as_str());
+        assert!(shards.eq(["0", "1", "2"]));
+    }
+
+    #[test]
+    fn test_merge_buffer_incremental() {
+        let mut buf = Buffer::default();
+        let rd = RowDescription::new(&[Field::bigint("id"), Field::text("email")]);
+        let decoder = Decoder::from(&rd);
+        let limit = Limit {
+            limit: Some(3),
+            offset: Some(1),
+        };
+        buf.start_merge(2, &[OrderBy::Desc(2)], &None, &limit);
+
+        let row = |id: i64, email: &str| {
+            let mut dr = DataRow::new();
+            dr.add(id).add(email.to_string());
+            dr.message().unwrap()
+        };
+
+        // Nothing is known until both shards sent a row.
+        buf.merge_row(0, row(1, "d"), &decoder).unwrap();
+        buf.merge_row(0, row(2, "b"), &decoder).unwrap();
+        assert!(buf.take().is_none());
+
+        // "d" is skipped by the OFFSET.
+        buf.merge_row(1, row(3, "c"), &decoder).unwrap();
+        assert!(merged_rows(&mut buf).is_empty());
+
+        buf.merge_row(1, row(4, "a"), &decoder).unwrap();
+        assert_eq!(
+            merged_rows(&mut buf),
+            vec![(3, "c".to_string()), (2, "b".to_string())]
+        );
+
+        // Shard 0 is done, so "a" is next, and the LIMIT is reached.
+        buf.merge_done(0, &decoder);
+        buf.merge_row(1, row(5, "0"), &decoder).unwrap();
+        assert_eq!(merged_rows(&mut buf), vec![(4, "a".to_string())]);
+        assert_eq!(buf.merged(), 3);
+    }
+
     #[test]
     fn test_aggregate_buffer() {
         let mut buf = Buffer::default();
@@ -324,6 +633,39 @@ mod test {
         }
     }
 
+    #[test]
+    fn test_aggregate_buffer_having() {
+        let mut buf = Buffer::default();
+        let rd = RowDescription::new(&[Field::bigint("count"), Field::text("email")]);
+        let agg = Aggregate::new_count_group_by(0, &[1]);
+        let mut plan = AggregateRewritePlan::default();
+        plan.set_having(Having::new(vec![HavingCondition::new(
+            0,
+            HavingOp::Gt,
+            10.0,
+        )]));
+
+        // Each shard has fewer than 10 rows for the group,
+        // but the combined count passes HAVING.
+        for (email, count) in [("test@test.com", 6_i64), ("admin@test.com", 2)] {
+            for _ in 0..2 {
+                let mut dr = DataRow::new();
+                dr.add(count);
+                dr.add(email);
+                buf.add(dr.message().unwrap()).unwrap();
+            }
+        }
+
+        buf.aggregate(&agg, &Decoder::from(&rd), &plan).unwrap();
+        buf.full();
+
+        assert_eq!(buf.len(), 1);
+        let row = buf.take().unwrap();
+        let dr = DataRow::from_bytes(row.to_bytes()).unwrap();
+        assert_eq!(dr.get::<i64>(0, Format::Text).unwrap(), 12);
+        assert_eq!(dr.get::<String>(1, Format::Text).unwrap(), "test@test.com");
+    }
+
     #[test]
     fn test_sort_buffer_with_timestamps() {
         let mut buf = Buffer::default();
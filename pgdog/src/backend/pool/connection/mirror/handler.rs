@@ -88,7 +88,7 @@ impl MirrorHandler {
             }
             MirrorHandlerState::Idle => {
                 let roll = if self.config.exposure < 1.0 {
-                    rng().random_range(0.0..1.0)
+                    random::with_rng(|rng| rng.random_range(0.0..1.0))
                 } else {
                     0.99
                 };
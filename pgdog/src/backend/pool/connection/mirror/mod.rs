@@ -3,7 +3,7 @@
 use std::time::Duration;
 
 use pgdog_config::MirroringLevel;
-use rand::{Rng, rng};
+use rand::Rng;
 use tokio::select;
 use tokio::sync::mpsc::*;
 use tokio::time::{Instant, sleep};
@@ -16,6 +16,7 @@ use crate::frontend::client::query_engine::{QueryEngine, QueryEngineContext};
 use crate::frontend::client::timeouts::Timeouts;
 use crate::frontend::{ClientComms, PreparedStatements};
 use crate::net::{FrontendPid, Parameter, Parameters, Stream};
+use crate::random;
 use crate::tasks;
 
 use super::Error;
@@ -1,5 +1,6 @@
 //! Server connection requested by a frontend.
 
+use bytes::Bytes;
 use mirror::MirrorHandler;
 use pgdog_config::users::PasswordKind;
 use tokio::{select, time::sleep};
@@ -9,6 +10,7 @@ use crate::{
     admin::server::AdminServer,
     backend::{
         PubSubClient,
+        auth::auth_query,
         databases::{self, databases},
         pool, reload_notify,
     },
@@ -135,11 +137,17 @@ impl Connection {
     /// Try to get a connection for the given route.
     async fn try_conn(&mut self, request: &Request, route: &Route) -> Result<(), Error> {
         if let Shard::Direct(shard) = route.shard() {
-            let mut server = if route.is_read() {
-                self.cluster()?.replica(*shard, request).await?
+            let cluster = self.cluster()?;
+            let server = if route.is_read() {
+                cluster.replica(*shard, request).await
             } else {
-                self.cluster()?.primary(*shard, request).await?
+                cluster.primary(*shard, request).await
             };
+            let mut server = server.inspect_err(|_| {
+                if let Some(shard) = cluster.shards().get(*shard) {
+                    shard.error();
+                }
+            })?;
 
             // Cleanup session mode connections when
             // they are done.
@@ -157,11 +165,12 @@ impl Connection {
                 {
                     continue;
                 };
-                let mut server = if route.is_read() {
-                    shard.replica(request).await?
+                let server = if route.is_read() {
+                    shard.replica(request).await
                 } else {
-                    shard.primary(request).await?
+                    shard.primary(request).await
                 };
+                let mut server = server.inspect_err(|_| shard.error())?;
 
                 if self.session_mode() {
                     server.reset = true;
@@ -232,12 +241,34 @@ impl Connection {
             }
 
             // This is cancel-safe.
-            message = self.binding.read() => {
+            message = self.binding.read(self.cluster.as_ref()) => {
                 message
             }
         }
     }
 
+    /// Same as [`Self::read`], except large `DataRow` and `CopyData` messages
+    /// from a single server are returned in parts. The rest of the message
+    /// has to be read with [`Self::read_chunk`].
+    pub(crate) async fn read_partial(&mut self, threshold: usize) -> Result<Message, Error> {
+        select! {
+            notification = self.pub_sub.recv() => {
+                Ok(notification.ok_or(Error::ProtocolOutOfSync)?.message()?)
+            }
+
+            // This is cancel-safe.
+            message = self.binding.read_partial(self.cluster.as_ref(), threshold) => {
+                message
+            }
+        }
+    }
+
+    /// Read the next part of a message returned by [`Self::read_partial`],
+    /// `None` once it's been read completely.
+    pub(crate) async fn read_chunk(&mut self) -> Result<Option<Bytes>, Error> {
+        self.binding.read_chunk().await
+    }
+
     /// Subscribe to a channel.
     pub async fn listen(&mut self, channel: &str, shard: Shard) -> Result<(), Error> {
         let num = match shard {
@@ -361,8 +392,11 @@ impl Connection {
         // This happens on configuration reload (RELOAD/sighup), because we
         // only load databases from the config. RELOAD effectively removes all passthrough
         // connection pools until a client needs to query it and we re-create it.
+        // Users found with `auth_query` are removed the same way.
         //
-        if config.config.general.passthrough_auth()
+        let looked_up = auth_query::looked_up(&self.user, &self.database);
+
+        if (config.config.general.passthrough_auth() || looked_up)
             && databases().passwords(user).is_none()
             && let Some(ref cluster) = self.cluster
         {
@@ -386,7 +420,11 @@ impl Connection {
                 }
             }
 
-            databases::add(user)?;
+            if looked_up {
+                databases::add_looked_up(user)?;
+            } else {
+                databases::add(user)?;
+            }
         }
 
         let databases = databases();
@@ -437,6 +475,12 @@ impl Connection {
         }
     }
 
+    /// Reset the session state on the server connection(s)
+    /// before returning them to the pool.
+    pub(crate) fn mark_dirty(&mut self) {
+        self.binding.dirty();
+    }
+
     /// Check if this connection is locked to a client.
     #[cfg(test)]
     pub(crate) fn locked(&self) -> bool {
@@ -0,0 +1,116 @@
+//! Concatenate `COPY ... TO STDOUT` output from multiple shards.
+//!
+//! Each shard sends a complete COPY stream. With `HEADER`, each stream starts
+//! with the column names line, and binary streams start with the file header
+//! and end with the file trailer. The client should see one stream, so we only
+//! send the first header and one trailer at the end.
+
+use std::collections::HashSet;
+
+use crate::net::messages::{CopyData, FromBytes, Message, Protocol, ToBytes};
+
+use super::Error;
+
+/// Binary COPY file signature.
+const BINARY_SIGNATURE: &[u8] = b"PGCOPY\n\xff\r\n\0";
+/// Binary COPY file trailer: a row with -1 fields.
+const BINARY_TRAILER: &[u8] = &[0xff, 0xff];
+
+#[derive(Debug)]
+pub(super) struct CopyMerge {
+    /// The COPY uses the binary format.
+    binary: bool,
+    /// Text and CSV streams start with a header line.
+    headers: bool,
+    /// Shards that sent CopyData already.
+    started: HashSet<usize>,
+    /// The header was sent to the client.
+    header_sent: bool,
+}
+
+impl CopyMerge {
+    /// Create merge state from the first shard's CopyOutResponse (B).
+    pub(super) fn new(copy_out: &Message, headers: bool) -> Self {
+        // 'H', length, overall format.
+        let binary = copy_out.payload().get(5) == Some(&1);
+
+        Self {
+            binary,
+            headers,
+            started: HashSet::new(),
+            header_sent: false,
+        }
+    }
+
+    /// Check if the CopyData (B) message received from the shard at `position`
+    /// should be sent to the client, skipped, or modified.
+    pub(super) fn data(
+        &mut self,
+        position: usize,
+        message: Message,
+    ) -> Result<Option<Message>, Error> {
+        let first = self.started.insert(position);
+
+        if !self.binary {
+            if self.headers && first {
+                if self.header_sent {
+                    return Ok(None);
+                }
+                self.header_sent = true;
+            }
+
+            return Ok(Some(message));
+        }
+
+        let copy_data = CopyData::from_bytes(message.to_bytes())?;
+        let data = copy_data.data();
+
+        // Postgres sends the file header with the first row
+        // and the trailer on its own.
+        let mut skip = 0;
+        let mut keep = 0;
+        if first && let Some(len) = binary_header_len(data) {
+            if self.header_sent {
+                skip = len;
+            } else {
+                keep = len;
+                self.header_sent = true;
+            }
+        }
+
+        let (header, body) = data[skip..].split_at(keep);
+        let body = if body == BINARY_TRAILER {
+            &[][..]
+        } else {
+            body
+        };
+
+        if header.len() + body.len() == data.len() {
+            Ok(Some(message))
+        } else if header.is_empty() && body.is_empty() {
+            Ok(None)
+        } else {
+            Ok(Some(CopyData::new(&[header, body].concat()).message()?))
+        }
+    }
+
+    /// Binary file trailer, sent before the last CopyDone (B).
+    pub(super) fn trailer(&self) -> Result<Option<Message>, Error> {
+        if self.binary {
+            Ok(Some(CopyData::new(BINARY_TRAILER).message()?))
+        } else {
+            Ok(None)
+        }
+    }
+}
+
+/// Length of the binary file header at the start of `data`, if there is one.
+fn binary_header_len(data: &[u8]) -> Option<usize> {
+    let rest = data.strip_prefix(BINARY_SIGNATURE)?;
+    // Flags, then header extension length and the extension.
+    let extension = rest.get(4..8)?;
+    let extension = u32::from_be_bytes(extension.try_into().ok()?) as usize;
+    let len = BINARY_SIGNATURE.len() + 8 + extension;
+
+    (len <= data.len()).then_some(len)
+}
@@ -1,8 +1,12 @@
 //! Multi-shard connection state.
 
+use std::collections::HashMap;
+
+use bytes::Bytes;
 use context::Context;
 
 use crate::{
+    config::config,
     frontend::{PreparedStatements, router::Route},
     net::{
         BackendPid, Decoder, ReadyForQuery,
@@ -16,11 +20,13 @@ use crate::{
 use super::buffer::Buffer;
 
 mod context;
+mod copy_merge;
 mod error;
 #[cfg(test)]
 mod test;
 mod validator;
 
+use copy_merge::CopyMerge;
 pub use error::Error;
 use validator::Validator;
 
@@ -42,7 +48,11 @@ struct Counters {
     copy_done: usize,
     copy_out: usize,
     copy_data: usize,
+    copy_merge: Option<CopyMerge>,
+    copy_done_message: Option<Message>,
     first_backend_data: Option<BackendPid>,
+    notices: HashMap<(Bytes, usize), usize>,
+    notices_sent: HashMap<Bytes, usize>,
 }
 
 /// Multi-shard state.
@@ -65,6 +75,8 @@ pub struct MultiShard {
     decoder: Decoder,
     /// Row consistency validator.
     validator: Validator,
+    /// Return rows in shard order.
+    order_by_shard: bool,
 }
 
 impl MultiShard {
@@ -76,6 +88,7 @@ impl MultiShard {
             shard_indices,
             route: route.clone(),
             counters: Counters::default(),
+            order_by_shard: config().config.general.order_by_shard,
             ..Default::default()
         }
     }
@@ -114,7 +127,18 @@ impl MultiShard {
 
     /// Check if the message should be sent to the client, skipped,
     /// or modified.
+    #[cfg(test)]
     pub(super) fn forward(&mut self, message: Message) -> Result<Option<Message>, Error> {
+        self.forward_from(0, message)
+    }
+
+    /// Check if the message received from the server at `position`
+    /// should be sent to the client, skipped, or modified.
+    pub(super) fn forward_from(
+        &mut self,
+        position: usize,
+        message: Message,
+    ) -> Result<Option<Message>, Error> {
         let mut forward = None;
 
         match message.code() {
@@ -156,6 +180,11 @@ impl MultiShard {
                 };
                 self.counters.command_complete_count += 1;
 
+                let merge = self.should_buffer() && self.should_merge();
+                if merge {
+                    self.buffer.merge_done(position, &self.decoder);
+                }
+
                 if self
                     .counters
                     .command_complete_count
@@ -163,7 +192,8 @@ impl MultiShard {
                 {
                     self.buffer.full();
 
-                    if !self.buffer.is_empty() {
+                    // Merged rows are already sorted, deduplicated and limited.
+                    if !merge && !self.buffer.is_empty() {
                         self.buffer
                             .aggregate(
                                 self.route.aggregate(),
@@ -178,7 +208,9 @@ impl MultiShard {
                     }
 
                     if has_rows {
-                        let rows = if self.should_buffer() {
+                        let rows = if merge {
+                            self.buffer.merged()
+                        } else if self.should_buffer() {
                             self.buffer.len()
                         } else {
                             self.counters.rows
@@ -251,6 +283,20 @@ impl MultiShard {
                     } else {
                         forward = Some(message);
                     }
+                } else if self.should_merge() {
+                    self.buffer.start_merge(
+                        self.shards,
+                        self.route.order_by(),
+                        self.route.distinct(),
+                        self.route.limit(),
+                    );
+                    self.buffer
+                        .merge_row(position, message, &self.decoder)
+                        .map_err(Error::from)?;
+                } else if self.order_by_shard {
+                    self.buffer
+                        .add_shard(self.shard_index(position), message)
+                        .map_err(Error::from)?;
                 } else {
                     self.buffer.add(message).map_err(Error::from)?;
                 }
@@ -295,17 +341,36 @@ impl MultiShard {
             'c' => {
                 self.counters.copy_done += 1;
                 if self.counters.copy_done.is_multiple_of(self.shards) {
-                    forward = Some(message);
+                    // Binary COPY needs its trailer before CopyDone.
+                    let trailer = match self.counters.copy_merge.as_ref() {
+                        Some(copy_merge) => copy_merge.trailer()?,
+                        None => None,
+                    };
+                    if let Some(trailer) = trailer {
+                        self.counters.copy_done_message = Some(message);
+                        forward = Some(trailer);
+                    } else {
+                        forward = Some(message);
+                    }
                 }
             }
 
             'd' => {
                 self.counters.copy_data += 1;
-                forward = Some(message);
+                forward = match self.counters.copy_merge.as_mut() {
+                    Some(copy_merge) => copy_merge.data(position, message)?,
+                    None => Some(message),
+                };
             }
 
             'H' => {
                 self.counters.copy_out += 1;
+                // Each shard sends its own COPY stream,
+                // which we concatenate.
+                if self.shards > 1 && self.counters.copy_merge.is_none() {
+                    self.counters.copy_merge =
+                        Some(CopyMerge::new(&message, self.route.copy_headers()));
+                }
                 if self.counters.copy_out.is_multiple_of(self.shards) {
                     forward = Some(message);
                 }
@@ -322,6 +387,28 @@ impl MultiShard {
                 }
             }
 
+            // Each shard sends the same notice, e.g. for
+            // DROP TABLE IF EXISTS. Send it to the client once.
+            // A shard can send the same notice more than once,
+            // e.g. RAISE NOTICE in a loop, so count them per shard
+            // and only skip the ones another shard already sent.
+            'N' => {
+                let payload = message.payload();
+                let received = self
+                    .counters
+                    .notices
+                    .entry((payload.clone(), position))
+                    .or_default();
+                *received += 1;
+                let received = *received;
+
+                let sent = self.counters.notices_sent.entry(payload).or_default();
+                if received > *sent {
+                    *sent += 1;
+                    forward = Some(message);
+                }
+            }
+
             _ => forward = Some(message),
         }
 
@@ -335,14 +422,29 @@ impl MultiShard {
         // 2. The route contains transformations we need to perform, e.g., aggregates, sorting, etc.
         // 3. The route does not concern omnisharded tables which have the same data on all shards
         //    anyway.
-        self.shards > 1 && self.route.should_buffer() && !self.route.is_omnisharded()
+        self.shards > 1
+            && (self.route.should_buffer() || self.order_by_shard)
+            && !self.route.is_omnisharded()
+    }
+
+    /// Return true if rows from each shard are already sorted by the ORDER BY
+    /// columns and only need to be merged as they arrive. Aggregates combine
+    /// rows from different shards, so their results have to be sorted again.
+    fn should_merge(&self) -> bool {
+        !self.order_by_shard
+            && !self.route.order_by().is_empty()
+            && self.route.aggregate().is_empty()
     }
 
     /// Multi-shard state is ready to send messages.
     pub(super) fn message(&mut self) -> Option<Message> {
         match self.buffer.take() {
             Some(data_row) => Some(data_row),
-            _ => self.counters.command_complete.take(),
+            _ => self
+                .counters
+                .copy_done_message
+                .take()
+                .or_else(|| self.counters.command_complete.take()),
         }
     }
 
@@ -1,6 +1,6 @@
 use crate::{
     frontend::router::parser::{Shard, ShardWithPriority},
-    net::{DataRow, Field},
+    net::{CopyData, CopyDone, DataRow, ErrorResponse, Field, NoticeResponse},
 };
 
 use super::*;
@@ -267,3 +267,226 @@ fn test_omni_data_rows_only_from_first_server() {
         .unwrap();
     assert!(result.is_some()); // Should be forwarded
 }
+
+#[test]
+fn test_order_by_shard() {
+    let mut multi_shard = MultiShard::new(
+        vec![0, 1],
+        &Route::read(ShardWithPriority::new_default_unset(Shard::All)),
+    );
+    multi_shard.order_by_shard = true;
+
+    let rd = RowDescription::new(&[Field::bigint("id")]);
+    for position in [1, 0] {
+        multi_shard
+            .forward_from(position, rd.message().unwrap())
+            .unwrap();
+    }
+
+    // Rows arrive interleaved.
+    for (position, id) in [(1, 10_i64), (0, 1), (1, 11), (0, 2)] {
+        let mut dr = DataRow::new();
+        dr.add(id);
+        let result = multi_shard
+            .forward_from(position, dr.message().unwrap())
+            .unwrap();
+        assert!(result.is_none()); // buffered
+    }
+
+    for position in [1, 0] {
+        let result = multi_shard
+            .forward_from(
+                position,
+                CommandComplete::from_str("SELECT 2").message().unwrap(),
+            )
+            .unwrap();
+        assert!(result.is_none());
+    }
+
+    let mut ids = vec![];
+    while let Some(message) = multi_shard.message() {
+        if message.code() == 'D' {
+            let dr = DataRow::from_bytes(message.to_bytes()).unwrap();
+            ids.push(dr.get::<i64>(0, crate::net::Format::Text).unwrap());
+        } else {
+            assert_eq!(message.code(), 'C');
+        }
+    }
+
+    assert_eq!(ids, vec![1, 2, 10, 11]);
+}
+
+/// CopyOutResponse (B) with one column.
+fn copy_out_response(binary: bool) -> Message {
+    use bytes::{BufMut, BytesMut};
+
+    let format = if binary { 1 } else { 0 };
+    let mut payload = BytesMut::new();
+    payload.put_u8(b'H');
+    payload.put_i32(4 + 1 + 2 + 2);
+    payload.put_i8(format);
+    payload.put_i16(1);
+    payload.put_i16(format as i16);
+    Message::new(payload.freeze())
+}
+
+fn copy_data(data: &[u8]) -> Message {
+    CopyData::new(data).message().unwrap()
+}
+
+#[test]
+fn test_copy_out_csv_header_once() {
+    let route = Route::read(ShardWithPriority::new_table(Shard::All)).with_copy_headers(true);
+    let mut multi_shard = MultiShard::new(vec![0, 1], &route);
+
+    assert!(
+        multi_shard
+            .forward_from(0, copy_out_response(false))
+            .unwrap()
+            .is_none()
+    );
+    let result = multi_shard
+        .forward_from(1, copy_out_response(false))
+        .unwrap();
+    assert_eq!(result.unwrap().code(), 'H');
+
+    let mut sent = vec![];
+    for (position, line) in [(0, "id\n"), (0, "1\n"), (1, "id\n"), (1, "2\n"), (1, "3\n")] {
+        if let Some(message) = multi_shard
+            .forward_from(position, copy_data(line.as_bytes()))
+            .unwrap()
+        {
+            let data = CopyData::from_bytes(message.to_bytes()).unwrap();
+            sent.push(String::from_utf8(data.data().to_vec()).unwrap());
+        }
+    }
+    assert_eq!(sent, vec!["id\n", "1\n", "2\n", "3\n"]);
+
+    for position in [0, 1] {
+        let result = multi_shard
+            .forward_from(position, CopyDone.message().unwrap())
+            .unwrap();
+        assert_eq!(
+            result.map(|message| message.code()),
+            (position == 1).then_some('c')
+        );
+    }
+    assert!(multi_shard.message().is_none());
+}
+
+#[test]
+fn test_copy_out_binary_header_and_trailer_once() {
+    let route = Route::read(ShardWithPriority::new_table(Shard::All)).with_copy_headers(true);
+    let mut multi_shard = MultiShard::new(vec![0, 1, 2], &route);
+
+    for position in [0, 1, 2] {
+        multi_shard
+            .forward_from(position, copy_out_response(true))
+            .unwrap();
+    }
+
+    let header = b"PGCOPY\n\xff\r\n\0\0\0\0\0\0\0\0\0".to_vec();
+    let row = |id: u8| vec![0, 1, 0, 0, 0, 1, id];
+    let trailer = vec![0xff, 0xff];
+
+    let mut sent = vec![];
+    for (position, data) in [
+        (0, [header.clone(), row(1)].concat()),
+        (0, trailer.clone()),
+        // Empty result: header and trailer in one message.
+        (1, [header.clone(), trailer.clone()].concat()),
+        (2, [header.clone(), row(2)].concat()),
+        (2, row(3)),
+        (2, trailer.clone()),
+    ] {
+        if let Some(message) = multi_shard
+            .forward_from(position, copy_data(&data))
+            .unwrap()
+        {
+            let data = CopyData::from_bytes(message.to_bytes()).unwrap();
+            sent.push(data.data().to_vec());
+        }
+    }
+    assert_eq!(sent, vec![[header, row(1)].concat(), row(2), row(3)]);
+
+    for position in [0, 1] {
+        let result = multi_shard
+            .forward_from(position, CopyDone.message().unwrap())
+            .unwrap();
+        assert!(result.is_none());
+    }
+
+    // The trailer is sent once, right before CopyDone.
+    let result = multi_shard
+        .forward_from(2, CopyDone.message().unwrap())
+        .unwrap()
+        .unwrap();
+    let data = CopyData::from_bytes(result.to_bytes()).unwrap();
+    assert_eq!(data.data(), &trailer[..]);
+    assert_eq!(multi_shard.message().unwrap().code(), 'c');
+    assert!(multi_shard.message().is_none());
+}
+
+#[test]
+fn test_notices_sent_once() {
+    let route = Route::default();
+    let mut multi_shard = MultiShard::new(vec![0, 1, 2], &route);
+
+    let notice = |message: &str| {
+        NoticeResponse::from(ErrorResponse {
+            severity: "NOTICE".into(),
+            code: "00000".into(),
+            message: message.into(),
+            ..Default::default()
+        })
+        .message()
+        .unwrap()
+    };
+
+    let skipping = "table \"users\" does not exist, skipping";
+    let forwarded = (0..3)
+        .filter_map(|shard| multi_shard.forward_from(shard, notice(skipping)).unwrap())
+        .count();
+    assert_eq!(forwarded, 1);
+
+    // Different notices are all sent.
+    let forwarded = (0..3)
+        .filter_map(|shard| {
+            multi_shard
+                .forward_from(shard, notice(&format!("shard {}", shard)))
+                .unwrap()
+        })
+        .count();
+    assert_eq!(forwarded, 3);
+
+    // The same notice from the next statement is sent again.
+    assert!(
+        multi_shard
+            .forward_from(0, notice(skipping))
+            .unwrap()
+            .is_some()
+    );
+}
+
+#[test]
+fn test_repeated_notices_sent_per_shard() {
+    let route = Route::default();
+    let mut multi_shard = MultiShard::new(vec![0, 1], &route);
+
+    let notice = NoticeResponse::from(ErrorResponse {
+        severity: "NOTICE".into(),
+        code: "00000".into(),
+        message: "loop".into(),
+        ..Default::default()
+    })
+    .message()
+    .unwrap();
+
+    // Each shard raises the notice 3 times, e.g. in a loop.
+    // The client gets it 3 times, like from one shard.
+    let forwarded = [0, 0, 1, 0, 1, 1]
+        .into_iter()
+        .filter_map(|shard| multi_shard.forward_from(shard, notice.clone()).unwrap())
+        .count();
+    assert_eq!(forwarded, 3);
+}
@@ -0,0 +1,195 @@
+//! Checks shared by pools connecting to the same server.
+//!
+//! Pools for different users often point at the same host and database. Health checks
+//! and LSN checks probe the server, not the user, so a recent result from any pool
+//! connected to the same endpoint can be reused instead of querying the server again.
+//!
+//! Only successful health checks are shared, and only pools that passed their own
+//! last check use them. A failure can be specific to the pool, e.g. a wrong password,
+//! so a failing pool keeps checking the server until it passes on its own.
+
+use std::collections::HashMap;
+use std::time::{Duration, SystemTime};
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use tokio::time::Instant;
+
+use super::{Address, LsnStats};
+
+static ENDPOINTS: Lazy<Mutex<HashMap<Endpoint, Checks>>> = Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// Physical database, independent of the user connecting to it.
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+pub(super) struct Endpoint {
+    host: String,
+    port: u16,
+    database_name: String,
+}
+
+/// Latest check results for an endpoint.
+#[derive(Debug, Default, Clone, Copy)]
+struct Checks {
+    /// Pools using the endpoint.
+    pools: usize,
+    healthcheck: Option<Instant>,
+    lsn_stats: Option<LsnStats>,
+}
+
+impl From<&Address> for Endpoint {
+    fn from(addr: &Address) -> Self {
+        Self {
+            host: addr.host.clone(),
+            port: addr.port,
+            database_name: addr.database_name.clone(),
+        }
+    }
+}
+
+impl Endpoint {
+    /// Share checks of this endpoint with a pool until
+    /// the returned guard is dropped, e.g. on pool shutdown.
+    /// Results are forgotten once no pool uses the endpoint.
+    pub(super) fn register(&self) -> EndpointGuard {
+        ENDPOINTS.lock().entry(self.clone()).or_default().pools += 1;
+
+        EndpointGuard {
+            endpoint: self.clone(),
+        }
+    }
+
+    /// A pool connected to this endpoint passed a health check
+    /// less than `max_age` ago.
+    pub(super) fn healthy(&self, max_age: Duration) -> bool {
+        ENDPOINTS
+            .lock()
+            .get(self)
+            .and_then(|checks| checks.healthcheck)
+            .is_some_and(|checked_at| checked_at.elapsed() < max_age)
+    }
+
+    /// Record a successful health check.
+    pub(super) fn record_healthcheck(&self) {
+        if let Some(checks) = ENDPOINTS.lock().get_mut(self) {
+            checks.healthcheck = Some(Instant::now());
+        }
+    }
+
+    /// LSN stats fetched by any pool less than `max_age` ago.
+    pub(super) fn lsn_stats(&self, max_age: Duration) -> Option<LsnStats> {
+        let now = SystemTime::now();
+
+        ENDPOINTS
+            .lock()
+            .get(self)
+            .and_then(|checks| checks.lsn_stats)
+            .filter(|stats| stats.lsn_age(now) < max_age)
+    }
+
+    /// Record LSN stats fetched from the server.
+    pub(super) fn record_lsn_stats(&self, stats: LsnStats) {
+        if let Some(checks) = ENDPOINTS.lock().get_mut(self) {
+            checks.lsn_stats = Some(stats);
+        }
+    }
+}
+
+/// Pool registered with an [`Endpoint`].
+#[derive(Debug)]
+pub(super) struct EndpointGuard {
+    endpoint: Endpoint,
+}
+
+impl Drop for EndpointGuard {
+    fn drop(&mut self) {
+        let mut endpoints = ENDPOINTS.lock();
+
+        if let Some(checks) = endpoints.get_mut(&self.endpoint) {
+            checks.pools = checks.pools.saturating_sub(1);
+
+            if checks.pools == 0 {
+                endpoints.remove(&self.endpoint);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    fn endpoint(host: &str) -> Endpoint {
+        Endpoint::from(&Address {
+            host: host.into(),
+            port: 5432,
+            database_name: "pgdog".into(),
+            user: "pgdog".into(),
+            ..Default::default()
+        })
+    }
+
+    #[test]
+    fn test_endpoint_ignores_user() {
+        let addr = Address {
+            host: "127.0.0.1".into(),
+            port: 5432,
+            database_name: "pgdog".into(),
+            user: "pgdog".into(),
+            ..Default::default()
+        };
+        let other = Address {
+            user: "pgdog_2".into(),
+            ..addr.clone()
+        };
+
+        assert_eq!(Endpoint::from(&addr), Endpoint::from(&other));
+    }
+
+    #[tokio::test]
+    async fn test_shared_healthcheck() {
+        let endpoint = endpoint("endpoint-healthcheck.internal");
+        let _guard = endpoint.register();
+        assert!(!endpoint.healthy(Duration::from_secs(5)));
+
+        endpoint.record_healthcheck();
+        assert!(endpoint.healthy(Duration::from_secs(5)));
+        assert!(!endpoint.healthy(Duration::ZERO));
+    }
+
+    #[test]
+    fn test_shared_lsn_stats() {
+        let endpoint = endpoint("endpoint-lsn.internal");
+        let _guard = endpoint.register();
+        assert!(endpoint.lsn_stats(Duration::from_secs(5)).is_none());
+
+        let mut stats = LsnStats::default();
+        stats.fetched = SystemTime::now();
+        stats.replica = true;
+        endpoint.record_lsn_stats(stats);
+
+        let shared = endpoint.lsn_stats(Duration::from_secs(5)).unwrap();
+        assert!(shared.replica);
+        assert!(endpoint.lsn_stats(Duration::ZERO).is_none());
+    }
+
+    #[test]
+    fn test_endpoint_pruned() {
+        let endpoint = endpoint("endpoint-pruned.internal");
+        let mut stats = LsnStats::default();
+        stats.fetched = SystemTime::now();
+
+        // Not used by any pool.
+        endpoint.record_lsn_stats(stats);
+        assert!(endpoint.lsn_stats(Duration::from_secs(5)).is_none());
+
+        let first = endpoint.register();
+        let second = endpoint.register();
+        endpoint.record_lsn_stats(stats);
+
+        drop(first);
+        assert!(endpoint.lsn_stats(Duration::from_secs(5)).is_some());
+
+        drop(second);
+        assert!(!ENDPOINTS.lock().contains_key(&endpoint));
+    }
+}
@@ -76,6 +76,9 @@ pub enum Error {
 
     #[error("replica lag")]
     ReplicaLag,
+
+    #[error("too many clients waiting for a connection, max_waiting_clients is {0}")]
+    TooManyWaiting(usize),
 }
 
 impl Error {
@@ -100,6 +103,19 @@ impl Error {
                 | Self::FastShutdown
         )
     }
+
+    /// The server can't be reached or failed a health check,
+    /// as opposed to being busy.
+    pub fn is_down(&self) -> bool {
+        matches!(
+            self,
+            Self::ConnectTimeout
+                | Self::ServerError
+                | Self::HealthcheckTimeout
+                | Self::HealthcheckError
+                | Self::PoolUnhealthy
+        )
+    }
 }
 
 #[cfg(test)]
@@ -123,6 +139,7 @@ mod tests {
         assert!(Error::Offline.is_retryable());
         assert!(Error::ReplicaLag.is_retryable());
         assert!(Error::PoolUnhealthy.is_retryable());
+        assert!(Error::TooManyWaiting(10).is_retryable());
     }
 
     #[test]
@@ -134,4 +151,17 @@ mod tests {
         assert!(!Error::FastShutdown.is_retryable());
         assert!(!Error::NoShard(0).is_retryable());
     }
+
+    #[test]
+    fn down() {
+        assert!(Error::ConnectTimeout.is_down());
+        assert!(Error::ServerError.is_down());
+        assert!(Error::HealthcheckTimeout.is_down());
+        assert!(Error::HealthcheckError.is_down());
+        assert!(Error::PoolUnhealthy.is_down());
+        assert!(!Error::CheckoutTimeout.is_down());
+        assert!(!Error::ReplicaCheckoutTimeout.is_down());
+        assert!(!Error::TooManyWaiting(10).is_down());
+        assert!(!Error::Offline.is_down());
+    }
 }
@@ -0,0 +1,291 @@
+//! Fair sharing of server connections between tenants.
+//!
+//! Clients sharing a pool are grouped into tenants by the startup parameter
+//! named by `fair_share_tenant`, `application_name` by default. The value
+//! the client connected with is used, so it can't escape its tenant's share
+//! with `SET`.
+//! We keep track of how long each tenant held server connections during
+//! a rolling window and, when clients are waiting for a connection, serve
+//! the tenant that used them the least first. Under contention, every tenant
+//! gets an equal slice of the pool's time, no matter how long its transactions are.
+
+use std::{collections::VecDeque, sync::Arc, time::Duration};
+
+use fnv::FnvHashMap as HashMap;
+use pgdog_config::{Priority, QueueOrder};
+use tokio::time::Instant;
+
+use crate::net::BackendPid;
+
+use super::Waiter;
+
+/// Number of slices the window is divided into.
+const SLICES: u32 = 10;
+
+/// Server connection usage of a tenant during the window.
+#[derive(Debug, Clone, PartialEq)]
+pub struct TenantShare {
+    /// Tenant name, i.e. the `fair_share_tenant` parameter of its clients.
+    pub tenant: Option<Arc<str>>,
+    /// Server connections held by the tenant right now.
+    pub checked_out: usize,
+    /// Clients of the tenant waiting for a server connection.
+    pub waiting: usize,
+    /// Time spent using server connections.
+    pub used: Duration,
+    /// Fraction of the time used by all tenants, between 0 and 1.
+    pub share: f64,
+}
+
+/// Time a tenant spent using server connections, bucketed into slices.
+#[derive(Debug, Default, Clone)]
+struct Usage {
+    slices: VecDeque<(Instant, Duration)>,
+}
+
+impl Usage {
+    fn record(&mut self, used: Duration, window: Duration, now: Instant) {
+        let slice = window / SLICES;
+
+        match self.slices.back_mut() {
+            Some((start, total)) if now.duration_since(*start) < slice => *total += used,
+            _ => self.slices.push_back((now, used)),
+        }
+    }
+
+    /// Drop slices that fell out of the window.
+    fn expire(&mut self, window: Duration, now: Instant) {
+        while let Some((start, _)) = self.slices.front() {
+            if now.duration_since(*start) < window {
+                break;
+            }
+            self.slices.pop_front();
+        }
+    }
+
+    fn used(&self) -> Duration {
+        self.slices.iter().map(|(_, used)| *used).sum()
+    }
+}
+
+/// Server connection usage of all tenants in a pool.
+#[derive(Debug, Default, Clone)]
+pub(super) struct FairShare {
+    tenants: HashMap<Option<Arc<str>>, Usage>,
+    /// Server connections checked out right now,
+    /// with their tenant and the time they were checked out.
+    checkouts: HashMap<BackendPid, (Option<Arc<str>>, Instant)>,
+}
+
+impl FairShare {
+    /// Server connection was given to a client.
+    pub(super) fn checkout(&mut self, tenant: Option<Arc<str>>, server: BackendPid, now: Instant) {
+        self.checkouts.insert(server, (tenant, now));
+    }
+
+    /// Server connection was returned to the pool.
+    pub(super) fn checkin(&mut self, server: BackendPid, window: Duration, now: Instant) {
+        if let Some((tenant, checked_out_at)) = self.checkouts.remove(&server) {
+            let used = now.duration_since(checked_out_at).min(window);
+            self.tenants
+                .entry(tenant)
+                .or_default()
+                .record(used, window, now);
+        }
+    }
+
+    /// Forget connections that are now checked out from another pool.
+    pub(super) fn clear(&mut self) {
+        self.checkouts.clear();
+    }
+
+    /// Pick the waiting client with this priority whose tenant used server
+    /// connections the least. Clients of the same tenant are served in queue order.
+    pub(super) fn next(
+        &mut self,
+        waiting: &VecDeque<Waiter>,
+        priority: Priority,
+        order: QueueOrder,
+        window: Duration,
+        now: Instant,
+    ) -> Option<usize> {
+        let usage = self.usage(window, now);
+
+        waiting
+            .iter()
+            .enumerate()
+            .filter(|(_, waiter)| waiter.request.priority == priority)
+            .min_by_key(|(position, waiter)| {
+                let used = usage
+                    .get(&waiter.request.tenant)
+                    .map(|(used, _)| *used)
+                    .unwrap_or_default();
+                let position = match order {
+                    QueueOrder::Fifo => *position,
+                    QueueOrder::Lifo => waiting.len() - position,
+                };
+
+                (used, position)
+            })
+            .map(|(position, _)| position)
+    }
+
+    /// Usage of each tenant, for SHOW FAIR_SHARE.
+    pub(super) fn shares(
+        &mut self,
+        waiting: &VecDeque<Waiter>,
+        window: Duration,
+        now: Instant,
+    ) -> Vec<TenantShare> {
+        let mut usage = self.usage(window, now);
+
+        for waiter in waiting {
+            usage.entry(waiter.request.tenant.clone()).or_default();
+        }
+
+        let total: Duration = usage.values().map(|(used, _)| *used).sum();
+
+        let mut shares = usage
+            .into_iter()
+            .map(|(tenant, (used, checked_out))| TenantShare {
+                waiting: waiting
+                    .iter()
+                    .filter(|waiter| waiter.request.tenant == tenant)
+                    .count(),
+                tenant,
+                checked_out,
+                used,
+                share: if total.is_zero() {
+                    0.0
+                } else {
+                    used.as_secs_f64() / total.as_secs_f64()
+                },
+            })
+            .collect::<Vec<_>>();
+
+        shares.sort_by(|a, b| a.tenant.cmp(&b.tenant));
+
+        shares
+    }
+
+    /// Time each tenant spent using server connections during the window,
+    /// including connections it's holding right now, and how many
+    /// connections it's holding.
+    fn usage(
+        &mut self,
+        window: Duration,
+        now: Instant,
+    ) -> HashMap<Option<Arc<str>>, (Duration, usize)> {
+        self.tenants.retain(|_, usage| {
+            usage.expire(window, now);
+            !usage.slices.is_empty()
+        });
+
+        let mut usage = self
+            .tenants
+            .iter()
+            .map(|(tenant, usage)| (tenant.clone(), (usage.used(), 0)))
+            .collect::<HashMap<_, _>>();
+
+        for (tenant, checked_out_at) in self.checkouts.values() {
+            let (used, checked_out) = usage.entry(tenant.clone()).or_default();
+            *used += now.duration_since(*checked_out_at).min(window);
+            *checked_out += 1;
+        }
+
+        usage
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use tokio::sync::oneshot::channel;
+
+    use super::*;
+    use crate::{backend::pool::Request, net::messages::FrontendPid};
+
+    fn waiter(tenant: &str) -> Waiter {
+        let (tx, _) = channel();
+
+        Waiter {
+            request: Request::new(FrontendPid::new(), false).tenant(Some(tenant.into())),
+            tx,
+        }
+    }
+
+    #[test]
+    fn test_least_used_tenant_first() {
+        let window = Duration::from_secs(60);
+        let now = Instant::now();
+        let mut fair_share = FairShare::default();
+
+        // Tenant "a" ran a long transaction, "b" a short one.
+        fair_share.checkout(Some("a".into()), BackendPid::for_test(1), now);
+        fair_share.checkout(Some("b".into()), BackendPid::for_test(2), now);
+        fair_share.checkin(
+            BackendPid::for_test(2),
+            window,
+            now + Duration::from_millis(10),
+        );
+        fair_share.checkin(
+            BackendPid::for_test(1),
+            window,
+            now + Duration::from_secs(5),
+        );
+
+        let now = now + Duration::from_secs(5);
+        let waiting = VecDeque::from([waiter("a"), waiter("a"), waiter("b")]);
+
+        assert_eq!(
+            fair_share.next(&waiting, Priority::Normal, QueueOrder::Fifo, window, now),
+            Some(2)
+        );
+
+        // Same tenant, queue order decides.
+        let waiting = VecDeque::from([waiter("a"), waiter("a")]);
+        assert_eq!(
+            fair_share.next(&waiting, Priority::Normal, QueueOrder::Fifo, window, now),
+            Some(0)
+        );
+        assert_eq!(
+            fair_share.next(&waiting, Priority::Normal, QueueOrder::Lifo, window, now),
+            Some(1)
+        );
+
+        let shares = fair_share.shares(&waiting, window, now);
+        assert_eq!(shares.len(), 2);
+        assert_eq!(shares[0].tenant.as_deref(), Some("a"));
+        assert_eq!(shares[0].waiting, 2);
+        assert_eq!(shares[1].used, Duration::from_millis(10));
+        assert!(shares[0].share > 0.99);
+
+        // Usage expires with the window.
+        let later = now + window;
+        assert!(
+            fair_share
+                .shares(&VecDeque::new(), window, later)
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn test_held_connections_count() {
+        let window = Duration::from_secs(60);
+        let now = Instant::now();
+        let mut fair_share = FairShare::default();
+
+        fair_share.checkout(Some("a".into()), BackendPid::for_test(1), now);
+
+        let now = now + Duration::from_secs(1);
+        let waiting = VecDeque::from([waiter("a"), waiter("b")]);
+
+        assert_eq!(
+            fair_share.next(&waiting, Priority::Normal, QueueOrder::Fifo, window, now),
+            Some(1)
+        );
+
+        let shares = fair_share.shares(&waiting, window, now);
+        assert_eq!(shares[0].checked_out, 1);
+        assert_eq!(shares[0].used, Duration::from_secs(1));
+    }
+}
@@ -9,6 +9,7 @@ use tracing::{debug, error};
 
 use crate::backend::{Error, Server};
 use crate::state::State;
+use crate::util::escape_identifier;
 
 use super::{Pool, cleanup::Cleanup};
 
@@ -157,6 +158,15 @@ impl Guard {
             );
             server.execute_batch(cleanup.queries()).await?;
 
+            // DISCARD ALL resets the role set at startup.
+            if cleanup.is_reset()
+                && let Some(role) = server.addr().server_role.clone()
+            {
+                server
+                    .execute(format!(r#"SET ROLE "{}""#, escape_identifier(&role)))
+                    .await?;
+            }
+
             if cleanup.is_deallocate() {
                 server.prepared_statements_mut().clear();
             }
@@ -55,8 +55,13 @@ impl<'a> Healtcheck<'a> {
             return Ok(());
         }
 
+        let started = Instant::now();
+
         match timeout(self.healthcheck_timeout, self.conn.healthcheck(";")).await {
-            Ok(Ok(())) => Ok(()),
+            Ok(Ok(())) => {
+                self.pool.inner().health.record_latency(started.elapsed());
+                Ok(())
+            }
             Ok(Err(err)) => {
                 // Check if this is an administrator command termination
                 if Self::is_admin_termination(&err) {
@@ -3,14 +3,20 @@
 use std::cmp::max;
 use std::collections::VecDeque;
 use std::fmt::Display;
+use std::time::Duration;
 
 use crate::backend::{ConnectReason, DisconnectReason};
 use crate::backend::{Server, stats::Counts as BackendCounts};
-use crate::net::messages::{BackendKeyData, FrontendPid};
+use crate::net::messages::{BackendKeyData, BackendPid, FrontendPid};
 
+use fnv::FnvHashSet as HashSet;
+use pgdog_config::{Priority, QueueOrder};
 use tokio::time::Instant;
 
-use super::{Config, Error, Oids, Pool, Request, Stats, Taken, Waiter, lsn_monitor::ReplicaLag};
+use super::{
+    Autoscaler, Config, Error, FairShare, Oids, Pool, Request, ScalingEvent, Stats, Taken,
+    TenantShare, Waiter, autoscale::Sample, lsn_monitor::ReplicaLag,
+};
 
 /// Pool internals protected by a mutex.
 #[derive(Default)]
@@ -20,8 +26,20 @@ pub(super) struct Inner {
     idle_connections: Vec<Box<Server>>,
     /// Server connections currently checked out.
     taken: Taken,
+    /// Server connection usage by tenant.
+    fair_share: FairShare,
+    /// Server connections checked out by low priority clients.
+    low_priority: HashSet<BackendPid>,
+    /// Checked out server connections killed by `KILL SERVER`,
+    /// closed when they are returned.
+    killed: HashSet<BackendPid>,
     /// Pool configuration.
     pub(super) config: Config,
+    /// Pool size from the config, which the autoscaler
+    /// doesn't shrink the pool below.
+    pool_size: usize,
+    /// Pool autoscaler.
+    pub(super) autoscaler: Autoscaler,
     /// Number of clients waiting for a connection.
     pub(super) waiting: VecDeque<Waiter>,
     /// Pool is online and available to clients.
@@ -51,6 +69,10 @@ pub(super) struct Inner {
     /// Bumped each time Vault credentials rotate. Connections stamped with
     /// an older generation are closed on check-in rather than reused.
     pub(super) credentials_generation: u64,
+    /// Number of connections to open in the background, e.g. to replace
+    /// the idle connections of the pool this one replaced on RELOAD.
+    /// Reset once the pool has that many.
+    pub(super) prewarm: usize,
 }
 
 impl std::fmt::Debug for Inner {
@@ -71,6 +93,11 @@ impl Inner {
         Self {
             idle_connections: Vec::new(),
             taken: Taken::default(),
+            fair_share: FairShare::default(),
+            low_priority: HashSet::default(),
+            killed: HashSet::default(),
+            pool_size: config.max,
+            autoscaler: Autoscaler::default(),
             config,
             waiting: VecDeque::new(),
             online: false,
@@ -85,6 +112,7 @@ impl Inner {
             id,
             replica_lag: ReplicaLag::default(),
             credentials_generation: 0,
+            prewarm: 0,
         }
     }
     /// Total number of connections managed by the pool.
@@ -129,6 +157,24 @@ impl Inner {
         self.taken.cancel_keys()
     }
 
+    /// Close the server connection, e.g. with `KILL SERVER`. Idle connections
+    /// are closed immediately, checked out ones when they are returned.
+    pub(super) fn kill(&mut self, pid: i32) -> Option<Kill> {
+        if let Some((server, frontend)) = self.taken.find(pid) {
+            self.killed.insert(server);
+            return Some(Kill::CheckedOut(frontend));
+        }
+
+        let index = self
+            .idle_connections
+            .iter()
+            .position(|conn| conn.id().pid() == pid)?;
+        let mut conn = self.idle_connections.remove(index);
+        conn.disconnect_reason(DisconnectReason::Killed);
+
+        Some(Kill::Closed)
+    }
+
     /// How many connections can be removed from the pool
     /// without affecting the minimum connection requirement.
     #[inline]
@@ -160,6 +206,7 @@ impl Inner {
         let client_needs =
             below_max && !self.waiting.is_empty() && self.idle_connections.is_empty();
         let maintenance_on = self.online && !self.paused;
+        let prewarm = below_max && self.total() < self.prewarm;
 
         // Clients from banned pools won't be able to request connections
         // unless it's a primary.
@@ -167,6 +214,8 @@ impl Inner {
             ConnectReason::ClientWaiting
         } else if maintenance_on && maintain_min {
             ConnectReason::BelowMin
+        } else if maintenance_on && prewarm {
+            ConnectReason::Prewarm
         } else {
             return ShouldCreate::No;
         };
@@ -230,6 +279,42 @@ impl Inner {
         removed
     }
 
+    /// Resize the pool based on how long clients waited for connections
+    /// and how many were in use, if autoscaling is enabled.
+    pub(super) fn autoscale(&mut self, period: Duration) -> Option<ScalingEvent> {
+        let max = self.config.autoscale_max?;
+
+        if !self.online || self.paused {
+            return None;
+        }
+
+        let sample = Sample {
+            size: self.max(),
+            wait_p95: self.stats.recent_wait_histogram.percentile(95.0),
+            checked_out: self.checked_out(),
+            waiting: self.waiting.len(),
+            xact_time: self.stats.counts.xact_time,
+        };
+
+        let event = self.autoscaler.evaluate(
+            sample,
+            (self.pool_size, max.max(self.pool_size)),
+            self.config.autoscale_wait_target,
+            period,
+        )?;
+
+        self.config.max = event.to;
+
+        // Close least recently used idle connections over the new size.
+        // Checked out ones are closed when they are returned.
+        while self.total() > self.max() && !self.idle_connections.is_empty() {
+            let mut conn = self.idle_connections.remove(0);
+            conn.disconnect_reason(DisconnectReason::Autoscale);
+        }
+
+        Some(event)
+    }
+
     /// Pool configuration options.
     #[inline]
     pub(super) fn config(&self) -> &Config {
@@ -239,10 +324,41 @@ impl Inner {
     /// Take connection from the idle pool.
     #[inline(always)]
     pub(super) fn take(&mut self, request: &Request) -> Result<Option<Box<Server>>, Error> {
-        match self.idle_connections.pop() {
-            Some(conn) => {
+        // Low priority clients wait for one of theirs to finish.
+        if request.priority == Priority::Low && self.low_priority_full() {
+            return Ok(None);
+        }
+
+        // Prefer the connection this client used last time, if it's idle.
+        let affinity = if self.config.connection_affinity {
+            self.idle_connections
+                .iter()
+                .rposition(|conn| conn.last_client() == Some(request.id))
+        } else {
+            None
+        };
+
+        let conn = match affinity {
+            Some(position) => Some(self.idle_connections.remove(position)),
+            None => match self.config.server_queue_order {
+                QueueOrder::Lifo => self.idle_connections.pop(),
+                QueueOrder::Fifo if self.idle_connections.is_empty() => None,
+                QueueOrder::Fifo => Some(self.idle_connections.remove(0)),
+            },
+        };
+
+        match conn {
+            Some(mut conn) => {
+                conn.set_last_client(request.id);
                 let cancel_key = conn.key().clone();
                 self.taken.take(request.id, conn.id(), cancel_key);
+                if self.config.fair_share_window.is_some() {
+                    self.fair_share
+                        .checkout(request.tenant.clone(), conn.id(), Instant::now());
+                }
+                if request.priority == Priority::Low {
+                    self.low_priority.insert(conn.id());
+                }
 
                 Ok(Some(conn))
             }
@@ -257,15 +373,25 @@ impl Inner {
         // Try to give it to a client that's been waiting, if any.
         let cancel_key = conn.key().clone();
         let server_id = conn.id();
-        while let Some(waiter) = self.waiting.pop_front() {
+        while let Some(waiter) = self.next_waiter(now) {
+            conn.set_last_client(waiter.request.id);
             match waiter.tx.send(Ok(conn)) {
                 Err(conn_ret) => {
                     conn = conn_ret.unwrap(); // SAFETY: We sent Ok(conn), we'll get back Ok(conn) if channel is closed.
                 }
                 _ => {
                     self.taken.take(waiter.request.id, server_id, cancel_key);
+                    if self.config.fair_share_window.is_some() {
+                        self.fair_share
+                            .checkout(waiter.request.tenant.clone(), server_id, now);
+                    }
+                    if waiter.request.priority == Priority::Low {
+                        self.low_priority.insert(server_id);
+                    }
                     self.stats.counts.server_assignment_count += 1;
-                    self.stats.counts.wait_time += now.duration_since(waiter.request.created_at);
+                    let wait = now.duration_since(waiter.request.created_at);
+                    self.stats.counts.wait_time += wait;
+                    self.stats.wait_histogram.record(wait);
                     return Ok(());
                 }
             }
@@ -277,6 +403,63 @@ impl Inner {
         Ok(())
     }
 
+    /// Next client to give a server connection to.
+    ///
+    /// Clients with a higher priority are served first. Low priority
+    /// clients wait while they're using all the connections they can.
+    fn next_waiter(&mut self, now: Instant) -> Option<Waiter> {
+        let low_priority_full = self.low_priority_full();
+        let priority = self
+            .waiting
+            .iter()
+            .map(|waiter| waiter.request.priority)
+            .filter(|priority| *priority != Priority::Low || !low_priority_full)
+            .min()?;
+
+        let position = if let Some(window) = self.config.fair_share_window {
+            self.fair_share.next(
+                &self.waiting,
+                priority,
+                self.config.client_queue_order,
+                window,
+                now,
+            )?
+        } else {
+            let mut waiting = self
+                .waiting
+                .iter()
+                .enumerate()
+                .filter(|(_, waiter)| waiter.request.priority == priority)
+                .map(|(position, _)| position);
+
+            match self.config.client_queue_order {
+                QueueOrder::Fifo => waiting.next(),
+                QueueOrder::Lifo => waiting.next_back(),
+            }?
+        };
+
+        self.waiting.remove(position)
+    }
+
+    /// Maximum number of connections low priority clients can use.
+    fn low_priority_max(&self) -> usize {
+        let percent = self.config.low_priority_pool_percent.min(100) as usize;
+        (self.max() * percent).div_ceil(100).max(1)
+    }
+
+    /// Low priority clients are using all the connections they can.
+    fn low_priority_full(&self) -> bool {
+        self.low_priority.len() >= self.low_priority_max()
+    }
+
+    /// Server connection usage of each tenant.
+    pub(super) fn fair_shares(&mut self, now: Instant) -> Vec<TenantShare> {
+        match self.config.fair_share_window {
+            Some(window) => self.fair_share.shares(&self.waiting, window, now),
+            None => vec![],
+        }
+    }
+
     #[inline]
     pub(super) fn set_taken(&mut self, taken: Taken) {
         self.taken = taken;
@@ -312,6 +495,8 @@ impl Inner {
         self.moved = Some(destination.clone());
         let mut idle = std::mem::take(&mut self.idle_connections);
         let taken = std::mem::take(&mut self.taken);
+        self.fair_share.clear();
+        self.low_priority.clear();
 
         for conn in idle.iter_mut() {
             conn.stats_mut().set_pool_id(destination.id());
@@ -349,6 +534,19 @@ impl Inner {
         }
 
         self.taken.check_in(server.id())?;
+        let killed = self.killed.remove(&server.id());
+
+        if let Some(window) = self.config.fair_share_window {
+            self.fair_share.checkin(server.id(), window, now);
+        }
+
+        // A low priority client finished, another one waiting
+        // can have an idle connection.
+        if self.low_priority.remove(&server.id())
+            && let Some(conn) = self.idle_connections.pop()
+        {
+            self.put(conn, now)?;
+        }
 
         // Update stats
         self.stats.counts = self.stats.counts + stats;
@@ -374,6 +572,12 @@ impl Inner {
             return Ok(result);
         }
 
+        // Killed by the admin while checked out.
+        if killed {
+            server.disconnect_reason(DisconnectReason::Killed);
+            return Ok(result);
+        }
+
         // Force close the connection.
         if server.force_close() {
             self.force_close += 1;
@@ -395,6 +599,13 @@ impl Inner {
             return Ok(result);
         }
 
+        // The autoscaler shrank the pool while this connection was checked out.
+        if self.config.autoscale_max.is_some() && self.total() >= self.max() {
+            server.disconnect_reason(DisconnectReason::Autoscale);
+            result.replenish = false;
+            return Ok(result);
+        }
+
         if server.re_synced() {
             self.re_synced += 1;
             server.reset_re_synced();
@@ -444,6 +655,15 @@ impl Inner {
     }
 }
 
+/// Result of killing a server connection.
+#[derive(Debug, Copy, Clone, PartialEq)]
+pub enum Kill {
+    /// The connection was idle and is now closed.
+    Closed,
+    /// The connection is used by this client.
+    CheckedOut(FrontendPid),
+}
+
 /// Result of connection check into the pool.
 #[derive(Debug, Copy, Clone)]
 pub(super) struct CheckInResult {
@@ -576,6 +796,88 @@ mod test {
         assert_eq!(inner.total(), 1);
     }
 
+    #[test]
+    fn test_connection_affinity() {
+        let mut inner = Inner {
+            online: true,
+            ..Default::default()
+        };
+        inner.config.connection_affinity = true;
+
+        let (first, second) = (FrontendPid::new(), FrontendPid::new());
+
+        let mut server = Box::new(Server::default());
+        server.set_last_client(first);
+        let first_server = server.id();
+        inner.put(server, Instant::now()).unwrap();
+
+        let mut server = Box::new(Server::default());
+        server.set_last_client(second);
+        inner.put(server, Instant::now()).unwrap();
+
+        // Client gets the connection it used last time.
+        let conn = inner.take(&Request::new(first, false)).unwrap().unwrap();
+        assert_eq!(conn.id(), first_server);
+        assert_eq!(conn.last_client(), Some(first));
+
+        // No connection used by this client, falls back to any idle one.
+        let conn = inner
+            .take(&Request::new(FrontendPid::new(), false))
+            .unwrap()
+            .unwrap();
+        assert_ne!(conn.id(), first_server);
+        assert_eq!(inner.idle(), 0);
+    }
+
+    #[test]
+    fn test_queue_order() {
+        let mut inner = Inner {
+            online: true,
+            ..Default::default()
+        };
+
+        let first = Box::new(Server::default());
+        let first_id = first.id();
+        let second = Box::new(Server::default());
+        let second_id = second.id();
+        inner.put(first, Instant::now()).unwrap();
+        inner.put(second, Instant::now()).unwrap();
+
+        // LIFO: most recently returned connection is reused first.
+        inner.config.server_queue_order = QueueOrder::Lifo;
+        let conn = inner.take(&Request::default()).unwrap().unwrap();
+        assert_eq!(conn.id(), second_id);
+        inner.put(conn, Instant::now()).unwrap();
+
+        // FIFO: connections are rotated.
+        inner.config.server_queue_order = QueueOrder::Fifo;
+        let conn = inner.take(&Request::default()).unwrap().unwrap();
+        assert_eq!(conn.id(), first_id);
+        inner.put(conn, Instant::now()).unwrap();
+
+        // LIFO client queue: last client to arrive is served first.
+        inner.config.client_queue_order = QueueOrder::Lifo;
+        inner.idle_connections.clear();
+        let (tx1, mut rx1) = channel();
+        let (tx2, mut rx2) = channel();
+        inner.waiting.push_back(Waiter {
+            request: Request::default(),
+            tx: tx1,
+        });
+        inner.waiting.push_back(Waiter {
+            request: Request::default(),
+            tx: tx2,
+        });
+
+        inner
+            .put(Box::new(Server::default()), Instant::now())
+            .unwrap();
+        assert!(rx1.try_recv().is_err());
+        assert!(rx2.try_recv().is_ok());
+        assert_eq!(inner.waiting.len(), 1);
+        assert_eq!(inner.stats.wait_histogram.count(), 1);
+    }
+
     #[test]
     fn test_server_error_handling() {
         let mut inner = Inner {
@@ -652,6 +954,32 @@ mod test {
         ));
     }
 
+    #[test]
+    fn test_should_create_prewarm() {
+        let mut inner = Inner {
+            online: true,
+            prewarm: 2,
+            ..Default::default()
+        };
+        inner.config.min = 0;
+        inner.config.max = 5;
+
+        assert!(matches!(
+            inner.should_create(),
+            ShouldCreate::Yes {
+                reason: ConnectReason::Prewarm,
+                ..
+            }
+        ));
+
+        inner.paused = true;
+        assert_eq!(inner.should_create(), ShouldCreate::No);
+
+        inner.paused = false;
+        inner.prewarm = 0;
+        assert_eq!(inner.should_create(), ShouldCreate::No);
+    }
+
     #[test]
     fn test_should_not_create_at_max() {
         let mut inner = Inner {
@@ -783,6 +1111,53 @@ mod test {
         assert_eq!(inner.total(), 0); // Connection not added due to max age
     }
 
+    #[test]
+    fn test_autoscale() {
+        let mut config = Config::default();
+        config.max = 1;
+        config.min = 0;
+        config.autoscale_max = Some(4);
+
+        let mut inner = Inner::new(config, 0);
+        inner.online = true;
+
+        // All connections in use and a client is waiting.
+        inner.taken.take(
+            FrontendPid::new(),
+            BackendPid::for_test(1),
+            BackendKeyData::random_legacy(),
+        );
+        inner.waiting.push_back(Waiter {
+            request: Request::default(),
+            tx: channel().0,
+        });
+
+        let event = inner.autoscale(Duration::from_secs(15)).unwrap();
+        assert_eq!((event.from, event.to), (1, 2));
+        assert_eq!(inner.max(), 2);
+        assert!(inner.should_create().yes());
+
+        // Nobody is using the pool anymore.
+        inner.waiting.clear();
+        inner.taken.clear();
+        let now = Instant::now();
+        inner.put(Box::new(Server::default()), now).unwrap();
+        inner.put(Box::new(Server::default()), now).unwrap();
+
+        let event = inner.autoscale(Duration::from_secs(15)).unwrap();
+        assert_eq!((event.from, event.to), (2, 1));
+        assert_eq!(inner.max(), 1);
+        assert_eq!(inner.idle(), 1);
+
+        // Not below pool_size.
+        assert!(inner.autoscale(Duration::from_secs(15)).is_none());
+        assert_eq!(inner.autoscaler.events(), 2);
+
+        // Disabled.
+        inner.config.autoscale_max = None;
+        assert!(inner.autoscale(Duration::from_secs(15)).is_none());
+    }
+
     #[test]
     fn test_peer_lookup() {
         let mut inner = Inner::default();
@@ -874,6 +1249,60 @@ mod test {
         assert!(rx.try_recv().is_ok());
     }
 
+    #[test]
+    fn test_priority() {
+        let low = Request::default().priority(Priority::Low);
+        let high = Request::default().priority(Priority::High);
+
+        // Low priority clients can use half the pool.
+        let mut inner = Inner::default();
+        inner.config.max = 2;
+        inner.config.low_priority_pool_percent = 50;
+        inner.idle_connections.push(Box::new(Server::default()));
+        inner.idle_connections.push(Box::new(Server::default()));
+
+        let conn = inner.take(&low).unwrap().unwrap();
+        assert!(inner.take(&low).unwrap().is_none());
+        assert!(inner.take(&Request::default()).unwrap().is_some());
+
+        // The low priority client waits for the connection
+        // held by the other low priority client.
+        let (tx, mut rx) = channel();
+        inner.waiting.push_back(Waiter { request: low, tx });
+        inner
+            .put(Box::new(Server::default()), Instant::now())
+            .unwrap();
+        assert!(rx.try_recv().is_err());
+        assert_eq!(inner.idle(), 1);
+
+        inner
+            .maybe_check_in(conn, Instant::now(), BackendCounts::default(), false)
+            .unwrap();
+        assert!(rx.try_recv().is_ok());
+
+        // Higher priority clients are served first.
+        let mut inner = Inner::default();
+        let mut receivers = vec![];
+        for request in [
+            Request::default().priority(Priority::Low),
+            Request::default(),
+            high,
+        ] {
+            let (tx, rx) = channel();
+            inner.waiting.push_back(Waiter { request, tx });
+            receivers.push(rx);
+        }
+
+        for expected in [2, 1, 0] {
+            inner
+                .put(Box::new(Server::default()), Instant::now())
+                .unwrap();
+            for (i, rx) in receivers.iter_mut().enumerate() {
+                assert_eq!(rx.try_recv().is_ok(), i == expected);
+            }
+        }
+    }
+
     #[test]
     fn test_put_connection_no_waiters() {
         let mut inner = Inner::default();
@@ -3,19 +3,21 @@
 use std::{
     sync::{
         Arc,
-        atomic::{AtomicI64, AtomicU8, AtomicUsize, Ordering},
+        atomic::{AtomicBool, AtomicI64, AtomicU8, AtomicUsize, Ordering},
     },
     time::{Duration, SystemTime},
 };
 
-use rand::seq::SliceRandom;
+use futures::future::join_all;
+use rand::{Rng, seq::SliceRandom};
 use tokio::{sync::Notify, time::timeout};
-use tracing::warn;
+use tracing::{debug, warn};
 
-use crate::{config::config, net::messages::FrontendPid};
+use crate::{backend::zone, config::config, net::messages::FrontendPid, stats::read_fallback};
 use crate::{
     config::{LoadBalancingStrategy, ReadWriteSplit, Role},
     net::Parameters,
+    random,
 };
 
 use super::{Error, Guard, Pool, PoolConfig, Request};
@@ -41,6 +43,8 @@ pub struct Target {
     pub health: TargetHealth,
     /// Smooth weighted round-robin current weight tracker.
     current_weight: Arc<AtomicI64>,
+    /// Replication lag is over `max_replica_lag`.
+    lagging: Arc<AtomicBool>,
 }
 
 impl Target {
@@ -52,6 +56,7 @@ impl Target {
             health: pool.inner().health.clone(),
             pool,
             current_weight: Arc::new(AtomicI64::new(0)),
+            lagging: Arc::new(AtomicBool::new(false)),
         }
     }
 
@@ -67,6 +72,16 @@ impl Target {
         let old = self.role.swap(value, Ordering::Relaxed);
         value != old
     }
+
+    /// Replica is too far behind to serve reads.
+    pub(super) fn lagging(&self) -> bool {
+        self.lagging.load(Ordering::Relaxed)
+    }
+
+    /// Set replica lag status. Returns true if it changed.
+    pub(super) fn set_lagging(&self, lagging: bool) -> bool {
+        self.lagging.swap(lagging, Ordering::Relaxed) != lagging
+    }
 }
 
 /// Load balancer.
@@ -86,6 +101,10 @@ pub struct LoadBalancer {
     pub(super) role_detection: Arc<Notify>,
     /// Read/write split.
     pub(super) rw_split: ReadWriteSplit,
+    /// Our availability zone.
+    pub(super) zone: Option<String>,
+    /// Send reads to the primary if all replicas are down.
+    pub(super) read_fallback_to_primary: bool,
 }
 
 impl LoadBalancer {
@@ -129,6 +148,8 @@ impl LoadBalancer {
             maintenance: Arc::new(Notify::new()),
             role_detection: Arc::new(Notify::new()),
             rw_split,
+            zone: zone::zone(),
+            read_fallback_to_primary: config().config.general.read_fallback_to_primary,
         }
     }
 
@@ -204,6 +225,28 @@ impl LoadBalancer {
         promoted
     }
 
+    /// Use the roles detected by another load balancer for the same databases,
+    /// e.g., the slow pools follow the roles of the regular pools.
+    pub(super) fn copy_roles(&self, source: &LoadBalancer) {
+        let roles_detected_before = self.roles_detected();
+        let mut promoted = false;
+
+        for target in &self.targets {
+            if let Some(from) = source
+                .targets
+                .iter()
+                .find(|from| from.pool.addr() == target.pool.addr())
+            {
+                let role = from.role();
+                promoted |= target.set_role(role) && role == Role::Primary;
+            }
+        }
+
+        if promoted || (!roles_detected_before && self.roles_detected()) {
+            self.role_detection.notify_one();
+        }
+    }
+
     /// Launch replica pools and start the monitor.
     pub fn launch(&self) {
         self.targets.iter().for_each(|target| target.pool.launch());
@@ -281,11 +324,10 @@ impl LoadBalancer {
 
     /// Cancel a query if one is running.
     pub async fn cancel(&self, id: FrontendPid) -> Result<(), super::super::Error> {
-        for target in &self.targets {
-            target.pool.cancel(id).await?;
-        }
-
-        Ok(())
+        join_all(self.targets.iter().map(|target| target.pool.cancel(id)))
+            .await
+            .into_iter()
+            .collect()
     }
 
     /// Replica pools handle.
@@ -376,12 +418,17 @@ impl LoadBalancer {
             candidates.retain(|target| matches!(target.role(), Role::Replica | Role::Auto));
         }
 
+        // Skip replicas that are too far behind, unless that's all of them.
+        if candidates.iter().any(|target| !target.lagging()) {
+            candidates.retain(|target| !target.lagging());
+        }
+
         if candidates.is_empty() {
             return Err(Error::AllReplicasDown);
         }
 
         match self.lb_strategy {
-            Random => candidates.shuffle(&mut rand::rng()),
+            Random => random::with_rng(|rng| candidates.shuffle(rng)),
             RoundRobin => {
                 let first = self.round_robin.fetch_add(1, Ordering::Relaxed) % candidates.len();
                 let mut reshuffled = vec![];
@@ -419,11 +466,48 @@ impl LoadBalancer {
                     candidates.swap(0, max_idx);
                 }
             }
+            LatencyAware => {
+                // Try the others fastest first if the chosen one fails.
+                candidates.sort_by_cached_key(|target| target.health.latency());
+                let weights = Self::latency_weights(&candidates);
+                let total: f64 = weights.iter().sum();
+                let mut pick = random::with_rng(|rng| rng.random::<f64>()) * total;
+                let chosen = weights
+                    .iter()
+                    .position(|weight| {
+                        pick -= weight;
+                        pick < 0.0
+                    })
+                    .unwrap_or_default();
+                candidates[..=chosen].rotate_right(1);
+            }
+        }
+
+        // Prefer targets in our zone. The others are used
+        // only if those are banned or saturated.
+        if let Some(ref zone) = self.zone {
+            candidates.sort_by_key(|target| target.pool.addr().zone.as_ref() != Some(zone));
         }
 
+        // Send reads to the primary if none of the replicas work.
+        let fallback = if (self.read_fallback_to_primary || request.read_fallback) && !primary_reads
+        {
+            self.primary_target()
+        } else {
+            None
+        };
+
         // Only ban a candidate pool if there are more than one
-        // and we have alternates.
-        let bannable = candidates.len() > 1;
+        // and we have alternates. A lone replica is banned only if it's down,
+        // not just slow, since reads go to the primary while it's banned.
+        // Bans apply to all clients, so a client asking for a fallback,
+        // e.g. with target_session_attrs=prefer-standby, doesn't count.
+        let fallback_configured = self.read_fallback_to_primary && fallback.is_some();
+        let bannable = |target: &Target, err: &Error| {
+            candidates.len() > 1 || (fallback_configured && Self::down(target, err))
+        };
+        let mut saturated = None;
+        let mut banned = false;
 
         for target in &candidates {
             if target.ban.banned() {
@@ -434,14 +518,41 @@ impl LoadBalancer {
                 Err(Error::Offline) => {
                     continue;
                 }
+                // Busy, try another one.
+                Err(err @ Error::TooManyWaiting(_)) => {
+                    saturated = Some(err);
+                }
                 Err(err) => {
-                    if bannable {
-                        target.ban.ban(err, target.pool.config().ban_timeout);
+                    if bannable(target, &err) {
+                        banned |= target.ban.ban(err, target.pool.config().ban_timeout);
                     }
                 }
             }
         }
 
+        if let Some(err) = saturated {
+            return Err(err);
+        }
+
+        // Keep the replicas banned, so the next reads go to the primary
+        // without waiting on them again until the bans expire.
+        if let Some(primary) = fallback {
+            // Warn only when the replicas go down, not on every read after that.
+            if banned {
+                warn!(
+                    "all replicas down, sending reads to primary [{}]",
+                    primary.pool.addr()
+                );
+            } else {
+                debug!(
+                    "all replicas down, sending read to primary [{}]",
+                    primary.pool.addr()
+                );
+            }
+            read_fallback::fallback();
+            return primary.pool.get(request).await;
+        }
+
         candidates
             .iter()
             .for_each(|target| target.ban.unban(true, UnbanReason::AllTargetsBanned));
@@ -449,6 +560,33 @@ impl LoadBalancer {
         Err(Error::AllReplicasDown)
     }
 
+    /// The target can't serve reads, as opposed to being busy. Checkouts time out
+    /// if we can't connect to the server, but then the pool has no connections.
+    fn down(target: &Target, err: &Error) -> bool {
+        err.is_down() || (*err == Error::CheckoutTimeout && target.pool.lock().total() == 0)
+    }
+
+    /// Selection weights for latency-aware load balancing, inversely
+    /// proportional to each target's latency. Targets we haven't measured yet
+    /// are weighted like the fastest one, so they get traffic and a measurement.
+    fn latency_weights(candidates: &[&Target]) -> Vec<f64> {
+        let latencies = candidates
+            .iter()
+            .map(|target| target.health.latency())
+            .collect::<Vec<_>>();
+        let fastest = latencies
+            .iter()
+            .flatten()
+            .min()
+            .copied()
+            .unwrap_or(Duration::from_micros(1));
+
+        latencies
+            .into_iter()
+            .map(|latency| 1.0 / latency.unwrap_or(fastest).as_secs_f64())
+            .collect()
+    }
+
     /// Shutdown replica pools.
     ///
     /// N.B. The primary pool is managed by `super::Shard`.
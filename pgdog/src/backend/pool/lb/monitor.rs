@@ -6,7 +6,7 @@ use super::*;
 
 use pgdog_stats::ReplicaLag;
 use tokio::{select, task::JoinHandle, time::interval};
-use tracing::debug;
+use tracing::{debug, info, warn};
 
 static MAINTENANCE: Duration = Duration::from_millis(333);
 
@@ -51,6 +51,16 @@ impl Monitor {
                 .unwrap_or(i64::MAX),
         };
 
+        let max_replica_lag = ReplicaLag {
+            duration: Duration::from_millis(config.config.general.max_replica_lag),
+            bytes: config
+                .config
+                .general
+                .max_replica_lag_bytes
+                .try_into()
+                .unwrap_or(i64::MAX),
+        };
+
         loop {
             let mut check_offline = false;
 
@@ -74,11 +84,35 @@ impl Monitor {
             }
 
             self.ban_check(&replica_ban_threshold);
+            self.lag_check(&max_replica_lag);
         }
 
         debug!("replicas monitor shut down");
     }
 
+    /// Exclude replicas lagging behind the primary from serving reads,
+    /// and bring them back once they catch up.
+    pub(super) fn lag_check(&self, max_replica_lag: &ReplicaLag) {
+        for target in &self.replicas.targets {
+            let lagging = target.role() == Role::Replica
+                && target.pool.replica_lag().greater_or_eq(max_replica_lag);
+
+            if target.set_lagging(lagging) {
+                if lagging {
+                    warn!(
+                        "replica is lagging, excluding it from reads [{}]",
+                        target.pool.addr()
+                    );
+                } else {
+                    info!(
+                        "replica caught up, using it for reads [{}]",
+                        target.pool.addr()
+                    );
+                }
+            }
+        }
+    }
+
     /// Check for unhealthy targets and ban them, or clear expired bans.
     /// This is pub(super) to enable testing.
     pub(super) fn ban_check(&self, replica_ban_threshold: &ReplicaLag) {
@@ -1,15 +1,24 @@
 //! Keep a record of each pool's health.
 
-use std::sync::{
-    Arc,
-    atomic::{AtomicBool, Ordering},
+use std::{
+    sync::{
+        Arc,
+        atomic::{AtomicBool, AtomicU64, Ordering},
+    },
+    time::Duration,
 };
 
+/// Weight of a new sample in the latency moving average.
+const LATENCY_ALPHA: f64 = 0.2;
+
 #[derive(Clone, Debug)]
 pub struct TargetHealth {
     #[allow(dead_code)]
     pub(super) id: u64,
     pub(super) healthy: Arc<AtomicBool>,
+    /// Moving average of query and healthcheck latency, in microseconds.
+    /// Zero if we haven't measured any yet.
+    pub(super) latency: Arc<AtomicU64>,
 }
 
 impl TargetHealth {
@@ -17,6 +26,7 @@ impl TargetHealth {
         Self {
             id,
             healthy: Arc::new(AtomicBool::new(true)),
+            latency: Arc::new(AtomicU64::new(0)),
         }
     }
 
@@ -27,4 +37,27 @@ impl TargetHealth {
     pub fn healthy(&self) -> bool {
         self.healthy.load(Ordering::Relaxed)
     }
+
+    /// Add a latency sample to the moving average.
+    pub fn record_latency(&self, sample: Duration) {
+        let sample = (sample.as_micros() as u64).max(1);
+        let _ = self
+            .latency
+            .fetch_update(Ordering::Relaxed, Ordering::Relaxed, |current| {
+                if current == 0 {
+                    Some(sample)
+                } else {
+                    let average = current as f64 + (sample as f64 - current as f64) * LATENCY_ALPHA;
+                    Some((average.round() as u64).max(1))
+                }
+            });
+    }
+
+    /// Moving average of latency, if we measured any.
+    pub fn latency(&self) -> Option<Duration> {
+        match self.latency.load(Ordering::Relaxed) {
+            0 => None,
+            latency => Some(Duration::from_micros(latency)),
+        }
+    }
 }
@@ -391,6 +391,173 @@ async fn test_read_write_split_exclude_primary() {
     replicas.shutdown();
 }
 
+#[tokio::test]
+async fn test_read_fallback_to_primary() {
+    let primary_config = create_test_pool_config("127.0.0.1", 5432);
+    let primary_pool = Pool::new(&primary_config);
+    primary_pool.launch();
+
+    let replica_configs = [
+        create_test_pool_config("localhost", 5432),
+        create_test_pool_config("127.0.0.1", 5432),
+    ];
+
+    let mut replicas = LoadBalancer::new(
+        &Some(primary_pool),
+        &replica_configs,
+        LoadBalancingStrategy::Random,
+        ReadWriteSplit::ExcludePrimary,
+    );
+    replicas.launch();
+
+    let request = Request::default();
+    let ban_replicas = |replicas: &LoadBalancer| {
+        for target in &replicas.targets {
+            if target.role() == Role::Replica {
+                target.ban.ban(Error::ServerError, Duration::from_secs(300));
+            }
+        }
+    };
+
+    ban_replicas(&replicas);
+    assert!(matches!(
+        replicas.get(&request).await,
+        Err(Error::AllReplicasDown)
+    ));
+
+    // The client asked for it, e.g. with target_session_attrs=prefer-standby.
+    let conn = replicas
+        .get(&Request::default().read_fallback(true))
+        .await
+        .unwrap();
+    assert_eq!(conn.pool.id(), replicas.primary().unwrap().id());
+    drop(conn);
+
+    replicas.read_fallback_to_primary = true;
+    ban_replicas(&replicas);
+    let conn = replicas.get(&request).await.unwrap();
+    assert_eq!(conn.pool.id(), replicas.primary().unwrap().id());
+
+    // Replicas stay banned while reads go to the primary.
+    assert!(
+        replicas
+            .targets
+            .iter()
+            .filter(|target| target.role() == Role::Replica)
+            .all(|target| target.ban.banned())
+    );
+
+    replicas.shutdown();
+}
+
+#[tokio::test]
+async fn test_read_fallback_to_primary_busy_replica_not_banned() {
+    let primary_config = create_test_pool_config("127.0.0.1", 5432);
+    let primary_pool = Pool::new(&primary_config);
+    primary_pool.launch();
+
+    let mut replica_config = create_test_pool_config("localhost", 5432);
+    replica_config.config.inner.checkout_timeout = Duration::from_millis(100);
+
+    let mut replicas = LoadBalancer::new(
+        &Some(primary_pool),
+        &[replica_config],
+        LoadBalancingStrategy::Random,
+        ReadWriteSplit::ExcludePrimary,
+    );
+    replicas.read_fallback_to_primary = true;
+    replicas.launch();
+
+    let replica = replicas
+        .targets
+        .iter()
+        .find(|target| target.role() == Role::Replica)
+        .unwrap();
+
+    // Take the only connection, so the next checkout times out.
+    let request = Request::default();
+    let busy = replica.pool.get(&request).await.unwrap();
+
+    let conn = replicas.get(&request).await.unwrap();
+    assert_eq!(conn.pool.id(), replicas.primary().unwrap().id());
+    assert!(!replica.ban.banned());
+
+    drop(busy);
+    drop(conn);
+    replicas.shutdown();
+}
+
+#[tokio::test]
+async fn test_read_fallback_to_primary_down_replica_banned() {
+    let primary_config = create_test_pool_config("127.0.0.1", 5432);
+    let primary_pool = Pool::new(&primary_config);
+    primary_pool.launch();
+
+    // Nothing listens there.
+    let mut replica_config = create_test_pool_config("127.0.0.1", 1);
+    replica_config.config.inner.checkout_timeout = Duration::from_millis(100);
+    replica_config.config.inner.ban_timeout = Duration::from_secs(300);
+
+    let mut replicas = LoadBalancer::new(
+        &Some(primary_pool),
+        &[replica_config],
+        LoadBalancingStrategy::Random,
+        ReadWriteSplit::ExcludePrimary,
+    );
+    replicas.read_fallback_to_primary = true;
+    replicas.launch();
+
+    let conn = replicas.get(&Request::default()).await.unwrap();
+    assert_eq!(conn.pool.id(), replicas.primary().unwrap().id());
+
+    let replica = replicas
+        .targets
+        .iter()
+        .find(|target| target.role() == Role::Replica)
+        .unwrap();
+    assert!(replica.ban.banned());
+
+    drop(conn);
+    replicas.shutdown();
+}
+
+#[tokio::test]
+async fn test_client_read_fallback_doesnt_ban_replica() {
+    let primary_config = create_test_pool_config("127.0.0.1", 5432);
+    let primary_pool = Pool::new(&primary_config);
+    primary_pool.launch();
+
+    // Nothing listens there.
+    let mut replica_config = create_test_pool_config("127.0.0.1", 1);
+    replica_config.config.inner.checkout_timeout = Duration::from_millis(100);
+    replica_config.config.inner.ban_timeout = Duration::from_secs(300);
+
+    let replicas = LoadBalancer::new(
+        &Some(primary_pool),
+        &[replica_config],
+        LoadBalancingStrategy::Random,
+        ReadWriteSplit::ExcludePrimary,
+    );
+    replicas.launch();
+
+    // The replica is shared with clients that didn't ask for a fallback.
+    let conn = replicas
+        .get(&Request::default().read_fallback(true))
+        .await
+        .unwrap();
+    assert_eq!(conn.pool.id(), replicas.primary().unwrap().id());
+    assert!(
+        replicas
+            .targets
+            .iter()
+            .filter(|target| target.role() == Role::Replica)
+            .all(|target| !target.ban.banned())
+    );
+
+    drop(conn);
+    replicas.shutdown();
+}
+
 #[tokio::test]
 async fn test_read_write_split_include_primary() {
     let primary_config = create_test_pool_config("127.0.0.1", 5432);
@@ -1586,6 +1753,77 @@ async fn test_least_active_connections_prefers_pool_with_fewer_checked_out() {
     replicas.shutdown();
 }
 
+#[test]
+fn test_target_health_latency_moving_average() {
+    let health = TargetHealth::new(0);
+    assert_eq!(health.latency(), None);
+
+    health.record_latency(Duration::from_millis(10));
+    assert_eq!(health.latency(), Some(Duration::from_millis(10)));
+
+    health.record_latency(Duration::from_millis(20));
+    assert_eq!(health.latency(), Some(Duration::from_millis(12)));
+}
+
+#[test]
+fn test_latency_weights_prefer_faster_targets() {
+    let lb = setup_test_replicas_no_launch();
+    let candidates = lb.targets.iter().collect::<Vec<_>>();
+
+    // Nothing measured yet, all targets are equal.
+    let weights = LoadBalancer::latency_weights(&candidates);
+    assert_eq!(weights[0], weights[1]);
+
+    lb.targets[0]
+        .health
+        .record_latency(Duration::from_millis(10));
+    let weights = LoadBalancer::latency_weights(&candidates);
+    assert_eq!(
+        weights[0], weights[1],
+        "unmeasured target is weighted like the fastest"
+    );
+
+    lb.targets[1]
+        .health
+        .record_latency(Duration::from_millis(30));
+    let weights = LoadBalancer::latency_weights(&candidates);
+    assert!((weights[0] / weights[1] - 3.0).abs() < 1e-9);
+}
+
+#[tokio::test]
+async fn test_zone_prefers_same_zone_replica() {
+    let mut pool_config1 = create_test_pool_config("127.0.0.1", 5432);
+    pool_config1.address.zone = Some("us-east-1a".into());
+    let mut pool_config2 = create_test_pool_config("localhost", 5432);
+    pool_config2.address.zone = Some("us-east-1b".into());
+
+    let mut lb = LoadBalancer::new(
+        &None,
+        &[pool_config1, pool_config2],
+        LoadBalancingStrategy::Random,
+        ReadWriteSplit::IncludePrimary,
+    );
+    lb.zone = Some("us-east-1b".into());
+    lb.launch();
+
+    let request = Request::default();
+    let same_zone = lb.targets[1].pool.id();
+
+    for _ in 0..10 {
+        let conn = lb.get(&request).await.unwrap();
+        assert_eq!(conn.pool.id(), same_zone);
+    }
+
+    // Spill over to the other zone if ours is banned.
+    lb.targets[1]
+        .ban
+        .ban(Error::ServerError, Duration::from_millis(1000));
+    let conn = lb.get(&request).await.unwrap();
+    assert_eq!(conn.pool.id(), lb.targets[0].pool.id());
+
+    lb.shutdown();
+}
+
 // ==========================================
 // ban_check unit tests
 // ==========================================
@@ -1630,6 +1868,58 @@ fn test_ban_check_clears_expired_ban_when_healthy_no_lag() {
     );
 }
 
+#[test]
+fn test_lag_check_excludes_lagging_replica_until_it_catches_up() {
+    let replicas = setup_test_replicas_no_launch();
+    let monitor = Monitor::new_test(&replicas);
+    let max_replica_lag = ReplicaLag {
+        duration: Duration::from_secs(1),
+        bytes: 100,
+    };
+
+    replicas.targets[0].pool.lock().replica_lag = ReplicaLag {
+        duration: Duration::from_secs(10),
+        bytes: 1000,
+    };
+    monitor.lag_check(&max_replica_lag);
+    assert!(replicas.targets[0].lagging());
+    assert!(!replicas.targets[1].lagging());
+    assert!(
+        !replicas.targets[0].ban.banned(),
+        "Lagging replica is excluded, not banned"
+    );
+
+    replicas.targets[0].pool.lock().replica_lag = ReplicaLag::default();
+    monitor.lag_check(&max_replica_lag);
+    assert!(!replicas.targets[0].lagging());
+}
+
+#[tokio::test]
+async fn test_lagging_replica_not_used_for_reads() {
+    // Launch the pools without the monitor, which would reset
+    // the lag status.
+    let replicas = setup_test_replicas_no_launch();
+    replicas
+        .targets
+        .iter()
+        .for_each(|target| target.pool.launch());
+    let request = Request::default();
+
+    replicas.targets[0].set_lagging(true);
+    let healthy = replicas.targets[1].pool.id();
+
+    for _ in 0..10 {
+        let conn = replicas.get(&request).await.unwrap();
+        assert_eq!(conn.pool.id(), healthy);
+    }
+
+    // All replicas lagging, use them anyway.
+    replicas.targets[1].set_lagging(true);
+    assert!(replicas.get(&request).await.is_ok());
+
+    replicas.shutdown();
+}
+
 #[test]
 fn test_ban_check_does_not_clear_expired_ban_when_healthy_with_bad_lag() {
     let replicas = setup_test_replicas_no_launch();
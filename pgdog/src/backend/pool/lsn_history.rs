@@ -0,0 +1,114 @@
+//! Recent LSN samples of a server.
+//!
+//! These are exported to external consumers, e.g. failover controllers,
+//! so they can reuse our view of replication state.
+
+use std::collections::VecDeque;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+use pgdog_stats::{LsnStats, ReplicaLag};
+use serde::Serialize;
+
+/// Result of one LSN check.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct LsnSample {
+    /// When the sample was taken, in milliseconds since the Unix epoch.
+    pub fetched_at: u64,
+    /// Server is a replica.
+    pub replica: bool,
+    /// WAL position, e.g. `0/16B3748`.
+    pub lsn: String,
+    /// WAL position in bytes.
+    pub offset_bytes: i64,
+    /// Replica lag in milliseconds, always 0 on the primary.
+    pub replica_lag_ms: u64,
+    /// Replica lag in bytes, always 0 on the primary.
+    pub replica_lag_bytes: i64,
+}
+
+impl LsnSample {
+    /// Create sample from LSN stats and the replica lag.
+    pub fn new(stats: &LsnStats, lag: &ReplicaLag) -> Self {
+        Self {
+            fetched_at: stats
+                .fetched
+                .duration_since(UNIX_EPOCH)
+                .unwrap_or_default()
+                .as_millis() as u64,
+            replica: stats.replica,
+            lsn: stats.lsn.to_string(),
+            offset_bytes: stats.offset_bytes,
+            replica_lag_ms: lag.duration.as_millis() as u64,
+            replica_lag_bytes: lag.bytes,
+        }
+    }
+}
+
+/// LSN samples taken over a time window, oldest first.
+#[derive(Debug, Default)]
+pub struct LsnHistory {
+    samples: VecDeque<(SystemTime, LsnSample)>,
+}
+
+impl LsnHistory {
+    /// Add sample and drop the ones older than the window.
+    pub fn record(&mut self, fetched: SystemTime, sample: LsnSample, window: Duration) {
+        self.samples.push_back((fetched, sample));
+
+        while let Some((oldest, _)) = self.samples.front() {
+            let age = fetched.duration_since(*oldest).unwrap_or_default();
+
+            // Always keep the latest sample.
+            if age > window || (window.is_zero() && self.samples.len() > 1) {
+                self.samples.pop_front();
+            } else {
+                break;
+            }
+        }
+    }
+
+    /// Get all samples, oldest first.
+    pub fn samples(&self) -> Vec<LsnSample> {
+        self.samples
+            .iter()
+            .map(|(_, sample)| sample.clone())
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    fn sample(offset_bytes: i64) -> LsnSample {
+        LsnSample {
+            fetched_at: 0,
+            replica: true,
+            lsn: String::new(),
+            offset_bytes,
+            replica_lag_ms: 0,
+            replica_lag_bytes: 0,
+        }
+    }
+
+    #[test]
+    fn test_lsn_history_window() {
+        let mut history = LsnHistory::default();
+        let window = Duration::from_secs(10);
+        let start = SystemTime::now();
+
+        for i in 0..15 {
+            history.record(start + Duration::from_secs(i), sample(i as i64), window);
+        }
+
+        let samples = history.samples();
+        assert_eq!(samples.len(), 11);
+        assert_eq!(samples.first().unwrap().offset_bytes, 4);
+        assert_eq!(samples.last().unwrap().offset_bytes, 14);
+
+        let mut history = LsnHistory::default();
+        history.record(start, sample(1), Duration::ZERO);
+        history.record(start, sample(2), Duration::ZERO);
+        assert_eq!(history.samples(), vec![sample(2)]);
+    }
+}
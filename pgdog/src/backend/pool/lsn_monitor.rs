@@ -15,6 +15,8 @@ use crate::{
     tasks,
 };
 
+use super::endpoint::Endpoint;
+use super::lsn_history::LsnSample;
 use super::*;
 use pgdog_postgres_types::Format;
 
@@ -52,6 +54,36 @@ SELECT
     END AS timestamp
 ";
 
+// WAL functions before Postgres 10.
+static XLOG_LSN_QUERY: &str = "
+SELECT
+    pg_is_in_recovery() AS replica,
+    CASE
+        WHEN pg_is_in_recovery() THEN
+            COALESCE(
+                pg_last_xlog_replay_location(),
+                pg_last_xlog_receive_location()
+            )
+        ELSE
+            pg_current_xlog_location()
+    END AS lsn,
+    CASE
+        WHEN pg_is_in_recovery() THEN
+            COALESCE(
+                pg_last_xlog_replay_location(),
+                pg_last_xlog_receive_location()
+            ) - '0/0'::pg_lsn
+        ELSE
+            pg_current_xlog_location() - '0/0'::pg_lsn
+    END AS offset_bytes,
+    CASE
+        WHEN pg_is_in_recovery() THEN
+            COALESCE(pg_last_xact_replay_timestamp(), now())
+        ELSE
+            now()
+    END AS timestamp
+";
+
 static AURORA_LSN_QUERY: &str = "
 SELECT
     pg_is_in_recovery() AS replica,
@@ -194,6 +226,8 @@ impl LsnMonitor {
 
         let mut aurora_detected: Option<bool> = None;
         let mut interval = interval(self.pool.config().lsn_check_interval);
+        let endpoint = Endpoint::from(self.pool.addr());
+        let _endpoint = endpoint.register();
 
         loop {
             select! {
@@ -201,6 +235,13 @@ impl LsnMonitor {
                 _ = self.pool.comms().shutdown.cancelled() => { break; }
             }
 
+            // Another pool connected to the same server fetched them recently.
+            if let Some(stats) = endpoint.lsn_stats(self.pool.config().lsn_check_interval) {
+                self.update_stats(stats);
+                aurora_detected = Some(stats.aurora);
+                continue;
+            }
+
             match self.run_check(aurora_detected).await {
                 Ok(result) => aurora_detected = result,
                 Err(Error::Offline) => break,
@@ -230,26 +271,47 @@ impl LsnMonitor {
             return Ok(None);
         };
 
-        let query = if aurora { AURORA_LSN_QUERY } else { LSN_QUERY };
+        // Servers in the same pool can run different versions
+        // during an upgrade, so check every connection.
+        let xlog = conn
+            .version()
+            .is_some_and(|version| !version.wal_functions());
+        let query = if aurora {
+            AURORA_LSN_QUERY
+        } else if xlog {
+            XLOG_LSN_QUERY
+        } else {
+            LSN_QUERY
+        };
 
         if let Some(row) = self.run_query(&mut conn, query).await {
             drop(conn);
             let stats = LsnStats::from_row(row, aurora);
-            {
-                let mut guard = self.pool.inner().lsn_stats.write();
-                // Notify that the role changed and the shard monitor
-                // should immediately resynchronize.
-                if stats.replica != guard.replica {
-                    self.pool.inner().lsn_role_change.notify_one();
-                }
-                (*guard) = stats;
-            }
-            trace!("lsn monitor stats updated [{}]", self.pool.addr());
+            Endpoint::from(self.pool.addr()).record_lsn_stats(stats);
+            self.update_stats(stats);
         }
 
         Ok(aurora_detected)
     }
 
+    fn update_stats(&self, stats: LsnStats) {
+        {
+            let mut guard = self.pool.inner().lsn_stats.write();
+            // Notify that the role changed and the shard monitor
+            // should immediately resynchronize.
+            if stats.replica != guard.replica {
+                self.pool.inner().lsn_role_change.notify_one();
+            }
+            (*guard) = stats;
+        }
+        self.pool.inner().lsn_history.lock().record(
+            stats.fetched,
+            LsnSample::new(&stats, &self.pool.replica_lag()),
+            self.pool.config().lsn_history,
+        );
+        trace!("lsn monitor stats updated [{}]", self.pool.addr());
+    }
+
     async fn get_connection(&self) -> Result<LsnConnection, Error> {
         match self.pool.get(&Request::default()).await {
             Ok(conn) => Ok(LsnConnection::Guard(conn)),
@@ -1,6 +1,7 @@
 //! Manage connections to the servers.
 
 pub mod address;
+pub mod autoscale;
 pub mod cleanup;
 pub mod cluster;
 pub mod cluster_launch;
@@ -9,11 +10,14 @@ pub mod config;
 pub mod connection;
 pub mod dns_cache;
 pub mod ee;
+pub mod endpoint;
 pub mod error;
+pub mod fair_share;
 pub mod guard;
 pub mod healthcheck;
 pub mod inner;
 pub mod lb;
+pub mod lsn_history;
 pub mod lsn_monitor;
 pub mod mirror_stats;
 pub mod monitor;
@@ -29,10 +33,12 @@ pub mod token_cache;
 pub mod waiting;
 
 pub use address::Address;
+pub use autoscale::{Autoscaler, ScalingEvent, ScalingReason};
 pub use cluster::{Cluster, ClusterConfig, ClusterShardConfig, PoolConfig, ShardingSchema};
 pub use config::Config;
 pub use connection::Connection;
 pub use error::Error;
+pub use fair_share::TenantShare;
 pub use guard::Guard;
 pub use healthcheck::Healtcheck;
 pub use lb::LoadBalancer;
@@ -43,11 +49,12 @@ pub use oids::Oids;
 pub use password::Password;
 pub use pool_impl::Pool;
 pub use request::Request;
-pub use shard::Shard;
+pub use shard::{PoolClass, Shard};
 pub use state::State;
 pub use stats::Stats;
 
 use comms::Comms;
+use fair_share::FairShare;
 use inner::Inner;
 use shard::ShardConfig;
 use taken::Taken;
@@ -6,6 +6,8 @@
 //!
 //! * the maintenance loop which runs ~3 times per second,
 //! * the healthcheck loop which runs every `idle_healthcheck_interval`,
+//!   checking failed hosts more often and healthy ones less often if
+//!   `idle_healthcheck_min_interval` and `idle_healthcheck_max_interval` are set,
 //! * the new connection loop which runs every time a client asks
 //!   for a new connection to be created,
 //! * the token refresh loop which runs for pools backed by an external
@@ -34,6 +36,13 @@
 //! connections back to the idle pool in that amount of time, and new connections are no longer needed even
 //! if clients requested ones to be created ~100ms ago.
 //!
+//! ## Healthcheck loop
+//!
+//! Health checks probe the server, so pools for different users connected to the same
+//! host and database share successful results. If another pool passed a health check
+//! since the last one, a healthy pool skips its own. A pool that failed its last check
+//! keeps checking, since the failure could be specific to it.
+//!
 //! ## Token refresh loop
 //!
 //! Spawned once per pool for addresses that use an external identity provider.
@@ -45,14 +54,16 @@
 
 use std::time::Duration;
 
-use super::{Error, Guard, Healtcheck, Oids, Pool, Request};
-use crate::backend::auth::{azure_workload_identity, rds_iam, vault};
+use super::endpoint::Endpoint;
+use super::{Config, Error, Guard, Healtcheck, Oids, Pool, Request};
+use crate::backend::auth::{azure_workload_identity, gcp_iam, rds_iam, vault};
 use crate::backend::pool::inner::ShouldCreate;
 use crate::backend::pool::token_cache::TokenCache;
 use crate::backend::{ConnectReason, DisconnectReason, Server};
 use crate::config::ServerAuth;
-use crate::tasks;
+use crate::{random, tasks};
 
+use rand::Rng;
 use tokio::select;
 use tokio::time::{Instant, interval, sleep, timeout};
 use tracing::{debug, error, info, warn};
@@ -152,7 +163,9 @@ impl Monitor {
                         break;
                     }
 
-                    if let ShouldCreate::Yes { reason, .. } = should_create {
+                    let mut should_create = should_create;
+
+                    while let ShouldCreate::Yes { reason, .. } = should_create {
                         info!("new connection requested: {} [{}]", should_create, self.pool.addr());
                         let ok = match self.replenish(reason).await {
                             Ok(ok) => ok,
@@ -163,7 +176,18 @@ impl Monitor {
                         };
                         if !ok {
                             self.pool.inner().health.toggle(false);
+                            break;
                         }
+
+                        // Warm up all connections required by min_pool_size at once,
+                        // e.g. after startup, RELOAD, or a ban closed idle connections,
+                        // instead of one per maintenance cycle. Same for connections
+                        // replacing the ones we had before RELOAD.
+                        if !matches!(reason, ConnectReason::BelowMin | ConnectReason::Prewarm) {
+                            break;
+                        }
+
+                        should_create = self.pool.lock().should_create();
                     }
                 }
 
@@ -213,6 +237,11 @@ impl Monitor {
                                 },
                             )
                         }
+                        ServerAuth::GcpIam => gcp_iam::token(addr.clone()).await.map(
+                            |(token, expires_at)| {
+                                TokenCache::global().set(&addr, token, expires_at)
+                            },
+                        ),
                         ServerAuth::VaultStatic => {
                             vault::static_backend_credentials(addr.clone()).await.map(
                                 |(token, refresh_at)| {
@@ -223,9 +252,14 @@ impl Monitor {
                             )
                         }
                         ServerAuth::VaultDynamic => {
-                            vault::credentials(addr.clone()).await.map(|credentials| {
-                                TokenCache::global().set_credentials(&addr, credentials);
-                                pool.lock().bump_credentials_generation();
+                            vault::refresh(addr.clone()).await.map(|refresh| match refresh {
+                                vault::Refresh::Renewed { refresh_at } => {
+                                    TokenCache::global().set_refresh_at(&addr, refresh_at);
+                                }
+                                vault::Refresh::Rotated(credentials) => {
+                                    TokenCache::global().set_credentials(&addr, credentials);
+                                    pool.lock().bump_credentials_generation();
+                                }
                             })
                         }
                         // Guard in spawn() ensures we only reach here for
@@ -255,14 +289,19 @@ impl Monitor {
     ///
     /// Runs regularly and ensures the pool triggers health checks on idle connections.
     async fn healthchecks(pool: Pool) {
-        let mut tick = interval(pool.lock().config().idle_healthcheck_interval());
+        let mut schedule = HealthcheckSchedule::new(pool.lock().config());
         let comms = pool.comms();
 
         debug!("health checks running [{}]", pool.addr());
 
+        let endpoint = Endpoint::from(pool.addr());
+        let _endpoint = endpoint.register();
+
         loop {
+            let wait = schedule.next();
+
             select! {
-                _ = tick.tick() => {
+                _ = sleep(wait) => {
                     {
                         let guard = pool.lock();
 
@@ -277,7 +316,13 @@ impl Monitor {
                         }
                     }
 
-                    let _ = Self::healthcheck(&pool).await;
+                    // Another pool connected to the same server checked it recently.
+                    let healthy = if pool.healthy() && endpoint.healthy(wait) {
+                        true
+                    } else {
+                        Self::healthcheck(&pool).await.unwrap_or(false)
+                    };
+                    schedule.update(healthy);
                 }
 
 
@@ -339,6 +384,9 @@ impl Monitor {
                 if guard.online {
                     guard.put(server, now)?;
                 }
+                if guard.total() >= guard.prewarm {
+                    guard.prewarm = 0;
+                }
                 Ok(true)
             }
             _ => Ok(false),
@@ -362,6 +410,9 @@ impl Monitor {
     pub async fn healthcheck(pool: &Pool) -> Result<bool, Error> {
         match Self::healthcheck_internal(pool).await {
             Ok(result) => {
+                if result {
+                    Endpoint::from(pool.addr()).record_healthcheck();
+                }
                 pool.inner().health.toggle(result);
                 Ok(result)
             }
@@ -426,9 +477,19 @@ impl Monitor {
         loop {
             select! {
                 _ = interval.tick() => {
-                    {
+                    let event = {
                         let mut lock = pool.lock();
                         lock.stats.calc_averages(duration);
+                        lock.autoscale(duration)
+                    };
+
+                    if let Some(event) = event {
+                        info!("pool autoscaled: {} [{}]", event, pool.addr());
+
+                        // Create connections for waiting clients right away.
+                        if event.to > event.from {
+                            comms.request.notify_one();
+                        }
                     }
                 }
 
@@ -513,6 +574,57 @@ impl Monitor {
     }
 }
 
+/// When to run the next idle healthcheck.
+///
+/// Hosts that failed a healthcheck are checked every `idle_healthcheck_min_interval`.
+/// The interval doubles after each successful healthcheck, up to `idle_healthcheck_max_interval`.
+#[derive(Debug)]
+struct HealthcheckSchedule {
+    min: Duration,
+    max: Duration,
+    current: Duration,
+    first: bool,
+}
+
+impl HealthcheckSchedule {
+    fn new(config: &Config) -> Self {
+        Self {
+            min: config.idle_healthcheck_min_interval(),
+            max: config.idle_healthcheck_max_interval(),
+            current: config.idle_healthcheck_interval(),
+            first: true,
+        }
+    }
+
+    /// How long to wait before the next healthcheck.
+    fn next(&mut self) -> Duration {
+        // Run the first healthcheck right away.
+        if self.first {
+            self.first = false;
+            return Duration::ZERO;
+        }
+
+        // Fixed interval, no jitter.
+        if self.min == self.max {
+            return self.current;
+        }
+
+        // Up to 10% in either direction.
+        let jitter = self.current.as_millis() as i64 / 10;
+        let offset = random::with_rng(|rng| rng.random_range(-jitter..=jitter));
+        Duration::from_millis((self.current.as_millis() as i64 + offset).max(0) as u64)
+    }
+
+    /// Adjust the interval after a healthcheck.
+    fn update(&mut self, healthy: bool) {
+        self.current = if healthy {
+            (self.current * 2).clamp(self.min, self.max)
+        } else {
+            self.min
+        };
+    }
+}
+
 #[cfg(test)]
 mod test {
     use crate::backend::pool::test::pool;
@@ -630,4 +742,59 @@ mod test {
         assert_eq!(pool.lock().total(), initial_total);
         assert!(!pool.lock().online);
     }
+
+    #[test]
+    fn test_healthcheck_schedule() {
+        let config = Config {
+            inner: pgdog_stats::Config {
+                idle_healthcheck_interval: Duration::from_millis(1_000),
+                idle_healthcheck_min_interval: Duration::from_millis(100),
+                idle_healthcheck_max_interval: Duration::from_millis(3_000),
+                ..Config::default().inner
+            },
+        };
+
+        let mut schedule = HealthcheckSchedule::new(&config);
+        assert_eq!(schedule.next(), Duration::ZERO);
+
+        let within = |duration: Duration, expected: u64| {
+            let ms = duration.as_millis() as u64;
+            ms >= expected - expected / 10 && ms <= expected + expected / 10
+        };
+        assert!(within(schedule.next(), 1_000));
+
+        // Healthy hosts are checked less often.
+        schedule.update(true);
+        assert!(within(schedule.next(), 2_000));
+        schedule.update(true);
+        assert!(within(schedule.next(), 3_000));
+        schedule.update(true);
+        assert!(within(schedule.next(), 3_000));
+
+        // Failed hosts are checked often until they recover.
+        schedule.update(false);
+        assert!(within(schedule.next(), 100));
+        schedule.update(true);
+        assert!(within(schedule.next(), 200));
+    }
+
+    #[test]
+    fn test_healthcheck_schedule_fixed() {
+        let config = Config {
+            inner: pgdog_stats::Config {
+                idle_healthcheck_interval: Duration::from_millis(1_000),
+                idle_healthcheck_min_interval: Duration::from_millis(1_000),
+                idle_healthcheck_max_interval: Duration::from_millis(1_000),
+                ..Config::default().inner
+            },
+        };
+
+        let mut schedule = HealthcheckSchedule::new(&config);
+        assert_eq!(schedule.next(), Duration::ZERO);
+
+        for healthy in [true, false, true] {
+            schedule.update(healthy);
+            assert_eq!(schedule.next(), Duration::from_millis(1_000));
+        }
+    }
 }
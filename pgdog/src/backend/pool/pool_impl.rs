@@ -13,15 +13,16 @@ use tokio::time::{Instant, timeout};
 use tracing::{debug, error};
 
 use crate::backend::pool::LsnStats;
+use crate::backend::pool::lsn_history::{LsnHistory, LsnSample};
 use crate::backend::{ConnectReason, DisconnectReason, Server, ServerOptions};
 use crate::config::PoolerMode;
 use crate::net::messages::FrontendPid;
 use crate::net::{Parameter, Parameters};
 
-use super::inner::CheckInResult;
+use super::inner::{CheckInResult, Kill};
 use super::{
-    Address, Comms, Config, Error, Guard, Healtcheck, Inner, Monitor, Oids, PoolConfig, Request,
-    State, Waiting,
+    Address, Autoscaler, Comms, Config, Error, Guard, Healtcheck, Inner, Monitor, Oids, PoolConfig,
+    Request, State, TenantShare, Waiting,
     lb::TargetHealth,
     lsn_monitor::{LsnMonitor, ReplicaLag},
 };
@@ -47,6 +48,7 @@ pub(crate) struct InnerSync {
     pub(super) params: OnceCell<Parameters>,
     pub(super) lsn_stats: RwLock<LsnStats>,
     pub(super) lsn_role_change: Notify,
+    pub(super) lsn_history: Mutex<LsnHistory>,
 }
 
 impl std::fmt::Debug for Pool {
@@ -72,6 +74,7 @@ impl Pool {
                 params: OnceCell::new(),
                 lsn_stats: RwLock::new(LsnStats::default()),
                 lsn_role_change: Notify::new(),
+                lsn_history: Mutex::new(LsnHistory::default()),
             }),
         }
     }
@@ -108,6 +111,8 @@ impl Pool {
     pub async fn get(&self, request: &Request) -> Result<Guard, Error> {
         match timeout(self.config().checkout_timeout, self.get_internal(request)).await {
             Ok(Ok(conn)) => Ok(conn),
+            // The pool is busy, not broken.
+            Ok(Err(err @ Error::TooManyWaiting(_))) => Err(err),
             Err(_) => {
                 self.inner.health.toggle(false);
                 Err(Error::CheckoutTimeout)
@@ -140,6 +145,7 @@ impl Pool {
 
                 if conn.is_some() {
                     guard.stats.counts.wait_time += elapsed;
+                    guard.stats.wait_histogram.record(elapsed);
                     guard.stats.counts.server_assignment_count += 1;
                     if request.read {
                         guard.stats.counts.reads += 1;
@@ -148,11 +154,16 @@ impl Pool {
                     }
                 }
 
-                (conn, granted_at, guard.paused)
+                // Register for the resume notification while holding the lock,
+                // so we don't miss it if the pool is resumed before we start waiting.
+                let paused = guard.paused.then(|| self.comms().ready.notified());
+
+                (conn, granted_at, paused)
             };
 
-            if paused {
-                self.comms().ready.notified().await;
+            // Hold the checkout until the pool is resumed.
+            if let Some(resumed) = paused {
+                resumed.await;
             }
 
             let (mut server, granted_at) = if let Some(server) = server {
@@ -246,6 +257,13 @@ impl Pool {
             counts
         };
 
+        // Average query latency during this checkout, for latency-aware load balancing.
+        if counts.queries > 0 {
+            self.inner
+                .health
+                .record_latency(counts.query_time / counts.queries as u32);
+        }
+
         // Check everything and maybe check the connection
         // into the idle pool.
         let CheckInResult {
@@ -280,6 +298,11 @@ impl Pool {
         Ok(())
     }
 
+    /// Close the server connection with this Postgres pid, if it belongs to this pool.
+    pub(crate) fn kill(&self, pid: i32) -> Option<Kill> {
+        self.lock().kill(pid)
+    }
+
     /// Pool is available to serve connections.
     pub fn available(&self) -> bool {
         let guard = self.lock();
@@ -328,6 +351,16 @@ impl Pool {
         self.addr().compatible(destination.addr())
     }
 
+    /// Open connections in the background until the pool has at least
+    /// this many, e.g. to replace the idle connections of the pool this one
+    /// replaced on RELOAD, so the first clients don't wait for new connections.
+    pub(crate) fn prewarm(&self, connections: usize) {
+        let mut guard = self.lock();
+        if connections > guard.total() {
+            guard.prewarm = connections;
+        }
+    }
+
     /// Pause pool, closing all open connections.
     pub fn pause(&self) {
         let mut guard = self.lock();
@@ -455,6 +488,13 @@ impl Pool {
             });
         }
 
+        if let Some(ref role) = self.addr().server_role {
+            params.push(Parameter {
+                name: "role".into(),
+                value: role.clone().into(),
+            });
+        }
+
         ServerOptions {
             params,
             pool_id: self.id(),
@@ -471,11 +511,26 @@ impl Pool {
         self.lock().replica_lag
     }
 
+    /// Server connection usage of each tenant, if fair sharing is enabled.
+    pub fn fair_shares(&self) -> Vec<TenantShare> {
+        self.lock().fair_shares(Instant::now())
+    }
+
+    /// Pool autoscaler state.
+    pub fn autoscaler(&self) -> Autoscaler {
+        self.lock().autoscaler.clone()
+    }
+
     /// LSN stats
     pub fn lsn_stats(&self) -> LsnStats {
         *self.inner().lsn_stats.read()
     }
 
+    /// Recent LSN samples, oldest first.
+    pub fn lsn_history(&self) -> Vec<LsnSample> {
+        self.inner().lsn_history.lock().samples()
+    }
+
     /// Update pool configuration used in internals.
     #[cfg(test)]
     pub(crate) fn update_config(&self, config: Config) {
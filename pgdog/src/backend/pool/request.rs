@@ -1,13 +1,24 @@
+use std::sync::Arc;
+
+use pgdog_config::Priority;
 use tokio::time::Instant;
 
 use crate::net::messages::FrontendPid;
 
 /// Connection request.
-#[derive(Clone, Debug, Copy)]
+#[derive(Clone, Debug)]
 pub struct Request {
     pub id: FrontendPid,
     pub created_at: Instant,
     pub read: bool,
+    /// Use the slow pool, if there is one.
+    pub slow: bool,
+    /// Tenant sharing the pool with other clients.
+    pub tenant: Option<Arc<str>>,
+    /// Priority when waiting for a connection.
+    pub priority: Priority,
+    /// Send reads to the primary if no replicas are available.
+    pub read_fallback: bool,
 }
 
 impl Request {
@@ -16,14 +27,46 @@ impl Request {
             id,
             created_at: Instant::now(),
             read,
+            slow: false,
+            tenant: None,
+            priority: Priority::default(),
+            read_fallback: false,
         }
     }
 
+    /// Use the slow pool for this request.
+    pub fn slow(mut self, slow: bool) -> Self {
+        self.slow = slow;
+        self
+    }
+
+    /// Tenant making the request, used for fair scheduling.
+    pub fn tenant(mut self, tenant: Option<Arc<str>>) -> Self {
+        self.tenant = tenant;
+        self
+    }
+
+    /// Priority of the client, used when the pool is contended.
+    pub fn priority(mut self, priority: Priority) -> Self {
+        self.priority = priority;
+        self
+    }
+
+    /// Let reads fall back to the primary for this request.
+    pub fn read_fallback(mut self, read_fallback: bool) -> Self {
+        self.read_fallback = read_fallback;
+        self
+    }
+
     pub fn unrouted(id: FrontendPid) -> Self {
         Self {
             id,
             created_at: Instant::now(),
             read: false,
+            slow: false,
+            tenant: None,
+            priority: Priority::default(),
+            read_fallback: false,
         }
     }
 }
@@ -1,8 +1,10 @@
 //! A shard is a collection of replicas and an optional primary.
 
 use arc_swap::ArcSwap;
+use futures::future::join;
 use std::ops::Deref;
 use std::sync::Arc;
+use std::sync::atomic::{AtomicUsize, Ordering};
 use std::time::Duration;
 use tokio::select;
 use tokio::sync::{Notify, OnceCell};
@@ -33,6 +35,10 @@ pub(super) struct ShardConfig<'a> {
     pub(super) primary: &'a Option<PoolConfig>,
     /// Shard replica databases.
     pub(super) replicas: &'a [PoolConfig],
+    /// Slow pool for the primary, if any.
+    pub(super) slow_primary: &'a Option<PoolConfig>,
+    /// Slow pools for the replicas.
+    pub(super) slow_replicas: &'a [PoolConfig],
     /// Load balancing strategy for replicas.
     pub(super) lb_strategy: LoadBalancingStrategy,
     /// Primary/replica read/write split strategy.
@@ -45,6 +51,24 @@ pub(super) struct ShardConfig<'a> {
     pub(super) pub_sub_enabled: bool,
 }
 
+/// Class of queries a connection pool serves.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum PoolClass {
+    /// Regular traffic.
+    Default,
+    /// Long-running queries, e.g. analytics and reports.
+    Slow,
+}
+
+impl std::fmt::Display for PoolClass {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Default => write!(f, "default"),
+            Self::Slow => write!(f, "slow"),
+        }
+    }
+}
+
 /// Connection pools for a single database shard.
 ///
 /// Includes a primary and replicas.
@@ -71,13 +95,36 @@ impl Shard {
 
     /// Get connection to the primary database.
     pub async fn primary(&self, request: &Request) -> Result<Guard, Error> {
-        self.lb.get_primary(request).await
+        self.load_balancer(request).get_primary(request).await
     }
 
     /// Get connection to one of the replica databases, using the configured
     /// load balancing algorithm.
     pub async fn replica(&self, request: &Request) -> Result<Guard, Error> {
-        self.lb.get(request).await
+        self.load_balancer(request).get(request).await
+    }
+
+    /// Get the load balancer for the request. Requests for the slow pool
+    /// use the regular pools if the shard doesn't have one.
+    fn load_balancer(&self, request: &Request) -> &LoadBalancer {
+        match self.slow {
+            Some(ref slow) if request.slow => slow,
+            _ => &self.lb,
+        }
+    }
+
+    /// The shard has a separate pool for long-running queries.
+    pub fn has_slow_pool(&self) -> bool {
+        self.slow.is_some()
+    }
+
+    /// Get the slow pools, if any.
+    pub fn slow_pools(&self) -> Vec<Pool> {
+        self.slow
+            .iter()
+            .flat_map(|slow| slow.pools())
+            .cloned()
+            .collect()
     }
 
     /// Get connection to primary if configured, otherwise replica.
@@ -95,6 +142,10 @@ impl Shard {
     pub fn move_conns_to(&self, destination: &Shard) -> Result<(), Error> {
         self.lb.move_conns_to(&destination.lb)?;
 
+        if let (Some(from), Some(to)) = (&self.slow, &destination.slow) {
+            from.move_conns_to(to)?;
+        }
+
         Ok(())
     }
 
@@ -165,6 +216,9 @@ impl Shard {
     /// Bring every pool online.
     pub fn launch(&self) {
         self.lb.launch();
+        if let Some(ref slow) = self.slow {
+            slow.launch();
+        }
         ShardMonitor::run(self);
         self.init_pub_sub();
     }
@@ -192,9 +246,15 @@ impl Shard {
     /// If these connection pools aren't running the query sent by this client, this is a no-op.
     ///
     pub async fn cancel(&self, id: FrontendPid) -> Result<(), super::super::Error> {
-        self.lb.cancel(id).await?;
+        let slow = async {
+            match self.slow {
+                Some(ref slow) => slow.cancel(id).await,
+                None => Ok(()),
+            }
+        };
+        let (lb, slow) = join(self.lb.cancel(id), slow).await;
 
-        Ok(())
+        lb.and(slow)
     }
 
     /// Get all connection pools.
@@ -229,11 +289,31 @@ impl Shard {
         self.lb.pools_with_roles_and_bans()
     }
 
+    /// Get all connection pools, including the slow pools, with the class
+    /// of queries they serve, their role in the shard and their bans.
+    pub fn pools_with_classes(&self) -> Vec<(PoolClass, Role, Ban, Pool)> {
+        let default = self
+            .lb
+            .pools_with_roles_and_bans()
+            .into_iter()
+            .map(|(role, ban, pool)| (PoolClass::Default, role, ban, pool));
+        let slow = self
+            .slow
+            .iter()
+            .flat_map(|slow| slow.pools_with_roles_and_bans())
+            .map(|(role, ban, pool)| (PoolClass::Slow, role, ban, pool));
+
+        default.chain(slow).collect()
+    }
+
     /// Shutdown every pool and maintenance task in this shard.
     pub fn shutdown(&self) {
         self.comms.shutdown.cancel();
         self.shutdown_pub_sub();
         self.lb.shutdown();
+        if let Some(ref slow) = self.slow {
+            slow.shutdown();
+        }
     }
 
     fn comms(&self) -> &ShardComms {
@@ -244,6 +324,16 @@ impl Shard {
         self.number
     }
 
+    /// Record a query or connection error on this shard.
+    pub fn error(&self) {
+        self.errors.fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// Number of errors recorded on this shard.
+    pub fn errors(&self) -> usize {
+        self.errors.load(Ordering::Relaxed)
+    }
+
     pub fn identifier(&self) -> &User {
         &self.identifier
     }
@@ -256,7 +346,13 @@ impl Shard {
     /// Re-detect primary/replica roles and re-build
     /// the shard routing logic.
     pub fn redetect_roles(&self) -> bool {
-        self.lb.redetect_roles()
+        let promoted = self.lb.redetect_roles();
+
+        if let Some(ref slow) = self.slow {
+            slow.copy_roles(&self.lb);
+        }
+
+        promoted
     }
 
     /// Get parameters from first available connection pool.
@@ -307,12 +403,14 @@ impl Deref for Shard {
 pub struct ShardInner {
     number: usize,
     lb: LoadBalancer,
+    slow: Option<LoadBalancer>,
     comms: Arc<ShardComms>,
     pub_sub: Arc<ArcSwap<Option<PubSubListener>>>,
     identifier: Arc<User>,
     schema: Arc<OnceCell<Schema>>,
     schema_waiter: Notify,
     pub_sub_enabled: bool,
+    errors: AtomicUsize,
 }
 
 impl ShardInner {
@@ -321,6 +419,8 @@ impl ShardInner {
             number,
             primary,
             replicas,
+            slow_primary,
+            slow_replicas,
             lb_strategy,
             rw_split,
             identifier,
@@ -329,6 +429,10 @@ impl ShardInner {
         } = shard;
         let primary = primary.as_ref().map(Pool::new);
         let lb = LoadBalancer::new(&primary, replicas, lb_strategy, rw_split);
+
+        let slow_primary = slow_primary.as_ref().map(Pool::new);
+        let slow = (slow_primary.is_some() || !slow_replicas.is_empty())
+            .then(|| LoadBalancer::new(&slow_primary, slow_replicas, lb_strategy, rw_split));
         let comms = Arc::new(ShardComms {
             shutdown: CancellationToken::new(),
             lsn_check_interval,
@@ -337,12 +441,14 @@ impl ShardInner {
         Self {
             number,
             lb,
+            slow,
             comms,
             pub_sub: Arc::new(ArcSwap::new(Arc::new(None))),
             identifier,
             schema: Arc::new(OnceCell::new()),
             schema_waiter: Notify::new(),
             pub_sub_enabled,
+            errors: AtomicUsize::new(0),
         }
     }
 }
@@ -376,6 +482,8 @@ mod test {
             number: 0,
             primary,
             replicas,
+            slow_primary: &None,
+            slow_replicas: &[],
             lb_strategy: LoadBalancingStrategy::Random,
             rw_split: ReadWriteSplit::ExcludePrimary,
             identifier: Arc::new(User {
@@ -415,6 +523,8 @@ mod test {
             number: 0,
             primary,
             replicas,
+            slow_primary: &None,
+            slow_replicas: &[],
             lb_strategy: LoadBalancingStrategy::Random,
             rw_split: ReadWriteSplit::IncludePrimary,
             identifier: Arc::new(User {
@@ -436,4 +546,51 @@ mod test {
 
         assert_eq!(ids.len(), 2);
     }
+
+    #[tokio::test]
+    async fn test_slow_pool() {
+        crate::logger();
+
+        let primary = &Some(PoolConfig {
+            address: Address::new_test(),
+            ..Default::default()
+        });
+
+        let slow_primary = &Some(PoolConfig {
+            address: Address::new_test(),
+            ..Default::default()
+        });
+
+        let shard = Shard::new(ShardConfig {
+            number: 0,
+            primary,
+            replicas: &[],
+            slow_primary,
+            slow_replicas: &[],
+            lb_strategy: LoadBalancingStrategy::Random,
+            rw_split: ReadWriteSplit::IncludePrimary,
+            identifier: Arc::new(User {
+                user: "pgdog".into(),
+                database: "pgdog".into(),
+            }),
+            lsn_check_interval: Duration::MAX,
+            pub_sub_enabled: false,
+        });
+        shard.launch();
+
+        assert!(shard.has_slow_pool());
+        let slow_id = shard.slow_pools()[0].id();
+        let regular_id = shard.pools()[0].id();
+        assert_ne!(slow_id, regular_id);
+
+        let conn = shard.primary(&Request::default().slow(true)).await.unwrap();
+        assert_eq!(conn.pool.id(), slow_id);
+        drop(conn);
+
+        let conn = shard.primary(&Request::default()).await.unwrap();
+        assert_eq!(conn.pool.id(), regular_id);
+        drop(conn);
+
+        shard.shutdown();
+    }
 }
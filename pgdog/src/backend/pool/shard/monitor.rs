@@ -292,6 +292,8 @@ mod test {
             number: 0,
             primary: &primary,
             replicas: &replicas,
+            slow_primary: &None,
+            slow_replicas: &[],
             lb_strategy: LoadBalancingStrategy::Random,
             rw_split: ReadWriteSplit::ExcludePrimary,
             identifier: Arc::new(User {
@@ -60,4 +60,15 @@ impl State {
             },
         }
     }
+
+    /// Progress of `PAUSE`: `running` if the pool isn't paused,
+    /// `pausing` while checked out connections are finishing their transactions,
+    /// and `paused` once all of them have been returned.
+    pub fn pause_state(&self) -> &'static str {
+        match (self.paused, self.checked_out) {
+            (false, _) => "running",
+            (true, 0) => "paused",
+            (true, _) => "pausing",
+        }
+    }
 }
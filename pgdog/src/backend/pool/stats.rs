@@ -170,6 +170,7 @@ mod tests {
             parse_count: 15,
             bind_count: 18,
             rollbacks: 2,
+            idle_xact_timeouts: 1,
             healthchecks: 1,
             close: 4,
             errors: 3,
@@ -197,6 +198,7 @@ mod tests {
             parse_count: 8,
             bind_count: 9,
             rollbacks: 1,
+            idle_xact_timeouts: 2,
             healthchecks: 2,
             close: 3,
             errors: 1,
@@ -253,6 +255,7 @@ mod tests {
             parse_count: 15,
             bind_count: 18,
             rollbacks: 2,
+            idle_xact_timeouts: 3,
             healthchecks: 4,
             close: 5,
             errors: 3,
@@ -280,6 +283,7 @@ mod tests {
             parse_count: 8,
             bind_count: 9,
             rollbacks: 1,
+            idle_xact_timeouts: 4,
             healthchecks: 2,
             close: 3,
             errors: 1,
@@ -358,6 +362,7 @@ mod tests {
             parse_count: 15,
             bind_count: 18,
             rollbacks: 2,
+            idle_xact_timeouts: 5,
             healthchecks: 8,
             close: 12,
             errors: 3,
@@ -429,6 +434,7 @@ mod tests {
             parse_count: 15,
             bind_count: 18,
             rollbacks: 2,
+            idle_xact_timeouts: 6,
             healthchecks: 1,
             close: 4,
             errors: 3,
@@ -449,6 +455,7 @@ mod tests {
             transactions_2pc: 2,
             queries: 10,
             rollbacks: 1,
+            idle_xact_timeouts: 7,
             errors: 2,
             prepared_statements: 0,
             query_time: Duration::from_secs(2),
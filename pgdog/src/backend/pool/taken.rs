@@ -73,6 +73,14 @@ impl Taken {
         self.frontend_to_cancel.get(&frontend).map(|c| &c.key)
     }
 
+    /// Backend connection with this Postgres pid and the frontend holding it.
+    pub(super) fn find(&self, pid: i32) -> Option<(BackendPid, FrontendPid)> {
+        self.backend_to_frontend
+            .iter()
+            .find(|(backend, _)| backend.pid() == pid)
+            .map(|(backend, frontend)| (*backend, *frontend))
+    }
+
     /// All cancel keys for currently checked-out backend connections. For
     /// frontends with multiple concurrent checkouts, only the latest is
     /// returned (matches prior behavior).
@@ -114,10 +122,12 @@ mod tests {
         assert_eq!(taken.len(), 1);
         assert_eq!(taken.cancel_key(frontend), Some(&cancel_key));
         assert_eq!(taken.cancel_keys().count(), 1);
+        assert_eq!(taken.find(backend.pid()), Some((backend, frontend)));
 
         taken.check_in(backend).unwrap();
         assert!(taken.is_empty());
         assert_eq!(taken.cancel_key(frontend), None);
+        assert_eq!(taken.find(backend.pid()), None);
     }
 
     #[test]
@@ -168,6 +168,27 @@ async fn test_offline() {
     err.expect_err("pool is shut down");
 }
 
+#[tokio::test]
+async fn test_pause_state() {
+    let pool = pool();
+
+    let conn = pool.get(&Request::default()).await.unwrap();
+    assert_eq!(pool.state().pause_state(), "running");
+
+    // In-flight connection is allowed to finish.
+    pool.pause();
+    assert_eq!(pool.state().pause_state(), "pausing");
+
+    drop(conn);
+    sleep(Duration::from_millis(100)).await;
+    assert_eq!(pool.state().pause_state(), "paused");
+    assert_eq!(pool.state().total, 0);
+
+    pool.resume();
+    assert_eq!(pool.state().pause_state(), "running");
+    assert!(pool.get(&Request::default()).await.is_ok());
+}
+
 #[tokio::test]
 async fn test_pause() {
     let pool = pool();
@@ -358,6 +379,43 @@ async fn test_server_force_close_discards_connection() {
     assert_eq!(state.total, 0);
 }
 
+#[tokio::test]
+async fn test_kill_server() {
+    let pool = pool();
+
+    let request = Request::default();
+    let conn = pool.get(&request).await.unwrap();
+    let checked_out = conn.id();
+    assert_eq!(
+        pool.kill(checked_out.pid()),
+        Some(inner::Kill::CheckedOut(request.id))
+    );
+
+    // Closed when returned instead of going back to the pool.
+    drop(conn);
+    sleep(Duration::from_millis(100)).await;
+    assert!(
+        pool.lock()
+            .idle_conns()
+            .iter()
+            .all(|conn| conn.id() != checked_out)
+    );
+
+    let conn = pool.get(&Request::default()).await.unwrap();
+    let idle = conn.id();
+    drop(conn);
+    sleep(Duration::from_millis(100)).await;
+
+    assert_eq!(pool.kill(idle.pid()), Some(inner::Kill::Closed));
+    assert!(
+        pool.lock()
+            .idle_conns()
+            .iter()
+            .all(|conn| conn.id() != idle)
+    );
+    assert_eq!(pool.kill(idle.pid()), None);
+}
+
 #[tokio::test]
 async fn test_query_stats() {
     let pool = pool();
@@ -483,6 +541,79 @@ async fn test_prepared_statements_limit() {
     assert_eq!(guard.stats().total().prepared_statements, 100); // stats are accurate.
 }
 
+#[tokio::test]
+async fn test_min_pool_size_warm_up() {
+    crate::logger();
+
+    let config = Config {
+        inner: pgdog_stats::Config {
+            max: 10,
+            min: 5,
+            ..Config::default().inner
+        },
+    };
+
+    let pool = Pool::new(&PoolConfig {
+        address: Address {
+            host: "127.0.0.1".into(),
+            port: 5432,
+            database_name: "pgdog".into(),
+            user: "pgdog".into(),
+            passwords: vec!["pgdog".into()],
+            ..Default::default()
+        },
+        config,
+    });
+    pool.launch();
+
+    // All connections are created in one maintenance cycle.
+    sleep(Duration::from_millis(500)).await;
+    assert_eq!(pool.lock().idle(), 5);
+
+    // Pool is warmed up again after losing its connections.
+    pool.lock().dump_idle();
+    assert_eq!(pool.lock().idle(), 0);
+
+    sleep(Duration::from_millis(500)).await;
+    assert_eq!(pool.lock().idle(), 5);
+}
+
+#[tokio::test]
+async fn test_prewarm() {
+    crate::logger();
+
+    let config = Config {
+        inner: pgdog_stats::Config {
+            max: 10,
+            min: 1,
+            ..Config::default().inner
+        },
+    };
+
+    let pool = Pool::new(&PoolConfig {
+        address: Address {
+            host: "127.0.0.1".into(),
+            port: 5432,
+            database_name: "pgdog".into(),
+            user: "pgdog".into(),
+            passwords: vec!["pgdog".into()],
+            ..Default::default()
+        },
+        config,
+    });
+    pool.prewarm(4);
+    pool.launch();
+
+    sleep(Duration::from_millis(500)).await;
+    assert_eq!(pool.lock().idle(), 4);
+    assert_eq!(pool.lock().prewarm, 0);
+
+    // Prewarmed connections are not re-created once closed.
+    pool.lock().dump_idle();
+    sleep(Duration::from_millis(500)).await;
+    assert_eq!(pool.lock().idle(), 1);
+}
+
 #[tokio::test]
 async fn test_idle_healthcheck_loop() {
     crate::logger();
@@ -597,6 +728,56 @@ async fn test_checkout_timeout() {
     assert!(pool.lock().waiting.is_empty());
 }
 
+#[tokio::test]
+async fn test_fair_share_between_tenants() {
+    let config = Config {
+        inner: pgdog_stats::Config {
+            max: 1,
+            min: 1,
+            fair_share_window: Some(Duration::from_secs(60)),
+            ..Config::default().inner
+        },
+    };
+
+    let pool = Pool::new(&PoolConfig {
+        address: Address::new_test(),
+        config,
+    });
+    pool.launch();
+
+    let request = |tenant: &str| {
+        Request::new(crate::net::messages::FrontendPid::new(), false).tenant(Some(tenant.into()))
+    };
+
+    // Tenant "a" holds the only connection for a while.
+    let conn = pool.get(&request("a")).await.unwrap();
+    sleep(Duration::from_millis(100)).await;
+
+    let served = Arc::new(parking_lot::Mutex::new(vec![]));
+    let tracker = TaskTracker::new();
+
+    // "a" queues up first.
+    for tenant in ["a", "b"] {
+        let pool = pool.clone();
+        let served = served.clone();
+        let request = request(tenant);
+        tracker.spawn(async move {
+            let _conn = pool.get(&request).await.unwrap();
+            served.lock().push(tenant);
+        });
+        sleep(Duration::from_millis(10)).await;
+    }
+
+    drop(conn);
+    tracker.close();
+    tracker.wait().await;
+
+    // "b" used the pool the least, so it's served first.
+    assert_eq!(served.lock().as_slice(), &["b", "a"]);
+
+    pool.shutdown();
+}
+
 #[tokio::test]
 async fn test_move_conns_to() {
     crate::logger();
@@ -199,6 +199,17 @@ impl TokenCache {
             .insert(CacheKey::from(addr), fetched.into());
     }
 
+    /// Move the refresh instant of the cached credentials for `addr`,
+    /// keeping the credentials themselves.
+    ///
+    /// Used after a Vault lease renewal, which extends the lifetime
+    /// of the credentials already in use.
+    pub fn set_refresh_at(&self, addr: &Address, refresh_at: Instant) {
+        if let Some(cached) = self.inner.lock().get_mut(&CacheKey::from(addr)) {
+            cached.refresh_at = Some(refresh_at);
+        }
+    }
+
     /// Remove the cached token for `addr`.
     ///
     /// Called by the monitor when a refresh fails, so the next
@@ -382,6 +393,37 @@ mod tests {
         cache().evict(&a);
     }
 
+    #[test]
+    fn set_refresh_at_keeps_credentials() {
+        let rt = tokio::runtime::Runtime::new().unwrap();
+        let a = addr(9924);
+        let now = Instant::now();
+        cache().set_credentials(
+            &a,
+            FetchedCredentials {
+                credentials: Credentials {
+                    username: Some("vault-user".into()),
+                    secret: "vault-pass".into(),
+                },
+                expires_at: None,
+                refresh_at: Some(now),
+            },
+        );
+        cache().set_refresh_at(&a, now + Duration::from_secs(100));
+
+        let d = cache().refresh_in(&a);
+        assert!(d > Duration::from_secs(95), "expected ~100s, got {d:?}");
+
+        let credentials = rt
+            .block_on(cache().credentials_or_fetch(&a, |_| async {
+                panic!("fetcher must not be called on a cache hit");
+            }))
+            .unwrap();
+        assert_eq!(credentials.username.as_deref(), Some("vault-user"));
+        assert_eq!(credentials.secret, "vault-pass");
+        cache().evict(&a);
+    }
+
     #[test]
     fn refresh_in_returns_zero_for_past_refresh_at() {
         let a = addr(9920);
@@ -24,7 +24,7 @@ impl Waiting {
     /// N.B. You must call and await `Waiting::wait`, otherwise you'll leak waiters.
     ///
     pub(super) fn new(pool: Pool, request: &Request) -> Result<Self, Error> {
-        let request = *request;
+        let request = request.clone();
         let (tx, rx) = channel();
 
         let full = {
@@ -32,12 +32,21 @@ impl Waiting {
             if !guard.online {
                 return Err(Error::Offline);
             }
+            // Shed load instead of piling up clients until checkout timeout.
+            if let Some(max) = guard.config.max_waiting_clients
+                && guard.waiting.len() >= max
+            {
+                return Err(Error::TooManyWaiting(max));
+            }
             if request.read {
                 guard.stats.counts.reads += 1;
             } else {
                 guard.stats.counts.writes += 1;
             }
-            guard.waiting.push_back(Waiter { request, tx });
+            guard.waiting.push_back(Waiter {
+                request: request.clone(),
+                tx,
+            });
             guard.full()
         };
 
@@ -183,4 +192,24 @@ mod tests {
             "Waiter should be removed on timeout"
         );
     }
+
+    #[tokio::test]
+    async fn test_max_waiting_clients() {
+        let mut config = crate::backend::pool::Config::default();
+        config.inner.max_waiting_clients = Some(2);
+
+        let pool = Pool::new(&crate::backend::pool::PoolConfig {
+            address: crate::backend::pool::Address::new_test(),
+            config,
+        });
+        // Don't launch, nothing will serve the waiters.
+        pool.lock().online = true;
+
+        let _first = Waiting::new(pool.clone(), &Request::unrouted(FrontendPid::new())).unwrap();
+        let _second = Waiting::new(pool.clone(), &Request::unrouted(FrontendPid::new())).unwrap();
+
+        let err = Waiting::new(pool.clone(), &Request::unrouted(FrontendPid::new())).err();
+        assert_eq!(err, Some(Error::TooManyWaiting(2)));
+        assert_eq!(pool.lock().waiting.len(), 2);
+    }
 }
@@ -103,6 +103,12 @@ impl PreparedStatements {
                 self.state.add_ignore('1');
                 Ok(())
             }
+            // Queries we run ahead of the client's, e.g. `SET statement_timeout`.
+            ProtocolMessage::Query(_) => {
+                self.state.add_ignore('C');
+                self.state.add_ignore('Z');
+                Ok(())
+            }
             _ => Err(Error::UnsupportedHandleIgnore(request.code())),
         }
     }
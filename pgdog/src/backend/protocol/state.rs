@@ -155,11 +155,15 @@ impl ProtocolState {
             ExecutionCode::Error => {
                 if !self.extended {
                     // A simple-query error only aborts the current simple query.
-                    // Keep any later pipelined simple query RFQs queued.
-                    while !self.queue.is_empty()
-                        && self.queue.front()
-                            != Some(&ExecutionItem::Code(ExecutionCode::ReadyForQuery))
-                    {
+                    // Keep any later pipelined simple query RFQs queued,
+                    // including the ones we ignore.
+                    while !matches!(
+                        self.queue.front(),
+                        None | Some(
+                            ExecutionItem::Code(ExecutionCode::ReadyForQuery)
+                                | ExecutionItem::Ignore(ExecutionCode::ReadyForQuery)
+                        )
+                    ) {
                         self.queue.pop_front();
                     }
                     return Ok(Action::Forward);
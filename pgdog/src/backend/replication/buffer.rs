@@ -83,11 +83,20 @@ impl Buffer {
                         let column = self
                             .replication_config
                             .sharded_column(table, &columns)
-                            .and_then(|column| update.column(column.position))
-                            .and_then(|column| column.as_str());
-                        if let Some(column) = column {
-                            let shard =
-                                shard_str(column, &self.sharding_schema, &vec![], CENTROID_PROBES);
+                            .and_then(|column| {
+                                update
+                                    .column(column.position)
+                                    .and_then(|value| value.as_str())
+                                    .map(|value| (value, column.hasher))
+                            });
+                        if let Some((column, hasher)) = column {
+                            let shard = shard_str(
+                                column,
+                                &self.sharding_schema,
+                                &vec![],
+                                CENTROID_PROBES,
+                                hasher,
+                            );
                             if self.shard == shard {
                                 self.message = Some(xlog_data);
                                 return self.flush();
@@ -102,11 +111,20 @@ impl Buffer {
                         let column = self
                             .replication_config
                             .sharded_column(table, &columns)
-                            .and_then(|column| insert.column(column.position))
-                            .and_then(|column| column.as_str());
-                        if let Some(column) = column {
-                            let shard =
-                                shard_str(column, &self.sharding_schema, &vec![], CENTROID_PROBES);
+                            .and_then(|column| {
+                                insert
+                                    .column(column.position)
+                                    .and_then(|value| value.as_str())
+                                    .map(|value| (value, column.hasher))
+                            });
+                        if let Some((column, hasher)) = column {
+                            let shard = shard_str(
+                                column,
+                                &self.sharding_schema,
+                                &vec![],
+                                CENTROID_PROBES,
+                                hasher,
+                            );
                             if self.shard == shard {
                                 self.message = Some(xlog_data);
                                 return self.flush();
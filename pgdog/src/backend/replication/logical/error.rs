@@ -178,6 +178,12 @@ pub enum Error {
     #[error("replication has been aborted")]
     ReplicationAborted,
 
+    #[error("moving range has been aborted")]
+    MoveRangeAborted,
+
+    #[error("clients didn't return their connections in {0}ms, moving range has been aborted")]
+    MoveRangePauseTimeout(u64),
+
     #[error("waiter has no publisher")]
     NoPublisher,
 
@@ -55,7 +55,7 @@ impl Copy {
             match msg.code() {
                 'd' => {
                     let data = CopyData::from_bytes(msg.to_bytes())?;
-                    trace!("[{}] --> {:?}", server.addr().addr().await?, data);
+                    trace!("[{}] --> {:?}", server.addr(), data);
                     return Ok(Some(data));
                 }
                 'C' => (),
@@ -166,9 +166,19 @@ pub struct PublicationTableColumn {
 
 impl PublicationTableColumn {
     pub async fn load(identity: &ReplicaIdentity, server: &mut Server) -> Result<Vec<Self>, Error> {
+        // Generated columns don't exist before Postgres 12.
+        let columns = if server
+            .version()
+            .is_none_or(|version| version.generated_columns())
+        {
+            COLUMNS.to_string()
+        } else {
+            COLUMNS.replace(" AND a.attgenerated = ''", "")
+        };
+
         Ok(server
             .fetch_all(
-                COLUMNS
+                columns
                     .replace("$1", &identity.oid.to_string())
                     .replace("$2", &identity.oid.to_string()),
             )
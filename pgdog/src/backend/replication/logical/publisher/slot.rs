@@ -2,7 +2,7 @@ use super::super::Error;
 use super::super::status::ReplicationSlot as ReplicationSlotTracker;
 use crate::config::config;
 use crate::{
-    backend::{self, ConnectReason, Server, ServerOptions, pool::Address},
+    backend::{self, ConnectReason, Server, ServerOptions, ServerVersion, pool::Address},
     frontend::client::query_engine::two_pc::TwoPcTransactions,
     net::{
         CopyData, CopyDone, DataRow, ErrorResponse, Format, FromBytes, Protocol, Query, ToBytes,
@@ -34,13 +34,24 @@ pub enum SlotKind {
 impl Display for Snapshot {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
         match self {
-            Self::Export => write!(f, "snapshot"),
+            Self::Export => write!(f, "export"),
             Self::Use => write!(f, "use"),
             Self::Nothing => write!(f, "nothing"),
         }
     }
 }
 
+impl Snapshot {
+    /// Option for `CREATE_REPLICATION_SLOT` before Postgres 15.
+    fn legacy_option(&self) -> &'static str {
+        match self {
+            Self::Export => "EXPORT_SNAPSHOT",
+            Self::Use => "USE_SNAPSHOT",
+            Self::Nothing => "NOEXPORT_SNAPSHOT",
+        }
+    }
+}
+
 #[derive(Debug)]
 pub struct ReplicationSlot {
     address: Address,
@@ -159,6 +170,12 @@ impl ReplicationSlot {
         self.server.as_mut().ok_or(Error::NotConnected)
     }
 
+    /// Version of the replication server, if it reported one.
+    /// Replication commands change between versions.
+    fn version(&self) -> Option<ServerVersion> {
+        self.server.as_ref().and_then(|server| server.version())
+    }
+
     /// Create the slot.
     pub async fn create_slot(&mut self) -> Result<Lsn, Error> {
         if self.server.is_none() {
@@ -186,16 +203,27 @@ impl ReplicationSlot {
                 .await?;
         }
 
-        let start_replication = format!(
-            r#"CREATE_REPLICATION_SLOT "{}" {} LOGICAL "pgoutput" (SNAPSHOT '{}')"#,
-            self.name,
-            if self.kind == SlotKind::DataSync {
-                "TEMPORARY"
-            } else {
-                ""
-            },
-            self.snapshot
-        );
+        let temporary = if self.kind == SlotKind::DataSync {
+            "TEMPORARY"
+        } else {
+            ""
+        };
+        let start_replication = if self
+            .version()
+            .is_none_or(|version| version.replication_command_options())
+        {
+            format!(
+                r#"CREATE_REPLICATION_SLOT "{}" {} LOGICAL "pgoutput" (SNAPSHOT '{}')"#,
+                self.name, temporary, self.snapshot
+            )
+        } else {
+            format!(
+                r#"CREATE_REPLICATION_SLOT "{}" {} LOGICAL "pgoutput" {}"#,
+                self.name,
+                temporary,
+                self.snapshot.legacy_option()
+            )
+        };
 
         let existing_slot = format!(
             "
@@ -292,6 +320,11 @@ impl ReplicationSlot {
     }
 
     fn drop_slot_query(&self, wait: bool) -> String {
+        let wait = wait
+            && self
+                .version()
+                .is_none_or(|version| version.drop_slot_wait());
+
         format!(
             r#"DROP_REPLICATION_SLOT "{}" {}"#,
             self.name,
@@ -304,11 +337,7 @@ impl ReplicationSlot {
         // Fresh copy stream (including after a reconnect): re-enable status updates.
         self.stopped = false;
         let is_binary = config().config.general.resharding_copy_format == CopyFormat::Binary;
-        // TODO: This is definitely Postgres version-specific.
-        let query = Query::new(format!(
-            r#"START_REPLICATION SLOT "{}" LOGICAL {} ("proto_version" '4', origin 'any', "publication_names" '"{}"', "binary" '{}')"#,
-            self.name, self.lsn, self.publication, is_binary
-        ));
+        let query = Query::new(self.start_replication_query(is_binary));
         self.server()?.send(&vec![query.into()].into()).await?;
 
         let copy_both = self.server()?.read().await?;
@@ -327,6 +356,33 @@ impl ReplicationSlot {
         Ok(())
     }
 
+    /// Ask for the latest `pgoutput` protocol and options the server supports.
+    /// Servers that don't report their version are assumed to be recent. Before
+    /// Postgres 14, rows are always sent as text.
+    fn start_replication_query(&self, is_binary: bool) -> String {
+        let version = self.version();
+        let supports = |feature: fn(&ServerVersion) -> bool| version.is_none_or(|v| feature(&v));
+
+        let mut options = vec![format!(
+            r#""proto_version" '{}'"#,
+            version.map_or(4, |version| version.pgoutput_protocol())
+        )];
+        if supports(ServerVersion::pgoutput_origin) {
+            options.push("origin 'any'".into());
+        }
+        options.push(format!(r#""publication_names" '"{}"'"#, self.publication));
+        if supports(ServerVersion::pgoutput_binary) {
+            options.push(format!(r#""binary" '{}'"#, is_binary));
+        }
+
+        format!(
+            r#"START_REPLICATION SLOT "{}" LOGICAL {} ({})"#,
+            self.name,
+            self.lsn,
+            options.join(", ")
+        )
+    }
+
     /// Replicate from slot until finished.
     pub async fn replicate(
         &mut self,
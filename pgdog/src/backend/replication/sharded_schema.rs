@@ -1,7 +1,7 @@
 use pgdog_config::sharding::ShardedSchema;
-use std::{collections::HashMap, ops::Deref, sync::Arc};
+use std::{borrow::Cow, collections::HashMap, ops::Deref, sync::Arc};
 
-use crate::frontend::router::parser::Schema;
+use crate::frontend::router::{parser::Schema, sharding::varchar};
 
 #[derive(Debug, Clone)]
 pub struct ShardedSchemas {
@@ -10,25 +10,59 @@ pub struct ShardedSchemas {
 
 #[derive(Debug)]
 struct Inner {
+    /// All mappings except the default one, including `tenant_*` patterns,
+    /// so a cluster with only patterns isn't treated as having no sharded schemas.
     schemas: HashMap<String, ShardedSchema>,
+    /// `tenant_*` style mappings, longest prefix first.
+    patterns: Vec<ShardedSchema>,
     default_mapping: Option<ShardedSchema>,
+    shards: usize,
 }
 
 impl Inner {
-    fn new(schemas: Vec<ShardedSchema>) -> Self {
+    fn new(schemas: Vec<ShardedSchema>, shards: usize) -> Self {
         let without_default = schemas
             .iter()
             .filter(|schema| !schema.is_default())
             .cloned();
         let default_mapping = schemas.iter().find(|schema| schema.is_default()).cloned();
+        let mut patterns = schemas
+            .iter()
+            .filter(|schema| schema.prefix().is_some())
+            .cloned()
+            .collect::<Vec<_>>();
+        patterns.sort_by_key(|schema| std::cmp::Reverse(schema.name().len()));
 
         Self {
             schemas: without_default
                 .into_iter()
                 .map(|schema| (schema.name().to_string(), schema))
                 .collect(),
+            patterns,
             default_mapping,
+            shards: shards.max(1),
+        }
+    }
+
+    /// Resolve the mapping for the schema. Patterns take the schema's name
+    /// and hashed mappings get their shard computed.
+    fn resolve<'a>(&self, mapping: &'a ShardedSchema, name: &str) -> Cow<'a, ShardedSchema> {
+        let hash = mapping.hash && !mapping.all;
+
+        if mapping.prefix().is_none() && !hash {
+            return Cow::Borrowed(mapping);
         }
+
+        Cow::Owned(ShardedSchema {
+            name: Some(name.to_owned()),
+            shard: if hash {
+                varchar(name.as_bytes()) as usize % self.shards
+            } else {
+                mapping.shard
+            },
+            hash: false,
+            ..mapping.clone()
+        })
     }
 }
 
@@ -41,25 +75,86 @@ impl Deref for ShardedSchemas {
 }
 
 impl ShardedSchemas {
-    pub fn get<'a>(&self, schema: Option<Schema<'a>>) -> Option<&ShardedSchema> {
-        if let Some(schema) = schema
-            && let Some(schema) = self.inner.schemas.get(schema.name)
-        {
-            return Some(schema);
+    /// Get the mapping for a schema. Exact names are checked first,
+    /// then `tenant_*` prefixes, then the default mapping.
+    pub fn get<'a>(&self, schema: Option<Schema<'a>>) -> Option<Cow<'_, ShardedSchema>> {
+        if let Some(schema) = schema {
+            if let Some(mapping) = self.inner.schemas.get(schema.name) {
+                return Some(self.inner.resolve(mapping, schema.name));
+            }
+
+            if let Some(mapping) = self.inner.patterns.iter().find(|mapping| {
+                mapping
+                    .prefix()
+                    .is_some_and(|prefix| schema.name.starts_with(prefix))
+            }) {
+                return Some(self.inner.resolve(mapping, schema.name));
+            }
         }
 
-        self.inner.default_mapping.as_ref()
+        self.inner.default_mapping.as_ref().map(Cow::Borrowed)
     }
 
-    pub fn new(schemas: Vec<ShardedSchema>) -> Self {
+    /// Create schema mappings for a cluster with `shards` shards.
+    pub fn new(schemas: Vec<ShardedSchema>, shards: usize) -> Self {
         Self {
-            inner: Arc::new(Inner::new(schemas)),
+            inner: Arc::new(Inner::new(schemas, shards)),
         }
     }
 }
 
 impl Default for ShardedSchemas {
     fn default() -> Self {
-        Self::new(vec![])
+        Self::new(vec![], 1)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    fn schema(name: Option<&str>, shard: usize, hash: bool) -> ShardedSchema {
+        ShardedSchema {
+            database: "pgdog".into(),
+            name: name.map(String::from),
+            shard,
+            hash,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_tenant_patterns() {
+        let schemas = ShardedSchemas::new(
+            vec![
+                schema(Some("tenant_*"), 0, true),
+                schema(Some("tenant_eu_*"), 2, false),
+                schema(Some("tenant_vip"), 1, false),
+                schema(None, 0, false),
+            ],
+            4,
+        );
+        let get = |name| schemas.get(Some(Schema { name })).unwrap();
+
+        // Exact name wins over the pattern.
+        assert_eq!(get("tenant_vip").shard(), Some(1));
+
+        // Longest prefix wins.
+        let eu = get("tenant_eu_acme");
+        assert_eq!(eu.shard(), Some(2));
+        assert_eq!(eu.name(), "tenant_eu_acme");
+
+        // Hashed by schema name, same as a text sharding key.
+        let hashed = get("tenant_acme");
+        assert_eq!(hashed.name(), "tenant_acme");
+        assert_eq!(hashed.shard(), Some(varchar(b"tenant_acme") as usize % 4));
+        assert_eq!(get("tenant_acme").shard(), hashed.shard());
+
+        // Everything else goes to the default.
+        assert!(get("public").is_default());
+
+        // Patterns alone count as sharded schemas.
+        let patterns = ShardedSchemas::new(vec![schema(Some("tenant_*"), 0, true)], 4);
+        assert!(!patterns.is_empty());
     }
 }
@@ -5,16 +5,21 @@ use crate::{
     config::DataType,
     frontend::router::{
         parser::Column,
-        sharding::{Mapping, ShardedTable},
+        sharding::{Hasher, Mapping, ShardedTable},
     },
     net::messages::Vector,
 };
-use std::{collections::HashMap, sync::Arc};
+use std::{
+    collections::{HashMap, HashSet},
+    sync::Arc,
+};
 
 #[derive(Default, Debug)]
 struct Inner {
     tables: Vec<ShardedTable>,
     omnisharded: HashMap<String, bool>, // Name <-> sticky routing
+    /// Omnisharded tables written to with two-phase commit.
+    omnisharded_two_pc: HashSet<String>,
     /// This is set only if we have the same sharding scheme
     /// across all tables, i.e., 3 tables with the same data type
     /// and list/range/hash function.
@@ -30,6 +35,8 @@ pub struct CommonMapping {
     /// The list/range mapping, if any.
     /// If none, the column is using hash sharding.
     pub mapping: Option<Mapping>,
+    /// Shard UUIDv7 values by their timestamp.
+    pub uuid_timestamp: bool,
 }
 
 /// Sharded tables.
@@ -69,22 +76,31 @@ impl ShardedTables {
         // It is only valid when every table agrees on the same sharding scheme,
         // so that any table's function produces the same shard for the same key.
         //
-        // Only data_type and mapping are compared because those are the only fields
-        // CommonMapping stores and infer_from_from_and_config reads.
+        // Only data_type, mapping and uuid_timestamp are compared because those are
+        // the only fields CommonMapping stores and infer_from_from_and_config reads.
         let common_mapping = match tables.split_first() {
             Some((first, rest))
-                if rest
-                    .iter()
-                    .all(|t| t.data_type == first.data_type && t.mapping == first.mapping) =>
+                if rest.iter().all(|t| {
+                    t.data_type == first.data_type
+                        && t.mapping == first.mapping
+                        && t.uuid_timestamp == first.uuid_timestamp
+                }) =>
             {
                 Some(CommonMapping {
                     data_type: first.data_type,
                     mapping: first.mapping.clone(),
+                    uuid_timestamp: first.uuid_timestamp,
                 })
             }
             _ => None,
         };
 
+        let omnisharded_two_pc = omnisharded_tables
+            .iter()
+            .filter(|table| table.two_phase_commit)
+            .map(|table| table.name.clone())
+            .collect();
+
         Self {
             inner: Arc::new(Inner {
                 tables,
@@ -92,6 +108,7 @@ impl ShardedTables {
                     .into_iter()
                     .map(|table| (table.name, table.sticky_routing))
                     .collect(),
+                omnisharded_two_pc,
                 common_mapping,
                 omnisharded_sticky,
                 system_catalogs,
@@ -115,6 +132,11 @@ impl ShardedTables {
         self.inner.omnisharded_sticky
     }
 
+    /// Writes to this omnisharded table use two-phase commit.
+    pub fn is_omnisharded_two_pc(&self, name: &str) -> bool {
+        self.inner.omnisharded_two_pc.contains(name)
+    }
+
     /// System catalogs are to be joined across shards.
     pub fn is_system_catalog_sharded(&self) -> bool {
         self.inner.system_catalogs == SystemCatalogsBehavior::Sharded
@@ -178,6 +200,7 @@ impl ShardedTables {
                     position,
                     centroids: sharded_table.centroids.clone(),
                     centroid_probes: sharded_table.centroid_probes,
+                    hasher: Hasher::from(&sharded_table.hasher),
                 })
         };
 
@@ -205,6 +228,7 @@ pub struct ShardedColumn {
     pub position: usize,
     pub centroids: Vec<Vector>,
     pub centroid_probes: usize,
+    pub hasher: Hasher,
 }
 
 impl ShardedColumn {
@@ -217,6 +241,7 @@ impl ShardedColumn {
                 position: index,
                 centroids: table.centroids.clone(),
                 centroid_probes: table.centroid_probes,
+                hasher: Hasher::from(&table.hasher),
             })
     }
 }
@@ -0,0 +1,172 @@
+//! Scheduled DDL for rolling range mappings.
+//!
+//! Runs the `ddl` of each rolling rule on the shard of the current range
+//! and the next `premake` ranges, so tables or partitions exist before
+//! rows for them arrive. Statements already executed by this process
+//! are not repeated until it restarts.
+//!
+use std::collections::HashSet;
+use std::time::Duration;
+
+use chrono::{NaiveDateTime, Utc};
+use pgdog_config::{ShardedMappingConfig, ShardedMappingRolling};
+use tokio::time::sleep;
+use tracing::{error, info};
+
+use super::databases::databases;
+use super::pool::Request;
+use crate::config::config;
+use crate::frontend::router::sharding::RollingShards;
+
+/// How often to check for ranges that need DDL.
+const INTERVAL: Duration = Duration::from_secs(60);
+
+/// Statement to run on a shard.
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+struct Ddl {
+    database: String,
+    shard: usize,
+    query: String,
+}
+
+/// Start running DDL for rolling ranges.
+pub fn start() {
+    crate::tasks::spawn("rolling ranges", async move {
+        let shutdown = crate::tasks::shutdown_signal();
+        let mut done = HashSet::new();
+
+        loop {
+            run(Utc::now().naive_utc(), &mut done).await;
+
+            tokio::select! {
+                _ = sleep(INTERVAL) => {}
+                _ = shutdown.cancelled() => break,
+            }
+        }
+    });
+}
+
+/// Execute DDL that hasn't run yet.
+async fn run(now: NaiveDateTime, done: &mut HashSet<Ddl>) {
+    let config = config();
+
+    let pending = config
+        .config
+        .sharded_tables
+        .iter()
+        .flat_map(|table| {
+            table
+                .mapping
+                .iter()
+                .flatten()
+                .filter_map(|rule| match rule {
+                    ShardedMappingConfig::Rolling(rule) => Some(rule),
+                    _ => None,
+                })
+                .flat_map(move |rule| statements(&table.database, rule, now))
+        })
+        .filter(|ddl| !done.contains(ddl))
+        .collect::<Vec<_>>();
+
+    for ddl in pending {
+        match execute(&ddl).await {
+            Ok(()) => {
+                info!(
+                    r#"rolling range ddl executed on shard {} of database "{}": {}"#,
+                    ddl.shard, ddl.database, ddl.query
+                );
+                done.insert(ddl);
+            }
+
+            // Retried on the next run.
+            Err(err) => error!(
+                r#"rolling range ddl failed on shard {} of database "{}": {}"#,
+                ddl.shard, ddl.database, err
+            ),
+        }
+    }
+}
+
+async fn execute(ddl: &Ddl) -> Result<(), super::Error> {
+    let cluster = databases().schema_owner(&ddl.database)?;
+    let Some(shard) = cluster.shards().get(ddl.shard) else {
+        return Err(super::pool::Error::NoShard(ddl.shard).into());
+    };
+
+    let mut server = shard.primary(&Request::default()).await?;
+    server.execute(&ddl.query).await?;
+
+    Ok(())
+}
+
+/// DDL for the current range and the next `premake` ranges.
+fn statements(database: &str, rule: &ShardedMappingRolling, now: NaiveDateTime) -> Vec<Ddl> {
+    let (Some(template), Some(rolling)) = (&rule.ddl, RollingShards::new(rule)) else {
+        return vec![];
+    };
+
+    // Ranges that haven't started yet are created ahead of time too.
+    let current = rolling.index(now).unwrap_or_default();
+
+    (current..=current.saturating_add(rule.premake as u32))
+        .filter_map(|index| {
+            Some(Ddl {
+                database: database.to_owned(),
+                shard: rolling.range_shard(index),
+                query: rolling.ddl(template, index)?,
+            })
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod test {
+    use chrono::NaiveDate;
+    use pgdog_config::RollingInterval;
+
+    use super::*;
+
+    #[test]
+    fn test_statements() {
+        let rule = ShardedMappingRolling {
+            start: "2026-01-01".into(),
+            interval: RollingInterval::Month,
+            shards: vec![0, 1, 2],
+            ddl: Some("CREATE TABLE IF NOT EXISTS events_{suffix} (LIKE events)".into()),
+            premake: 1,
+        };
+        let now = NaiveDate::from_ymd_opt(2026, 5, 14)
+            .unwrap()
+            .and_hms_opt(10, 0, 0)
+            .unwrap();
+
+        let ddl = statements("prod", &rule, now);
+        assert_eq!(ddl.len(), 2);
+        assert_eq!(ddl[0].shard, 1);
+        assert_eq!(
+            ddl[0].query,
+            "CREATE TABLE IF NOT EXISTS events_2026_05 (LIKE events)"
+        );
+        assert_eq!(ddl[1].shard, 2);
+        assert_eq!(
+            ddl[1].query,
+            "CREATE TABLE IF NOT EXISTS events_2026_06 (LIKE events)"
+        );
+
+        // Before the first range.
+        let before = NaiveDate::from_ymd_opt(2025, 12, 1)
+            .unwrap()
+            .and_hms_opt(0, 0, 0)
+            .unwrap();
+        let ddl = statements("prod", &rule, before);
+        assert_eq!(ddl[0].shard, 0);
+        assert_eq!(
+            ddl[0].query,
+            "CREATE TABLE IF NOT EXISTS events_2026_01 (LIKE events)"
+        );
+
+        // No DDL configured.
+        let rule = ShardedMappingRolling { ddl: None, ..rule };
+        assert!(statements("prod", &rule, now).is_empty());
+    }
+}
@@ -0,0 +1,310 @@
+//! Sequence values allocated in advance.
+//!
+//! `INSERT` statements into unsharded tables that rely on a `nextval()`
+//! column default can be served values we fetched from the primary
+//! in one round trip, instead of calling `nextval()` for each row.
+//!
+//! Values returned by `nextval()` are never returned again, so unused ones
+//! can be saved to a file during shutdown and used after a restart.
+//!
+use std::collections::{HashMap, VecDeque};
+use std::fs;
+use std::path::Path;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use serde::{Deserialize, Serialize};
+use tokio::runtime::Handle;
+use tracing::{debug, info, warn};
+
+use super::{Error, databases::databases, pool::Request};
+
+/// Allocated values, by database and sequence name.
+static CACHE: Lazy<Mutex<HashMap<(String, String), Sequence>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+#[derive(Debug, Default)]
+struct Sequence {
+    values: VecDeque<i64>,
+    refilling: bool,
+}
+
+/// Unused values of a sequence, as saved to disk.
+#[derive(Debug, Serialize, Deserialize, PartialEq)]
+struct SavedSequence {
+    database: String,
+    sequence: String,
+    values: Vec<i64>,
+}
+
+/// Get the sequence from a `nextval('name'::regclass)` column default.
+pub fn nextval_sequence(column_default: &str) -> Option<&str> {
+    column_default
+        .strip_prefix("nextval('")?
+        .strip_suffix("'::regclass)")
+}
+
+/// Schema-qualify the sequence from a column default, so it resolves
+/// the same way regardless of the `search_path` of the connection that
+/// allocates its values.
+///
+/// `regclass` leaves out the schema if it's on the `search_path` of the
+/// connection that loaded the table, which is the table's schema.
+pub fn qualify(schema: &str, sequence: &str) -> String {
+    if split(sequence).0.is_some() {
+        sequence.to_owned()
+    } else {
+        format!(r#""{}".{}"#, schema.replace('"', "\"\""), sequence)
+    }
+}
+
+/// The cache serves values of the sequence, so `currval()` doesn't see them.
+/// Without a name, e.g. `lastval()`, check all sequences of the database.
+pub fn managed(database: &str, sequence: Option<&str>) -> bool {
+    let sequence = sequence.map(split);
+
+    CACHE.lock().keys().any(|(db, cached)| {
+        db == database
+            && sequence.as_ref().is_none_or(|(schema, name)| {
+                let (cached_schema, cached_name) = split(cached);
+                *name == cached_name && (schema.is_none() || *schema == cached_schema)
+            })
+    })
+}
+
+/// Split a sequence name into its schema, if any, and name, without quotes.
+fn split(sequence: &str) -> (Option<String>, String) {
+    let mut parts = vec![String::new()];
+    let mut quoted = false;
+    let mut chars = sequence.chars().peekable();
+
+    while let Some(c) = chars.next() {
+        let part = parts.last_mut().unwrap();
+        match c {
+            '"' if quoted && chars.peek() == Some(&'"') => {
+                chars.next();
+                part.push('"');
+            }
+            '"' => quoted = !quoted,
+            '.' if !quoted => parts.push(String::new()),
+            c if quoted => part.push(c),
+            c => part.push(c.to_ascii_lowercase()),
+        }
+    }
+
+    let name = parts.pop().unwrap_or_default();
+    (parts.pop(), name)
+}
+
+/// Take `count` values of the sequence, or none if the cache doesn't
+/// have enough. Allocates more values in the background when we are
+/// running low, in blocks of `block` values.
+pub fn take(database: &str, sequence: &str, count: usize, block: usize) -> Option<Vec<i64>> {
+    let mut cache = CACHE.lock();
+    let entry = cache
+        .entry((database.to_owned(), sequence.to_owned()))
+        .or_default();
+
+    let values = if entry.values.len() >= count {
+        Some(entry.values.drain(..count).collect())
+    } else {
+        None
+    };
+
+    if entry.values.len() <= block / 2
+        && !entry.refilling
+        && let Ok(handle) = Handle::try_current()
+    {
+        entry.refilling = true;
+
+        let database = database.to_owned();
+        let sequence = sequence.to_owned();
+        let refill = block.max(count);
+
+        handle.spawn(async move {
+            if let Err(err) = refill_sequence(&database, &sequence, refill).await {
+                warn!(
+                    "failed to allocate values for sequence \"{}\" [{}]: {}",
+                    sequence, database, err
+                );
+            }
+
+            if let Some(entry) = CACHE.lock().get_mut(&(database, sequence)) {
+                entry.refilling = false;
+            }
+        });
+    }
+
+    values
+}
+
+/// Take the next value of the sequence, if the cache has one.
+pub fn next(database: &str, sequence: &str, block: usize) -> Option<i64> {
+    take(database, sequence, 1, block).and_then(|values| values.first().copied())
+}
+
+/// Add values to the cache.
+#[cfg(test)]
+pub(crate) fn extend(database: &str, sequence: &str, values: &[i64]) {
+    CACHE
+        .lock()
+        .entry((database.to_owned(), sequence.to_owned()))
+        .or_default()
+        .values
+        .extend(values);
+}
+
+/// Allocate `count` values of the sequence on the primary.
+async fn refill_sequence(database: &str, sequence: &str, count: usize) -> Result<(), Error> {
+    let cluster = databases()
+        .all()
+        .iter()
+        .find(|(user, cluster)| user.database == database && cluster.shards().len() == 1)
+        .map(|(_, cluster)| cluster.clone())
+        .ok_or(Error::NoCluster)?;
+
+    let mut server = cluster.primary(0, &Request::default()).await?;
+    let values: Vec<i64> = server
+        .fetch_all(format!(
+            "SELECT nextval('{}'::regclass) FROM generate_series(1, {})",
+            sequence.replace('\'', "''"),
+            count
+        ))
+        .await?;
+
+    debug!(
+        "allocated {} values for sequence \"{}\" [{}]",
+        values.len(),
+        sequence,
+        database
+    );
+
+    CACHE
+        .lock()
+        .entry((database.to_owned(), sequence.to_owned()))
+        .or_default()
+        .values
+        .extend(values);
+
+    Ok(())
+}
+
+/// Save unused values to a file.
+pub fn save(path: &Path) -> Result<(), Error> {
+    let saved: Vec<SavedSequence> = CACHE
+        .lock()
+        .iter()
+        .filter(|(_, entry)| !entry.values.is_empty())
+        .map(|((database, sequence), entry)| SavedSequence {
+            database: database.clone(),
+            sequence: sequence.clone(),
+            values: entry.values.iter().copied().collect(),
+        })
+        .collect();
+
+    let json = serde_json::to_string(&saved).map_err(std::io::Error::from)?;
+    fs::write(path, json)?;
+
+    info!(
+        "saved unused values of {} sequences to \"{}\"",
+        saved.len(),
+        path.display()
+    );
+
+    Ok(())
+}
+
+/// Load values saved by a previous run and remove the file,
+/// so they can't be used twice.
+pub fn load(path: &Path) -> Result<(), Error> {
+    if !path.exists() {
+        return Ok(());
+    }
+
+    let json = fs::read_to_string(path)?;
+    let saved: Vec<SavedSequence> = serde_json::from_str(&json).map_err(std::io::Error::from)?;
+    fs::remove_file(path)?;
+
+    let mut cache = CACHE.lock();
+    for sequence in &saved {
+        cache
+            .entry((sequence.database.clone(), sequence.sequence.clone()))
+            .or_default()
+            .values
+            .extend(sequence.values.iter().copied());
+    }
+
+    info!(
+        "loaded unused values of {} sequences from \"{}\"",
+        saved.len(),
+        path.display()
+    );
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_nextval_sequence() {
+        assert_eq!(
+            nextval_sequence("nextval('users_id_seq'::regclass)"),
+            Some("users_id_seq")
+        );
+        assert_eq!(
+            nextval_sequence("nextval('app.\"Users_id_seq\"'::regclass)"),
+            Some("app.\"Users_id_seq\"")
+        );
+        assert_eq!(nextval_sequence("now()"), None);
+        assert_eq!(nextval_sequence(""), None);
+    }
+
+    #[test]
+    fn test_qualify() {
+        assert_eq!(qualify("app", "users_id_seq"), r#""app".users_id_seq"#);
+        assert_eq!(
+            qualify("app", r#""Users_id_seq""#),
+            r#""app"."Users_id_seq""#
+        );
+        assert_eq!(qualify("app", "public.users_id_seq"), "public.users_id_seq");
+        assert_eq!(qualify("app", r#""a.b".seq"#), r#""a.b".seq"#);
+    }
+
+    #[test]
+    fn test_managed() {
+        let database = "test_sequence_cache_managed";
+        assert!(!managed(database, None));
+
+        extend(database, &qualify("public", "users_id_seq"), &[1]);
+
+        assert!(managed(database, None));
+        assert!(managed(database, Some("users_id_seq")));
+        assert!(managed(database, Some("public.users_id_seq")));
+        assert!(managed(database, Some(r#""public"."users_id_seq""#)));
+        assert!(!managed(database, Some("app.users_id_seq")));
+        assert!(!managed(database, Some("orders_id_seq")));
+        assert!(!managed("test_sequence_cache_other", None));
+    }
+
+    #[test]
+    fn test_take_save_load() {
+        let path =
+            std::env::temp_dir().join(format!("pgdog_sequence_cache_{}.json", std::process::id()));
+        let key = ("test_sequence_cache".to_owned(), "users_id_seq".to_owned());
+
+        extend(&key.0, &key.1, &[1, 2, 3]);
+
+        assert_eq!(take(&key.0, &key.1, 2, 10), Some(vec![1, 2]));
+        assert_eq!(take(&key.0, &key.1, 2, 10), None);
+
+        save(&path).unwrap();
+        CACHE.lock().remove(&key);
+        assert_eq!(take(&key.0, &key.1, 1, 10), None);
+
+        load(&path).unwrap();
+        assert!(!path.exists());
+        assert_eq!(take(&key.0, &key.1, 1, 10), Some(vec![3]));
+    }
+}
@@ -2,8 +2,10 @@
 
 use std::{ops::Deref, time::Duration};
 
-use bytes::{BufMut, BytesMut};
+use bytes::{BufMut, Bytes, BytesMut};
 use rustls_pki_types::ServerName;
+#[cfg(unix)]
+use tokio::net::UnixStream;
 use tokio::{
     io::{AsyncReadExt, AsyncWriteExt},
     net::TcpStream,
@@ -13,8 +15,8 @@ use tokio::{
 use tracing::{debug, error, info, trace, warn};
 
 use super::{
-    ConnectReason, DisconnectReason, Error, PreparedStatements, ServerOptions, Stats,
-    pool::Address, prepared_statements::HandleResult,
+    ConnectReason, DisconnectReason, Error, PreparedStatements, ServerOptions, ServerVersion,
+    Stats, pool::Address, prepared_statements::HandleResult,
 };
 use crate::{
     auth::{md5, scram::Client},
@@ -25,14 +27,14 @@ use crate::{
         Close, MessageBuffer, Parameter, ProtocolMessage, Sync,
         messages::{
             Authentication, BackendKeyData, BackendPid, ErrorResponse, FromBytes, FrontendPid,
-            Message, ParameterStatus, Password, Protocol, Query, ReadyForQuery, Startup, Terminate,
-            ToBytes, hello::SslReply,
+            Message, NegotiateProtocolVersion, ParameterStatus, Password, Protocol,
+            ProtocolVersion, Query, ReadyForQuery, Startup, Terminate, ToBytes, hello::SslReply,
         },
     },
     stats::memory::MemoryUsage,
 };
 use crate::{
-    config::{PoolerMode, TlsVerifyMode, config},
+    config::{ConfigAndUsers, PoolerMode, TlsVerifyMode, config},
     net::{
         CommandComplete, Stream,
         messages::{DataRow, NoticeResponse},
@@ -42,6 +44,16 @@ use crate::{
 };
 use crate::{net::tweak, state::State};
 
+/// `statement_timeout` changed by a client deadline.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Deadline {
+    None,
+    /// Changed for the session.
+    Session,
+    /// Changed with `SET LOCAL`, until the transaction ends.
+    Local,
+}
+
 /// PostgreSQL server connection.
 #[derive(Debug)]
 pub struct Server {
@@ -49,6 +61,7 @@ pub struct Server {
     stream: Option<Stream>,
     key: BackendKeyData,
     id: BackendPid,
+    protocol_version: ProtocolVersion,
     params: Parameters,
     changed_params: Parameters,
     client_params: Parameters,
@@ -76,6 +89,11 @@ pub struct Server {
     /// Compared against the pool's generation on check-in; a mismatch means
     /// the Vault lease rotated and this connection must be closed.
     credentials_generation: u64,
+    /// A client deadline changed `statement_timeout`,
+    /// so it has to be restored before the next request.
+    deadline: Deadline,
+    /// Client that used this connection last.
+    last_client: Option<FrontendPid>,
 }
 
 impl MemoryUsage for Server {
@@ -153,22 +171,14 @@ impl Server {
         auth_secret: &super::pool::Password,
     ) -> Result<Self, Error> {
         debug!("=> {}", addr);
-        let stream = TcpStream::connect(addr.addr().await?).await?;
         let config = config();
-
-        if let Err(err) = tweak(&stream, &config.config.tcp) {
-            warn!(
-                "keepalive settings ({}) are not supported on this system, ignoring, error: {} [{}]",
-                config.config.tcp, err, addr,
-            );
-        }
-
-        let mut stream = Stream::plain(stream, config.config.memory.net_buffer);
+        let mut stream = Self::socket(addr, &config).await?;
 
         let tls_mode = config.config.general.tls_verify;
 
-        // Only attempt TLS if not in Disabled mode
-        if tls_mode != TlsVerifyMode::Disabled {
+        // Only attempt TLS if not in Disabled mode. Like libpq,
+        // we don't use TLS over UNIX sockets.
+        if tls_mode != TlsVerifyMode::Disabled && !addr.is_unix_socket() {
             debug!(
                 "requesting TLS connection with verify mode: {:?} [{}]",
                 tls_mode, addr,
@@ -225,8 +235,23 @@ impl Server {
             );
         }
 
+        // Postgres 18 sends longer cancellation keys with protocol 3.2.
+        // Older servers reply with NegotiateProtocolVersion and use 3.0.
+        let mut protocol_version = if config.config.general.server_protocol_3_2 {
+            ProtocolVersion::V3_2
+        } else {
+            ProtocolVersion::V3_0
+        };
         stream
-            .write_all(&Startup::new(user, &addr.database_name, options.params.clone()).to_bytes())
+            .write_all(
+                &Startup::new_with_protocol_version(
+                    protocol_version,
+                    user,
+                    &addr.database_name,
+                    options.params.clone(),
+                )
+                .to_bytes(),
+            )
             .await?;
         stream.flush().await?;
 
@@ -241,6 +266,15 @@ impl Server {
                     let error = ErrorResponse::from_bytes(message.payload())?;
                     return Err(Error::ConnectionError(Box::new(error)));
                 }
+                // NegotiateProtocolVersion (B)
+                'v' => {
+                    let negotiate = NegotiateProtocolVersion::from_bytes(message.payload())?;
+                    debug!(
+                        "server downgraded protocol from {} to {} [{}]",
+                        protocol_version, negotiate.version, addr
+                    );
+                    protocol_version = negotiate.version;
+                }
                 'R' => {
                     let auth = Authentication::from_bytes(message.payload())?;
 
@@ -334,6 +368,7 @@ impl Server {
             stream: Some(stream),
             key,
             id,
+            protocol_version,
             stats: Stats::connect(id, addr, &params, &options, &config.config.memory),
             replication_mode: options.replication_mode(),
             params,
@@ -354,6 +389,8 @@ impl Server {
             password_attempts: 1, // This is going to be changed by parent caller.
             max_age: None,
             credentials_generation: 0,
+            deadline: Deadline::None,
+            last_client: None,
         };
 
         server.stats.memory_used(server.memory_stats()); // Stream capacity.
@@ -361,9 +398,30 @@ impl Server {
         Ok(server)
     }
 
+    /// Open an unencrypted connection to the server,
+    /// using a UNIX socket if the host is a directory.
+    async fn socket(addr: &Address, config: &ConfigAndUsers) -> Result<Stream, Error> {
+        #[cfg(unix)]
+        if addr.is_unix_socket() {
+            let stream = UnixStream::connect(addr.unix_socket_path()).await?;
+            return Ok(Stream::unix(stream, config.config.memory.net_buffer));
+        }
+
+        let stream = TcpStream::connect(addr.addr().await?).await?;
+
+        if let Err(err) = tweak(&stream, &config.config.tcp) {
+            warn!(
+                "keepalive settings ({}) are not supported on this system, ignoring, error: {} [{}]",
+                config.config.tcp, err, addr,
+            );
+        }
+
+        Ok(Stream::plain(stream, config.config.memory.net_buffer))
+    }
+
     /// Request query cancellation for the given backend server identifier.
     pub async fn cancel(addr: &Address, id: BackendKeyData) -> Result<(), Error> {
-        let mut stream = TcpStream::connect(addr.addr().await?).await?;
+        let mut stream = Self::socket(addr, &config()).await?;
         stream.write_all(&Startup::Cancel { id }.to_bytes()).await?;
         stream.flush().await?;
 
@@ -465,13 +523,60 @@ impl Server {
     /// This method is cancel-safe.
     ///
     pub async fn read(&mut self) -> Result<Message, Error> {
+        self.read_message(None).await
+    }
+
+    /// Read a single message from the server. `DataRow` and `CopyData` messages
+    /// larger than `threshold` are returned in parts: the rest of the message
+    /// has to be read with [`Server::read_chunk`].
+    ///
+    /// # Cancellation safety
+    ///
+    /// This method is cancel-safe.
+    ///
+    pub async fn read_partial(&mut self, threshold: usize) -> Result<Message, Error> {
+        self.read_message(Some(threshold)).await
+    }
+
+    /// Read the next part of a message returned by [`Server::read_partial`],
+    /// `None` once it's been read completely.
+    ///
+    /// # Cancellation safety
+    ///
+    /// This method is cancel-safe.
+    ///
+    pub async fn read_chunk(&mut self) -> Result<Option<Bytes>, Error> {
+        match self
+            .stream_buffer
+            .read_chunk(self.stream.as_mut().unwrap())
+            .await
+        {
+            Ok(chunk) => {
+                if let Some(ref chunk) = chunk {
+                    self.stats.receive(chunk.len(), b'D');
+                }
+                Ok(chunk)
+            }
+            Err(err) => {
+                self.stats.state(State::Error);
+                Err(err.into())
+            }
+        }
+    }
+
+    async fn read_message(&mut self, partial_threshold: Option<usize>) -> Result<Message, Error> {
         let message = loop {
             if let Some(message) = self.prepared_statements.state_mut().get_simulated() {
                 // INVARIANT: omni dedup in multi_shard relies on this being process-unique;
                 // never substitute a non-unique value here.
                 return Ok(message.backend(self.id));
             }
-            match self.stream_buffer.read(self.stream.as_mut().unwrap()).await {
+            let stream = self.stream.as_mut().unwrap();
+            let result = match partial_threshold {
+                Some(threshold) => self.stream_buffer.read_partial(stream, threshold).await,
+                None => self.stream_buffer.read(stream).await,
+            };
+            match result {
                 Ok(message) => {
                     // INVARIANT: omni dedup in multi_shard relies on this being process-unique;
                     // never substitute a non-unique value here.
@@ -598,6 +703,9 @@ impl Server {
 
         self.stats.link_client(client_name, server_name, id);
 
+        // Undo the previous client's deadline, if any.
+        self.reset_deadline().await?;
+
         // Clear any params previously tracked by SET.
         self.changed_params.clear();
         let mut clear_params = false;
@@ -675,6 +783,102 @@ impl Server {
         self.changed_params.clear();
     }
 
+    /// Enforce a client deadline with `statement_timeout`, or restore it
+    /// after the previous request if there is none.
+    ///
+    /// Inside a transaction, this uses `SET LOCAL`, so Postgres drops it at
+    /// `COMMIT` or `ROLLBACK`. Outside of one, the session value is changed.
+    /// Either way, it only applies to one request.
+    ///
+    /// The `SET` is sent ahead of the request, without waiting for it, and the
+    /// client doesn't see its result. It's skipped if the server is still
+    /// executing pipelined requests, since it would run in the middle of them.
+    pub async fn deadline(&mut self, timeout: Option<Duration>) -> Result<(), Error> {
+        let Some(timeout) = timeout else {
+            return match self.reset_deadline_query() {
+                Some(query) => self.send_deadline(query, Deadline::None).await,
+                None => Ok(()),
+            };
+        };
+
+        if !self.in_sync() {
+            warn!(
+                "client deadline skipped, server is executing pipelined requests [{}]",
+                self.addr()
+            );
+            return Ok(());
+        }
+
+        // Nothing can run until the client rolls back.
+        if self.stats().get_state() == State::TransactionError {
+            return Ok(());
+        }
+
+        let timeout = timeout.as_millis();
+
+        if self.in_transaction() {
+            self.send_deadline(
+                format!("SET LOCAL statement_timeout TO {}", timeout),
+                Deadline::Local,
+            )
+            .await
+        } else {
+            self.send_deadline(
+                format!("SET statement_timeout TO {}", timeout),
+                Deadline::Session,
+            )
+            .await
+        }
+    }
+
+    /// Queue the query changing `statement_timeout` in front of the request.
+    async fn send_deadline(&mut self, query: String, deadline: Deadline) -> Result<(), Error> {
+        self.send_ignore(&ProtocolMessage::Query(Query::new(query)))
+            .await?;
+        self.deadline = deadline;
+
+        Ok(())
+    }
+
+    /// Restore `statement_timeout` changed by a deadline.
+    pub async fn reset_deadline(&mut self) -> Result<(), Error> {
+        if let Some(query) = self.reset_deadline_query() {
+            self.execute(query).await?;
+            self.deadline = Deadline::None;
+        }
+
+        Ok(())
+    }
+
+    /// Query restoring `statement_timeout` changed by a deadline, if it needs restoring.
+    fn reset_deadline_query(&mut self) -> Option<String> {
+        if self.deadline == Deadline::None || !self.in_sync() {
+            return None;
+        }
+
+        let local = self.deadline == Deadline::Local;
+
+        if local && !self.in_transaction() {
+            // Postgres dropped it when the transaction ended.
+            self.deadline = Deadline::None;
+            return None;
+        }
+
+        // Nothing can run until the client rolls back.
+        if self.stats().get_state() == State::TransactionError {
+            return None;
+        }
+
+        let query = match (self.client_params.get("statement_timeout"), local) {
+            (Some(value), false) => format!(r#"SET "statement_timeout" TO {}"#, value),
+            (Some(value), true) => format!(r#"SET LOCAL "statement_timeout" TO {}"#, value),
+            (None, false) => "RESET statement_timeout".into(),
+            (None, true) => "SET LOCAL statement_timeout TO DEFAULT".into(),
+        };
+
+        Some(query)
+    }
+
     /// We can disconnect from this server.
     ///
     /// There are no more expected messages from the server connection
@@ -763,6 +967,11 @@ impl Server {
         &self.params
     }
 
+    /// Server version, as reported by the server on connect.
+    pub fn version(&self) -> Option<ServerVersion> {
+        ServerVersion::from_params(&self.params)
+    }
+
     /// Execute a batch of queries and return all results.
     pub async fn execute_batch(&mut self, queries: &[Query]) -> Result<Vec<Message>, Error> {
         let mut err = None;
@@ -1012,6 +1221,12 @@ impl Server {
         &self.key
     }
 
+    /// Protocol version negotiated with the server.
+    #[inline]
+    pub fn protocol_version(&self) -> ProtocolVersion {
+        self.protocol_version
+    }
+
     /// Number of password attempts it took to authenticate this connection.
     #[inline]
     pub fn password_attempts(&self) -> usize {
@@ -1045,7 +1260,7 @@ impl Server {
         // Sampling is signed, so drop into ms locally; result goes back
         // out as a Duration immediately, no leak across the API.
         let jitter_ms = jitter.as_millis() as i64;
-        let offset_ms = rand::rng().random_range(-jitter_ms..=jitter_ms);
+        let offset_ms = crate::random::with_rng(|rng| rng.random_range(-jitter_ms..=jitter_ms));
         let offset = Duration::from_millis(offset_ms.unsigned_abs());
         self.max_age = Some(if offset_ms >= 0 {
             base.saturating_add(offset)
@@ -1071,6 +1286,17 @@ impl Server {
         self.credentials_generation = generation;
     }
 
+    /// Client that used this connection last.
+    #[inline]
+    pub fn last_client(&self) -> Option<FrontendPid> {
+        self.last_client
+    }
+
+    #[inline]
+    pub fn set_last_client(&mut self, client: FrontendPid) {
+        self.last_client = Some(client);
+    }
+
     /// How long this connection has been idle.
     #[inline]
     pub fn idle_for(&self, instant: Instant) -> Duration {
@@ -1098,6 +1324,12 @@ impl Server {
         self.stream.as_mut().unwrap()
     }
 
+    /// Take the socket, e.g. to forward bytes
+    /// to a client without parsing messages.
+    pub fn into_stream(mut self) -> Option<Stream> {
+        self.stream.take()
+    }
+
     /// Server needs a cleanup because client changed a session variable
     /// of parameter.
     #[inline]
@@ -1235,6 +1467,7 @@ pub mod test {
                 stream: None,
                 key,
                 id,
+                protocol_version: ProtocolVersion::V3_0,
                 params: Parameters::default(),
                 changed_params: Parameters::default(),
                 client_params: Parameters::default(),
@@ -1262,6 +1495,8 @@ pub mod test {
                 password_attempts: 1,
                 max_age: None,
                 credentials_generation: 0,
+                deadline: Deadline::None,
+                last_client: None,
             }
         }
     }
@@ -1432,6 +1667,93 @@ pub mod test {
         server_task.await.unwrap();
     }
 
+    #[tokio::test]
+    async fn test_connect_protocol_3_2() {
+        use crate::net::messages::backend_key::SecretKey;
+
+        let mut config = (*config()).clone();
+        config.config.general.server_protocol_3_2 = true;
+        let _config = crate::test_utils::set_config(config);
+
+        for downgrade in [false, true] {
+            let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+            let port = listener.local_addr().unwrap().port();
+            let key = if downgrade {
+                BackendKeyData::legacy(1234, 5678)
+            } else {
+                BackendKeyData {
+                    pid: 1234,
+                    secret: SecretKey::random(32),
+                }
+            };
+
+            let server_task = tokio::spawn({
+                let key = key.clone();
+                async move {
+                    let (mut socket, _) = listener.accept().await.unwrap();
+
+                    let startup = Startup::from_stream(&mut socket).await.unwrap();
+                    let startup = if matches!(startup, Startup::Ssl) {
+                        socket.write_all(b"N").await.unwrap();
+                        Startup::from_stream(&mut socket).await.unwrap()
+                    } else {
+                        startup
+                    };
+                    assert!(matches!(
+                        startup,
+                        Startup::Startup {
+                            version: ProtocolVersion::V3_2,
+                            ..
+                        }
+                    ));
+
+                    if downgrade {
+                        socket
+                            .write_all(
+                                &NegotiateProtocolVersion::new(ProtocolVersion::V3_0, vec![])
+                                    .to_bytes(),
+                            )
+                            .await
+                            .unwrap();
+                    }
+                    socket
+                        .write_all(&Authentication::Ok.to_bytes())
+                        .await
+                        .unwrap();
+                    socket.write_all(&key.to_bytes()).await.unwrap();
+                    socket
+                        .write_all(&ReadyForQuery::idle().to_bytes())
+                        .await
+                        .unwrap();
+
+                    // The cancel request carries the server's secret as-is.
+                    let (mut socket, _) = listener.accept().await.unwrap();
+                    let cancel = Startup::from_stream(&mut socket).await.unwrap();
+                    assert_eq!(cancel, Startup::Cancel { id: key });
+                    drop(socket);
+                }
+            });
+
+            let mut addr = Address::new_test();
+            addr.port = port;
+
+            let server = Server::connect(&addr, ServerOptions::default(), ConnectReason::Other)
+                .await
+                .unwrap();
+            let expected = if downgrade {
+                ProtocolVersion::V3_0
+            } else {
+                ProtocolVersion::V3_2
+            };
+            assert_eq!(server.protocol_version(), expected);
+            assert_eq!(server.key(), &key);
+
+            Server::cancel(&addr, server.key().clone()).await.unwrap();
+            drop(server);
+            server_task.await.unwrap();
+        }
+    }
+
     #[tokio::test]
     async fn test_simple_query() {
         let mut server = test_server().await;
@@ -1467,6 +1789,43 @@ pub mod test {
         assert!(server.done());
     }
 
+    #[tokio::test]
+    async fn test_deadline() {
+        let mut server = test_server().await;
+        let show = || -> ClientRequest {
+            vec![ProtocolMessage::from(Query::new("SHOW statement_timeout"))].into()
+        };
+
+        // The SET goes with the query and its result is hidden.
+        server
+            .deadline(Some(Duration::from_millis(1500)))
+            .await
+            .unwrap();
+        server.send(&show()).await.unwrap();
+        let mut messages = vec![];
+        for c in ['T', 'D', 'C', 'Z'] {
+            let msg = server.read().await.unwrap();
+            assert_eq!(msg.code(), c);
+            messages.push(msg);
+        }
+        let row = DataRow::from_bytes(messages[1].to_bytes()).unwrap();
+        assert_eq!(row.get_text(0).unwrap(), "1500ms");
+        assert!(server.done());
+
+        // Restored with the next request.
+        server.deadline(None).await.unwrap();
+        server.send(&show()).await.unwrap();
+        let mut messages = vec![];
+        for c in ['T', 'D', 'C', 'Z'] {
+            let msg = server.read().await.unwrap();
+            assert_eq!(msg.code(), c);
+            messages.push(msg);
+        }
+        let row = DataRow::from_bytes(messages[1].to_bytes()).unwrap();
+        assert_eq!(row.get_text(0).unwrap(), "0");
+        assert!(server.done());
+    }
+
     #[tokio::test]
     async fn test_empty_query() {
         let mut server = test_server().await;
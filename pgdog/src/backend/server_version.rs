@@ -0,0 +1,184 @@
+//! PostgreSQL server version.
+//!
+//! Postgres reports its version in the `server_version` parameter
+//! when a connection is created. During major version upgrades, the same
+//! cluster can have servers running different versions, so version-specific
+//! behavior is decided for each server connection separately.
+
+use std::fmt::Display;
+
+use crate::net::Parameters;
+
+/// Server version, e.g., `16.4`, in the same format as `server_version_num`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash)]
+pub struct ServerVersion {
+    num: u32,
+}
+
+impl ServerVersion {
+    /// Create version from its `server_version_num` representation, e.g., `160004`.
+    pub fn new(num: u32) -> Self {
+        Self { num }
+    }
+
+    /// Parse the `server_version` parameter, e.g., `16.4 (Debian 16.4-1.pgdg120+1)`,
+    /// `9.6.24` or `18beta1`.
+    pub fn parse(version: &str) -> Option<Self> {
+        let numeric = version
+            .trim()
+            .split(|c: char| !c.is_ascii_digit() && c != '.')
+            .next()?;
+        let mut parts = numeric.split('.').map(|part| part.parse::<u32>().ok());
+
+        let first = parts.next().flatten()?;
+        let second = parts.next().flatten().unwrap_or(0);
+
+        let num = if first >= 10 {
+            first * 10_000 + second
+        } else {
+            // Before Postgres 10, the major version had two parts, e.g., 9.6.
+            let third = parts.next().flatten().unwrap_or(0);
+            first * 10_000 + second * 100 + third
+        };
+
+        Some(Self { num })
+    }
+
+    /// Get the version reported by the server in its startup parameters.
+    pub fn from_params(params: &Parameters) -> Option<Self> {
+        params
+            .get("server_version")
+            .and_then(|version| version.as_str())
+            .and_then(Self::parse)
+    }
+
+    /// Version as `server_version_num`.
+    pub fn num(&self) -> u32 {
+        self.num
+    }
+
+    /// Major version, e.g., `16`. Versions before 10 are reported
+    /// without the second part of their major version, e.g., `9` for 9.6.
+    pub fn major(&self) -> u32 {
+        self.num / 10_000
+    }
+
+    /// WAL functions are named `*_wal_*` and `*_lsn` instead of
+    /// `*_xlog_*` and `*_location` since Postgres 10.
+    pub fn wal_functions(&self) -> bool {
+        self.num >= 100_000
+    }
+
+    /// `pg_attribute.attgenerated` exists since Postgres 12.
+    pub fn generated_columns(&self) -> bool {
+        self.major() >= 12
+    }
+
+    /// `DROP_REPLICATION_SLOT` accepts `WAIT` since Postgres 13.
+    pub fn drop_slot_wait(&self) -> bool {
+        self.major() >= 13
+    }
+
+    /// Replication commands take their options in parentheses,
+    /// e.g., `(SNAPSHOT 'use')`, since Postgres 15.
+    pub fn replication_command_options(&self) -> bool {
+        self.major() >= 15
+    }
+
+    /// Latest `pgoutput` protocol version supported by the server.
+    pub fn pgoutput_protocol(&self) -> u32 {
+        match self.major() {
+            16.. => 4,
+            15 => 3,
+            14 => 2,
+            _ => 1,
+        }
+    }
+
+    /// `pgoutput` accepts the `binary` option since Postgres 14.
+    pub fn pgoutput_binary(&self) -> bool {
+        self.major() >= 14
+    }
+
+    /// `pgoutput` accepts the `origin` option since Postgres 16.
+    pub fn pgoutput_origin(&self) -> bool {
+        self.major() >= 16
+    }
+}
+
+impl Display for ServerVersion {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        if self.wal_functions() {
+            write!(f, "{}.{}", self.major(), self.num % 10_000)
+        } else {
+            write!(
+                f,
+                "{}.{}.{}",
+                self.major(),
+                self.num / 100 % 100,
+                self.num % 100
+            )
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_parse() {
+        let version = ServerVersion::parse("16.4 (Debian 16.4-1.pgdg120+1)").unwrap();
+        assert_eq!(version.num(), 160004);
+        assert_eq!(version.major(), 16);
+        assert_eq!(version.to_string(), "16.4");
+        assert!(version.wal_functions());
+
+        let version = ServerVersion::parse("9.6.24").unwrap();
+        assert_eq!(version.num(), 90624);
+        assert_eq!(version.major(), 9);
+        assert_eq!(version.to_string(), "9.6.24");
+        assert!(!version.wal_functions());
+
+        let version = ServerVersion::parse("18beta1").unwrap();
+        assert_eq!(version.num(), 180000);
+        assert_eq!(version.to_string(), "18.0");
+
+        assert!(ServerVersion::parse("PgDog").is_none());
+        assert!(ServerVersion::parse("").is_none());
+    }
+
+    #[test]
+    fn test_features() {
+        let version = ServerVersion::new(170002);
+        assert!(version.generated_columns());
+        assert!(version.replication_command_options());
+        assert_eq!(version.pgoutput_protocol(), 4);
+        assert!(version.pgoutput_origin());
+
+        let version = ServerVersion::new(140010);
+        assert!(version.drop_slot_wait());
+        assert!(!version.replication_command_options());
+        assert_eq!(version.pgoutput_protocol(), 2);
+        assert!(version.pgoutput_binary());
+        assert!(!version.pgoutput_origin());
+
+        let version = ServerVersion::new(110022);
+        assert!(!version.generated_columns());
+        assert!(!version.drop_slot_wait());
+        assert_eq!(version.pgoutput_protocol(), 1);
+        assert!(!version.pgoutput_binary());
+    }
+
+    #[test]
+    fn test_from_params() {
+        let mut params = Parameters::default();
+        assert!(ServerVersion::from_params(&params).is_none());
+
+        params.insert("server_version", "17.2");
+        assert_eq!(
+            ServerVersion::from_params(&params),
+            Some(ServerVersion::new(170002))
+        );
+    }
+}
@@ -0,0 +1,186 @@
+//! Loading of directory sharding mappings.
+//!
+//! Reads each directory from its Postgres table or local file at startup,
+//! before clients are accepted, and then every `refresh_interval`,
+//! replacing its entries if they changed. Entries
+//! are kept if loading fails, so a missing table or file doesn't send
+//! queries for known keys to all shards.
+//!
+use std::collections::HashMap;
+use std::time::{Duration, Instant, SystemTime};
+
+use pgdog_config::{ShardedMappingConfig, ShardedMappingDirectory};
+use tokio::time::sleep;
+use tracing::{error, info, warn};
+
+use super::databases::databases;
+use super::pool::Request;
+use crate::config::config;
+use crate::frontend::router::sharding::{Directory, directory};
+use crate::net::DataRow;
+
+/// How often to check for directories that need reloading.
+const INTERVAL: Duration = Duration::from_secs(1);
+
+/// Directory row.
+struct Entry {
+    key: Option<String>,
+    shard: Option<i64>,
+}
+
+impl From<DataRow> for Entry {
+    fn from(value: DataRow) -> Self {
+        Self {
+            key: value.get_text(0),
+            shard: value.get_int(1, true),
+        }
+    }
+}
+
+/// When a directory was last loaded.
+#[derive(Default)]
+struct Loaded {
+    at: Option<Instant>,
+    /// Modification time of the file.
+    modified: Option<SystemTime>,
+}
+
+/// Load directories and keep reloading them in the background.
+///
+/// The first load finishes before this returns, so queries aren't
+/// sent to all shards while the directories are still empty.
+pub async fn start() {
+    let mut loaded = HashMap::new();
+    run(&mut loaded).await;
+
+    crate::tasks::spawn("shard directory", async move {
+        let shutdown = crate::tasks::shutdown_signal();
+
+        loop {
+            tokio::select! {
+                _ = sleep(INTERVAL) => {}
+                _ = shutdown.cancelled() => break,
+            }
+
+            run(&mut loaded).await;
+        }
+    });
+}
+
+/// Reload directories that are due.
+async fn run(loaded: &mut HashMap<ShardedMappingDirectory, Loaded>) {
+    let config = config();
+
+    let directories = config
+        .config
+        .sharded_tables
+        .iter()
+        .flat_map(|table| {
+            table
+                .mapping
+                .iter()
+                .flatten()
+                .filter_map(move |rule| match rule {
+                    ShardedMappingConfig::Directory(rule) => Some((&table.database, rule)),
+                    _ => None,
+                })
+        })
+        .collect::<Vec<_>>();
+
+    for (database, config) in directories {
+        let state = loaded.entry(config.clone()).or_default();
+        let interval = Duration::from_millis(config.refresh_interval);
+
+        if state.at.is_some_and(|at| at.elapsed() < interval) {
+            continue;
+        }
+        state.at = Some(Instant::now());
+
+        let result = if let Some(ref table) = config.table {
+            load_table(database, table).await.map(Some)
+        } else if let Some(ref path) = config.path {
+            load_file(path, &mut state.modified).await
+        } else {
+            continue;
+        };
+
+        match result {
+            Ok(Some(shards)) => {
+                let shards = valid(database, shards);
+                let directory = Directory::new(config);
+                let entries = shards.len();
+                if directory.replace(shards) {
+                    info!(
+                        r#"shard directory for database "{}" loaded with {} entries"#,
+                        database, entries
+                    );
+                }
+            }
+
+            // File didn't change.
+            Ok(None) => (),
+
+            // Retried on the next run.
+            Err(err) => error!(
+                r#"shard directory for database "{}" failed to load: {}"#,
+                database, err
+            ),
+        }
+    }
+}
+
+/// Read the directory from a table on the first shard.
+async fn load_table(database: &str, table: &str) -> Result<HashMap<String, usize>, super::Error> {
+    let cluster = databases().schema_owner(database)?;
+    let Some(shard) = cluster.shards().first() else {
+        return Err(super::pool::Error::NoShard(0).into());
+    };
+
+    let mut server = shard.primary(&Request::default()).await?;
+    let entries = server
+        .fetch_all::<Entry>(format!("SELECT key::text, shard::bigint FROM {}", table))
+        .await?;
+
+    Ok(entries
+        .into_iter()
+        .filter_map(|entry| Some((entry.key?, usize::try_from(entry.shard?).ok()?)))
+        .collect())
+}
+
+/// Read the directory from a file, if it changed since it was last read.
+async fn load_file(
+    path: &std::path::Path,
+    modified: &mut Option<SystemTime>,
+) -> Result<Option<HashMap<String, usize>>, super::Error> {
+    let changed = tokio::fs::metadata(path).await?.modified().ok();
+    if changed.is_some() && changed == *modified {
+        return Ok(None);
+    }
+
+    let text = tokio::fs::read_to_string(path).await?;
+    let shards = directory::parse(&text)?;
+    *modified = changed;
+
+    Ok(Some(shards))
+}
+
+/// Drop entries pointing to shards that don't exist.
+fn valid(database: &str, mut shards: HashMap<String, usize>) -> HashMap<String, usize> {
+    let Ok(cluster) = databases().schema_owner(database) else {
+        return shards;
+    };
+    let num_shards = cluster.shards().len();
+
+    shards.retain(|key, shard| {
+        let valid = *shard < num_shards;
+        if !valid {
+            warn!(
+                r#"shard directory for database "{}" maps "{}" to shard {}, but there are only {} shards"#,
+                database, key, shard, num_shards
+            );
+        }
+        valid
+    });
+
+    shards
+}
@@ -0,0 +1,98 @@
+//! Reject all queries targeting a specific shard.
+//!
+//! This is used to contain incidents where one shard's primary is
+//! overloaded and needs breathing room, while the other shards keep serving.
+//!
+//! Like maintenance mode, the kill switch is independent from the config
+//! and will hold true during config reloads.
+//!
+use std::collections::HashSet;
+
+use arc_swap::ArcSwap;
+use futures::future::try_join_all;
+use once_cell::sync::Lazy;
+use tracing::warn;
+
+use super::{Error, databases::databases};
+use crate::frontend::router::parser::Shard;
+
+/// Disabled shards, by database name and shard number.
+static DISABLED: Lazy<ArcSwap<HashSet<(String, usize)>>> =
+    Lazy::new(|| ArcSwap::from_pointee(HashSet::new()));
+
+/// Reject all queries to the shard and cancel the ones already running.
+pub async fn disable(database: &str, shard: usize) -> Result<(), Error> {
+    DISABLED.rcu(|disabled| {
+        let mut disabled = HashSet::clone(disabled);
+        disabled.insert((database.to_owned(), shard));
+        disabled
+    });
+
+    warn!(
+        "shard {} of database \"{}\" is disabled, rejecting all queries",
+        shard, database
+    );
+
+    let pools: Vec<_> = databases()
+        .all()
+        .iter()
+        .filter(|(user, _)| user.database == database)
+        .filter_map(|(_, cluster)| cluster.shards().get(shard).map(|shard| shard.pools()))
+        .flatten()
+        .collect();
+
+    try_join_all(pools.iter().map(|pool| pool.cancel_all())).await?;
+
+    Ok(())
+}
+
+/// Start serving queries for the shard again.
+pub fn enable(database: &str, shard: usize) {
+    DISABLED.rcu(|disabled| {
+        let mut disabled = HashSet::clone(disabled);
+        disabled.remove(&(database.to_owned(), shard));
+        disabled
+    });
+
+    warn!("shard {} of database \"{}\" is enabled", shard, database);
+}
+
+/// Get the first disabled shard the query would be sent to, if any.
+pub(crate) fn disabled(database: &str, shard: &Shard, shards: usize) -> Option<usize> {
+    let disabled = DISABLED.load();
+
+    if disabled.is_empty() {
+        return None;
+    }
+
+    let is_disabled = |shard: &usize| disabled.contains(&(database.to_owned(), *shard));
+
+    match shard {
+        Shard::Direct(shard) => Some(*shard).filter(is_disabled),
+        Shard::Multi(shards) => shards.iter().copied().find(is_disabled),
+        Shard::All => (0..shards).find(is_disabled),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[tokio::test]
+    async fn test_kill_switch() {
+        // Use a database that doesn't exist, so nothing else is affected.
+        let database = "test_kill_switch";
+        assert_eq!(disabled(database, &Shard::All, 2), None);
+
+        disable(database, 1).await.unwrap();
+
+        assert_eq!(disabled(database, &Shard::Direct(0), 2), None);
+        assert_eq!(disabled(database, &Shard::Direct(1), 2), Some(1));
+        assert_eq!(disabled(database, &Shard::Multi(vec![0, 1]), 2), Some(1));
+        assert_eq!(disabled(database, &Shard::All, 2), Some(1));
+        assert_eq!(disabled("pgdog", &Shard::All, 2), None);
+
+        enable(database, 1);
+        assert_eq!(disabled(database, &Shard::All, 2), None);
+    }
+}
@@ -10,7 +10,7 @@ pub use pgdog_stats::server::Counts;
 use tokio::time::Instant;
 
 use crate::{
-    backend::{Pool, ServerOptions, pool::stats::MemoryStats},
+    backend::{Pool, ServerOptions, ServerVersion, pool::stats::MemoryStats},
     config::Memory,
     net::{
         Parameters,
@@ -98,6 +98,7 @@ pub struct ConnectedServer {
     pub stats: ServerStats,
     pub addr: Address,
     pub application_name: String,
+    pub server_version: Option<ServerVersion>,
 }
 
 /// Server statistics handle.
@@ -126,6 +127,7 @@ impl Stats {
             stats: local,
             addr: addr.clone(),
             application_name: params.get_default("application_name", "PgDog").to_owned(),
+            server_version: ServerVersion::from_params(params),
         };
 
         let shared = Arc::new(Mutex::new(server));
@@ -302,6 +304,13 @@ impl Stats {
         self.sync_to_shared();
     }
 
+    /// Track transactions rolled back because the client was idle in them for too long.
+    pub fn idle_xact_timeout(&mut self) {
+        self.local.total.idle_xact_timeouts += 1;
+        self.local.last_checkout.idle_xact_timeouts += 1;
+        self.sync_to_shared();
+    }
+
     /// Server is closing.
     pub(super) fn disconnect(&self) {
         STATS.write().remove(&self.local.id);
@@ -7,6 +7,7 @@ use pgdog_config::{
     DataType, FlexibleType, FlexibleTypeRef, ShardedMappingConfig, ShardedMappingRange,
 };
 
+use crate::frontend::router::sharding::RollingShards;
 use crate::frontend::router::sharding::mapping::compare_flexible_type;
 
 /// A single validation problem detected in a sharded table mapping configuration.
@@ -43,6 +44,24 @@ pub enum ValidationError {
         value: FlexibleType,
         data_type: DataType,
     },
+
+    /// A rolling entry's `start` isn't a timestamp, or monthly ranges don't start on the first of a month.
+    #[display(
+        "rolling range start ({start}) must be a timestamp, and the first day of a month for monthly ranges"
+    )]
+    RollingInvalidStart { start: String },
+
+    /// A rolling entry has no shards.
+    #[display("rolling range must list at least one shard")]
+    RollingNoShards,
+
+    /// A rolling entry is used on a column that isn't `varchar`.
+    #[display("rolling range requires the varchar data type, not {data_type}")]
+    RollingDataType { data_type: DataType },
+
+    /// A directory entry doesn't set exactly one of `table` and `path`.
+    #[display("directory must set either a table or a path")]
+    DirectorySource,
 }
 
 /// Collect all validation errors for a mapping configuration.
@@ -60,6 +79,8 @@ pub fn validate(
         errors.extend(check_shard_range(config, num_shards));
         errors.extend(check_range_bounds(config));
         errors.extend(check_type_compatibility(config, data_type));
+        errors.extend(check_rolling(config, data_type));
+        errors.extend(check_directory(config));
     }
     errors.extend(check_range_overlap(configs));
     errors
@@ -74,6 +95,9 @@ pub fn check_shard_range(
         ShardedMappingConfig::Default { shard } => *shard,
         ShardedMappingConfig::List(l) => l.shard,
         ShardedMappingConfig::Range(r) => r.shard,
+        ShardedMappingConfig::Rolling(r) => *r.shards.iter().find(|shard| **shard >= num_shards)?,
+        // Checked when the directory is loaded.
+        ShardedMappingConfig::Directory(_) => return None,
     };
     (shard >= num_shards).then_some(ValidationError::ShardOutOfRange { shard, num_shards })
 }
@@ -111,7 +135,9 @@ pub fn check_type_compatibility(
             .into_iter()
             .flatten()
             .collect(),
-        ShardedMappingConfig::Default { .. } => return vec![],
+        ShardedMappingConfig::Default { .. }
+        | ShardedMappingConfig::Rolling(_)
+        | ShardedMappingConfig::Directory(_) => return vec![],
     };
     values
         .into_iter()
@@ -123,6 +149,38 @@ pub fn check_type_compatibility(
         .collect()
 }
 
+/// Check that `config`, if it is a rolling entry, can be used to route timestamps.
+pub fn check_rolling(config: &ShardedMappingConfig, data_type: DataType) -> Vec<ValidationError> {
+    let ShardedMappingConfig::Rolling(r) = config else {
+        return vec![];
+    };
+
+    let mut errors = vec![];
+
+    if data_type != DataType::Varchar {
+        errors.push(ValidationError::RollingDataType { data_type });
+    }
+
+    if r.shards.is_empty() {
+        errors.push(ValidationError::RollingNoShards);
+    } else if RollingShards::new(r).is_none() {
+        errors.push(ValidationError::RollingInvalidStart {
+            start: r.start.clone(),
+        });
+    }
+
+    errors
+}
+
+/// Check that `config`, if it is a directory entry, has one place to load it from.
+pub fn check_directory(config: &ShardedMappingConfig) -> Option<ValidationError> {
+    let ShardedMappingConfig::Directory(d) = config else {
+        return None;
+    };
+
+    (d.table.is_some() == d.path.is_some()).then_some(ValidationError::DirectorySource)
+}
+
 /// Check that no two range entries in `configs` overlap.
 ///
 /// Compares every pair of ranges as half-open intervals `[start, end)`, with an
@@ -182,7 +240,10 @@ fn type_compatible(value: &FlexibleType, data_type: DataType) -> bool {
 #[cfg(test)]
 mod tests {
     use super::*;
-    use pgdog_config::{FlexibleType, ShardedMappingList, ShardedMappingRange};
+    use pgdog_config::{
+        FlexibleType, RollingInterval, ShardedMappingList, ShardedMappingRange,
+        ShardedMappingRolling,
+    };
 
     fn range(shard: usize, start: Option<i64>, end: Option<i64>) -> ShardedMappingConfig {
         ShardedMappingConfig::Range(ShardedMappingRange {
@@ -200,6 +261,16 @@ mod tests {
         ShardedMappingConfig::Default { shard }
     }
 
+    fn rolling(start: &str, interval: RollingInterval, shards: Vec<usize>) -> ShardedMappingConfig {
+        ShardedMappingConfig::Rolling(ShardedMappingRolling {
+            start: start.into(),
+            interval,
+            shards,
+            ddl: None,
+            premake: 1,
+        })
+    }
+
     mod check_shard_range {
         use super::*;
 
@@ -347,6 +418,68 @@ mod tests {
         }
     }
 
+    mod check_rolling {
+        use super::*;
+
+        #[test]
+        fn ok() {
+            let config = rolling("2026-01-01", RollingInterval::Month, vec![0, 1]);
+            assert!(check_rolling(&config, DataType::Varchar).is_empty());
+            assert!(check_shard_range(&config, 2).is_none());
+            assert!(check_rolling(&list(0, vec![]), DataType::Bigint).is_empty());
+        }
+
+        #[test]
+        fn invalid() {
+            let config = rolling("2026-01-15", RollingInterval::Month, vec![0, 4]);
+            let errors = check_rolling(&config, DataType::Bigint);
+            assert_eq!(
+                errors[0].to_string(),
+                "rolling range requires the varchar data type, not bigint"
+            );
+            assert_eq!(
+                errors[1].to_string(),
+                "rolling range start (2026-01-15) must be a timestamp, and the first day of a month for monthly ranges"
+            );
+            assert_eq!(
+                check_shard_range(&config, 2).unwrap().to_string(),
+                "shard=4 exceeds the configured shard count (2)"
+            );
+
+            let config = rolling("2026-01-01", RollingInterval::Day, vec![]);
+            assert_eq!(
+                check_rolling(&config, DataType::Varchar)[0].to_string(),
+                "rolling range must list at least one shard"
+            );
+        }
+    }
+
+    mod check_directory {
+        use super::*;
+        use pgdog_config::ShardedMappingDirectory;
+
+        fn directory(table: Option<&str>, path: Option<&str>) -> ShardedMappingConfig {
+            ShardedMappingConfig::Directory(ShardedMappingDirectory {
+                table: table.map(String::from),
+                path: path.map(Into::into),
+                refresh_interval: 1_000,
+            })
+        }
+
+        #[test]
+        fn source() {
+            assert!(check_directory(&directory(Some("pgdog.tenants"), None)).is_none());
+            assert!(check_directory(&directory(None, Some("tenants.csv"))).is_none());
+            assert_eq!(
+                check_directory(&directory(None, None)).unwrap().to_string(),
+                "directory must set either a table or a path"
+            );
+            assert!(
+                check_directory(&directory(Some("pgdog.tenants"), Some("tenants.csv"))).is_some()
+            );
+        }
+    }
+
     mod check_range_overlap {
         use super::*;
 
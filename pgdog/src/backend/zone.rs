@@ -0,0 +1,184 @@
+//! Availability zone PgDog is running in.
+//!
+//! Read queries prefer replicas in the same zone, to avoid paying
+//! for cross-zone data transfer. The zone is set with `general.zone`,
+//! or detected from the EC2 or GCP instance metadata at startup
+//! with `zone = "auto"`.
+//!
+use std::env;
+use std::time::Duration;
+
+use once_cell::sync::Lazy;
+use parking_lot::RwLock;
+use tracing::{info, warn};
+
+use crate::config::config;
+
+/// EC2 metadata endpoint used when `AWS_EC2_METADATA_SERVICE_ENDPOINT` isn't set.
+const EC2_METADATA_ENDPOINT: &str = "http://169.254.169.254";
+
+/// GCP metadata server used when `GCE_METADATA_HOST` isn't set.
+const GCP_METADATA_HOST: &str = "metadata.google.internal";
+
+/// How long to wait for the metadata servers. Outside of the cloud,
+/// they don't exist.
+const TIMEOUT: Duration = Duration::from_secs(1);
+
+static DETECTED: Lazy<RwLock<Option<String>>> = Lazy::new(|| RwLock::new(None));
+
+/// Our availability zone, if configured.
+pub fn zone() -> Option<String> {
+    match config().config.general.zone.as_deref() {
+        Some("auto") => DETECTED.read().clone(),
+        zone => zone.map(str::to_owned),
+    }
+}
+
+/// Detect our availability zone from the instance metadata,
+/// if configured with `zone = "auto"`.
+pub async fn detect() {
+    if config().config.general.zone.as_deref() != Some("auto") {
+        return;
+    }
+
+    let zone = match ec2().await {
+        Some(zone) => Some(zone),
+        None => gcp().await,
+    };
+
+    match zone {
+        Some(ref zone) => info!(r#"detected availability zone "{}""#, zone),
+        None => warn!("availability zone couldn't be detected from instance metadata"),
+    }
+
+    *DETECTED.write() = zone;
+}
+
+fn client() -> Option<reqwest::Client> {
+    reqwest::Client::builder().timeout(TIMEOUT).build().ok()
+}
+
+/// Get the zone from the EC2 instance metadata (IMDSv2).
+async fn ec2() -> Option<String> {
+    let endpoint = env::var("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+        .unwrap_or_else(|_| EC2_METADATA_ENDPOINT.to_owned());
+    let endpoint = endpoint.trim_end_matches('/');
+    let client = client()?;
+
+    let token = client
+        .put(format!("{}/latest/api/token", endpoint))
+        .header("X-aws-ec2-metadata-token-ttl-seconds", "60")
+        .send()
+        .await
+        .ok()?
+        .error_for_status()
+        .ok()?
+        .text()
+        .await
+        .ok()?;
+
+    let zone = client
+        .get(format!(
+            "{}/latest/meta-data/placement/availability-zone",
+            endpoint
+        ))
+        .header("X-aws-ec2-metadata-token", token)
+        .send()
+        .await
+        .ok()?
+        .error_for_status()
+        .ok()?
+        .text()
+        .await
+        .ok()?;
+
+    Some(zone.trim().to_owned()).filter(|zone| !zone.is_empty())
+}
+
+/// Get the zone from the GCP metadata server.
+async fn gcp() -> Option<String> {
+    let host = env::var("GCE_METADATA_HOST").unwrap_or_else(|_| GCP_METADATA_HOST.to_owned());
+
+    // e.g. projects/123456789/zones/us-central1-a
+    let zone = client()?
+        .get(format!("http://{}/computeMetadata/v1/instance/zone", host))
+        .header("Metadata-Flavor", "Google")
+        .send()
+        .await
+        .ok()?
+        .error_for_status()
+        .ok()?
+        .text()
+        .await
+        .ok()?;
+
+    zone.trim()
+        .rsplit('/')
+        .next()
+        .filter(|zone| !zone.is_empty())
+        .map(str::to_owned)
+}
+
+#[cfg(test)]
+mod tests {
+    use wiremock::matchers::{header, method, path};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+    use crate::test_utils::set_env_var;
+
+    #[tokio::test]
+    async fn test_zone_from_ec2() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("PUT"))
+            .and(path("/latest/api/token"))
+            .respond_with(ResponseTemplate::new(200).set_body_string("token"))
+            .mount(&server)
+            .await;
+
+        Mock::given(method("GET"))
+            .and(path("/latest/meta-data/placement/availability-zone"))
+            .and(header("X-aws-ec2-metadata-token", "token"))
+            .respond_with(ResponseTemplate::new(200).set_body_string("us-east-1a"))
+            .mount(&server)
+            .await;
+
+        let _endpoint = set_env_var("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.uri());
+
+        assert_eq!(ec2().await.as_deref(), Some("us-east-1a"));
+    }
+
+    #[tokio::test]
+    async fn test_zone_from_gcp() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("GET"))
+            .and(path("/computeMetadata/v1/instance/zone"))
+            .and(header("Metadata-Flavor", "Google"))
+            .respond_with(
+                ResponseTemplate::new(200)
+                    .set_body_string("projects/123456789/zones/us-central1-a"),
+            )
+            .mount(&server)
+            .await;
+
+        let _host = set_env_var("GCE_METADATA_HOST", server.address().to_string());
+
+        assert_eq!(gcp().await.as_deref(), Some("us-central1-a"));
+    }
+
+    #[tokio::test]
+    async fn test_zone_not_found() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("GET"))
+            .respond_with(ResponseTemplate::new(404))
+            .mount(&server)
+            .await;
+
+        let _host = set_env_var("GCE_METADATA_HOST", server.address().to_string());
+
+        assert_eq!(gcp().await, None);
+    }
+}
@@ -74,6 +74,25 @@ pub enum Commands {
         file: PathBuf,
     },
 
+    /// Print the shard a sharding key belongs to.
+    ShardOf {
+        /// Database in pgdog.toml.
+        #[arg(long)]
+        database: String,
+
+        /// Sharded table name.
+        #[arg(long)]
+        table: String,
+
+        /// Sharded column, if the table is sharded on more than one.
+        #[arg(long)]
+        column: Option<String>,
+
+        /// Value of the sharding key.
+        #[arg(long)]
+        key: String,
+    },
+
     /// Check configuration files for errors.
     Configcheck,
 
@@ -383,3 +402,24 @@ pub async fn route(commands: Commands) -> Result<(), Box<dyn std::error::Error>>
 
     Ok(())
 }
+
+/// Print the shard a sharding key belongs to, using the current configuration.
+#[allow(clippy::print_stdout)]
+pub fn shard_of(commands: Commands) -> Result<(), Box<dyn std::error::Error>> {
+    if let Commands::ShardOf {
+        database,
+        table,
+        column,
+        key,
+    } = commands
+    {
+        let schema = databases()
+            .sharding_schema(&database)
+            .ok_or_else(|| format!("database \"{}\" is not configured", database))?;
+        let shard = schema.shard_of(&table, column.as_deref(), &key)?;
+
+        println!("{}", shard);
+    }
+
+    Ok(())
+}
@@ -20,7 +20,7 @@ pub use database::{Database, Role};
 pub use error::Error;
 pub use general::{General, LogFormat};
 pub use memory::*;
-pub use networking::{MultiTenant, Tcp, TlsVerifyMode};
+pub use networking::{GssEncryption, MultiTenant, SniRoute, Tcp, TlsVerifyMode};
 pub use overrides::Overrides;
 use pgdog_config::ShardedTableConfig;
 pub use pgdog_config::auth::{AuthType, PassthroughAuth};
@@ -309,6 +309,7 @@ fn load_test_sharded_n(num_shards: usize) {
         database: "pgdog".into(),
         tables: vec!["sharded_omni".into()],
         sticky: false,
+        two_phase_commit: false,
     }];
     config.config.rewrite.enabled = true;
     config.config.rewrite.split_inserts = RewriteMode::Rewrite;
@@ -3,11 +3,12 @@
 //! Entrypoint for client/server interactions.
 //!
 
-use std::net::SocketAddr;
 use std::sync::Arc;
 use std::time::{Duration, Instant};
 
+use bytes::BufMut;
 use pgdog_config::users::PasswordKind;
+use pgdog_config::{ClientKeepaliveMessage, QuerySizeLimitAction};
 use timeouts::Timeouts;
 use tokio::{select, spawn};
 use tracing::{Level as LogLevel, debug, enabled, error, info, trace, warn};
@@ -15,6 +16,7 @@ use tracing::{Level as LogLevel, debug, enabled, error, info, trace, warn};
 use super::{ClientRequest, Error, PreparedStatements};
 use crate::auth::AuthResult;
 use crate::auth::{md5, scram::Server};
+use crate::backend::auth::auth_query;
 use crate::backend::maintenance_mode;
 use crate::backend::pool::stats::MemoryStats;
 use crate::backend::{
@@ -22,19 +24,20 @@ use crate::backend::{
     pool::{Connection, Request},
 };
 use crate::config::convert::user_from_params;
-use crate::config::{self, AuthType, ConfigAndUsers, config};
-use crate::frontend::ClientComms;
-use crate::frontend::client::query_engine::{QueryEngine, QueryEngineContext};
+use crate::config::{self, AuthType, ConfigAndUsers, General, config};
+use crate::frontend::client::query_engine::{QueryEngine, QueryEngineContext, statement_timeout};
+use crate::frontend::{ClientAddr, ClientComms, UserSlot, unix_socket};
 use crate::net::messages::{
-    Authentication, BackendKeyData, ErrorResponse, FromBytes, FrontendPid, Message, Password,
-    Protocol, ProtocolVersion, ReadyForQuery, ToBytes,
+    Authentication, BackendKeyData, ErrorResponse, FromBytes, FrontendPid, Message, NoticeResponse,
+    ParameterStatus, Password, Payload, Protocol, ProtocolVersion, ReadyForQuery, ToBytes,
 };
 use crate::net::{MessageBuffer, ProtocolMessage, Stream, parameter::Parameters};
 use crate::state::State;
 use crate::stats::memory::MemoryUsage;
-use crate::util::{safe_timeout, user_database_from_params};
+use crate::util::{remaining, safe_timeout, user_database_from_params};
 
 pub mod query_engine;
+pub mod replication;
 pub mod sticky;
 pub mod timeouts;
 pub mod transaction_type;
@@ -48,8 +51,8 @@ pub use transaction_type::TransactionType;
 ///
 #[derive(Debug)]
 pub struct Client {
-    // Client IP.
-    addr: SocketAddr,
+    // Client address.
+    addr: ClientAddr,
     // Client socket.
     stream: Stream,
     // Client unique key. Randomly generated
@@ -61,6 +64,9 @@ pub struct Client {
     // Process-global communication primitives used for clients
     // to talk to each other, e.g. to track their own state.
     comms: ClientComms,
+    // Slot counting towards the user's client connection limit.
+    // Released when the client disconnects.
+    _slot: Option<UserSlot>,
     // Client is connected to the admin database.
     admin: bool,
     // Client is streaming data via replication, and not running
@@ -91,8 +97,12 @@ pub struct Client {
     database: String,
     /// Log queries to stdout.
     query_log_stdout: bool,
+    /// Message sent to the client to keep its connection alive while it's idle.
+    keepalive_message: ClientKeepaliveMessage,
     /// Maximum query message size before a warning is logged.
     query_size_limit: Option<usize>,
+    /// Action taken when a query message exceeds the limit.
+    query_size_limit_action: QuerySizeLimitAction,
 }
 
 impl Client {
@@ -104,7 +114,7 @@ impl Client {
     ///
     /// - `stream`: TCP stream.
     /// - `params`: Client parameters extracted from the [`crate::net::Startup`] message.
-    /// - `addr`: TCP IP.
+    /// - `addr`: Client address, TCP or UNIX socket.
     /// - `config`: Currently loaded `pgdog.toml` and `users.toml`.
     /// - `protocol_version`: The version of the PostgreSQL protocol used by the client. This is typically 3.0, but can be 3.2
     ///   for more modern clients.
@@ -112,7 +122,7 @@ impl Client {
     pub async fn spawn(
         stream: Stream,
         params: Parameters,
-        addr: SocketAddr,
+        addr: ClientAddr,
         config: Arc<ConfigAndUsers>,
         protocol_version: ProtocolVersion,
     ) -> Result<(), Error> {
@@ -145,6 +155,71 @@ impl Client {
         }
     }
 
+    /// Add users that aren't in `users.toml` from `auth_file` to the config.
+    ///
+    /// They can connect to any database configured in `pgdog.toml`. Returns
+    /// `true` if the user was found in the file.
+    fn auth_file(user: &str, database: &str, config: &ConfigAndUsers) -> Result<bool, Error> {
+        let Some(entry) = config.userlist.user(user, database) else {
+            return Ok(false);
+        };
+
+        if !config.config.databases.iter().any(|db| db.name == database) {
+            return Ok(false);
+        }
+
+        let looked_up = auth_query::looked_up(user, database);
+
+        if !looked_up && databases::databases().cluster((user, database)).is_ok() {
+            return Ok(false);
+        }
+
+        databases::add_looked_up(entry)?;
+        auth_query::mark_looked_up(user, database);
+
+        Ok(true)
+    }
+
+    /// Look up users that aren't in `users.toml` with `auth_query`,
+    /// adding them to the config.
+    ///
+    /// Users found this way are looked up again on every login, so password
+    /// changes and dropped users are picked up. Returns an auth result if
+    /// the user should be rejected right away.
+    async fn auth_query(
+        user: &str,
+        database: &str,
+        config: &ConfigAndUsers,
+    ) -> Result<Option<AuthResult>, Error> {
+        if config.config.general.auth_query.is_none() {
+            return Ok(None);
+        }
+
+        let looked_up = auth_query::looked_up(user, database);
+
+        if !looked_up && databases::databases().cluster((user, database)).is_ok() {
+            return Ok(None);
+        }
+
+        match auth_query::lookup(&config.config.general, user, database).await {
+            Ok(Some(entry)) => {
+                databases::add_looked_up(entry)?;
+                auth_query::mark_looked_up(user, database);
+                Ok(None)
+            }
+
+            Ok(None) => Ok(Some(AuthResult::NoUserOrDatabase)),
+
+            Err(err) => {
+                error!(
+                    r#"auth_query for user "{}" and database "{}" failed: {}"#,
+                    user, database, err
+                );
+                Ok(Some(AuthResult::NoUserOrDatabase))
+            }
+        }
+    }
+
     /// Authenticate a client against the configured password(s) using the
     /// requested authentication method.
     ///
@@ -156,7 +231,7 @@ impl Client {
         auth_type: &AuthType,
         passwords: &[PasswordKind],
     ) -> Result<AuthResult, Error> {
-        if passwords.is_empty() {
+        if passwords.is_empty() && !auth_type.trust() {
             return Ok(AuthResult::NoPasswordConfig);
         }
 
@@ -216,16 +291,34 @@ impl Client {
         Ok(result)
     }
 
+    /// Peer authentication of UNIX socket clients, like in Postgres: the operating
+    /// system user of the client process must have the same name as `user`.
+    ///
+    /// Returns `None` if it isn't enabled or the client isn't using a UNIX socket.
+    async fn peer_auth(addr: &ClientAddr, user: &str, general: &General) -> Option<bool> {
+        match addr {
+            ClientAddr::Unix { uid } if general.unix_socket_peer_auth => {
+                let name = match uid {
+                    Some(uid) => unix_socket::user_name(*uid).await,
+                    None => None,
+                };
+                Some(name.as_deref() == Some(user))
+            }
+            _ => None,
+        }
+    }
+
     /// Create new frontend client from the given TCP stream.
     async fn login(
         mut stream: Stream,
         params: Parameters,
-        addr: SocketAddr,
+        addr: ClientAddr,
         config: Arc<ConfigAndUsers>,
         protocol_version: ProtocolVersion,
     ) -> Result<Option<Client>, Error> {
         // Bail immediately if TLS is required but the connection isn't using it.
-        if config.config.general.tls_client_required && !stream.is_tls() {
+        // UNIX sockets don't leave the machine, so they don't need it.
+        if config.config.general.tls_client_required && !stream.is_tls() && !stream.is_unix() {
             stream.fatal(ErrorResponse::tls_required()).await?;
             return Ok(None);
         }
@@ -233,7 +326,25 @@ impl Client {
         let (user, database) = user_database_from_params(&params);
         let admin = database == config.config.admin.name && config.config.admin.user == user;
         let admin_password = &config.config.admin.password;
-        let auth_type = &config.config.general.auth_type;
+        // UNIX socket clients are checked against their operating system user.
+        let peer = Self::peer_auth(&addr, user, &config.config.general).await;
+        // Clients from trusted networks don't need a password,
+        // except for the admin database.
+        let trusted = !admin
+            && (peer == Some(true)
+                || addr
+                    .ip()
+                    .is_some_and(|ip| config.config.general.trusted_network(ip)));
+        let trusted_networks = !config.config.general.trusted_networks.is_empty();
+        let auth_type = if trusted {
+            &AuthType::Trust
+        } else if admin && trusted_networks && config.config.general.auth_type.trust() {
+            // Trust is limited to the configured networks, which
+            // don't apply to the admin database, so ask for its password.
+            &AuthType::Scram
+        } else {
+            &config.config.general.auth_type
+        };
         let passthrough = config.config.general.passthrough_auth();
         let id = FrontendPid::new();
         let key = BackendKeyData::new_frontend(protocol_version, id);
@@ -245,7 +356,12 @@ impl Client {
         //
         // This is likely because passthrough authentication is enabled.
         //
-        let auth_result = if admin {
+        let auth_result = if peer == Some(false) {
+            AuthResult::NoPeerMatch
+        } else if auth_type.trust() && !trusted && trusted_networks {
+            // Trust is limited to the configured networks.
+            AuthResult::NoTrustedNetwork
+        } else if admin {
             // The admin database is virtual and never present in the cluster
             // map, so authenticate directly against the configured admin password.
             let passwords = [PasswordKind::Plain(admin_password.clone())];
@@ -268,6 +384,10 @@ impl Client {
             } else {
                 AuthResult::NoPassthroughNoUser
             }
+        } else if !Self::auth_file(user, database, &config)?
+            && let Some(result) = Self::auth_query(user, database, &config).await?
+        {
+            result
         } else {
             match databases::databases().cluster((user, database)) {
                 Ok(cluster) => {
@@ -316,6 +436,44 @@ impl Client {
             return Ok(None);
         }
 
+        // Check that the user doesn't have too many clients connected already.
+        let slot = if admin {
+            None
+        } else {
+            let (limit, user_limit) = databases::databases()
+                .cluster((user, database))
+                .map(|cluster| {
+                    (
+                        cluster.max_client_connections(),
+                        cluster.max_user_client_connections(),
+                    )
+                })
+                .unwrap_or_default();
+
+            match comms.reserve(user, database, limit, user_limit) {
+                Ok(slot) => Some(slot),
+                Err(limit) => {
+                    warn!(
+                        r#"user "{}" and database "{}" has too many clients connected [{}]"#,
+                        user, database, addr
+                    );
+                    stream
+                        .fatal(ErrorResponse::too_many_connections(user, database, limit))
+                        .await?;
+                    return Ok(None);
+                }
+            }
+        };
+
+        // Clients can't go over the maximum statement_timeout with
+        // startup parameters either.
+        let mut params = params.clone();
+        let max_statement_timeout = databases::databases()
+            .cluster((user, database))
+            .ok()
+            .and_then(|cluster| cluster.max_statement_timeout())
+            .filter(|max| statement_timeout::clamp_startup(&mut params, *max));
+
         let mut conn = match Connection::new(user, database, admin) {
             Ok(conn) => conn,
             Err(err) => {
@@ -349,6 +507,14 @@ impl Client {
             stream.send(&param).await?;
         }
 
+        if let Some(max) = max_statement_timeout {
+            stream
+                .send(&NoticeResponse::from(
+                    ErrorResponse::statement_timeout_lowered(max),
+                ))
+                .await?;
+        }
+
         stream.send(&key).await?;
         stream.send_flush(&ReadyForQuery::idle()).await?;
         comms.connect(key.clone(), addr, &params);
@@ -378,12 +544,14 @@ impl Client {
             stream,
             key,
             comms,
+            _slot: slot,
             admin,
             streaming: false,
             params: params.clone(),
             prepared_statements: PreparedStatements::new(),
             transaction: None,
-            timeouts: Timeouts::from_config(&config.config.general),
+            timeouts: Timeouts::from_config(&config.config.general)
+                .database(&config.config.databases, database),
             client_request: ClientRequest::default(),
             stream_buffer: MessageBuffer::new(
                 config.config.memory.message_buffer,
@@ -393,6 +561,8 @@ impl Client {
             database: database.to_string(),
             query_log_stdout: false,
             query_size_limit: None,
+            query_size_limit_action: QuerySizeLimitAction::default(),
+            keepalive_message: ClientKeepaliveMessage::default(),
         }))
     }
 
@@ -412,9 +582,10 @@ impl Client {
 
         Self {
             stream,
-            addr: SocketAddr::from(([127, 0, 0, 1], 1234)),
+            addr: std::net::SocketAddr::from(([127, 0, 0, 1], 1234)).into(),
             key,
             comms: ClientComms::new(id),
+            _slot: None,
             streaming: false,
             prepared_statements,
             admin: false,
@@ -430,6 +601,8 @@ impl Client {
             database: "pgdog".to_string(),
             query_log_stdout: false,
             query_size_limit: None,
+            query_size_limit_action: QuerySizeLimitAction::default(),
+            keepalive_message: ClientKeepaliveMessage::default(),
         }
     }
 
@@ -463,7 +636,13 @@ impl Client {
 
     /// Run the client.
     async fn run(&mut self) -> Result<(), Error> {
+        // Replication clients don't run regular queries.
+        if let Some(mode) = replication::replication(&self.params) {
+            return self.replicate(mode).await;
+        }
+
         let shutdown = self.comms.shutting_down();
+        let killed = self.comms.killed();
         let mut query_engine = QueryEngine::from_client(self)?;
 
         loop {
@@ -482,19 +661,23 @@ impl Client {
             }
 
             let client_state = query_engine.client_state();
+            let pinned = query_engine.pinned_in_transaction();
 
             select! {
                 _ = shutdown.notified() => {
                     continue; // Wake up task.
                 }
 
+                // The query is cancelled by KILL CLIENT, we just disconnect.
+                _ = killed.notified() => return Err(Error::Killed),
+
                 // Async messages.
                 message = query_engine.read_backend() => {
                     let message = message?;
                     self.server_message(&mut query_engine, message).await?;
                 }
 
-                buffer = self.buffer(client_state) => {
+                buffer = self.buffer(client_state, pinned) => {
                     let event = buffer?;
 
                     // Only send requests to the backend if they are complete.
@@ -507,6 +690,9 @@ impl Client {
                         // Client disconnected, we're done.
                         BufferEvent::DisconnectAbrupt | BufferEvent::DisconnectGraceful => break,
                         BufferEvent::HaveRequest => (),
+                        BufferEvent::IdleInTransactionTimeout => {
+                            self.idle_in_transaction_timeout(&mut query_engine).await?
+                        }
                     }
                 }
             }
@@ -529,6 +715,21 @@ impl Client {
         Ok(())
     }
 
+    /// Client was idle in transaction for too long.
+    async fn idle_in_transaction_timeout(
+        &mut self,
+        query_engine: &mut QueryEngine,
+    ) -> Result<(), Error> {
+        let timeout = self.timeouts.idle_in_transaction_rollback;
+        let mut context = QueryEngineContext::new(self);
+        query_engine
+            .idle_in_transaction_timeout(&mut context, timeout)
+            .await?;
+        self.transaction = context.transaction();
+
+        Ok(())
+    }
+
     /// Handle client messages.
     async fn client_messages(&mut self, query_engine: &mut QueryEngine) -> Result<(), Error> {
         // Check maintenance mode.
@@ -542,6 +743,21 @@ impl Client {
             query_engine.set_state(state);
         }
 
+        // The pipeline was aborted by an error in an earlier request, e.g. the client
+        // sent it in parts separated by Flush. Postgres ignores everything until Sync,
+        // so there won't be any responses to wait for.
+        if query_engine.out_of_sync() {
+            match self.client_request.iter().position(|m| m.code() == 'S') {
+                Some(sync) => {
+                    self.client_request.drain(..sync);
+                }
+                None => {
+                    debug!("pipeline aborted, ignoring request until Sync");
+                    return Ok(());
+                }
+            }
+        }
+
         // If client sent multiple requests, split them up and execute individually.
         let spliced = self.client_request.spliced()?;
         if spliced.is_empty() {
@@ -586,7 +802,7 @@ impl Client {
     ///
     /// This ensures we don't check out a connection from the pool until the client
     /// sent a complete request.
-    async fn buffer(&mut self, state: State) -> Result<BufferEvent, Error> {
+    async fn buffer(&mut self, state: State, pinned: bool) -> Result<BufferEvent, Error> {
         self.client_request.clear();
 
         // Only start timer once we receive the first message.
@@ -596,37 +812,67 @@ impl Client {
         let config = config::config();
         // Configure prepared statements cache.
         self.prepared_statements.level = config.prepared_statements();
-        self.timeouts = Timeouts::from_config(&config.config.general);
+        self.timeouts = Timeouts::from_config(&config.config.general)
+            .database(&config.config.databases, &self.database);
         self.query_log_stdout = config.config.general.query_log_stdout;
+        self.keepalive_message = config.config.general.client_keepalive_message;
         self.query_size_limit = config.config.general.query_size_limit;
+        self.query_size_limit_action = config.config.general.query_size_limit_action;
         self.stream_buffer
             .set_size_limit_block(config.config.general.frontend_query_size_limit_block());
 
+        // Keepalives don't reset idle timeouts.
+        let mut last_message = Instant::now();
+        let mut last_keepalive = last_message;
+
         while !self.client_request.is_complete() {
             let idle_timeout = self
                 .timeouts
                 .client_idle_timeout(&state, &self.client_request);
+            let rollback_timeout =
+                self.timeouts
+                    .idle_in_transaction_rollback(&state, pinned, &self.client_request);
+            let timeout = remaining(idle_timeout.min(rollback_timeout), last_message);
+            let keepalive = remaining(
+                self.timeouts.client_keepalive(&state, &self.client_request),
+                last_keepalive,
+            );
 
-            let message =
-                match safe_timeout(idle_timeout, self.stream_buffer.read(&mut self.stream)).await {
-                    Err(_) => {
-                        self.stream
-                            .fatal(ErrorResponse::client_idle_timeout(idle_timeout, &state))
-                            .await?;
-                        return Ok(BufferEvent::DisconnectAbrupt);
-                    }
+            let message = match safe_timeout(
+                timeout.min(keepalive),
+                self.stream_buffer.read(&mut self.stream),
+            )
+            .await
+            {
+                Err(_) if keepalive < timeout => {
+                    self.keepalive().await?;
+                    last_keepalive = Instant::now();
+                    continue;
+                }
+                Err(_) if rollback_timeout < idle_timeout => {
+                    return Ok(BufferEvent::IdleInTransactionTimeout);
+                }
+                Err(_) => {
+                    self.stream
+                        .fatal(ErrorResponse::client_idle_timeout(idle_timeout, &state))
+                        .await?;
+                    return Ok(BufferEvent::DisconnectAbrupt);
+                }
 
-                    Ok(Ok(message)) => message.stream(self.streaming).frontend(),
-                    Ok(Err(err)) => {
-                        if let Some(response) = err.as_fatal_error_response() {
-                            self.stream.fatal(response).await?;
-                        }
-                        return Ok(BufferEvent::DisconnectAbrupt);
+                Ok(Ok(message)) => message.stream(self.streaming).frontend(),
+                Ok(Err(err)) => {
+                    if let Some(response) = err.as_fatal_error_response() {
+                        self.stream.fatal(response).await?;
                     }
-                };
+                    return Ok(BufferEvent::DisconnectAbrupt);
+                }
+            };
+
+            last_message = Instant::now();
+            last_keepalive = last_message;
 
             if timer.is_none() {
-                timer = Some(Instant::now());
+                timer = Some(last_message);
             }
 
             // Terminate (B & F).
@@ -659,6 +905,32 @@ impl Client {
         Ok(BufferEvent::HaveRequest)
     }
 
+    /// Send a keepalive to an idle client.
+    async fn keepalive(&mut self) -> Result<(), Error> {
+        match self.keepalive_message {
+            ClientKeepaliveMessage::ParameterStatus => {
+                let status = ParameterStatus {
+                    name: "application_name".into(),
+                    value: self
+                        .params
+                        .get("application_name")
+                        .cloned()
+                        .unwrap_or_else(|| "".into()),
+                };
+                self.stream.send_flush(&status).await?;
+            }
+            ClientKeepaliveMessage::Notice => {
+                let mut notice = Payload::named('N');
+                notice.put_u8(0);
+                self.stream
+                    .send_flush(&Message::new(notice.freeze()))
+                    .await?;
+            }
+        }
+
+        Ok(())
+    }
+
     pub fn in_transaction(&self) -> bool {
         self.transaction.is_some()
     }
@@ -692,7 +964,7 @@ impl Client {
 impl MemoryUsage for Client {
     #[inline]
     fn memory_usage(&self) -> usize {
-        std::mem::size_of::<SocketAddr>()
+        std::mem::size_of::<ClientAddr>()
             + std::mem::size_of::<Stream>()
             + std::mem::size_of::<BackendKeyData>()
             + self.params.memory_usage()
@@ -713,4 +985,5 @@ enum BufferEvent {
     DisconnectGraceful,
     DisconnectAbrupt,
     HaveRequest,
+    IdleInTransactionTimeout,
 }
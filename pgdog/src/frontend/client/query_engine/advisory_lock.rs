@@ -1,38 +1,137 @@
-use fnv::FnvHashSet;
+use fnv::FnvHashMap;
 
 use crate::frontend::router::parser::statement::{AdvisoryLocks as ParserAdvisoryLocks, LockScope};
+use crate::net::{DataRow, DataType, FromBytes, Message, Protocol, RowDescription};
+
+/// Key of a session lock.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+enum LockKey {
+    /// `pg_advisory_lock(42)`.
+    Id(i64),
+    /// Computed by the server, e.g. `pg_advisory_lock(hashtext('job'))`,
+    /// so it's only released by an unlock with the same expression.
+    Expression(u64),
+}
+
+/// What `SELECT pg_try_advisory_lock(...)` returned.
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+enum TryLock {
+    /// We didn't see a result we understand, so the lock may be held.
+    #[default]
+    Unknown,
+    /// The result is a single boolean column.
+    Column,
+    /// The column has a single row.
+    Row(bool),
+}
 
 /// Tracks advisory locks held by the current client across requests.
 #[derive(Default, Debug)]
 pub(crate) struct AdvisoryLocks {
-    locks: FnvHashSet<i64>,
+    /// Session locks are reentrant: each lock must be released
+    /// as many times as it was acquired.
+    locks: FnvHashMap<LockKey, usize>,
+    /// We can't tell if some lock is still held, e.g., its key comes
+    /// from a `VALUES` row we can't read. Only `pg_advisory_unlock_all()`
+    /// or disconnecting releases those.
+    unknown: bool,
+    /// Result of the current request, if it tries to take a lock.
+    try_lock: TryLock,
 }
 
 impl AdvisoryLocks {
+    /// Read the result of a lone `pg_try_advisory_lock()` call,
+    /// so we don't count locks that weren't acquired.
+    pub(crate) fn observe(
+        &mut self,
+        locks: &ParserAdvisoryLocks,
+        message: &Message,
+    ) -> Result<(), crate::net::Error> {
+        if !matches!(message.code(), 'T' | 'D') || message.remaining() > 0 || !Self::try_lock(locks)
+        {
+            return Ok(());
+        }
+
+        self.try_lock = match (self.try_lock, message.code()) {
+            (TryLock::Unknown, 'T') => {
+                let description = RowDescription::from_bytes(message.payload())?;
+                match description.fields.as_slice() {
+                    // The column is named after the function, unless the client renamed it
+                    // or the function call is part of an expression, e.g. `NOT pg_try_advisory_lock(1)`.
+                    [field]
+                        if field.name.starts_with("pg_try_advisory_lock")
+                            && field.data_type() == DataType::Bool =>
+                    {
+                        TryLock::Column
+                    }
+                    _ => TryLock::Unknown,
+                }
+            }
+            (TryLock::Column, 'D') => {
+                let row = DataRow::from_bytes(message.payload())?;
+                // Text or binary encoding.
+                let acquired = !matches!(row.column(0).as_deref(), Some(b"f" | [0]));
+                TryLock::Row(acquired)
+            }
+            // More than one row.
+            _ => TryLock::Unknown,
+        };
+
+        Ok(())
+    }
+
+    /// The statement only tries to take one session lock.
+    fn try_lock(locks: &ParserAdvisoryLocks) -> bool {
+        locks.len() == 1
+            && locks
+                .iter()
+                .all(|lock| lock.try_lock && lock.scope == LockScope::Session)
+    }
+
     pub(crate) fn merge(&mut self, locks: &ParserAdvisoryLocks) {
+        let try_lock = std::mem::take(&mut self.try_lock);
+
         for lock in locks.iter() {
-            if lock.unlock {
-                if let Some(id) = lock.id {
-                    self.locks.remove(&id);
-                } else {
-                    // pg_advisory_unlock_all() clears every advisory lock.
-                    self.locks.clear();
+            if lock.scope != LockScope::Session {
+                continue;
+            }
+
+            let key = lock
+                .id
+                .map(LockKey::Id)
+                .or(lock.expression.map(LockKey::Expression));
+
+            if lock.all {
+                self.locks.clear();
+                self.unknown = false;
+            } else if lock.unlock {
+                if let Some(key) = key
+                    && let Some(count) = self.locks.get_mut(&key)
+                {
+                    *count -= 1;
+                    if *count == 0 {
+                        self.locks.remove(&key);
+                    }
+                }
+            } else if lock.try_lock && try_lock == TryLock::Row(false) {
+                // Someone else holds it.
+                continue;
+            } else {
+                match key {
+                    Some(key) => *self.locks.entry(key).or_default() += 1,
+                    None => self.unknown = true,
                 }
-            } else if let Some(id) = lock.id
-                && lock.scope == LockScope::Session
-            {
-                self.locks.insert(id);
             }
         }
     }
 
     pub(crate) fn locked(&self) -> bool {
-        !self.locks.is_empty()
+        !self.locks.is_empty() || self.unknown
     }
 
     #[cfg(test)]
     pub(crate) fn contains(&self, id: i64) -> bool {
-        self.locks.contains(&id)
+        self.locks.contains_key(&LockKey::Id(id))
     }
 
     #[cfg(test)]
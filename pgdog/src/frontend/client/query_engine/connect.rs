@@ -1,4 +1,9 @@
-use crate::frontend::router::parser::{ShardWithPriority, route::ShardSource};
+use pgdog_config::{Priority, QueryRoutingPool};
+
+use crate::backend::{Error as BackendError, pool::Error as PoolError};
+use crate::frontend::router::parser::{
+    ShardWithPriority, comment::slow_pool_hint, route::ShardSource,
+};
 use crate::util::safe_timeout;
 
 use super::*;
@@ -29,7 +34,11 @@ impl QueryEngine {
 
         let connect_route = connect_route.unwrap_or(context.client_request.route());
 
-        let request = Request::new(context.id, connect_route.is_read());
+        let request = Request::new(context.id, connect_route.is_read())
+            .slow(self.slow(context))
+            .tenant(Some(self.tenant.clone()))
+            .priority(self.priority(context))
+            .read_fallback(context.sticky.read_fallback);
 
         self.stats.waiting(request.created_at);
         self.comms.update_stats(self.stats);
@@ -64,10 +73,22 @@ impl QueryEngine {
                     .map(|cluster| cluster.client_connection_recovery().can_recover())
                     .unwrap_or_default();
 
-                if err.no_server() && can_recover {
+                if self.comms.offline() {
+                    // Client was waiting for a connection while we're shutting down.
+                    // Nothing ran yet, so the client loop can disconnect it with
+                    // the retryable shutdown error.
+                    self.begin_stmt = None;
+                    self.backend.disconnect();
+                    self.router.reset();
+                } else if err.no_server() && can_recover {
                     error!("{} [{:?}]", err, context.stream.peer_addr());
 
-                    let error = ErrorResponse::from_err(&err);
+                    let error = match err {
+                        BackendError::Pool(PoolError::TooManyWaiting(limit)) => {
+                            ErrorResponse::too_many_waiting_clients(limit)
+                        }
+                        _ => ErrorResponse::from_err(&err),
+                    };
 
                     self.hooks.on_engine_error(context, &error)?;
 
@@ -144,6 +165,67 @@ impl QueryEngine {
         }
     }
 
+    /// Tenant sharing the pool, from the startup parameter named
+    /// by `fair_share_tenant`, or the user if the client didn't send it.
+    pub(super) fn tenant(params: &Parameters, user: &str) -> Arc<str> {
+        let general = &config().config.general;
+
+        params
+            .get(&general.fair_share_tenant)
+            .and_then(|value| value.as_str())
+            .unwrap_or(user)
+            .into()
+    }
+
+    /// Priority of the client, from its `application_name` or its user.
+    fn priority(&self, context: &QueryEngineContext<'_>) -> Priority {
+        let general = &config().config.general;
+        let application_name = context
+            .params
+            .get("application_name")
+            .and_then(|name| name.as_str());
+
+        let listed = |apps: &[String]| {
+            application_name.is_some_and(|name| apps.iter().any(|app| app == name))
+        };
+
+        if listed(&general.high_priority_applications) {
+            Priority::High
+        } else if listed(&general.low_priority_applications) {
+            Priority::Low
+        } else {
+            self.backend
+                .cluster()
+                .map(|cluster| cluster.priority())
+                .unwrap_or_default()
+        }
+    }
+
+    /// Use the slow pool, if the database has one and the query asks for it
+    /// with a comment, a query routing rule or `slow_queries`, or the user does.
+    fn slow(&self, context: &QueryEngineContext<'_>) -> bool {
+        let Ok(cluster) = self.backend.cluster() else {
+            return false;
+        };
+
+        if !cluster.has_slow_pool() {
+            return false;
+        }
+
+        let hint = context
+            .client_request
+            .query()
+            .ok()
+            .flatten()
+            .is_some_and(|query| slow_pool_hint(query.query()));
+
+        // The router matched the query against the rules already.
+        hint || match context.client_request.route().pool() {
+            Some(pool) => pool == QueryRoutingPool::Slow,
+            None => cluster.slow_pool(),
+        }
+    }
+
     fn debug_connected(&self, context: &QueryEngineContext<'_>, connected: bool) {
         if let Ok(addr) = self.backend.addr() {
             debug!(
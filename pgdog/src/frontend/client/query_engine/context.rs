@@ -1,3 +1,5 @@
+use pgdog_config::QuerySizeLimitAction;
+
 use crate::{
     backend::pool::{connection::mirror::Mirror, stats::MemoryStats},
     frontend::{
@@ -43,6 +45,8 @@ pub struct QueryEngineContext<'a> {
     pub(super) query_log_stdout: bool,
     /// Maximum query message size before a warning is logged.
     pub(super) query_size_limit: Option<usize>,
+    /// Action taken when a query message exceeds the limit.
+    pub(super) query_size_limit_action: QuerySizeLimitAction,
 }
 
 impl<'a> QueryEngineContext<'a> {
@@ -66,6 +70,7 @@ impl<'a> QueryEngineContext<'a> {
             rewrite_result: None,
             query_log_stdout: client.query_log_stdout,
             query_size_limit: client.query_size_limit,
+            query_size_limit_action: client.query_size_limit_action,
         }
     }
 
@@ -94,6 +99,7 @@ impl<'a> QueryEngineContext<'a> {
             rewrite_result: None,
             query_log_stdout: false,
             query_size_limit: None,
+            query_size_limit_action: QuerySizeLimitAction::default(),
         }
     }
 
@@ -0,0 +1,65 @@
+use fnv::FnvHashSet;
+
+use crate::{frontend::router::parser::Cursor, net::TransactionState};
+
+/// Tracks `WITH HOLD` cursors opened by the current client across requests.
+#[derive(Default, Debug)]
+pub(crate) struct Cursors {
+    cursors: FnvHashSet<String>,
+    /// Declared in the current transaction. Postgres
+    /// closes them if it's rolled back.
+    pending: FnvHashSet<String>,
+}
+
+impl Cursors {
+    /// Record the cursor opened or closed by a request
+    /// once the server finished executing it.
+    pub(crate) fn update(
+        &mut self,
+        cursor: Option<&Cursor>,
+        state: TransactionState,
+        rollback: bool,
+    ) {
+        // The request failed and the transaction will be rolled back.
+        if state == TransactionState::Error {
+            self.pending.clear();
+            return;
+        }
+
+        match cursor {
+            Some(Cursor::Hold(name)) => {
+                self.pending.insert(name.clone());
+            }
+            Some(Cursor::Close(Some(name))) => {
+                self.cursors.remove(name);
+                self.pending.remove(name);
+            }
+            // CLOSE ALL closes every cursor.
+            Some(Cursor::Close(None)) => self.clear(),
+            None => (),
+        }
+
+        if state == TransactionState::Idle {
+            if rollback {
+                self.pending.clear();
+            } else {
+                self.cursors.extend(self.pending.drain());
+            }
+        }
+    }
+
+    /// Forget all cursors, e.g. after `DISCARD ALL`.
+    pub(crate) fn clear(&mut self) {
+        self.cursors.clear();
+        self.pending.clear();
+    }
+
+    pub(crate) fn open(&self) -> bool {
+        !self.cursors.is_empty() || !self.pending.is_empty()
+    }
+
+    #[cfg(test)]
+    pub(crate) fn contains(&self, name: &str) -> bool {
+        self.cursors.contains(name) || self.pending.contains(name)
+    }
+}
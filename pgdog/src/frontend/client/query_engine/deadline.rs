@@ -0,0 +1,78 @@
+//! Client request deadlines.
+//!
+//! Clients can limit how long a query can run for, in milliseconds,
+//! with a comment, e.g. `/* pgdog_deadline: 500 */ SELECT ...`, or
+//! for all queries with `SET pgdog.deadline TO 500`. The comment takes
+//! precedence and, like other pgdog comments, must be at the beginning
+//! or the end of the query. Postgres enforces it with `statement_timeout`,
+//! sent with the query, and restored with the next request, in or out of
+//! a transaction.
+
+use std::time::Duration;
+
+use super::*;
+use crate::frontend::router::{parameter_hints::PGDOG_DEADLINE, parser::comment::deadline_hint};
+use crate::net::parameter::ParameterValue;
+
+impl QueryEngine {
+    /// Enforce the client's deadline, if any, on the servers we are
+    /// about to send the request to.
+    pub(super) async fn deadline(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        self.backend.deadline(request_deadline(context)).await?;
+
+        Ok(())
+    }
+}
+
+/// Get the deadline from the query comment or the `pgdog.deadline` parameter.
+fn request_deadline(context: &QueryEngineContext<'_>) -> Option<Duration> {
+    if let Ok(Some(query)) = context.client_request.query()
+        && let Some(deadline) = comment_deadline(query.query())
+    {
+        return Some(deadline);
+    }
+
+    let ms: u64 = match context.params.get(PGDOG_DEADLINE)? {
+        ParameterValue::Integer(ms) => u64::try_from(*ms).ok()?,
+        ParameterValue::String(ms) => ms.parse().ok()?,
+        ParameterValue::Tuple(_) => return None,
+    };
+
+    (ms > 0).then(|| Duration::from_millis(ms))
+}
+
+fn comment_deadline(query: &str) -> Option<Duration> {
+    if !query.contains("pgdog_deadline") {
+        return None;
+    }
+
+    deadline_hint(query)
+        .filter(|ms| *ms > 0)
+        .map(Duration::from_millis)
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_comment_deadline() {
+        assert_eq!(
+            comment_deadline("/* pgdog_deadline: 500 */ SELECT 1"),
+            Some(Duration::from_millis(500))
+        );
+        assert_eq!(
+            comment_deadline("SELECT 1 /* pgdog_deadline:25 */"),
+            Some(Duration::from_millis(25))
+        );
+        assert_eq!(comment_deadline("/* pgdog_deadline: 0 */ SELECT 1"), None);
+        assert_eq!(comment_deadline("SELECT 1"), None);
+        assert_eq!(
+            comment_deadline("SELECT 'pgdog_deadline: 500', /* pgdog_deadline: 500 */ 1"),
+            None
+        );
+    }
+}
@@ -3,10 +3,18 @@ use crate::net::{CommandComplete, Protocol, ReadyForQuery};
 use super::*;
 
 impl QueryEngine {
+    /// Handle `DEALLOCATE`. Statements on the server are managed by us,
+    /// so we only forget the client's name for it.
     pub(super) async fn deallocate(
         &mut self,
         context: &mut QueryEngineContext<'_>,
+        name: Option<&str>,
     ) -> Result<(), Error> {
+        match name {
+            Some(name) => context.prepared_statements.close(name),
+            None => context.prepared_statements.close_all(),
+        }
+
         let bytes_sent = context
             .stream
             .send_many(&[
@@ -1,15 +1,36 @@
-use crate::net::{CommandComplete, Protocol, ReadyForQuery};
+use crate::{
+    frontend::router::parser::DiscardTarget,
+    net::{CommandComplete, Protocol, ReadyForQuery},
+};
 
 use super::*;
 
 impl QueryEngine {
-    /// Ignore DISCARD command.
+    /// Ignore DISCARD command, unless the server is pinned to this client
+    /// and has session state that `DISCARD ALL` resets, e.g. WITH HOLD cursors,
+    /// or temporary objects that `DISCARD TEMP` drops.
+    ///
+    /// Some drivers expect it to close their prepared statements.
     pub(super) async fn discard(
         &mut self,
         context: &mut QueryEngineContext<'_>,
         extended: bool,
+        target: DiscardTarget,
     ) -> Result<(), Error> {
         let _extended = extended;
+
+        if self
+            .backend
+            .cluster()
+            .is_ok_and(|cluster| cluster.client_profile().discard_closes_prepared())
+        {
+            context.prepared_statements.close_all();
+        }
+
+        if matches!(target, DiscardTarget::All | DiscardTarget::Temp) && self.backend.locked() {
+            return self.execute(context).await;
+        }
+
         let bytes_sent = context
             .stream
             .send_many(&[
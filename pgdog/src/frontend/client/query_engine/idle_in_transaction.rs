@@ -0,0 +1,123 @@
+//! Idle in transaction timeout.
+//!
+//! Clients that leave a transaction open pin their server connections
+//! in transaction mode. Once `idle_in_transaction_timeout` expires, we roll
+//! the transaction back and give the servers back to the pool. The client stays
+//! connected, but every query fails until it ends the transaction. Like Postgres
+//! does for a failed transaction, COMMIT is answered with ROLLBACK.
+
+use std::time::Duration;
+
+use tracing::warn;
+
+use super::*;
+use crate::frontend::{ClientRequest, client::TransactionType};
+
+impl QueryEngine {
+    /// Client is inside a transaction that's holding on to server connections.
+    pub fn pinned_in_transaction(&self) -> bool {
+        self.backend.connected()
+            && !self.backend.session_mode()
+            && !self.backend.locked()
+            && self.idle_in_transaction_aborted.is_none()
+    }
+
+    /// Roll back the transaction of a client that's been idle in it for too long.
+    pub async fn idle_in_transaction_timeout(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+        timeout: Duration,
+    ) -> Result<(), Error> {
+        warn!(
+            "rolling back transaction idle for {}ms [{:?}]",
+            timeout.as_millis(),
+            context.stream.peer_addr()
+        );
+
+        self.backend.idle_xact_timeout();
+        self.backend.transaction_params_hook(true);
+        // Servers are rolled back before going back into the pool.
+        self.backend.disconnect();
+        self.backend.mirror_clear();
+        self.notify_buffer.clear();
+        self.begin_stmt = None;
+        self.idle_in_transaction_aborted = Some(timeout);
+
+        context.transaction = context.transaction.map(|_| TransactionType::ErrorReadWrite);
+
+        Ok(())
+    }
+
+    /// Reject queries inside a transaction rolled back by the timeout,
+    /// until the client ends it with ROLLBACK or COMMIT.
+    ///
+    /// Returns `true` if the request was handled.
+    pub(super) async fn idle_in_transaction_check(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<bool, Error> {
+        let Some(timeout) = self.idle_in_transaction_aborted else {
+            return Ok(false);
+        };
+
+        let end = match self.router.command() {
+            Command::RollbackTransaction { extended } | Command::CommitTransaction { extended } => {
+                Some(*extended)
+            }
+            _ if end_transaction(context.client_request) => Some(false),
+            _ => None,
+        };
+
+        if let Some(extended) = end {
+            // The transaction is gone, so COMMIT rolls it back, like in Postgres.
+            self.idle_in_transaction_aborted = None;
+            self.end_not_connected(context, true, extended).await?;
+            context.params.rollback();
+        } else {
+            self.error_response(context, ErrorResponse::idle_in_transaction_timeout(timeout))
+                .await?;
+        }
+
+        Ok(true)
+    }
+}
+
+/// Request is a simple ROLLBACK or COMMIT, recognized without the query parser.
+fn end_transaction(request: &ClientRequest) -> bool {
+    let Ok(Some(query)) = request.query() else {
+        return false;
+    };
+
+    let query = query.query().trim().trim_end_matches(';').to_lowercase();
+    let mut words = query.split_whitespace();
+
+    matches!(words.next(), Some("rollback" | "abort" | "commit" | "end"))
+        && matches!(words.next(), None | Some("work" | "transaction"))
+        && words.next().is_none()
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+    use crate::net::Query;
+
+    #[test]
+    fn test_end_transaction() {
+        for query in [
+            "ROLLBACK",
+            "rollback;",
+            "ABORT WORK",
+            "  Rollback Transaction ; ",
+            "COMMIT",
+            "end work;",
+        ] {
+            let request = ClientRequest::from(vec![Query::new(query).into()]);
+            assert!(end_transaction(&request), "{}", query);
+        }
+
+        for query in ["ROLLBACK TO SAVEPOINT a", "COMMIT PREPARED 'a'", "SELECT 1"] {
+            let request = ClientRequest::from(vec![Query::new(query).into()]);
+            assert!(!end_transaction(&request), "{}", query);
+        }
+    }
+}
@@ -0,0 +1,459 @@
+//! Inline parameter binding fallback.
+//!
+//! Postgres only accepts parameters in a handful of statement types. Others,
+//! e.g. `CREATE TABLE ... DEFAULT $1`, are rejected when the server parses them.
+//! When `rewrite.inline_parameters` is enabled, such requests are retried
+//! once with the parameter values inlined into the query as quoted literals.
+
+use tracing::warn;
+
+use super::*;
+use crate::frontend::PreparedStatements;
+use crate::net::{ErrorResponse, FromBytes, Parse, ProtocolMessage, ToBytes, messages::Format};
+
+/// Errors returned by Postgres for statements that can't take parameters.
+const FALLBACK_CODES: [&str; 2] = [
+    "42P02", // undefined_parameter, e.g. "there is no parameter $1"
+    "42P18", // indeterminate_datatype
+];
+
+impl QueryEngine {
+    /// Send the client request to the server, retrying it with inlined parameters
+    /// if the server rejected it because the statement can't take parameters.
+    ///
+    /// Returns `false` if the request isn't eligible for the fallback and
+    /// nothing was sent.
+    pub(super) async fn inline_parameters_fallback(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<bool, Error> {
+        // A failed statement aborts the transaction, so we can't retry it.
+        if context.in_transaction() || !self.backend.cluster()?.rewrite().inline_parameters {
+            return Ok(false);
+        }
+
+        let Some(inlined) = inline_parameters(context.client_request) else {
+            return Ok(false);
+        };
+
+        self.backend
+            .handle_client_request(context.client_request, &mut self.router, self.streaming)
+            .await?;
+
+        let message = self.read_server_message().await?;
+
+        if message.code() == 'E' {
+            let error = ErrorResponse::from_bytes(message.to_bytes())?;
+
+            if FALLBACK_CODES.contains(&error.code.as_str()) {
+                // The server skips everything until Sync,
+                // so the rest is just ReadyForQuery.
+                while self.backend.has_more_messages() {
+                    self.read_server_message().await?;
+                }
+
+                warn!(
+                    "retrying statement with inlined parameters: {} [{:?}]",
+                    error.message,
+                    context.stream.peer_addr()
+                );
+
+                self.backend
+                    .handle_client_request(&inlined, &mut self.router, self.streaming)
+                    .await?;
+
+                return Ok(true);
+            }
+        }
+
+        self.process_server_message(context, message).await?;
+
+        Ok(true)
+    }
+}
+
+/// Build a copy of the request with all parameters inlined into the query.
+///
+/// Returns `None` if the request isn't a single Bind ending with one Sync,
+/// or any parameter can't be safely inlined, e.g. it's binary-encoded.
+/// Without the Sync, the server doesn't tell us when it's done skipping
+/// the failed messages, so we can't send them again.
+///
+/// If the statement was prepared by an earlier request, its query
+/// comes from the global cache and the copy gets its own Parse.
+pub(super) fn inline_parameters(request: &ClientRequest) -> Option<ClientRequest> {
+    let syncs = request
+        .messages
+        .iter()
+        .filter(|message| matches!(message, ProtocolMessage::Sync(_)))
+        .count();
+
+    if syncs != 1 || !matches!(request.messages.last(), Some(ProtocolMessage::Sync(_))) {
+        return None;
+    }
+
+    let mut parse = None;
+    let mut bind = None;
+
+    for message in &request.messages {
+        match message {
+            ProtocolMessage::Parse(message) if parse.is_none() => parse = Some(message),
+            ProtocolMessage::Bind(message) if bind.is_none() => bind = Some(message),
+            ProtocolMessage::Describe(_)
+            | ProtocolMessage::Execute(_)
+            | ProtocolMessage::Sync(_)
+            | ProtocolMessage::Other(_) => (),
+            _ => return None,
+        }
+    }
+
+    let bind = bind?;
+
+    // The server prepares the statement from the cache, if it doesn't have it yet.
+    let cached = match parse {
+        Some(_) => None,
+        None if !bind.anonymous() => Some(
+            PreparedStatements::global()
+                .read()
+                .rewritten_parse(bind.statement())?,
+        ),
+        None => return None,
+    };
+    let parse = parse.or(cached.as_ref())?;
+
+    if (cached.is_none() && bind.statement() != parse.name()) || bind.params_raw().is_empty() {
+        return None;
+    }
+
+    let mut values = Vec::with_capacity(bind.params_raw().len());
+
+    for index in 0..bind.params_raw().len() {
+        let param = bind.parameter(index).ok()??;
+
+        if param.is_null() {
+            values.push(None);
+        } else if param.format() == Format::Text {
+            values.push(Some(param.text()?));
+        } else {
+            return None;
+        }
+    }
+
+    let query = inline_query(parse.query(), &values)?;
+
+    let mut inlined = ClientRequest::default();
+
+    if cached.is_some() {
+        inlined
+            .messages
+            .push(ProtocolMessage::Parse(Parse::new_anonymous(&query)));
+    }
+
+    for message in &request.messages {
+        let message = match message {
+            ProtocolMessage::Parse(_) => ProtocolMessage::Parse(Parse::new_anonymous(&query)),
+            ProtocolMessage::Bind(bind) => {
+                let mut bind = bind.clone();
+                bind.anonymize();
+                bind.clear_params();
+                ProtocolMessage::Bind(bind)
+            }
+            ProtocolMessage::Describe(describe) => {
+                let mut describe = describe.clone();
+                if describe.is_statement() {
+                    describe.anonymize();
+                }
+                ProtocolMessage::Describe(describe)
+            }
+            other => other.clone(),
+        };
+        inlined.messages.push(message);
+    }
+
+    inlined.route = request.route.clone();
+    inlined.ast = request.ast.clone();
+
+    Some(inlined)
+}
+
+/// Replace `$n` placeholders in `query` with quoted literals.
+///
+/// String literals, quoted identifiers, dollar-quoted strings and comments
+/// are left untouched. Returns `None` if a placeholder has no value.
+fn inline_query(query: &str, values: &[Option<&str>]) -> Option<String> {
+    let bytes = query.as_bytes();
+    let mut result = String::with_capacity(query.len());
+    let mut copied = 0;
+    let mut pos = 0;
+
+    while pos < bytes.len() {
+        match bytes[pos] {
+            b'\'' => {
+                // E'' strings allow backslash escapes.
+                let escapes = pos > 0
+                    && matches!(bytes[pos - 1], b'E' | b'e')
+                    && (pos < 2 || !is_identifier(bytes[pos - 2]));
+                pos += 1;
+
+                while pos < bytes.len() {
+                    match bytes[pos] {
+                        b'\\' if escapes => pos += 2,
+                        b'\'' if bytes.get(pos + 1) == Some(&b'\'') => pos += 2,
+                        b'\'' => break,
+                        _ => pos += 1,
+                    }
+                }
+
+                pos += 1;
+            }
+
+            b'"' => {
+                // A doubled quote ends this identifier and starts a new one.
+                pos += 1;
+                while pos < bytes.len() && bytes[pos] != b'"' {
+                    pos += 1;
+                }
+                pos += 1;
+            }
+
+            b'-' if bytes.get(pos + 1) == Some(&b'-') => {
+                while pos < bytes.len() && bytes[pos] != b'\n' {
+                    pos += 1;
+                }
+            }
+
+            b'/' if bytes.get(pos + 1) == Some(&b'*') => {
+                let mut depth = 0;
+
+                while pos < bytes.len() {
+                    if bytes[pos..].starts_with(b"/*") {
+                        depth += 1;
+                        pos += 2;
+                    } else if bytes[pos..].starts_with(b"*/") {
+                        depth -= 1;
+                        pos += 2;
+                        if depth == 0 {
+                            break;
+                        }
+                    } else {
+                        pos += 1;
+                    }
+                }
+            }
+
+            // Part of an identifier, e.g. `a$1`.
+            b'$' if pos > 0 && is_identifier(bytes[pos - 1]) => pos += 1,
+
+            b'$' if bytes.get(pos + 1).is_some_and(u8::is_ascii_digit) => {
+                let start = pos;
+                pos += 1;
+                while pos < bytes.len() && bytes[pos].is_ascii_digit() {
+                    pos += 1;
+                }
+
+                let number: usize = query[start + 1..pos].parse().ok()?;
+                let value = values.get(number.checked_sub(1)?)?;
+
+                result.push_str(&query[copied..start]);
+                match value {
+                    Some(value) => result.push_str(&quote_literal(value)),
+                    None => result.push_str("NULL"),
+                }
+                copied = pos;
+            }
+
+            b'$' => {
+                // Dollar-quoted string, e.g. $$text$$ or $tag$text$tag$.
+                let tag_end = bytes[pos + 1..]
+                    .iter()
+                    .position(|c| !is_identifier(*c) || *c == b'$')
+                    .map(|end| pos + 1 + end);
+
+                match tag_end {
+                    Some(tag_end) if bytes[tag_end] == b'$' => {
+                        let tag = &query[pos..=tag_end];
+                        pos = match query[tag_end + 1..].find(tag) {
+                            Some(close) => tag_end + 1 + close + tag.len(),
+                            None => bytes.len(),
+                        };
+                    }
+                    _ => pos += 1,
+                }
+            }
+
+            _ => pos += 1,
+        }
+    }
+
+    result.push_str(&query[copied.min(query.len())..]);
+
+    Some(result)
+}
+
+/// Can this byte be part of an unquoted identifier?
+fn is_identifier(c: u8) -> bool {
+    c.is_ascii_alphanumeric() || c == b'_' || c == b'$' || c >= 0x80
+}
+
+/// Quote a string so it can be used as a literal,
+/// regardless of the `standard_conforming_strings` setting.
+fn quote_literal(value: &str) -> String {
+    let escaped = value.replace('\'', "''");
+
+    if escaped.contains('\\') {
+        format!("E'{}'", escaped.replace('\\', "\\\\"))
+    } else {
+        format!("'{}'", escaped)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::net::{Bind, Describe, Execute, Flush, Query, Sync, messages::Parameter};
+
+    #[test]
+    fn test_inline_query() {
+        assert_eq!(
+            inline_query(
+                "CREATE TABLE t (a TEXT DEFAULT $1, b INT DEFAULT $2)",
+                &[Some("it's"), None]
+            )
+            .unwrap(),
+            "CREATE TABLE t (a TEXT DEFAULT 'it''s', b INT DEFAULT NULL)"
+        );
+    }
+
+    #[test]
+    fn test_inline_query_skips_quoted() {
+        let query = r#"SELECT '$1', E'\'$1', "$1", $$ $1 $$, $tag$ $1 $tag$, a$1 -- $1
+/* $1 /* $1 */ */ $1"#;
+        assert_eq!(
+            inline_query(query, &[Some("x")]).unwrap(),
+            r#"SELECT '$1', E'\'$1', "$1", $$ $1 $$, $tag$ $1 $tag$, a$1 -- $1
+/* $1 /* $1 */ */ 'x'"#
+        );
+    }
+
+    #[test]
+    fn test_inline_query_missing_value() {
+        assert!(inline_query("SELECT $2", &[Some("x")]).is_none());
+        assert!(inline_query("SELECT $0", &[Some("x")]).is_none());
+    }
+
+    #[test]
+    fn test_quote_literal() {
+        assert_eq!(quote_literal("abc"), "'abc'");
+        assert_eq!(quote_literal("a'b"), "'a''b'");
+        assert_eq!(quote_literal(r"a\'b"), r"E'a\\''b'");
+    }
+
+    #[test]
+    fn test_inline_parameters() {
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Parse(Parse::named("__pgdog_1", "CREATE VIEW v AS SELECT $1 AS a")),
+            ProtocolMessage::Bind(Bind::new_params("__pgdog_1", &[Parameter::new(b"1")])),
+            ProtocolMessage::Describe(Describe::new_statement("__pgdog_1")),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+
+        let inlined = inline_parameters(&request).unwrap();
+        assert_eq!(inlined.messages.len(), 5);
+
+        match &inlined.messages[0] {
+            ProtocolMessage::Parse(parse) => {
+                assert!(parse.anonymous());
+                assert_eq!(parse.query(), "CREATE VIEW v AS SELECT '1' AS a");
+            }
+            _ => panic!("expected Parse"),
+        }
+
+        match &inlined.messages[1] {
+            ProtocolMessage::Bind(bind) => {
+                assert!(bind.anonymous());
+                assert!(bind.params_raw().is_empty());
+            }
+            _ => panic!("expected Bind"),
+        }
+
+        match &inlined.messages[2] {
+            ProtocolMessage::Describe(describe) => assert!(describe.anonymous()),
+            _ => panic!("expected Describe"),
+        }
+    }
+
+    #[test]
+    fn test_inline_parameters_cached_parse() {
+        // Statement prepared in an earlier request.
+        let (_, name) = PreparedStatements::global().write().insert(&Parse::named(
+            "test",
+            "CREATE VIEW inline_parameters_cached AS SELECT $1 AS a",
+        ));
+
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Bind(Bind::new_params(&name, &[Parameter::new(b"1")])),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+
+        let inlined = inline_parameters(&request).unwrap();
+        assert_eq!(inlined.messages.len(), 4);
+
+        match &inlined.messages[0] {
+            ProtocolMessage::Parse(parse) => {
+                assert!(parse.anonymous());
+                assert_eq!(
+                    parse.query(),
+                    "CREATE VIEW inline_parameters_cached AS SELECT '1' AS a"
+                );
+            }
+            _ => panic!("expected Parse"),
+        }
+
+        match &inlined.messages[1] {
+            ProtocolMessage::Bind(bind) => {
+                assert!(bind.anonymous());
+                assert!(bind.params_raw().is_empty());
+            }
+            _ => panic!("expected Bind"),
+        }
+    }
+
+    #[test]
+    fn test_inline_parameters_not_eligible() {
+        // Binary parameters can't be inlined as text.
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Parse(Parse::named("__pgdog_1", "SELECT $1")),
+            ProtocolMessage::Bind(Bind::new_params_codes(
+                "__pgdog_1",
+                &[Parameter::new(&1_i64.to_be_bytes())],
+                &[Format::Binary],
+            )),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+        assert!(inline_parameters(&request).is_none());
+
+        // Simple protocol.
+        let request = ClientRequest::from(vec![ProtocolMessage::Query(Query::new("SELECT 1"))]);
+        assert!(inline_parameters(&request).is_none());
+
+        // Statement we don't know about.
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Bind(Bind::new_params("__pgdog_unknown", &[Parameter::new(b"1")])),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+        assert!(inline_parameters(&request).is_none());
+
+        // No Sync, the server won't tell us when it's ready for the retry.
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Parse(Parse::named("__pgdog_1", "CREATE VIEW v AS SELECT $1 AS a")),
+            ProtocolMessage::Bind(Bind::new_params("__pgdog_1", &[Parameter::new(b"1")])),
+            ProtocolMessage::Execute(Execute::new()),
+            Flush.into(),
+        ]);
+        assert!(inline_parameters(&request).is_none());
+    }
+}
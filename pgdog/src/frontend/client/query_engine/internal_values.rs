@@ -47,4 +47,24 @@ impl QueryEngine {
 
         Ok(())
     }
+
+    /// EXPLAIN (ROUTE).
+    pub(super) async fn explain_route(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+        lines: Vec<String>,
+    ) -> Result<(), Error> {
+        let mut messages = vec![RowDescription::new(&[Field::text("QUERY PLAN")]).message()?];
+        for line in lines.into_iter().filter(|line| !line.is_empty()) {
+            messages.push(DataRow::from_columns(vec![line]).message()?);
+        }
+        messages.push(CommandComplete::from_str("EXPLAIN").message()?);
+        messages.push(ReadyForQuery::in_transaction(context.in_transaction()).message()?);
+
+        let bytes_sent = context.stream.send_many(&messages).await?;
+
+        self.stats.sent(bytes_sent);
+
+        Ok(())
+    }
 }
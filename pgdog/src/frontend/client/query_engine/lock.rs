@@ -4,11 +4,15 @@ impl QueryEngine {
     /// Check if we need to lock the backend to this client, and do so
     /// if needed.
     pub(super) fn check_lock(&mut self) {
-        // The presence of advisory locks or manual pin
-        // indicates we cannot release the backend.
-        let locked = self.advisory_locks.locked() || self.manual_lock;
+        // Advisory locks, WITH HOLD cursors and temporary objects live in
+        // the server session, so the client is pinned to it.
+        let pinned = self.advisory_locks.locked() || self.cursors.open() || self.temporary;
+
+        // So is a client that asked for it.
+        let locked = pinned || self.manual_lock;
 
         self.backend.lock(locked);
         self.stats.locked(locked);
+        self.stats.pinned(pinned);
     }
 }
@@ -4,45 +4,60 @@ use crate::{
     frontend::{
         BufferedQuery, Client, ClientComms, Command, Error, Router, RouterContext, Stats,
         client::query_engine::{hooks::QueryEngineHooks, route_query::ClusterCheck},
-        router::{Route, parser::Shard},
+        router::{Route, parser::Shard, sharding::relationships::ParentShard},
     },
     net::{ErrorResponse, Message, Parameters},
     state::State,
 };
 
+use std::{
+    sync::Arc,
+    time::{Duration, Instant},
+};
+
+use tokio::sync::Notify;
 use tracing::debug;
 
 pub mod advisory_lock;
 pub mod connect;
 pub mod context;
+pub mod cursors;
+pub mod deadline;
 pub mod deallocate;
 pub mod discard;
 pub mod end_transaction;
 pub mod fake;
 pub mod hooks;
+pub mod idle_in_transaction;
 pub mod incomplete_requests;
+pub mod inline_parameters;
 pub mod internal_values;
 pub mod lock;
 pub mod multi_step;
 pub mod notify_buffer;
+pub mod parent_rows;
 pub mod pub_sub;
 pub mod query;
 mod query_log_stdout;
+pub mod read_your_writes;
 pub mod rewrite;
 pub mod route_query;
+pub mod serialization_retry;
 pub mod set;
 pub mod start_transaction;
+pub mod statement_timeout;
 #[cfg(test)]
 mod test;
 #[cfg(test)]
 mod testing;
+pub mod transaction_duration;
 pub mod two_pc;
 pub mod unknown_command;
 
 use self::query::ExplainResponseState;
-use self::query_log_stdout::log_query_stdout;
 pub(crate) use advisory_lock::AdvisoryLocks;
 pub use context::QueryEngineContext;
+pub(crate) use cursors::Cursors;
 use notify_buffer::NotifyBuffer;
 use two_pc::TwoPc;
 pub use two_pc::phase::TwoPcPhase;
@@ -62,10 +77,28 @@ pub struct QueryEngine {
     pending_explain: Option<ExplainResponseState>,
     hooks: QueryEngineHooks,
     advisory_locks: AdvisoryLocks,
+    cursors: Cursors,
     // The client requested we disable transaction mode temporarily.
     // They will remain pinned to their connection until they unpin manually
     // or disconnect.
     manual_lock: bool,
+    // The client created temporary tables, views or sequences. They only exist
+    // on its server connection, so it's pinned until it disconnects
+    // or drops them with DISCARD TEMP or DISCARD ALL.
+    temporary: bool,
+    // Transaction was rolled back by the idle in transaction timeout.
+    idle_in_transaction_aborted: Option<Duration>,
+    // Tenant for fair sharing of the pool, from the startup parameters.
+    tenant: Arc<str>,
+    // When the client's last write committed, for read your writes.
+    last_write: Option<Instant>,
+    // The client wrote and its transaction hasn't finished yet.
+    write_pending: bool,
+    // Notified when the client is killed with KILL CLIENT.
+    killed: Arc<Notify>,
+    // Rows inserted into parent tables by the current transaction,
+    // learned once it commits.
+    parent_rows: Vec<ParentShard>,
 }
 
 impl QueryEngine {
@@ -88,7 +121,15 @@ impl QueryEngine {
             begin_stmt: None,
             router: Router::default(),
             advisory_locks: AdvisoryLocks::default(),
+            cursors: Cursors::default(),
             manual_lock: false,
+            temporary: false,
+            idle_in_transaction_aborted: None,
+            tenant: Self::tenant(params, user),
+            last_write: None,
+            write_pending: false,
+            killed: comms.killed(),
+            parent_rows: vec![],
         })
     }
 
@@ -98,7 +139,7 @@ impl QueryEngine {
 
     /// Wait for an async message from the backend.
     pub async fn read_backend(&mut self) -> Result<Message, Error> {
-        Ok(self.backend.read().await?)
+        self.read_server_message_partial().await
     }
 
     /// Client can safely disconnect (no active backend connection or pending transaction).
@@ -117,7 +158,7 @@ impl QueryEngine {
             .received(context.client_request.total_message_len());
         self.set_state(State::Active); // Client is active.
 
-        log_query_stdout(context);
+        self.log_query(context).await?;
 
         // Rewrite prepared statements.
         self.rewrite_extended(context)?;
@@ -144,6 +185,11 @@ impl QueryEngine {
             return Ok(());
         }
 
+        if self.idle_in_transaction_check(context).await? {
+            self.update_stats(context);
+            return Ok(());
+        }
+
         self.hooks.before_execution(context)?;
 
         // Queue up request to mirrors, if any.
@@ -177,6 +223,9 @@ impl QueryEngine {
                     .await?
             }
             Command::UniqueId => self.unique_id(context).await?,
+            Command::ExplainRoute(trace) => {
+                self.explain_route(context, trace.render_lines()).await?
+            }
             Command::StartTransaction {
                 query,
                 transaction_type,
@@ -247,8 +296,10 @@ impl QueryEngine {
                 self.reset_all(context).await?;
             }
             Command::Copy(_) => self.execute(context).await?,
-            Command::Deallocate => self.deallocate(context).await?,
-            Command::Discard { extended } => self.discard(context, *extended).await?,
+            Command::Deallocate { name } => self.deallocate(context, name.as_deref()).await?,
+            Command::Discard { extended, target } => {
+                self.discard(context, *extended, *target).await?
+            }
             command => self.unknown_command(context, command.clone()).await?,
         }
 
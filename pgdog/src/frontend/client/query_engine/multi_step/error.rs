@@ -24,6 +24,9 @@ pub enum Error {
 
     #[error("net: {0}")]
     Net(#[from] crate::net::Error),
+
+    #[error("intermediate query has no route")]
+    NoRoute,
 }
 
 #[derive(Debug, Error)]
@@ -1,4 +1,9 @@
+#[cfg(not(feature = "new_parser"))]
+use indexmap::IndexMap;
+
 use super::{CommandType, MultiServerState};
+#[cfg(not(feature = "new_parser"))]
+use crate::frontend::router::parser::rewrite::statement::insert::merge_split_requests;
 use crate::{
     frontend::{
         ClientRequest, Command, Router, RouterContext,
@@ -55,6 +60,55 @@ impl<'a> InsertMulti<'a> {
             .then_some(first)
     }
 
+    /// Merge splits routed to the same shard into one multi-tuple INSERT
+    /// per shard, so each shard executes a single statement.
+    ///
+    /// Only applies when every split has a direct route; otherwise, the splits
+    /// are executed as-is.
+    #[cfg(not(feature = "new_parser"))]
+    fn merge_by_shard(&mut self) -> Result<(), Error> {
+        let mut shards: IndexMap<usize, Vec<ClientRequest>> = IndexMap::new();
+
+        for request in &self.requests {
+            match request.route.as_ref().map(|route| route.shard()) {
+                Some(Shard::Direct(shard)) => {
+                    shards.entry(*shard).or_default();
+                }
+                _ => return Ok(()),
+            }
+        }
+
+        // Every split goes to a different shard, nothing to merge.
+        if shards.len() == self.requests.len() {
+            return Ok(());
+        }
+
+        for request in std::mem::take(&mut self.requests) {
+            if let Some(Shard::Direct(shard)) = request.route.as_ref().map(|route| route.shard()) {
+                let shard = *shard;
+                shards.entry(shard).or_default().push(request);
+            }
+        }
+
+        for (shard, mut requests) in shards {
+            let mut request = if requests.len() > 1 {
+                merge_split_requests(&requests)?
+            } else if let Some(request) = requests.pop() {
+                request
+            } else {
+                continue;
+            };
+            request.route = Some(Route::write(ShardWithPriority::new_table(Shard::Direct(
+                shard,
+            ))));
+            self.requests.push(request);
+        }
+
+        self.state = MultiServerState::new(self.requests.len());
+
+        Ok(())
+    }
+
     /// Execute the multi-shard INSERT.
     pub(crate) async fn execute(
         &'a mut self,
@@ -103,6 +157,9 @@ impl<'a> InsertMulti<'a> {
             return Err(Error::MultiShardRequired);
         }
 
+        #[cfg(not(feature = "new_parser"))]
+        self.merge_by_shard()?;
+
         for request in self.requests.iter() {
             self.engine
                 .backend
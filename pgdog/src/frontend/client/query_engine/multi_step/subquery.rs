@@ -0,0 +1,166 @@
+use indexmap::IndexSet;
+use tracing::debug;
+
+use crate::{
+    frontend::{
+        ClientRequest, Command, Router, RouterContext,
+        client::query_engine::{QueryEngine, QueryEngineContext},
+        router::parser::rewrite::statement::CrossShardSubquery,
+    },
+    net::{DataRow, ErrorResponse, Protocol},
+};
+
+use super::{Error, ForwardCheck};
+
+#[derive(Debug)]
+pub(crate) struct SubqueryMulti<'a> {
+    rewrite: CrossShardSubquery,
+    engine: &'a mut QueryEngine,
+}
+
+impl<'a> SubqueryMulti<'a> {
+    /// Create new cross-shard subquery handler.
+    pub(crate) fn new(engine: &'a mut QueryEngine, rewrite: CrossShardSubquery) -> Self {
+        Self { rewrite, engine }
+    }
+
+    /// Execute the subquery, followed by the statement using its rows.
+    pub(crate) async fn execute(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        match self.execute_internal(context).await {
+            // The subquery failed, e.g. it references a column
+            // that doesn't exist. Return the error as-is.
+            Err(Error::Execution(err)) => {
+                self.engine.error_response(context, *err).await?;
+                Ok(())
+            }
+            result => result,
+        }
+    }
+
+    pub(super) async fn execute_internal(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        let mut subquery = self
+            .rewrite
+            .subquery
+            .build_request(context.client_request)?;
+        self.route(&mut subquery, context)?;
+
+        // The subquery and the statement are on the same shard,
+        // so the shard can evaluate the subquery on its own.
+        let shard = context.client_request.route().shard();
+        if shard.is_direct() && subquery.route().shard() == shard {
+            debug!("[subquery] subquery is on the same shard");
+            return self.execute_original(context).await;
+        }
+
+        let values = self.fetch_values(&subquery).await?;
+        debug!("[subquery] fetched {} values", values.len());
+
+        let mut request = self
+            .rewrite
+            .build_request(context.client_request, &values)?;
+        self.route(&mut request, context)?;
+
+        self.engine
+            .backend
+            .handle_client_request(&request, &mut Router::default(), false)
+            .await?;
+
+        // Our request uses the extended protocol, so only
+        // forward the messages the client is expecting.
+        let mut checker = ForwardCheck::new(context.client_request);
+
+        while self.engine.backend.has_more_messages() {
+            let message = self.engine.read_server_message().await?;
+            let code = message.code();
+
+            if checker.forward(code) || matches!(code, 'C' | 'Z' | 'N' | 'S') {
+                self.engine.process_server_message(context, message).await?;
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Get the distinct values returned by the subquery from all shards.
+    async fn fetch_values(
+        &mut self,
+        request: &ClientRequest,
+    ) -> Result<Vec<Option<String>>, Error> {
+        self.engine
+            .backend
+            .handle_client_request(request, &mut Router::default(), false)
+            .await?;
+
+        let mut values = IndexSet::new();
+        let mut error = None;
+
+        while self.engine.backend.has_more_messages() {
+            let message = self.engine.read_server_message().await?;
+            match message.code() {
+                'D' => {
+                    values.insert(DataRow::try_from(message)?.get_text(0));
+                }
+                'E' => error = Some(ErrorResponse::try_from(message)?),
+                _ => (),
+            }
+        }
+
+        if let Some(error) = error {
+            return Err(error.into());
+        }
+
+        Ok(values.into_iter().collect())
+    }
+
+    async fn execute_original(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        self.engine
+            .backend
+            .handle_client_request(
+                context.client_request,
+                &mut self.engine.router,
+                self.engine.streaming,
+            )
+            .await?;
+
+        while self.engine.backend.has_more_messages() {
+            let message = self.engine.read_server_message().await?;
+            self.engine.process_server_message(context, message).await?;
+        }
+
+        Ok(())
+    }
+
+    fn route(
+        &self,
+        request: &mut ClientRequest,
+        context: &QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        let cluster = self.engine.backend.cluster()?;
+
+        let context = RouterContext::new(
+            request,
+            cluster,
+            context.params,
+            context.transaction(),
+            context.sticky,
+        )?;
+        let mut router = Router::new();
+        let command = router.query(context)?;
+        if let Command::Query(route) = command {
+            request.route = Some(route.clone());
+        } else {
+            return Err(Error::NoRoute);
+        }
+
+        Ok(())
+    }
+}
@@ -3,7 +3,7 @@ use crate::{
         ClientRequest,
         client::{query_engine::QueryEngineContext, test::TestClient},
     },
-    net::{Parameters, Query},
+    net::{CommandComplete, FromBytes, Parameters, Query, ToBytes},
 };
 
 #[tokio::test]
@@ -59,3 +59,34 @@ async fn test_cross_shard_insert_uses_all_shards() {
         "cross-shard INSERT must go through the split path, not the direct route"
     );
 }
+
+#[tokio::test]
+async fn test_cross_shard_insert_merges_tuples_per_shard() {
+    crate::logger();
+
+    let mut client = TestClient::new_rewrites(Parameters::default()).await;
+    let id0 = client.random_id_for_shard(0);
+    let id1 = client.random_id_for_shard(1);
+    let id2 = client.random_id_for_shard(0);
+
+    client
+        .send_simple(Query::new(format!(
+            "INSERT INTO sharded (id, value) VALUES ({}, 'a'), ({}, 'b'), ({}, 'c')",
+            id0, id1, id2
+        )))
+        .await;
+
+    let messages = client.read_until('Z').await.unwrap();
+    assert_eq!(messages.len(), 2);
+
+    let cc = CommandComplete::from_bytes(messages[0].to_bytes()).unwrap();
+    assert_eq!(cc.rows().unwrap(), Some(3));
+
+    client
+        .send_simple(Query::new(format!(
+            "DELETE FROM sharded WHERE id IN ({}, {}, {})",
+            id0, id1, id2
+        )))
+        .await;
+    client.read_until('Z').await.unwrap();
+}
@@ -0,0 +1,77 @@
+//! Parent rows of routing relationships.
+//!
+//! Child table rows are routed to the shard of the parent row they reference.
+//! Parent rows are learned once their INSERT commits, and looked up on
+//! all shards when a child row references one we don't know yet.
+
+use crate::backend::Cluster;
+use crate::frontend::router::sharding::relationships::ParentRow;
+use crate::net::TransactionState;
+use crate::util::escape_identifier;
+
+use super::*;
+
+impl QueryEngine {
+    /// Learn the shard of parent rows inserted by the request
+    /// once its transaction commits.
+    pub(super) fn learn_parent_rows(&mut self, state: TransactionState, rollback: bool) {
+        self.parent_rows
+            .extend_from_slice(self.router.command().route().parent_rows());
+
+        match state {
+            TransactionState::Idle if !rollback => {
+                if let Ok(cluster) = self.backend.cluster() {
+                    for parent in &self.parent_rows {
+                        cluster.relationships().learn(parent);
+                    }
+                }
+                self.parent_rows.clear();
+            }
+            TransactionState::Idle | TransactionState::Error => self.parent_rows.clear(),
+            TransactionState::InTrasaction => (),
+        }
+    }
+}
+
+/// Look the parent row up on all shards and remember its shard.
+/// Returns `false` if it doesn't exist.
+pub(super) async fn find_parent_row(cluster: &Cluster, parent: &ParentRow) -> Result<bool, Error> {
+    let Some(ref key) = parent.key else {
+        return Ok(false);
+    };
+    let relationship = &parent.relationship;
+
+    let table = match relationship.schema {
+        Some(ref schema) => format!(
+            r#""{}"."{}""#,
+            escape_identifier(schema),
+            escape_identifier(&relationship.parent_table)
+        ),
+        None => format!(r#""{}""#, escape_identifier(&relationship.parent_table)),
+    };
+    let query = format!(
+        r#"SELECT 1::bigint FROM {} WHERE "{}" = '{}' LIMIT 1"#,
+        table,
+        escape_identifier(&relationship.parent_column),
+        key.replace('\'', "''")
+    );
+
+    for shard in 0..cluster.shards().len() {
+        let mut server = cluster
+            .primary(shard, &Request::default())
+            .await
+            .map_err(crate::backend::Error::from)?;
+        let rows: Vec<i64> = server.fetch_all(query.as_str()).await?;
+
+        if !rows.is_empty() {
+            cluster.relationships().learn(&ParentShard {
+                relationship: relationship.clone(),
+                key: key.clone(),
+                shard,
+            });
+            return Ok(true);
+        }
+    }
+
+    Ok(false)
+}
@@ -1,13 +1,17 @@
+use pgdog_config::NoticeSeverity;
+use tokio::{io::AsyncWriteExt, select};
 use tracing::{info, trace};
 
 use crate::{
     frontend::{
         client::TransactionType,
-        router::parser::{explain_trace::ExplainTrace, rewrite::statement::plan::RewriteResult},
+        router::parser::{
+            DiscardTarget, explain_trace::ExplainTrace, rewrite::statement::plan::RewriteResult,
+        },
     },
     net::{
-        DataRow, FromBytes, Message, Protocol, ProtocolMessage, Query, ReadyForQuery,
-        RowDescription, ToBytes, TransactionState,
+        DataRow, FromBytes, Message, NoticeResponse, Protocol, ProtocolMessage, Query,
+        ReadyForQuery, RowDescription, ToBytes, TransactionState, stream::eof,
     },
     state::State,
     util::safe_timeout,
@@ -51,6 +55,9 @@ impl QueryEngine {
 
         self.hooks.after_connected(context, &self.backend)?;
 
+        // Enforce client deadline, if any.
+        self.deadline(context).await?;
+
         // Set response format.
         for msg in context.client_request.messages.iter() {
             if let ProtocolMessage::Bind(bind) = msg {
@@ -88,15 +95,23 @@ impl QueryEngine {
             }
 
             Some(RewriteResult::InPlace { .. }) | None => {
-                self.backend
-                    .handle_client_request(context.client_request, &mut self.router, self.streaming)
-                    .await?;
+                if !self.inline_parameters_fallback(context).await?
+                    && !self.serialization_retry(context).await?
+                {
+                    self.backend
+                        .handle_client_request(
+                            context.client_request,
+                            &mut self.router,
+                            self.streaming,
+                        )
+                        .await?;
+                }
 
                 while self.backend.has_more_messages()
                     && !self.backend.in_copy_mode()
                     && !self.streaming
                 {
-                    let message = self.read_server_message().await?;
+                    let message = self.read_server_message_partial().await?;
                     self.process_server_message(context, message).await?;
                 }
             }
@@ -106,13 +121,37 @@ impl QueryEngine {
                     .execute(context)
                     .await?;
             }
+
+            Some(RewriteResult::Subquery(subquery)) => {
+                multi_step::SubqueryMulti::new(self, subquery)
+                    .execute(context)
+                    .await?;
+            }
         }
 
         Ok(())
     }
 
+    /// Read a message from the backend, unless the client is killed
+    /// with `KILL CLIENT` while it's waiting for the server.
     pub async fn read_server_message(&mut self) -> Result<Message, Error> {
-        Ok(self.backend.read().await?)
+        select! {
+            message = self.backend.read() => Ok(message?),
+            _ = self.killed.notified() => Err(Error::Killed),
+        }
+    }
+
+    /// Read a message from the backend. `DataRow` and `CopyData` messages larger
+    /// than `message_stream_threshold` are returned in parts and
+    /// [`Self::process_server_message`] forwards the rest to the client as it arrives.
+    pub async fn read_server_message_partial(&mut self) -> Result<Message, Error> {
+        match config().config.memory.message_stream_threshold {
+            0 => self.read_server_message().await,
+            threshold => select! {
+                message = self.backend.read_partial(threshold) => Ok(message?),
+                _ = self.killed.notified() => Err(Error::Killed),
+            },
+        }
     }
 
     pub async fn process_server_message(
@@ -123,6 +162,9 @@ impl QueryEngine {
         self.streaming = message.streaming();
 
         let code = message.code();
+        if code == 'N' && self.notice_filtered(&message) {
+            return Ok(());
+        }
         let payload = if code == 'T' {
             Some(message.payload())
         } else {
@@ -154,6 +196,9 @@ impl QueryEngine {
             self.pending_explain = None;
         }
 
+        self.advisory_locks
+            .observe(self.router.command().route().advisory_locks(), &message)?;
+
         // Messages that we need to send to the client immediately.
         // ReadyForQuery (B) | CopyInResponse (B) | ErrorResponse(B) | NoticeResponse(B) | NotificationResponse (B)
         let flush = matches!(code, 'Z' | 'G' | 'E' | 'N' | 'A')
@@ -229,10 +274,35 @@ impl QueryEngine {
             // the router and the command state.
             self.advisory_locks
                 .merge(self.router.command().route().advisory_locks());
+            self.cursors.update(
+                self.router.command().route().cursor(),
+                state,
+                context.rollback,
+            );
+            self.learn_parent_rows(state, context.rollback);
+            if state == TransactionState::Idle
+                && let Command::Discard { target, .. } = self.router.command()
+            {
+                if *target == DiscardTarget::All {
+                    self.cursors.clear();
+                }
+                // Both drop the temporary objects.
+                if matches!(target, DiscardTarget::All | DiscardTarget::Temp) {
+                    self.temporary = false;
+                }
+            }
+            if self.router.command().route().temporary() && !self.temporary {
+                self.temporary = true;
+                // Drop the temporary objects before the server
+                // is given to another client.
+                self.backend.mark_dirty();
+            }
             self.check_lock();
 
             if !context.in_transaction() {
                 self.stats.transaction(two_pc_auto);
+                self.write_finished();
+                self.transaction_duration(context).await?;
             }
         }
 
@@ -243,7 +313,13 @@ impl QueryEngine {
 
         trace!("{:#?} >>> {:?}", message, context.stream.peer_addr());
 
-        if flush {
+        if message.remaining() > 0 {
+            context.stream.send(&message).await?;
+            self.forward_partial(context).await?;
+            if flush {
+                eof(context.stream.flush().await)?;
+            }
+        } else if flush {
             context.stream.send_flush(&message).await?;
         } else {
             context.stream.send(&message).await?;
@@ -257,6 +333,53 @@ impl QueryEngine {
         Ok(())
     }
 
+    /// Notices less severe than `min_notice_severity`
+    /// aren't sent to the client. Like Postgres' `client_min_messages`,
+    /// `INFO` is always sent.
+    fn notice_filtered(&self, message: &Message) -> bool {
+        let Ok(cluster) = self.backend.cluster() else {
+            return false;
+        };
+        let min_severity = cluster.min_notice_severity();
+
+        min_severity > NoticeSeverity::Debug
+            && NoticeResponse::severity(&message.payload())
+                .is_some_and(|severity| severity != NoticeSeverity::Info && severity < min_severity)
+    }
+
+    /// Forward the rest of a partially read message
+    /// to the client as it arrives from the server.
+    ///
+    /// Each part has to arrive within the query timeout and
+    /// `KILL CLIENT` stops waiting for it.
+    async fn forward_partial(&mut self, context: &mut QueryEngineContext<'_>) -> Result<(), Error> {
+        let query_timeout = context.timeouts.query_timeout(&State::Active);
+
+        loop {
+            let chunk = select! {
+                chunk = safe_timeout(query_timeout, self.backend.read_chunk()) => match chunk {
+                    Ok(chunk) => chunk?,
+                    Err(err) => {
+                        // The server stopped sending the message halfway,
+                        // the connection can't be reused.
+                        self.backend.force_close();
+                        return Err(err.into());
+                    }
+                },
+                _ = self.killed.notified() => return Err(Error::Killed),
+            };
+
+            let Some(chunk) = chunk else {
+                break;
+            };
+
+            eof(context.stream.write_all(&chunk).await)?;
+            self.stats.sent(chunk.len());
+        }
+
+        Ok(())
+    }
+
     async fn emit_explain_rows(
         &mut self,
         context: &mut QueryEngineContext<'_>,
@@ -403,14 +526,26 @@ impl QueryEngine {
     }
 
     fn two_pc_check(&mut self, context: &mut QueryEngineContext<'_>) {
-        let enabled = self
+        let (enabled, auto, ddl) = self
             .backend
             .cluster()
-            .map(|c| c.two_pc_auto_enabled())
+            .map(|c| {
+                (
+                    c.two_pc_enabled(),
+                    c.two_pc_auto_enabled(),
+                    c.two_pc_ddl_enabled(),
+                )
+            })
             .unwrap_or_default();
+        let route = context.client_request.route();
+
+        // Cross-shard DDL is applied to all shards or none.
+        let ddl = ddl && route.is_ddl() && route.is_cross_shard();
+
+        // So are writes to omnisharded tables that ask for it.
+        let omnisharded = enabled && route.is_omnisharded_two_pc() && route.should_2pc();
 
-        if enabled
-            && context.client_request.route().should_2pc()
+        if ((auto && route.should_2pc()) || ddl || omnisharded)
             && self.begin_stmt.is_none()
             && context.client_request.is_executable()
             && !context.in_transaction()
@@ -473,6 +608,18 @@ impl QueryEngine {
 
         Ok(())
     }
+
+    /// Send a notice to the client. The request carries on.
+    pub(super) async fn notice_response(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+        notice: ErrorResponse,
+    ) -> Result<(), Error> {
+        let bytes_sent = context.stream.send(&NoticeResponse::from(notice)).await?;
+        self.stats.sent(bytes_sent);
+
+        Ok(())
+    }
 }
 
 #[derive(Debug, Default, Clone)]
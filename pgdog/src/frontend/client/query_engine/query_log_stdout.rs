@@ -1,11 +1,42 @@
+use pgdog_config::QuerySizeLimitAction;
 use tracing::{info, warn};
 
-use super::QueryEngineContext;
+use super::*;
 use crate::config::config;
 use crate::net::ProtocolMessage;
+use crate::stats::query_size_limit;
 use crate::util::{sanitize_log_sample, user_database_from_params};
 
-pub(super) fn log_query_stdout(context: &QueryEngineContext<'_>) {
+impl QueryEngine {
+    /// Log the query and report it if it exceeds `query_size_limit`.
+    pub(super) async fn log_query(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        let Some(size) = log_query_stdout(context) else {
+            return Ok(());
+        };
+
+        query_size_limit::exceeded();
+
+        if context.query_size_limit_action == QuerySizeLimitAction::Notice
+            && let Some(size_limit) = context.query_size_limit
+        {
+            self.notice_response(
+                context,
+                ErrorResponse::query_size_limit_exceeded(size, size_limit),
+            )
+            .await?;
+        }
+
+        Ok(())
+    }
+}
+
+/// Log the query to stdout, if enabled, and warn about large queries.
+///
+/// Returns the size of the largest query message, if it exceeds `query_size_limit`.
+fn log_query_stdout(context: &QueryEngineContext<'_>) -> Option<usize> {
     let size_limit = context.query_size_limit;
 
     // Largest query message in the request, when it exceeds the limit.
@@ -23,11 +54,11 @@ pub(super) fn log_query_stdout(context: &QueryEngineContext<'_>) {
     });
 
     if !context.query_log_stdout && oversize.is_none() {
-        return;
+        return None;
     }
 
     let Ok(Some(query)) = context.client_request.query() else {
-        return;
+        return oversize;
     };
 
     let one_line = sanitize_log_sample(
@@ -48,4 +79,6 @@ pub(super) fn log_query_stdout(context: &QueryEngineContext<'_>) {
     } else if context.query_log_stdout {
         info!("{} [database: {}, user: {}]", one_line, database, user);
     }
+
+    oversize
 }
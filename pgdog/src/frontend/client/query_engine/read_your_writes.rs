@@ -0,0 +1,49 @@
+//! Read your writes.
+//!
+//! Replicas replay writes asynchronously, so a client reading its own write
+//! from a replica could get stale data. For `read_your_writes_window`
+//! after a client's write commits, we send its reads to the primary instead.
+
+use std::time::{Duration, Instant};
+
+use super::*;
+
+impl QueryEngine {
+    /// Send the read to the primary if the client wrote recently.
+    pub(super) fn read_your_writes(&mut self, context: &mut QueryEngineContext<'_>) {
+        let window = Duration::from_millis(config().config.general.read_your_writes_window);
+
+        if window.is_zero() || !context.client_request.is_executable() {
+            return;
+        }
+
+        // The client picked the role themselves.
+        if context.sticky.role.is_some() {
+            return;
+        }
+
+        let Some(route) = context.client_request.route.as_mut() else {
+            return;
+        };
+
+        if route.is_write() {
+            self.write_pending = true;
+        } else if self.write_pending
+            || self
+                .last_write
+                .is_some_and(|last_write| last_write.elapsed() < window)
+        {
+            route.set_read(false);
+        }
+    }
+
+    /// Start the window once the transaction that wrote is finished.
+    /// Replicas can't replay the write before it commits, so a long
+    /// transaction would otherwise use up the window.
+    pub(super) fn write_finished(&mut self) {
+        if self.write_pending {
+            self.write_pending = false;
+            self.last_write = Some(Instant::now());
+        }
+    }
+}
@@ -1,4 +1,7 @@
-use crate::frontend::router::parser::{AstContext, Cache};
+use pgdog_config::QueryParserLevel;
+use tracing::warn;
+
+use crate::frontend::router::parser::{AstContext, Cache, LazyFingerprint};
 
 use super::*;
 
@@ -8,9 +11,15 @@ impl QueryEngine {
         &mut self,
         context: &mut QueryEngineContext<'_>,
     ) -> Result<(), Error> {
+        let client_profile = self
+            .backend
+            .cluster()
+            .map(|cluster| cluster.client_profile())
+            .unwrap_or_default();
+
         for message in context.client_request.iter_mut() {
             if message.is_extended() {
-                let level = context.prepared_statements.level;
+                let level = client_profile.prepared_statements(context.prepared_statements.level);
                 if level.handles_extended() && (level.rewrite_anonymous() || !message.anonymous()) {
                     context.prepared_statements.maybe_rewrite(message)?;
                 }
@@ -34,19 +43,33 @@ impl QueryEngine {
             return Ok(true);
         }
 
+        // Shadow parser doesn't change queries.
+        let shadow = self.backend.cluster()?.query_parser() == QueryParserLevel::Shadow;
+
         let query = context.client_request.query()?;
         if let Some(query) = query {
             let cluster = self.backend.cluster()?;
             let ast_ctx = AstContext::from_cluster(cluster, context.params);
-            let ast = match Cache::get().query(&query, &ast_ctx, context.prepared_statements) {
-                Ok(ast) => ast,
+            match Cache::get().query(&query, &ast_ctx, context.prepared_statements) {
+                Ok(ast) => context.client_request.ast = Some(ast),
+                // Let Postgres decide if the query is valid,
+                // we're only observing what the parser would do.
+                Err(err) if shadow => {
+                    // The query can have sensitive values in it.
+                    let fingerprint = LazyFingerprint::new(query.query());
+                    warn!(
+                        "shadow parser error: {} [fingerprint: {}]",
+                        err,
+                        fingerprint.fingerprint().unwrap_or("none")
+                    );
+                    Cache::get().shadow_error();
+                }
                 Err(err) => {
                     self.error_response(context, ErrorResponse::syntax(err.to_string().as_str()))
                         .await?;
                     return Ok(false);
                 }
-            };
-            context.client_request.ast = Some(ast);
+            }
         }
 
         let plan = context
@@ -55,7 +78,9 @@ impl QueryEngine {
             .as_ref()
             .map(|ast| ast.rewrite_plan.clone());
 
-        if let Some(plan) = plan {
+        if let Some(plan) = plan
+            && !shadow
+        {
             context.rewrite_result = Some(plan.apply(context.client_request)?);
         }
 
@@ -1,9 +1,11 @@
 use pgdog_config::PoolerMode;
 use tracing::trace;
 
-use crate::backend::Cluster;
+use crate::backend::{Cluster, shard_kill_switch};
+use crate::frontend::router::{Error as RouterError, parser::Error as ParserError};
 use crate::util::safe_timeout;
 
+use super::parent_rows::find_parent_row;
 use super::*;
 
 #[derive(Debug, Clone)]
@@ -84,15 +86,33 @@ impl QueryEngine {
             }
         };
 
-        let router_context = RouterContext::new(
-            context.client_request,
-            cluster,
-            context.params,
-            context.transaction,
-            context.sticky,
-        )?;
-        match self.router.query(router_context) {
-            Ok(command) => {
+        // A child row references a parent row we haven't seen,
+        // e.g., inserted before we started: find its shard and route again.
+        let mut parent_row_found = false;
+        let result = loop {
+            let router_context = RouterContext::new(
+                context.client_request,
+                cluster,
+                context.params,
+                context.transaction,
+                context.sticky,
+            )?;
+            match self.router.query(router_context) {
+                Err(RouterError::Parser(ParserError::ParentRowUnknown(parent)))
+                    if !parent_row_found =>
+                {
+                    if !find_parent_row(cluster, &parent).await? {
+                        break Err(RouterError::Parser(ParserError::ParentRowUnknown(parent)));
+                    }
+                    parent_row_found = true;
+                }
+                result => break result.map(|_| ()),
+            }
+        };
+
+        match result {
+            Ok(()) => {
+                let command = self.router.command();
                 context.client_request.route = Some(command.route().clone());
                 trace!(
                     "routing {:#?} to {:#?}",
@@ -109,6 +129,16 @@ impl QueryEngine {
                 // route to a default/cross-shard target but must still be forwarded
                 // to the already-connected backend to finish the exchange.
                 if context.client_request.is_executable() {
+                    if let Some(shard) = shard_kill_switch::disabled(
+                        cluster.name(),
+                        command.route().shard(),
+                        cluster.shards().len(),
+                    ) {
+                        self.error_response(context, ErrorResponse::shard_disabled(shard))
+                            .await?;
+                        return Ok(false);
+                    }
+
                     if Self::is_omnishard_unsafe(&self.backend, command, cluster) {
                         self.error_response(context, ErrorResponse::omni_in_direct_to_shard())
                             .await?;
@@ -130,6 +160,9 @@ impl QueryEngine {
             }
         }
 
+        // After the checks, which borrow the command and the cluster.
+        self.read_your_writes(context);
+
         Ok(true)
     }
 
@@ -0,0 +1,193 @@
+//! Serialization failure retries.
+//!
+//! Postgres aborts one of the transactions involved in a serialization
+//! anomaly or a deadlock and expects the application to retry it. When the
+//! statement runs in its own implicit transaction and nothing was sent to the
+//! client yet, we can retry it instead, up to `serialization_retry_max_attempts` times.
+
+use tokio::time::sleep;
+use tracing::warn;
+
+use super::*;
+use crate::{
+    frontend::ClientRequest,
+    net::{ErrorResponse, FromBytes, ProtocolMessage, ToBytes},
+};
+
+/// Errors returned by Postgres for transactions that should be retried.
+const RETRY_CODES: [&str; 2] = [
+    "40001", // serialization_failure
+    "40P01", // deadlock_detected
+];
+
+/// Messages the server can send before the error. We hold on to them
+/// until we know the statement doesn't need to be retried.
+const HEADER_CODES: [char; 5] = [
+    '1', // ParseComplete
+    '2', // BindComplete
+    't', // ParameterDescription
+    'T', // RowDescription
+    'n', // NoData
+];
+
+impl QueryEngine {
+    /// Send the client request to the server, retrying it if it failed
+    /// with a serialization failure or a deadlock.
+    ///
+    /// Returns `false` if retries are disabled or the request isn't eligible
+    /// and nothing was sent.
+    pub(super) async fn serialization_retry(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<bool, Error> {
+        let cluster = self.backend.cluster()?;
+        let max_attempts = cluster.serialization_retry_max_attempts();
+        let base_delay = *cluster.serialization_retry_min_delay();
+
+        // Explicit transactions are aborted by the error, so the client has to retry them.
+        // Cross-shard statements could have succeeded on some of the shards.
+        if max_attempts == 0
+            || context.in_transaction()
+            || context.client_request.route().is_cross_shard()
+            || !retryable(context.client_request)
+        {
+            return Ok(false);
+        }
+
+        let mut attempt = 0;
+
+        loop {
+            self.backend
+                .handle_client_request(context.client_request, &mut self.router, self.streaming)
+                .await?;
+
+            let mut held = vec![];
+            let message = loop {
+                let message = self.read_server_message().await?;
+
+                if HEADER_CODES.contains(&message.code()) && self.backend.has_more_messages() {
+                    held.push(message);
+                } else {
+                    break message;
+                }
+            };
+
+            if message.code() == 'E' && attempt < max_attempts {
+                let error = ErrorResponse::from_bytes(message.to_bytes())?;
+
+                if RETRY_CODES.contains(&error.code.as_str()) {
+                    // The server skips everything until Sync,
+                    // so the rest is just ReadyForQuery.
+                    while self.backend.has_more_messages() {
+                        self.read_server_message().await?;
+                    }
+
+                    let backoff = base_delay * 2u32.pow(attempt.min(5) as u32);
+                    attempt += 1;
+                    self.stats.retry();
+
+                    warn!(
+                        "retrying statement after \"{}\" (attempt {}/{}) in {}ms [{:?}]",
+                        error.message,
+                        attempt,
+                        max_attempts,
+                        backoff.as_millis(),
+                        context.stream.peer_addr()
+                    );
+
+                    sleep(backoff).await;
+                    continue;
+                }
+            }
+
+            for message in held {
+                self.process_server_message(context, message).await?;
+            }
+            self.process_server_message(context, message).await?;
+
+            return Ok(true);
+        }
+    }
+}
+
+/// Can the request be sent again as-is?
+///
+/// It has to be a single simple query or a single extended protocol
+/// exchange ending with a Sync, so the server rolls back one implicit
+/// transaction and tells us when it's done. With more Syncs, the statements
+/// before the error were already committed and can't be sent again.
+fn retryable(request: &ClientRequest) -> bool {
+    let syncs = request
+        .messages
+        .iter()
+        .filter(|message| matches!(message, ProtocolMessage::Sync(_)))
+        .count();
+
+    match request.messages.as_slice() {
+        [ProtocolMessage::Query(_)] => true,
+        [.., ProtocolMessage::Sync(_)] if syncs == 1 => request.messages.iter().all(|message| {
+            !matches!(
+                message,
+                ProtocolMessage::Query(_)
+                    | ProtocolMessage::CopyData(_)
+                    | ProtocolMessage::CopyDone(_)
+                    | ProtocolMessage::CopyFail(_)
+                    | ProtocolMessage::Fastpath(_)
+            )
+        }),
+        _ => false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::net::{Bind, CopyData, Execute, Flush, Parse, Query, Sync};
+
+    #[test]
+    fn test_retryable() {
+        let request = ClientRequest::from(vec![ProtocolMessage::Query(Query::new(
+            "UPDATE t SET v = 1",
+        ))]);
+        assert!(retryable(&request));
+
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Parse(Parse::named("__pgdog_1", "UPDATE t SET v = $1")),
+            ProtocolMessage::Bind(Bind::new_statement("__pgdog_1")),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+        assert!(retryable(&request));
+
+        // No Sync, the server won't tell us the statement is done.
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Bind(Bind::new_statement("__pgdog_1")),
+            ProtocolMessage::Execute(Execute::new()),
+            Flush.into(),
+        ]);
+        assert!(!retryable(&request));
+
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::CopyData(CopyData::new(b"1\n")),
+            ProtocolMessage::Sync(Sync),
+        ]);
+        assert!(!retryable(&request));
+
+        // The first statement is committed by the time the second one fails.
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Bind(Bind::new_statement("__pgdog_1")),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+            ProtocolMessage::Bind(Bind::new_statement("__pgdog_1")),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+        assert!(!retryable(&request));
+
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Query(Query::new("UPDATE t SET v = 1")),
+            ProtocolMessage::Query(Query::new("UPDATE t SET v = 2")),
+        ]);
+        assert!(!retryable(&request));
+    }
+}
@@ -22,8 +22,15 @@ impl QueryEngine {
             return Ok(());
         }
 
+        let Some(params) = self
+            .max_statement_timeout(context, params, behave_like_select)
+            .await?
+        else {
+            return Ok(());
+        };
+
         let mut fake_command = "SET";
-        for param in params {
+        for param in &params {
             let is_pin = param.name == PGDOG_PIN;
 
             if let Some(value) = param.value.clone() {
@@ -31,6 +38,11 @@ impl QueryEngine {
                     context
                         .params
                         .insert_transaction(&param.name, value, param.local);
+                } else if param.local {
+                    // SET LOCAL outside a transaction only lasts until the end of
+                    // the implicit transaction, so it must not be replayed on
+                    // other server connections.
+                    continue;
                 } else {
                     context.params.insert(&param.name, value);
                     if is_pin {
@@ -42,6 +54,10 @@ impl QueryEngine {
                             .unwrap_or_default();
                     }
                 }
+            } else if param.local {
+                // A local reset only lasts until the end of the transaction,
+                // the session value comes back after it.
+                context.params.reset_local(&param.name);
             } else {
                 fake_command = "RESET";
                 context.params.reset(&param.name);
@@ -56,6 +72,11 @@ impl QueryEngine {
         }
 
         if self.backend.connected() {
+            // RESET ALL doesn't reset the role, so clean up the server
+            // before another client gets it.
+            if params.iter().any(|param| Parameters::is_role(&param.name)) {
+                self.backend.mark_dirty();
+            }
             self.execute(context).await?;
         } else {
             let values_to_return =
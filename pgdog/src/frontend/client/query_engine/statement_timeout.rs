@@ -0,0 +1,252 @@
+//! Maximum `statement_timeout` clients can set.
+//!
+//! If the database has `max_statement_timeout` configured, `SET statement_timeout`
+//! with a higher value (or `0`, which disables the timeout) is lowered to the maximum
+//! and the client is told about it with a `NOTICE`. If the value can't be lowered
+//! because the request is using the extended protocol, the client gets an error.
+//!
+//! The same applies to `statement_timeout` passed in startup parameters,
+//! including `options=-c statement_timeout=...`.
+
+use super::*;
+use crate::frontend::SetParam;
+use crate::net::{
+    ProtocolMessage, Query,
+    parameter::{ParameterValue, Parameters},
+};
+
+const STATEMENT_TIMEOUT: &str = "statement_timeout";
+
+impl QueryEngine {
+    /// Lower `statement_timeout` to the maximum allowed for this database, if needed.
+    ///
+    /// Returns the params to apply. If the client is connected to a server, the request
+    /// is rewritten so the server receives the lowered value as well. If it can't be,
+    /// the client gets an error and `None` is returned.
+    pub(super) async fn max_statement_timeout(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+        params: &[SetParam],
+        behave_like_select: bool,
+    ) -> Result<Option<Vec<SetParam>>, Error> {
+        let Some(max) = self
+            .backend
+            .cluster()
+            .ok()
+            .and_then(|cluster| cluster.max_statement_timeout())
+        else {
+            return Ok(Some(params.to_vec()));
+        };
+
+        let mut clamped = false;
+        let lowered = params
+            .iter()
+            .map(|param| {
+                let mut param = param.clone();
+                if param.name.eq_ignore_ascii_case(STATEMENT_TIMEOUT)
+                    && let Some(ref value) = param.value
+                    && exceeds(value, max)
+                {
+                    param.value = Some(ParameterValue::String(max.to_string()));
+                    clamped = true;
+                }
+                param
+            })
+            .collect::<Vec<_>>();
+
+        if !clamped {
+            return Ok(Some(lowered));
+        }
+
+        // The server will run the SETs, so make sure it gets the lowered value.
+        if self.backend.connected() {
+            let query = rewrite(&lowered, behave_like_select);
+
+            // Only simple protocol requests can be rewritten. Don't send
+            // the others, the server would get the value over the maximum.
+            if context
+                .client_request
+                .rewrite(&[ProtocolMessage::from(Query::new(query))])
+                .is_err()
+            {
+                self.error_response(context, ErrorResponse::statement_timeout_too_high(max))
+                    .await?;
+                return Ok(None);
+            }
+        }
+
+        self.notice_response(context, ErrorResponse::statement_timeout_lowered(max))
+            .await?;
+
+        Ok(Some(lowered))
+    }
+}
+
+/// Lower `statement_timeout` passed in startup parameters to the maximum.
+///
+/// Returns `true` if it was lowered.
+pub(crate) fn clamp_startup(params: &mut Parameters, max: u64) -> bool {
+    if params
+        .get(STATEMENT_TIMEOUT)
+        .is_some_and(|value| exceeds(value, max))
+    {
+        params.insert(STATEMENT_TIMEOUT, max.to_string());
+        true
+    } else {
+        false
+    }
+}
+
+/// Build the statement the server runs instead, keeping the shape of the
+/// original so the client gets the reply it expects: a row for
+/// `SELECT set_config(...)` and `SET` for everything else.
+fn rewrite(params: &[SetParam], behave_like_select: bool) -> String {
+    if behave_like_select {
+        let calls = params
+            .iter()
+            .map(|param| {
+                // NULL resets the parameter.
+                let value = param
+                    .value
+                    .as_ref()
+                    .map(literal)
+                    .unwrap_or_else(|| "NULL".into());
+                format!(
+                    "set_config({}, {}, {})",
+                    literal(&ParameterValue::String(param.name.clone())),
+                    value,
+                    param.local
+                )
+            })
+            .collect::<Vec<_>>()
+            .join(", ");
+
+        format!("SELECT {}", calls)
+    } else {
+        params
+            .iter()
+            .map(|param| {
+                let set = if param.local { "SET LOCAL" } else { "SET" };
+                match param.value {
+                    Some(ref value) => format!(r#"{} "{}" TO {}"#, set, param.name, value),
+                    None => format!(r#"RESET "{}""#, param.name),
+                }
+            })
+            .collect::<Vec<_>>()
+            .join("; ")
+    }
+}
+
+/// Quote the value as a string literal.
+fn literal(value: &ParameterValue) -> String {
+    let value = match value {
+        ParameterValue::String(value) => value.clone(),
+        ParameterValue::Integer(value) => value.to_string(),
+        ParameterValue::Tuple(values) => values.join(", "),
+    };
+
+    format!("'{}'", value.replace('\'', "''"))
+}
+
+/// The requested timeout is higher than the maximum.
+/// `0` disables the timeout, so it's always higher.
+fn exceeds(value: &ParameterValue, max: u64) -> bool {
+    match timeout_ms(value) {
+        Some(0) => true,
+        Some(timeout) => timeout > max,
+        None => false,
+    }
+}
+
+/// Parse `statement_timeout` into milliseconds, e.g. `5000`, `'5s'` or `'1min'`.
+fn timeout_ms(value: &ParameterValue) -> Option<u64> {
+    let value = match value {
+        ParameterValue::Integer(ms) => return u64::try_from(*ms).ok(),
+        ParameterValue::String(value) => value.trim().trim_matches('"').trim_matches('\''),
+        ParameterValue::Tuple(_) => return None,
+    };
+
+    let split = value
+        .find(|c: char| !c.is_ascii_digit() && c != '.')
+        .unwrap_or(value.len());
+    let (number, unit) = value.split_at(split);
+    let number: f64 = number.parse().ok()?;
+
+    let multiplier = match unit.trim() {
+        "" | "ms" => 1.0,
+        "us" => 0.001,
+        "s" => 1_000.0,
+        "min" => 60_000.0,
+        "h" => 3_600_000.0,
+        "d" => 86_400_000.0,
+        _ => return None,
+    };
+
+    Some((number * multiplier) as u64)
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_timeout_ms() {
+        assert_eq!(timeout_ms(&ParameterValue::Integer(500)), Some(500));
+        assert_eq!(timeout_ms(&"5000".into()), Some(5000));
+        assert_eq!(timeout_ms(&"5s".into()), Some(5000));
+        assert_eq!(timeout_ms(&"'2min'".into()), Some(120_000));
+        assert_eq!(timeout_ms(&"1 h".into()), Some(3_600_000));
+        assert_eq!(timeout_ms(&"1500us".into()), Some(1));
+        assert_eq!(timeout_ms(&"forever".into()), None);
+    }
+
+    #[test]
+    fn test_exceeds() {
+        assert!(exceeds(&"0".into(), 1000));
+        assert!(exceeds(&"2s".into(), 1000));
+        assert!(!exceeds(&"1s".into(), 1000));
+        assert!(!exceeds(&"500".into(), 1000));
+        assert!(!exceeds(&"default".into(), 1000));
+    }
+
+    #[test]
+    fn test_clamp_startup() {
+        let mut params = Parameters::default();
+        params.insert("statement_timeout", "0");
+        assert!(clamp_startup(&mut params, 1000));
+        assert_eq!(params.get("statement_timeout"), Some(&"1000".into()));
+
+        params.insert("statement_timeout", "500");
+        assert!(!clamp_startup(&mut params, 1000));
+        assert_eq!(params.get("statement_timeout"), Some(&"500".into()));
+
+        let mut params = Parameters::default();
+        assert!(!clamp_startup(&mut params, 1000));
+        assert!(params.get("statement_timeout").is_none());
+    }
+
+    #[test]
+    fn test_rewrite_keeps_shape() {
+        let params = vec![
+            SetParam {
+                name: "statement_timeout".into(),
+                value: Some("1000".into()),
+                local: false,
+            },
+            SetParam {
+                name: "application_name".into(),
+                value: None,
+                local: true,
+            },
+        ];
+
+        assert_eq!(
+            rewrite(&params, false),
+            r#"SET "statement_timeout" TO "1000"; RESET "application_name""#
+        );
+        assert_eq!(
+            rewrite(&params, true),
+            "SELECT set_config('statement_timeout', '1000', false), set_config('application_name', NULL, true)"
+        );
+    }
+}
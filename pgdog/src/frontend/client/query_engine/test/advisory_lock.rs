@@ -1,4 +1,7 @@
-use super::prelude::*;
+use pgdog_config::PreparedStatements as PreparedStatementsLevel;
+
+use super::{change_config, prelude::*};
+use crate::net::{DataRow, FromBytes};
 
 #[tokio::test]
 async fn test_session_lock_tracked_outside_transaction() {
@@ -196,3 +199,156 @@ async fn test_xact_lock_released_on_rollback() {
     assert_eq!(locks.len(), 0);
     assert!(!client.backend_locked());
 }
+
+#[tokio::test]
+async fn test_reentrant_lock_held_until_released_twice() {
+    let mut client = TestClient::new_sharded(Parameters::default()).await;
+
+    for _ in 0..2 {
+        client
+            .send_simple(Query::new("SELECT pg_advisory_lock(505)"))
+            .await;
+        client.read_until('Z').await.unwrap();
+    }
+
+    client
+        .send_simple(Query::new("SELECT pg_advisory_unlock(505)"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.advisory_locks().contains(505));
+    assert!(
+        client.backend_locked(),
+        "lock taken twice is held until it's released twice"
+    );
+
+    client
+        .send_simple(Query::new("SELECT pg_advisory_unlock(505)"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert_eq!(client.engine.advisory_locks().len(), 0);
+    assert!(!client.backend_locked());
+}
+
+#[tokio::test]
+async fn test_computed_key_released_by_same_expression() {
+    let mut client = TestClient::new_sharded(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new("SELECT pg_advisory_lock(hashtext('job'))"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.advisory_locks().locked());
+    assert!(client.backend_locked());
+
+    // Another key.
+    client
+        .send_simple(Query::new("SELECT pg_advisory_unlock(hashtext('other'))"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.advisory_locks().locked());
+    assert!(client.backend_locked());
+
+    client
+        .send_simple(Query::new("SELECT pg_advisory_unlock(hashtext( 'job' ))"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.advisory_locks().locked());
+    assert!(!client.backend_locked());
+}
+
+#[tokio::test]
+async fn test_try_lock_released_by_unlock() {
+    let mut client = TestClient::new_sharded(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new("SELECT pg_try_advisory_lock(707)"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.advisory_locks().contains(707));
+    assert!(client.backend_locked());
+
+    client
+        .send_simple(Query::new("SELECT pg_advisory_unlock(707)"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.advisory_locks().locked());
+    assert!(!client.backend_locked());
+}
+
+#[tokio::test]
+async fn test_try_lock_not_acquired() {
+    let mut holder = TestClient::new(Parameters::default()).await;
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    holder
+        .send_simple(Query::new("SELECT pg_advisory_lock(708)"))
+        .await;
+    holder.read_until('Z').await.unwrap();
+    assert!(holder.backend_locked());
+
+    client
+        .send_simple(Query::new("SELECT pg_try_advisory_lock(708)"))
+        .await;
+    let messages = client.read_until('Z').await.unwrap();
+    let row = messages
+        .iter()
+        .find(|message| message.code() == 'D')
+        .unwrap();
+    assert_eq!(
+        DataRow::from_bytes(row.payload()).unwrap().get_text(0),
+        Some("f".into())
+    );
+
+    // The lock is held by someone else.
+    assert!(!client.engine.advisory_locks().locked());
+    assert!(!client.backend_locked());
+
+    holder
+        .send_simple(Query::new("SELECT pg_advisory_unlock(708)"))
+        .await;
+    holder.read_until('Z').await.unwrap();
+    assert!(!holder.backend_locked());
+}
+
+#[tokio::test]
+async fn test_lock_extended_anonymous() {
+    let mut client = TestClient::new_sharded(Parameters::default()).await;
+    let _config = change_config(|general| {
+        general.prepared_statements = PreparedStatementsLevel::ExtendedAnonymous;
+    });
+
+    for query in [
+        "SELECT pg_advisory_lock($1)",
+        "SELECT pg_advisory_unlock($1)",
+    ] {
+        client.send(Parse::new_anonymous(query)).await;
+        client
+            .send(Bind::new_params(
+                "",
+                &[Parameter {
+                    len: 3,
+                    data: "606".into(),
+                }],
+            ))
+            .await;
+        client.send(Execute::new()).await;
+        client.send(Sync).await;
+        client.try_process().await.unwrap();
+        client.read_until('Z').await.unwrap();
+
+        if query.contains("unlock") {
+            assert_eq!(client.engine.advisory_locks().len(), 0);
+            assert!(!client.backend_locked());
+        } else {
+            assert!(client.engine.advisory_locks().contains(606));
+            assert!(client.backend_locked());
+        }
+    }
+}
@@ -0,0 +1,171 @@
+use super::prelude::*;
+
+#[tokio::test]
+async fn test_hold_cursor_survives_commit() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client.send_simple(Query::new("BEGIN")).await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new(
+            "DECLARE pgdog_hold_cursor CURSOR WITH HOLD FOR SELECT generate_series(1, 10)",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    client.send_simple(Query::new("COMMIT")).await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.cursors().contains("pgdog_hold_cursor"));
+    assert!(client.engine.stats().pinned);
+    assert!(client.backend_connected());
+    assert!(
+        client.backend_locked(),
+        "backend must stay pinned while the cursor is open"
+    );
+
+    // The cursor is on this server connection.
+    client
+        .send_simple(Query::new("FETCH 5 FROM pgdog_hold_cursor"))
+        .await;
+    let messages = client.read_until('Z').await.unwrap();
+    assert_eq!(messages.iter().filter(|m| m.code() == 'D').count(), 5);
+
+    client
+        .send_simple(Query::new("CLOSE pgdog_hold_cursor"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.cursors().open());
+    assert!(!client.engine.stats().pinned);
+    assert!(!client.backend_locked());
+    assert!(
+        !client.backend_connected(),
+        "backend must be released once the cursor is closed"
+    );
+}
+
+#[tokio::test]
+async fn test_cursor_without_hold_not_pinned() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client.send_simple(Query::new("BEGIN")).await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new(
+            "DECLARE pgdog_cursor CURSOR FOR SELECT generate_series(1, 10)",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new("FETCH 5 FROM pgdog_cursor"))
+        .await;
+    let messages = client.read_until('Z').await.unwrap();
+    assert_eq!(messages.iter().filter(|m| m.code() == 'D').count(), 5);
+
+    client.send_simple(Query::new("COMMIT")).await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.cursors().open());
+    assert!(!client.backend_locked());
+    assert!(!client.backend_connected());
+}
+
+#[tokio::test]
+async fn test_close_all_releases_backend() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    for name in ["pgdog_hold_a", "pgdog_hold_b"] {
+        client
+            .send_simple(Query::new(format!(
+                "DECLARE {} CURSOR WITH HOLD FOR SELECT 1",
+                name
+            )))
+            .await;
+        client.read_until('Z').await.unwrap();
+    }
+
+    assert!(client.backend_locked());
+
+    client.send_simple(Query::new("CLOSE ALL")).await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.cursors().open());
+    assert!(!client.backend_locked());
+    assert!(!client.backend_connected());
+}
+
+#[tokio::test]
+async fn test_failed_declare_not_pinned() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new(
+            "DECLARE pgdog_hold_missing CURSOR WITH HOLD FOR SELECT * FROM pgdog_no_such_table",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.cursors().open());
+    assert!(!client.backend_locked());
+}
+
+#[tokio::test]
+async fn test_hold_cursor_closed_by_rollback() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new(
+            "DECLARE pgdog_hold_kept CURSOR WITH HOLD FOR SELECT 1",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    client.send_simple(Query::new("BEGIN")).await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new(
+            "DECLARE pgdog_hold_rolled_back CURSOR WITH HOLD FOR SELECT 1",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+    assert!(client.engine.cursors().contains("pgdog_hold_rolled_back"));
+
+    client.send_simple(Query::new("ROLLBACK")).await;
+    client.read_until('Z').await.unwrap();
+
+    // Only the cursor declared in the rolled back transaction is gone.
+    assert!(!client.engine.cursors().contains("pgdog_hold_rolled_back"));
+    assert!(client.engine.cursors().contains("pgdog_hold_kept"));
+    assert!(client.backend_locked());
+
+    client
+        .send_simple(Query::new("CLOSE pgdog_hold_kept"))
+        .await;
+    client.read_until('Z').await.unwrap();
+    assert!(!client.backend_locked());
+}
+
+#[tokio::test]
+async fn test_discard_all_releases_backend() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new(
+            "DECLARE pgdog_hold_discard CURSOR WITH HOLD FOR SELECT 1",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+    assert!(client.backend_locked());
+
+    client.send_simple(Query::new("DISCARD ALL")).await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.cursors().open());
+    assert!(!client.backend_locked());
+    assert!(!client.backend_connected());
+}
@@ -6,14 +6,15 @@ use crate::{
         BindComplete, CommandComplete, DataRow, Parameters, ParseComplete, ReadyForQuery,
         RowDescription, bind::Parameter,
     },
+    test_utils::ConfigGuard,
 };
 
 use super::{change_config, prelude::*};
 
-fn set_extended_anonymous() {
+fn set_extended_anonymous() -> ConfigGuard {
     change_config(|g| {
         g.prepared_statements = PreparedStatementsLevel::ExtendedAnonymous;
-    });
+    })
 }
 
 /// Extended protocol with named prepared statement works in extended_anonymous mode.
@@ -21,7 +22,7 @@ fn set_extended_anonymous() {
 #[tokio::test]
 async fn test_extended_anonymous_basic() {
     let mut client = TestClient::new_replicas(Parameters::default()).await;
-    set_extended_anonymous();
+    let _config = set_extended_anonymous();
 
     client.send(Parse::named("test", "SELECT $1")).await;
     client
@@ -53,7 +54,7 @@ async fn test_extended_anonymous_basic() {
 #[tokio::test]
 async fn test_extended_anonymous_with_describe() {
     let mut client = TestClient::new_replicas(Parameters::default()).await;
-    set_extended_anonymous();
+    let _config = set_extended_anonymous();
 
     client.send(Parse::named("desc_test", "SELECT $1")).await;
     client
@@ -89,7 +90,7 @@ async fn test_extended_anonymous_with_describe() {
 #[tokio::test]
 async fn test_extended_anonymous_transaction_state() {
     let mut client = TestClient::new_replicas(Parameters::default()).await;
-    set_extended_anonymous();
+    let _config = set_extended_anonymous();
 
     // BEGIN
     client.send(Query::new("BEGIN")).await;
@@ -138,7 +139,7 @@ async fn test_extended_anonymous_transaction_state() {
 #[tokio::test]
 async fn test_extended_anonymous_close() {
     let mut client = TestClient::new_replicas(Parameters::default()).await;
-    set_extended_anonymous();
+    let _config = set_extended_anonymous();
 
     // Parse first
     client.send(Parse::named("close_test", "SELECT 1")).await;
@@ -162,7 +163,7 @@ async fn test_extended_anonymous_close() {
 #[tokio::test]
 async fn test_extended_anonymous_repeated_statement_name() {
     let mut client = TestClient::new_replicas(Parameters::default()).await;
-    set_extended_anonymous();
+    let _config = set_extended_anonymous();
 
     for i in 0..5 {
         let val = format!("{}", i);
@@ -191,7 +192,7 @@ async fn test_extended_anonymous_repeated_statement_name() {
 #[tokio::test]
 async fn test_extended_anonymous_simple_query_unaffected() {
     let mut client = TestClient::new_replicas(Parameters::default()).await;
-    set_extended_anonymous();
+    let _config = set_extended_anonymous();
 
     client.send_simple(Query::new("SELECT 42")).await;
 
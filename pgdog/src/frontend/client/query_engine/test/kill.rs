@@ -0,0 +1,47 @@
+use std::time::Duration;
+
+use tokio::time::{sleep, timeout};
+
+use crate::{
+    admin::{Command, kill::Kill},
+    config::load_test,
+    expect_message,
+    net::{DataRow, ErrorResponse, Format, RowDescription},
+};
+
+use super::prelude::*;
+
+/// Test that killing a client waiting on a long query disconnects it
+/// right away and cancels the query on the server.
+#[tokio::test]
+async fn test_kill_client_running_query() {
+    load_test();
+
+    let (mut client, id) = SpawnedClient::new_connected(Parameters::default()).await;
+    let mut other = TestClient::new(Parameters::default()).await;
+
+    client.send(Query::new("SELECT pg_sleep(9.25)")).await;
+    // Let the query reach the server.
+    sleep(Duration::from_millis(250)).await;
+
+    Kill::Client(id.pid()).execute().await.unwrap();
+
+    let err = expect_message!(client.read().await, ErrorResponse);
+    assert_eq!(err.code, "57P01");
+
+    timeout(Duration::from_secs(2), client.join())
+        .await
+        .expect("client loop did not exit after kill");
+
+    // The query doesn't keep running after the client is gone.
+    sleep(Duration::from_millis(250)).await;
+    other
+        .send_simple(Query::new(
+            "SELECT count(*) FROM pg_stat_activity WHERE query = 'SELECT pg_sleep(9.25)' AND state = 'active'",
+        ))
+        .await;
+    expect_message!(other.read().await, RowDescription);
+    let row = expect_message!(other.read().await, DataRow);
+    assert_eq!(row.get::<String>(0, Format::Text), Some("0".into()));
+    other.read_until('Z').await.unwrap();
+}
@@ -1,16 +1,17 @@
 use pgdog_config::General;
 
 use crate::{
-    backend::databases::reload_from_existing,
-    config::{config, load_test, load_test_sharded, set},
+    config::{config, load_test, load_test_sharded},
     frontend::Client,
     net::{Parameters, Stream},
+    test_utils::{ConfigGuard, set_config},
 };
 
 mod advisory_lock;
 mod close_parse;
 mod close_parse_global_cache;
 mod cross_shard_disabled;
+mod cursors;
 mod extended;
 mod extended_anonymous;
 mod extended_transaction;
@@ -18,22 +19,28 @@ mod fatal_error;
 mod graceful_disconnect;
 mod graceful_shutdown;
 mod idle_in_transaction_recovery;
+mod kill;
 mod lock_session;
 mod manual_lock;
 mod multi_binding;
+mod notices;
 mod omni;
 pub mod prelude;
 mod prepared_syntax_error;
+mod read_your_writes;
 mod replicas;
 mod rewrite_extended;
 mod rewrite_insert_split;
 mod rewrite_offset;
 mod rewrite_simple_prepared;
+mod rewrite_subquery;
 mod schema_changed;
 mod set;
 mod set_schema_sharding;
+mod shadow;
 mod sharded;
 mod spliced;
+mod temporary;
 mod test_omnisharded;
 mod transaction_state;
 
@@ -47,9 +54,10 @@ pub(super) fn test_sharded_client() -> Client {
     Client::new_test(Stream::dev_null(), Parameters::default())
 }
 
-pub(super) fn change_config(f: impl FnOnce(&mut General)) {
+/// Change the general settings and reload databases. They are
+/// restored when the guard is dropped, even if the test fails.
+pub(super) fn change_config(f: impl FnOnce(&mut General)) -> ConfigGuard {
     let mut config = (*config()).clone();
     f(&mut config.config.general);
-    set(config).unwrap();
-    reload_from_existing().unwrap();
+    set_config(config).reload()
 }
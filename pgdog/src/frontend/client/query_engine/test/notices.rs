@@ -0,0 +1,105 @@
+use pgdog_config::{NoticeSeverity, QuerySizeLimitAction};
+
+use crate::config::load_test_sharded;
+use crate::net::{FromBytes, Message, NoticeResponse, ToBytes};
+
+use super::change_config;
+use super::prelude::*;
+
+fn notices(messages: &[Message]) -> Vec<NoticeResponse> {
+    messages
+        .iter()
+        .filter(|message| message.code() == 'N')
+        .map(|message| NoticeResponse::from_bytes(message.to_bytes()).unwrap())
+        .collect()
+}
+
+/// A soft limit doesn't get in the way of queries under it. Queries over
+/// it get one NOTICE and still run.
+async fn assert_soft_limit(under: &str, over: &str, message: &str) {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client.send_simple(Query::new(under)).await;
+    let messages = client.read_until('Z').await.unwrap();
+    assert!(notices(&messages).is_empty());
+
+    client.send_simple(Query::new(over)).await;
+    let messages = client.read_until('Z').await.unwrap();
+
+    let notices = notices(&messages);
+    assert_eq!(notices.len(), 1);
+    assert_eq!(notices[0].message.severity, "NOTICE");
+    assert_eq!(notices[0].message.message, message);
+    assert!(messages.iter().any(|message| message.code() == 'C'));
+}
+
+#[tokio::test]
+async fn test_cross_shard_notice_sent_once() {
+    let mut client = TestClient::new_sharded(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new("DROP TABLE IF EXISTS pgdog_notice_missing"))
+        .await;
+    let messages = client.read_until('Z').await.unwrap();
+
+    let notices = notices(&messages);
+    assert_eq!(notices.len(), 1);
+    assert!(notices[0].message.message.contains("pgdog_notice_missing"));
+}
+
+#[tokio::test]
+async fn test_min_notice_severity() {
+    load_test_sharded();
+    let _config = change_config(|general| general.min_notice_severity = NoticeSeverity::Warning);
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new(
+            "DO $$ BEGIN RAISE NOTICE 'pgdog notice'; RAISE INFO 'pgdog info'; RAISE WARNING 'pgdog warning'; END $$",
+        ))
+        .await;
+    let messages = client.read_until('Z').await.unwrap();
+
+    // INFO is always sent.
+    let notices = notices(&messages);
+    assert_eq!(notices.len(), 2);
+    assert_eq!(notices[0].message.message, "pgdog info");
+    assert_eq!(notices[1].message.message, "pgdog warning");
+}
+
+#[tokio::test]
+async fn test_transaction_duration_notice() {
+    load_test_sharded();
+    let _config = change_config(|general| general.transaction_duration_notice = Some(5));
+
+    assert_soft_limit(
+        "SELECT 1",
+        "SELECT pg_sleep(0.01)",
+        "transaction duration exceeds transaction_duration_notice",
+    )
+    .await;
+}
+
+#[tokio::test]
+async fn test_query_size_limit_notice() {
+    load_test_sharded();
+    let _config = change_config(|general| {
+        general.query_size_limit = Some(1024);
+        general.query_size_limit_action = QuerySizeLimitAction::Notice;
+    });
+
+    // 100 distinct columns, clearly over the 1024-byte limit.
+    let big_query = format!(
+        "SELECT {}",
+        (1..=100)
+            .map(|i| format!("{i} AS col_{i:03}"))
+            .collect::<Vec<_>>()
+            .join(", ")
+    );
+    assert_soft_limit(
+        "SELECT 1",
+        &big_query,
+        "query size exceeds query_size_limit",
+    )
+    .await;
+}
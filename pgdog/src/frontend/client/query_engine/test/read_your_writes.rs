@@ -0,0 +1,52 @@
+use crate::config::load_test_replicas;
+
+use super::change_config;
+use super::prelude::*;
+
+async fn route(engine: &mut QueryEngine, client: &mut Client, query: &str) -> bool {
+    client.client_request = ClientRequest::from(vec![Query::new(query).into()]);
+    let mut context = QueryEngineContext::new(client);
+
+    assert!(engine.parse_and_rewrite(&mut context).await.unwrap());
+    assert!(engine.route_query(&mut context).await.unwrap());
+
+    context.client_request.route().is_read()
+}
+
+#[tokio::test]
+async fn test_read_your_writes() {
+    load_test_replicas();
+    let _config = change_config(|general| general.read_your_writes_window = 60_000);
+
+    let mut client = Client::new_test(Stream::dev_null(), Parameters::default());
+    let mut engine = QueryEngine::from_client(&client).unwrap();
+
+    assert!(route(&mut engine, &mut client, "SELECT 1").await);
+    assert!(!route(&mut engine, &mut client, "INSERT INTO test VALUES (1)").await);
+
+    // Reads go to the primary after the write.
+    assert!(!route(&mut engine, &mut client, "SELECT 1").await);
+    assert!(!route(&mut engine, &mut client, "SELECT 2").await);
+
+    // The window doesn't start until the write is finished.
+    let _window = change_config(|general| general.read_your_writes_window = 1);
+    tokio::time::sleep(std::time::Duration::from_millis(5)).await;
+    assert!(!route(&mut engine, &mut client, "SELECT 1").await);
+
+    // Until the window expires.
+    engine.write_finished();
+    assert!(!route(&mut engine, &mut client, "SELECT 1").await);
+    tokio::time::sleep(std::time::Duration::from_millis(5)).await;
+    assert!(route(&mut engine, &mut client, "SELECT 1").await);
+}
+
+#[tokio::test]
+async fn test_read_your_writes_disabled() {
+    load_test_replicas();
+
+    let mut client = Client::new_test(Stream::dev_null(), Parameters::default());
+    let mut engine = QueryEngine::from_client(&client).unwrap();
+
+    assert!(!route(&mut engine, &mut client, "INSERT INTO test VALUES (1)").await);
+    assert!(route(&mut engine, &mut client, "SELECT 1").await);
+}
@@ -83,13 +83,21 @@ async fn test_offset_limit_no_offset_no_plan() {
 }
 
 #[tokio::test]
-async fn test_offset_limit_no_limit_no_plan() {
+async fn test_offset_no_limit() {
     let offset = run_test(vec![ProtocolMessage::Query(Query::new(
         "SELECT * FROM test OFFSET 5",
     ))])
     .await;
 
-    assert!(offset.is_none());
+    let offset = offset.expect("expected OffsetPlan");
+    assert_eq!(
+        offset.limit,
+        Limit {
+            limit: None,
+            offset: Some(5)
+        }
+    );
+    assert_eq!(offset.limit_param, 0);
 }
 
 #[tokio::test]
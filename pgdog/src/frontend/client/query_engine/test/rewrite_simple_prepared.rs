@@ -19,7 +19,7 @@ async fn run_test(client: &mut Client, messages: &[ProtocolMessage]) -> Vec<Prot
 async fn test_rewrite_prepare() {
     load_test();
 
-    change_config(|general| {
+    let _config = change_config(|general| {
         general.prepared_statements = PreparedStatements::Full;
     });
 
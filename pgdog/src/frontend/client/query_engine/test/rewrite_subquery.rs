@@ -0,0 +1,47 @@
+use pgdog_config::RewriteMode;
+
+use crate::backend::databases::reload_from_existing;
+use crate::config::{config, set};
+use crate::frontend::router::parser::rewrite::statement::plan::RewriteResult;
+
+use super::prelude::*;
+use super::test_sharded_client;
+
+#[tokio::test]
+async fn test_subquery_rewrite() {
+    let mut client = test_sharded_client();
+
+    let mut updated = (*config()).clone();
+    updated.config.rewrite.subqueries = RewriteMode::Rewrite;
+    set(updated).unwrap();
+    reload_from_existing().unwrap();
+
+    client.client_request = ClientRequest::from(vec![ProtocolMessage::Query(Query::new(
+        "SELECT * FROM users WHERE id IN (SELECT id FROM sharded WHERE value = 'test')",
+    ))]);
+
+    let mut engine = QueryEngine::from_client(&client).unwrap();
+    let mut context = QueryEngineContext::new(&mut client);
+
+    engine.parse_and_rewrite(&mut context).await.unwrap();
+
+    let Some(RewriteResult::Subquery(subquery)) = context.rewrite_result.take() else {
+        panic!("expected subquery rewrite");
+    };
+
+    assert_eq!(
+        subquery.subquery.stmt,
+        "SELECT id FROM sharded WHERE value = 'test'"
+    );
+    assert_eq!(
+        subquery.outer.stmt,
+        "SELECT * FROM users WHERE id = ANY($1)"
+    );
+
+    // The original query is sent as-is if the subquery
+    // ends up on the same shard.
+    assert_eq!(
+        context.client_request.query().unwrap().unwrap().query(),
+        "SELECT * FROM users WHERE id IN (SELECT id FROM sharded WHERE value = 'test')"
+    );
+}
@@ -116,6 +116,41 @@ async fn test_set_inside_transaction() {
     assert!(!test_client.backend_locked());
 }
 
+#[tokio::test]
+async fn test_set_role() {
+    let mut test_client = TestClient::new_sharded(Parameters::default()).await;
+
+    for (query, command) in [
+        ("BEGIN", "BEGIN"),
+        ("SET ROLE pgdog", "SET"),
+        ("COMMIT", "COMMIT"),
+        ("RESET ALL", "RESET"),
+    ] {
+        test_client.send_simple(Query::new(query)).await;
+        assert_eq!(
+            expect_message!(test_client.read().await, CommandComplete).command(),
+            command
+        );
+        expect_message!(test_client.read().await, ReadyForQuery);
+    }
+
+    // RESET ALL doesn't reset the role.
+    assert_eq!(
+        test_client.client().params.get("role").unwrap(),
+        &ParameterValue::String("pgdog".into()),
+    );
+
+    test_client.send_simple(Query::new("RESET ROLE")).await;
+    assert_eq!(
+        expect_message!(test_client.read().await, CommandComplete).command(),
+        "RESET"
+    );
+    expect_message!(test_client.read().await, ReadyForQuery);
+
+    assert!(test_client.client().params.get("role").is_none());
+    assert!(!test_client.backend_locked());
+}
+
 #[tokio::test]
 async fn test_set_inside_transaction_rollback() {
     let mut test_client = TestClient::new_sharded(Parameters::default()).await;
@@ -161,6 +196,68 @@ async fn test_set_inside_transaction_rollback() {
     );
 }
 
+#[tokio::test]
+async fn test_set_local_outside_transaction_not_tracked() {
+    let mut test_client = TestClient::new_sharded(Parameters::default()).await;
+
+    test_client
+        .send_simple(Query::new("SET LOCAL app.tenant_id TO '42'"))
+        .await;
+
+    assert_eq!(
+        expect_message!(test_client.read().await, CommandComplete).command(),
+        "SET"
+    );
+    assert_eq!(
+        expect_message!(test_client.read().await, ReadyForQuery).status,
+        'I'
+    );
+
+    assert!(
+        test_client.client().params.get("app.tenant_id").is_none(),
+        "SET LOCAL outside a transaction must not be replayed on other connections",
+    );
+
+    test_client
+        .send_simple(Query::new("SET app.tenant_id TO '42'"))
+        .await;
+
+    assert_eq!(
+        expect_message!(test_client.read().await, CommandComplete).command(),
+        "SET"
+    );
+    assert_eq!(
+        expect_message!(test_client.read().await, ReadyForQuery).status,
+        'I'
+    );
+
+    assert_eq!(
+        test_client.client().params.get("app.tenant_id").unwrap(),
+        &ParameterValue::String("42".into()),
+    );
+}
+
+#[tokio::test]
+async fn test_set_config_local_null_keeps_session_value() {
+    let mut test_client = TestClient::new_sharded(Parameters::default()).await;
+
+    test_client
+        .send_simple(Query::new("SET app.tenant_id TO '42'"))
+        .await;
+    test_client.read_until('Z').await.unwrap();
+
+    test_client
+        .send_simple(Query::new("SELECT set_config('app.tenant_id', NULL, true)"))
+        .await;
+    test_client.read_until('Z').await.unwrap();
+
+    assert_eq!(
+        test_client.client().params.get("app.tenant_id").unwrap(),
+        &ParameterValue::String("42".into()),
+        "a local reset must not reset the session value",
+    );
+}
+
 #[tokio::test]
 async fn test_reset() {
     let mut test_client = TestClient::new_sharded(Parameters::default()).await;
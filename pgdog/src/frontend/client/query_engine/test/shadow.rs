@@ -0,0 +1,31 @@
+use pgdog_config::QueryParserLevel;
+
+use crate::{
+    expect_message,
+    frontend::router::parser::Cache,
+    net::{ErrorResponse, Parameters, ReadyForQuery},
+};
+
+use super::{change_config, prelude::*};
+
+/// Shadow parser errors don't reach the client,
+/// the query is sent to Postgres unchanged.
+#[tokio::test]
+async fn test_shadow_parser_error() {
+    let mut client = TestClient::new_replicas(Parameters::default()).await;
+    let _config = change_config(|general| {
+        general.query_parser = QueryParserLevel::Shadow;
+    });
+
+    let mismatches = Cache::stats().0.shadow_mismatch;
+    client.send_simple(Query::new("SELEKT 1")).await;
+
+    let err = expect_message!(client.read().await, ErrorResponse);
+    assert_eq!(err.code, "42601");
+    // Only Postgres sets the source file.
+    assert!(err.file.is_some());
+    expect_message!(client.read().await, ReadyForQuery);
+
+    // Counted as a mismatch. Other tests share the cache.
+    assert!(Cache::stats().0.shadow_mismatch > mismatches);
+}
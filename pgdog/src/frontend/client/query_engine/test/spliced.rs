@@ -471,3 +471,50 @@ async fn test_spliced_pipeline_error_skips_to_sync() {
     // Connection should be released back to pool
     assert!(!client.backend_connected());
 }
+
+/// Same as above, but the client sends the pipeline in parts separated by Flush.
+/// Postgres ignores the parts sent after the error, so pgdog must not wait
+/// for their responses.
+#[tokio::test]
+async fn test_pipeline_error_with_flush_skips_to_sync() {
+    let mut client = TestClient::new_sharded(Parameters::default()).await;
+
+    client
+        .send(Parse::named("", "SELECT * FROM nonexistent_table_12345"))
+        .await;
+    client.send(Bind::new_statement("")).await;
+    client.send(Execute::new()).await;
+    client.send(Flush).await;
+    client.try_process().await.unwrap();
+
+    let error = expect_message!(client.read().await, ErrorResponse);
+    assert_eq!(error.code, "42P01");
+    assert!(client.backend_connected());
+
+    client.send(Parse::named("", "SELECT 2")).await;
+    client.send(Bind::new_statement("")).await;
+    client.send(Execute::new()).await;
+    client.send(Flush).await;
+    client.try_process().await.unwrap();
+
+    client.send(Sync).await;
+    client.try_process().await.unwrap();
+
+    let rfq = expect_message!(client.read().await, ReadyForQuery);
+    assert_eq!(rfq.status, 'I');
+    assert!(!client.backend_connected());
+
+    // The connection is usable after the pipeline.
+    client.send(Parse::named("", "SELECT 3")).await;
+    client.send(Bind::new_statement("")).await;
+    client.send(Execute::new()).await;
+    client.send(Sync).await;
+    client.try_process().await.unwrap();
+
+    expect_message!(client.read().await, ParseComplete);
+    expect_message!(client.read().await, BindComplete);
+    let row = expect_message!(client.read().await, DataRow);
+    assert_eq!(row.get_int(0, true), Some(3));
+    expect_message!(client.read().await, CommandComplete);
+    expect_message!(client.read().await, ReadyForQuery);
+}
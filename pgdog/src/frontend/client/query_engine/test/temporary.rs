@@ -0,0 +1,126 @@
+use super::prelude::*;
+
+#[tokio::test]
+async fn test_temp_table_pins_session() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new("CREATE TEMP TABLE pgdog_temp_table (id BIGINT)"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.temporary());
+    assert!(client.engine.stats().pinned);
+    assert!(client.backend_connected());
+    assert!(
+        client.backend_locked(),
+        "backend must stay pinned while the temporary table exists"
+    );
+
+    // The table is on this server connection.
+    client
+        .send_simple(Query::new("INSERT INTO pgdog_temp_table VALUES (1), (2)"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new("SELECT * FROM pgdog_temp_table"))
+        .await;
+    let messages = client.read_until('Z').await.unwrap();
+    assert_eq!(messages.iter().filter(|m| m.code() == 'D').count(), 2);
+
+    // Dropping the table doesn't unpin the session.
+    client
+        .send_simple(Query::new("DROP TABLE pgdog_temp_table"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.backend_locked());
+}
+
+#[tokio::test]
+async fn test_temp_sequence_pins_session() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client.send_simple(Query::new("BEGIN")).await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new("CREATE TEMPORARY SEQUENCE pgdog_temp_seq"))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    client.send_simple(Query::new("COMMIT")).await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(client.engine.temporary());
+    assert!(client.backend_locked());
+    assert!(client.backend_connected());
+}
+
+#[tokio::test]
+async fn test_table_not_pinned() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client
+        .send_simple(Query::new(
+            "CREATE TABLE IF NOT EXISTS pgdog_not_temp_table (id BIGINT)",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.temporary());
+    assert!(!client.engine.stats().pinned);
+    assert!(!client.backend_locked());
+    assert!(!client.backend_connected());
+
+    client
+        .send_simple(Query::new("DROP TABLE IF EXISTS pgdog_not_temp_table"))
+        .await;
+    client.read_until('Z').await.unwrap();
+}
+
+#[tokio::test]
+async fn test_discard_unpins_temporary() {
+    for discard in ["DISCARD TEMP", "DISCARD ALL"] {
+        let mut client = TestClient::new(Parameters::default()).await;
+
+        client
+            .send_simple(Query::new(
+                "CREATE TEMP TABLE pgdog_temp_discard (id BIGINT)",
+            ))
+            .await;
+        client.read_until('Z').await.unwrap();
+        assert!(client.backend_locked());
+
+        // Goes to the server, which drops the table.
+        client.send_simple(Query::new(discard)).await;
+        client.read_until('Z').await.unwrap();
+
+        assert!(!client.engine.temporary(), "{}", discard);
+        assert!(!client.engine.stats().pinned, "{}", discard);
+        assert!(!client.backend_locked(), "{}", discard);
+    }
+}
+
+#[tokio::test]
+async fn test_on_commit_drop_not_pinned() {
+    let mut client = TestClient::new(Parameters::default()).await;
+
+    client.send_simple(Query::new("BEGIN")).await;
+    client.read_until('Z').await.unwrap();
+
+    client
+        .send_simple(Query::new(
+            "CREATE TEMP TABLE pgdog_temp_commit_drop (id BIGINT) ON COMMIT DROP",
+        ))
+        .await;
+    client.read_until('Z').await.unwrap();
+
+    client.send_simple(Query::new("COMMIT")).await;
+    client.read_until('Z').await.unwrap();
+
+    assert!(!client.engine.temporary());
+    assert!(!client.backend_locked());
+    assert!(!client.backend_connected());
+}
@@ -12,4 +12,12 @@ impl QueryEngine {
     pub(crate) fn advisory_locks(&mut self) -> &mut AdvisoryLocks {
         &mut self.advisory_locks
     }
+
+    pub(crate) fn cursors(&mut self) -> &mut Cursors {
+        &mut self.cursors
+    }
+
+    pub(crate) fn temporary(&self) -> bool {
+        self.temporary
+    }
 }
@@ -0,0 +1,35 @@
+//! Soft limit on transaction duration.
+//!
+//! Transactions that take longer than `transaction_duration_notice`
+//! are counted and the client gets a `NOTICE`. Nothing is interrupted.
+
+use std::time::Duration;
+
+use super::*;
+use crate::stats::transaction_duration;
+
+impl QueryEngine {
+    /// Report the transaction that just finished if it took too long.
+    pub(super) async fn transaction_duration(
+        &mut self,
+        context: &mut QueryEngineContext<'_>,
+    ) -> Result<(), Error> {
+        let Some(limit) = config().config.general.transaction_duration_notice else {
+            return Ok(());
+        };
+        let limit = Duration::from_millis(limit);
+        let duration = self.stats.last_transaction_time;
+
+        if duration <= limit {
+            return Ok(());
+        }
+
+        transaction_duration::exceeded();
+
+        self.notice_response(
+            context,
+            ErrorResponse::transaction_duration_exceeded(duration, limit),
+        )
+        .await
+    }
+}
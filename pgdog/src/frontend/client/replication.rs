@@ -0,0 +1,204 @@
+//! Replication connections, e.g. from Debezium, `pg_recvlogical`
+//! or `pg_receivewal`.
+//!
+//! Clients connecting with the `replication` startup parameter speak the
+//! replication protocol, which we don't parse. Each one gets its own server
+//! connection, opened with the same `replication` parameter, and everything
+//! is forwarded as-is in both directions, including `CopyBoth` streaming.
+//!
+use pgdog_config::Role;
+use tokio::io::copy_bidirectional;
+use tokio::select;
+use tracing::info;
+
+use super::sticky::Sticky;
+use super::{Client, Error};
+use crate::backend::pool::Address;
+use crate::backend::{Cluster, ConnectReason, Server, ServerOptions, databases::databases};
+use crate::frontend::router::parameter_hints::PGDOG_SHARD;
+use crate::net::messages::ErrorResponse;
+use crate::net::{Parameter, Parameters, parameter::ParameterValue};
+use crate::util::user_database_from_params;
+
+/// Startup parameter naming the server to replicate from,
+/// e.g. `10.0.0.2` or `10.0.0.2:5432`.
+pub const PGDOG_HOST: &str = "pgdog.host";
+
+/// Replication mode requested by the client: `database` for logical
+/// replication, `true` for physical replication.
+pub(super) fn replication(params: &Parameters) -> Option<String> {
+    match params.get("replication")?.as_str()? {
+        "false" | "off" | "no" | "0" => None,
+        mode => Some(mode.to_owned()),
+    }
+}
+
+/// Server the client replicates from.
+///
+/// Only users with `replication = true` can replicate: the connection
+/// uses the pool's credentials, not the client's. The shard is picked with `pgdog.shard`, which can be omitted
+/// if the database isn't sharded. In that shard, it's the server named with
+/// `pgdog.host` or, if not set, the primary, unless the client asked for a
+/// replica with `pgdog.role` or `target_session_attrs`.
+pub(super) fn address(cluster: &Cluster, params: &Parameters) -> Result<Address, Error> {
+    if !cluster.replication() {
+        return Err(Error::ReplicationNotAllowed(
+            cluster.identifier().user.clone(),
+        ));
+    }
+
+    let shard = match params.get(PGDOG_SHARD) {
+        Some(ParameterValue::Integer(shard)) => *shard as usize,
+        Some(shard) => shard
+            .as_str()
+            .and_then(|shard| shard.parse().ok())
+            .ok_or(Error::NoReplicationServer)?,
+        None if cluster.shards().len() == 1 => 0,
+        None => return Err(Error::Parameter(PGDOG_SHARD.into())),
+    };
+
+    let shard = cluster
+        .shards()
+        .get(shard)
+        .ok_or(Error::NoReplicationServer)?;
+    let host = params.get(PGDOG_HOST).and_then(|host| host.as_str());
+    let role = Sticky::from_params(params).role.unwrap_or(Role::Primary);
+
+    let pools = shard.pools_with_roles();
+
+    match host {
+        Some(host) => pools
+            .into_iter()
+            .map(|(_, pool)| pool.addr().clone())
+            .find(|addr| addr.host == host || format!("{}:{}", addr.host, addr.port) == host)
+            .ok_or_else(|| Error::ReplicationHost(host.to_owned())),
+        None => pools
+            .into_iter()
+            .find(|(pool_role, _)| *pool_role == role)
+            .map(|(_, pool)| pool.addr().clone())
+            .ok_or(Error::NoReplicationServer),
+    }
+}
+
+impl Client {
+    /// Forward the replication connection to the server,
+    /// until either side disconnects.
+    pub(super) async fn replicate(&mut self, mode: String) -> Result<(), Error> {
+        let (user, database) = user_database_from_params(&self.params);
+        let cluster = databases().cluster((user, database))?;
+        let addr = address(&cluster, &self.params)?;
+
+        let mut params = vec![Parameter {
+            name: "replication".into(),
+            value: mode.into(),
+        }];
+        if let Some(application_name) = self.params.get("application_name") {
+            params.push(Parameter {
+                name: "application_name".into(),
+                value: application_name.clone(),
+            });
+        }
+
+        let server = Server::connect(
+            &addr,
+            ServerOptions { params, pool_id: 0 },
+            ConnectReason::Replication,
+        )
+        .await?;
+        let mut stream = server
+            .into_stream()
+            .ok_or(crate::backend::Error::NotConnected)?;
+
+        info!(
+            r#"client "{}" is replicating from "{}" [{}]"#,
+            user, addr, self.addr
+        );
+
+        let shutdown = self.comms.shutting_down();
+        let shutting_down = select! {
+            result = copy_bidirectional(&mut self.stream, &mut stream) => {
+                result?;
+                false
+            }
+            _ = shutdown.notified() => true,
+        };
+
+        if shutting_down {
+            self.stream
+                .send_flush(&ErrorResponse::shutting_down())
+                .await?;
+        }
+
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+    use crate::config::ConfigAndUsers;
+
+    #[test]
+    fn test_replication_mode() {
+        let mut params = Parameters::default();
+        assert_eq!(replication(&params), None);
+
+        params.insert("replication", "database");
+        assert_eq!(replication(&params).as_deref(), Some("database"));
+
+        params.insert("replication", "true");
+        assert_eq!(replication(&params).as_deref(), Some("true"));
+
+        params.insert("replication", "off");
+        assert_eq!(replication(&params), None);
+    }
+
+    #[tokio::test]
+    async fn test_address() {
+        let config = ConfigAndUsers::default();
+        let cluster = Cluster::new_test_replication(&config);
+
+        // Sharded databases need the shard.
+        let mut params = Parameters::default();
+        assert!(matches!(
+            address(&cluster, &params),
+            Err(Error::Parameter(name)) if name == PGDOG_SHARD
+        ));
+
+        params.insert(PGDOG_SHARD, "1");
+        let addr = address(&cluster, &params).unwrap();
+        assert_eq!(addr.configured_role, Role::Primary);
+
+        params.insert("pgdog.role", "replica");
+        let addr = address(&cluster, &params).unwrap();
+        assert_eq!(addr.configured_role, Role::Replica);
+
+        params.insert(PGDOG_HOST, "127.0.0.1:5432");
+        assert_eq!(address(&cluster, &params).unwrap().port, 5432);
+
+        // Only servers of this database.
+        params.insert(PGDOG_HOST, "10.0.0.1");
+        assert!(matches!(
+            address(&cluster, &params),
+            Err(Error::ReplicationHost(host)) if host == "10.0.0.1"
+        ));
+
+        let mut params = Parameters::default();
+        params.insert(PGDOG_SHARD, "5");
+        assert!(matches!(
+            address(&cluster, &params),
+            Err(Error::NoReplicationServer)
+        ));
+    }
+
+    #[tokio::test]
+    async fn test_replication_not_allowed() {
+        let config = ConfigAndUsers::default();
+        let cluster = Cluster::new_test_single_shard(&config);
+
+        assert!(matches!(
+            address(&cluster, &Parameters::default()),
+            Err(Error::ReplicationNotAllowed(user)) if user == "pgdog"
+        ));
+    }
+}
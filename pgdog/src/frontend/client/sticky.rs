@@ -2,9 +2,10 @@
 //! default routing behavior determined by the query parser.
 
 use pgdog_config::Role;
-use rand::{Rng, rng};
+use rand::Rng;
 
 use crate::net::{Parameters, parameter::ParameterValue};
+use crate::random;
 
 #[derive(Debug, Clone, Copy)]
 pub struct Sticky {
@@ -12,9 +13,13 @@ pub struct Sticky {
     /// stick to only one database.
     pub omni_index: usize,
 
-    /// Desired database role. This comes from `target_session_attrs`
-    /// provided by the client.
+    /// Desired database role. This comes from `pgdog.role`
+    /// or `target_session_attrs` provided by the client.
     pub role: Option<Role>,
+
+    /// Replicas are preferred but not required: send reads
+    /// to the primary if none of them are available.
+    pub read_fallback: bool,
 }
 
 impl Default for Sticky {
@@ -34,10 +39,19 @@ impl Sticky {
         Self {
             omni_index: 1,
             role: None,
+            read_fallback: false,
         }
     }
 
     /// Create Sticky from params.
+    ///
+    /// `pgdog.role` is specific to us, so it takes precedence
+    /// over `target_session_attrs`.
+    ///
+    /// libpq doesn't send `target_session_attrs` to the server: it uses it
+    /// to pick a host from the connection string. Clients have to pass it
+    /// as a startup parameter themselves, e.g. with
+    /// `options=-ctarget_session_attrs=read-only`.
     pub fn from_params(params: &Parameters) -> Self {
         let role = params.get("pgdog.role").and_then(|value| match value {
             ParameterValue::String(value) => match value.as_str() {
@@ -48,13 +62,35 @@ impl Sticky {
             _ => None,
         });
 
+        let (role, read_fallback) = match role {
+            Some(role) => (Some(role), false),
+            None => params
+                .get("target_session_attrs")
+                .and_then(|value| value.as_str())
+                .map(target_session_attrs)
+                .unwrap_or_default(),
+        };
+
         Self {
-            omni_index: rng().random_range(1..usize::MAX),
+            omni_index: random::with_rng(|rng| rng.random_range(1..usize::MAX)),
             role,
+            read_fallback,
         }
     }
 }
 
+/// Role requested with libpq's `target_session_attrs` and whether
+/// reads can fall back to the primary. Like in libpq, `prefer-standby`
+/// uses the primary if there are no replicas to connect to.
+fn target_session_attrs(value: &str) -> (Option<Role>, bool) {
+    match value {
+        "read-write" | "primary" => (Some(Role::Primary), false),
+        "read-only" | "standby" => (Some(Role::Replica), false),
+        "prefer-standby" => (Some(Role::Replica), true),
+        _ => (None, false),
+    }
+}
+
 #[cfg(test)]
 mod test {
     use super::*;
@@ -75,4 +111,30 @@ mod test {
             assert_eq!(sticky.role, role);
         }
     }
+
+    #[test]
+    fn test_sticky_target_session_attrs() {
+        for (attrs, role, read_fallback) in [
+            ("read-write", Some(Role::Primary), false),
+            ("primary", Some(Role::Primary), false),
+            ("read-only", Some(Role::Replica), false),
+            ("standby", Some(Role::Replica), false),
+            ("prefer-standby", Some(Role::Replica), true),
+            ("any", None, false),
+        ] {
+            let mut params = Parameters::default();
+            params.insert("target_session_attrs", attrs);
+            let sticky = Sticky::from_params(&params);
+            assert_eq!(sticky.role, role, "{}", attrs);
+            assert_eq!(sticky.read_fallback, read_fallback, "{}", attrs);
+        }
+
+        // pgdog.role wins.
+        let mut params = Parameters::default();
+        params.insert("target_session_attrs", "prefer-standby");
+        params.insert("pgdog.role", "replica");
+        let sticky = Sticky::from_params(&params);
+        assert_eq!(sticky.role, Some(Role::Replica));
+        assert!(!sticky.read_fallback);
+    }
 }
@@ -1,6 +1,6 @@
 use std::time::{Duration, Instant};
 
-use pgdog_config::{PoolerMode, QuerySizeLimitAction};
+use pgdog_config::{ClientKeepaliveMessage, PoolerMode, QuerySizeLimitAction};
 use tokio::{
     io::{AsyncRead, AsyncReadExt, AsyncWriteExt},
     net::{TcpListener, TcpStream},
@@ -22,8 +22,8 @@ use crate::{
     },
     net::{
         Bind, Close, CommandComplete, DataRow, Describe, ErrorResponse, Execute, Field, Flush,
-        Format, FromBytes, Message, Parameters, Parse, ProtocolVersion, Query, ReadyForQuery,
-        RowDescription, Sync, Terminate, ToBytes,
+        Format, FromBytes, Message, ParameterStatus, Parameters, Parse, ProtocolVersion, Query,
+        ReadyForQuery, RowDescription, Sync, Terminate, ToBytes,
     },
     state::State,
 };
@@ -268,7 +268,7 @@ async fn test_abrupt_disconnect() {
 
     drop(conn);
 
-    let event = client.buffer(State::Idle).await.unwrap();
+    let event = client.buffer(State::Idle, false).await.unwrap();
     assert_eq!(event, BufferEvent::DisconnectAbrupt);
     assert!(client.client_request.messages.is_empty());
 
@@ -287,7 +287,7 @@ async fn test_client_idle_timeout() {
     set(config).unwrap();
 
     let start = Instant::now();
-    let res = client.buffer(State::Idle).await.unwrap();
+    let res = client.buffer(State::Idle, false).await.unwrap();
     assert_eq!(res, BufferEvent::DisconnectAbrupt);
 
     let err = read_one!(conn);
@@ -298,13 +298,128 @@ async fn test_client_idle_timeout() {
     assert!(
         timeout(
             Duration::from_millis(50),
-            client.buffer(State::IdleInTransaction)
+            client.buffer(State::IdleInTransaction, false)
         )
         .await
         .is_err()
     );
 }
 
+#[tokio::test]
+async fn test_idle_in_transaction_timeout_commit() {
+    let (mut conn, mut client, _) = new_client!(false);
+
+    let mut config = (*config()).clone();
+    config.config.general.idle_in_transaction_timeout = 25;
+    set(config).unwrap();
+
+    let handle = tokio::spawn(async move { client.run().await.unwrap() });
+
+    conn.write_all(&Query::new("BEGIN").to_bytes())
+        .await
+        .unwrap();
+    read_messages(&mut conn, &['C', 'Z']).await;
+    conn.write_all(&Query::new("SELECT 1").to_bytes())
+        .await
+        .unwrap();
+    read_messages(&mut conn, &['T', 'D', 'C', 'Z']).await;
+
+    tokio::time::sleep(Duration::from_millis(100)).await;
+
+    conn.write_all(&Query::new("SELECT 1").to_bytes())
+        .await
+        .unwrap();
+    let msgs = read!(conn, ['E', 'Z']);
+    let err = ErrorResponse::from_bytes(msgs[0].clone().freeze()).unwrap();
+    assert_eq!(err.code, "25P03");
+
+    // Like Postgres, COMMIT of a rolled back transaction reports ROLLBACK.
+    conn.write_all(&Query::new("COMMIT").to_bytes())
+        .await
+        .unwrap();
+    let msgs = read!(conn, ['C', 'Z']);
+    let cc = CommandComplete::from_bytes(msgs[0].clone().freeze()).unwrap();
+    assert_eq!(cc.tag(), "ROLLBACK");
+    let rfq = ReadyForQuery::from_bytes(msgs[1].clone().freeze()).unwrap();
+    assert_eq!(rfq.status, 'I');
+
+    conn.write_all(&Query::new("SELECT 1").to_bytes())
+        .await
+        .unwrap();
+    read_messages(&mut conn, &['T', 'D', 'C', 'Z']).await;
+
+    conn.write_all(&Terminate.to_bytes()).await.unwrap();
+    handle.await.unwrap();
+}
+
+#[tokio::test]
+async fn test_large_row_streamed() {
+    let (mut conn, mut client, _) = new_client!(false);
+
+    let mut config = (*config()).clone();
+    config.config.memory.message_stream_threshold = 1024;
+    set(config).unwrap();
+
+    let handle = tokio::spawn(async move { client.run().await.unwrap() });
+
+    // Forwarded to the client in parts, but arrives as one DataRow.
+    for len in [100_000, 10] {
+        conn.write_all(&Query::new(format!("SELECT repeat('a', {})", len)).to_bytes())
+            .await
+            .unwrap();
+        let msgs = read!(conn, ['T', 'D', 'C', 'Z']);
+        let dr = DataRow::from_bytes(msgs[1].clone().freeze()).unwrap();
+        assert_eq!(dr.get_text(0).unwrap(), "a".repeat(len));
+    }
+
+    conn.write_all(&Terminate.to_bytes()).await.unwrap();
+    handle.await.unwrap();
+}
+
+#[tokio::test]
+async fn test_client_keepalive() {
+    let (mut conn, mut client, _inner) = new_client!(false);
+
+    let mut config = (*config()).clone();
+    config.config.general.client_idle_timeout = 55;
+    config.config.general.client_keepalive_interval = Some(10);
+    set(config).unwrap();
+
+    let res = client.buffer(State::Idle, false).await.unwrap();
+    assert_eq!(res, BufferEvent::DisconnectAbrupt);
+
+    // Keepalives are sent while the client is idle,
+    // but don't stop the idle timeout from firing.
+    let mut keepalives = 0;
+    loop {
+        let message = read_one!(conn);
+        match message[0] as char {
+            'S' => {
+                let status = ParameterStatus::from_bytes(message.freeze()).unwrap();
+                assert_eq!(status.name, "application_name");
+                keepalives += 1;
+            }
+            'E' => {
+                let err = ErrorResponse::from_bytes(message.freeze()).unwrap();
+                assert_eq!(err.code, "57P05");
+                break;
+            }
+            code => panic!("unexpected message {}", code),
+        }
+    }
+    assert!(keepalives >= 3);
+
+    let mut config = (*crate::config::config()).clone();
+    config.config.general.client_keepalive_message = ClientKeepaliveMessage::Notice;
+    set(config).unwrap();
+
+    let res = client.buffer(State::Idle, false).await.unwrap();
+    assert_eq!(res, BufferEvent::DisconnectAbrupt);
+
+    let notice = read_one!(conn);
+    assert_eq!(&notice[..], &[b'N', 0, 0, 0, 5, 0]);
+}
+
 #[tokio::test]
 async fn test_parse_describe_flush_bind_execute_close_sync() {
     let (mut conn, mut client, _) = new_client!(false);
@@ -365,7 +480,7 @@ async fn test_client_login_timeout() {
         Client::spawn(
             stream,
             params,
-            addr,
+            addr.into(),
             crate::config::config(),
             ProtocolVersion::V3_0,
         )
@@ -516,7 +631,7 @@ async fn test_query_timeout() {
     let buf = buffer!({ Query::new("SELECT pg_sleep(0.2)") });
     conn.write_all(&buf).await.unwrap();
 
-    client.buffer(State::Idle).await.unwrap();
+    client.buffer(State::Idle, false).await.unwrap();
     let result = client.client_messages(&mut engine).await;
 
     assert!(result.is_err());
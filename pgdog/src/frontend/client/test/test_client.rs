@@ -17,7 +17,7 @@ use crate::{
         router::{parser::Shard, sharding::ContextBuilder},
     },
     net::{
-        DataRow, ErrorResponse, Message, Parameters, Protocol, ProtocolVersion, Query,
+        DataRow, ErrorResponse, FrontendPid, Message, Parameters, Protocol, ProtocolVersion, Query,
         RowDescription, Stream,
     },
 };
@@ -226,7 +226,10 @@ impl TestClient {
 
     /// Process a request.
     pub(crate) async fn try_process(&mut self) -> Result<(), Box<dyn std::error::Error>> {
-        self.client.buffer(self.engine.stats().state).await?;
+        let pinned = self.engine.pinned_in_transaction();
+        self.client
+            .buffer(self.engine.stats().state, pinned)
+            .await?;
         self.client.client_messages(&mut self.engine).await?;
 
         Ok(())
@@ -326,7 +329,7 @@ impl SpawnedClient {
         let handle = tokio::spawn(async move {
             let (stream, addr) = listener.accept().await.unwrap();
             let stream = Stream::plain(stream, 4096);
-            Client::spawn(stream, params, addr, config(), ProtocolVersion::V3_0)
+            Client::spawn(stream, params, addr.into(), config(), ProtocolVersion::V3_0)
                 .await
                 .unwrap();
         });
@@ -346,6 +349,30 @@ impl SpawnedClient {
         Self::new(params).await
     }
 
+    /// Spawn a client registered with comms, so admin commands,
+    /// e.g. `KILL CLIENT`, can find it by its id.
+    ///
+    /// Config needs to be loaded.
+    pub async fn new_connected(params: Parameters) -> (Self, FrontendPid) {
+        let (conn, client) = new_client_pair(params).await;
+        let id = FrontendPid::from(&client.key);
+        client
+            .comms
+            .connect(client.key.clone(), client.addr, &client.params);
+
+        let handle = tokio::spawn(async move {
+            client.spawn_test().await;
+        });
+
+        (
+            Self {
+                conn,
+                handle: Some(handle),
+            },
+            id,
+        )
+    }
+
     pub async fn send(&mut self, message: impl Protocol) {
         send_message(&mut self.conn, message).await;
     }
@@ -1,12 +1,18 @@
 use std::time::Duration;
 
-use crate::{config::General, frontend::ClientRequest, state::State};
+use crate::{
+    config::{Database, General},
+    frontend::ClientRequest,
+    state::State,
+};
 
 #[derive(Debug, Clone, Copy)]
 pub struct Timeouts {
     pub(super) query_timeout: Duration,
     pub(super) client_idle_timeout: Duration,
     pub(super) idle_in_transaction_timeout: Duration,
+    pub(super) idle_in_transaction_rollback: Duration,
+    pub(super) client_keepalive: Duration,
 }
 
 impl Default for Timeouts {
@@ -15,6 +21,8 @@ impl Default for Timeouts {
             query_timeout: Duration::MAX,
             client_idle_timeout: Duration::MAX,
             idle_in_transaction_timeout: Duration::MAX,
+            idle_in_transaction_rollback: Duration::MAX,
+            client_keepalive: Duration::MAX,
         }
     }
 }
@@ -25,9 +33,24 @@ impl Timeouts {
             query_timeout: general.query_timeout(),
             client_idle_timeout: general.client_idle_timeout(),
             idle_in_transaction_timeout: general.client_idle_in_transaction_timeout(),
+            idle_in_transaction_rollback: general.idle_in_transaction_timeout(),
+            client_keepalive: general.client_keepalive_interval(),
         }
     }
 
+    /// Apply overrides configured for the database the client is connected to.
+    pub(crate) fn database(mut self, databases: &[Database], name: &str) -> Self {
+        if let Some(timeout) = databases
+            .iter()
+            .filter(|database| database.name == name)
+            .find_map(|database| database.client_idle_timeout)
+        {
+            self.client_idle_timeout = Duration::from_millis(timeout);
+        }
+
+        self
+    }
+
     /// Get active query timeout.
     #[inline]
     pub(crate) fn query_timeout(&self, state: &State) -> Duration {
@@ -63,6 +86,41 @@ impl Timeouts {
             _ => Duration::MAX,
         }
     }
+
+    /// Roll back the transaction if the client is idle in it
+    /// while holding on to a server connection.
+    #[inline]
+    pub(crate) fn idle_in_transaction_rollback(
+        &self,
+        state: &State,
+        pinned: bool,
+        client_request: &ClientRequest,
+    ) -> Duration {
+        match state {
+            State::IdleInTransaction if pinned && client_request.messages.is_empty() => {
+                self.idle_in_transaction_rollback
+            }
+            _ => Duration::MAX,
+        }
+    }
+
+    /// Send a keepalive to the client if it's idle,
+    /// i.e. hasn't started sending its next request.
+    #[inline]
+    pub(crate) fn client_keepalive(
+        &self,
+        state: &State,
+        client_request: &ClientRequest,
+    ) -> Duration {
+        match state {
+            State::Idle | State::IdleInTransaction | State::TransactionError
+                if client_request.messages.is_empty() =>
+            {
+                self.client_keepalive
+            }
+            _ => Duration::MAX,
+        }
+    }
 }
 
 #[cfg(test)]
@@ -87,4 +145,104 @@ mod test {
         );
         assert_eq!(actual, Duration::MAX);
     }
+
+    #[test]
+    fn test_idle_in_transaction_rollback() {
+        let timeout = Timeouts {
+            idle_in_transaction_rollback: Duration::from_secs(5),
+            ..Default::default()
+        };
+        let empty = ClientRequest::default();
+
+        assert_eq!(
+            timeout.idle_in_transaction_rollback(&State::IdleInTransaction, true, &empty),
+            Duration::from_secs(5)
+        );
+        // No server connection to give back.
+        assert_eq!(
+            timeout.idle_in_transaction_rollback(&State::IdleInTransaction, false, &empty),
+            Duration::MAX
+        );
+        assert_eq!(
+            timeout.idle_in_transaction_rollback(&State::Idle, true, &empty),
+            Duration::MAX
+        );
+        assert_eq!(
+            timeout.idle_in_transaction_rollback(
+                &State::IdleInTransaction,
+                true,
+                &ClientRequest::from(vec![Query::new("SELECT 1").into()])
+            ),
+            Duration::MAX
+        );
+    }
+
+    #[test]
+    fn test_client_keepalive() {
+        let general = General {
+            client_keepalive_interval: Some(30_000),
+            ..Default::default()
+        };
+        let timeout = Timeouts::from_config(&general);
+        let empty = ClientRequest::default();
+
+        assert_eq!(
+            timeout.client_keepalive(&State::Idle, &empty),
+            Duration::from_secs(30)
+        );
+        assert_eq!(
+            timeout.client_keepalive(&State::IdleInTransaction, &empty),
+            Duration::from_secs(30)
+        );
+        assert_eq!(
+            timeout.client_keepalive(&State::Active, &empty),
+            Duration::MAX
+        );
+        // Client is sending a request.
+        assert_eq!(
+            timeout.client_keepalive(
+                &State::Idle,
+                &ClientRequest::from(vec![Query::new("SELECT 1").into()])
+            ),
+            Duration::MAX
+        );
+
+        let timeout = Timeouts::from_config(&General::default());
+        assert_eq!(
+            timeout.client_keepalive(&State::Idle, &empty),
+            Duration::MAX
+        );
+    }
+
+    #[test]
+    fn test_database_client_idle_timeout() {
+        let general = General {
+            client_idle_timeout: 60_000,
+            ..Default::default()
+        };
+        let databases = vec![
+            Database {
+                name: "prod".into(),
+                ..Default::default()
+            },
+            Database {
+                name: "serverless".into(),
+                client_idle_timeout: Some(5_000),
+                ..Default::default()
+            },
+        ];
+        let empty = ClientRequest::default();
+
+        let timeout = Timeouts::from_config(&general).database(&databases, "serverless");
+        assert_eq!(
+            timeout.client_idle_timeout(&State::Idle, &empty),
+            Duration::from_secs(5)
+        );
+
+        let timeout = Timeouts::from_config(&general).database(&databases, "prod");
+        assert_eq!(
+            timeout.client_idle_timeout(&State::Idle, &empty),
+            Duration::from_secs(60)
+        );
+    }
 }
@@ -0,0 +1,85 @@
+//! Address of a connected client.
+
+use std::fmt::Display;
+use std::net::{IpAddr, SocketAddr};
+
+/// Where the client is connecting from.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ClientAddr {
+    /// TCP connection.
+    Tcp(SocketAddr),
+    /// UNIX socket connection, with the operating system
+    /// user of the client process, if it's known.
+    Unix { uid: Option<u32> },
+}
+
+impl ClientAddr {
+    /// IP address of a TCP client. UNIX socket clients don't have one,
+    /// so they never match IP-based rules, e.g. `trusted_networks`.
+    pub fn ip(&self) -> Option<IpAddr> {
+        match self {
+            Self::Tcp(addr) => Some(addr.ip()),
+            Self::Unix { .. } => None,
+        }
+    }
+
+    /// Client port, `0` for UNIX sockets.
+    pub fn port(&self) -> u16 {
+        match self {
+            Self::Tcp(addr) => addr.port(),
+            Self::Unix { .. } => 0,
+        }
+    }
+
+    /// Client host, as shown in admin commands.
+    pub fn host(&self) -> String {
+        match self {
+            Self::Tcp(addr) => addr.ip().to_string(),
+            Self::Unix { .. } => "unix".into(),
+        }
+    }
+
+    /// Client is connected over a UNIX socket.
+    pub fn is_unix(&self) -> bool {
+        matches!(self, Self::Unix { .. })
+    }
+}
+
+impl From<SocketAddr> for ClientAddr {
+    fn from(addr: SocketAddr) -> Self {
+        Self::Tcp(addr)
+    }
+}
+
+impl Display for ClientAddr {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Tcp(addr) => write!(f, "{}", addr),
+            Self::Unix { uid: Some(uid) } => write!(f, "unix socket, uid {}", uid),
+            Self::Unix { uid: None } => write!(f, "unix socket"),
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::net::Ipv4Addr;
+
+    use super::*;
+
+    #[test]
+    fn test_client_addr() {
+        let tcp = ClientAddr::from(SocketAddr::from((Ipv4Addr::LOCALHOST, 5432)));
+        assert_eq!(tcp.ip(), Some(IpAddr::from(Ipv4Addr::LOCALHOST)));
+        assert_eq!(tcp.host(), "127.0.0.1");
+        assert_eq!(tcp.port(), 5432);
+        assert_eq!(tcp.to_string(), "127.0.0.1:5432");
+
+        let unix = ClientAddr::Unix { uid: Some(1000) };
+        assert_eq!(unix.ip(), None);
+        assert_eq!(unix.host(), "unix");
+        assert_eq!(unix.port(), 0);
+        assert!(unix.is_unix());
+        assert_eq!(unix.to_string(), "unix socket, uid 1000");
+    }
+}
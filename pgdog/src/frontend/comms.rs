@@ -1,6 +1,5 @@
 //! Communication to/from connected clients.
 
-use std::net::SocketAddr;
 use std::ops::Deref;
 use std::sync::{
     Arc,
@@ -16,7 +15,7 @@ use tokio_util::task::TaskTracker;
 use crate::net::Parameters;
 use crate::net::messages::{BackendKeyData, FrontendPid};
 
-use super::{ConnectedClient, Stats};
+use super::{ClientAddr, ConnectedClient, Stats};
 
 static COMMS: Lazy<Comms> = Lazy::new(Comms::new);
 
@@ -34,6 +33,10 @@ struct Global {
     // because FrontendPid is monotonically minted by us,
     // not derived from untrusted client input.
     clients: Arc<DashMap<FrontendPid, ConnectedClient>>,
+    // Number of connected clients, by user and database.
+    users: DashMap<(String, String), usize>,
+    // Number of connected clients, by user, for all databases.
+    user_totals: DashMap<String, usize>,
     tracker: TaskTracker,
 }
 
@@ -57,6 +60,8 @@ impl Comms {
                 shutdown: Arc::new(Notify::new()),
                 offline: AtomicBool::new(false),
                 clients: Arc::new(DashMap::default()),
+                users: DashMap::default(),
+                user_totals: DashMap::default(),
                 tracker: TaskTracker::new(),
             }),
         }
@@ -86,13 +91,69 @@ impl Comms {
     }
 
     /// New client connected.
-    pub fn connect(&self, key: BackendKeyData, addr: SocketAddr, params: &Parameters) {
+    pub fn connect(&self, key: BackendKeyData, addr: ClientAddr, params: &Parameters) {
         let pid = FrontendPid::from(&key);
         self.global
             .clients
             .insert(pid, ConnectedClient::new(key, addr, params));
     }
 
+    /// Reserve a slot for a client of the user and database, unless
+    /// `limit` clients are connected to the database already, or `user_limit`
+    /// to all databases. The slot is released when dropped.
+    pub fn reserve(
+        &self,
+        user: &str,
+        database: &str,
+        limit: Option<usize>,
+        user_limit: Option<usize>,
+    ) -> Result<UserSlot, ClientLimit> {
+        // The user's total is always locked first,
+        // so concurrent logins can't deadlock.
+        let mut total = self.global.user_totals.entry(user.to_owned()).or_default();
+
+        if let Some(limit) = user_limit
+            && *total >= limit
+        {
+            return Err(ClientLimit::User(limit));
+        }
+
+        let key = (user.to_owned(), database.to_owned());
+        let mut clients = self.global.users.entry(key.clone()).or_default();
+
+        if let Some(limit) = limit
+            && *clients >= limit
+        {
+            return Err(ClientLimit::Database(limit));
+        }
+
+        *clients += 1;
+        *total += 1;
+
+        Ok(UserSlot {
+            comms: self.clone(),
+            key,
+        })
+    }
+
+    /// Number of clients connected as the user to the database.
+    pub fn user_clients(&self, user: &str, database: &str) -> usize {
+        self.global
+            .users
+            .get(&(user.to_owned(), database.to_owned()))
+            .map(|clients| *clients)
+            .unwrap_or_default()
+    }
+
+    /// Number of clients connected as the user to all databases.
+    pub fn user_clients_total(&self, user: &str) -> usize {
+        self.global
+            .user_totals
+            .get(user)
+            .map(|clients| *clients)
+            .unwrap_or_default()
+    }
+
     /// Update client parameters.
     pub fn update_params(&self, id: FrontendPid, params: Parameters) {
         if let Some(mut entry) = self.global.clients.get_mut(&id) {
@@ -122,6 +183,32 @@ impl Comms {
             .unwrap_or(false)
     }
 
+    /// The client is connected.
+    pub fn connected(&self, id: FrontendPid) -> bool {
+        self.global.clients.contains_key(&id)
+    }
+
+    /// Disconnect the client, e.g. with `KILL CLIENT`.
+    ///
+    /// Return: true if the client is connected, false otherwise.
+    pub fn kill(&self, id: FrontendPid) -> bool {
+        self.global
+            .clients
+            .get(&id)
+            .map(|client| client.kill.notify_one())
+            .is_some()
+    }
+
+    /// Wait for the client to be killed.
+    pub fn killed(&self, id: FrontendPid) -> Arc<Notify> {
+        self.global
+            .clients
+            .get(&id)
+            .map(|client| client.kill.clone())
+            // Not registered, e.g. mirror clients, so it can't be killed.
+            .unwrap_or_default()
+    }
+
     /// Notify clients pgDog is shutting down.
     pub fn shutdown(&self) {
         self.global.offline.store(true, Ordering::Relaxed);
@@ -140,6 +227,42 @@ impl Comms {
     }
 }
 
+/// Client slot of a user and database, reserved with [`Comms::reserve`].
+#[derive(Debug)]
+pub struct UserSlot {
+    comms: Comms,
+    key: (String, String),
+}
+
+impl Drop for UserSlot {
+    fn drop(&mut self) {
+        let users = &self.comms.global.users;
+
+        if let Some(mut clients) = users.get_mut(&self.key) {
+            *clients = clients.saturating_sub(1);
+        }
+
+        users.remove_if(&self.key, |_, clients| *clients == 0);
+
+        let totals = &self.comms.global.user_totals;
+
+        if let Some(mut clients) = totals.get_mut(&self.key.0) {
+            *clients = clients.saturating_sub(1);
+        }
+
+        totals.remove_if(&self.key.0, |_, clients| *clients == 0);
+    }
+}
+
+/// Client limit that was reached, see [`Comms::reserve`].
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ClientLimit {
+    /// `max_client_connections` of the user and database.
+    Database(usize),
+    /// `max_user_client_connections` of the user.
+    User(usize),
+}
+
 #[derive(Debug, Clone)]
 pub struct ClientComms {
     comms: Comms,
@@ -167,13 +290,17 @@ impl ClientComms {
         Self { id, comms: comms() }
     }
 
-    pub fn connect(&self, key: BackendKeyData, addr: SocketAddr, params: &Parameters) {
+    pub fn connect(&self, key: BackendKeyData, addr: ClientAddr, params: &Parameters) {
         self.comms.connect(key, addr, params)
     }
 
     pub fn update_params(&self, params: &Parameters) {
         self.comms.update_params(self.id, params.clone());
     }
+
+    pub fn killed(&self) -> Arc<Notify> {
+        self.comms.killed(self.id)
+    }
 }
 
 #[cfg(test)]
@@ -186,8 +313,8 @@ mod tests {
         messages::{BackendKeyData, ProtocolVersion},
     };
 
-    fn addr() -> SocketAddr {
-        "127.0.0.1:5432".parse().unwrap()
+    fn addr() -> ClientAddr {
+        "127.0.0.1:5432".parse::<SocketAddr>().unwrap().into()
     }
 
     #[test]
@@ -230,4 +357,69 @@ mod tests {
         comms.disconnect(id);
         assert!(!comms.verify_cancel(&key));
     }
+
+    #[tokio::test]
+    async fn test_kill() {
+        let comms = Comms::default();
+        let id = FrontendPid::new();
+        assert!(!comms.kill(id));
+
+        let key = BackendKeyData::new_frontend(ProtocolVersion::V3_0, id);
+        comms.connect(key, addr(), &Parameters::default());
+        let killed = comms.killed(id);
+
+        assert!(comms.kill(id));
+        // The client doesn't have to be waiting yet.
+        killed.notified().await;
+    }
+
+    #[test]
+    fn test_reserve_user_slot() {
+        let comms = Comms::default();
+
+        let first = comms.reserve("alice", "pgdog", Some(2), None).unwrap();
+        let second = comms.reserve("alice", "pgdog", Some(2), None).unwrap();
+        assert_eq!(
+            comms.reserve("alice", "pgdog", Some(2), None).unwrap_err(),
+            ClientLimit::Database(2)
+        );
+        assert_eq!(comms.user_clients("alice", "pgdog"), 2);
+
+        // Other users and databases have their own limits.
+        assert!(comms.reserve("bob", "pgdog", Some(2), None).is_ok());
+        assert!(comms.reserve("alice", "other", Some(2), None).is_ok());
+
+        drop(first);
+        assert_eq!(comms.user_clients("alice", "pgdog"), 1);
+        let _third = comms.reserve("alice", "pgdog", Some(2), None).unwrap();
+
+        drop(second);
+        assert!(comms.reserve("alice", "pgdog", None, None).is_ok());
+    }
+
+    #[test]
+    fn test_reserve_user_slot_all_databases() {
+        let comms = Comms::default();
+
+        let first = comms.reserve("alice", "pgdog", None, Some(2)).unwrap();
+        let _second = comms.reserve("alice", "other", Some(5), Some(2)).unwrap();
+        assert_eq!(comms.user_clients_total("alice"), 2);
+
+        // The limit is shared by all databases of the user.
+        for database in ["pgdog", "other", "third"] {
+            assert_eq!(
+                comms.reserve("alice", database, None, Some(2)).unwrap_err(),
+                ClientLimit::User(2)
+            );
+        }
+        assert!(comms.reserve("bob", "pgdog", None, Some(2)).is_ok());
+
+        // A rejected client doesn't take a slot.
+        assert_eq!(comms.user_clients("alice", "third"), 0);
+
+        drop(first);
+        assert_eq!(comms.user_clients_total("alice"), 1);
+        let _third = comms.reserve("alice", "third", None, Some(2)).unwrap();
+        assert_eq!(comms.user_clients_total("alice"), 2);
+    }
 }
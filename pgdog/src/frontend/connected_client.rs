@@ -1,34 +1,39 @@
 use chrono::{DateTime, Local};
-use std::net::SocketAddr;
+use std::sync::Arc;
+
+use tokio::sync::Notify;
 
 use crate::net::{Parameters, messages::BackendKeyData};
 
-use super::Stats;
+use super::{ClientAddr, Stats};
 
 /// Connected client.
 #[derive(Clone, Debug)]
 pub struct ConnectedClient {
     /// Client statistics.
     pub stats: Stats,
-    /// Client IP address.
-    pub addr: SocketAddr,
+    /// Client address.
+    pub addr: ClientAddr,
     /// System time when the client connected.
     pub connected_at: DateTime<Local>,
     /// Client connection parameters.
     pub paramters: Parameters,
     /// Cancel key identifying this client and its secret.
     pub key: BackendKeyData,
+    /// Notified when the client is killed by `KILL CLIENT`.
+    pub kill: Arc<Notify>,
 }
 
 impl ConnectedClient {
     /// New connected client.
-    pub fn new(key: BackendKeyData, addr: SocketAddr, params: &Parameters) -> Self {
+    pub fn new(key: BackendKeyData, addr: ClientAddr, params: &Parameters) -> Self {
         Self {
             key,
             stats: Stats::new(),
             addr,
             connected_at: Local::now(),
             paramters: params.clone(),
+            kill: Arc::new(Notify::new()),
         }
     }
 }
@@ -64,12 +64,24 @@ pub enum Error {
     #[error("query has no route")]
     NoRoute,
 
+    #[error("no server to replicate from")]
+    NoReplicationServer,
+
+    #[error("user \"{0}\" is not allowed to replicate")]
+    ReplicationNotAllowed(String),
+
+    #[error("\"{0}\" is not a server of this database")]
+    ReplicationHost(String),
+
     #[error("multi-tuple insert requires multi-shard binding")]
     MultiShardRequired,
 
     #[error("sharding key updates are forbidden")]
     ShardingKeyUpdateForbidden,
 
+    #[error("killed by administrator command")]
+    Killed,
+
     // FIXME: layer errors better so we don't have
     // to reach so deep into a module.
     #[error("{0}")]
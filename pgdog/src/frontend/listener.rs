@@ -5,21 +5,24 @@ use std::net::SocketAddr;
 use std::sync::Arc;
 
 use crate::backend::databases::{databases, reload, shutdown};
-use crate::config::config;
+use crate::config::{GssEncryption, config};
 use crate::frontend::client::query_engine::two_pc::Manager;
-use crate::net::messages::{FrontendPid, NegotiateProtocolVersion, Startup, hello::SslReply};
-use crate::net::tls::{acceptor, peer_identity};
+use crate::net::messages::{
+    ErrorResponse, FrontendPid, NegotiateProtocolVersion, Startup, hello::SslReply,
+};
+use crate::net::tls::{acceptor, peer_identity, sni_database};
 use crate::net::{self, Stream, tweak};
 use crate::sighup::Sighup;
+use crate::sigterm::Sigterm;
 use tokio::net::{TcpListener, TcpStream};
 use tokio::signal::ctrl_c;
 use tokio::sync::Notify;
 use tokio::time::timeout;
 use tokio::{select, spawn};
 
-use tracing::{error, info, warn};
+use tracing::{debug, error, info, warn};
 
-use super::{Client, Error, comms::comms};
+use super::{Client, ClientAddr, Error, comms::comms, unix_socket::UnixSocket};
 
 /// Client connections listener and handler.
 #[derive(Debug, Clone)]
@@ -41,30 +44,24 @@ impl Listener {
     pub async fn listen(&mut self) -> Result<(), Error> {
         info!("🐕 PgDog listening on {}", self.addr);
         let listener = TcpListener::bind(&self.addr).await?;
+        let unix_socket = {
+            let config = config();
+            UnixSocket::bind(&config.config.general, config.config.memory.net_buffer)?
+        };
         let shutdown_signal = comms().shutting_down();
         let mut sighup = Sighup::new()?;
+        let mut sigterm = Sigterm::new()?;
 
         loop {
             select! {
                 connection = listener.accept() => {
-                   let comms = comms();
                    let (stream, addr) = connection?;
-                   let offline = comms.offline();
-
-                   let future = async move {
-                       match Self::handle_client(stream, addr).await {
-                           Ok(_) => (),
-                           Err(err) => if !err.disconnect() {
-                               error!("client crashed: {:?}", err);
-                           }
-                       };
-                   };
-
-                   if offline {
-                       spawn(future);
-                   } else {
-                       comms.tracker().spawn(future);
-                   }
+                   Self::spawn_client(Self::handle_client(stream, addr));
+                }
+
+                connection = unix_socket.accept() => {
+                   let (stream, addr) = connection?;
+                   Self::spawn_client(Self::handle_stream(stream, addr));
                 }
 
                 _ = shutdown_signal.notified() => {
@@ -75,6 +72,13 @@ impl Listener {
                     self.start_shutdown();
                 }
 
+                // Let clients finish their transactions, e.g.
+                // during a rolling restart in Kubernetes.
+                _ = sigterm.listen() => {
+                    info!("🐕 PgDog is shutting down gracefully [SIGTERM]");
+                    self.start_shutdown();
+                }
+
                 _ = sighup.listen() => {
                     if let Err(err) = reload() {
                         error!("configuration reload error: {}", err);
@@ -90,6 +94,26 @@ impl Listener {
         Ok(())
     }
 
+    fn spawn_client(client: impl Future<Output = Result<(), Error>> + Send + 'static) {
+        let comms = comms();
+        let future = async move {
+            match client.await {
+                Ok(_) => (),
+                Err(err) => {
+                    if !err.disconnect() {
+                        error!("client crashed: {:?}", err);
+                    }
+                }
+            };
+        };
+
+        if comms.offline() {
+            spawn(future);
+        } else {
+            comms.tracker().spawn(future);
+        }
+    }
+
     /// Shutdown this listener.
     pub fn shutdown(&self) {
         self.shutdown.notify_one();
@@ -164,9 +188,18 @@ impl Listener {
             );
         }
 
-        let mut stream = Stream::plain(stream, config.config.memory.net_buffer);
+        Self::handle_stream(
+            Stream::plain(stream, config.config.memory.net_buffer),
+            addr.into(),
+        )
+        .await
+    }
 
-        let tls = acceptor();
+    async fn handle_stream(mut stream: Stream, addr: ClientAddr) -> Result<(), Error> {
+        let config = config();
+        // TLS isn't used over UNIX sockets, like in Postgres.
+        let tls = if stream.is_unix() { None } else { acceptor() };
+        let mut database = None;
 
         loop {
             let startup = match Startup::from_stream(&mut stream).await {
@@ -198,6 +231,12 @@ impl Listener {
                             }
                         };
                         let tls_identity = peer_identity(cipher.get_ref().1);
+                        // Multiple databases can share our address,
+                        // the client tells us which one with SNI.
+                        database = sni_database(
+                            cipher.get_ref().1.server_name(),
+                            &config.config.sni_routes,
+                        );
                         stream = Stream::tls(
                             tokio_rustls::TlsStream::Server(cipher),
                             config.config.memory.net_buffer,
@@ -209,15 +248,43 @@ impl Listener {
                 }
 
                 Startup::GssEnc => {
-                    // GSS encryption is not yet supported; reject and wait for a normal startup.
-                    stream.send_flush(&SslReply::No).await?;
+                    let general = &config.config.general;
+                    let reply = if stream.is_unix() {
+                        general.unix_socket_gss_encryption
+                    } else {
+                        general.gss_encryption
+                    };
+
+                    match reply {
+                        // GSS encryption isn't supported. Decline it, so the client
+                        // continues on this connection with an SSLRequest or a plain startup,
+                        // like libpq does with `gssencmode=prefer`.
+                        GssEncryption::Decline => {
+                            debug!("declining GSS encryption request [{addr}]");
+                            stream.send_flush(&SslReply::No).await?;
+                        }
+
+                        // libpq reconnects without GSS encryption unless
+                        // it's required, and reports the error if it is.
+                        GssEncryption::Reject => {
+                            debug!("rejecting GSS encryption request [{addr}]");
+                            stream
+                                .fatal(ErrorResponse::gss_encryption_not_supported())
+                                .await?;
+                            return Ok(());
+                        }
+                    }
                 }
 
                 Startup::Startup {
                     version,
-                    params,
+                    mut params,
                     unrecognized_options,
                 } => {
+                    if let Some(database) = database.take() {
+                        params.insert("database", database);
+                    }
+
                     let negotiated = version
                         .negotiated()
                         .ok_or_else(|| net::Error::UnsupportedStartup(version.as_i32()))?;
@@ -250,3 +317,135 @@ impl Listener {
         Ok(())
     }
 }
+
+#[cfg(test)]
+mod test {
+    use tokio::io::{AsyncRead, AsyncReadExt, AsyncWriteExt};
+    use tokio::time::Duration;
+
+    use super::*;
+    use crate::config::load_test;
+    use crate::net::messages::ToBytes;
+    use crate::test_utils::set_config;
+
+    async fn connect() -> (TcpStream, tokio::task::JoinHandle<Result<(), Error>>) {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let port = listener.local_addr().unwrap().port();
+
+        let handle = spawn(async move {
+            let (stream, addr) = listener.accept().await.unwrap();
+            Listener::handle_client(stream, addr).await
+        });
+
+        (
+            TcpStream::connect(("127.0.0.1", port)).await.unwrap(),
+            handle,
+        )
+    }
+
+    async fn read_u8(conn: &mut (impl AsyncRead + Unpin)) -> u8 {
+        timeout(Duration::from_secs(1), conn.read_u8())
+            .await
+            .unwrap()
+            .unwrap()
+    }
+
+    #[tokio::test]
+    async fn test_gssenc() {
+        load_test();
+
+        let (mut conn, handle) = connect().await;
+
+        // GSSENCRequest, then SSLRequest, like libpq with gssencmode=prefer.
+        for request in [Startup::gss_enc(), Startup::tls()] {
+            conn.write_all(&request.to_bytes()).await.unwrap();
+            assert_eq!(read_u8(&mut conn).await, b'N');
+        }
+
+        // The client continues with a normal startup on the same connection.
+        let startup = Startup::new("pgdog", "pgdog", vec![]);
+        conn.write_all(&startup.to_bytes()).await.unwrap();
+        assert!(matches!(read_u8(&mut conn).await, b'R' | b'E'));
+
+        drop(conn);
+        let _ = handle.await.unwrap();
+
+        let mut config = (*config()).clone();
+        config.config.general.gss_encryption = GssEncryption::Reject;
+        let _config = set_config(config);
+
+        let (mut conn, handle) = connect().await;
+
+        // The request is rejected and the connection closed.
+        conn.write_all(&Startup::gss_enc().to_bytes())
+            .await
+            .unwrap();
+        assert_eq!(read_u8(&mut conn).await, b'E');
+        handle.await.unwrap().unwrap();
+    }
+
+    #[cfg(unix)]
+    #[tokio::test]
+    async fn test_unix_socket_client() {
+        load_test();
+
+        let (mut conn, server) = tokio::net::UnixStream::pair().unwrap();
+        let stream = Stream::unix(server, 4096);
+        let addr = ClientAddr::Unix { uid: None };
+        let handle = spawn(async move { Listener::handle_stream(stream, addr).await });
+
+        // No TLS over UNIX sockets.
+        conn.write_all(&Startup::tls().to_bytes()).await.unwrap();
+        assert_eq!(read_u8(&mut conn).await, b'N');
+
+        let startup = Startup::new("pgdog", "pgdog", vec![]);
+        conn.write_all(&startup.to_bytes()).await.unwrap();
+        assert!(matches!(read_u8(&mut conn).await, b'R' | b'E'));
+
+        drop(conn);
+        let _ = handle.await.unwrap();
+    }
+
+    #[cfg(unix)]
+    #[tokio::test]
+    async fn test_unix_socket_gssenc() {
+        load_test();
+
+        // The TCP setting doesn't apply to UNIX sockets.
+        let mut tcp = (*config()).clone();
+        tcp.config.general.gss_encryption = GssEncryption::Reject;
+        let config_guard = set_config(tcp);
+
+        let (mut conn, server) = tokio::net::UnixStream::pair().unwrap();
+        let handle = spawn(async move {
+            Listener::handle_stream(Stream::unix(server, 4096), ClientAddr::Unix { uid: None })
+                .await
+        });
+
+        conn.write_all(&Startup::gss_enc().to_bytes())
+            .await
+            .unwrap();
+        assert_eq!(read_u8(&mut conn).await, b'N');
+
+        drop(conn);
+        let _ = handle.await.unwrap();
+        drop(config_guard);
+
+        let mut unix = (*config()).clone();
+        unix.config.general.unix_socket_gss_encryption = GssEncryption::Reject;
+        let _config = set_config(unix);
+
+        let (mut conn, server) = tokio::net::UnixStream::pair().unwrap();
+        let handle = spawn(async move {
+            Listener::handle_stream(Stream::unix(server, 4096), ClientAddr::Unix { uid: None })
+                .await
+        });
+
+        // The request is rejected and the connection closed.
+        conn.write_all(&Startup::gss_enc().to_bytes())
+            .await
+            .unwrap();
+        assert_eq!(read_u8(&mut conn).await, b'E');
+        handle.await.unwrap().unwrap();
+    }
+}
@@ -2,6 +2,7 @@
 
 pub mod buffered_query;
 pub mod client;
+pub mod client_addr;
 pub mod client_request;
 pub mod comms;
 pub mod connected_client;
@@ -15,11 +16,13 @@ pub mod query_logger;
 pub mod regex_parser;
 pub mod router;
 pub mod stats;
+pub mod unix_socket;
 
 pub use buffered_query::BufferedQuery;
 pub use client::Client;
+pub use client_addr::ClientAddr;
 pub use client_request::ClientRequest;
-pub use comms::{ClientComms, Comms};
+pub use comms::{ClientComms, ClientLimit, Comms, UserSlot};
 pub use connected_client::ConnectedClient;
 pub(crate) use error::Error;
 pub use prepared_statements::{PreparedStatements, Rewrite};
@@ -179,6 +179,23 @@ impl GlobalCache {
         }
     }
 
+    /// Record a rewritten copy of a prepared statement, executed instead
+    /// of the original by some requests, and return its global name.
+    ///
+    /// Clients don't know about it and never close it, so it stays in the cache.
+    pub fn insert_rewritten(&mut self, parse: &Parse) -> String {
+        let key = CacheKey {
+            query: parse.query_ref(),
+            data_types: parse.data_types_ref(),
+            version: 0,
+        };
+
+        match self.statements.get(&key) {
+            Some(entry) if entry.used > 0 => entry.name(),
+            _ => self.insert(parse).1,
+        }
+    }
+
     /// Insert a prepared statement into the global cache ignoring
     /// duplicate check.
     pub fn insert_anyway(&mut self, parse: &Parse) -> String {
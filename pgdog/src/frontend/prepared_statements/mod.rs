@@ -94,9 +94,10 @@ impl PreparedStatements {
         let existed = self.local.insert(key.to_owned(), name.clone());
 
         if let Some(old_value) = existed {
-            // Key already existed, only value changed.
+            // Client prepared it again under the same name.
             self.memory_used = self.memory_used.saturating_sub(str_mem(&old_value));
             self.memory_used += str_mem(&name);
+            self.global.write().decrement(&old_value);
         } else {
             // New entry.
             self.memory_used += str_mem(key) + str_mem(&name);
@@ -330,4 +331,27 @@ mod test {
         let unused = global.statements().values().filter(|s| s.used == 0).count();
         assert_eq!(unused, 2, "old statements should be unused");
     }
+
+    /// Preparing a statement again with `PREPARE` under the same name
+    /// releases the old one.
+    #[test]
+    fn test_insert_anyway_same_name_releases_old() {
+        let mut statements = PreparedStatements::default();
+
+        let mut parse = Parse::named("__test_1", "SELECT 1");
+        statements.insert_anyway(&mut parse);
+        let mut parse = Parse::named("__test_1", "SELECT 2");
+        statements.insert_anyway(&mut parse);
+
+        assert_eq!(statements.len_local(), 1);
+        assert_eq!(statements.parse("__test_1").unwrap().query(), "SELECT 2");
+
+        let global = statements.global.read();
+        let active = global.statements().values().filter(|s| s.used == 1).count();
+        assert_eq!(active, 1, "only the latest statement should be active");
+        drop(global);
+
+        statements.close_all();
+        assert!(statements.parse("__test_1").is_none());
+    }
 }
@@ -18,6 +18,8 @@ pub const PGDOG_SHARDING_KEY: &str = "pgdog.sharding_key";
 pub const PGDOG_ROLE: &str = "pgdog.role";
 /// Connection pinning.
 pub const PGDOG_PIN: &str = "pgdog.pin";
+/// `SET pgdog.deadline` — limit how long queries can run for, in milliseconds.
+pub const PGDOG_DEADLINE: &str = "pgdog.deadline";
 
 #[derive(Debug, Clone, Default)]
 pub struct ParameterHints<'a> {
@@ -25,6 +27,8 @@ pub struct ParameterHints<'a> {
     pub pgdog_shard: Option<&'a ParameterValue>,
     pub pgdog_sharding_key: Option<&'a ParameterValue>,
     pub pgdog_role: Option<&'a ParameterValue>,
+    pub application_name: Option<&'a ParameterValue>,
+    pub default_transaction_read_only: Option<&'a ParameterValue>,
     hooks: ParserHooks,
 }
 
@@ -35,6 +39,8 @@ impl<'a> From<&'a Parameters> for ParameterHints<'a> {
             pgdog_shard: value.get(PGDOG_SHARD),
             pgdog_role: value.get(PGDOG_ROLE),
             pgdog_sharding_key: value.get(PGDOG_SHARDING_KEY),
+            application_name: value.get("application_name"),
+            default_transaction_read_only: value.get("default_transaction_read_only"),
             hooks: ParserHooks::default(),
         }
     }
@@ -121,6 +127,17 @@ impl ParameterHints<'_> {
 
         role
     }
+
+    /// Are transactions read-only unless they say otherwise?
+    pub(crate) fn default_transaction_read_only(&self) -> bool {
+        match self.default_transaction_read_only {
+            Some(ParameterValue::String(val)) => {
+                matches!(val.to_lowercase().as_str(), "on" | "true" | "yes" | "1")
+            }
+            Some(ParameterValue::Integer(val)) => *val != 0,
+            _ => false,
+        }
+    }
 }
 
 #[cfg(test)]
@@ -137,12 +154,13 @@ mod tests {
                 name: Some(name.to_string()),
                 shard: *shard,
                 all: false,
+                hash: false,
             })
             .collect();
 
         ShardingSchema {
             shards: schemas.len(),
-            schemas: ShardedSchemas::new(sharded_schemas),
+            schemas: ShardedSchemas::new(sharded_schemas, schemas.len()),
             ..Default::default()
         }
     }
@@ -8,7 +8,7 @@ use std::ops::Deref;
 use std::time::Instant;
 
 use parking_lot::Mutex;
-use std::sync::Arc;
+use std::sync::{Arc, OnceLock};
 use tracing::warn;
 
 use super::super::{Error, Route, Shard, StatementRewrite, StatementRewriteContext};
@@ -50,6 +50,8 @@ pub struct AstInner {
     pub rewrite_plan: RewritePlan,
     /// Original query.
     pub query_without_comment: Arc<str>,
+    /// Query fingerprint, computed the first time it's needed.
+    pub fingerprint: OnceLock<Option<String>>,
 }
 
 impl AstInner {
@@ -61,6 +63,7 @@ impl AstInner {
             stats: Mutex::new(Stats::new()),
             rewrite_plan: RewritePlan::default(),
             query_without_comment: "".into(),
+            fingerprint: OnceLock::new(),
         }
     }
 
@@ -71,6 +74,7 @@ impl AstInner {
             stats: Mutex::new(Stats::new()),
             rewrite_plan: RewritePlan::default(),
             query_without_comment: "".into(),
+            fingerprint: OnceLock::new(),
         }
     }
 }
@@ -162,6 +166,7 @@ impl Ast {
                 ast,
                 rewrite_plan,
                 query_without_comment: query.query_without_comment.into(),
+                fingerprint: OnceLock::new(),
             }),
         })
     }
@@ -262,6 +267,36 @@ impl Ast {
         }
     }
 
+    /// Record whether the shadow parser agreed with the route
+    /// this query was sent to. Every statement in the query
+    /// went there, so each one counts.
+    pub fn update_shadow_stats(&self, matched: bool) {
+        let statements = self.statements();
+        let mut guard = self.stats.lock();
+
+        if matched {
+            guard.shadow_match += statements;
+        } else {
+            guard.shadow_mismatch += statements;
+        }
+    }
+
+    /// Number of statements in the query.
+    #[cfg(feature = "new_parser")]
+    pub(crate) fn statements(&self) -> usize {
+        self.ast.stmts().count()
+    }
+
+    cfg_select! {
+        not(feature = "new_parser") => {
+            /// Number of statements in the query.
+            pub(crate) fn statements(&self) -> usize {
+                self.ast.protobuf.stmts.len()
+            }
+        }
+        _ => {}
+    }
+
     /// Get statement type.
     #[cfg(feature = "new_parser")]
     pub(crate) fn statement_type(&self) -> StatementType {
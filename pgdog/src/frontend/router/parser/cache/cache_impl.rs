@@ -33,6 +33,10 @@ pub struct Stats {
     pub parse_time: Duration,
     /// Fingerprints calculated.
     pub fingerprints: usize,
+    /// Shadow parser agreed with the route used.
+    pub shadow_match: usize,
+    /// Shadow parser disagreed with the route used.
+    pub shadow_mismatch: usize,
 }
 
 impl Stats {
@@ -227,6 +231,12 @@ impl Cache {
         CACHE.clone()
     }
 
+    /// Record a query the shadow parser couldn't parse. It isn't
+    /// cached, so it's counted once in the global stats.
+    pub fn shadow_error(&self) {
+        self.inner.lock().stats.shadow_mismatch += 1;
+    }
+
     /// Get cache stats.
     pub fn stats() -> (Stats, usize) {
         let cache = Self::get();
@@ -245,6 +255,8 @@ impl Cache {
         for stat in query_stats {
             stats.direct += stat.direct;
             stats.multi += stat.multi;
+            stats.shadow_match += stat.shadow_match;
+            stats.shadow_mismatch += stat.shadow_mismatch;
         }
         (stats, len)
     }
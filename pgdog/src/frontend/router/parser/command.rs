@@ -1,4 +1,4 @@
-use super::*;
+use super::{explain_trace::ExplainTrace, *};
 use crate::{
     frontend::{BufferedQuery, client::TransactionType},
     net::parameter::ParameterValue,
@@ -12,6 +12,17 @@ pub struct SetParam {
     pub local: bool,
 }
 
+/// What a `DISCARD` statement resets.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum DiscardTarget {
+    /// `DISCARD ALL`.
+    All,
+    /// `DISCARD TEMP`.
+    Temp,
+    /// `DISCARD PLANS` or `DISCARD SEQUENCES`.
+    Other,
+}
+
 #[derive(Debug, Clone)]
 pub enum Command {
     Query(Route),
@@ -39,9 +50,13 @@ pub enum Command {
         name: String,
         value: String,
     },
-    Deallocate,
+    Deallocate {
+        /// Statement name, `None` for `DEALLOCATE ALL`.
+        name: Option<String>,
+    },
     Discard {
         extended: bool,
+        target: DiscardTarget,
     },
     Listen {
         channel: String,
@@ -54,6 +69,8 @@ pub enum Command {
     },
     Unlisten(String),
     UniqueId,
+    /// `EXPLAIN (ROUTE)`, answered without running the query.
+    ExplainRoute(ExplainTrace),
 }
 
 impl Command {
@@ -15,6 +15,9 @@ pub(super) static SHARDING_KEY: Lazy<Regex> = Lazy::new(|| {
 });
 pub(super) static ROLE: Lazy<Regex> =
     Lazy::new(|| Regex::new(r#"pgdog_role: *(primary|replica)"#).unwrap());
+pub(super) static POOL: Lazy<Regex> = Lazy::new(|| Regex::new(r#"pgdog_pool: *slow\b"#).unwrap());
+pub(super) static DEADLINE: Lazy<Regex> =
+    Lazy::new(|| Regex::new(r#"pgdog_deadline: *([0-9]+)"#).unwrap());
 
 pub(super) fn get_matched_value<'a>(caps: &'a regex::Captures<'a>) -> Option<&'a str> {
     caps.get(1)
@@ -20,6 +20,31 @@ pub struct QueryAndComment<'a> {
     pub shard: Option<Shard>,
 }
 
+/// Block comments at the beginning and the end of the query.
+fn edge_comments(query: &str) -> impl Iterator<Item = &str> {
+    let leading = leading_block_comment(query).map(|(_, comment)| comment);
+    let trailing = trailing_block_comment(query).map(|(_, comment)| comment);
+
+    leading.into_iter().chain(trailing)
+}
+
+/// Check if the query asks for the slow pool with a `pgdog_pool: slow`
+/// comment, at either the beginning or the end of the query.
+pub fn slow_pool_hint(query: &str) -> bool {
+    edge_comments(query).any(|comment| directive::POOL.is_match(comment))
+}
+
+/// Get the deadline, in milliseconds, from a `pgdog_deadline: <ms>`
+/// comment at either the beginning or the end of the query.
+pub fn deadline_hint(query: &str) -> Option<u64> {
+    edge_comments(query).find_map(|comment| {
+        directive::DEADLINE
+            .captures(comment)
+            .and_then(|cap| cap.get(1))
+            .and_then(|ms| ms.as_str().parse().ok())
+    })
+}
+
 /// Extract SQL C-style block comments from both the beginning and the end
 /// of the query, returning the stripped query string and directives found
 /// in either side. Leading takes precedence when both sides carry the same
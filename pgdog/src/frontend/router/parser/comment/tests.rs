@@ -6,7 +6,7 @@ use crate::config::database::Role;
 
 use super::super::Shard;
 use super::directive::{SHARDING_KEY, get_matched_value};
-use super::parse_edge_comment;
+use super::{deadline_hint, parse_edge_comment, slow_pool_hint};
 
 fn test_schema() -> ShardingSchema {
     ShardingSchema {
@@ -431,12 +431,13 @@ fn test_sharding_key_with_schema_name() {
         name: Some("sales".to_string()),
         shard: 1,
         all: false,
+        hash: false,
     };
 
     let schema = ShardingSchema {
         shards: 2,
         tables: ShardedTables::new(vec![], vec![], false, SystemCatalogsBehavior::default()),
-        schemas: ShardedSchemas::new(vec![sales_schema]),
+        schemas: ShardedSchemas::new(vec![sales_schema], 2),
         ..Default::default()
     };
 
@@ -444,3 +445,34 @@ fn test_sharding_key_with_schema_name() {
     let result = parse_edge_comment(query, &schema).unwrap();
     assert_eq!(result.shard, Some(Shard::Direct(1)));
 }
+
+#[test]
+fn test_slow_pool_hint() {
+    assert!(slow_pool_hint(
+        "/* pgdog_pool: slow */ SELECT * FROM report"
+    ));
+    assert!(slow_pool_hint("SELECT * FROM report /* pgdog_pool:slow */"));
+    assert!(!slow_pool_hint("SELECT * FROM report"));
+    assert!(!slow_pool_hint(
+        "SELECT '/* pgdog_pool: slow */' AS hint, 1"
+    ));
+    assert!(!slow_pool_hint("/* pgdog_pool: slower */ SELECT 1"));
+}
+
+#[test]
+fn test_deadline_hint() {
+    assert_eq!(
+        deadline_hint("/* pgdog_deadline: 500 */ SELECT 1"),
+        Some(500)
+    );
+    assert_eq!(deadline_hint("SELECT 1 /* pgdog_deadline:25 */"), Some(25));
+    assert_eq!(deadline_hint("SELECT 1"), None);
+    assert_eq!(
+        deadline_hint("SELECT '/* pgdog_deadline: 500 */' AS hint, 1"),
+        None
+    );
+    assert_eq!(
+        deadline_hint("SELECT 1 WHERE name = 'pgdog_deadline: 500'"),
+        None
+    );
+}
@@ -1,16 +1,18 @@
 //! Shortcut the parser given the cluster config.
 
-use pgdog_config::Role;
+use pgdog_config::{QueryParserLevel, QueryRoutingPool, Role};
 
 use crate::frontend::client::TransactionType;
-use crate::frontend::router::parser::ShardsWithPriority;
+use crate::frontend::router::parser::{
+    LazyFingerprint, QueryRoutingTarget, Shard, ShardWithPriority, ShardsWithPriority,
+};
 use crate::{
     backend::ShardingSchema,
     config::{MultiTenant, ReadWriteStrategy},
     frontend::{BufferedQuery, RouterContext},
 };
 
-use super::Error;
+use super::{Error, PrimaryOnly};
 
 /// Query parser context.
 ///
@@ -34,6 +36,14 @@ pub struct QueryParserContext<'a> {
     pub(super) prefer_primary: bool,
     /// Route all queries to replicas by default unless an explicit role hint says otherwise.
     pub(super) prefer_replica: bool,
+    /// Route queries that only read system catalogs to replicas.
+    pub(super) catalog_reads_on_replicas: bool,
+    /// Functions and tables that always route to the primary.
+    pub(super) primary_only: &'a PrimaryOnly,
+    /// Query routing rule matching the query, if any.
+    pub(super) routing_rule: Option<QueryRoutingTarget>,
+    /// The query is listed in `slow_queries`.
+    pub(super) slow_query: bool,
     /// Do we need the router at all? Shortcut to bypass this for unsharded
     /// clusters with databases that only read or write.
     pub(super) router_needed: bool,
@@ -41,6 +51,8 @@ pub struct QueryParserContext<'a> {
     pub(super) multi_tenant: &'a Option<MultiTenant>,
     /// Dry run enabled?
     pub(super) dry_run: bool,
+    /// Parser runs in shadow mode, its decisions are recorded but not used.
+    pub(super) shadow: bool,
     /// Expanded EXPLAIN annotations enabled?
     pub(super) expanded_explain: bool,
     /// Shards calculator.
@@ -57,6 +69,40 @@ impl<'a> QueryParserContext<'a> {
             .parameter_hints
             .compute_shard(&mut shards_calculator, &sharding_schema)?;
 
+        // Both match queries by fingerprint, which is computed once, if at all,
+        // and kept with the cached AST for the next requests.
+        let cluster = router_context.cluster;
+        let (routing_rule, slow_query) = match router_context.query {
+            Some(ref query) => {
+                let query = match router_context.ast {
+                    Some(ref ast) => LazyFingerprint::cached(query.query(), &ast.fingerprint),
+                    None => LazyFingerprint::new(query.query()),
+                };
+                let routing_rules = cluster.query_routing_rules();
+                let routing_rule = if routing_rules.is_empty() {
+                    None
+                } else {
+                    routing_rules.route(
+                        &query,
+                        router_context
+                            .parameter_hints
+                            .application_name
+                            .and_then(|name| name.as_str()),
+                    )
+                };
+
+                (
+                    routing_rule,
+                    cluster.has_slow_pool() && cluster.slow_query(&query),
+                )
+            }
+            None => (None, false),
+        };
+
+        if let Some(shard) = routing_rule.and_then(|rule| rule.shard) {
+            shards_calculator.push(ShardWithPriority::new_rule(Shard::Direct(shard)));
+        }
+
         Ok(Self {
             read_only: router_context.cluster.read_only(),
             write_only: router_context.cluster.write_only(),
@@ -65,18 +111,38 @@ impl<'a> QueryParserContext<'a> {
             rw_strategy: router_context.cluster.read_write_strategy(),
             prefer_primary: router_context.cluster.prefer_primary(),
             prefer_replica: router_context.cluster.prefer_replica(),
+            catalog_reads_on_replicas: router_context.cluster.catalog_reads_on_replicas(),
+            primary_only: router_context.cluster.primary_only(),
+            routing_rule,
+            slow_query,
             router_needed: router_context.cluster.router_needed(),
             multi_tenant: router_context.cluster.multi_tenant(),
             dry_run: router_context.cluster.dry_run(),
+            shadow: router_context.cluster.query_parser() == QueryParserLevel::Shadow,
             expanded_explain: router_context.cluster.expanded_explain(),
             router_context,
             shards_calculator,
         })
     }
 
+    /// Role requested by a query routing rule or the `pgdog.role` parameter.
+    /// The rule is specific to the query, so it takes precedence.
+    pub(super) fn role(&self) -> Option<Role> {
+        self.routing_rule
+            .and_then(|rule| rule.role)
+            .or_else(|| self.router_context.parameter_hints.compute_role())
+    }
+
+    /// Connection pool requested by a query routing rule or `slow_queries`.
+    pub(super) fn pool(&self) -> Option<QueryRoutingPool> {
+        self.routing_rule
+            .and_then(|rule| rule.pool)
+            .or(self.slow_query.then_some(QueryRoutingPool::Slow))
+    }
+
     /// Write override enabled?
     pub(super) fn write_override(&self) -> bool {
-        let role = self.router_context.parameter_hints.compute_role();
+        let role = self.role();
         let txn_write = matches!(
             self.router_context.transaction(),
             Some(TransactionType::ReadWrite | TransactionType::Implicit)
@@ -87,6 +153,18 @@ impl<'a> QueryParserContext<'a> {
             || (self.prefer_primary && role != Some(Role::Replica))
     }
 
+    /// Inside a READ ONLY transaction? The whole transaction can go to a replica.
+    pub(super) fn read_only_transaction(&self) -> bool {
+        *self.router_context.transaction() == Some(TransactionType::ReadOnly)
+    }
+
+    /// Can queries that only read system catalogs ignore the write override?
+    ///
+    /// Transactions could have changed the catalogs, so they stay where they are.
+    pub(super) fn catalog_reads_on_replicas(&self) -> bool {
+        self.catalog_reads_on_replicas && self.router_context.transaction().is_none()
+    }
+
     /// Are we using the conservative read/write separation strategy?
     pub(super) fn rw_conservative(&self) -> bool {
         self.rw_strategy == &ReadWriteStrategy::Conservative
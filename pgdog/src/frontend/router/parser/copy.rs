@@ -95,6 +95,15 @@ impl Default for CopyParser {
     }
 }
 
+/// Value of the `HEADER` option. It's a boolean or `match`,
+/// and enabled when used without a value.
+fn header(value: Option<&str>) -> bool {
+    !matches!(
+        value.map(|value| value.to_lowercase()).as_deref(),
+        Some("false" | "off" | "0")
+    )
+}
+
 impl CopyParser {
     /// Create new copy parser from a COPY statement.
     #[cfg(feature = "new_parser")]
@@ -131,41 +140,41 @@ impl CopyParser {
             }
 
             parser.columns = columns.len();
+        }
 
-            for elem in stmt.options() {
-                match elem.defname().unwrap_or_default().to_lowercase().as_str() {
-                    "format" => match elem.arg().as_str().map(|s| s.to_lowercase()).as_deref() {
-                        Some("binary") => {
-                            parser.headers = true;
-                            format = CopyFormat::Binary;
-                        }
-                        Some("csv") => {
-                            if parser.delimiter.is_none() {
-                                parser.delimiter = Some(',');
-                            }
-                            format = CopyFormat::Csv;
-                        }
-                        _ => (),
-                    },
-
-                    "delimiter" => {
-                        if let Some(string) = elem.arg().as_str() {
-                            parser.delimiter = Some(string.chars().next().unwrap_or(','));
+        for elem in stmt.options() {
+            match elem.defname().unwrap_or_default().to_lowercase().as_str() {
+                "format" => match elem.arg().as_str().map(|s| s.to_lowercase()).as_deref() {
+                    Some("binary") => {
+                        parser.headers = true;
+                        format = CopyFormat::Binary;
+                    }
+                    Some("csv") => {
+                        if parser.delimiter.is_none() {
+                            parser.delimiter = Some(',');
                         }
+                        format = CopyFormat::Csv;
                     }
+                    _ => (),
+                },
 
-                    "header" => {
-                        parser.headers = true;
+                "delimiter" => {
+                    if let Some(string) = elem.arg().as_str() {
+                        parser.delimiter = Some(string.chars().next().unwrap_or(','));
                     }
+                }
 
-                    "null" => {
-                        if let Some(string) = elem.arg().as_str() {
-                            null_string = string.to_owned();
-                        }
-                    }
+                "header" => {
+                    parser.headers = header(elem.arg().as_str());
+                }
 
-                    _ => (),
+                "null" => {
+                    if let Some(string) = elem.arg().as_str() {
+                        null_string = string.to_owned();
+                    }
                 }
+
+                _ => (),
             }
         }
 
@@ -220,52 +229,57 @@ impl CopyParser {
                     }
 
                     parser.columns = columns.len();
+                }
 
-                    for option in &stmt.options {
-                        if let Some(NodeEnum::DefElem(ref elem)) = option.node {
-                            match elem.defname.to_lowercase().as_str() {
-                                "format" => {
-                                    if let Some(ref arg) = elem.arg
-                                        && let Some(NodeEnum::String(ref string)) = arg.node
-                                    {
-                                        match string.sval.to_lowercase().as_str() {
-                                            "binary" => {
-                                                parser.headers = true;
-                                                format = CopyFormat::Binary;
-                                            }
-                                            "csv" => {
-                                                if parser.delimiter.is_none() {
-                                                    parser.delimiter = Some(',');
-                                                }
-                                                format = CopyFormat::Csv;
+                for option in &stmt.options {
+                    if let Some(NodeEnum::DefElem(ref elem)) = option.node {
+                        match elem.defname.to_lowercase().as_str() {
+                            "format" => {
+                                if let Some(ref arg) = elem.arg
+                                    && let Some(NodeEnum::String(ref string)) = arg.node
+                                {
+                                    match string.sval.to_lowercase().as_str() {
+                                        "binary" => {
+                                            parser.headers = true;
+                                            format = CopyFormat::Binary;
+                                        }
+                                        "csv" => {
+                                            if parser.delimiter.is_none() {
+                                                parser.delimiter = Some(',');
                                             }
-                                            _ => (),
+                                            format = CopyFormat::Csv;
                                         }
+                                        _ => (),
                                     }
                                 }
+                            }
 
-                                "delimiter" => {
-                                    if let Some(ref arg) = elem.arg
-                                        && let Some(NodeEnum::String(ref string)) = arg.node
-                                    {
-                                        parser.delimiter = Some(string.sval.chars().next().unwrap_or(','));
-                                    }
-                                }
-
-                                "header" => {
-                                    parser.headers = true;
+                            "delimiter" => {
+                                if let Some(ref arg) = elem.arg
+                                    && let Some(NodeEnum::String(ref string)) = arg.node
+                                {
+                                    parser.delimiter = Some(string.sval.chars().next().unwrap_or(','));
                                 }
+                            }
 
-                                "null" => {
-                                    if let Some(ref arg) = elem.arg
-                                        && let Some(NodeEnum::String(ref string)) = arg.node
-                                    {
-                                        null_string = string.sval.clone();
+                            "header" => {
+                                parser.headers = header(elem.arg.as_ref().and_then(|arg| {
+                                    match arg.node {
+                                        Some(NodeEnum::String(ref string)) => Some(string.sval.as_str()),
+                                        _ => None,
                                     }
-                                }
+                                }));
+                            }
 
-                                _ => (),
+                            "null" => {
+                                if let Some(ref arg) = elem.arg
+                                    && let Some(NodeEnum::String(ref string)) = arg.node
+                                {
+                                    null_string = string.sval.clone();
+                                }
                             }
+
+                            _ => (),
                         }
                     }
                 }
@@ -294,6 +308,12 @@ impl CopyParser {
         self.delimiter.unwrap_or('\t')
     }
 
+    /// Each shard's output starts with a header: the CSV/text `HEADER` line
+    /// or the binary file header.
+    pub fn headers(&self) -> bool {
+        self.headers
+    }
+
     /// Split CopyData (F) messages into multiple CopyData (F) messages
     /// with shard numbers.
     pub fn shard(&mut self, data: &[CopyData]) -> Result<Vec<CopyRow>, Error> {
@@ -456,6 +476,27 @@ mod test {
         assert_eq!(sharded[0].message().data(), b"\"1\",\"2\"\n");
     }
 
+    #[test]
+    fn test_copy_to_headers() {
+        for (query, headers) in [
+            ("COPY sharded TO STDOUT", false),
+            ("COPY sharded TO STDOUT CSV HEADER", true),
+            (
+                "COPY (SELECT * FROM sharded) TO STDOUT (FORMAT csv, HEADER)",
+                true,
+            ),
+            (
+                "COPY (SELECT * FROM sharded) TO STDOUT (FORMAT csv, HEADER false)",
+                false,
+            ),
+            ("COPY sharded TO STDOUT (FORMAT binary)", true),
+        ] {
+            let copy = parse(query);
+            let copy = CopyParser::new(&copy, &Cluster::default()).unwrap();
+            assert_eq!(copy.headers(), headers, "{}", query);
+        }
+    }
+
     #[test]
     fn test_copy_csv_stream() {
         let copy_data = CopyData::new(b"id,value\n1,test\n6,test6\n");
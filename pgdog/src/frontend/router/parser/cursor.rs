@@ -0,0 +1,57 @@
+//! Cursors opened with `DECLARE ... WITH HOLD` and closed with `CLOSE`.
+//!
+//! Cursors declared without `WITH HOLD` are closed when the transaction ends,
+//! and the transaction keeps its server connection anyway. `WITH HOLD` cursors
+//! stay open after `COMMIT`, so the client needs to keep its server connection
+//! until it closes them.
+
+#[cfg(not(feature = "new_parser"))]
+use pg_query::NodeEnum;
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::Node;
+
+/// `CURSOR_OPT_HOLD` from Postgres' `parsenodes.h`.
+const CURSOR_OPT_HOLD: i32 = 0x0020;
+
+/// Cursor opened or closed by a statement.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Cursor {
+    /// `DECLARE ... WITH HOLD`.
+    Hold(String),
+    /// `CLOSE`, `None` for `CLOSE ALL`.
+    Close(Option<String>),
+}
+
+impl Cursor {
+    /// Get the cursor opened or closed by the statement, if any.
+    #[cfg(feature = "new_parser")]
+    pub fn from_node(node: Node<'_>) -> Option<Self> {
+        match node {
+            Node::DeclareCursorStmt(stmt) if stmt.options & CURSOR_OPT_HOLD != 0 => {
+                stmt.portalname().map(|name| Self::Hold(name.to_owned()))
+            }
+            Node::ClosePortalStmt(stmt) => Some(Self::Close(stmt.portalname().map(str::to_owned))),
+            _ => None,
+        }
+    }
+
+    cfg_select! {
+        not(feature = "new_parser") => {
+            /// Get the cursor opened or closed by the statement, if any.
+            pub fn from_node(node: &Option<NodeEnum>) -> Option<Self> {
+                match node {
+                    Some(NodeEnum::DeclareCursorStmt(stmt))
+                        if stmt.options & CURSOR_OPT_HOLD != 0 =>
+                    {
+                        Some(Self::Hold(stmt.portalname.clone()))
+                    }
+                    Some(NodeEnum::ClosePortalStmt(stmt)) => Some(Self::Close(
+                        (!stmt.portalname.is_empty()).then(|| stmt.portalname.clone()),
+                    )),
+                    _ => None,
+                }
+            }
+        }
+        _ => {}
+    }
+}
@@ -104,4 +104,10 @@ pub enum Error {
 
     #[error("multi-statement queries cannot mix SET with other commands")]
     MultiStatementMixedSet,
+
+    #[error("split_in_lists is not supported by the new query parser")]
+    InListSplitUnsupported,
+
+    #[error("shard of the parent row of a \"{}\" row is unknown", .0.table)]
+    ParentRowUnknown(Box<sharding::relationships::ParentRow>),
 }
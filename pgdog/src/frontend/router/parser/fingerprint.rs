@@ -0,0 +1,96 @@
+//! Query fingerprints.
+
+use std::{cell::OnceCell, sync::OnceLock};
+
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::normalize::normalize;
+
+use super::Error;
+
+/// Get the query fingerprint, computed by pg_query from the parse tree.
+/// Queries that only differ in their constants, comments or formatting
+/// have the same fingerprint.
+#[cfg(not(feature = "new_parser"))]
+pub fn fingerprint(query: &str) -> Result<String, Error> {
+    Ok(pg_query::fingerprint(query)?.hex)
+}
+
+/// Get the query fingerprint. The parser doesn't fingerprint queries, so
+/// we deparse the query with its constants replaced by parameters instead.
+/// Queries that only differ in their constants, comments or formatting
+/// have the same fingerprint.
+#[cfg(feature = "new_parser")]
+pub fn fingerprint(query: &str) -> Result<String, Error> {
+    let ast = pg_raw_parse::parse(&normalize(query)?)?;
+    Ok(pg_raw_parse::deparse_stmts(&*ast.into_inner())?)
+}
+
+/// Query with its fingerprint, computed the first time it's needed,
+/// so everything matching queries by fingerprint parses it only once.
+#[derive(Debug)]
+pub struct LazyFingerprint<'a> {
+    query: &'a str,
+    fingerprint: OnceCell<Option<String>>,
+    /// Fingerprint kept with the cached AST, shared by all requests
+    /// running the same query.
+    cached: Option<&'a OnceLock<Option<String>>>,
+}
+
+impl<'a> LazyFingerprint<'a> {
+    pub fn new(query: &'a str) -> Self {
+        Self {
+            query,
+            fingerprint: OnceCell::new(),
+            cached: None,
+        }
+    }
+
+    /// Use the fingerprint kept with the query's AST.
+    pub fn cached(query: &'a str, fingerprint: &'a OnceLock<Option<String>>) -> Self {
+        Self {
+            cached: Some(fingerprint),
+            ..Self::new(query)
+        }
+    }
+
+    /// Query text.
+    pub fn query(&self) -> &'a str {
+        self.query
+    }
+
+    /// Query fingerprint, `None` if the query can't be parsed.
+    pub fn fingerprint(&self) -> Option<&str> {
+        let init = || fingerprint(self.query).ok();
+        let fingerprint = match self.cached {
+            Some(cached) => cached.get_or_init(init),
+            None => self.fingerprint.get_or_init(init),
+        };
+        fingerprint.as_deref()
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_fingerprint() {
+        let a = fingerprint("SELECT * FROM report WHERE id = 1").unwrap();
+        let b = fingerprint("/* app: reports */ SELECT * FROM report WHERE id = 25").unwrap();
+        let c = fingerprint("SELECT * FROM report WHERE user_id = 1").unwrap();
+        let d = fingerprint("select *\n  from report\n where id = 3 -- by id").unwrap();
+
+        assert_eq!(a, b);
+        assert_ne!(a, c);
+        assert_eq!(a, d);
+
+        let lazy = LazyFingerprint::new("SELECT * FROM report WHERE id = 2");
+        assert_eq!(lazy.fingerprint(), Some(a.as_str()));
+        assert!(LazyFingerprint::new("SELEKT 1").fingerprint().is_none());
+
+        let cached = OnceLock::new();
+        let lazy = LazyFingerprint::cached("SELECT * FROM report WHERE id = 3", &cached);
+        assert_eq!(lazy.fingerprint(), Some(a.as_str()));
+        assert_eq!(cached.get(), Some(&Some(a.clone())));
+    }
+}
@@ -3,7 +3,30 @@ use pg_query::{Node, NodeEnum, protobuf};
 #[cfg(feature = "new_parser")]
 use pg_raw_parse::{Node, nodes};
 
-const WRITE_ONLY: &[&str] = &["nextval", "setval"];
+/// Volatile functions that write, or otherwise can't run on a replica.
+/// `SELECT` queries calling them go to the primary.
+const WRITE_ONLY: &[&str] = &[
+    // Sequences. currval() and lastval() read what nextval() returned.
+    "nextval",
+    "setval",
+    "currval",
+    "lastval",
+    // Transaction IDs are only assigned on the primary.
+    "txid_current",
+    "pg_current_xact_id",
+    "pg_notify",
+    // Large objects.
+    "lo_create",
+    "lo_creat",
+    "lo_import",
+    "lo_from_bytea",
+    "lo_put",
+    "lo_unlink",
+    // WAL.
+    "pg_switch_wal",
+    "pg_create_restore_point",
+    "pg_logical_emit_message",
+];
 
 const CROSS_SHARD: &[(Option<&str>, &str)] = &[(Some("pgdog"), "install_sharded_sequence")];
 
@@ -13,6 +36,7 @@ pub(crate) struct FunctionBehavior {
     pub(crate) cross_shard: bool,
 }
 
+#[derive(Debug, Clone, Copy)]
 pub(crate) struct Function<'a> {
     pub(crate) name: &'a str,
     pub(crate) schema: Option<&'a str>,
@@ -166,6 +190,21 @@ mod test {
         }
     }
 
+    #[test]
+    fn test_write_function() {
+        for query in [
+            "SELECT nextval('users_id_seq')",
+            "SELECT currval('users_id_seq')",
+            "SELECT pg_notify('jobs', 'hello')",
+            "SELECT txid_current()",
+            "SELECT lo_unlink(1234)",
+        ] {
+            first_func(query, |func| assert!(func.behavior().writes, "{}", query));
+        }
+
+        first_func("SELECT now()", |func| assert!(!func.behavior().writes));
+    }
+
     #[test]
     fn test_cross_shard_function() {
         first_func(
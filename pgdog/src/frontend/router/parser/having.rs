@@ -0,0 +1,465 @@
+//! HAVING clause of a cross-shard SELECT.
+//!
+//! Each shard only sees part of a group, so filtering groups with HAVING
+//! on the shards would drop groups that match once their partial aggregates
+//! are combined. Instead, PgDog removes HAVING from cross-shard queries and
+//! evaluates it after merging rows from all shards.
+//!
+//! Only comparisons between aggregates present in the target list and numeric
+//! constants, joined with AND, are supported, e.g., `HAVING COUNT(*) > 5 AND SUM(x) < 100`.
+//! Queries with other HAVING clauses are sent to shards unchanged.
+
+#[cfg(feature = "new_parser")]
+use itertools::Itertools;
+#[cfg(not(feature = "new_parser"))]
+use pg_query::{
+    NodeEnum,
+    protobuf::{AExprKind, BoolExprType, FuncCall, Node, SelectStmt, String as PgQueryString},
+};
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::{Node, nodes};
+use pgdog_postgres_types::Datum;
+
+#[cfg(feature = "new_parser")]
+use super::Function;
+use super::{Aggregate, Value};
+
+/// Comparison operator.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum HavingOp {
+    Eq,
+    NotEq,
+    Lt,
+    LtEq,
+    Gt,
+    GtEq,
+}
+
+impl HavingOp {
+    fn parse(op: &str) -> Option<Self> {
+        Some(match op {
+            "=" => Self::Eq,
+            "<>" | "!=" => Self::NotEq,
+            "<" => Self::Lt,
+            "<=" => Self::LtEq,
+            ">" => Self::Gt,
+            ">=" => Self::GtEq,
+            _ => return None,
+        })
+    }
+
+    /// Operator with swapped operands, e.g., `5 < COUNT(*)` is `COUNT(*) > 5`.
+    fn flip(self) -> Self {
+        match self {
+            Self::Lt => Self::Gt,
+            Self::LtEq => Self::GtEq,
+            Self::Gt => Self::Lt,
+            Self::GtEq => Self::LtEq,
+            op => op,
+        }
+    }
+}
+
+/// Comparison between an aggregate and a constant.
+#[derive(Debug, Clone, PartialEq)]
+pub struct HavingCondition {
+    column: usize,
+    op: HavingOp,
+    value: f64,
+}
+
+impl HavingCondition {
+    pub fn new(column: usize, op: HavingOp, value: f64) -> Self {
+        Self { column, op, value }
+    }
+
+    /// Position of the aggregate in the result set.
+    pub fn column(&self) -> usize {
+        self.column
+    }
+
+    /// Check that the aggregate value matches the condition.
+    /// NULL never matches, same as in Postgres.
+    pub fn matches(&self, datum: &Datum) -> bool {
+        let value = match datum {
+            Datum::Bigint(value) => *value as f64,
+            Datum::Integer(value) => *value as f64,
+            Datum::SmallInt(value) => *value as f64,
+            Datum::Float(value) => value.0 as f64,
+            Datum::Double(value) => value.0,
+            Datum::Numeric(value) => match value.to_f64() {
+                Some(value) => value,
+                None => return false,
+            },
+            _ => return false,
+        };
+
+        match self.op {
+            HavingOp::Eq => value == self.value,
+            HavingOp::NotEq => value != self.value,
+            HavingOp::Lt => value < self.value,
+            HavingOp::LtEq => value <= self.value,
+            HavingOp::Gt => value > self.value,
+            HavingOp::GtEq => value >= self.value,
+        }
+    }
+}
+
+/// HAVING clause evaluated by PgDog.
+#[derive(Debug, Clone, PartialEq, Default)]
+pub struct Having {
+    conditions: Vec<HavingCondition>,
+}
+
+/// Aggregate function call, used to find which target
+/// the HAVING clause is referring to.
+#[derive(Debug, PartialEq)]
+struct Call<'a> {
+    name: &'a str,
+    star: bool,
+    distinct: bool,
+    args: Vec<Vec<&'a str>>,
+}
+
+impl Having {
+    pub fn new(conditions: Vec<HavingCondition>) -> Self {
+        Self { conditions }
+    }
+
+    /// Parse the HAVING clause. Returns `None` if the query doesn't have one
+    /// or PgDog can't evaluate it.
+    #[cfg(feature = "new_parser")]
+    pub(crate) fn parse(stmt: &nodes::SelectStmt, aggregate: &Aggregate) -> Option<Self> {
+        let targets = aggregate
+            .targets()
+            .iter()
+            .filter_map(|target| {
+                let node = stmt.target_list().iter().nth(target.column())?;
+                let call = Call::new(Function::extract_func_call(node.val())?)?;
+                Some((target.column(), call))
+            })
+            .collect::<Vec<_>>();
+
+        let mut conditions = vec![];
+        Self::conditions_from(stmt.having_clause(), &targets, &mut conditions)?;
+
+        if conditions.is_empty() {
+            None
+        } else {
+            Some(Self { conditions })
+        }
+    }
+
+    #[cfg(feature = "new_parser")]
+    fn conditions_from(
+        node: Node<'_>,
+        targets: &[(usize, Call<'_>)],
+        conditions: &mut Vec<HavingCondition>,
+    ) -> Option<()> {
+        match node {
+            Node::None => Some(()),
+
+            Node::BoolExpr(expr) if expr.boolop == nodes::BoolExprType::AND_EXPR => {
+                for arg in expr.args().iter() {
+                    Self::conditions_from(arg, targets, conditions)?;
+                }
+                Some(())
+            }
+
+            Node::A_Expr(expr) if expr.kind == nodes::A_Expr_Kind::AEXPR_OP => {
+                let op = HavingOp::parse(expr.name().iter().exactly_one().ok()?.as_str()?)?;
+
+                let (func, constant, op) = match (expr.lexpr(), expr.rexpr()) {
+                    (Node::FuncCall(func), constant) => (func, constant, op),
+                    (constant, Node::FuncCall(func)) => (func, constant, op.flip()),
+                    _ => return None,
+                };
+
+                let call = Call::new(func)?;
+                let column = targets
+                    .iter()
+                    .find(|(_, target)| *target == call)
+                    .map(|(column, _)| *column)?;
+
+                conditions.push(HavingCondition {
+                    column,
+                    op,
+                    value: numeric(Value::try_from(constant).ok()?)?,
+                });
+                Some(())
+            }
+
+            _ => None,
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    pub(crate) fn parse(stmt: &SelectStmt, aggregate: &Aggregate) -> Option<Self> {
+        let targets = aggregate
+            .targets()
+            .iter()
+            .filter_map(|target| {
+                let node = stmt.target_list.get(target.column())?;
+                let call = Call::new(Self::func_call(node)?)?;
+                Some((target.column(), call))
+            })
+            .collect::<Vec<_>>();
+
+        let mut conditions = vec![];
+        Self::conditions_from(stmt.having_clause.as_deref()?, &targets, &mut conditions)?;
+
+        if conditions.is_empty() {
+            None
+        } else {
+            Some(Self { conditions })
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn func_call(node: &Node) -> Option<&FuncCall> {
+        match node.node.as_ref()? {
+            NodeEnum::FuncCall(func) => Some(func),
+            NodeEnum::ResTarget(res) => Self::func_call(res.val.as_deref()?),
+            NodeEnum::TypeCast(cast) => Self::func_call(cast.arg.as_deref()?),
+            _ => None,
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn conditions_from<'a>(
+        node: &'a Node,
+        targets: &[(usize, Call<'a>)],
+        conditions: &mut Vec<HavingCondition>,
+    ) -> Option<()> {
+        match node.node.as_ref()? {
+            NodeEnum::BoolExpr(expr) if expr.boolop() == BoolExprType::AndExpr => {
+                for arg in &expr.args {
+                    Self::conditions_from(arg, targets, conditions)?;
+                }
+                Some(())
+            }
+
+            NodeEnum::AExpr(expr) if expr.kind() == AExprKind::AexprOp => {
+                let op = match expr.name.as_slice() {
+                    [
+                        Node {
+                            node: Some(NodeEnum::String(PgQueryString { sval })),
+                        },
+                    ] => HavingOp::parse(sval)?,
+                    _ => return None,
+                };
+
+                let left = expr.lexpr.as_deref()?;
+                let right = expr.rexpr.as_deref()?;
+
+                let (func, constant, op) = match (&left.node, &right.node) {
+                    (Some(NodeEnum::FuncCall(func)), _) => (func, &right.node, op),
+                    (_, Some(NodeEnum::FuncCall(func))) => (func, &left.node, op.flip()),
+                    _ => return None,
+                };
+
+                let call = Call::new(func)?;
+                let column = targets
+                    .iter()
+                    .find(|(_, target)| *target == call)
+                    .map(|(column, _)| *column)?;
+
+                conditions.push(HavingCondition {
+                    column,
+                    op,
+                    value: numeric(Value::try_from(constant).ok()?)?,
+                });
+                Some(())
+            }
+
+            _ => None,
+        }
+    }
+
+    /// Conditions, all of which have to match.
+    pub fn conditions(&self) -> &[HavingCondition] {
+        &self.conditions
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.conditions.is_empty()
+    }
+}
+
+impl<'a> Call<'a> {
+    #[cfg(feature = "new_parser")]
+    fn new(func: &'a nodes::FuncCall) -> Option<Self> {
+        let name = func.funcname().iter().filter_map(Node::as_str).last()?;
+        let args = func
+            .args()
+            .iter()
+            .map(|arg| match arg {
+                Node::ColumnRef(column) => {
+                    Some(column.fields().iter().filter_map(Node::as_str).collect())
+                }
+                _ => None,
+            })
+            .collect::<Option<Vec<_>>>()?;
+
+        Some(Self {
+            name,
+            star: func.agg_star,
+            distinct: func.agg_distinct,
+            args,
+        })
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn new(func: &'a FuncCall) -> Option<Self> {
+        let name = func
+            .funcname
+            .iter()
+            .filter_map(|node| match node.node.as_ref() {
+                Some(NodeEnum::String(PgQueryString { sval })) => Some(sval.as_str()),
+                _ => None,
+            })
+            .last()?;
+        let args = func
+            .args
+            .iter()
+            .map(|arg| match arg.node.as_ref() {
+                Some(NodeEnum::ColumnRef(column)) => Some(
+                    column
+                        .fields
+                        .iter()
+                        .filter_map(|field| match field.node.as_ref() {
+                            Some(NodeEnum::String(PgQueryString { sval })) => Some(sval.as_str()),
+                            _ => None,
+                        })
+                        .collect(),
+                ),
+                _ => None,
+            })
+            .collect::<Option<Vec<_>>>()?;
+
+        Some(Self {
+            name,
+            star: func.agg_star,
+            distinct: func.agg_distinct,
+            args,
+        })
+    }
+}
+
+fn numeric(value: Value<'_>) -> Option<f64> {
+    match value {
+        Value::Integer(value) => Some(value as f64),
+        Value::Float(value) => Some(value),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+    #[cfg(feature = "new_parser")]
+    use pg_raw_parse::{Owned, make};
+    use pgdog_postgres_types::Double;
+
+    #[cfg(feature = "new_parser")]
+    fn parse(stmt: &str) -> Option<Having> {
+        let stmt: Owned<nodes::SelectStmt> =
+            match pg_raw_parse::parse(stmt).unwrap().stmts().next().unwrap() {
+                Node::SelectStmt(stmt) => make::owned(|mem| mem.make_unique(stmt)),
+                _ => panic!("not a select"),
+            };
+        let aggregate = Aggregate::parse(&stmt, &Default::default());
+        Having::parse(&stmt, &aggregate)
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn parse(stmt: &str) -> Option<Having> {
+        let stmt = pg_query::parse(stmt)
+            .unwrap()
+            .protobuf
+            .stmts
+            .remove(0)
+            .stmt
+            .unwrap();
+        let stmt = match stmt.node.unwrap() {
+            NodeEnum::SelectStmt(stmt) => *stmt,
+            _ => panic!("not a select"),
+        };
+        let aggregate = Aggregate::parse(&stmt, &Default::default());
+        Having::parse(&stmt, &aggregate)
+    }
+
+    #[test]
+    fn test_having_count() {
+        let having =
+            parse("SELECT tenant_id, COUNT(*) FROM orders GROUP BY tenant_id HAVING COUNT(*) > 5")
+                .unwrap();
+        assert_eq!(
+            having.conditions(),
+            &[HavingCondition {
+                column: 1,
+                op: HavingOp::Gt,
+                value: 5.0,
+            }]
+        );
+
+        let condition = &having.conditions()[0];
+        assert!(condition.matches(&Datum::Bigint(6)));
+        assert!(!condition.matches(&Datum::Bigint(5)));
+        assert!(!condition.matches(&Datum::Null));
+    }
+
+    #[test]
+    fn test_having_and() {
+        let having = parse(
+            "SELECT tenant_id, SUM(amount), AVG(amount) FROM orders GROUP BY 1 \
+             HAVING SUM(amount) >= 100 AND 10.5 > AVG(amount)",
+        )
+        .unwrap();
+        assert_eq!(
+            having.conditions(),
+            &[
+                HavingCondition {
+                    column: 1,
+                    op: HavingOp::GtEq,
+                    value: 100.0,
+                },
+                HavingCondition {
+                    column: 2,
+                    op: HavingOp::Lt,
+                    value: 10.5,
+                },
+            ]
+        );
+        assert!(having.conditions()[1].matches(&Datum::Double(Double(10.0))));
+    }
+
+    #[test]
+    fn test_having_unsupported() {
+        // No HAVING.
+        assert!(parse("SELECT tenant_id, COUNT(*) FROM orders GROUP BY 1").is_none());
+        // Aggregate not in the target list.
+        assert!(
+            parse("SELECT tenant_id, COUNT(*) FROM orders GROUP BY 1 HAVING SUM(amount) > 5")
+                .is_none()
+        );
+        // OR can't be split.
+        assert!(
+            parse(
+                "SELECT tenant_id, COUNT(*) FROM orders GROUP BY 1 \
+                 HAVING COUNT(*) > 5 OR COUNT(*) < 2"
+            )
+            .is_none()
+        );
+        // Parameters aren't known until Bind.
+        assert!(
+            parse("SELECT tenant_id, COUNT(*) FROM orders GROUP BY 1 HAVING COUNT(*) > $1")
+                .is_none()
+        );
+        // Different arguments.
+        assert!(
+            parse("SELECT tenant_id, SUM(amount) FROM orders GROUP BY 1 HAVING SUM(tax) > 5")
+                .is_none()
+        );
+    }
+}
@@ -0,0 +1,363 @@
+//! Split large `IN` lists on the sharding key by shard.
+//!
+//! A query like `SELECT * FROM users WHERE id IN (1, 2, 3, ...)` is sent
+//! to every shard that owns at least one of the values. Instead of sending the
+//! full list everywhere, we rewrite it for each shard so it only contains
+//! the values that shard owns.
+use std::collections::BTreeMap;
+
+#[cfg(not(feature = "new_parser"))]
+use pg_query::{
+    Node, NodeEnum,
+    protobuf::{AExpr, AExprKind, BoolExprType, ParseResult, SelectStmt, SetOperation},
+};
+#[cfg(not(feature = "new_parser"))]
+use pgdog_config::QueryParserEngine;
+
+use super::{Ast, Error};
+#[cfg(not(feature = "new_parser"))]
+use super::{Column, Shard, Table, Value};
+#[cfg(not(feature = "new_parser"))]
+use crate::frontend::router::sharding::ContextBuilder;
+use crate::{backend::ShardingSchema, net::Query};
+
+/// Per-shard versions of a query with a large `IN` list
+/// on the sharding key.
+#[derive(Debug, Clone, PartialEq, Default)]
+pub struct InListSplit {
+    queries: BTreeMap<usize, Query>,
+}
+
+impl InListSplit {
+    /// Get the query for the shard, if any.
+    pub fn query(&self, shard: usize) -> Option<&Query> {
+        self.queries.get(&shard)
+    }
+
+    /// Shards that received at least one value from the list.
+    pub fn shards(&self) -> Vec<usize> {
+        self.queries.keys().copied().collect()
+    }
+
+    /// Split the `IN` list of a `SELECT` statement by shard.
+    ///
+    /// Returns `None` if the statement doesn't qualify, i.e. it's not
+    /// a single-table `SELECT`, the list isn't on the sharding key,
+    /// contains anything other than literals, or is shorter than
+    /// the configured threshold.
+    #[cfg(not(feature = "new_parser"))]
+    pub(crate) fn new(ast: &Ast, schema: &ShardingSchema) -> Result<Option<Self>, Error> {
+        let threshold = schema.rewrite.split_in_lists;
+
+        if threshold == 0 || schema.shards < 2 {
+            return Ok(None);
+        }
+
+        let parse_result = &ast.parse_result().protobuf;
+
+        let Some(select) = Self::select(parse_result) else {
+            return Ok(None);
+        };
+
+        let table = match select
+            .from_clause
+            .first()
+            .and_then(|node| node.node.as_ref())
+        {
+            Some(NodeEnum::RangeVar(range_var)) if select.from_clause.len() == 1 => {
+                Table::from(range_var)
+            }
+            _ => return Ok(None),
+        };
+
+        let Some((position, expr)) = select.where_clause.as_deref().and_then(Self::find) else {
+            return Ok(None);
+        };
+
+        let (Some(lexpr), Some(rexpr)) = (expr.lexpr.as_deref(), expr.rexpr.as_deref()) else {
+            return Ok(None);
+        };
+
+        let Some(NodeEnum::List(list)) = rexpr.node.as_ref() else {
+            return Ok(None);
+        };
+
+        if list.items.len() < threshold {
+            return Ok(None);
+        }
+
+        let Ok(column) = Column::try_from(&lexpr.node) else {
+            return Ok(None);
+        };
+
+        // Column must belong to the table we're selecting from.
+        if let Some(name) = column.table
+            && !table.name_match(name)
+        {
+            return Ok(None);
+        }
+
+        let column = Column {
+            name: column.name,
+            table: Some(table.name),
+            schema: table.schema,
+        };
+
+        let Some(sharded_table) = schema.tables().get_table(column) else {
+            return Ok(None);
+        };
+
+        let mut values: BTreeMap<usize, Vec<Node>> = BTreeMap::new();
+
+        for item in &list.items {
+            let context = ContextBuilder::new(sharded_table);
+            let context = match Value::try_from(&item.node) {
+                Ok(Value::String(value)) => context.data(value),
+                Ok(Value::Integer(value)) => context.data(value),
+                _ => return Ok(None),
+            };
+
+            match context.shards(schema.shards).build()?.apply()? {
+                Shard::Direct(shard) => values.entry(shard).or_default().push(item.clone()),
+                _ => return Ok(None),
+            }
+        }
+
+        let mut queries = BTreeMap::new();
+
+        for (shard, items) in values {
+            let mut stmt = parse_result.clone();
+
+            if let Some(NodeEnum::List(list)) = Self::select_mut(&mut stmt)
+                .and_then(|select| select.where_clause.as_deref_mut())
+                .and_then(|node| Self::find_mut(node, position))
+                .and_then(|expr| expr.rexpr.as_deref_mut())
+                .and_then(|node| node.node.as_mut())
+            {
+                list.items = items;
+            }
+
+            let query = match schema.query_parser_engine {
+                QueryParserEngine::PgQueryProtobuf => stmt.deparse(),
+                QueryParserEngine::PgQueryRaw => stmt.deparse_raw(),
+            }?;
+
+            queries.insert(shard, Query::new(query));
+        }
+
+        Ok(Some(Self { queries }))
+    }
+
+    /// The new parser doesn't support splitting `IN` lists yet,
+    /// so tell the user instead of ignoring the setting.
+    #[cfg(feature = "new_parser")]
+    pub(crate) fn new(_ast: &Ast, schema: &ShardingSchema) -> Result<Option<Self>, Error> {
+        if schema.rewrite.split_in_lists == 0 || schema.shards < 2 {
+            Ok(None)
+        } else {
+            Err(Error::InListSplitUnsupported)
+        }
+    }
+
+    /// Get the `SELECT` statement, if it's the only statement in the query.
+    #[cfg(not(feature = "new_parser"))]
+    fn select(parse_result: &ParseResult) -> Option<&SelectStmt> {
+        if parse_result.stmts.len() != 1 {
+            return None;
+        }
+
+        match parse_result.stmts.first()?.stmt.as_ref()?.node.as_ref()? {
+            NodeEnum::SelectStmt(select)
+                if select.op() == SetOperation::SetopNone && select.with_clause.is_none() =>
+            {
+                Some(select)
+            }
+            _ => None,
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn select_mut(parse_result: &mut ParseResult) -> Option<&mut SelectStmt> {
+        match parse_result
+            .stmts
+            .first_mut()?
+            .stmt
+            .as_mut()?
+            .node
+            .as_mut()?
+        {
+            NodeEnum::SelectStmt(select) => Some(select),
+            _ => None,
+        }
+    }
+
+    /// Find the `IN` list in the `WHERE` clause. It has to be either
+    /// the whole clause or one of the top-level `AND` arguments, otherwise
+    /// removing values from it could change the result.
+    ///
+    /// Returns the position of the argument in the `AND` expression, if any,
+    /// so we can find it again in a copy of the statement.
+    #[cfg(not(feature = "new_parser"))]
+    fn find(node: &Node) -> Option<(Option<usize>, &AExpr)> {
+        match node.node.as_ref()? {
+            NodeEnum::AExpr(expr) if Self::is_in_list(expr) => Some((None, expr.as_ref())),
+            NodeEnum::BoolExpr(expr) if expr.boolop() == BoolExprType::AndExpr => expr
+                .args
+                .iter()
+                .enumerate()
+                .find_map(|(position, arg)| match arg.node.as_ref() {
+                    Some(NodeEnum::AExpr(expr)) if Self::is_in_list(expr) => {
+                        Some((Some(position), expr.as_ref()))
+                    }
+                    _ => None,
+                }),
+            _ => None,
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn find_mut(node: &mut Node, position: Option<usize>) -> Option<&mut AExpr> {
+        match (node.node.as_mut()?, position) {
+            (NodeEnum::AExpr(expr), None) => Some(expr.as_mut()),
+            (NodeEnum::BoolExpr(expr), Some(position)) => {
+                match expr.args.get_mut(position)?.node.as_mut()? {
+                    NodeEnum::AExpr(expr) => Some(expr.as_mut()),
+                    _ => None,
+                }
+            }
+            _ => None,
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn is_in_list(expr: &AExpr) -> bool {
+        expr.kind() == AExprKind::AexprIn
+            && matches!(
+                expr.name.first().and_then(|node| node.node.as_ref()),
+                Some(NodeEnum::String(string)) if string.sval == "="
+            )
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pgdog_config::Rewrite;
+
+    use super::*;
+    use crate::{backend::ShardedTables, frontend::router::sharding::ShardedTable};
+
+    fn schema(split_in_lists: usize) -> ShardingSchema {
+        ShardingSchema {
+            shards: 2,
+            tables: ShardedTables::new(
+                vec![ShardedTable {
+                    name: Some("users".into()),
+                    column: "id".into(),
+                    ..Default::default()
+                }],
+                vec![],
+                false,
+                Default::default(),
+            ),
+            rewrite: Rewrite {
+                split_in_lists,
+                ..Default::default()
+            },
+            ..Default::default()
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    fn split(query: &str, schema: &ShardingSchema) -> Option<InListSplit> {
+        let ast = Ast::from_parse_result(pg_query::parse(query).unwrap());
+        InListSplit::new(&ast, schema).unwrap()
+    }
+
+    #[test]
+    #[cfg(not(feature = "new_parser"))]
+    fn test_split_in_list() {
+        let schema = schema(4);
+        let values = (1..=20).map(|v| v.to_string()).collect::<Vec<_>>();
+        let query = format!(
+            "SELECT * FROM users WHERE active = true AND id IN ({})",
+            values.join(", ")
+        );
+
+        let split = split(&query, &schema).unwrap();
+        assert_eq!(split.shards(), vec![0, 1]);
+
+        let mut total = 0;
+        for shard in split.shards() {
+            let query = split.query(shard).unwrap().query().to_owned();
+            assert!(query.starts_with("SELECT * FROM users WHERE active = true AND id IN ("));
+
+            let ast = Ast::from_parse_result(pg_query::parse(&query).unwrap());
+            let Some(NodeEnum::List(list)) = InListSplit::select(&ast.parse_result().protobuf)
+                .and_then(|select| select.where_clause.as_deref())
+                .and_then(InListSplit::find)
+                .and_then(|(_, expr)| expr.rexpr.as_deref())
+                .and_then(|node| node.node.as_ref())
+            else {
+                panic!("IN list not found in {}", query);
+            };
+            total += list.items.len();
+        }
+
+        assert_eq!(total, values.len());
+    }
+
+    #[test]
+    #[cfg(not(feature = "new_parser"))]
+    fn test_split_in_list_skipped() {
+        let schema = schema(4);
+
+        // Below threshold.
+        assert!(split("SELECT * FROM users WHERE id IN (1, 2, 3)", &schema).is_none());
+
+        // Not the sharding key.
+        assert!(
+            split(
+                "SELECT * FROM users WHERE email IN ('a', 'b', 'c', 'd')",
+                &schema
+            )
+            .is_none()
+        );
+
+        // OR can't be split.
+        assert!(
+            split(
+                "SELECT * FROM users WHERE id IN (1, 2, 3, 4) OR active = true",
+                &schema
+            )
+            .is_none()
+        );
+
+        // Parameters aren't supported.
+        assert!(split("SELECT * FROM users WHERE id IN (1, 2, 3, $1)", &schema).is_none());
+
+        // Disabled.
+        assert!(
+            split(
+                "SELECT * FROM users WHERE id IN (1, 2, 3, 4)",
+                &self::schema(0)
+            )
+            .is_none()
+        );
+    }
+
+    #[test]
+    #[cfg(feature = "new_parser")]
+    fn test_split_in_list_unsupported() {
+        let ast = Ast::new_record(
+            "SELECT * FROM users WHERE id IN (1, 2, 3, 4)",
+            pgdog_config::QueryParserEngine::PgQueryProtobuf,
+        )
+        .unwrap();
+
+        assert!(matches!(
+            InListSplit::new(&ast, &schema(4)),
+            Err(Error::InListSplitUnsupported)
+        ));
+        assert!(InListSplit::new(&ast, &schema(0)).unwrap().is_none());
+    }
+}
@@ -9,23 +9,30 @@ pub mod comment;
 pub mod context;
 pub mod copy;
 mod csv;
+pub mod cursor;
 mod distinct;
 pub mod ee;
 pub mod error;
 pub mod explain_trace;
+pub mod fingerprint;
 mod from_clause;
 pub mod function;
+pub mod having;
+pub mod in_list;
 pub mod key;
 mod limit;
 pub mod multi_tenant;
 pub mod order_by;
+pub mod primary_only;
 pub mod query;
+pub mod query_routing;
 pub mod rewrite;
 pub mod route;
 pub mod schema;
 mod sequence;
 pub mod statement;
 mod table;
+pub mod temporary;
 pub(crate) mod util;
 pub mod value;
 mod where_clause;
@@ -34,24 +41,31 @@ pub use aggregate::{Aggregate, AggregateFunction, AggregateTarget};
 pub use binary::BinaryStream;
 pub use cache::{Ast, AstContext, AstQuery, Cache};
 pub(crate) use column::Column;
-pub use command::{Command, SetParam};
+pub use command::{Command, DiscardTarget, SetParam};
 pub(crate) use comment::parse_edge_comment;
 pub use context::QueryParserContext;
 pub use copy::{CopyFormat, CopyParser};
 pub(crate) use csv::CsvStream;
+pub use cursor::Cursor;
 pub(crate) use distinct::{Distinct, DistinctBy, DistinctColumn};
 pub use error::Error;
+pub use fingerprint::{LazyFingerprint, fingerprint};
 pub(crate) use from_clause::FromClause;
 use function::Function;
+pub use having::{Having, HavingCondition, HavingOp};
+pub use in_list::InListSplit;
 pub use key::Key;
 pub(crate) use limit::{Limit, LimitClause};
 pub use order_by::OrderBy;
+pub use primary_only::PrimaryOnly;
 pub use query::QueryParser;
+pub use query_routing::{QueryRoutingRules, QueryRoutingTarget};
 pub use rewrite::{Assignment, AssignmentValue, StatementRewrite, StatementRewriteContext};
 pub use route::{Route, Shard, ShardWithPriority, ShardsWithPriority};
 pub use schema::Schema;
 pub(crate) use sequence::Sequence;
 pub use statement::{SchemaLookupContext, StatementParser};
 pub(crate) use table::Table;
+pub use temporary::creates_temporary;
 pub use value::Value;
 pub(crate) use where_clause::{TablesSource, WhereClause};
@@ -0,0 +1,54 @@
+//! Functions and tables that always route to the primary.
+
+use std::collections::HashSet;
+
+use super::{Table, function::Function};
+
+/// Functions and tables whose `SELECT`s always go to the primary.
+///
+/// Built-in functions that write, e.g. `nextval()`, are known to us.
+/// The parser can't know that `SELECT enqueue_job(...)` writes,
+/// so users can tell us. They can also let built-in functions
+/// run on replicas. Names match unqualified or as `schema.name`.
+#[derive(Debug, Clone, Default)]
+pub struct PrimaryOnly {
+    functions: HashSet<String>,
+    tables: HashSet<String>,
+    replica_functions: HashSet<String>,
+}
+
+impl PrimaryOnly {
+    /// Create from the configured function and table names.
+    pub fn new(functions: &[String], tables: &[String], replica_functions: &[String]) -> Self {
+        Self {
+            functions: functions.iter().cloned().collect(),
+            tables: tables.iter().cloned().collect(),
+            replica_functions: replica_functions.iter().cloned().collect(),
+        }
+    }
+
+    /// Nothing is configured.
+    pub fn is_empty(&self) -> bool {
+        self.functions.is_empty() && self.tables.is_empty() && self.replica_functions.is_empty()
+    }
+
+    /// The function must run on the primary.
+    pub(crate) fn function(&self, function: &Function<'_>) -> bool {
+        if Self::contains(&self.functions, function.schema, function.name) {
+            return true;
+        }
+
+        function.behavior().writes
+            && !Self::contains(&self.replica_functions, function.schema, function.name)
+    }
+
+    /// The table must be read from the primary.
+    pub(crate) fn table(&self, table: &Table<'_>) -> bool {
+        Self::contains(&self.tables, table.schema, table.name)
+    }
+
+    fn contains(names: &HashSet<String>, schema: Option<&str>, name: &str) -> bool {
+        names.contains(name)
+            || schema.is_some_and(|schema| names.contains(&format!("{}.{}", schema, name)))
+    }
+}
@@ -26,14 +26,18 @@ impl QueryParser {
         use nodes::ObjectType;
         let mut shard = Shard::All;
         let mut schema_changed = false;
+        // Transactional DDL, which can run inside two-phase commit.
+        let mut ddl = false;
 
         match node {
             Node::CreateStmt(stmt) => {
+                ddl = true;
                 schema_changed = true;
                 shard = Self::shard_ddl_table(stmt.relation(), schema)?.unwrap_or(Shard::All);
             }
 
             Node::CreateSeqStmt(stmt) => {
+                ddl = true;
                 shard = Self::shard_ddl_table(stmt.sequence(), schema)?.unwrap_or(Shard::All);
             }
 
@@ -42,6 +46,7 @@ impl QueryParser {
                 | ObjectType::OBJECT_INDEX
                 | ObjectType::OBJECT_VIEW
                 | ObjectType::OBJECT_SEQUENCE => {
+                    ddl = !stmt.concurrent;
                     let table = Table::try_from(stmt.objects()).ok();
                     if let Some(table) = table
                         && let Some(schema) = schema.schemas.get(table.schema())
@@ -52,6 +57,7 @@ impl QueryParser {
                 }
 
                 ObjectType::OBJECT_SCHEMA => {
+                    ddl = true;
                     if let Some(string) = stmt.objects().first().and_then(Node::as_str)
                         && let Some(schema) = schema.schemas.get(Some(string.into()))
                     {
@@ -63,21 +69,25 @@ impl QueryParser {
             },
 
             Node::CreateSchemaStmt(stmt) => {
+                ddl = true;
                 if let Some(schema) = schema.schemas.get(stmt.schemaname().map(Into::into)) {
                     shard = schema.shard().into();
                 }
             }
 
             Node::IndexStmt(stmt) => {
+                ddl = !stmt.concurrent;
                 shard = Self::shard_ddl_table(stmt.relation(), schema)?.unwrap_or(Shard::All);
             }
 
             Node::ViewStmt(stmt) => {
+                ddl = true;
                 schema_changed = true;
                 shard = Self::shard_ddl_table(stmt.view(), schema)?.unwrap_or(Shard::All);
             }
 
             Node::CreateTableAsStmt(stmt) => {
+                ddl = true;
                 schema_changed = true;
                 if let Some(into) = stmt.into() {
                     shard = Self::shard_ddl_table(into.rel(), schema)?.unwrap_or(Shard::All);
@@ -85,6 +95,7 @@ impl QueryParser {
             }
 
             Node::CreateFunctionStmt(stmt) => {
+                ddl = true;
                 let table = Table::try_from(stmt.funcname()).ok();
                 if let Some(table) = table {
                     shard = schema
@@ -96,6 +107,7 @@ impl QueryParser {
             }
 
             Node::CreateEnumStmt(stmt) => {
+                ddl = true;
                 let table = Table::try_from(stmt.type_name()).ok();
                 if let Some(table) = table {
                     shard = schema
@@ -107,19 +119,23 @@ impl QueryParser {
             }
 
             Node::AlterOwnerStmt(stmt) => {
+                ddl = true;
                 shard = Self::shard_ddl_table(stmt.relation(), schema)?.unwrap_or(Shard::All);
             }
 
             Node::RenameStmt(stmt) => {
+                ddl = true;
                 shard = Self::shard_ddl_table(stmt.relation(), schema)?.unwrap_or(Shard::All);
             }
 
             Node::AlterTableStmt(stmt) => {
+                ddl = true;
                 schema_changed = true;
                 shard = Self::shard_ddl_table(stmt.relation(), schema)?.unwrap_or(Shard::All);
             }
 
             Node::AlterSeqStmt(stmt) => {
+                ddl = true;
                 shard = Self::shard_ddl_table(stmt.sequence(), schema)?.unwrap_or(Shard::All);
             }
 
@@ -205,7 +221,9 @@ impl QueryParser {
         calculator.push(ShardWithPriority::new_table(shard));
 
         Ok(Command::Query(
-            Route::write(calculator.shard()).with_schema_changed(schema_changed),
+            Route::write(calculator.shard())
+                .with_schema_changed(schema_changed)
+                .with_ddl(ddl),
         ))
     }
 
@@ -218,14 +236,18 @@ impl QueryParser {
             ) -> Result<Command, Error> {
                 let mut shard = Shard::All;
                 let mut schema_changed = false;
+                // Transactional DDL, which can run inside two-phase commit.
+                let mut ddl = false;
 
                 match node {
                     Some(NodeEnum::CreateStmt(stmt)) => {
+                        ddl = true;
                         schema_changed = true;
                         shard = Self::shard_ddl_table(&stmt.relation, schema)?.unwrap_or(Shard::All);
                     }
 
                     Some(NodeEnum::CreateSeqStmt(stmt)) => {
+                        ddl = true;
                         shard = Self::shard_ddl_table(&stmt.sequence, schema)?.unwrap_or(Shard::All);
                     }
 
@@ -234,6 +256,7 @@ impl QueryParser {
                         | ObjectType::ObjectIndex
                         | ObjectType::ObjectView
                         | ObjectType::ObjectSequence => {
+                            ddl = !stmt.concurrent;
                             let table = Table::try_from(&stmt.objects).ok();
                             if let Some(table) = table
                                 && let Some(schema) = schema.schemas.get(table.schema())
@@ -244,6 +267,7 @@ impl QueryParser {
                         }
 
                         ObjectType::ObjectSchema => {
+                            ddl = true;
                             if let Some(PgNode {
                                 node: Some(NodeEnum::String(string)),
                             }) = stmt.objects.first()
@@ -257,21 +281,25 @@ impl QueryParser {
                     },
 
                     Some(NodeEnum::CreateSchemaStmt(stmt)) => {
+                        ddl = true;
                         if let Some(schema) = schema.schemas.get(Some(stmt.schemaname.as_str().into())) {
                             shard = schema.shard().into();
                         }
                     }
 
                     Some(NodeEnum::IndexStmt(stmt)) => {
+                        ddl = !stmt.concurrent;
                         shard = Self::shard_ddl_table(&stmt.relation, schema)?.unwrap_or(Shard::All);
                     }
 
                     Some(NodeEnum::ViewStmt(stmt)) => {
+                        ddl = true;
                         schema_changed = true;
                         shard = Self::shard_ddl_table(&stmt.view, schema)?.unwrap_or(Shard::All);
                     }
 
                     Some(NodeEnum::CreateTableAsStmt(stmt)) => {
+                        ddl = true;
                         schema_changed = true;
                         if let Some(into) = &stmt.into {
                             shard = Self::shard_ddl_table(&into.rel, schema)?.unwrap_or(Shard::All);
@@ -279,6 +307,7 @@ impl QueryParser {
                     }
 
                     Some(NodeEnum::CreateFunctionStmt(stmt)) => {
+                        ddl = true;
                         let table = Table::try_from(&stmt.funcname).ok();
                         if let Some(table) = table {
                             shard = schema
@@ -290,6 +319,7 @@ impl QueryParser {
                     }
 
                     Some(NodeEnum::CreateEnumStmt(stmt)) => {
+                        ddl = true;
                         let table = Table::try_from(&stmt.type_name).ok();
                         if let Some(table) = table {
                             shard = schema
@@ -301,19 +331,23 @@ impl QueryParser {
                     }
 
                     Some(NodeEnum::AlterOwnerStmt(stmt)) => {
+                        ddl = true;
                         shard = Self::shard_ddl_table(&stmt.relation, schema)?.unwrap_or(Shard::All);
                     }
 
                     Some(NodeEnum::RenameStmt(stmt)) => {
+                        ddl = true;
                         shard = Self::shard_ddl_table(&stmt.relation, schema)?.unwrap_or(Shard::All);
                     }
 
                     Some(NodeEnum::AlterTableStmt(stmt)) => {
+                        ddl = true;
                         schema_changed = true;
                         shard = Self::shard_ddl_table(&stmt.relation, schema)?.unwrap_or(Shard::All);
                     }
 
                     Some(NodeEnum::AlterSeqStmt(stmt)) => {
+                        ddl = true;
                         shard = Self::shard_ddl_table(&stmt.sequence, schema)?.unwrap_or(Shard::All);
                     }
 
@@ -409,7 +443,9 @@ impl QueryParser {
                 calculator.push(ShardWithPriority::new_table(shard));
 
                 Ok(Command::Query(
-                    Route::write(calculator.shard()).with_schema_changed(schema_changed),
+                    Route::write(calculator.shard())
+                        .with_schema_changed(schema_changed)
+                        .with_ddl(ddl),
                 ))
             }
         }
@@ -460,18 +496,21 @@ mod test {
     fn test_schema() -> ShardingSchema {
         ShardingSchema {
             shards: 2,
-            schemas: ShardedSchemas::new(vec![
-                ShardedSchema {
-                    name: Some("shard_0".into()),
-                    shard: 0,
-                    ..Default::default()
-                },
-                ShardedSchema {
-                    name: Some("shard_1".into()),
-                    shard: 1,
-                    ..Default::default()
-                },
-            ]),
+            schemas: ShardedSchemas::new(
+                vec![
+                    ShardedSchema {
+                        name: Some("shard_0".into()),
+                        shard: 0,
+                        ..Default::default()
+                    },
+                    ShardedSchema {
+                        name: Some("shard_1".into()),
+                        shard: 1,
+                        ..Default::default()
+                    },
+                ],
+                2,
+            ),
             ..Default::default()
         }
     }
@@ -812,4 +851,26 @@ mod test {
         assert_eq!(command.route().shard(), &Shard::All);
         assert!(!command.route().is_schema_changed());
     }
+
+    #[test]
+    fn test_transactional_ddl() {
+        for query in [
+            "CREATE TABLE public.test (id BIGINT)",
+            "ALTER TABLE public.test ADD COLUMN new_col INT",
+            "CREATE INDEX test_idx ON public.test (id)",
+            "DROP INDEX public.test_idx",
+            "CREATE SCHEMA new_schema",
+        ] {
+            assert!(parse_stmt(query).route().is_ddl(), "{}", query);
+        }
+
+        for query in [
+            "CREATE INDEX CONCURRENTLY test_idx ON public.test (id)",
+            "DROP INDEX CONCURRENTLY public.test_idx",
+            "VACUUM public.test",
+            "TRUNCATE public.test",
+        ] {
+            assert!(!parse_stmt(query).route().is_ddl(), "{}", query);
+        }
+    }
 }
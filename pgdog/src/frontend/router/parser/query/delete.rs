@@ -23,6 +23,7 @@ impl QueryParser {
             context.router_context.parameter_hints.search_path,
         );
         let omnisharded = parser.is_all_omnisharded();
+        let omnisharded_two_pc = parser.is_omnisharded_two_pc();
 
         let shard = parser.shard()?;
 
@@ -52,7 +53,9 @@ impl QueryParser {
         }
 
         Ok(Command::Query(
-            Route::write(context.shards_calculator.shard()).with_omnisharded(omnisharded),
+            Route::write(context.shards_calculator.shard())
+                .with_omnisharded(omnisharded)
+                .with_omnisharded_two_pc(omnisharded_two_pc),
         ))
     }
 }
@@ -0,0 +1,54 @@
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::nodes::DiscardMode::*;
+
+use super::*;
+
+impl QueryParser {
+    /// Handle DISCARD. It's answered by us unless the server
+    /// has session state that it would reset.
+    ///
+    /// # Arguments
+    ///
+    /// * `stmt`: DISCARD statement.
+    /// * `context`: Query parser context.
+    ///
+    #[cfg(feature = "new_parser")]
+    pub(super) fn discard(
+        &mut self,
+        stmt: &nodes::DiscardStmt,
+        context: &mut QueryParserContext,
+    ) -> Result<Command, Error> {
+        let target = match stmt.target {
+            DISCARD_ALL => DiscardTarget::All,
+            DISCARD_TEMP => DiscardTarget::Temp,
+            _ => DiscardTarget::Other,
+        };
+
+        Ok(Command::Discard {
+            extended: !context.query()?.simple(),
+            target,
+        })
+    }
+
+    cfg_select! {
+        not(feature = "new_parser") => {
+            pub(super) fn discard(
+                &mut self,
+                stmt: &DiscardStmt,
+                context: &mut QueryParserContext,
+            ) -> Result<Command, Error> {
+                let target = match stmt.target() {
+                    DiscardMode::DiscardAll => DiscardTarget::All,
+                    DiscardMode::DiscardTemp => DiscardTarget::Temp,
+                    _ => DiscardTarget::Other,
+                };
+
+                Ok(Command::Discard {
+                    extended: !context.query()?.simple(),
+                    target,
+                })
+            }
+        }
+        _ => {}
+    }
+}
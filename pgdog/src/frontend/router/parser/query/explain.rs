@@ -11,8 +11,9 @@ impl QueryParser {
         context: &mut QueryParserContext,
     ) -> Result<Command, Error> {
         let query = stmt.query();
+        self.explain_route = Self::explain_route(stmt);
 
-        if context.expanded_explain() {
+        if context.expanded_explain() || self.explain_route {
             if self.explain_recorder.is_none() {
                 self.explain_recorder = Some(ExplainRecorder::new());
             }
@@ -46,6 +47,14 @@ impl QueryParser {
         }
     }
 
+    /// `EXPLAIN (ROUTE)` returns our routing decision instead of the query plan.
+    #[cfg(feature = "new_parser")]
+    pub(super) fn explain_route(stmt: &nodes::ExplainStmt) -> bool {
+        stmt.options()
+            .into_iter()
+            .any(|option| matches!(option, Node::DefElem(elem) if elem.defname() == Some("route")))
+    }
+
     cfg_select! {
         not(feature = "new_parser") => {
             pub(super) fn explain(
@@ -56,8 +65,9 @@ impl QueryParser {
             ) -> Result<Command, Error> {
                 let query = stmt.query.as_ref().ok_or(Error::EmptyQuery)?;
                 let node = query.node.as_ref().ok_or(Error::EmptyQuery)?;
+                self.explain_route = Self::explain_route(stmt);
 
-                if context.expanded_explain() {
+                if context.expanded_explain() || self.explain_route {
                     if self.explain_recorder.is_none() {
                         self.explain_recorder = Some(ExplainRecorder::new());
                     }
@@ -103,6 +113,13 @@ impl QueryParser {
                     }
                 }
             }
+
+            /// `EXPLAIN (ROUTE)` returns our routing decision instead of the query plan.
+            pub(super) fn explain_route(stmt: &ExplainStmt) -> bool {
+                stmt.options.iter().any(|option| {
+                    matches!(option.node, Some(NodeEnum::DefElem(ref elem)) if elem.defname == "route")
+                })
+            }
         }
         _ => {}
     }
@@ -135,6 +152,14 @@ mod tests {
 
     // Helper function to route a plain SQL statement and return its `Route`.
     fn route(sql: &str) -> Route {
+        match command(sql) {
+            Command::Query(route) => route,
+            _ => panic!("expected Query command"),
+        }
+    }
+
+    // Helper function to parse a plain SQL statement and return its `Command`.
+    fn command(sql: &str) -> Command {
         enable_expanded_explain();
         let cluster = Cluster::new_test(&config());
         let mut stmts = PreparedStatements::default();
@@ -148,14 +173,19 @@ mod tests {
 
         let ctx = RouterContext::new(&buffer, &cluster, &params, None, Sticky::new()).unwrap();
 
-        match QueryParser::default().parse(ctx).unwrap().clone() {
+        QueryParser::default().parse(ctx).unwrap()
+    }
+
+    // Helper function to route a parameterized SQL statement and return its `Route`.
+    fn route_parameterized(sql: &str, values: &[&[u8]]) -> Route {
+        match command_parameterized(sql, values) {
             Command::Query(route) => route,
             _ => panic!("expected Query command"),
         }
     }
 
-    // Helper function to route a parameterized SQL statement and return its `Route`.
-    fn route_parameterized(sql: &str, values: &[&[u8]]) -> Route {
+    // Helper function to parse a parameterized SQL statement and return its `Command`.
+    fn command_parameterized(sql: &str, values: &[&[u8]]) -> Command {
         enable_expanded_explain();
         let parse_msg = Parse::new_anonymous(sql);
         let parameters = values
@@ -180,10 +210,7 @@ mod tests {
 
         let ctx = RouterContext::new(&buffer, &cluster, &params, None, Sticky::new()).unwrap();
 
-        match QueryParser::default().parse(ctx).unwrap().clone() {
-            Command::Query(route) => route,
-            _ => panic!("expected Query command"),
-        }
+        QueryParser::default().parse(ctx).unwrap()
     }
 
     #[test]
@@ -379,4 +406,41 @@ mod tests {
         assert!(matches!(r.shard(), Shard::Direct(_)));
         assert!(r.is_write());
     }
+
+    #[test]
+    fn test_explain_route() {
+        let Command::ExplainRoute(trace) =
+            command("EXPLAIN (ROUTE) SELECT * FROM sharded WHERE id = 1")
+        else {
+            panic!("expected ExplainRoute command");
+        };
+        assert!(matches!(trace.summary().shard, Shard::Direct(_)));
+        assert!(trace.summary().read);
+        let lines = trace.render_lines();
+        assert!(lines.iter().any(|line| line.contains("role=replica")));
+        assert!(lines.iter().any(|line| line.contains("using constant 1")));
+
+        let Command::ExplainRoute(trace) =
+            command("EXPLAIN (ROUTE) INSERT INTO sharded (id, email) VALUES (1, 'a@a.com')")
+        else {
+            panic!("expected ExplainRoute command");
+        };
+        assert!(matches!(trace.summary().shard, Shard::Direct(_)));
+        assert!(!trace.summary().read);
+
+        let Command::ExplainRoute(trace) = command("EXPLAIN (ROUTE) DELETE FROM sharded") else {
+            panic!("expected ExplainRoute command");
+        };
+        assert_eq!(trace.summary().shard, Shard::All);
+    }
+
+    #[test]
+    fn test_explain_route_extended() {
+        // Only supported with the simple protocol.
+        let r = route_parameterized(
+            "EXPLAIN (ROUTE) SELECT * FROM sharded WHERE id = $1",
+            &[b"1"],
+        );
+        assert!(matches!(r.shard(), Shard::Direct(_)));
+    }
 }
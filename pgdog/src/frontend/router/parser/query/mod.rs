@@ -25,6 +25,7 @@ use super::{
 };
 mod ddl;
 mod delete;
+mod discard;
 mod explain;
 mod plugins;
 mod select;
@@ -68,6 +69,8 @@ pub struct QueryParser {
     plugin_output: PluginOutput,
     // Record explain output.
     explain_recorder: Option<ExplainRecorder>,
+    // Return the routing decision without running the query.
+    explain_route: bool,
 }
 
 impl QueryParser {
@@ -77,11 +80,13 @@ impl QueryParser {
 
     #[cfg(feature = "new_parser")]
     fn ensure_explain_recorder(&mut self, node: Node<'_>, context: &QueryParserContext) {
-        if self.explain_recorder.is_some() || !context.expanded_explain() {
+        if self.explain_recorder.is_some() {
             return;
         }
 
-        if matches!(node, Node::ExplainStmt(_)) {
+        if let Node::ExplainStmt(stmt) = node
+            && (context.expanded_explain() || Self::explain_route(stmt))
+        {
             self.explain_recorder = Some(ExplainRecorder::new());
         }
     }
@@ -93,13 +98,14 @@ impl QueryParser {
                 ast: &pg_query::ParseResult,
                 context: &QueryParserContext,
             ) {
-                if self.explain_recorder.is_some() || !context.expanded_explain() {
+                if self.explain_recorder.is_some() {
                     return;
                 }
 
                 if let Some(root) = ast.protobuf.stmts.first()
-                    && let Some(node) = root.stmt.as_ref().and_then(|stmt| stmt.node.as_ref())
-                    && matches!(node, NodeEnum::ExplainStmt(_))
+                    && let Some(NodeEnum::ExplainStmt(stmt)) =
+                        root.stmt.as_ref().and_then(|stmt| stmt.node.as_ref())
+                    && (context.expanded_explain() || Self::explain_route(stmt))
                 {
                     self.explain_recorder = Some(ExplainRecorder::new());
                 }
@@ -121,11 +127,16 @@ impl QueryParser {
     /// Parse a query and return a command.
     pub fn parse(&mut self, context: RouterContext) -> Result<Command, Error> {
         let mut context = QueryParserContext::new(context)?;
+        self.explain_route = false;
 
         let mut command = if context.query().is_ok() {
             self.write_override = context.write_override();
 
-            self.query(&mut context)?
+            if context.shadow {
+                self.shadow(&mut context)?
+            } else {
+                self.query(&mut context)?
+            }
         } else {
             Command::default()
         };
@@ -142,12 +153,24 @@ impl QueryParser {
                 }
 
                 route.set_search_path_driven(context.shards_calculator.is_search_path());
+                route.set_pool(context.pool());
+
+                // Send each shard only the IN list values it owns.
+                if matches!(route.shard(), Shard::Multi(_))
+                    && !context.router_context.extended
+                    && let Some(ref ast) = context.router_context.ast
+                    && let Some(split) = InListSplit::new(ast, &context.sharding_schema)?
+                {
+                    route.set_in_list_split(split);
+                }
 
                 if let Some(role) = context.router_context.sticky.role {
                     match role {
                         Role::Primary => route.set_read(false),
                         _ => route.set_read(true),
                     }
+                } else if context.read_only_transaction() && context.role() != Some(Role::Primary) {
+                    route.set_read(true);
                 }
             }
 
@@ -158,9 +181,47 @@ impl QueryParser {
 
         self.attach_explain(&mut command);
 
+        // EXPLAIN (ROUTE) is answered by us, the query doesn't go anywhere.
+        // Only supported with the simple protocol.
+        if self.explain_route
+            && !context.router_context.extended
+            && let Command::Query(route) = &mut command
+            && let Some(trace) = route.take_explain()
+        {
+            command = Command::ExplainRoute(trace);
+        }
+
         Ok(command)
     }
 
+    /// Run the parser and record its decision, but route the query
+    /// the same way we would with the parser disabled.
+    fn shadow(&mut self, context: &mut QueryParserContext) -> Result<Command, Error> {
+        let shards_calculator = context.shards_calculator.clone();
+        let parsed = self.query(context);
+        context.shards_calculator = shards_calculator;
+
+        let route = Self::query_parser_bypass(context).ok_or(Error::QueryParserRequired)?;
+
+        if let Some(ref statement) = context.router_context.ast {
+            match parsed {
+                Ok(Command::Query(parsed)) => {
+                    // With one shard, every query ends up on it anyway.
+                    let same_shard = context.shards == 1 || parsed.shard() == route.shard();
+                    statement
+                        .update_shadow_stats(same_shard && parsed.is_read() == route.is_read());
+                }
+                Ok(_) => (),
+                Err(err) => {
+                    debug!("shadow parser error: {}", err);
+                    statement.update_shadow_stats(false);
+                }
+            }
+        }
+
+        Ok(Command::Query(route))
+    }
+
     /// Bypass the query parser if we can.
     fn query_parser_bypass(context: &mut QueryParserContext) -> Option<Route> {
         let shard = context.shards_calculator.shard();
@@ -187,8 +248,9 @@ impl QueryParser {
         else if context.write_only {
             Some(Route::write(shard))
 
-        // The role is specified in the connection parameter (pgdog.role).
-        } else if let Some(role) = context.router_context.parameter_hints.compute_role() {
+        // The role is specified by a query routing rule or
+        // in the connection parameter (pgdog.role).
+        } else if let Some(role) = context.role() {
             Some(match role {
                 Role::Replica => Route::read(shard),
                 Role::Primary | Role::Auto => Route::write(shard),
@@ -328,8 +390,10 @@ impl QueryParser {
                 return self.show(stmt, context);
             }
 
-            Node::DeallocateStmt(_) => {
-                return Ok(Command::Deallocate);
+            Node::DeallocateStmt(stmt) => {
+                return Ok(Command::Deallocate {
+                    name: stmt.name().map(str::to_owned),
+                });
             }
 
             Node::SelectStmt(stmt) => self.select(&statement, stmt, context),
@@ -384,15 +448,19 @@ impl QueryParser {
 
             Node::ExplainStmt(stmt) => self.explain(&statement, stmt, context),
 
-            Node::DiscardStmt { .. } => {
-                return Ok(Command::Discard {
-                    extended: !context.query()?.simple(),
-                });
-            }
+            Node::DiscardStmt(stmt) => return self.discard(stmt, context),
 
             node => self.ddl(node, context),
         }?;
 
+        // WITH HOLD cursors and temporary objects outlive the transaction.
+        if let Command::Query(ref mut route) = command {
+            if let Some(cursor) = Cursor::from_node(root.stmt()) {
+                route.set_cursor(cursor);
+            }
+            route.set_temporary(creates_temporary(root.stmt()));
+        }
+
         // e.g. Parse, Describe, Flush-style flow.
         if !context.router_context.executable
             && let Command::Query(ref query) = command
@@ -600,8 +668,10 @@ impl QueryParser {
                     // SHOW statements -> return immediately.
                     Some(NodeEnum::VariableShowStmt(ref stmt)) => return self.show(stmt, context),
                     // DEALLOCATE statements -> return immediately.
-                    Some(NodeEnum::DeallocateStmt(_)) => {
-                        return Ok(Command::Deallocate);
+                    Some(NodeEnum::DeallocateStmt(ref stmt)) => {
+                        return Ok(Command::Deallocate {
+                            name: (!stmt.name.is_empty()).then(|| stmt.name.clone()),
+                        });
                     }
                     // SELECT statements.
                     Some(NodeEnum::SelectStmt(ref stmt)) => self.select(
@@ -665,15 +735,21 @@ impl QueryParser {
 
                     Some(NodeEnum::ExplainStmt(ref stmt)) => self.explain(&statement, stmt, context),
 
-                    Some(NodeEnum::DiscardStmt { .. }) => {
-                        return Ok(Command::Discard {
-                            extended: !context.query()?.simple(),
-                        });
+                    Some(NodeEnum::DiscardStmt(ref stmt)) => {
+                        return self.discard(stmt, context);
                     }
 
                     _ => self.ddl(&root.node, context),
                 }?;
 
+                // WITH HOLD cursors and temporary objects outlive the transaction.
+                if let Command::Query(ref mut route) = command {
+                    if let Some(cursor) = Cursor::from_node(&root.node) {
+                        route.set_cursor(cursor);
+                    }
+                    route.set_temporary(creates_temporary(&root.node));
+                }
+
                 // e.g. Parse, Describe, Flush-style flow.
                 if !context.router_context.executable
                     && let Command::Query(ref query) = command
@@ -804,9 +880,9 @@ impl QueryParser {
             context
                 .shards_calculator
                 .push(ShardWithPriority::new_table(Shard::All));
-            Ok(Command::Query(Route::read(
-                context.shards_calculator.shard(),
-            )))
+            Ok(Command::Query(
+                Route::read(context.shards_calculator.shard()).with_copy_headers(parser.headers()),
+            ))
         } else {
             Ok(Command::Copy(Box::new(parser)))
         }
@@ -849,9 +925,10 @@ impl QueryParser {
                     context
                         .shards_calculator
                         .push(ShardWithPriority::new_table(Shard::All));
-                    Ok(Command::Query(Route::read(
-                        context.shards_calculator.shard(),
-                    )))
+                    Ok(Command::Query(
+                        Route::read(context.shards_calculator.shard())
+                            .with_copy_headers(parser.headers()),
+                    ))
                 } else {
                     Ok(Command::Copy(Box::new(parser)))
                 }
@@ -895,8 +972,10 @@ impl QueryParser {
             context.router_context.parameter_hints.search_path,
         );
         let omnisharded = parser.is_all_omnisharded();
+        let omnisharded_two_pc = parser.is_omnisharded_two_pc();
 
         let shard = parser.shard()?.unwrap_or(Shard::All);
+        let parent_rows = parser.take_parent_rows();
 
         context.shards_calculator.push(if is_sharded {
             ShardWithPriority::new_table(shard.clone())
@@ -919,7 +998,10 @@ impl QueryParser {
         }
 
         Ok(Command::Query(
-            Route::write(shard).with_omnisharded(omnisharded),
+            Route::write(shard)
+                .with_omnisharded(omnisharded)
+                .with_omnisharded_two_pc(omnisharded_two_pc)
+                .with_parent_rows(parent_rows),
         ))
     }
 }
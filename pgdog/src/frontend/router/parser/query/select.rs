@@ -30,8 +30,7 @@ impl QueryParser {
         context: &mut QueryParserContext,
     ) -> Result<Command, Error> {
         let mut cross_shard = false;
-        // Write overwrite because of conservative read/write split.
-        let mut writes = self.write_override;
+        let mut writes = false;
         walk::walk(stmt.into(), |node| match node {
             Node::CommonTableExpr(expr) => match expr.ctequery() {
                 Node::SelectStmt(_) => (),
@@ -43,7 +42,7 @@ impl QueryParser {
                     Function::from_strings(f.funcname().into_iter().filter_map(Node::as_str))
                 {
                     cross_shard = cross_shard || f.behavior().cross_shard;
-                    writes = writes || f.behavior().writes;
+                    writes = writes || context.primary_only.function(&f);
                 }
             }
             _ => (),
@@ -55,7 +54,7 @@ impl QueryParser {
                 .push(ShardWithPriority::new_override_cross_shard_function());
         }
 
-        let (advisory_locks, mut omnisharded) = {
+        let (advisory_locks, mut omnisharded, catalog_read, primary_only) = {
             let mut parser = StatementParser::from_select(
                 stmt.into(),
                 context.router_context.bind,
@@ -63,10 +62,20 @@ impl QueryParser {
                 None,
             );
 
-            (parser.extract_advisory_locks(), parser.is_all_omnisharded())
+            (
+                parser.extract_advisory_locks(),
+                parser.is_all_omnisharded(),
+                context.catalog_reads_on_replicas() && parser.is_all_system_catalogs(),
+                parser.is_primary_only(context.primary_only),
+            )
         };
 
-        let writes = writes || !advisory_locks.is_empty();
+        // Write overwrite because of conservative read/write split,
+        // unless it's a catalog read we can send to a replica.
+        let writes = writes
+            || primary_only
+            || (self.write_override && !catalog_read)
+            || !advisory_locks.is_empty();
 
         // Early return for any direct-to-shard queries.
         if context.shards_calculator.shard().is_direct() {
@@ -270,10 +279,9 @@ impl QueryParser {
                 let FunctionBehavior {
                     writes,
                     cross_shard,
-                } = Self::functions(stmt_old);
+                } = Self::functions(stmt_old, context.primary_only);
 
-                // Write overwrite because of conservative read/write split.
-                let writes = writes || self.write_override || cte_writes || has_locking;
+                let writes = writes || cte_writes || has_locking;
 
                 if cross_shard {
                     context
@@ -281,7 +289,7 @@ impl QueryParser {
                         .push(ShardWithPriority::new_override_cross_shard_function());
                 }
 
-                let (advisory_locks, mut omnisharded) = {
+                let (advisory_locks, mut omnisharded, catalog_read, primary_only) = {
                     let mut parser = StatementParser::from_select(
                         stmt_old,
                         context.router_context.bind,
@@ -289,10 +297,20 @@ impl QueryParser {
                         None,
                     );
 
-                    (parser.extract_advisory_locks(), parser.is_all_omnisharded())
+                    (
+                        parser.extract_advisory_locks(),
+                        parser.is_all_omnisharded(),
+                        context.catalog_reads_on_replicas() && parser.is_all_system_catalogs(),
+                        parser.is_primary_only(context.primary_only),
+                    )
                 };
 
-                let writes = writes || !advisory_locks.is_empty();
+                // Write overwrite because of conservative read/write split,
+                // unless it's a catalog read we can send to a replica.
+                let writes = writes
+                    || primary_only
+                    || (self.write_override && !catalog_read)
+                    || !advisory_locks.is_empty();
 
                 // Early return for any direct-to-shard queries.
                 if context.shards_calculator.shard().is_direct() {
@@ -654,15 +672,23 @@ impl QueryParser {
     /// # Arguments
     ///
     /// * `stmt`: SELECT statement from pg_query.
+    /// * `primary_only`: Functions that must run on the primary.
     ///
     #[cfg(not(feature = "new_parser"))]
-    fn functions(stmt: &SelectStmt) -> FunctionBehavior {
+    fn functions(stmt: &SelectStmt, primary_only: &PrimaryOnly) -> FunctionBehavior {
+        let mut behavior = FunctionBehavior::default();
+
         for target in &stmt.target_list {
             if let Ok(func) = Function::try_from(target) {
-                return func.behavior();
+                behavior.writes = behavior.writes || primary_only.function(&func);
+                behavior.cross_shard = behavior.cross_shard || func.behavior().cross_shard;
             }
         }
 
+        if behavior.writes {
+            return behavior;
+        }
+
         // Recurse into CTEs so a write-only function
         // nested inside a WITH clause still routes to the primary.
         if let Some(ref with_clause) = stmt.with_clause {
@@ -671,15 +697,18 @@ impl QueryParser {
                     && let Some(ref query) = expr.ctequery
                     && let Some(NodeEnum::SelectStmt(ref inner)) = query.node
                 {
-                    let behavior = Self::functions(inner);
-                    if behavior.writes {
-                        return behavior;
+                    let inner = Self::functions(inner, primary_only);
+                    if inner.writes {
+                        return FunctionBehavior {
+                            writes: true,
+                            cross_shard: behavior.cross_shard || inner.cross_shard,
+                        };
                     }
                 }
             }
         }
 
-        FunctionBehavior::default()
+        behavior
     }
 
     /// Recursively check for a locking clause (FOR UPDATE, FOR SHARE, etc.)
@@ -7,6 +7,10 @@ use std::string::String;
 impl QueryParser {
     /// Handle SELECT set_config('key', 'value', is_local)
     ///
+    /// The value and `is_local` can be bound parameters, e.g.
+    /// `set_config('app.tenant_id', $1, false)`, which is how drivers usually
+    /// send session labels used by row-level security policies.
+    ///
     /// If the function arguments are a form we cannot handle, we warn and
     /// pass through
     #[cfg(feature = "new_parser")]
@@ -15,7 +19,7 @@ impl QueryParser {
         fcall: &nodes::FuncCall,
         context: &QueryParserContext,
     ) -> Command {
-        if let Some(param) = parse_args(fcall) {
+        if let Some(param) = parse_args(fcall, context.router_context.bind) {
             Command::Set {
                 params: vec![param],
                 route: Route::write(context.shards_calculator.shard()),
@@ -31,7 +35,7 @@ impl QueryParser {
     cfg_select! {
         not(feature = "new_parser") => {
             pub(super) fn set_config(&mut self, fcall: &FuncCall, context: &QueryParserContext) -> Command {
-                if let Some(param) = parse_args(fcall) {
+                if let Some(param) = parse_args(fcall, context.router_context.bind) {
                     Command::Set {
                         params: vec![param],
                         route: Route::write(context.shards_calculator.shard()),
@@ -50,19 +54,19 @@ impl QueryParser {
 
 /// Returns None if the arguments could not be parsed
 #[cfg(feature = "new_parser")]
-fn parse_args(fcall: &nodes::FuncCall) -> Option<SetParam> {
+fn parse_args(fcall: &nodes::FuncCall, bind: Option<&Bind>) -> Option<SetParam> {
     let name = parse_config_name(fcall.args().first()?)?;
-    let value = parse_config_value(fcall.args().get(1)?)?;
-    let local = parse_is_local(fcall.args().get(2)?)?;
+    let value = parse_config_value(fcall.args().get(1)?, bind)?;
+    let local = parse_is_local(fcall.args().get(2)?, bind)?;
     Some(SetParam { name, value, local })
 }
 
 cfg_select! {
     not(feature = "new_parser") => {
-        fn parse_args(fcall: &FuncCall) -> Option<SetParam> {
+        fn parse_args(fcall: &FuncCall, bind: Option<&Bind>) -> Option<SetParam> {
             let name = parse_config_name(fcall.args.first()?)?;
-            let value = parse_config_value(fcall.args.get(1)?)?;
-            let local = parse_is_local(fcall.args.get(2)?)?;
+            let value = parse_config_value(fcall.args.get(1)?, bind)?;
+            let local = parse_is_local(fcall.args.get(2)?, bind)?;
             Some(SetParam { name, value, local })
         }
     }
@@ -95,7 +99,7 @@ fn parse_config_name(arg: &PgNode) -> Option<String> {
 /// Returns None if the value could not be parsed, Some(None) if the value
 /// is NULL, and Some if the value was successfully parsed
 #[cfg(feature = "new_parser")]
-fn parse_config_value(arg: Node<'_>) -> Option<Option<ParameterValue>> {
+fn parse_config_value(arg: Node<'_>, bind: Option<&Bind>) -> Option<Option<ParameterValue>> {
     match arg {
         Node::A_Const(c) => match c.val() {
             Some(value) => Some(Some(ParameterValue::String(
@@ -103,19 +107,21 @@ fn parse_config_value(arg: Node<'_>) -> Option<Option<ParameterValue>> {
             ))),
             None => Some(None),
         },
+        Node::ParamRef(param) => bound_config_value(bind?, param.number),
         _ => None,
     }
 }
 
 cfg_select! {
     not(feature = "new_parser") => {
-        fn parse_config_value(arg: &PgNode) -> Option<Option<ParameterValue>> {
+        fn parse_config_value(arg: &PgNode, bind: Option<&Bind>) -> Option<Option<ParameterValue>> {
             match &arg.node {
                 Some(NodeEnum::AConst(AConst {
                     val: Some(Val::Sval(PgString { sval })),
                     ..
                 })) => Some(Some(ParameterValue::String(sval.clone()))),
                 Some(NodeEnum::AConst(AConst { isnull: true, .. })) => Some(None),
+                Some(NodeEnum::ParamRef(param)) => bound_config_value(bind?, param.number),
                 // FIXME(sage): The function only takes text. Do we need to deal with
                 // other literals?
                 _ => None,
@@ -127,21 +133,23 @@ cfg_select! {
 
 /// Returns None if the node was not a constant boolean
 #[cfg(feature = "new_parser")]
-fn parse_is_local(arg: Node<'_>) -> Option<bool> {
+fn parse_is_local(arg: Node<'_>, bind: Option<&Bind>) -> Option<bool> {
     match arg {
         Node::A_Const(c) => c.val()?.bool_value(),
+        Node::ParamRef(param) => bound_is_local(bind?, param.number),
         _ => None,
     }
 }
 
 cfg_select! {
     not(feature = "new_parser") => {
-        fn parse_is_local(arg: &PgNode) -> Option<bool> {
+        fn parse_is_local(arg: &PgNode, bind: Option<&Bind>) -> Option<bool> {
             match &arg.node {
                 Some(NodeEnum::AConst(AConst {
                     val: Some(Val::Boolval(Boolean { boolval })),
                     ..
                 })) => Some(*boolval),
+                Some(NodeEnum::ParamRef(param)) => bound_is_local(bind?, param.number),
                 // Only constant strings can be handled for now
                 _ => None,
             }
@@ -149,3 +157,38 @@ cfg_select! {
     }
     _ => {}
 }
+
+/// Read the config value from a bound parameter. `set_config` only takes text,
+/// so the parameter is used as-is.
+fn bound_config_value(bind: &Bind, number: i32) -> Option<Option<ParameterValue>> {
+    let param = bind
+        .parameter(usize::try_from(number).ok()?.checked_sub(1)?)
+        .ok()??;
+
+    if param.is_null() {
+        Some(None)
+    } else {
+        param
+            .text()
+            .map(|value| Some(ParameterValue::String(value.to_owned())))
+    }
+}
+
+/// Read `is_local` from a bound parameter.
+fn bound_is_local(bind: &Bind, number: i32) -> Option<bool> {
+    let param = bind
+        .parameter(usize::try_from(number).ok()?.checked_sub(1)?)
+        .ok()??;
+
+    if param.is_null() {
+        return None;
+    }
+
+    param
+        .decode::<bool>()
+        .or_else(|| match param.text()?.trim().to_lowercase().as_str() {
+            "true" | "on" | "yes" | "1" => Some(true),
+            "false" | "off" | "no" | "0" => Some(false),
+            _ => None,
+        })
+}
@@ -30,6 +30,8 @@ pub mod test_explain;
 pub mod test_functions;
 pub mod test_insert;
 pub mod test_prefer_primary;
+pub mod test_primary_only;
+pub mod test_query_routing;
 pub mod test_rr;
 pub mod test_schema_sharding;
 pub mod test_search_path;
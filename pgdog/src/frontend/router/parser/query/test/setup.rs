@@ -1,6 +1,6 @@
 use std::ops::Deref;
 
-use pgdog_config::{ConfigAndUsers, ReadWriteSplit};
+use pgdog_config::{ConfigAndUsers, QueryRoutingRule, ReadWriteSplit};
 
 use crate::{
     backend::Cluster,
@@ -10,7 +10,7 @@ use crate::{
         client::{Sticky, TransactionType},
         router::{
             QueryParser,
-            parser::{AstContext, Cache, Error},
+            parser::{AstContext, Cache, Error, PrimaryOnly, QueryRoutingRules},
         },
     },
     net::{Parameters, ProtocolMessage, parameter::ParameterValue},
@@ -96,6 +96,12 @@ impl QueryParserTest {
         self
     }
 
+    /// Set the type of transaction we're in.
+    pub(crate) fn with_transaction(mut self, transaction: TransactionType) -> Self {
+        self.transaction = Some(transaction);
+        self
+    }
+
     /// Set the read/write strategy on the cluster.
     pub(crate) fn with_read_write_strategy(mut self, strategy: ReadWriteStrategy) -> Self {
         self.cluster.set_read_write_strategy(strategy);
@@ -108,6 +114,43 @@ impl QueryParserTest {
         self
     }
 
+    /// Route queries that only read system catalogs to replicas.
+    pub(crate) fn with_catalog_reads_on_replicas(mut self) -> Self {
+        self.cluster.set_catalog_reads_on_replicas(true);
+        self
+    }
+
+    /// Always route these functions and tables to the primary.
+    pub(crate) fn with_primary_only(mut self, functions: &[&str], tables: &[&str]) -> Self {
+        let names = |names: &[&str]| {
+            names
+                .iter()
+                .map(|name| name.to_string())
+                .collect::<Vec<_>>()
+        };
+        self.cluster
+            .set_primary_only(PrimaryOnly::new(&names(functions), &names(tables), &[]));
+        self
+    }
+
+    /// Allow these built-in functions that write to run on replicas.
+    pub(crate) fn with_replica_safe_functions(mut self, functions: &[&str]) -> Self {
+        let functions = functions
+            .iter()
+            .map(|name| name.to_string())
+            .collect::<Vec<_>>();
+        self.cluster
+            .set_primary_only(PrimaryOnly::new(&[], &[], &functions));
+        self
+    }
+
+    /// Route queries with these query routing rules.
+    pub(crate) fn with_query_routing_rules(mut self, rules: &[QueryRoutingRule]) -> Self {
+        self.cluster
+            .set_query_routing_rules(QueryRoutingRules::new(rules));
+        self
+    }
+
     /// Enable expanded explain for this test.
     pub(crate) fn with_expanded_explain(mut self) -> Self {
         let mut updated = config().deref().clone();
@@ -7,7 +7,7 @@ use pgdog_config::{QueryParserLevel, ReadWriteSplit};
 
 use crate::{
     config::config,
-    frontend::router::parser::{Error, Shard},
+    frontend::router::parser::{Cache, Error, Shard},
     net::Query,
 };
 
@@ -167,3 +167,32 @@ async fn test_sharded_no_hints() {
         assert!(matches!(result, Error::QueryParserRequired));
     }
 }
+
+#[tokio::test]
+async fn test_shadow() {
+    let mut config = (*config()).clone();
+    config.config.general.query_parser = QueryParserLevel::Shadow;
+    let mut test = QueryParserTest::new_single_shard(&config);
+
+    let read = "SELECT * FROM test_shadow WHERE id = 1";
+    let write = "INSERT INTO test_shadow (id) VALUES (1)";
+    let reads = "SELECT * FROM test_shadow WHERE id = 1; SELECT * FROM test_shadow WHERE id = 2";
+
+    for query in [read, write, reads] {
+        // Routed as if the parser was disabled.
+        let result = test.try_execute(vec![Query::new(query).into()]).unwrap();
+        assert!(result.route().is_write());
+        assert_eq!(result.route().shard(), &Shard::Direct(0));
+    }
+
+    let queries = Cache::queries();
+    let stats = |query: &str| *queries.get(query).unwrap().stats.lock();
+
+    // Parser would've sent the read to a replica.
+    assert_eq!(stats(read).shadow_mismatch, 1);
+    assert_eq!(stats(read).shadow_match, 0);
+    assert_eq!(stats(write).shadow_match, 1);
+    assert_eq!(stats(write).shadow_mismatch, 0);
+    // Each statement counts.
+    assert_eq!(stats(reads).shadow_mismatch, 2);
+}
@@ -55,3 +55,53 @@ fn test_prefer_primary_write_routes_to_primary() {
 
     assert!(command.route().is_write());
 }
+
+/// With `catalog_reads_on_replicas`, catalog-only reads go to replicas.
+#[test]
+fn test_prefer_primary_catalog_reads_on_replicas() {
+    let mut test = QueryParserTest::new()
+        .with_rw_split(ReadWriteSplit::PreferPrimary)
+        .with_catalog_reads_on_replicas();
+
+    for query in [
+        "SELECT oid, typname FROM pg_type",
+        "SELECT * FROM pg_catalog.pg_namespace n JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid",
+        "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public'",
+    ] {
+        let command = test.execute(vec![Query::new(query).into()]);
+        assert!(command.route().is_read(), "{}", query);
+    }
+
+    // Not only catalogs.
+    let command = test.execute(vec![
+        Query::new("SELECT * FROM users JOIN pg_class ON pg_class.relname = users.name").into(),
+    ]);
+    assert!(command.route().is_write());
+
+    // Locks.
+    let command = test.execute(vec![Query::new("SELECT * FROM pg_class FOR UPDATE").into()]);
+    assert!(command.route().is_write());
+}
+
+/// Catalog reads inside transactions stay on the primary.
+#[test]
+fn test_prefer_primary_catalog_reads_in_transaction() {
+    let mut test = QueryParserTest::new()
+        .with_rw_split(ReadWriteSplit::PreferPrimary)
+        .with_catalog_reads_on_replicas()
+        .in_transaction(true);
+
+    let command = test.execute(vec![Query::new("SELECT oid, typname FROM pg_type").into()]);
+
+    assert!(command.route().is_write());
+}
+
+/// Without `catalog_reads_on_replicas`, catalog reads go to the primary.
+#[test]
+fn test_prefer_primary_catalog_reads_disabled() {
+    let mut test = QueryParserTest::new().with_rw_split(ReadWriteSplit::PreferPrimary);
+
+    let command = test.execute(vec![Query::new("SELECT oid, typname FROM pg_type").into()]);
+
+    assert!(command.route().is_write());
+}
@@ -0,0 +1,76 @@
+use super::setup::*;
+
+#[test]
+fn test_primary_only_function() {
+    let mut test = QueryParserTest::new().with_primary_only(&["enqueue_job"], &[]);
+
+    for query in [
+        "SELECT enqueue_job('send_email', 1)",
+        "SELECT public.enqueue_job('send_email', 1)",
+        "SELECT * FROM enqueue_job('send_email', 1)",
+        "SELECT id FROM users WHERE id = 1 AND enqueue_job('send_email', id) IS NOT NULL",
+    ] {
+        let command = test.execute(vec![Query::new(query).into()]);
+        assert!(command.route().is_write(), "{}", query);
+    }
+
+    let command = test.execute(vec![Query::new("SELECT other_job('send_email', 1)").into()]);
+    assert!(command.route().is_read());
+}
+
+#[test]
+fn test_primary_only_function_schema() {
+    let mut test = QueryParserTest::new().with_primary_only(&["jobs.enqueue"], &[]);
+
+    let command = test.execute(vec![Query::new("SELECT jobs.enqueue(1)").into()]);
+    assert!(command.route().is_write());
+
+    let command = test.execute(vec![Query::new("SELECT enqueue(1)").into()]);
+    assert!(command.route().is_read());
+}
+
+#[test]
+fn test_primary_only_table() {
+    let mut test = QueryParserTest::new().with_primary_only(&[], &["balances"]);
+
+    for query in [
+        "SELECT * FROM balances WHERE user_id = 1",
+        "SELECT * FROM users JOIN balances ON balances.user_id = users.id",
+        "SELECT * FROM users WHERE id IN (SELECT user_id FROM balances)",
+    ] {
+        let command = test.execute(vec![Query::new(query).into()]);
+        assert!(command.route().is_write(), "{}", query);
+    }
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users").into()]);
+    assert!(command.route().is_read());
+}
+
+#[test]
+fn test_write_functions() {
+    let mut test = QueryParserTest::new();
+
+    for query in [
+        "SELECT nextval('users_id_seq')",
+        "SELECT * FROM nextval('users_id_seq')",
+        "SELECT now(), currval('users_id_seq')",
+        "SELECT id FROM users WHERE id = 1 AND pg_notify('jobs', 'hello') IS NOT NULL",
+    ] {
+        let command = test.execute(vec![Query::new(query).into()]);
+        assert!(command.route().is_write(), "{}", query);
+    }
+
+    let command = test.execute(vec![Query::new("SELECT now()").into()]);
+    assert!(command.route().is_read());
+}
+
+#[test]
+fn test_replica_safe_functions() {
+    let mut test = QueryParserTest::new().with_replica_safe_functions(&["currval"]);
+
+    let command = test.execute(vec![Query::new("SELECT currval('users_id_seq')").into()]);
+    assert!(command.route().is_read());
+
+    let command = test.execute(vec![Query::new("SELECT nextval('users_id_seq')").into()]);
+    assert!(command.route().is_write());
+}
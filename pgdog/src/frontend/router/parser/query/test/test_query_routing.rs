@@ -0,0 +1,113 @@
+use pgdog_config::{QueryRoutingPool, QueryRoutingRule, ReadWriteSplit, Role};
+
+use crate::frontend::router::parser::Shard;
+
+use super::setup::*;
+
+fn rule(regex: &str) -> QueryRoutingRule {
+    QueryRoutingRule {
+        database: "pgdog".into(),
+        regex: Some(regex.into()),
+        ..Default::default()
+    }
+}
+
+#[test]
+fn test_query_routing_rule_primary() {
+    let mut test = QueryParserTest::new().with_query_routing_rules(&[QueryRoutingRule {
+        role: Some(Role::Primary),
+        ..rule("FROM users")
+    }]);
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users WHERE id = 1").into()]);
+    assert!(command.route().is_write());
+
+    let command = test.execute(vec![Query::new("SELECT * FROM orders WHERE id = 1").into()]);
+    assert!(command.route().is_read());
+}
+
+#[test]
+fn test_query_routing_rule_replica() {
+    let mut test = QueryParserTest::new()
+        .with_rw_split(ReadWriteSplit::PreferPrimary)
+        .with_query_routing_rules(&[QueryRoutingRule {
+            role: Some(Role::Replica),
+            ..rule("^SELECT .* FROM reports")
+        }]);
+
+    let command = test.execute(vec![Query::new("SELECT * FROM reports").into()]);
+    assert!(command.route().is_read());
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users").into()]);
+    assert!(command.route().is_write());
+}
+
+#[test]
+fn test_query_routing_rule_shard() {
+    let mut test = QueryParserTest::new().with_query_routing_rules(&[QueryRoutingRule {
+        shard: Some(1),
+        ..rule("FROM users")
+    }]);
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users").into()]);
+    assert_eq!(command.route().shard(), &Shard::Direct(1));
+
+    // Comments take precedence.
+    let command = test.execute(vec![
+        Query::new("/* pgdog_shard: 0 */ SELECT * FROM users").into(),
+    ]);
+    assert_eq!(command.route().shard(), &Shard::Direct(0));
+}
+
+#[test]
+fn test_query_routing_rule_pool() {
+    let mut test = QueryParserTest::new().with_query_routing_rules(&[
+        QueryRoutingRule {
+            pool: Some(QueryRoutingPool::Slow),
+            ..rule("FROM reports")
+        },
+        QueryRoutingRule {
+            pool: Some(QueryRoutingPool::Default),
+            ..rule("FROM users")
+        },
+    ]);
+
+    let command = test.execute(vec![Query::new("SELECT * FROM reports").into()]);
+    assert_eq!(command.route().pool(), Some(QueryRoutingPool::Slow));
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users").into()]);
+    assert_eq!(command.route().pool(), Some(QueryRoutingPool::Default));
+
+    let command = test.execute(vec![Query::new("SELECT * FROM orders").into()]);
+    assert_eq!(command.route().pool(), None);
+}
+
+#[test]
+fn test_query_routing_rule_application_name() {
+    let rules = [QueryRoutingRule {
+        database: "pgdog".into(),
+        application_name: Some("reporting_*".into()),
+        role: Some(Role::Replica),
+        ..Default::default()
+    }];
+
+    let mut test = QueryParserTest::new()
+        .with_rw_split(ReadWriteSplit::PreferPrimary)
+        .with_query_routing_rules(&rules)
+        .with_param("application_name", "reporting_daily");
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users").into()]);
+    assert!(command.route().is_read());
+
+    // Writes still go to the primary.
+    let command = test.execute(vec![Query::new("INSERT INTO users (id) VALUES (1)").into()]);
+    assert!(command.route().is_write());
+
+    let mut test = QueryParserTest::new()
+        .with_rw_split(ReadWriteSplit::PreferPrimary)
+        .with_query_routing_rules(&rules)
+        .with_param("application_name", "web");
+
+    let command = test.execute(vec![Query::new("SELECT * FROM users").into()]);
+    assert!(command.route().is_write());
+}
@@ -7,7 +7,7 @@ use crate::{
             route::{OverrideReason, ShardSource},
         },
     },
-    net::parameter::ParameterValue,
+    net::{messages::Parameter, parameter::ParameterValue},
 };
 
 use super::setup::*;
@@ -80,6 +80,66 @@ fn test_set_config_null_value() {
     }
 }
 
+#[test]
+fn test_set_config_bound_value() {
+    let mut test = QueryParserTest::new();
+
+    let command = test.execute(vec![
+        Parse::named(
+            "__test_set_config",
+            "SELECT set_config('app.tenant_id', $1, $2)",
+        )
+        .into(),
+        Bind::new_params(
+            "__test_set_config",
+            &[Parameter::new(b"42"), Parameter::new(b"false")],
+        )
+        .into(),
+        Execute::new().into(),
+        Sync.into(),
+    ]);
+
+    match command {
+        Command::Set {
+            params,
+            behave_like_select,
+            ..
+        } => {
+            assert_eq!(params.len(), 1);
+            assert_eq!(params[0].name, "app.tenant_id");
+            assert_eq!(params[0].value, Some(ParameterValue::String("42".into())));
+            assert!(!params[0].local);
+            assert!(behave_like_select);
+        }
+        _ => panic!("expected Command::Set, got {command:#?}"),
+    }
+}
+
+#[test]
+fn test_set_config_bound_null_value() {
+    let mut test = QueryParserTest::new();
+
+    let command = test.execute(vec![
+        Parse::named(
+            "__test_set_config_null",
+            "SELECT set_config('app.tenant_id', $1, true)",
+        )
+        .into(),
+        Bind::new_params("__test_set_config_null", &[Parameter::new_null()]).into(),
+        Execute::new().into(),
+        Sync.into(),
+    ]);
+
+    match command {
+        Command::Set { params, .. } => {
+            assert_eq!(params.len(), 1);
+            assert_eq!(params[0].value, None);
+            assert!(params[0].local);
+        }
+        _ => panic!("expected Command::Set, got {command:#?}"),
+    }
+}
+
 #[test]
 fn test_set_multi_statement() {
     let mut test = QueryParserTest::new();
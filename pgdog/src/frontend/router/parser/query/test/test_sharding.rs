@@ -118,6 +118,34 @@ fn test_omni_all_tables_must_be_omnisharded() {
     assert!(matches!(command.route().shard(), Shard::All));
 }
 
+#[test]
+fn test_omni_two_pc_writes() {
+    for q in [
+        "INSERT INTO sharded_omni_2pc (id, value) VALUES (1, 'test')",
+        "UPDATE sharded_omni_2pc SET value = 'test' WHERE id = 1",
+        "DELETE FROM sharded_omni_2pc WHERE id = 1",
+    ] {
+        let mut test = QueryParserTest::new();
+        let command = test.execute(vec![Query::new(q).into()]);
+        assert!(command.route().is_omnisharded_two_pc(), "{}", q);
+        assert!(command.route().should_2pc(), "{}", q);
+    }
+
+    // Reads still go to one shard.
+    let mut test = QueryParserTest::new();
+    let command = test.execute(vec![
+        Query::new("SELECT * FROM sharded_omni_2pc WHERE id = 1").into(),
+    ]);
+    assert!(matches!(command.route().shard(), Shard::Direct(_)));
+
+    // Only tables configured with two_phase_commit.
+    let mut test = QueryParserTest::new();
+    let command = test.execute(vec![
+        Query::new("DELETE FROM sharded_omni WHERE id = 1").into(),
+    ]);
+    assert!(!command.route().is_omnisharded_two_pc());
+}
+
 #[test]
 fn test_omni_flag_set_for_select() {
     let mut test = QueryParserTest::new();
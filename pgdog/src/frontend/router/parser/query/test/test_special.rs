@@ -368,3 +368,22 @@ fn test_empty_string_param() {
 
     assert!(command.route().is_read());
 }
+
+// --- DEALLOCATE ---
+
+#[test]
+fn test_deallocate() {
+    let mut test = QueryParserTest::new();
+
+    let command = test.execute(vec![Query::new("DEALLOCATE __test_1").into()]);
+    assert!(
+        matches!(command, Command::Deallocate { name: Some(ref name) } if name == "__test_1"),
+        "expected Command::Deallocate, got {command:#?}",
+    );
+
+    let command = test.execute(vec![Query::new("DEALLOCATE ALL").into()]);
+    assert!(
+        matches!(command, Command::Deallocate { name: None }),
+        "expected Command::Deallocate, got {command:#?}",
+    );
+}
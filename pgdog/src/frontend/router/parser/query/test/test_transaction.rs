@@ -1,5 +1,6 @@
 use crate::config::ReadWriteStrategy;
 use crate::frontend::Command;
+use crate::frontend::client::TransactionType;
 use crate::net::parameter::ParameterValue;
 
 use super::setup::*;
@@ -96,3 +97,78 @@ fn test_set_application_name_in_transaction() {
 
     assert!(command.route().shard().is_all());
 }
+
+#[test]
+fn test_begin_read_only() {
+    let mut test = QueryParserTest::new();
+
+    let command = test.execute(vec![Query::new("BEGIN READ ONLY").into()]);
+
+    match command {
+        Command::StartTransaction {
+            transaction_type,
+            route,
+            ..
+        } => {
+            assert_eq!(transaction_type, TransactionType::ReadOnly);
+            assert!(route.is_read());
+        }
+        _ => panic!("expected StartTransaction, got {command:?}"),
+    }
+}
+
+#[test]
+fn test_begin_default_transaction_read_only() {
+    let mut test = QueryParserTest::new().with_param("default_transaction_read_only", "on");
+
+    let command = test.execute(vec![Query::new("BEGIN").into()]);
+    match command {
+        Command::StartTransaction {
+            transaction_type,
+            route,
+            ..
+        } => {
+            assert_eq!(transaction_type, TransactionType::ReadOnly);
+            assert!(route.is_read());
+        }
+        _ => panic!("expected StartTransaction, got {command:?}"),
+    }
+
+    // Explicit READ WRITE overrides the default.
+    let command = test.execute(vec![Query::new("BEGIN READ WRITE").into()]);
+    match command {
+        Command::StartTransaction {
+            transaction_type,
+            route,
+            ..
+        } => {
+            assert_eq!(transaction_type, TransactionType::ReadWrite);
+            assert!(route.is_write());
+        }
+        _ => panic!("expected StartTransaction, got {command:?}"),
+    }
+}
+
+#[test]
+fn test_read_only_transaction_stays_on_replica() {
+    let mut test = QueryParserTest::new().with_transaction(TransactionType::ReadOnly);
+
+    for query in [
+        "SELECT * FROM users WHERE id = 1",
+        "SELECT * FROM users WHERE id = 1 FOR UPDATE",
+        "INSERT INTO users (id) VALUES (1)",
+    ] {
+        let command = test.execute(vec![Query::new(query).into()]);
+        assert!(command.route().is_read(), "{query}");
+    }
+}
+
+#[test]
+fn test_read_only_transaction_role_primary() {
+    let mut test = QueryParserTest::new()
+        .with_transaction(TransactionType::ReadOnly)
+        .with_param("pgdog.role", "primary");
+
+    let command = test.execute(vec![Query::new("SELECT 1").into()]);
+    assert!(command.route().is_write());
+}
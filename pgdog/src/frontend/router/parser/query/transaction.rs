@@ -33,7 +33,8 @@ impl QueryParser {
                 return Ok(Command::RollbackTransaction { extended });
             }
             TRANS_STMT_BEGIN | TRANS_STMT_START => {
-                let transaction_type = Self::transaction_type(stmt.options()).unwrap_or_default();
+                let transaction_type = Self::transaction_type(stmt.options())
+                    .unwrap_or_else(|| Self::default_transaction_type(context));
                 return Ok(Command::StartTransaction {
                     query: context.query()?.clone(),
                     transaction_type,
@@ -83,7 +84,8 @@ impl QueryParser {
                         return Ok(Command::RollbackTransaction { extended });
                     }
                     TransactionStmtKind::TransStmtBegin | TransactionStmtKind::TransStmtStart => {
-                        let transaction_type = Self::transaction_type(&stmt.options).unwrap_or_default();
+                        let transaction_type = Self::transaction_type(&stmt.options)
+                            .unwrap_or_else(|| Self::default_transaction_type(context));
                         return Ok(Command::StartTransaction {
                             query: context.query()?.clone(),
                             transaction_type,
@@ -116,6 +118,20 @@ impl QueryParser {
         _ => {}
     }
 
+    /// Transaction type used when BEGIN doesn't specify READ ONLY or READ WRITE.
+    fn default_transaction_type(context: &QueryParserContext) -> TransactionType {
+        if context
+            .router_context
+            .parameter_hints
+            .default_transaction_read_only()
+        {
+            TransactionType::ReadOnly
+        } else {
+            TransactionType::ReadWrite
+        }
+    }
+
+    /// Get the transaction type from BEGIN options, if specified.
     #[cfg(feature = "new_parser")]
     fn transaction_type<'a>(
         options: impl IntoIterator<Item = Node<'a>>,
@@ -130,10 +146,12 @@ impl QueryParser {
                 {
                     return Some(TransactionType::ReadOnly);
                 }
+
+                return Some(TransactionType::ReadWrite);
             }
         }
 
-        Some(TransactionType::ReadWrite)
+        None
     }
 
     cfg_select! {
@@ -153,10 +171,12 @@ impl QueryParser {
                                 return Some(TransactionType::ReadOnly);
                             }
                         }
+
+                        return Some(TransactionType::ReadWrite);
                     }
                 }
 
-                Some(TransactionType::ReadWrite)
+                None
             }
         }
         _ => {}
@@ -170,19 +190,22 @@ mod test {
     #[test]
     #[cfg(feature = "new_parser")]
     fn test_detect_transaction_type() {
-        let read_write_queries = [
+        let unspecified_queries = [
             "BEGIN",
             "BEGIN;",
             "begin",
             "bEgIn",
             "BEGIN WORK",
             "BEGIN TRANSACTION",
-            "BEGIN READ WRITE",
-            "BEGIN WORK READ WRITE",
-            "BEGIN TRANSACTION READ WRITE",
             "START TRANSACTION",
             "START TRANSACTION;",
             "start transaction",
+        ];
+
+        let read_write_queries = [
+            "BEGIN READ WRITE",
+            "BEGIN WORK READ WRITE",
+            "BEGIN TRANSACTION READ WRITE",
             "START TRANSACTION READ WRITE",
             "BEGIN ISOLATION LEVEL REPEATABLE READ READ WRITE DEFERRABLE",
         ];
@@ -196,6 +219,16 @@ mod test {
             "START TRANSACTION ISOLATION LEVEL READ COMMITTED READ ONLY NOT DEFERRABLE",
         ];
 
+        for q in unspecified_queries {
+            let ast = pg_raw_parse::parse(q).unwrap();
+            let Some(Node::TransactionStmt(stmt)) = ast.stmts().next() else {
+                unreachable!("not a transaction")
+            };
+
+            let t = QueryParser::transaction_type(stmt.options());
+            assert_eq!(t, None);
+        }
+
         for q in read_write_queries {
             let ast = pg_raw_parse::parse(q).unwrap();
             let Some(Node::TransactionStmt(stmt)) = ast.stmts().next() else {
@@ -221,19 +254,22 @@ mod test {
         not(feature = "new_parser") => {
             #[test]
             fn test_detect_transaction_type() {
-                let read_write_queries = vec![
+                let unspecified_queries = vec![
                     "BEGIN",
                     "BEGIN;",
                     "begin",
                     "bEgIn",
                     "BEGIN WORK",
                     "BEGIN TRANSACTION",
-                    "BEGIN READ WRITE",
-                    "BEGIN WORK READ WRITE",
-                    "BEGIN TRANSACTION READ WRITE",
                     "START TRANSACTION",
                     "START TRANSACTION;",
                     "start transaction",
+                ];
+
+                let read_write_queries = vec![
+                    "BEGIN READ WRITE",
+                    "BEGIN WORK READ WRITE",
+                    "BEGIN TRANSACTION READ WRITE",
                     "START TRANSACTION READ WRITE",
                     "BEGIN ISOLATION LEVEL REPEATABLE READ READ WRITE DEFERRABLE",
                 ];
@@ -247,6 +283,27 @@ mod test {
                     "START TRANSACTION ISOLATION LEVEL READ COMMITTED READ ONLY NOT DEFERRABLE",
                 ];
 
+                for q in unspecified_queries {
+                    let binding = pg_query::parse(q).unwrap();
+                    let stmt = binding
+                        .protobuf
+                        .stmts
+                        .first()
+                        .as_ref()
+                        .unwrap()
+                        .stmt
+                        .as_ref()
+                        .unwrap();
+
+                    match stmt.node {
+                        Some(NodeEnum::TransactionStmt(ref stmt)) => {
+                            let t = QueryParser::transaction_type(&stmt.options);
+                            assert_eq!(t, None);
+                        }
+                        _ => panic!("not a transaction"),
+                    }
+                }
+
                 for q in read_write_queries {
                     let binding = pg_query::parse(q).unwrap();
                     let stmt = binding
@@ -0,0 +1,205 @@
+//! Query routing rules.
+//!
+//! Send queries matching a regex or a fingerprint, or coming from
+//! an `application_name`, to the primary, the replicas, a shard
+//! or a connection pool, as configured in `[[query_routing_rules]]`.
+//! Rules are evaluated once per query by the router, which stores
+//! the pool on the route for the query engine.
+
+use pgdog_config::{QueryRoutingPool, QueryRoutingRule, Role};
+use regex::Regex;
+use tracing::warn;
+
+use super::{LazyFingerprint, fingerprint};
+
+/// Where to send queries matching a rule.
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct QueryRoutingTarget {
+    pub role: Option<Role>,
+    pub shard: Option<usize>,
+    pub pool: Option<QueryRoutingPool>,
+}
+
+#[derive(Debug)]
+struct Rule {
+    regex: Option<Regex>,
+    fingerprint: Option<String>,
+    application_name: Option<Regex>,
+    target: QueryRoutingTarget,
+}
+
+/// Query routing rules for a database, checked in order.
+#[derive(Debug, Default)]
+pub struct QueryRoutingRules {
+    rules: Vec<Rule>,
+}
+
+impl QueryRoutingRules {
+    /// Compile the configured rules. Invalid ones are ignored.
+    pub fn new<'a>(rules: impl IntoIterator<Item = &'a QueryRoutingRule>) -> Self {
+        let rules = rules
+            .into_iter()
+            .filter_map(|rule| {
+                let regex = match rule.regex.as_deref().map(Regex::new).transpose() {
+                    Ok(regex) => regex,
+                    Err(err) => {
+                        warn!("ignoring query routing rule: {}", err);
+                        return None;
+                    }
+                };
+
+                let fingerprint = match rule.query.as_deref().map(fingerprint).transpose() {
+                    Ok(fingerprint) => fingerprint,
+                    Err(err) => {
+                        warn!("ignoring query routing rule: {}", err);
+                        return None;
+                    }
+                };
+
+                let application_name = rule.application_name.as_deref().map(glob);
+
+                if regex.is_none() && fingerprint.is_none() && application_name.is_none() {
+                    return None;
+                }
+
+                Some(Rule {
+                    regex,
+                    fingerprint,
+                    application_name,
+                    target: QueryRoutingTarget {
+                        role: rule.role,
+                        shard: rule.shard,
+                        pool: rule.pool,
+                    },
+                })
+            })
+            .collect();
+
+        Self { rules }
+    }
+
+    /// No rules configured.
+    pub fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+
+    /// Get the target of the first rule matching the query
+    /// and the client's `application_name`.
+    ///
+    /// The query is fingerprinted only if a rule needs it.
+    pub fn route(
+        &self,
+        query: &LazyFingerprint<'_>,
+        application_name: Option<&str>,
+    ) -> Option<QueryRoutingTarget> {
+        self.rules
+            .iter()
+            .find(|rule| {
+                if let Some(ref pattern) = rule.application_name
+                    && !application_name.is_some_and(|name| pattern.is_match(name))
+                {
+                    return false;
+                }
+
+                if let Some(ref regex) = rule.regex
+                    && !regex.is_match(query.query())
+                {
+                    return false;
+                }
+
+                if let Some(ref expected) = rule.fingerprint
+                    && query.fingerprint() != Some(expected.as_str())
+                {
+                    return false;
+                }
+
+                true
+            })
+            .map(|rule| rule.target)
+    }
+}
+
+/// Match the whole name, with `*` matching any number of characters.
+fn glob(pattern: &str) -> Regex {
+    let pattern = pattern
+        .split('*')
+        .map(regex::escape)
+        .collect::<Vec<_>>()
+        .join(".*");
+
+    Regex::new(&format!("^{}$", pattern)).expect("escaped pattern is valid")
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    fn rule(regex: Option<&str>, query: Option<&str>, role: Role) -> QueryRoutingRule {
+        QueryRoutingRule {
+            database: "pgdog".into(),
+            regex: regex.map(str::to_owned),
+            query: query.map(str::to_owned),
+            role: Some(role),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_query_routing_rules() {
+        let rules = [
+            rule(Some("^SELECT .* FROM reports"), None, Role::Replica),
+            rule(
+                None,
+                Some("SELECT * FROM users WHERE email = 'a@b.c'"),
+                Role::Primary,
+            ),
+            rule(Some("[invalid"), None, Role::Primary),
+        ];
+        let rules = QueryRoutingRules::new(&rules);
+        let route = |query| rules.route(&LazyFingerprint::new(query), None);
+
+        assert_eq!(
+            route("SELECT id FROM reports").unwrap().role,
+            Some(Role::Replica)
+        );
+        assert_eq!(
+            route("/* orm */ SELECT * FROM users WHERE email = 'x@y.z'")
+                .unwrap()
+                .role,
+            Some(Role::Primary)
+        );
+        assert!(route("SELECT * FROM users WHERE id = 1").is_none());
+        assert!(route("[invalid").is_none());
+    }
+
+    #[test]
+    fn test_query_routing_rules_application_name() {
+        let rules = [
+            QueryRoutingRule {
+                application_name: Some("migrations".into()),
+                ..rule(Some("^SELECT"), None, Role::Primary)
+            },
+            QueryRoutingRule {
+                application_name: Some("reporting_*".into()),
+                ..rule(None, None, Role::Replica)
+            },
+        ];
+        let rules = QueryRoutingRules::new(&rules);
+
+        let role = |query, application_name| {
+            rules
+                .route(&LazyFingerprint::new(query), application_name)
+                .and_then(|target| target.role)
+        };
+
+        assert_eq!(role("SELECT 1", Some("migrations")), Some(Role::Primary));
+        assert_eq!(role("UPDATE users SET id = 1", Some("migrations")), None);
+        assert_eq!(
+            role("SELECT 1", Some("reporting_daily")),
+            Some(Role::Replica)
+        );
+        assert_eq!(role("SELECT 1", Some("reporting_")), Some(Role::Replica));
+        assert_eq!(role("SELECT 1", Some("daily_reporting_")), None);
+        assert_eq!(role("SELECT 1", None), None);
+    }
+}
@@ -3,7 +3,7 @@ mod plan;
 
 use super::{Error, RewritePlan, StatementRewrite};
 use crate::backend::schema::Schema;
-use crate::frontend::router::parser::aggregate::Aggregate;
+use crate::frontend::router::parser::{Having, aggregate::Aggregate};
 #[cfg(not(feature = "new_parser"))]
 use pg_query::NodeEnum;
 #[cfg(feature = "new_parser")]
@@ -31,13 +31,21 @@ impl StatementRewrite<'_> {
             return Ok(());
         }
 
-        let output = AggregatesRewrite::rewrite_select(select, mem, &aggregate);
+        let mut output = AggregatesRewrite::rewrite_select(select, mem, &aggregate);
+        let helpers = !output.plan.is_noop();
+        if let Some(having) = Having::parse(&select, &aggregate) {
+            output.plan.set_having(having);
+        }
         if output.plan.is_noop() {
             return Ok(());
         }
 
         plan.aggregates = output.plan;
-        self.rewritten = true;
+        // HAVING is removed from the query after routing,
+        // only if it's sent to multiple shards.
+        if helpers {
+            self.rewritten = true;
+        }
         Ok(())
     }
 
@@ -68,13 +76,21 @@ impl StatementRewrite<'_> {
             return Ok(());
         }
 
-        let output = AggregatesRewrite.rewrite_select(select, &aggregate);
+        let mut output = AggregatesRewrite.rewrite_select(select, &aggregate);
+        let helpers = !output.plan.is_noop();
+        if let Some(having) = Having::parse(select, &aggregate) {
+            output.plan.set_having(having);
+        }
         if output.plan.is_noop() {
             return Ok(());
         }
 
         plan.aggregates = output.plan;
-        self.rewritten = true;
+        // HAVING is removed from the query after routing,
+        // only if it's sent to multiple shards.
+        if helpers {
+            self.rewritten = true;
+        }
         Ok(())
     }
 }
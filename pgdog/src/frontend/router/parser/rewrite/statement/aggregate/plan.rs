@@ -1,3 +1,5 @@
+use crate::frontend::router::parser::Having;
+
 /// Type of aggregate function added to the result set.
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
 pub(crate) enum HelperKind {
@@ -34,6 +36,8 @@ pub(crate) struct HelperMapping {
 #[derive(Debug, Clone, Default, PartialEq)]
 pub(crate) struct AggregateRewritePlan {
     helpers: Vec<HelperMapping>,
+    /// HAVING clause evaluated by the proxy instead of the shards.
+    having: Having,
 }
 
 impl AggregateRewritePlan {
@@ -41,12 +45,13 @@ impl AggregateRewritePlan {
     pub(crate) fn new() -> Self {
         Self {
             helpers: Vec::new(),
+            having: Having::default(),
         }
     }
 
     /// Is this plan a no-op? Doesn't do anything.
     pub(crate) fn is_noop(&self) -> bool {
-        self.helpers.is_empty()
+        self.helpers.is_empty() && self.having.is_empty()
     }
 
     pub(crate) fn drop_columns(&self) -> impl Iterator<Item = usize> + '_ {
@@ -60,6 +65,14 @@ impl AggregateRewritePlan {
     pub(crate) fn add_helper(&mut self, mapping: HelperMapping) {
         self.helpers.push(mapping);
     }
+
+    pub(crate) fn having(&self) -> &Having {
+        &self.having
+    }
+
+    pub(crate) fn set_having(&mut self, having: Having) {
+        self.having = having;
+    }
 }
 
 #[derive(Debug, Default, Clone)]
@@ -12,16 +12,18 @@ use pg_raw_parse::{Node, NodeMut, make, nodes};
 use pgdog_config::RewriteMode;
 
 use super::{Error, RewritePlan, StatementRewrite};
+use crate::backend::schema::columns::StatsColumn;
 use crate::frontend::router::parser::{StatementParser, Table};
 
 impl StatementRewrite<'_> {
-    /// Handle BIGINT primary key columns in INSERT statements based on config.
+    /// Handle BIGINT primary key columns, and columns listed in
+    /// `rewrite.unique_id_columns`, in INSERT statements based on config.
     ///
     /// Behavior depends on `rewrite.primary_key` setting:
     /// - `ignore`: Do nothing
     /// - `error`: Return an error if a BIGINT primary key is missing
     /// - `rewrite`: Auto-inject pgdog.unique_id() for missing columns,
-    ///   or replace DEFAULT values with pgdog.unique_id()
+    ///   or replace DEFAULT values, and nextval() in configured columns, with pgdog.unique_id()
     ///
     /// This runs before unique_id replacement so injected function calls
     /// will be processed by the unique_id rewriter.
@@ -47,12 +49,18 @@ impl StatementRewrite<'_> {
         // Get the columns specified in the INSERT (preserving order)
         let insert_columns: IndexSet<&str> = self.get_insert_column_names_ordered(&node);
 
-        // Find BIGINT primary key columns
-        let bigint_pk_columns: Vec<&str> = relation
+        // Find BIGINT primary key and configured columns, and if
+        // their nextval() can be replaced.
+        let bigint_pk_columns: Vec<(&str, bool)> = relation
             .columns()
             .values()
-            .filter(|col| col.is_primary_key && is_bigint_type(&col.data_type))
-            .map(|col| col.column_name.as_str())
+            .filter(|col| self.is_unique_id_column(col))
+            .map(|col| {
+                (
+                    col.column_name.as_str(),
+                    self.is_configured_unique_id_column(col),
+                )
+            })
             .collect();
 
         if bigint_pk_columns.is_empty() {
@@ -60,21 +68,22 @@ impl StatementRewrite<'_> {
         }
 
         // Find positions of present PK columns (for DEFAULT replacement)
-        let (present_pk_positions, missing_columns): (Vec<_>, Vec<_>) =
-            bigint_pk_columns.into_iter().partition_map(|pk_col| {
+        let (present_pk_positions, missing_columns): (Vec<_>, Vec<_>) = bigint_pk_columns
+            .into_iter()
+            .partition_map(|(pk_col, nextval)| {
                 insert_columns
                     .get_index_of(&pk_col)
-                    .map(Either::Left)
+                    .map(|pos| Either::Left((pos, nextval)))
                     .unwrap_or(Either::Right(pk_col))
             });
 
         let rewrite =
             mode == RewriteMode::Rewrite || mode == RewriteMode::RewriteOmni && !is_sharded;
 
-        // Replace DEFAULT values with unique_id() for present columns (only in rewrite mode)
+        // Replace DEFAULT, and nextval() in configured columns, with unique_id() (only in rewrite mode)
         if rewrite {
             let replaced =
-                self.replace_set_to_default_at_positions(&mut node, mem, &present_pk_positions);
+                self.replace_generated_at_positions(&mut node, mem, &present_pk_positions);
             if replaced > 0 {
                 plan.auto_id_injected += replaced as u16;
                 self.rewritten = true;
@@ -123,12 +132,18 @@ impl StatementRewrite<'_> {
                 // Get the columns specified in the INSERT (preserving order)
                 let insert_columns: IndexSet<&str> = self.get_insert_column_names_ordered();
 
-                // Find BIGINT primary key columns
-                let bigint_pk_columns: Vec<&str> = relation
+                // Find BIGINT primary key and configured columns, and if
+                // their nextval() can be replaced.
+                let bigint_pk_columns: Vec<(&str, bool)> = relation
                     .columns()
                     .values()
-                    .filter(|col| col.is_primary_key && is_bigint_type(&col.data_type))
-                    .map(|col| col.column_name.as_str())
+                    .filter(|col| self.is_unique_id_column(col))
+                    .map(|col| {
+                        (
+                            col.column_name.as_str(),
+                            self.is_configured_unique_id_column(col),
+                        )
+                    })
                     .collect();
 
                 if bigint_pk_columns.is_empty() {
@@ -136,24 +151,26 @@ impl StatementRewrite<'_> {
                 }
 
                 // Find positions of present PK columns (for DEFAULT replacement)
-                let present_pk_positions: Vec<usize> = bigint_pk_columns
+                let present_pk_positions: Vec<(usize, bool)> = bigint_pk_columns
                     .iter()
-                    .filter_map(|pk_col| insert_columns.get_index_of(pk_col))
+                    .filter_map(|(pk_col, nextval)| {
+                        insert_columns.get_index_of(pk_col).map(|pos| (pos, *nextval))
+                    })
                     .collect();
 
                 // Find which PK columns are missing
                 let missing_columns: Vec<&str> = bigint_pk_columns
                     .iter()
-                    .filter(|pk_col| !insert_columns.contains(*pk_col))
-                    .copied()
+                    .filter(|(pk_col, _)| !insert_columns.contains(pk_col))
+                    .map(|(pk_col, _)| *pk_col)
                     .collect();
 
                 let rewrite =
                     mode == RewriteMode::Rewrite || mode == RewriteMode::RewriteOmni && !is_sharded;
 
-                // Replace DEFAULT values with unique_id() for present columns (only in rewrite mode)
+                // Replace DEFAULT, and nextval() in configured columns, with unique_id() (only in rewrite mode)
                 if rewrite {
-                    let replaced = self.replace_set_to_default_at_positions(&present_pk_positions);
+                    let replaced = self.replace_generated_at_positions(&present_pk_positions);
                     if replaced > 0 {
                         plan.auto_id_injected += replaced as u16;
                         self.rewritten = true;
@@ -182,9 +199,23 @@ impl StatementRewrite<'_> {
         _ => {}
     }
 
+    /// Column is a BIGINT primary key or configured to get unique IDs.
+    fn is_unique_id_column(&self, column: &StatsColumn) -> bool {
+        (column.is_primary_key && is_bigint_type(&column.data_type))
+            || self.is_configured_unique_id_column(column)
+    }
+
+    /// Column is in `unique_id_columns`. Only these get their `nextval()`
+    /// replaced: a primary key set with `nextval()` was given a value on purpose.
+    fn is_configured_unique_id_column(&self, column: &StatsColumn) -> bool {
+        self.schema
+            .rewrite
+            .unique_id_column(&column.table_name, &column.column_name)
+    }
+
     /// Get the table from an INSERT statement.
     #[cfg(feature = "new_parser")]
-    fn get_insert_table<'a>(&self, insert: &'a nodes::InsertStmt) -> (Table<'a>, bool) {
+    pub(super) fn get_insert_table<'a>(&self, insert: &'a nodes::InsertStmt) -> (Table<'a>, bool) {
         let relation = insert.relation().expect("INSERT always has table");
         let is_sharded = StatementParser::from_insert(insert.into(), None, self.schema, None)
             .is_sharded(self.db_schema, self.user, self.search_path);
@@ -194,7 +225,7 @@ impl StatementRewrite<'_> {
 
     cfg_select! {
         not(feature = "new_parser") => {
-            fn get_insert_table(
+            pub(super) fn get_insert_table(
                 &self,
             ) -> Option<(Table<'_>, bool)> {
                 let stmt = self.stmt.stmts.first()?;
@@ -221,7 +252,7 @@ impl StatementRewrite<'_> {
 
     /// Get the column names specified in the INSERT statement, preserving order.
     #[cfg(feature = "new_parser")]
-    fn get_insert_column_names_ordered<'a>(
+    pub(super) fn get_insert_column_names_ordered<'a>(
         &self,
         insert: &'a nodes::InsertStmt,
     ) -> IndexSet<&'a str> {
@@ -237,7 +268,7 @@ impl StatementRewrite<'_> {
 
     cfg_select! {
         not(feature = "new_parser") => {
-            fn get_insert_column_names_ordered(&self) -> IndexSet<&str> {
+            pub(super) fn get_insert_column_names_ordered(&self) -> IndexSet<&str> {
                 let Some(stmt) = self.stmt.stmts.first() else {
                     return IndexSet::new();
                 };
@@ -265,13 +296,14 @@ impl StatementRewrite<'_> {
         _ => {}
     }
 
-    /// Replace SetToDefault nodes at the specified column positions with pgdog.unique_id().
+    /// Replace DEFAULT at the specified column positions with pgdog.unique_id(),
+    /// and nextval() too at positions that allow it.
     #[cfg(feature = "new_parser")]
-    fn replace_set_to_default_at_positions<'a, 'b>(
+    fn replace_generated_at_positions<'a, 'b>(
         &mut self,
         insert: &mut nodes::InsertStmtMut<'a, 'b>,
         mem: make::MemoryToken<'a>,
-        positions: &[usize],
+        positions: &[(usize, bool)],
     ) -> usize {
         let NodeMut::SelectStmt(mut select_stmt) = insert.select_stmt_mut() else {
             return 0; // DEFAULT VALUES
@@ -280,9 +312,12 @@ impl StatementRewrite<'_> {
         let mut replaced = 0;
         for list in select_stmt.values_lists_mut() {
             let mut list = list.expect_node_list();
-            for pos in positions {
-                if matches!(list.get(*pos), Some(Node::SetToDefault(..))) {
-                    list.set(*pos, Self::unique_id_func_call(mem).uncast());
+            for &(pos, nextval) in positions {
+                if list
+                    .get(pos)
+                    .is_some_and(|node| is_generated(node, nextval))
+                {
+                    list.set(pos, Self::unique_id_func_call(mem).uncast());
                     replaced += 1;
                 }
             }
@@ -293,7 +328,7 @@ impl StatementRewrite<'_> {
 
     cfg_select! {
         not(feature = "new_parser") => {
-            fn replace_set_to_default_at_positions(&mut self, positions: &[usize]) -> usize {
+            fn replace_generated_at_positions(&mut self, positions: &[(usize, bool)]) -> usize {
                 let Some(stmt) = self.stmt.stmts.first_mut() else {
                     return 0;
                 };
@@ -315,9 +350,11 @@ impl StatementRewrite<'_> {
 
                 for values_node in &mut select_stmt.values_lists {
                     if let Some(NodeEnum::List(list)) = &mut values_node.node {
-                        for &pos in positions {
-                            if pos < list.items.len()
-                                && let Some(NodeEnum::SetToDefault(_)) = &list.items[pos].node
+                        for &(pos, nextval) in positions {
+                            if list
+                                .items
+                                .get(pos)
+                                .is_some_and(|node| is_generated(node, nextval))
                             {
                                 list.items[pos] = unique_id_call.clone();
                                 replaced += 1;
@@ -441,6 +478,34 @@ impl StatementRewrite<'_> {
     }
 }
 
+/// Value the database would generate: `DEFAULT`, or a `nextval()` call if `nextval` is set.
+#[cfg(feature = "new_parser")]
+fn is_generated(node: Node<'_>, nextval: bool) -> bool {
+    match node {
+        Node::SetToDefault(..) => true,
+        Node::FuncCall(func) => {
+            nextval && func.funcname().iter().filter_map(Node::as_str).last() == Some("nextval")
+        }
+        _ => false,
+    }
+}
+
+cfg_select! {
+    not(feature = "new_parser") => {
+        fn is_generated(node: &PgNode, nextval: bool) -> bool {
+            match &node.node {
+                Some(NodeEnum::SetToDefault(_)) => true,
+                Some(NodeEnum::FuncCall(func)) => nextval && matches!(
+                    func.funcname.last().and_then(|name| name.node.as_ref()),
+                    Some(NodeEnum::String(name)) if name.sval == "nextval"
+                ),
+                _ => false,
+            }
+        }
+    }
+    _ => {}
+}
+
 /// Check if a data type is a BIGINT variant.
 fn is_bigint_type(data_type: &str) -> bool {
     matches!(
@@ -457,7 +522,7 @@ mod tests {
     use std::collections::HashMap;
 
     use super::*;
-    use crate::backend::schema::columns::StatsColumn as SchemaColumn;
+    use crate::backend::schema::columns::{Column, StatsColumn as SchemaColumn};
     use crate::backend::schema::{Relation, Schema};
     use crate::backend::{ShardedTables, ShardingSchema};
     use crate::frontend::PreparedStatements;
@@ -542,6 +607,40 @@ mod tests {
         Schema::from_parts(vec!["public".into()], relations)
     }
 
+    fn make_schema_with_serial_column() -> Schema {
+        let column = |name: &str, default: &str, position, is_primary_key| -> Column {
+            SchemaColumn {
+                table_catalog: "test".into(),
+                table_schema: "public".into(),
+                table_name: "users".into(),
+                column_name: name.into(),
+                column_default: default.into(),
+                is_nullable: false,
+                data_type: "bigint".into(),
+                ordinal_position: position,
+                is_primary_key,
+                foreign_keys: Vec::new(),
+            }
+            .into()
+        };
+        let columns = IndexMap::from([
+            ("id".to_string(), column("id", "", 1, true)),
+            ("name".to_string(), column("name", "", 2, false)),
+            (
+                "order_number".to_string(),
+                column(
+                    "order_number",
+                    "nextval('users_order_number_seq'::regclass)",
+                    3,
+                    false,
+                ),
+            ),
+        ]);
+        let relation = Relation::test_table("public", "users", columns);
+        let relations = HashMap::from([(("public".into(), "users".into()), relation)]);
+        Schema::from_parts(vec!["public".into()], relations)
+    }
+
     fn sharding_schema_with_mode(mode: RewriteMode) -> ShardingSchema {
         ShardingSchema {
             rewrite: Rewrite {
@@ -843,4 +942,58 @@ mod tests {
         assert_eq!(plan.auto_id_injected, 1);
         assert!(sql.contains("::bigint"));
     }
+
+    #[test]
+    fn test_unique_id_columns() {
+        let db_schema = make_schema_with_serial_column();
+        let rewrite = |columns: &[&str], sql: &str| {
+            let schema = ShardingSchema {
+                rewrite: Rewrite {
+                    primary_key: RewriteMode::Rewrite,
+                    unique_id_columns: columns.iter().map(|c| c.to_string()).collect(),
+                    ..Default::default()
+                },
+                ..Default::default()
+            };
+            rewrite_sql_with_sharding_schema(sql, &db_schema, &schema).unwrap()
+        };
+
+        let (sql, plan) = rewrite(
+            &["users.order_number"],
+            "INSERT INTO users (id, name) VALUES (1, 'test')",
+        );
+        assert_eq!(plan.auto_id_injected, 1);
+        assert!(sql.contains("order_number"));
+
+        let (sql, plan) = rewrite(
+            &["order_number"],
+            "INSERT INTO users (id, name, order_number) VALUES (1, 'test', DEFAULT)",
+        );
+        assert_eq!(plan.auto_id_injected, 1);
+        assert!(!sql.to_uppercase().contains("DEFAULT"));
+
+        // nextval() is replaced like DEFAULT.
+        let (sql, plan) = rewrite(
+            &["order_number"],
+            "INSERT INTO users (id, name, order_number) VALUES (1, 'test', nextval('users_order_number_seq'))",
+        );
+        assert_eq!(plan.auto_id_injected, 1);
+        assert!(!sql.contains("nextval"));
+
+        // The primary key was set explicitly, only the configured column is replaced.
+        let (sql, plan) = rewrite(
+            &["order_number"],
+            "INSERT INTO users (id, name, order_number) VALUES (nextval('users_id_seq'), 'test', nextval('users_order_number_seq'))",
+        );
+        assert_eq!(plan.auto_id_injected, 1);
+        assert!(sql.contains("nextval('users_id_seq')"));
+        assert!(!sql.contains("users_order_number_seq"));
+
+        // Column of another table.
+        let (_, plan) = rewrite(
+            &["orders.order_number"],
+            "INSERT INTO users (id, name) VALUES (1, 'test')",
+        );
+        assert_eq!(plan.auto_id_injected, 0);
+    }
 }
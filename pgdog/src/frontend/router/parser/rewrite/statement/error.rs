@@ -43,6 +43,12 @@ pub enum Error {
     #[error("missing AST on request")]
     MissingAst,
 
+    #[error("cross-shard subqueries are forbidden")]
+    CrossShardSubquery,
+
     #[error("prepared statement '{0}' does not exist")]
     ExecuteMissingPrepare(String),
+
+    #[error("{0}() is not supported with sequence_cache enabled")]
+    SequenceCacheCurrval(String),
 }
@@ -168,6 +168,143 @@ pub fn build_split_requests(
         .collect()
 }
 
+/// Merge single-tuple INSERT requests routed to the same shard
+/// back into one multi-tuple INSERT, so each shard executes one statement.
+///
+/// Parameters are renumbered in request order and the Bind messages
+/// are concatenated to match. The merged statement is always
+/// sent as an anonymous prepared statement.
+#[cfg(not(feature = "new_parser"))]
+pub(crate) fn merge_split_requests(requests: &[ClientRequest]) -> Result<ClientRequest, Error> {
+    let first = requests.first().ok_or(Error::EmptyQuery)?;
+    let first_ast = first.ast.as_ref().ok_or(Error::MissingAst)?;
+    let mut merged = first_ast.parse_result().protobuf.clone();
+
+    let mut tuples = Vec::with_capacity(requests.len());
+    let mut params = Vec::new();
+    let mut codes = Vec::new();
+    let mut binary = false;
+
+    for request in requests {
+        let mut stmt = request
+            .ast
+            .as_ref()
+            .ok_or(Error::MissingAst)?
+            .parse_result()
+            .protobuf
+            .clone();
+        let mut tuple = values_lists_mut(&mut stmt)
+            .and_then(|lists| lists.pop())
+            .ok_or(Error::MissingAst)?;
+        offset_params(&mut tuple, params.len() as i32);
+        tuples.push(tuple);
+
+        if let Some(bind) = request.parameters()? {
+            for index in 0..bind.params_raw().len() {
+                let format = bind.parameter_format(index)?;
+                binary |= format == Format::Binary;
+                codes.push(format);
+            }
+            params.extend(bind.params_raw().iter().cloned());
+        }
+    }
+
+    if let Some(values_lists) = values_lists_mut(&mut merged) {
+        *values_lists = tuples;
+    }
+
+    // All text parameters don't need format codes.
+    if !binary {
+        codes.clear();
+    }
+
+    let merged = pg_query::ParseResult::new(merged, "".into());
+    let stmt = match first_ast.query_parser_engine {
+        QueryParserEngine::PgQueryProtobuf => merged.deparse(),
+        QueryParserEngine::PgQueryRaw => merged.deparse_raw(),
+    }?;
+
+    let mut request = ClientRequest::default();
+    let mut has_parse = false;
+
+    for message in &first.messages {
+        let message = match message {
+            ProtocolMessage::Parse(parse) => {
+                has_parse = true;
+                let mut parse = parse.clone();
+                parse.anonymize();
+                parse.set_query(&stmt);
+                ProtocolMessage::Parse(parse)
+            }
+            ProtocolMessage::Query(query) => {
+                let mut query = query.clone();
+                query.set_query(&stmt);
+                ProtocolMessage::Query(query)
+            }
+            ProtocolMessage::Bind(_) => {
+                // The statement was prepared in an earlier request,
+                // but the merged statement is new to the server.
+                if !has_parse {
+                    has_parse = true;
+                    request
+                        .messages
+                        .push(ProtocolMessage::Parse(Parse::new_anonymous(&stmt)));
+                }
+                ProtocolMessage::Bind(Bind::new_params_codes("", &params, &codes))
+            }
+            ProtocolMessage::Describe(describe) => {
+                let mut describe = describe.clone();
+                describe.anonymize();
+                ProtocolMessage::Describe(describe)
+            }
+            other => other.clone(),
+        };
+        request.messages.push(message);
+    }
+
+    request.ast = Some(Ast::from_parse_result(merged));
+
+    Ok(request)
+}
+
+/// Get the VALUES lists of an INSERT statement.
+#[cfg(not(feature = "new_parser"))]
+fn values_lists_mut(stmt: &mut pg_query::protobuf::ParseResult) -> Option<&mut Vec<Node>> {
+    let node = stmt.stmts.first_mut()?.stmt.as_mut()?;
+
+    if let Some(NodeEnum::InsertStmt(insert)) = node.node.as_mut()
+        && let Some(select) = insert.select_stmt.as_mut()
+        && let Some(NodeEnum::SelectStmt(select_stmt)) = select.node.as_mut()
+    {
+        return Some(&mut select_stmt.values_lists);
+    }
+
+    None
+}
+
+/// Shift parameter references in a node tree by `offset`.
+#[cfg(not(feature = "new_parser"))]
+fn offset_params(node: &mut Node, offset: i32) {
+    if let Some(node_enum) = &mut node.node {
+        match node_enum {
+            NodeEnum::ParamRef(param) if param.number > 0 => {
+                param.number += offset;
+            }
+            NodeEnum::List(list) => {
+                for item in &mut list.items {
+                    offset_params(item, offset);
+                }
+            }
+            NodeEnum::TypeCast(cast) => {
+                if let Some(arg) = &mut cast.arg {
+                    offset_params(arg, offset);
+                }
+            }
+            _ => {}
+        }
+    }
+}
+
 impl StatementRewrite<'_> {
     /// Split up multi-tuple INSERT statements into separate single-tuple statements
     /// for individual execution.
@@ -447,6 +584,8 @@ mod tests {
     use crate::backend::schema::Schema;
     use crate::frontend::PreparedStatements;
     use crate::frontend::router::parser::StatementRewriteContext;
+    #[cfg(not(feature = "new_parser"))]
+    use crate::net::{Execute, Sync};
 
     fn default_db_schema() -> Schema {
         Schema::default()
@@ -719,4 +858,66 @@ mod tests {
             Err(Error::MissingParameter(_))
         );
     }
+
+    #[test]
+    #[cfg(not(feature = "new_parser"))]
+    fn test_merge_split_requests() {
+        let splits = parse_and_split("INSERT INTO t (a, b) VALUES ($1, $2), ($3, 'lit'), ($4, $5)");
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::Parse(Parse::named(
+                "__pgdog_1",
+                "INSERT INTO t (a, b) VALUES ($1, $2), ($3, 'lit'), ($4, $5)",
+            )),
+            ProtocolMessage::Bind(Bind::new_params_codes(
+                "__pgdog_1",
+                &[
+                    Parameter::new(b"p0"),
+                    Parameter::new(b"p1"),
+                    Parameter::new(b"p2"),
+                    Parameter::new(b"p3"),
+                    Parameter::new(b"p4"),
+                ],
+                &[Format::Binary],
+            )),
+            ProtocolMessage::Execute(Execute::new()),
+            ProtocolMessage::Sync(Sync),
+        ]);
+        let requests = build_split_requests(&splits, &request).unwrap();
+        assert_eq!(requests.len(), 3);
+
+        // First and last tuples go to the same shard.
+        let merged = merge_split_requests(&[requests[0].clone(), requests[2].clone()]).unwrap();
+        assert!(merged.ast.is_some());
+        assert_eq!(merged.messages.len(), 4);
+
+        match &merged.messages[0] {
+            ProtocolMessage::Parse(parse) => {
+                assert!(parse.anonymous());
+                assert_eq!(
+                    parse.query(),
+                    "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4)"
+                );
+            }
+            _ => panic!("expected Parse"),
+        }
+
+        match &merged.messages[1] {
+            ProtocolMessage::Bind(bind) => {
+                assert!(bind.anonymous());
+                let params: Vec<&[u8]> = bind
+                    .params_raw()
+                    .iter()
+                    .map(|param| param.data.as_ref())
+                    .collect();
+                assert_eq!(params, vec![b"p0".as_ref(), b"p1", b"p3", b"p4"]);
+                assert_eq!(bind.format_codes_raw().len(), 4);
+                assert!(
+                    bind.format_codes_raw()
+                        .iter()
+                        .all(|code| *code == Format::Binary)
+                );
+            }
+            _ => panic!("expected Bind"),
+        }
+    }
 }
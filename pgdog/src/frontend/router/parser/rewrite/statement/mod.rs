@@ -21,7 +21,9 @@ pub mod error;
 pub mod insert;
 pub mod offset;
 pub mod plan;
+pub mod sequence;
 pub mod simple_prepared;
+pub mod subquery;
 pub mod unique_id;
 pub mod update;
 pub mod visitor;
@@ -30,6 +32,7 @@ pub use error::Error;
 pub use insert::InsertSplit;
 pub(crate) use plan::RewritePlan;
 pub use simple_prepared::SimplePreparedResult;
+pub(crate) use subquery::CrossShardSubquery;
 pub(crate) use update::*;
 
 /// Statement rewrite engine context.
@@ -148,12 +151,24 @@ impl<'a> StatementRewrite<'a> {
             self.inject_auto_id(insert, mem, &mut plan)?;
         }
 
+        // Serve nextval() defaults of unsharded tables from the sequence cache.
+        if let NodeMut::InsertStmt(insert) = stmt.stmt_mut() {
+            self.serve_cached_sequences(insert, mem)?;
+        }
+
         // Track the next parameter number to use
         let mut next_param = plan.params as i32 + 1;
         let mut err = None;
+        let sequence_cache = self.sequence_cache_enabled();
+        let database = self.schema.database.as_str();
         transform::transform_node(
             stmt.stmt_mut(),
             &mut transform::TransformClosure::new(|node| {
+                if sequence_cache && let Err(e) = Self::check_currval(node.as_ref(), database) {
+                    err = Some(e);
+                    return None;
+                }
+
                 match Self::rewrite_unique_id(node.as_ref(), mem, self.extended, &mut next_param) {
                     Ok(Some(replacement)) => {
                         plan.unique_ids += 1;
@@ -190,6 +205,10 @@ impl<'a> StatementRewrite<'a> {
             self.sharding_key_update(stmt, &mut plan)?;
         }
 
+        if let Node::SelectStmt(stmt) = stmt.stmt() {
+            self.cross_shard_subquery(stmt, &mut plan)?;
+        }
+
         Ok(plan)
     }
 
@@ -213,11 +232,20 @@ impl<'a> StatementRewrite<'a> {
         // function calls get processed.
         self.inject_auto_id(&mut plan)?;
 
+        // Serve nextval() defaults of unsharded tables from the sequence cache.
+        self.serve_cached_sequences()?;
+
         // Track the next parameter number to use
         let mut next_param = plan.params as i32 + 1;
 
         let extended = self.extended;
+        let sequence_cache = self.sequence_cache_enabled();
+        let database = self.schema.database.as_str();
         visitor::visit_and_mutate_nodes(self.stmt, |node| -> Result<Option<PgNode>, Error> {
+            if sequence_cache {
+                Self::check_currval(node, database)?;
+            }
+
             match Self::rewrite_unique_id(node, extended, &mut next_param)? {
                 Some(replacement) => {
                     plan.unique_ids += 1;
@@ -240,6 +268,7 @@ impl<'a> StatementRewrite<'a> {
 
         self.split_insert(&mut plan)?;
         self.sharding_key_update(&mut plan)?;
+        self.cross_shard_subquery(&mut plan)?;
 
         Ok(plan)
     }
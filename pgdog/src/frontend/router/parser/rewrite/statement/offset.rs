@@ -6,8 +6,9 @@ use pg_query::{
 #[cfg(feature = "new_parser")]
 use pg_raw_parse::{ConstValue, Node, Owned, StmtList, nodes};
 
-use crate::frontend::ClientRequest;
+use crate::frontend::router::parser::Ast;
 use crate::frontend::router::parser::Limit;
+use crate::frontend::{ClientRequest, PreparedStatements};
 use crate::net::ProtocolMessage;
 use crate::net::messages::bind::{Format, Parameter};
 
@@ -16,11 +17,28 @@ use super::*;
 #[derive(Debug, Clone, PartialEq)]
 pub(crate) struct OffsetPlan {
     pub(crate) limit: Limit,
+    /// Parameter number of the LIMIT, 0 if it's a literal or the query doesn't have one.
     pub(crate) limit_param: usize,
     pub(crate) offset_param: usize,
 }
 
 impl OffsetPlan {
+    fn new(limit: Option<LimitValueInfo>, offset: LimitValueInfo) -> Self {
+        Self {
+            limit: Limit {
+                limit: limit.as_ref().and_then(|limit| limit.literal()),
+                offset: offset.literal(),
+            },
+            limit_param: limit.as_ref().map_or(0, |limit| limit.param_index()),
+            offset_param: offset.param_index(),
+        }
+    }
+
+    /// The query has a LIMIT clause.
+    fn has_limit(&self) -> bool {
+        self.limit.limit.is_some() || self.limit_param > 0
+    }
+
     pub(super) fn apply_after_parser(&self, request: &mut ClientRequest) -> Result<(), Error> {
         let route = match request.route.as_mut() {
             Some(route) => route,
@@ -37,7 +55,7 @@ impl OffsetPlan {
 
         for message in request.messages.iter_mut() {
             if let ProtocolMessage::Bind(bind) = message {
-                if limit_val.is_none() {
+                if limit_val.is_none() && self.limit_param > 0 {
                     let idx = self.limit_param - 1;
                     limit_val = Some(
                         bind.parameter(idx)?
@@ -61,7 +79,7 @@ impl OffsetPlan {
                 let new_limit = limit_val.unwrap_or(0) + offset_val.unwrap_or(0);
 
                 // Overwrite parameterized limit.
-                if self.limit.limit.is_none() {
+                if self.limit.limit.is_none() && self.limit_param > 0 {
                     let idx = self.limit_param - 1;
                     let fmt = bind.parameter_format(idx)?;
                     let param = match fmt {
@@ -88,37 +106,15 @@ impl OffsetPlan {
         }
 
         // Rewrite SQL if any value was a literal.
-        if self.limit.limit.is_some() || self.limit.offset.is_some() {
-            let new_limit = (limit_val.unwrap_or(0) + offset_val.unwrap_or(0)) as i32;
-            let ast = request.ast.as_ref().ok_or(Error::MissingAst)?;
-            #[cfg(not(feature = "new_parser"))]
-            let mut protobuf = ast.ast.protobuf.clone();
-            #[cfg(not(feature = "new_parser"))]
-            if rewrite_ast_limit_offset(&mut protobuf, new_limit) {
-                let result = pg_query::ParseResult::new(protobuf, "".into());
-                let new_sql = result.deparse()?;
-                for message in request.messages.iter_mut() {
-                    match message {
-                        ProtocolMessage::Query(q) => q.set_query(&new_sql),
-                        ProtocolMessage::Parse(p) => p.set_query(&new_sql),
-                        _ => {}
-                    }
-                }
-            }
-
-            #[cfg(feature = "new_parser")]
-            if let Some(rewritten) = rewrite_ast_limit_offset(&ast.ast, new_limit) {
-                let result = pg_raw_parse::deparse(&*rewritten)?;
-                let new_sql = result.as_str();
-                for message in request.messages.iter_mut() {
-                    match message {
-                        ProtocolMessage::Query(q) => q.set_query(new_sql),
-                        ProtocolMessage::Parse(p) => p.set_query(new_sql),
-                        _ => {}
-                    }
-                }
-            }
-        }
+        let limit = if self.limit.limit.is_none() && self.limit.offset.is_none() {
+            LimitRewrite::Keep
+        } else if self.has_limit() {
+            LimitRewrite::Limit((limit_val.unwrap_or(0) + offset_val.unwrap_or(0)) as i32)
+        } else {
+            LimitRewrite::Offset
+        };
+        let having = !route.aggregate_rewrite_plan().having().is_empty();
+        rewrite_select_sql(request.ast.as_ref(), &mut request.messages, limit, having)?;
 
         route.set_limit(Limit {
             limit: limit_val,
@@ -129,6 +125,126 @@ impl OffsetPlan {
     }
 }
 
+/// LIMIT and OFFSET rewrite for a cross-shard SELECT.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub(super) enum LimitRewrite {
+    /// Leave LIMIT and OFFSET as they are.
+    Keep,
+    /// Replace LIMIT with the given value and remove OFFSET.
+    Limit(i32),
+    /// Remove OFFSET. The query doesn't have a LIMIT.
+    Offset,
+}
+
+/// Rewrite the SQL of a cross-shard SELECT after routing.
+///
+/// OFFSET is removed, since it's applied by the proxy after merging rows from all shards.
+/// If `having` is set, HAVING is removed for the same reason, and so is LIMIT: groups
+/// filtered out on the merged rows would otherwise take up rows on each shard. A LIMIT
+/// parameter is set to NULL instead, which Postgres treats as no limit.
+pub(super) fn rewrite_select_sql(
+    ast: Option<&Ast>,
+    messages: &mut [ProtocolMessage],
+    limit: LimitRewrite,
+    having: bool,
+) -> Result<(), Error> {
+    if limit == LimitRewrite::Keep && !having {
+        return Ok(());
+    }
+
+    let ast = ast.ok_or(Error::MissingAst)?;
+
+    if having
+        && !matches!(limit, LimitRewrite::Limit(_))
+        && let Some(LimitValueInfo::Param(param)) = limit_count(ast)
+    {
+        for message in messages.iter_mut() {
+            if let ProtocolMessage::Bind(bind) = message {
+                bind.set_param(param - 1, Parameter::new_null());
+            }
+        }
+    }
+
+    #[cfg(not(feature = "new_parser"))]
+    let mut protobuf = ast.ast.protobuf.clone();
+    #[cfg(not(feature = "new_parser"))]
+    if rewrite_ast_select(&mut protobuf, limit, having) {
+        let result = pg_query::ParseResult::new(protobuf, "".into());
+        let new_sql = result.deparse()?;
+        set_query(messages, &new_sql);
+    }
+
+    #[cfg(feature = "new_parser")]
+    if let Some(rewritten) = rewrite_ast_select(&ast.ast, limit, having) {
+        let result = pg_raw_parse::deparse(&*rewritten)?;
+        set_query(messages, result.as_str());
+    }
+
+    Ok(())
+}
+
+/// Replace the SQL of the statement in the request.
+///
+/// A named prepared statement is executed as a rewritten copy instead,
+/// so executions routed to one shard keep the original. This works
+/// for requests that only send Bind too, since the copy is prepared
+/// from the global cache like any other statement.
+fn set_query(messages: &mut [ProtocolMessage], sql: &str) {
+    for message in messages.iter_mut() {
+        match message {
+            ProtocolMessage::Query(query) => query.set_query(sql),
+            ProtocolMessage::Parse(parse) => {
+                if let Some(name) = rewritten_statement(parse.name(), sql) {
+                    *parse = parse.rename(&name);
+                }
+                parse.set_query(sql);
+            }
+            ProtocolMessage::Bind(bind) => {
+                if let Some(name) = rewritten_statement(bind.statement(), sql) {
+                    bind.rename(name);
+                }
+            }
+            _ => {}
+        }
+    }
+}
+
+/// Global name of the rewritten copy of a prepared statement.
+fn rewritten_statement(name: &str, sql: &str) -> Option<String> {
+    if name.is_empty() {
+        return None;
+    }
+
+    let global = PreparedStatements::global();
+    let mut parse = global.read().parse(name)?;
+    parse.set_query(sql);
+    let name = global.write().insert_rewritten(&parse);
+
+    Some(name)
+}
+
+/// LIMIT of the SELECT statement.
+#[cfg(feature = "new_parser")]
+fn limit_count(ast: &Ast) -> Option<LimitValueInfo> {
+    match ast.ast.stmts().next() {
+        Some(Node::SelectStmt(select)) => extract_limit_value(select.limit_count()),
+        _ => None,
+    }
+}
+
+/// LIMIT of the SELECT statement.
+#[cfg(not(feature = "new_parser"))]
+fn limit_count(ast: &Ast) -> Option<LimitValueInfo> {
+    let stmt = ast.ast.protobuf.stmts.first()?.stmt.as_ref()?;
+    match &stmt.node {
+        Some(NodeEnum::SelectStmt(select)) => select
+            .limit_count
+            .as_ref()
+            .and_then(|node| extract_limit_value(&node.node)),
+        _ => None,
+    }
+}
+
 enum LimitValueInfo {
     Literal(usize),
     Param(usize),
@@ -178,24 +294,40 @@ fn extract_limit_value(node: &Option<pg_query::NodeEnum>) -> Option<LimitValueIn
 }
 
 #[cfg(feature = "new_parser")]
-fn rewrite_ast_limit_offset(ast: &StmtList, new_limit: i32) -> Option<Owned<nodes::SelectStmt>> {
+fn rewrite_ast_select(
+    ast: &StmtList,
+    limit: LimitRewrite,
+    having: bool,
+) -> Option<Owned<nodes::SelectStmt>> {
     let Some(Node::SelectStmt(select)) = ast.stmts().next() else {
         return None;
     };
 
+    let limit_param = matches!(select.limit_count(), Node::ParamRef(_));
+
     Some(make::owned(|mem| {
         let mut select = mem.make_unique(select);
-        select
-            .as_mut()
-            .set_limit_count(mem.make_a_const(ConstValue::Integer(new_limit)).uncast());
-        select.as_mut().set_limit_offset(mem.none());
+        if let LimitRewrite::Limit(new_limit) = limit {
+            select
+                .as_mut()
+                .set_limit_count(mem.make_a_const(ConstValue::Integer(new_limit)).uncast());
+        }
+        if limit != LimitRewrite::Keep {
+            select.as_mut().set_limit_offset(mem.none());
+        }
+        if having {
+            select.as_mut().set_having_clause(mem.none());
+            if matches!(limit, LimitRewrite::Limit(_)) || !limit_param {
+                select.as_mut().set_limit_count(mem.none());
+            }
+        }
         select
     }))
 }
 
 cfg_select! {
     not(feature = "new_parser") => {
-        fn rewrite_ast_limit_offset(ast: &mut ParseResult, new_limit: i32) -> bool {
+        fn rewrite_ast_select(ast: &mut ParseResult, limit: LimitRewrite, having: bool) -> bool {
             let raw_stmt = match ast.stmts.first_mut() {
                 Some(s) => s,
                 None => return false,
@@ -209,21 +341,38 @@ cfg_select! {
                 _ => return false,
             };
 
-            select.limit_count = Some(Box::new(pg_query::Node {
-                node: Some(NodeEnum::AConst(AConst {
-                    val: Some(Val::Ival(Integer { ival: new_limit })),
-                    isnull: false,
-                    location: -1i32,
-                })),
-            }));
-
-            select.limit_offset = Some(Box::new(pg_query::Node {
-                node: Some(NodeEnum::AConst(AConst {
-                    val: Some(Val::Ival(Integer { ival: 0 })),
-                    isnull: false,
-                    location: -1i32,
-                })),
-            }));
+            if let LimitRewrite::Limit(new_limit) = limit {
+                select.limit_count = Some(Box::new(pg_query::Node {
+                    node: Some(NodeEnum::AConst(AConst {
+                        val: Some(Val::Ival(Integer { ival: new_limit })),
+                        isnull: false,
+                        location: -1i32,
+                    })),
+                }));
+            }
+
+            if limit != LimitRewrite::Keep {
+                select.limit_offset = Some(Box::new(pg_query::Node {
+                    node: Some(NodeEnum::AConst(AConst {
+                        val: Some(Val::Ival(Integer { ival: 0 })),
+                        isnull: false,
+                        location: -1i32,
+                    })),
+                }));
+            }
+
+            if having {
+                select.having_clause = None;
+                let limit_param = matches!(
+                    select.limit_count.as_deref(),
+                    Some(pg_query::Node {
+                        node: Some(NodeEnum::ParamRef(_))
+                    })
+                );
+                if matches!(limit, LimitRewrite::Limit(_)) || !limit_param {
+                    select.limit_count = None;
+                }
+            }
 
             true
         }
@@ -238,21 +387,21 @@ impl StatementRewrite<'_> {
             return;
         }
 
-        let Some(limit_info) = extract_limit_value(select.limit_count()) else {
-            return;
+        // OFFSET without LIMIT is rewritten too.
+        let limit_info = match select.limit_count() {
+            Node::None => None,
+            node => {
+                let Some(limit_info) = extract_limit_value(node) else {
+                    return;
+                };
+                Some(limit_info)
+            }
         };
         let Some(offset_info) = extract_limit_value(select.limit_offset()) else {
             return;
         };
 
-        plan.offset = Some(OffsetPlan {
-            limit: Limit {
-                limit: limit_info.literal(),
-                offset: offset_info.literal(),
-            },
-            limit_param: limit_info.param_index(),
-            offset_param: offset_info.param_index(),
-        });
+        plan.offset = Some(OffsetPlan::new(limit_info, offset_info));
     }
 
     #[cfg(not(feature = "new_parser"))]
@@ -278,27 +427,21 @@ impl StatementRewrite<'_> {
             Some(node) => node,
             None => return Ok(()),
         };
-        let limit_node = match &select.limit_count {
-            Some(node) => node,
-            None => return Ok(()),
-        };
 
-        let limit_info = extract_limit_value(&limit_node.node);
-        let offset_info = extract_limit_value(&offset_node.node);
-
-        let (limit_info, offset_info) = match (limit_info, offset_info) {
-            (Some(l), Some(o)) => (l, o),
-            _ => return Ok(()),
+        // OFFSET without LIMIT is rewritten too.
+        let limit_info = match &select.limit_count {
+            Some(node) => match extract_limit_value(&node.node) {
+                Some(limit_info) => Some(limit_info),
+                None => return Ok(()),
+            },
+            None => None,
+        };
+        let offset_info = match extract_limit_value(&offset_node.node) {
+            Some(offset_info) => offset_info,
+            None => return Ok(()),
         };
 
-        plan.offset = Some(OffsetPlan {
-            limit: Limit {
-                limit: limit_info.literal(),
-                offset: offset_info.literal(),
-            },
-            limit_param: limit_info.param_index(),
-            offset_param: offset_info.param_index(),
-        });
+        plan.offset = Some(OffsetPlan::new(limit_info, offset_info));
 
         Ok(())
     }
@@ -443,9 +586,12 @@ mod tests {
     }
 
     #[test]
-    fn test_limit_offset_skipped_no_limit() {
+    fn test_limit_offset_detection_no_limit() {
         let plan = run_limit_offset("SELECT * FROM t OFFSET 5", &sharded_schema());
-        assert!(plan.offset.is_none());
+        let offset = plan.offset.unwrap();
+        assert_eq!(offset.limit.limit, None);
+        assert_eq!(offset.limit.offset, Some(5));
+        assert_eq!(offset.limit_param, 0);
     }
 
     #[test]
@@ -572,4 +718,153 @@ mod tests {
         assert_eq!(route.limit().limit, Some(10));
         assert_eq!(route.limit().offset, Some(5));
     }
+
+    #[test]
+    fn test_apply_after_parser_offset_without_limit() {
+        let plan = OffsetPlan {
+            limit: Limit {
+                limit: None,
+                offset: Some(5),
+            },
+            limit_param: 0,
+            offset_param: 0,
+        };
+        let mut request = ClientRequest::from(vec![ProtocolMessage::Query(Query::new(
+            "SELECT * FROM t ORDER BY id OFFSET 5",
+        ))]);
+        request.route = Some(cross_shard_route());
+        request.ast = Some(make_ast("SELECT * FROM t ORDER BY id OFFSET 5"));
+
+        plan.apply_after_parser(&mut request).unwrap();
+
+        let query = match &request.messages[0] {
+            ProtocolMessage::Query(q) => q.query().to_owned(),
+            _ => panic!("expected Query"),
+        };
+        #[cfg(feature = "new_parser")]
+        assert_eq!(query, "SELECT * FROM t ORDER BY id");
+        #[cfg(not(feature = "new_parser"))]
+        assert_eq!(query, "SELECT * FROM t ORDER BY id OFFSET 0");
+
+        let route = request.route.unwrap();
+        assert_eq!(route.limit().limit, None);
+        assert_eq!(route.limit().offset, Some(5));
+    }
+
+    #[test]
+    fn test_apply_after_parser_offset_param_without_limit() {
+        let plan = OffsetPlan {
+            limit: Limit {
+                limit: None,
+                offset: None,
+            },
+            limit_param: 0,
+            offset_param: 1,
+        };
+        let mut request = ClientRequest::from(vec![ProtocolMessage::Bind(Bind::new_params(
+            "",
+            &[Parameter::new(b"5")],
+        ))]);
+        request.route = Some(cross_shard_route());
+
+        plan.apply_after_parser(&mut request).unwrap();
+
+        if let ProtocolMessage::Bind(bind) = &request.messages[0] {
+            assert_eq!(bind.params_raw()[0].data.as_ref(), b"0");
+        } else {
+            panic!("expected Bind");
+        }
+
+        let route = request.route.unwrap();
+        assert_eq!(route.limit().limit, None);
+        assert_eq!(route.limit().offset, Some(5));
+    }
+
+    #[test]
+    fn test_rewrite_select_sql_having() {
+        let sql = "SELECT a, count(*) FROM t GROUP BY a HAVING count(*) > 5 LIMIT 10 OFFSET 5";
+        let ast = make_ast(sql);
+        let mut messages = vec![ProtocolMessage::Query(Query::new(sql))];
+
+        rewrite_select_sql(Some(&ast), &mut messages, LimitRewrite::Limit(15), true).unwrap();
+
+        let query = match &messages[0] {
+            ProtocolMessage::Query(q) => q.query().to_owned(),
+            _ => panic!("expected Query"),
+        };
+        // LIMIT is applied after HAVING on the merged rows.
+        #[cfg(feature = "new_parser")]
+        assert_eq!(query, "SELECT a, count(*) FROM t GROUP BY a");
+        #[cfg(not(feature = "new_parser"))]
+        assert_eq!(query, "SELECT a, count(*) FROM t GROUP BY a OFFSET 0");
+
+        // Nothing to rewrite, AST isn't needed.
+        rewrite_select_sql(None, &mut messages, LimitRewrite::Keep, false).unwrap();
+    }
+
+    #[test]
+    fn test_rewrite_select_sql_having_limit_param() {
+        let sql = "SELECT a, count(*) FROM t GROUP BY a HAVING count(*) > 5 LIMIT $1";
+        let ast = make_ast(sql);
+        let mut messages = vec![
+            ProtocolMessage::Parse(Parse::new_anonymous(sql)),
+            ProtocolMessage::Bind(Bind::new_params("", &[Parameter::new(b"10")])),
+        ];
+
+        rewrite_select_sql(Some(&ast), &mut messages, LimitRewrite::Keep, true).unwrap();
+
+        let sql = match &messages[0] {
+            ProtocolMessage::Parse(p) => p.query().to_owned(),
+            _ => panic!("expected Parse"),
+        };
+        assert_eq!(sql, "SELECT a, count(*) FROM t GROUP BY a LIMIT $1");
+
+        match &messages[1] {
+            ProtocolMessage::Bind(bind) => assert!(bind.parameter(0).unwrap().unwrap().is_null()),
+            _ => panic!("expected Bind"),
+        }
+    }
+
+    #[test]
+    fn test_rewrite_select_sql_having_prepared() {
+        let sql = "SELECT a, count(*) FROM t GROUP BY a HAVING count(*) > 5";
+        let ast = make_ast(sql);
+        let mut parse = Parse::named("test_having_prepared", sql);
+        PreparedStatements::new().insert(&mut parse);
+        let name = parse.name().to_owned();
+
+        // Statement was prepared earlier, client only sends Bind.
+        let mut messages = vec![ProtocolMessage::Bind(Bind::new_statement(&name))];
+        rewrite_select_sql(Some(&ast), &mut messages, LimitRewrite::Keep, true).unwrap();
+
+        let rewritten = match &messages[0] {
+            ProtocolMessage::Bind(bind) => bind.statement().to_owned(),
+            _ => panic!("expected Bind"),
+        };
+        assert_ne!(rewritten, name);
+
+        let global = PreparedStatements::global();
+        assert_eq!(
+            global.read().parse(&rewritten).unwrap().query(),
+            "SELECT a, count(*) FROM t GROUP BY a"
+        );
+        // Executions on one shard still run the original.
+        assert_eq!(global.read().parse(&name).unwrap().query(), sql);
+
+        // Parse and Bind in the same request use the same copy.
+        let mut messages = vec![
+            ProtocolMessage::Parse(parse.clone()),
+            ProtocolMessage::Bind(Bind::new_statement(&name)),
+        ];
+        rewrite_select_sql(Some(&ast), &mut messages, LimitRewrite::Keep, true).unwrap();
+
+        match &messages[0] {
+            ProtocolMessage::Parse(parse) => assert_eq!(parse.name(), rewritten),
+            _ => panic!("expected Parse"),
+        }
+        match &messages[1] {
+            ProtocolMessage::Bind(bind) => assert_eq!(bind.statement(), rewritten),
+            _ => panic!("expected Bind"),
+        }
+    }
 }
@@ -4,8 +4,10 @@ use crate::net::{Bind, Parse, ProtocolMessage, Query};
 use crate::unique_id::UniqueId;
 
 use super::insert::build_split_requests;
-use super::offset::OffsetPlan;
-use super::{Error, InsertSplit, ShardingKeyUpdate, aggregate::AggregateRewritePlan};
+use super::offset::{LimitRewrite, OffsetPlan, rewrite_select_sql};
+use super::{
+    CrossShardSubquery, Error, InsertSplit, ShardingKeyUpdate, aggregate::AggregateRewritePlan,
+};
 
 /// Statement rewrite plan.
 ///
@@ -46,6 +48,10 @@ pub struct RewritePlan {
 
     /// Limit/offset pagination.
     pub(crate) offset: Option<OffsetPlan>,
+
+    /// Subquery reading a sharded table, executed
+    /// before the statement.
+    pub(crate) subquery: Option<CrossShardSubquery>,
 }
 
 #[derive(Debug, Clone)]
@@ -53,6 +59,7 @@ pub(crate) enum RewriteResult {
     InPlace { offset: Option<OffsetPlan> },
     InsertSplit(Vec<ClientRequest>),
     ShardingKeyUpdate(ShardingKeyUpdate),
+    Subquery(CrossShardSubquery),
 }
 
 impl RewriteResult {
@@ -61,9 +68,25 @@ impl RewriteResult {
             Self::InPlace {
                 offset: Some(offset),
             } => offset.apply_after_parser(request),
+            Self::InPlace { offset: None } => Self::strip_having(request),
             _ => Ok(()),
         }
     }
+
+    /// Remove HAVING from a cross-shard query. Groups are filtered
+    /// by the proxy once rows from all shards are combined.
+    fn strip_having(request: &mut ClientRequest) -> Result<(), Error> {
+        let having = request.route.as_ref().is_some_and(|route| {
+            route.is_cross_shard() && !route.aggregate_rewrite_plan().having().is_empty()
+        });
+
+        rewrite_select_sql(
+            request.ast.as_ref(),
+            &mut request.messages,
+            LimitRewrite::Keep,
+            having,
+        )
+    }
 }
 
 impl RewritePlan {
@@ -79,6 +102,7 @@ impl RewritePlan {
             && self.aggregates.is_noop()
             && self.sharding_key_update.is_none()
             && self.offset.is_none()
+            && self.subquery.is_none()
     }
 
     /// Apply the rewrite plan to a Bind message by appending generated unique IDs.
@@ -155,6 +179,12 @@ impl RewritePlan {
             ));
         }
 
+        if let Some(subquery) = &self.subquery
+            && request.is_executable()
+        {
+            return Ok(RewriteResult::Subquery(subquery.clone()));
+        }
+
         Ok(RewriteResult::InPlace {
             offset: self.offset.clone(),
         })
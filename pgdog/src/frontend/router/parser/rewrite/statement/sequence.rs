@@ -0,0 +1,453 @@
+//! Serve `nextval()` column defaults of unsharded tables from the sequence cache.
+//!
+//! Cached values are sent to Postgres as literals, so `currval()` and `lastval()`
+//! in the same session don't see them. Statements calling either function on
+//! a sequence served from the cache are rejected instead of returning a stale value.
+
+#[cfg(not(feature = "new_parser"))]
+use pg_query::protobuf::ResTarget;
+#[cfg(not(feature = "new_parser"))]
+use pg_query::{Node as PgNode, NodeEnum};
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::{Node, NodeMut, make, nodes};
+
+use super::{Error, StatementRewrite};
+use crate::backend::sequence_cache::{self, nextval_sequence};
+use crate::frontend::router::parser::Value;
+
+impl StatementRewrite<'_> {
+    /// Replace `nextval()` column defaults in `INSERT` statements into
+    /// unsharded tables with values allocated in advance.
+    ///
+    /// Columns set to `DEFAULT` are replaced for as many rows as the cache
+    /// has values for. Missing columns are added only if the cache has values
+    /// for all rows. Everything else is left to Postgres.
+    ///
+    /// Prepared statements are reused, so values are only served to queries
+    /// sent over the simple protocol.
+    #[cfg(feature = "new_parser")]
+    pub(super) fn serve_cached_sequences<'a>(
+        &mut self,
+        mut node: nodes::InsertStmtMut<'a, '_>,
+        mem: make::MemoryToken<'a>,
+    ) -> Result<(), Error> {
+        let block = self.schema.rewrite.sequence_cache;
+
+        if !self.sequence_cache_enabled() || self.extended {
+            return Ok(());
+        }
+
+        let (table, _) = self.get_insert_table(&node);
+
+        let Some(relation) = self.db_schema.table(table, self.user, self.search_path) else {
+            return Ok(());
+        };
+
+        let insert_columns = self.get_insert_column_names_ordered(&node);
+
+        // Columns with a nextval() default and their position in the INSERT, if present.
+        let sequences: Vec<(&str, String, Option<usize>)> = relation
+            .columns()
+            .values()
+            .filter_map(|col| {
+                let sequence = nextval_sequence(&col.column_default)?;
+                let sequence = sequence_cache::qualify(relation.schema(), sequence);
+                let position = insert_columns.get_index_of(col.column_name.as_str());
+                Some((col.column_name.as_str(), sequence, position))
+            })
+            .collect();
+
+        let database = self.schema.database.as_str();
+
+        for (column, sequence, position) in sequences {
+            let NodeMut::SelectStmt(mut select_stmt) = node.select_stmt_mut() else {
+                return Ok(()); // DEFAULT VALUES
+            };
+
+            if let Some(position) = position {
+                for list in select_stmt.values_lists_mut() {
+                    let mut list = list.expect_node_list();
+                    if matches!(list.get(position), Some(Node::SetToDefault(..)))
+                        && let Some(value) = sequence_cache::next(database, &sequence, block)
+                    {
+                        list.set(position, Self::literal_bigint(mem, value));
+                        self.rewritten = true;
+                    }
+                }
+            } else {
+                let rows = select_stmt.values_lists_mut().into_iter().count();
+                if rows == 0 {
+                    continue; // INSERT ... SELECT
+                }
+
+                let Some(values) = sequence_cache::take(database, &sequence, rows, block) else {
+                    continue;
+                };
+
+                for (list, value) in select_stmt.values_lists_mut().into_iter().zip(values) {
+                    list.expect_node_list()
+                        .push(mem, Self::literal_bigint(mem, value));
+                }
+
+                node.cols_mut().push(
+                    mem,
+                    mem.make_res_target(Some(column), mem.empty(), mem.none())
+                        .uncast(),
+                );
+                self.rewritten = true;
+            }
+        }
+
+        Ok(())
+    }
+
+    /// The sequence cache is enabled for this database.
+    pub(super) fn sequence_cache_enabled(&self) -> bool {
+        self.schema.rewrite.sequence_cache > 0 && self.schema.shards == 1
+    }
+
+    /// Reject `currval()` and `lastval()` calls, which can't see values served
+    /// from the sequence cache, if the cache serves values of the sequence.
+    #[cfg(feature = "new_parser")]
+    pub(super) fn check_currval(node: Node<'_>, database: &str) -> Result<(), Error> {
+        let Node::FuncCall(func) = node else {
+            return Ok(());
+        };
+
+        let name = match func.funcname().iter().filter_map(Node::as_str).last() {
+            Some(name @ ("currval" | "lastval")) => name,
+            _ => return Ok(()),
+        };
+
+        // lastval() or a sequence name we can't read.
+        let sequence = match func.args().into_iter().next().map(Value::try_from) {
+            Some(Ok(Value::String(sequence))) => Some(sequence),
+            _ => None,
+        };
+
+        if sequence_cache::managed(database, sequence) {
+            Err(Error::SequenceCacheCurrval(name.into()))
+        } else {
+            Ok(())
+        }
+    }
+
+    cfg_select! {
+        not(feature = "new_parser") => {
+            pub(super) fn check_currval(node: &PgNode, database: &str) -> Result<(), Error> {
+                let Some(NodeEnum::FuncCall(func)) = &node.node else {
+                    return Ok(());
+                };
+
+                let name = func.funcname.last().and_then(|n| match &n.node {
+                    Some(NodeEnum::String(s)) => Some(s.sval.as_str()),
+                    _ => None,
+                });
+
+                let name = match name {
+                    Some(name @ ("currval" | "lastval")) => name,
+                    _ => return Ok(()),
+                };
+
+                // lastval() or a sequence name we can't read.
+                let sequence = match func.args.first().map(Value::try_from) {
+                    Some(Ok(Value::String(sequence))) => Some(sequence),
+                    _ => None,
+                };
+
+                if sequence_cache::managed(database, sequence) {
+                    Err(Error::SequenceCacheCurrval(name.into()))
+                } else {
+                    Ok(())
+                }
+            }
+
+            pub(super) fn serve_cached_sequences(&mut self) -> Result<(), Error> {
+                let block = self.schema.rewrite.sequence_cache;
+
+                if !self.sequence_cache_enabled() || self.extended {
+                    return Ok(());
+                }
+
+                let Some((table, _)) = self.get_insert_table() else {
+                    return Ok(());
+                };
+
+                let Some(relation) = self.db_schema.table(table, self.user, self.search_path) else {
+                    return Ok(());
+                };
+
+                let insert_columns = self.get_insert_column_names_ordered();
+
+                // Columns with a nextval() default and their position in the INSERT, if present.
+                let sequences: Vec<(&str, String, Option<usize>)> = relation
+                    .columns()
+                    .values()
+                    .filter_map(|col| {
+                        let sequence = nextval_sequence(&col.column_default)?;
+                        let sequence = sequence_cache::qualify(relation.schema(), sequence);
+                        let position = insert_columns.get_index_of(col.column_name.as_str());
+                        Some((col.column_name.as_str(), sequence, position))
+                    })
+                    .collect();
+
+                let database = self.schema.database.as_str();
+
+                let Some(NodeEnum::InsertStmt(insert)) = self
+                    .stmt
+                    .stmts
+                    .first_mut()
+                    .and_then(|stmt| stmt.stmt.as_mut())
+                    .and_then(|node| node.node.as_mut())
+                else {
+                    return Ok(());
+                };
+
+                let mut rewritten = false;
+
+                for (column, sequence, position) in sequences {
+                    let Some(NodeEnum::SelectStmt(select_stmt)) = insert
+                        .select_stmt
+                        .as_mut()
+                        .and_then(|select| select.node.as_mut())
+                    else {
+                        break; // DEFAULT VALUES
+                    };
+
+                    if let Some(position) = position {
+                        for values_node in &mut select_stmt.values_lists {
+                            if let Some(NodeEnum::List(list)) = &mut values_node.node
+                                && let Some(NodeEnum::SetToDefault(_)) =
+                                    list.items.get(position).and_then(|item| item.node.as_ref())
+                                && let Some(value) = sequence_cache::next(database, &sequence, block)
+                            {
+                                list.items[position] = Self::literal_bigint(value);
+                                rewritten = true;
+                            }
+                        }
+                    } else {
+                        let rows = select_stmt.values_lists.len();
+                        if rows == 0 {
+                            continue; // INSERT ... SELECT
+                        }
+
+                        let Some(values) = sequence_cache::take(database, &sequence, rows, block) else {
+                            continue;
+                        };
+
+                        for (values_node, value) in select_stmt.values_lists.iter_mut().zip(values) {
+                            if let Some(NodeEnum::List(list)) = &mut values_node.node {
+                                list.items.push(Self::literal_bigint(value));
+                            }
+                        }
+
+                        insert.cols.push(PgNode {
+                            node: Some(NodeEnum::ResTarget(Box::new(ResTarget {
+                                name: column.to_string(),
+                                ..Default::default()
+                            }))),
+                        });
+                        rewritten = true;
+                    }
+                }
+
+                if rewritten {
+                    self.rewritten = true;
+                }
+
+                Ok(())
+            }
+        }
+        _ => {}
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use indexmap::IndexMap;
+    use pgdog_config::Rewrite;
+    use std::collections::HashMap;
+
+    use super::*;
+    use crate::backend::ShardingSchema;
+    use crate::backend::schema::columns::StatsColumn as SchemaColumn;
+    use crate::backend::schema::{Relation, Schema};
+    use crate::frontend::PreparedStatements;
+    use crate::frontend::router::parser::StatementRewriteContext;
+
+    fn make_schema() -> Schema {
+        let mut columns = IndexMap::new();
+        for (position, (name, default)) in
+            [("id", "nextval('users_id_seq'::regclass)"), ("name", "")]
+                .into_iter()
+                .enumerate()
+        {
+            columns.insert(
+                name.to_string(),
+                SchemaColumn {
+                    table_catalog: "test".into(),
+                    table_schema: "public".into(),
+                    table_name: "users".into(),
+                    column_name: name.into(),
+                    column_default: default.into(),
+                    is_nullable: position > 0,
+                    data_type: "bigint".into(),
+                    ordinal_position: position as i32 + 1,
+                    is_primary_key: position == 0,
+                    foreign_keys: Vec::new(),
+                }
+                .into(),
+            );
+        }
+        let relation = Relation::test_table("public", "users", columns);
+        let relations = HashMap::from([(("public".into(), "users".into()), relation)]);
+        Schema::from_parts(vec!["public".into()], relations)
+    }
+
+    fn sharding_schema(database: &str) -> ShardingSchema {
+        ShardingSchema {
+            database: database.into(),
+            shards: 1,
+            rewrite: Rewrite {
+                sequence_cache: 10,
+                ..Default::default()
+            },
+            ..Default::default()
+        }
+    }
+
+    #[cfg(feature = "new_parser")]
+    fn try_rewrite_sql(sql: &str, schema: &ShardingSchema) -> Result<String, Error> {
+        let db_schema = make_schema();
+        let ast = pg_raw_parse::parse(sql).unwrap();
+        let mut prepared = PreparedStatements::default();
+        let mut rewriter = StatementRewrite::new(StatementRewriteContext {
+            extended: false,
+            prepared: false,
+            prepared_statements: &mut prepared,
+            schema,
+            db_schema: &db_schema,
+            user: "",
+            search_path: None,
+        });
+        let ast = make::try_owned(|mem| {
+            let mut copy = mem.make_unique(&*ast.into_inner());
+            rewriter.maybe_rewrite(copy.as_mut().into_iter().next().unwrap(), mem)?;
+            Ok::<_, Error>(copy)
+        })?;
+        Ok(pg_raw_parse::deparse_stmts(&*ast).unwrap())
+    }
+
+    cfg_select! {
+        not(feature = "new_parser") => {
+            fn try_rewrite_sql(sql: &str, schema: &ShardingSchema) -> Result<String, Error> {
+                let db_schema = make_schema();
+                let mut ast = pg_query::parse(sql).unwrap().protobuf;
+                let mut prepared = PreparedStatements::default();
+                let mut rewriter = StatementRewrite::new(StatementRewriteContext {
+                    stmt: &mut ast,
+                    extended: false,
+                    prepared: false,
+                    prepared_statements: &mut prepared,
+                    schema,
+                    db_schema: &db_schema,
+                    user: "",
+                    search_path: None,
+                });
+                let plan = rewriter.maybe_rewrite()?;
+                Ok(plan.stmt.unwrap_or_else(|| ast.deparse().unwrap()))
+            }
+        }
+        _ => {}
+    }
+
+    fn rewrite_sql(sql: &str, schema: &ShardingSchema) -> String {
+        try_rewrite_sql(sql, schema).unwrap()
+    }
+
+    fn rewrite_err(sql: &str, schema: &ShardingSchema) -> Error {
+        try_rewrite_sql(sql, schema).unwrap_err()
+    }
+
+    #[test]
+    fn test_serve_cached_sequences() {
+        let schema = sharding_schema("test_serve_cached_sequences");
+        sequence_cache::extend(
+            &schema.database,
+            &sequence_cache::qualify("public", "users_id_seq"),
+            &[100, 101, 102],
+        );
+
+        let sql = rewrite_sql("INSERT INTO users (name) VALUES ('a'), ('b')", &schema);
+        assert!(sql.contains("id"), "{}", sql);
+        assert!(sql.contains("100") && sql.contains("101"), "{}", sql);
+
+        let sql = rewrite_sql(
+            "INSERT INTO users (id, name) VALUES (DEFAULT, 'c'), (DEFAULT, 'd')",
+            &schema,
+        );
+        assert!(sql.contains("102"), "{}", sql);
+        assert!(sql.contains("DEFAULT"), "{}", sql);
+
+        // Cache is empty, Postgres calls nextval().
+        let sql = rewrite_sql("INSERT INTO users (name) VALUES ('e')", &schema);
+        assert_eq!(sql, "INSERT INTO users (name) VALUES ('e')");
+    }
+
+    #[test]
+    fn test_serve_cached_sequences_disabled() {
+        let mut schema = sharding_schema("test_serve_cached_sequences_disabled");
+        schema.rewrite.sequence_cache = 0;
+        sequence_cache::extend(
+            &schema.database,
+            &sequence_cache::qualify("public", "users_id_seq"),
+            &[100],
+        );
+
+        let sql = rewrite_sql("INSERT INTO users (name) VALUES ('a')", &schema);
+        assert_eq!(sql, "INSERT INTO users (name) VALUES ('a')");
+    }
+
+    #[test]
+    fn test_check_currval() {
+        let schema = sharding_schema("test_check_currval");
+
+        // No sequences are served from the cache yet.
+        assert_eq!(rewrite_sql("SELECT lastval()", &schema), "SELECT lastval()");
+
+        sequence_cache::extend(
+            &schema.database,
+            &sequence_cache::qualify("public", "users_id_seq"),
+            &[1],
+        );
+
+        for (sql, name) in [
+            ("SELECT currval('users_id_seq')", "currval"),
+            ("SELECT pg_catalog.currval('users_id_seq')", "currval"),
+            ("SELECT lastval()", "lastval"),
+            ("SELECT * FROM users WHERE id = lastval()", "lastval"),
+        ] {
+            let err = rewrite_err(sql, &schema);
+            assert!(
+                matches!(&err, Error::SequenceCacheCurrval(func) if func == name),
+                "{}: {}",
+                sql,
+                err
+            );
+        }
+
+        // Sequences not served from the cache.
+        assert_eq!(
+            rewrite_sql("SELECT currval('orders_id_seq')", &schema),
+            "SELECT currval('orders_id_seq')"
+        );
+        assert_eq!(
+            rewrite_sql("SELECT currval('app.users_id_seq')", &schema),
+            "SELECT currval('app.users_id_seq')"
+        );
+
+        let mut schema = sharding_schema("test_check_currval");
+        schema.rewrite.sequence_cache = 0;
+        assert_eq!(rewrite_sql("SELECT lastval()", &schema), "SELECT lastval()");
+    }
+}
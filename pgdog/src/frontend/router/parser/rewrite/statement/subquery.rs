@@ -0,0 +1,667 @@
+//! Uncorrelated `IN (SELECT ...)` subqueries reading sharded tables.
+//!
+//! Each shard only has its own rows, so if we send the query to all shards,
+//! the subquery returns a different (and incomplete) result on each one.
+//! Instead, we execute the subquery first, collecting rows from all shards, and
+//! pass them to the outer query as an array:
+//!
+//! ```sql
+//! SELECT * FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > $1)
+//! ```
+//!
+//! becomes
+//!
+//! ```sql
+//! SELECT user_id FROM orders WHERE amount > $1
+//! SELECT * FROM users WHERE id = ANY($1)
+//! ```
+//!
+//! Only the first subquery found in the top-level `AND` conditions of a `SELECT`
+//! is rewritten. Subqueries referencing tables of the outer query (correlated)
+//! can't run on their own and are sent to the shards unchanged.
+//!
+#[cfg(not(feature = "new_parser"))]
+use std::collections::HashSet;
+
+#[cfg(feature = "new_parser")]
+use indexmap::IndexSet;
+#[cfg(not(feature = "new_parser"))]
+use pg_query::{
+    Node as PgNode, NodeEnum,
+    protobuf::{
+        AExpr, AExprKind, BoolExprType, ParamRef, SelectStmt, String as PgString, SubLink,
+        SubLinkType,
+    },
+};
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::make::owned;
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::{Node, deparse, nodes, transform, walk};
+#[cfg(not(feature = "new_parser"))]
+use pgdog_config::QueryParserEngine;
+use pgdog_config::RewriteMode;
+
+#[cfg(not(feature = "new_parser"))]
+use super::visitor::visit_and_mutate_node;
+use super::*;
+use crate::{
+    frontend::{
+        ClientRequest,
+        router::{
+            Ast,
+            parser::{Column, StatementParser, Table},
+        },
+    },
+    net::{Bind, Describe, Execute, Format, Parse, ProtocolMessage, Sync, bind::Parameter},
+};
+
+/// Subquery executed before the statement that contains it.
+#[derive(Debug, Clone)]
+pub(crate) struct CrossShardSubquery {
+    /// The subquery, executed on its own.
+    pub(crate) subquery: Statement,
+    /// The original statement, with the subquery replaced by `= ANY($n)`.
+    pub(crate) outer: Statement,
+    /// Parameter in `outer.params` that receives the subquery rows.
+    values: u16,
+}
+
+impl CrossShardSubquery {
+    /// Build the outer statement request, passing the rows returned
+    /// by the subquery as a text array.
+    ///
+    /// The request uses the extended protocol, even if the original
+    /// statement didn't, so the values don't need to be escaped.
+    ///
+    pub(crate) fn build_request(
+        &self,
+        request: &ClientRequest,
+        values: &[Option<String>],
+    ) -> Result<ClientRequest, Error> {
+        let params = request.parameters()?;
+        let mut bind = Bind::new_statement("");
+
+        for number in &self.outer.params {
+            if *number == self.values {
+                bind.push_param(Parameter::new(array(values).as_bytes()), Format::Text);
+            } else {
+                let param = params
+                    .and_then(|p| p.parameter(*number as usize - 1).transpose())
+                    .ok_or(Error::MissingParameter(*number))??;
+                bind.push_param(param.parameter().clone(), param.format());
+            }
+        }
+
+        // Return columns in the format the client asked for.
+        if let Some(params) = params {
+            bind.set_results(params);
+        }
+
+        let mut req = ClientRequest::from(vec![
+            ProtocolMessage::from(Parse::new_anonymous(&self.outer.stmt)),
+            bind.into(),
+            Describe::new_portal("").into(),
+            Execute::new().into(),
+            Sync.into(),
+        ]);
+        req.ast = Some(self.outer.ast.clone());
+
+        Ok(req)
+    }
+}
+
+/// Text representation of a one-dimensional array, e.g. `{"1","2",NULL}`.
+fn array(values: &[Option<String>]) -> String {
+    let mut array = String::from("{");
+
+    for (idx, value) in values.iter().enumerate() {
+        if idx > 0 {
+            array.push(',');
+        }
+
+        match value {
+            Some(value) => {
+                array.push('"');
+                for c in value.chars() {
+                    if c == '"' || c == '\\' {
+                        array.push('\\');
+                    }
+                    array.push(c);
+                }
+                array.push('"');
+            }
+            None => array.push_str("NULL"),
+        }
+    }
+
+    array.push('}');
+    array
+}
+
+impl<'a> StatementRewrite<'a> {
+    /// Split a `SELECT` with an `IN (SELECT ...)` on a sharded table
+    /// into the subquery and the outer statement.
+    #[cfg(feature = "new_parser")]
+    pub(super) fn cross_shard_subquery(
+        &mut self,
+        stmt: &nodes::SelectStmt,
+        plan: &mut RewritePlan,
+    ) -> Result<(), Error> {
+        if self.schema.shards == 1 || self.schema.rewrite.subqueries == RewriteMode::Ignore {
+            return Ok(());
+        }
+
+        // Don't combine this with other rewrites.
+        if !plan.is_empty() {
+            return Ok(());
+        }
+
+        let Some(sublink) = self.find_subquery(stmt.where_clause()) else {
+            return Ok(());
+        };
+
+        if self.schema.rewrite.subqueries == RewriteMode::Error {
+            return Err(Error::CrossShardSubquery);
+        }
+
+        let Node::SelectStmt(subselect) = sublink.subselect() else {
+            return Ok(());
+        };
+        let location = sublink.location;
+        let values = plan.params + 1;
+
+        let mut params = IndexSet::new();
+        let subquery = owned(|mem| {
+            let mut select = mem.make_unique(subselect);
+            params = rewrite_params(select.as_mut().into());
+            mem.make_list(&[mem.make_raw_stmt(select.uncast())])
+        });
+
+        let subquery = Statement {
+            stmt: deparse(subquery.first().unwrap())?.as_str().to_owned(),
+            ast: Ast::from_raw_stmts(subquery),
+            params,
+        };
+
+        let mut params = IndexSet::new();
+        let outer = owned(|mem| {
+            let mut select = mem.make_unique(stmt);
+            transform::transform_node(
+                select.as_mut().into(),
+                &mut transform::TransformClosure::new(|node| match node.as_ref() {
+                    Node::SubLink(sublink) if sublink.location == location => {
+                        node.replace(
+                            mem.make_a_expr(
+                                nodes::A_Expr_Kind::AEXPR_OP_ANY,
+                                mem.make_list(&[mem.make_string(Some("=")).uncast()]),
+                                mem.make_unique(sublink.testexpr()),
+                                mem.make_param_ref(values as i32).uncast(),
+                            )
+                            .uncast(),
+                        );
+                        None
+                    }
+                    _ => Some(node),
+                }),
+            );
+            params = rewrite_params(select.as_mut().into());
+            mem.make_list(&[mem.make_raw_stmt(select.uncast())])
+        });
+
+        let outer = Statement {
+            stmt: deparse(outer.first().unwrap())?.as_str().to_owned(),
+            ast: Ast::from_raw_stmts(outer),
+            params,
+        };
+
+        plan.subquery = Some(CrossShardSubquery {
+            subquery,
+            outer,
+            values,
+        });
+
+        Ok(())
+    }
+
+    /// Find the first `IN (SELECT ...)` in the top-level `AND` conditions
+    /// that needs to be executed separately.
+    #[cfg(feature = "new_parser")]
+    fn find_subquery<'b>(&self, node: Node<'b>) -> Option<&'b nodes::SubLink> {
+        match node {
+            Node::BoolExpr(expr) if expr.boolop == nodes::BoolExprType::AND_EXPR => {
+                expr.args().iter().find_map(|arg| self.find_subquery(arg))
+            }
+
+            Node::SubLink(sublink)
+                if sublink.sub_link_type == nodes::SubLinkType::ANY_SUBLINK
+                    && sublink
+                        .oper_name()
+                        .into_iter()
+                        .all(|name| name.as_str() == Some("="))
+                    && matches!(sublink.testexpr(), Node::ColumnRef(_)) =>
+            {
+                let Node::SelectStmt(subselect) = sublink.subselect() else {
+                    return None;
+                };
+
+                let sharded =
+                    StatementParser::from_select(sublink.subselect(), None, self.schema, None)
+                        .is_sharded(self.db_schema, self.user, self.search_path);
+
+                (sharded && !is_correlated(subselect)).then_some(sublink)
+            }
+
+            _ => None,
+        }
+    }
+
+    /// Split a `SELECT` with an `IN (SELECT ...)` on a sharded table
+    /// into the subquery and the outer statement.
+    #[cfg(not(feature = "new_parser"))]
+    pub(super) fn cross_shard_subquery(&mut self, plan: &mut RewritePlan) -> Result<(), Error> {
+        if self.schema.shards == 1 || self.schema.rewrite.subqueries == RewriteMode::Ignore {
+            return Ok(());
+        }
+
+        // Don't combine this with other rewrites.
+        if !plan.is_empty() {
+            return Ok(());
+        }
+
+        let Some(NodeEnum::SelectStmt(stmt)) = self
+            .stmt
+            .stmts
+            .first()
+            .and_then(|stmt| stmt.stmt.as_ref().map(|stmt| stmt.node.as_ref()))
+            .flatten()
+        else {
+            return Ok(());
+        };
+
+        let values = plan.params + 1;
+        let mut outer = stmt.as_ref().clone();
+        let Some(subquery) = outer
+            .where_clause
+            .as_deref_mut()
+            .and_then(|where_clause| self.replace_subquery(where_clause, values))
+        else {
+            return Ok(());
+        };
+
+        if self.schema.rewrite.subqueries == RewriteMode::Error {
+            return Err(Error::CrossShardSubquery);
+        }
+
+        let engine = self.schema.query_parser_engine;
+
+        plan.subquery = Some(CrossShardSubquery {
+            subquery: statement(NodeEnum::SelectStmt(subquery), engine)?,
+            outer: statement(NodeEnum::SelectStmt(Box::new(outer)), engine)?,
+            values,
+        });
+
+        Ok(())
+    }
+
+    /// Replace the first `IN (SELECT ...)` in the top-level `AND` conditions
+    /// that needs to be executed separately with `= ANY($values)`,
+    /// returning the subquery.
+    #[cfg(not(feature = "new_parser"))]
+    fn replace_subquery(&self, node: &mut PgNode, values: u16) -> Option<Box<SelectStmt>> {
+        if let Some(NodeEnum::BoolExpr(expr)) = node.node.as_mut() {
+            if expr.boolop() != BoolExprType::AndExpr {
+                return None;
+            }
+
+            return expr
+                .args
+                .iter_mut()
+                .find_map(|arg| self.replace_subquery(arg, values));
+        }
+
+        let Some(NodeEnum::SubLink(sublink)) = node.node.as_ref() else {
+            return None;
+        };
+        let subquery = self.subquery(sublink)?.clone();
+        let column = sublink.testexpr.clone();
+
+        node.node = Some(NodeEnum::AExpr(Box::new(AExpr {
+            kind: AExprKind::AexprOpAny.into(),
+            name: vec![PgNode {
+                node: Some(NodeEnum::String(PgString { sval: "=".into() })),
+            }],
+            lexpr: column,
+            rexpr: Some(Box::new(PgNode {
+                node: Some(NodeEnum::ParamRef(ParamRef {
+                    number: values as i32,
+                    ..Default::default()
+                })),
+            })),
+            ..Default::default()
+        })));
+
+        Some(Box::new(subquery))
+    }
+
+    /// Get the subquery of `column IN (SELECT ...)` if it reads
+    /// a sharded table and doesn't reference the outer query.
+    #[cfg(not(feature = "new_parser"))]
+    fn subquery<'b>(&self, sublink: &'b SubLink) -> Option<&'b SelectStmt> {
+        let equals = sublink
+            .oper_name
+            .iter()
+            .all(|name| matches!(&name.node, Some(NodeEnum::String(name)) if name.sval == "="));
+        let column = matches!(
+            sublink
+                .testexpr
+                .as_deref()
+                .and_then(|expr| expr.node.as_ref()),
+            Some(NodeEnum::ColumnRef(_))
+        );
+
+        if sublink.sub_link_type() != SubLinkType::AnySublink || !equals || !column {
+            return None;
+        }
+
+        let Some(NodeEnum::SelectStmt(subselect)) = sublink
+            .subselect
+            .as_deref()
+            .and_then(|node| node.node.as_ref())
+        else {
+            return None;
+        };
+
+        let sharded = StatementParser::from_select(subselect, None, self.schema, None).is_sharded(
+            self.db_schema,
+            self.user,
+            self.search_path,
+        );
+
+        (sharded && !is_correlated(subselect)).then_some(subselect)
+    }
+}
+
+/// The subquery references a table that's not in its own FROM clause,
+/// so it must come from the outer query.
+///
+/// Unqualified columns can't be attributed to a table without the schema,
+/// so they are assumed to belong to the subquery.
+#[cfg(feature = "new_parser")]
+fn is_correlated(subselect: &nodes::SelectStmt) -> bool {
+    let mut tables = vec![];
+    let mut references = vec![];
+
+    walk::walk(Node::from(subselect), |node| match node {
+        Node::RangeVar(range_var) => {
+            let table = Table::from(range_var);
+            tables.push(table.alias.unwrap_or(table.name));
+        }
+        Node::RangeSubselect(range) => {
+            if let Some(alias) = range.alias().and_then(|alias| alias.aliasname()) {
+                tables.push(alias);
+            }
+        }
+        Node::ColumnRef(column) => {
+            if let Some(table) = Column::try_from(column).ok().and_then(|c| c.table) {
+                references.push(table);
+            }
+        }
+        _ => {}
+    });
+
+    references.iter().any(|table| !tables.contains(table))
+}
+
+/// The subquery references a table that's not in its own FROM clause,
+/// so it must come from the outer query.
+///
+/// Unqualified columns can't be attributed to a table without the schema,
+/// so they are assumed to belong to the subquery.
+#[cfg(not(feature = "new_parser"))]
+fn is_correlated(subselect: &SelectStmt) -> bool {
+    let mut tables = HashSet::new();
+    let mut references = HashSet::new();
+
+    // The visitor needs a mutable node, but we don't change anything.
+    let mut node = PgNode {
+        node: Some(NodeEnum::SelectStmt(Box::new(subselect.clone()))),
+    };
+    let _: Result<(), std::convert::Infallible> =
+        visit_and_mutate_node(&mut node, &mut |node: &mut PgNode| {
+            match &node.node {
+                Some(NodeEnum::RangeVar(range_var)) => {
+                    let table = Table::from(range_var);
+                    tables.insert(table.alias.unwrap_or(table.name).to_owned());
+                }
+                Some(NodeEnum::RangeSubselect(range)) => {
+                    if let Some(ref alias) = range.alias {
+                        tables.insert(alias.aliasname.clone());
+                    }
+                }
+                Some(NodeEnum::ColumnRef(_)) => {
+                    if let Some(table) = Column::try_from(&node.node).ok().and_then(|c| c.table) {
+                        references.insert(table.to_owned());
+                    }
+                }
+                _ => {}
+            }
+            Ok(None)
+        });
+
+    !references.is_subset(&tables)
+}
+
+/// Build a statement, numbering its parameters from $1.
+#[cfg(not(feature = "new_parser"))]
+fn statement(node: NodeEnum, engine: QueryParserEngine) -> Result<Statement, Error> {
+    let mut result = parse_result(node);
+    let params = rewrite_params(&mut result)?;
+    let result = pg_query::ParseResult::new(result, "".into());
+
+    Ok(Statement {
+        stmt: match engine {
+            QueryParserEngine::PgQueryProtobuf => result.deparse()?,
+            QueryParserEngine::PgQueryRaw => result.deparse_raw()?,
+        },
+        ast: Ast::from_parse_result(result),
+        params,
+    })
+}
+
+#[cfg(test)]
+mod test {
+    #[cfg(feature = "new_parser")]
+    use indexmap::indexset;
+    #[cfg(not(feature = "new_parser"))]
+    use pg_query::parse;
+    use pgdog_config::Rewrite;
+
+    use crate::backend::schema::Schema;
+    use crate::backend::{ShardedTables, replication::ShardedSchemas};
+    use crate::frontend::router::sharding::ShardedTable;
+    use crate::net::Protocol;
+
+    use super::*;
+
+    #[cfg(not(feature = "new_parser"))]
+    macro_rules! indexset {
+        ($($t:tt)*) => {
+            vec![$($t)*]
+        };
+    }
+
+    fn schema(mode: RewriteMode) -> ShardingSchema {
+        ShardingSchema {
+            shards: 2,
+            tables: ShardedTables::new(
+                vec![ShardedTable {
+                    database: "pgdog".into(),
+                    name: Some("sharded".into()),
+                    column: "id".into(),
+                    ..Default::default()
+                }],
+                vec![],
+                false,
+                pgdog_config::SystemCatalogsBehavior::default(),
+            ),
+            schemas: ShardedSchemas::new(vec![], 1),
+            rewrite: Rewrite {
+                enabled: true,
+                subqueries: mode,
+                ..Default::default()
+            },
+            ..Default::default()
+        }
+    }
+
+    fn run_test_mode(
+        query: &str,
+        params: u16,
+        mode: RewriteMode,
+    ) -> Result<Option<CrossShardSubquery>, Error> {
+        #[cfg(not(feature = "new_parser"))]
+        let mut stmt_old = parse(query)?;
+        #[cfg(feature = "new_parser")]
+        let stmt = pg_raw_parse::parse(query)?;
+        let schema = schema(mode);
+        let db_schema = Schema::default();
+        let mut stmts = PreparedStatements::new();
+
+        let ctx = StatementRewriteContext {
+            #[cfg(not(feature = "new_parser"))]
+            stmt: &mut stmt_old.protobuf,
+            schema: &schema,
+            db_schema: &db_schema,
+            extended: true,
+            prepared: false,
+            prepared_statements: &mut stmts,
+            user: "",
+            search_path: None,
+        };
+        let mut plan = RewritePlan {
+            params,
+            ..Default::default()
+        };
+        StatementRewrite::new(ctx).cross_shard_subquery(
+            #[cfg(feature = "new_parser")]
+            match stmt.stmts().next().unwrap() {
+                Node::SelectStmt(stmt) => stmt,
+                _ => panic!("Not a select"),
+            },
+            &mut plan,
+        )?;
+        Ok(plan.subquery)
+    }
+
+    fn run_test(query: &str, params: u16) -> Option<CrossShardSubquery> {
+        run_test_mode(query, params, RewriteMode::Rewrite).unwrap()
+    }
+
+    #[test]
+    fn test_subquery_split() {
+        let result = run_test(
+            "SELECT * FROM users WHERE id IN (SELECT user_id FROM sharded WHERE value = $1) AND name = $2",
+            2,
+        )
+        .unwrap();
+
+        assert_eq!(
+            result.subquery.stmt,
+            "SELECT user_id FROM sharded WHERE value = $1"
+        );
+        assert_eq!(result.subquery.params, indexset![1]);
+        assert_eq!(
+            result.outer.stmt,
+            "SELECT * FROM users WHERE id = ANY($1) AND name = $2"
+        );
+        assert_eq!(result.outer.params, indexset![3, 2]);
+    }
+
+    #[test]
+    fn test_subquery_equals_any() {
+        let result = run_test(
+            "SELECT * FROM users WHERE id = ANY(SELECT user_id FROM sharded)",
+            0,
+        )
+        .unwrap();
+
+        assert_eq!(result.subquery.stmt, "SELECT user_id FROM sharded");
+        assert_eq!(result.outer.stmt, "SELECT * FROM users WHERE id = ANY($1)");
+        assert_eq!(result.outer.params, indexset![1]);
+    }
+
+    #[test]
+    fn test_subquery_ignored() {
+        for query in [
+            // Not reading a sharded table.
+            "SELECT * FROM sharded WHERE id IN (SELECT id FROM users)",
+            // Correlated.
+            "SELECT * FROM users u WHERE id IN (SELECT s.user_id FROM sharded s WHERE s.value = u.name)",
+            // Inside NOT and OR.
+            "SELECT * FROM users WHERE id NOT IN (SELECT user_id FROM sharded)",
+            "SELECT * FROM users WHERE id = 1 OR id IN (SELECT user_id FROM sharded)",
+            // Not equality.
+            "SELECT * FROM users WHERE id > ANY(SELECT user_id FROM sharded)",
+            "SELECT * FROM users WHERE EXISTS (SELECT 1 FROM sharded)",
+            "SELECT * FROM users",
+        ] {
+            assert!(run_test(query, 0).is_none(), "{}", query);
+        }
+    }
+
+    #[test]
+    fn test_subquery_modes() {
+        let query = "SELECT * FROM users WHERE id IN (SELECT user_id FROM sharded)";
+
+        assert!(
+            run_test_mode(query, 0, RewriteMode::Ignore)
+                .unwrap()
+                .is_none()
+        );
+        assert!(matches!(
+            run_test_mode(query, 0, RewriteMode::Error),
+            Err(Error::CrossShardSubquery)
+        ));
+    }
+
+    #[test]
+    fn test_build_request() {
+        let result = run_test(
+            "SELECT * FROM users WHERE id IN (SELECT user_id FROM sharded) AND name = $1",
+            1,
+        )
+        .unwrap();
+
+        let request = ClientRequest::from(vec![
+            ProtocolMessage::from(Parse::new_anonymous("")),
+            Bind::new_params("", &[Parameter::new(b"alice")]).into(),
+            Execute::new().into(),
+            Sync.into(),
+        ]);
+        let request = result
+            .build_request(&request, &[Some("1".into()), None, Some(r#"a"b\c"#.into())])
+            .unwrap();
+
+        let bind = request
+            .iter()
+            .find_map(|message| match message {
+                ProtocolMessage::Bind(bind) => Some(bind.clone()),
+                _ => None,
+            })
+            .unwrap();
+        let params = bind.params_raw();
+        assert_eq!(params.len(), 2);
+        assert_eq!(&params[0].data[..], br#"{"1",NULL,"a\"b\\c"}"#);
+        assert_eq!(&params[1].data[..], b"alice");
+        assert_eq!(
+            request.iter().map(|m| m.code()).collect::<String>(),
+            "PBDES"
+        );
+    }
+
+    #[test]
+    fn test_array() {
+        assert_eq!(array(&[]), "{}");
+        assert_eq!(array(&[Some("1".into()), None]), r#"{"1",NULL}"#);
+    }
+}
@@ -22,28 +22,46 @@ impl StatementRewrite<'_> {
             return Ok(None);
         }
 
-        let replacement = if extended {
-            let param_ref = mem.make_param_ref(*next_param);
-            *next_param += 1;
-            param_ref.uncast()
-        } else {
-            use pg_raw_parse::ConstValue;
-
+        if !extended {
             let unique_id = crate::unique_id::UniqueId::generator()?.next_id();
-            mem.make_a_const(ConstValue::Float(&unique_id.to_string()))
-                .uncast()
-        };
+            return Ok(Some(Self::literal_bigint(mem, unique_id)));
+        }
+
+        let param_ref = mem.make_param_ref(*next_param);
+        *next_param += 1;
 
-        Ok(Some(
-            mem.make_type_cast(
-                replacement,
-                mem.make_list(&[
-                    mem.make_string(Some("pg_catalog")),
-                    mem.make_string(Some("int8")),
-                ]),
-            )
-            .uncast(),
-        ))
+        Ok(Some(Self::bigint_cast(mem, param_ref.uncast())))
+    }
+
+    /// Create a literal value cast to bigint: <value>::bigint
+    #[cfg(feature = "new_parser")]
+    pub(super) fn literal_bigint(
+        mem: make::MemoryToken<'_>,
+        value: i64,
+    ) -> make::Unique<'_, Node<'_>> {
+        use pg_raw_parse::ConstValue;
+
+        Self::bigint_cast(
+            mem,
+            mem.make_a_const(ConstValue::Float(&value.to_string()))
+                .uncast(),
+        )
+    }
+
+    /// Cast a node to bigint.
+    #[cfg(feature = "new_parser")]
+    fn bigint_cast<'mem>(
+        mem: make::MemoryToken<'mem>,
+        node: make::Unique<'mem, Node<'mem>>,
+    ) -> make::Unique<'mem, Node<'mem>> {
+        mem.make_type_cast(
+            node,
+            mem.make_list(&[
+                mem.make_string(Some("pg_catalog")),
+                mem.make_string(Some("int8")),
+            ]),
+        )
+        .uncast()
     }
 
     cfg_select! {
@@ -94,7 +112,7 @@ impl StatementRewrite<'_> {
 
     /// Create a literal value cast to bigint: <value>::bigint
     #[cfg(not(feature = "new_parser"))]
-    fn literal_bigint(value: i64) -> Node {
+    pub(super) fn literal_bigint(value: i64) -> Node {
         let literal = Node {
             node: Some(NodeEnum::AConst(AConst {
                 val: Some(Val::Sval(PgString {
@@ -621,7 +621,7 @@ impl<'a> StatementRewrite<'a> {
 /// Visit all ParamRef nodes in a ParseResult and renumber them sequentially.
 /// Returns a sorted list of the original parameter numbers.
 #[cfg(feature = "new_parser")]
-fn rewrite_params(node: NodeMut<'_, '_>) -> IndexSet<u16> {
+pub(super) fn rewrite_params(node: NodeMut<'_, '_>) -> IndexSet<u16> {
     let mut params = IndexSet::new();
     walk::walk_mut(node, |node| match node {
         NodeMut::ParamRef(param) => {
@@ -634,7 +634,7 @@ fn rewrite_params(node: NodeMut<'_, '_>) -> IndexSet<u16> {
 }
 
 #[cfg(not(feature = "new_parser"))]
-fn rewrite_params(parse_result: &mut ParseResult) -> Result<Vec<u16>, Error> {
+pub(super) fn rewrite_params(parse_result: &mut ParseResult) -> Result<Vec<u16>, Error> {
     let mut params = HashMap::new();
 
     visit_and_mutate_nodes(parse_result, |node| -> Result<Option<PgNode>, Error> {
@@ -757,7 +757,7 @@ fn select_star() -> Vec<PgNode> {
 }
 
 #[cfg(not(feature = "new_parser"))]
-fn parse_result(node: NodeEnum) -> ParseResult {
+pub(super) fn parse_result(node: NodeEnum) -> ParseResult {
     ParseResult {
         version: pg_query::PG_VERSION_NUM as i32,
         stmts: vec![RawStmt {
@@ -1055,7 +1055,7 @@ mod test {
                 false,
                 pgdog_config::SystemCatalogsBehavior::default(),
             ),
-            schemas: ShardedSchemas::new(vec![]),
+            schemas: ShardedSchemas::new(vec![], 1),
             rewrite: Rewrite {
                 enabled: true,
                 shard_key: RewriteMode::Rewrite,
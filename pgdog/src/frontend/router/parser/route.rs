@@ -1,11 +1,13 @@
-use std::{fmt::Display, ops::Deref};
+use std::{fmt::Display, ops::Deref, sync::Arc};
 
 use lazy_static::lazy_static;
+use pgdog_config::QueryRoutingPool;
 
 use super::{
-    Aggregate, DistinctBy, Limit, OrderBy, explain_trace::ExplainTrace,
+    Aggregate, Cursor, DistinctBy, InListSplit, Limit, OrderBy, explain_trace::ExplainTrace,
     rewrite::statement::aggregate::AggregateRewritePlan, statement::AdvisoryLocks,
 };
+use crate::frontend::router::sharding::relationships::ParentShard;
 
 /// The shard destination for a query.
 #[derive(Debug, Clone, PartialEq, PartialOrd, Ord, Eq, Hash, Default)]
@@ -103,6 +105,10 @@ pub struct Route {
     limit: Limit,
     /// Advisory locks requested by this query, if any.
     advisory_locks: AdvisoryLocks,
+    /// `WITH HOLD` cursor opened or cursor closed by this query, if any.
+    cursor: Option<Cursor>,
+    /// This query creates a temporary table, view or sequence.
+    temporary: bool,
     /// `DISTINCT` clause, if set.
     distinct: Option<DistinctBy>,
     /// Rewrites performed by the aggregate rewriter; adds
@@ -121,9 +127,26 @@ pub struct Route {
     /// This query is a DDL statement. We will need to
     /// reload the schema from Postgres once this runs.
     schema_changed: bool,
+    /// This query is DDL that can run inside a transaction
+    /// and so can be executed with two-phase commit.
+    ddl: bool,
     /// This query is only touching omnisharded tables
     /// and requires special checks to be executed.
     omnisharded: bool,
+    /// This query writes to omnisharded tables that must
+    /// be changed on all shards or none, with two-phase commit.
+    omnisharded_two_pc: bool,
+    /// Per-shard versions of this query, each containing
+    /// only the `IN` list values owned by that shard.
+    in_list_split: Option<Arc<InListSplit>>,
+    /// This is a `COPY ... TO STDOUT` and each shard's output
+    /// starts with a header we should only send once.
+    copy_headers: bool,
+    /// Connection pool requested by a query routing rule
+    /// or `slow_queries`.
+    pool: Option<QueryRoutingPool>,
+    /// Rows inserted into parent tables of routing relationships.
+    parent_rows: Vec<ParentShard>,
 }
 
 impl Display for Route {
@@ -252,6 +275,16 @@ impl Route {
         self.omnisharded
     }
 
+    /// Writes to omnisharded tables configured with `two_phase_commit`.
+    pub fn is_omnisharded_two_pc(&self) -> bool {
+        self.omnisharded_two_pc
+    }
+
+    pub fn with_omnisharded_two_pc(mut self, two_pc: bool) -> Self {
+        self.omnisharded_two_pc = two_pc;
+        self
+    }
+
     pub fn is_schema_changed(&self) -> bool {
         self.schema_changed
     }
@@ -261,6 +294,16 @@ impl Route {
         self
     }
 
+    /// Transactional DDL, e.g. `CREATE TABLE` but not `CREATE INDEX CONCURRENTLY`.
+    pub fn is_ddl(&self) -> bool {
+        self.ddl
+    }
+
+    pub fn with_ddl(mut self, ddl: bool) -> Self {
+        self.ddl = ddl;
+        self
+    }
+
     pub fn set_search_path_driven(&mut self, schema_driven: bool) {
         self.search_path_driven = schema_driven;
     }
@@ -337,6 +380,52 @@ impl Route {
         &self.advisory_locks
     }
 
+    pub fn with_parent_rows(mut self, parent_rows: Vec<ParentShard>) -> Self {
+        self.parent_rows = parent_rows;
+        self
+    }
+
+    /// Parent rows written by this query. Their shard
+    /// is learned once the query succeeds.
+    pub fn parent_rows(&self) -> &[ParentShard] {
+        &self.parent_rows
+    }
+
+    pub fn with_copy_headers(mut self, headers: bool) -> Self {
+        self.copy_headers = headers;
+        self
+    }
+
+    pub fn copy_headers(&self) -> bool {
+        self.copy_headers
+    }
+
+    pub fn set_cursor(&mut self, cursor: Cursor) {
+        self.cursor = Some(cursor);
+    }
+
+    pub fn cursor(&self) -> Option<&Cursor> {
+        self.cursor.as_ref()
+    }
+
+    pub fn set_pool(&mut self, pool: Option<QueryRoutingPool>) {
+        self.pool = pool;
+    }
+
+    /// Connection pool to use, if the query has to use a specific one.
+    pub fn pool(&self) -> Option<QueryRoutingPool> {
+        self.pool
+    }
+
+    pub fn set_temporary(&mut self, temporary: bool) {
+        self.temporary = temporary;
+    }
+
+    /// Temporary objects stay on the server connection for the rest of the session.
+    pub fn temporary(&self) -> bool {
+        self.temporary
+    }
+
     /// True when the statement acquires an advisory lock whose lifetime outlives
     /// a single transaction — the client must stay pinned to the same backend.
     pub fn is_lock_session(&self) -> bool {
@@ -360,6 +449,15 @@ impl Route {
         }
     }
 
+    /// Per-shard queries with a split `IN` list, if any.
+    pub fn in_list_split(&self) -> Option<&InListSplit> {
+        self.in_list_split.as_deref()
+    }
+
+    pub(crate) fn set_in_list_split(&mut self, split: InListSplit) {
+        self.in_list_split = Some(Arc::new(split));
+    }
+
     pub(crate) fn distinct(&self) -> &Option<DistinctBy> {
         &self.distinct
     }
@@ -392,6 +490,7 @@ pub enum ShardSource {
     RoundRobin(RoundRobinReason),
     SearchPath(String),
     Set,
+    Rule,
     Comment,
     Plugin,
     Override(OverrideReason),
@@ -558,6 +657,14 @@ impl ShardWithPriority {
         }
     }
 
+    /// New query routing rule-based routing.
+    pub fn new_rule(shard: Shard) -> Self {
+        Self {
+            shard,
+            source: ShardSource::Rule,
+        }
+    }
+
     /// New search_path-based shard.
     pub fn new_search_path(shard: Shard, schema: &str) -> Self {
         Self {
@@ -638,7 +745,8 @@ mod test {
         );
         assert!(ShardSource::Table(TableReason::Omni) < ShardSource::SearchPath(String::new()));
         assert!(ShardSource::SearchPath(String::new()) < ShardSource::Set);
-        assert!(ShardSource::Set < ShardSource::Comment);
+        assert!(ShardSource::Set < ShardSource::Rule);
+        assert!(ShardSource::Rule < ShardSource::Comment);
         assert!(ShardSource::Comment < ShardSource::Override(OverrideReason::OnlyOneShard));
     }
 
@@ -1,6 +1,7 @@
 #[cfg(feature = "new_parser")]
 use std::borrow::Cow;
 use std::collections::{HashMap, HashSet};
+use std::hash::{DefaultHasher, Hash, Hasher};
 
 #[cfg(feature = "new_parser")]
 use crate::util::ResultControlFlowExt;
@@ -27,6 +28,8 @@ use pg_raw_parse::{Node, list, nodes, walk};
 #[cfg(feature = "new_parser")]
 use std::ops::ControlFlow;
 
+use pgdog_config::{DataType, system_catalogs};
+
 #[cfg(feature = "new_parser")]
 fn advisory_locks_from_func_call(
     func: &nodes::FuncCall,
@@ -40,23 +43,26 @@ fn advisory_locks_from_func_call(
     }
     let name = name_parts.next().unwrap();
 
-    let (unlock, scope) = match name {
-        "pg_advisory_lock"
-        | "pg_advisory_lock_shared"
-        | "pg_try_advisory_lock"
-        | "pg_try_advisory_lock_shared" => (false, LockScope::Session),
-        "pg_advisory_xact_lock"
-        | "pg_advisory_xact_lock_shared"
-        | "pg_try_advisory_xact_lock"
-        | "pg_try_advisory_xact_lock_shared" => (false, LockScope::Transaction),
+    let (unlock, scope, try_lock) = match name {
+        "pg_advisory_lock" | "pg_advisory_lock_shared" => (false, LockScope::Session, false),
+        "pg_try_advisory_lock" | "pg_try_advisory_lock_shared" => (false, LockScope::Session, true),
+        "pg_advisory_xact_lock" | "pg_advisory_xact_lock_shared" => {
+            (false, LockScope::Transaction, false)
+        }
+        "pg_try_advisory_xact_lock" | "pg_try_advisory_xact_lock_shared" => {
+            (false, LockScope::Transaction, true)
+        }
         // Session-scoped unlocks. xact locks can't be released by name;
         // Postgres drops them automatically at COMMIT/ROLLBACK.
-        "pg_advisory_unlock" => (true, LockScope::Session),
+        "pg_advisory_unlock" | "pg_advisory_unlock_shared" => (true, LockScope::Session, false),
         "pg_advisory_unlock_all" => {
             return vec![AdvisoryLock {
                 id: None,
                 unlock: true,
                 scope: LockScope::Session,
+                all: true,
+                try_lock: false,
+                expression: None,
             }];
         }
         _ => return Vec::new(),
@@ -67,15 +73,33 @@ fn advisory_locks_from_func_call(
             id: None,
             unlock,
             scope,
+            all: false,
+            try_lock,
+            expression: None,
         }];
     };
 
+    // Two-key form, e.g. `pg_advisory_lock(1, 2)`.
+    if func.args().len() > 1 {
+        return vec![AdvisoryLock {
+            id: None,
+            unlock,
+            scope,
+            all: false,
+            try_lock,
+            expression: expression_key(func.args(), bind),
+        }];
+    }
+
     // Fast path: the key is a literal / param / cast we can resolve directly.
     if let Some(id) = integer_arg(arg, bind) {
         return vec![AdvisoryLock {
             id: Some(id),
             unlock,
             scope,
+            all: false,
+            try_lock,
+            expression: None,
         }];
     }
 
@@ -101,6 +125,9 @@ fn advisory_locks_from_func_call(
                 id: integer_arg(*v, bind),
                 unlock,
                 scope,
+                all: false,
+                try_lock,
+                expression: None,
             })
             .collect();
     }
@@ -109,6 +136,9 @@ fn advisory_locks_from_func_call(
         id: None,
         unlock,
         scope,
+        all: false,
+        try_lock,
+        expression: expression_key([arg], bind),
     }]
 }
 
@@ -131,23 +161,26 @@ fn advisory_locks_from_func_call(
         return Vec::new();
     };
 
-    let (unlock, scope) = match name {
-        "pg_advisory_lock"
-        | "pg_advisory_lock_shared"
-        | "pg_try_advisory_lock"
-        | "pg_try_advisory_lock_shared" => (false, LockScope::Session),
-        "pg_advisory_xact_lock"
-        | "pg_advisory_xact_lock_shared"
-        | "pg_try_advisory_xact_lock"
-        | "pg_try_advisory_xact_lock_shared" => (false, LockScope::Transaction),
+    let (unlock, scope, try_lock) = match name {
+        "pg_advisory_lock" | "pg_advisory_lock_shared" => (false, LockScope::Session, false),
+        "pg_try_advisory_lock" | "pg_try_advisory_lock_shared" => (false, LockScope::Session, true),
+        "pg_advisory_xact_lock" | "pg_advisory_xact_lock_shared" => {
+            (false, LockScope::Transaction, false)
+        }
+        "pg_try_advisory_xact_lock" | "pg_try_advisory_xact_lock_shared" => {
+            (false, LockScope::Transaction, true)
+        }
         // Session-scoped unlocks. xact locks can't be released by name;
         // Postgres drops them automatically at COMMIT/ROLLBACK.
-        "pg_advisory_unlock" => (true, LockScope::Session),
+        "pg_advisory_unlock" | "pg_advisory_unlock_shared" => (true, LockScope::Session, false),
         "pg_advisory_unlock_all" => {
             return vec![AdvisoryLock {
                 id: None,
                 unlock: true,
                 scope: LockScope::Session,
+                all: true,
+                try_lock: false,
+                expression: None,
             }];
         }
         _ => return Vec::new(),
@@ -158,15 +191,33 @@ fn advisory_locks_from_func_call(
             id: None,
             unlock,
             scope,
+            all: false,
+            try_lock,
+            expression: None,
         }];
     };
 
+    // Two-key form, e.g. `pg_advisory_lock(1, 2)`.
+    if func.args.len() > 1 {
+        return vec![AdvisoryLock {
+            id: None,
+            unlock,
+            scope,
+            all: false,
+            try_lock,
+            expression: expression_key(&func.args, bind),
+        }];
+    }
+
     // Fast path: the key is a literal / param / cast we can resolve directly.
     if let Some(id) = integer_arg(arg, bind) {
         return vec![AdvisoryLock {
             id: Some(id),
             unlock,
             scope,
+            all: false,
+            try_lock,
+            expression: None,
         }];
     }
 
@@ -191,6 +242,9 @@ fn advisory_locks_from_func_call(
                 id: integer_arg(v, bind),
                 unlock,
                 scope,
+                all: false,
+                try_lock,
+                expression: None,
             })
             .collect();
     }
@@ -199,9 +253,84 @@ fn advisory_locks_from_func_call(
         id: None,
         unlock,
         scope,
+        all: false,
+        try_lock,
+        expression: expression_key(std::slice::from_ref(arg), bind),
     }]
 }
 
+/// Hash of the key expression of an advisory lock we can't evaluate,
+/// e.g. `hashtext('job')`, so the matching unlock releases the same lock.
+/// Deparsing normalizes whitespace, case and comments.
+#[cfg(feature = "new_parser")]
+fn expression_key<'a>(
+    args: impl IntoIterator<Item = Node<'a>>,
+    bind: Option<&Bind>,
+) -> Option<u64> {
+    use pg_raw_parse::make::owned;
+
+    let node = owned(|mem| {
+        let mut select = mem.make_node::<nodes::SelectStmt>();
+        let res_targets = args
+            .into_iter()
+            .map(|arg| mem.make_res_target(None, mem.empty(), mem.make_unique(arg)))
+            .collect::<Vec<_>>();
+        select.as_mut().set_target_list(mem.make_list(&res_targets));
+        mem.make_raw_stmt(select.uncast())
+    });
+    let expression = pg_raw_parse::deparse(&*node).ok()?;
+
+    Some(expression_hash(expression.as_str(), bind))
+}
+
+/// Hash of the key expression of an advisory lock we can't evaluate,
+/// e.g. `hashtext('job')`, so the matching unlock releases the same lock.
+/// Deparsing normalizes whitespace, case and comments.
+#[cfg(not(feature = "new_parser"))]
+fn expression_key(args: &[Node], bind: Option<&Bind>) -> Option<u64> {
+    use pg_query::protobuf::{LimitOption, ParseResult, ResTarget, SetOperation};
+
+    let stmt = SelectStmt {
+        target_list: args
+            .iter()
+            .map(|arg| Node {
+                node: Some(NodeEnum::ResTarget(Box::new(ResTarget {
+                    val: Some(Box::new(arg.clone())),
+                    ..Default::default()
+                }))),
+            })
+            .collect(),
+        limit_option: LimitOption::Default.into(),
+        op: SetOperation::SetopNone.into(),
+        ..Default::default()
+    };
+    let result = ParseResult {
+        version: pg_query::PG_VERSION_NUM as i32,
+        stmts: vec![protobuf::RawStmt {
+            stmt: Some(Box::new(Node {
+                node: Some(NodeEnum::SelectStmt(Box::new(stmt))),
+            })),
+            stmt_location: 0,
+            stmt_len: 0,
+        }],
+    };
+    let expression = result.deparse().ok()?;
+
+    Some(expression_hash(&expression, bind))
+}
+
+fn expression_hash(expression: &str, bind: Option<&Bind>) -> u64 {
+    let mut hasher = DefaultHasher::new();
+    expression.hash(&mut hasher);
+    // The expression can use parameters, e.g. `hashtext($1)`.
+    if let Some(bind) = bind {
+        for param in bind.params_raw() {
+            param.data.hash(&mut hasher);
+        }
+    }
+    hasher.finish()
+}
+
 #[cfg(feature = "new_parser")]
 fn last_column_name<'a>(fields: impl IntoIterator<Item = Node<'a>>) -> Option<&'a str> {
     fields.into_iter().last().and_then(Node::as_str)
@@ -366,8 +495,13 @@ fn is_param_ref(node: &Node) -> bool {
 }
 
 use super::{
-    super::sharding::Value as ShardingValue, Column, Error, Table, Value,
+    super::sharding::{
+        Value as ShardingValue,
+        relationships::{self, ParentRow, ParentShard},
+    },
+    Column, Error, PrimaryOnly, Table, Value,
     explain_trace::ExplainRecorder,
+    function::Function,
 };
 
 /// Lifetime of an advisory lock.
@@ -390,6 +524,12 @@ pub struct AdvisoryLock {
     pub id: Option<i64>,
     pub unlock: bool,
     pub scope: LockScope,
+    /// `pg_advisory_unlock_all()`, releasing every session lock.
+    pub all: bool,
+    /// `pg_try_advisory_lock()` and friends, which may not acquire the lock.
+    pub try_lock: bool,
+    /// Hash of the key expression when `id` can't be resolved, e.g. `hashtext('job')`.
+    pub expression: Option<u64>,
 }
 
 /// Set of advisory locks discovered while walking a statement.
@@ -423,10 +563,11 @@ impl AdvisoryLocks {
 }
 
 /// Accumulator shared across statement walkers — lets a single traversal
-/// collect tables and advisory locks without walking the AST twice.
+/// collect tables, functions and advisory locks without walking the AST twice.
 #[derive(Debug, Clone, Default)]
 struct Walk<'a> {
     tables: Vec<Table<'a>>,
+    functions: Vec<Function<'a>>,
     advisory_locks: HashSet<AdvisoryLock>,
 }
 use crate::{
@@ -446,6 +587,8 @@ struct SearchContext<'a> {
     aliases: HashMap<&'a str, Table<'a>>,
     /// The primary table from the FROM clause (if simple)
     table: Option<Table<'a>>,
+    /// All tables in the FROM clause, including joins.
+    tables: Vec<Table<'a>>,
 }
 
 impl<'a> SearchContext<'a> {
@@ -453,9 +596,10 @@ impl<'a> SearchContext<'a> {
     #[cfg(feature = "new_parser")]
     fn from_from_clause(nodes: &'a list::NodeList) -> Self {
         let mut aliases = HashMap::new();
+        let mut tables = vec![];
 
         for node in nodes {
-            Self::extract_alias_from_node(&mut aliases, node);
+            Self::extract_alias_from_node(&mut aliases, &mut tables, node);
         }
 
         let table = nodes
@@ -464,7 +608,11 @@ impl<'a> SearchContext<'a> {
             .ok()
             .and_then(|n| Table::try_from(n).ok());
 
-        Self { aliases, table }
+        Self {
+            aliases,
+            table,
+            tables,
+        }
     }
 
     #[cfg(not(feature = "new_parser"))]
@@ -490,16 +638,23 @@ impl<'a> SearchContext<'a> {
     }
 
     #[cfg(feature = "new_parser")]
-    fn extract_alias_from_node(aliases: &mut HashMap<&'a str, Table<'a>>, node: Node<'a>) {
+    fn extract_alias_from_node(
+        aliases: &mut HashMap<&'a str, Table<'a>>,
+        tables: &mut Vec<Table<'a>>,
+        node: Node<'a>,
+    ) {
         match node {
-            Node::RangeVar(rv) if let Some(alias) = rv.alias() => {
+            Node::RangeVar(rv) => {
                 let table = Table::from(rv);
-                aliases.insert(alias.aliasname().expect("alias name always present"), table);
+                if let Some(alias) = rv.alias() {
+                    aliases.insert(alias.aliasname().expect("alias name always present"), table);
+                }
+                tables.push(table);
             }
 
             Node::JoinExpr(join) => {
-                Self::extract_alias_from_node(aliases, join.larg());
-                Self::extract_alias_from_node(aliases, join.rarg());
+                Self::extract_alias_from_node(aliases, tables, join.larg());
+                Self::extract_alias_from_node(aliases, tables, join.rarg());
             }
 
             Node::RangeSubselect(subselect) if let Some(alias) = subselect.alias() => {
@@ -524,10 +679,11 @@ impl<'a> SearchContext<'a> {
     fn extract_alias_from_node_old(&mut self, node: &'a PgNode) {
         match &node.node {
             Some(NodeEnum::RangeVar(range_var)) => {
+                let table = Table::from(range_var);
                 if let Some(ref alias) = range_var.alias {
-                    let table = Table::from(range_var);
                     self.aliases.insert(alias.aliasname.as_str(), table);
                 }
+                self.tables.push(table);
             }
             Some(NodeEnum::JoinExpr(join)) => {
                 if let Some(ref larg) = join.larg {
@@ -668,6 +824,8 @@ pub struct StatementParser<'a, 'b, 'c> {
     cached_walk: Option<Walk<'a>>,
     /// Cached result of all_omnisharded check (None = not yet computed)
     all_omnisharded: Option<bool>,
+    /// Parent rows written by this statement, learned once it succeeds.
+    parent_rows: Vec<ParentShard>,
 }
 
 impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
@@ -690,9 +848,15 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
             hooks: ParserHooks::default(),
             cached_walk: None,
             all_omnisharded: None,
+            parent_rows: vec![],
         }
     }
 
+    /// Parent rows written by the statement, with their shard.
+    pub fn take_parent_rows(&mut self) -> Vec<ParentShard> {
+        std::mem::take(&mut self.parent_rows)
+    }
+
     fn walk(&mut self) -> &Walk<'a> {
         if self.cached_walk.is_none() {
             self.cached_walk = Some(self.run_walk());
@@ -725,6 +889,43 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
         result
     }
 
+    /// The query only touches omnisharded tables and at least one of them
+    /// requires writes to be committed on all shards using two-phase commit.
+    pub(crate) fn is_omnisharded_two_pc(&mut self) -> bool {
+        if !self.is_all_omnisharded() {
+            return false;
+        }
+
+        let schema = self.schema;
+        self.tables()
+            .iter()
+            .any(|table| schema.tables.is_omnisharded_two_pc(table.name))
+    }
+
+    /// Check if the query only reads system catalogs, i.e. tables in
+    /// `pg_catalog` and `information_schema`.
+    pub(crate) fn is_all_system_catalogs(&mut self) -> bool {
+        let tables = self.tables();
+
+        !tables.is_empty()
+            && tables.iter().all(|table| match table.schema {
+                Some(schema) => matches!(schema, "pg_catalog" | "information_schema"),
+                None => system_catalogs().contains(table.name),
+            })
+    }
+
+    /// Check if the query calls a function or reads a table
+    /// that must run on the primary.
+    pub(crate) fn is_primary_only(&mut self, primary_only: &PrimaryOnly) -> bool {
+        let walk = self.walk();
+
+        walk.tables.iter().any(|table| primary_only.table(table))
+            || walk
+                .functions
+                .iter()
+                .any(|function| primary_only.function(function))
+    }
+
     /// Set the schema lookup context for INSERT without column list.
     pub fn with_schema_lookup(mut self, ctx: SchemaLookupContext<'b>) -> Self {
         self.schema_lookup = Some(ctx);
@@ -818,7 +1019,7 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                 Value::Placeholder(pos) => {
                     format!("matched sharding key {} using parameter ${}", col_str, pos)
                 }
-                _ => format!("matched sharding key {} using constant", col_str),
+                _ => format!("matched sharding key {} using constant {}", col_str, value),
             };
             recorder.record_entry(Some(shard.clone()), description);
         }
@@ -928,6 +1129,11 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                 }
             }
 
+            // Child tables are stored with their parent rows
+            if self.schema.relationships.is_child(table.schema, table.name) {
+                return true;
+            }
+
             // Check nameless configs by looking up the table in the db schema
             // to see if it has the sharding column
             if !nameless.is_empty()
@@ -986,6 +1192,9 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                     self.bind,
                     values_columns.as_ref(),
                 ));
+                walk.functions.extend(Function::from_strings(
+                    func.funcname().into_iter().filter_map(Node::as_str),
+                ));
                 Recurse::no()
             }
 
@@ -1155,6 +1364,12 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                     self.walk_select(inner_select, walk);
                 }
             }
+            // SELECT * FROM func()
+            Some(NodeEnum::RangeFunction(range)) => {
+                for function in &range.functions {
+                    self.walk_node(function, walk, values);
+                }
+            }
             Some(NodeEnum::SubLink(sublink)) => {
                 if let Some(ref subselect) = sublink.subselect
                     && let Some(NodeEnum::SelectStmt(ref inner_select)) = subselect.node
@@ -1197,6 +1412,7 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                 for lock in advisory_locks_from_func_call(func, self.bind, values) {
                     walk.advisory_locks.insert(lock);
                 }
+                walk.functions.extend(Function::try_from(node).ok());
                 for arg in &func.args {
                     self.walk_node(arg, walk, values);
                 }
@@ -1414,6 +1630,121 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
         }
     }
 
+    /// Value of a parent table column, as used by routing relationships.
+    fn relationship_key(&self, value: &Value<'a>, data_type: DataType) -> Option<String> {
+        match value {
+            Value::Placeholder(pos) => {
+                let param = self
+                    .bind
+                    .and_then(|bind| bind.parameter(*pos as usize - 1).ok().flatten())
+                    .filter(|param| !param.is_null())?;
+                relationships::key(&ShardingValue::from_param(&param, data_type).ok()?)
+            }
+            Value::String(val) => relationships::key(&ShardingValue::new(*val, data_type)),
+            Value::Integer(val) => relationships::key(&ShardingValue::new(*val, data_type)),
+            _ => None,
+        }
+    }
+
+    /// Compute the shard of a child table row from the parent row it references.
+    ///
+    /// Parent rows we haven't seen inserted could be on any shard,
+    /// so the query goes to all of them.
+    fn compute_shard_by_parent(
+        &mut self,
+        schema: Option<&str>,
+        table: &str,
+        column: &str,
+        value: &Value<'a>,
+    ) -> Option<Shard> {
+        let sharding_schema = self.schema;
+        let relationship = sharding_schema.relationships.child(schema, table, column)?;
+        let key = self.relationship_key(value, relationship.data_type);
+        let shard = key
+            .as_deref()
+            .and_then(|key| sharding_schema.relationships.lookup(relationship, key))
+            .map(Shard::Direct)
+            .unwrap_or(Shard::All);
+
+        if let Some(recorder) = self.recorder.as_mut()
+            && let Some(key) = key
+        {
+            recorder.record_entry(
+                Some(shard.clone()),
+                format!(
+                    "matched parent row {}.{} = {}",
+                    relationship.parent_table, relationship.parent_column, key
+                ),
+            );
+        }
+
+        Some(shard)
+    }
+
+    /// Compute the shard of a child table row being inserted.
+    ///
+    /// Unlike other statements, an INSERT can't go to all shards
+    /// when we don't know where the parent row is: that would write
+    /// a copy of the row to every shard. The caller looks the parent
+    /// row up on the shards instead.
+    fn compute_insert_shard_by_parent(
+        &mut self,
+        schema: Option<&str>,
+        table: &str,
+        column: &str,
+        value: &Value<'a>,
+    ) -> Result<Option<Shard>, Error> {
+        let sharding_schema = self.schema;
+        let Some(relationship) = sharding_schema.relationships.child(schema, table, column) else {
+            return Ok(None);
+        };
+
+        match self.compute_shard_by_parent(schema, table, column, value) {
+            Some(Shard::All) => Err(Error::ParentRowUnknown(Box::new(ParentRow {
+                table: table.to_owned(),
+                relationship: relationship.clone(),
+                key: self.relationship_key(value, relationship.data_type),
+            }))),
+            shard => Ok(shard),
+        }
+    }
+
+    /// Record the shard of a row inserted into a parent table.
+    /// It's learned once the INSERT succeeds.
+    fn learn_parent_row<'v>(
+        &mut self,
+        table: Option<Table<'a>>,
+        row: impl Iterator<Item = (&'v str, Option<Value<'a>>)>,
+        shard: &Shard,
+    ) {
+        let (Some(table), Shard::Direct(shard)) = (table, shard) else {
+            return;
+        };
+        let sharding_schema = self.schema;
+        let parents = sharding_schema
+            .relationships
+            .parents(table.schema, table.name)
+            .collect::<Vec<_>>();
+        if parents.is_empty() {
+            return;
+        }
+
+        for (column, value) in row {
+            let Some(value) = value else {
+                continue;
+            };
+            for relationship in parents.iter().filter(|r| r.parent_column == column) {
+                if let Some(key) = self.relationship_key(&value, relationship.data_type) {
+                    self.parent_rows.push(ParentShard {
+                        relationship: (*relationship).clone(),
+                        key,
+                        shard: *shard,
+                    });
+                }
+            }
+        }
+    }
+
     #[cfg(not(feature = "new_parser"))]
     fn select_search(
         &mut self,
@@ -1842,11 +2173,70 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
             column
         };
 
-        let shard = self.compute_shard(resolved_column, value.clone())?;
-        if let Some(ref shard) = shard {
-            self.record_sharding_key(shard, resolved_column, &value);
+        if resolved_column.table.is_none()
+            && ctx.tables.len() > 1
+            && let Some(shard) = self.compute_shard_colocated(column, &value, ctx)?
+        {
+            return Ok(Some(shard));
+        }
+
+        if let Some(shard) = self.compute_shard(resolved_column, value.clone())? {
+            self.record_sharding_key(&shard, resolved_column, &value);
+            return Ok(Some(shard));
+        }
+
+        // Unqualified columns belong to the only table in the query.
+        let table = match resolved_column.table {
+            Some(name) => Some((resolved_column.schema, name)),
+            None if ctx.tables.len() <= 1 => ctx.table.map(|table| (table.schema, table.name)),
+            None => None,
+        };
+
+        Ok(table.and_then(|(schema, table)| {
+            self.compute_shard_by_parent(schema, table, resolved_column.name, &value)
+        }))
+    }
+
+    /// Compute the shard for an unqualified column in a join.
+    ///
+    /// Tables joined on their sharding key are colocated: the same value
+    /// maps to the same shard in all of them. If it doesn't, e.g., the tables
+    /// use different sharding functions, the join can't go to one shard.
+    fn compute_shard_colocated(
+        &mut self,
+        column: Column<'a>,
+        value: &Value<'a>,
+        ctx: &SearchContext<'a>,
+    ) -> Result<Option<Shard>, Error> {
+        let mut colocated: Option<(Shard, Column<'a>)> = None;
+
+        for table in &ctx.tables {
+            let qualified = Column {
+                name: column.name,
+                table: Some(table.name),
+                schema: table.schema,
+            };
+            let sharded_table = match self.schema.tables().get_table(qualified) {
+                Some(sharded_table) if sharded_table.name.is_some() => sharded_table,
+                _ => continue,
+            };
+
+            match (
+                &colocated,
+                self.compute_shard_for_table(Some(sharded_table), value.clone())?,
+            ) {
+                (None, Some(shard)) => colocated = Some((shard, qualified)),
+                (Some((existing, _)), Some(shard)) if *existing == shard => (),
+                _ => return Ok(None),
+            }
+        }
+
+        if let Some((shard, column)) = colocated {
+            self.record_sharding_key(&shard, column, value);
+            Ok(Some(shard))
+        } else {
+            Ok(None)
         }
-        Ok(shard)
     }
 
     /// Search an UPDATE statement for sharding keys.
@@ -2018,7 +2408,7 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                 .collect();
             let row: Vec<_> = values_lists.next().map(|r| r.collect()).unwrap_or(targets);
 
-            for (column_name, target_node) in columns.into_iter().zip(row) {
+            for (column_name, target_node) in columns.iter().copied().zip(row.iter().copied()) {
                 let table_name = ctx.table.map(|t| t.name);
                 let table_schema = ctx.table.and_then(|t| t.schema);
                 let sharded_table =
@@ -2026,6 +2416,21 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
 
                 if let Ok(value) = Value::try_from(target_node)
                     && let Some(shard) = self.compute_shard_for_table(sharded_table, value)?
+                {
+                    let values = row.iter().map(|node| Value::try_from(*node).ok());
+                    self.learn_parent_row(ctx.table, columns.iter().copied().zip(values), &shard);
+                    return Ok(Some(shard));
+                }
+
+                if sharded_table.is_none()
+                    && let Some(table) = ctx.table
+                    && let Ok(value) = Value::try_from(target_node)
+                    && let Some(shard) = self.compute_insert_shard_by_parent(
+                        table.schema,
+                        table.name,
+                        column_name,
+                        &value,
+                    )?
                 {
                     return Ok(Some(shard));
                 }
@@ -2159,8 +2564,27 @@ impl<'a, 'b: 'a, 'c> StatementParser<'a, 'b, 'c> {
                                         && let Some(shard) =
                                             self.compute_shard_for_table(sharded_table, value)?
                                     {
+                                        let values = list
+                                            .items
+                                            .iter()
+                                            .map(|node| Value::try_from(node).ok());
+                                        self.learn_parent_row(
+                                            ctx.table,
+                                            columns.iter().map(String::as_str).zip(values),
+                                            &shard,
+                                        );
                                         return Ok(SearchResult::Match(shard));
                                     }
+                                } else if let Some(table) = ctx.table
+                                    && let Ok(value) = Value::try_from(value_node)
+                                    && let Some(shard) = self.compute_insert_shard_by_parent(
+                                        table.schema,
+                                        table.name,
+                                        column_name,
+                                        &value,
+                                    )?
+                                {
+                                    return Ok(SearchResult::Match(shard));
                                 }
                             }
 
@@ -2233,6 +2657,17 @@ mod test {
                         schema: Some("myschema".into()),
                         ..Default::default()
                     },
+                    // Colocated tables sharded on the same column.
+                    ShardedTable {
+                        column: "tenant_id".into(),
+                        name: Some("orders".into()),
+                        ..Default::default()
+                    },
+                    ShardedTable {
+                        column: "tenant_id".into(),
+                        name: Some("order_items".into()),
+                        ..Default::default()
+                    },
                 ],
                 vec![],
                 false,
@@ -2313,6 +2748,55 @@ mod test {
         assert!(result.is_some());
     }
 
+    #[test]
+    fn test_select_colocated_join_using() {
+        let result = run_test(
+            "SELECT * FROM orders JOIN order_items USING (tenant_id) WHERE tenant_id = 1",
+            None,
+        )
+        .unwrap();
+        assert_eq!(
+            result,
+            run_test("SELECT * FROM orders WHERE tenant_id = 1", None).unwrap()
+        );
+        assert!(matches!(result, Some(Shard::Direct(_))));
+    }
+
+    #[test]
+    fn test_bound_select_colocated_join_using() {
+        let bind = Bind::new_params("", &[Parameter::new(b"1")]);
+        let result = run_test(
+            "SELECT o.id, i.sku FROM orders o \
+             JOIN order_items i USING (tenant_id) \
+             WHERE tenant_id = $1 AND o.status = 'open'",
+            Some(&bind),
+        )
+        .unwrap();
+        assert!(matches!(result, Some(Shard::Direct(_))));
+    }
+
+    #[test]
+    fn test_select_join_unqualified_column_one_sharded_table() {
+        let result = run_test(
+            "SELECT * FROM orders JOIN customers ON orders.customer_id = customers.id \
+             WHERE tenant_id = 1",
+            None,
+        )
+        .unwrap();
+        assert!(matches!(result, Some(Shard::Direct(_))));
+    }
+
+    #[test]
+    fn test_select_join_unqualified_column_not_sharded() {
+        let result = run_test(
+            "SELECT * FROM customers JOIN regions ON customers.region_id = regions.id \
+             WHERE tenant_id = 1",
+            None,
+        )
+        .unwrap();
+        assert!(result.is_none());
+    }
+
     #[test]
     fn test_select_with_type_cast() {
         let result = run_test("SELECT * FROM sharded WHERE id = '1'::int", None).unwrap();
@@ -3042,6 +3526,157 @@ mod test {
         assert_eq!(result.unwrap(), Some(Shard::All));
     }
 
+    // Routing relationships tests
+    use crate::frontend::router::sharding::Relationships;
+    use pgdog_config::RoutingRelationship;
+
+    fn relationships_schema() -> ShardingSchema {
+        ShardingSchema {
+            shards: 3,
+            tables: ShardedTables::new(
+                vec![ShardedTable {
+                    column: "tenant_id".into(),
+                    name: Some("orders".into()),
+                    ..Default::default()
+                }],
+                vec![],
+                false,
+                SystemCatalogsBehavior::default(),
+            ),
+            relationships: Relationships::new(
+                "test_relationships",
+                vec![RoutingRelationship {
+                    database: "test".into(),
+                    table: "order_items".into(),
+                    column: "order_id".into(),
+                    parent_table: "orders".into(),
+                    parent_column: "id".into(),
+                    ..Default::default()
+                }],
+                10,
+            ),
+            ..Default::default()
+        }
+    }
+
+    fn run_test_with_relationships(
+        stmt: &str,
+        bind: Option<&Bind>,
+        schema: &ShardingSchema,
+    ) -> Result<Option<Shard>, Error> {
+        parse_with_relationships(stmt, bind, schema).map(|(shard, _)| shard)
+    }
+
+    /// Shard and parent rows written by the statement.
+    fn parse_with_relationships(
+        stmt: &str,
+        bind: Option<&Bind>,
+        schema: &ShardingSchema,
+    ) -> Result<(Option<Shard>, Vec<ParentShard>), Error> {
+        #[cfg(not(feature = "new_parser"))]
+        let raw = pg_query::parse(stmt)
+            .unwrap()
+            .protobuf
+            .stmts
+            .first()
+            .cloned()
+            .unwrap();
+        #[cfg(feature = "new_parser")]
+        let raw = pg_raw_parse::parse(stmt).unwrap();
+        #[cfg(feature = "new_parser")]
+        let stmt = raw.stmts().next().unwrap();
+        let mut parser = StatementParser::from_raw(
+            #[cfg(not(feature = "new_parser"))]
+            &raw,
+            #[cfg(feature = "new_parser")]
+            stmt,
+            bind,
+            schema,
+            None,
+        )?;
+        let shard = parser.shard()?;
+        Ok((shard, parser.take_parent_rows()))
+    }
+
+    #[test]
+    fn test_relationships_route_child_by_parent() {
+        let schema = relationships_schema();
+
+        // Parent row we haven't seen could be anywhere.
+        let result = run_test_with_relationships(
+            "SELECT * FROM order_items WHERE order_id = 10",
+            None,
+            &schema,
+        )
+        .unwrap();
+        assert_eq!(result, Some(Shard::All));
+
+        // Inserting it everywhere would duplicate the row.
+        let result = run_test_with_relationships(
+            "INSERT INTO order_items (id, order_id) VALUES (1, 10)",
+            None,
+            &schema,
+        );
+        let Err(Error::ParentRowUnknown(parent_row)) = result else {
+            panic!("expected an unknown parent row");
+        };
+        assert_eq!(parent_row.key.as_deref(), Some("10"));
+        assert_eq!(parent_row.relationship.parent_table, "orders");
+
+        // The parent row's shard is learned once its INSERT succeeds.
+        let (parent, parent_rows) = parse_with_relationships(
+            "INSERT INTO orders (id, tenant_id) VALUES (10, 1)",
+            None,
+            &schema,
+        )
+        .unwrap();
+        let parent = parent.unwrap();
+        let Shard::Direct(parent_shard) = parent else {
+            panic!("parent row should go to one shard");
+        };
+        assert_eq!(parent_rows.len(), 1);
+        assert_eq!(parent_rows[0].key, "10");
+        assert_eq!(parent_rows[0].shard, parent_shard);
+        assert_eq!(
+            run_test_with_relationships(
+                "SELECT * FROM order_items WHERE order_id = 10",
+                None,
+                &schema
+            )
+            .unwrap(),
+            Some(Shard::All)
+        );
+        for parent_row in &parent_rows {
+            schema.relationships.learn(parent_row);
+        }
+
+        for query in [
+            "SELECT * FROM order_items WHERE order_id = 10",
+            "SELECT * FROM order_items i WHERE i.order_id = '10'",
+            "UPDATE order_items SET quantity = 2 WHERE order_id = 10",
+            "DELETE FROM order_items WHERE order_id = 10",
+            "INSERT INTO order_items (id, order_id) VALUES (1, 10)",
+        ] {
+            let result = run_test_with_relationships(query, None, &schema).unwrap();
+            assert_eq!(result, Some(parent.clone()), "{}", query);
+        }
+
+        let bind = Bind::new_params("", &[Parameter::new(b"10")]);
+        let result = run_test_with_relationships(
+            "SELECT * FROM order_items WHERE order_id = $1",
+            Some(&bind),
+            &schema,
+        )
+        .unwrap();
+        assert_eq!(result, Some(parent));
+
+        // Other columns don't reference the parent.
+        let result =
+            run_test_with_relationships("SELECT * FROM order_items WHERE id = 10", None, &schema)
+                .unwrap();
+        assert_eq!(result, None);
+    }
+
     // Schema-based sharding fallback tests
     use crate::backend::replication::ShardedSchemas;
     use pgdog_config::sharding::ShardedSchema;
@@ -3059,20 +3694,25 @@ mod test {
                 false,
                 SystemCatalogsBehavior::default(),
             ),
-            schemas: ShardedSchemas::new(vec![
-                ShardedSchema {
-                    database: "test".to_string(),
-                    name: Some("sales".to_string()),
-                    shard: 1,
-                    all: false,
-                },
-                ShardedSchema {
-                    database: "test".to_string(),
-                    name: Some("inventory".to_string()),
-                    shard: 2,
-                    all: false,
-                },
-            ]),
+            schemas: ShardedSchemas::new(
+                vec![
+                    ShardedSchema {
+                        database: "test".to_string(),
+                        name: Some("sales".to_string()),
+                        shard: 1,
+                        all: false,
+                        hash: false,
+                    },
+                    ShardedSchema {
+                        database: "test".to_string(),
+                        name: Some("inventory".to_string()),
+                        shard: 2,
+                        all: false,
+                        hash: false,
+                    },
+                ],
+                3,
+            ),
             ..Default::default()
         };
         #[cfg(not(feature = "new_parser"))]
@@ -3457,10 +4097,12 @@ mod test {
                     OmnishardedTable {
                         name: "users".into(),
                         sticky_routing: false,
+                        two_phase_commit: false,
                     },
                     OmnishardedTable {
                         name: "sessions".into(),
                         sticky_routing: false,
+                        two_phase_commit: true,
                     },
                 ],
                 false,
@@ -3649,6 +4291,23 @@ mod test {
                 id,
                 unlock,
                 scope: LockScope::Session,
+                all: false,
+                try_lock: false,
+                expression: None,
+            }
+        }
+
+        fn try_lock(lock: AdvisoryLock) -> AdvisoryLock {
+            AdvisoryLock {
+                try_lock: true,
+                ..lock
+            }
+        }
+
+        fn unlock_all() -> AdvisoryLock {
+            AdvisoryLock {
+                all: true,
+                ..session(None, true)
             }
         }
 
@@ -3657,6 +4316,9 @@ mod test {
                 id,
                 unlock,
                 scope: LockScope::Transaction,
+                all: false,
+                try_lock: false,
+                expression: None,
             }
         }
 
@@ -3672,6 +4334,44 @@ mod test {
             );
         }
 
+        #[test]
+        fn unlock_shared() {
+            assert_eq!(
+                locks("SELECT pg_advisory_unlock_shared(42)"),
+                vec![session(Some(42), true)],
+            );
+        }
+
+        fn expression(query: &str) -> Option<u64> {
+            let locks = locks(query);
+            assert_eq!(locks.len(), 1, "{query}");
+            assert_eq!(locks[0].id, None, "{query}");
+            locks[0].expression
+        }
+
+        #[test]
+        fn unresolved_key() {
+            // The key is computed by Postgres, so we key the lock on the expression.
+            let lock = expression("SELECT pg_advisory_lock(hashtext('job'))");
+            assert!(lock.is_some());
+            assert_eq!(
+                expression("SELECT pg_advisory_unlock(HASHTEXT( 'job' ))"),
+                lock
+            );
+            assert_ne!(
+                expression("SELECT pg_advisory_unlock(hashtext('other'))"),
+                lock
+            );
+        }
+
+        #[test]
+        fn two_keys() {
+            let lock = expression("SELECT pg_advisory_lock(1, 2)");
+            assert!(lock.is_some());
+            assert_eq!(expression("SELECT pg_advisory_unlock(1, 2)"), lock);
+            assert_ne!(expression("SELECT pg_advisory_unlock(1, 3)"), lock);
+        }
+
         #[test]
         fn bigint_argument() {
             // Values larger than i32 are encoded as Float in pg_query.
@@ -3683,12 +4383,15 @@ mod test {
 
         #[test]
         fn all_session_lock_variants() {
+            assert_eq!(
+                locks("SELECT pg_advisory_lock_shared(7)"),
+                vec![session(Some(7), false)],
+            );
             for q in [
                 "SELECT pg_try_advisory_lock(7)",
-                "SELECT pg_advisory_lock_shared(7)",
                 "SELECT pg_try_advisory_lock_shared(7)",
             ] {
-                assert_eq!(locks(q), vec![session(Some(7), false)], "{q}");
+                assert_eq!(locks(q), vec![try_lock(session(Some(7), false))], "{q}");
             }
         }
 
@@ -3699,10 +4402,14 @@ mod test {
             for q in [
                 "SELECT pg_advisory_xact_lock(7)",
                 "SELECT pg_advisory_xact_lock_shared(7)",
+            ] {
+                assert_eq!(locks(q), vec![xact(Some(7), false)], "{q}");
+            }
+            for q in [
                 "SELECT pg_try_advisory_xact_lock(7)",
                 "SELECT pg_try_advisory_xact_lock_shared(7)",
             ] {
-                assert_eq!(locks(q), vec![xact(Some(7), false)], "{q}");
+                assert_eq!(locks(q), vec![try_lock(xact(Some(7), false))], "{q}");
             }
         }
 
@@ -3718,7 +4425,7 @@ mod test {
         fn cast_and_cte() {
             assert_eq!(
                 locks("SELECT pg_try_advisory_lock(9)::bool"),
-                vec![session(Some(9), false)],
+                vec![try_lock(session(Some(9), false))],
             );
             assert_eq!(
                 locks("WITH x AS (SELECT pg_advisory_lock(11)) SELECT * FROM x"),
@@ -3736,10 +4443,7 @@ mod test {
         #[test]
         fn unlock_all_without_bind() {
             // unlock_all takes no arguments, so it always applies.
-            assert_eq!(
-                locks("SELECT pg_advisory_unlock_all()"),
-                vec![session(None, true)],
-            );
+            assert_eq!(locks("SELECT pg_advisory_unlock_all()"), vec![unlock_all()],);
         }
 
         #[test]
@@ -3832,7 +4536,7 @@ mod test {
                      pg_advisory_unlock(30), pg_advisory_unlock_all()",
                 ),
                 vec![
-                    session(None, true),
+                    unlock_all(),
                     session(Some(10), false),
                     xact(Some(20), false),
                     session(Some(30), true),
@@ -0,0 +1,125 @@
+//! Temporary tables, views and sequences.
+//!
+//! Temporary objects belong to the server connection that created them
+//! and are dropped when it disconnects. Once a client creates one, it needs
+//! to keep its server connection for the rest of the session.
+//!
+//! Tables created with `ON COMMIT DROP` don't outlive their transaction,
+//! so they don't count.
+
+#[cfg(not(feature = "new_parser"))]
+use pg_query::{NodeEnum, protobuf::OnCommitAction};
+#[cfg(feature = "new_parser")]
+use pg_raw_parse::{Node, nodes::OnCommitAction::*};
+
+/// `RELPERSISTENCE_TEMP` from Postgres' `pg_class.h`.
+const RELPERSISTENCE_TEMP: u8 = b't';
+
+/// Objects created in `pg_temp` are temporary, e.g. `CREATE TABLE pg_temp.t`.
+/// `pg_temp_N` is the same schema, named explicitly.
+fn temporary_schema(schema: &str) -> bool {
+    schema == "pg_temp" || schema.starts_with("pg_temp_")
+}
+
+/// Check if the statement creates a temporary object.
+#[cfg(feature = "new_parser")]
+pub fn creates_temporary(node: Node<'_>) -> bool {
+    let relation = match node {
+        Node::CreateStmt(stmt) if stmt.oncommit != ONCOMMIT_DROP => stmt.relation(),
+        Node::CreateSeqStmt(stmt) => stmt.sequence(),
+        Node::ViewStmt(stmt) => stmt.view(),
+        Node::CreateTableAsStmt(stmt) => stmt
+            .into()
+            .filter(|into| into.onCommit != ONCOMMIT_DROP)
+            .and_then(|into| into.rel()),
+        _ => None,
+    };
+
+    relation.is_some_and(|relation| {
+        relation.relpersistence as u8 == RELPERSISTENCE_TEMP
+            || relation.schemaname().is_some_and(temporary_schema)
+    })
+}
+
+cfg_select! {
+    not(feature = "new_parser") => {
+        /// Check if the statement creates a temporary object.
+        pub fn creates_temporary(node: &Option<NodeEnum>) -> bool {
+            let relation = match node {
+                Some(NodeEnum::CreateStmt(stmt))
+                    if stmt.oncommit() != OnCommitAction::OncommitDrop =>
+                {
+                    stmt.relation.as_ref()
+                }
+                Some(NodeEnum::CreateSeqStmt(stmt)) => stmt.sequence.as_ref(),
+                Some(NodeEnum::ViewStmt(stmt)) => stmt.view.as_ref(),
+                Some(NodeEnum::CreateTableAsStmt(stmt)) => stmt
+                    .into
+                    .as_ref()
+                    .filter(|into| into.on_commit() != OnCommitAction::OncommitDrop)
+                    .and_then(|into| into.rel.as_ref()),
+                _ => None,
+            };
+
+            relation.is_some_and(|relation| {
+                relation.relpersistence.as_bytes() == [RELPERSISTENCE_TEMP]
+                    || temporary_schema(&relation.schemaname)
+            })
+        }
+    }
+    _ => {}
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[cfg(feature = "new_parser")]
+    fn temporary(query: &str) -> bool {
+        let ast = pg_raw_parse::parse(query).unwrap();
+        creates_temporary(ast.stmts().next().unwrap())
+    }
+
+    cfg_select! {
+        not(feature = "new_parser") => {
+            fn temporary(query: &str) -> bool {
+                let ast = pg_query::parse(query).unwrap();
+                creates_temporary(&ast.protobuf.stmts[0].stmt.as_ref().unwrap().node)
+            }
+        }
+        _ => {}
+    }
+
+    #[test]
+    fn test_creates_temporary() {
+        for query in [
+            "CREATE TEMP TABLE t (id BIGINT)",
+            "CREATE TEMPORARY TABLE IF NOT EXISTS t (id BIGINT)",
+            "CREATE TEMP TABLE t AS SELECT 1",
+            "CREATE TEMPORARY SEQUENCE s",
+            "CREATE TEMP VIEW v AS SELECT 1",
+            "CREATE TABLE pg_temp.t (id BIGINT)",
+            "CREATE TABLE pg_temp_3.t AS SELECT 1",
+            "CREATE SEQUENCE pg_temp.s",
+            "CREATE VIEW pg_temp.v AS SELECT 1",
+        ] {
+            assert!(temporary(query), "{}", query);
+        }
+
+        for query in [
+            "CREATE TABLE t (id BIGINT)",
+            "CREATE UNLOGGED TABLE t (id BIGINT)",
+            "CREATE TABLE t AS SELECT 1",
+            "CREATE SEQUENCE s",
+            "CREATE VIEW v AS SELECT 1",
+            "CREATE TABLE public.t (id BIGINT)",
+            "CREATE TABLE pg_template.t (id BIGINT)",
+            "CREATE TABLE pg_temp.t (id BIGINT) ON COMMIT DROP",
+            "CREATE TEMP TABLE t (id BIGINT) ON COMMIT DROP",
+            "CREATE TEMP TABLE t ON COMMIT DROP AS SELECT 1",
+            "SELECT 1",
+        ] {
+            assert!(!temporary(query), "{}", query);
+        }
+    }
+}
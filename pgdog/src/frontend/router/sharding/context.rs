@@ -1,3 +1,4 @@
+use crate::config::DataType;
 use crate::frontend::router::parser::Shard;
 use tracing::trace;
 
@@ -8,15 +9,26 @@ pub struct Context<'a> {
     pub(super) value: Value<'a>,
     pub(super) operator: Operator<'a>,
     pub(super) hasher: Hasher,
+    pub(super) uuid_timestamp: bool,
 }
 
 impl Context<'_> {
     pub fn apply(&self) -> Result<Shard, Error> {
+        if self.uuid_timestamp
+            && let Some(timestamp) = self.value.uuid_timestamp()?
+        {
+            return self.shard(&Value::new(timestamp.as_str(), DataType::Varchar));
+        }
+
+        self.shard(&self.value)
+    }
+
+    fn shard(&self, value: &Value<'_>) -> Result<Shard, Error> {
         match &self.operator {
             Operator::Shards(shards) => {
                 trace!("sharding using hash");
-                if let Some(hash) = self.value.hash(self.hasher)? {
-                    return Ok(Shard::Direct(hash as usize % shards));
+                if let Some(hash) = value.hash(self.hasher)? {
+                    return Ok(Shard::Direct(self.hasher.shard(hash, *shards)));
                 }
             }
 
@@ -26,13 +38,13 @@ impl Context<'_> {
                 centroids,
             } => {
                 trace!("sharding using k-means");
-                if let Some(vector) = self.value.vector()? {
+                if let Some(vector) = value.vector()? {
                     return Ok(centroids.shard(&vector, *shards, *probes).into());
                 }
             }
 
             Operator::Mapping(mapping) => {
-                return mapping.shard(&self.value);
+                return mapping.shard(value);
             }
         }
 
@@ -4,11 +4,7 @@
 //! to a shard number, given a sharded mapping in pgdog.toml.
 //!
 use crate::frontend::router::sharding::mapping::MappingResolver;
-use crate::{
-    backend::ShardingSchema,
-    config::{DataType, Hasher as HasherConfig},
-    frontend::router::sharding::ShardedTable,
-};
+use crate::{backend::ShardingSchema, config::DataType, frontend::router::sharding::ShardedTable};
 
 use super::{Centroids, Context, Data, Error, Hasher, Operator, Value};
 
@@ -22,6 +18,7 @@ pub struct ContextBuilder<'a> {
     mapping: Option<MappingResolver<'a>>,
     probes: usize,
     hasher: Hasher,
+    uuid_timestamp: bool,
 }
 
 impl<'a> ContextBuilder<'a> {
@@ -38,10 +35,8 @@ impl<'a> ContextBuilder<'a> {
             probes: table.centroid_probes,
             operator: None,
             value: None,
-            hasher: match table.hasher {
-                HasherConfig::Sha1 => Hasher::Sha1,
-                HasherConfig::Postgres => Hasher::Postgres,
-            },
+            hasher: Hasher::from(&table.hasher),
+            uuid_timestamp: table.uuid_timestamp,
             mapping: MappingResolver::new(&table.mapping),
         }
     }
@@ -64,6 +59,7 @@ impl<'a> ContextBuilder<'a> {
                     centroids: None,
                     operator: None,
                     hasher: Hasher::Postgres,
+                    uuid_timestamp: common_mapping.uuid_timestamp,
                     mapping: MappingResolver::new(&common_mapping.mapping),
                 })
             }
@@ -86,6 +82,7 @@ impl<'a> ContextBuilder<'a> {
                 centroids: None,
                 operator: None,
                 hasher: Hasher::Postgres,
+                uuid_timestamp: false,
                 mapping: None,
             })
         } else if uuid.valid() {
@@ -96,6 +93,7 @@ impl<'a> ContextBuilder<'a> {
                 centroids: None,
                 operator: None,
                 hasher: Hasher::Postgres,
+                uuid_timestamp: false,
                 mapping: None,
             })
         } else if varchar.valid() {
@@ -106,6 +104,7 @@ impl<'a> ContextBuilder<'a> {
                 centroids: None,
                 operator: None,
                 hasher: Hasher::Postgres,
+                uuid_timestamp: false,
                 mapping: None,
             })
         } else {
@@ -147,6 +146,7 @@ impl<'a> ContextBuilder<'a> {
             operator,
             value,
             hasher: self.hasher,
+            uuid_timestamp: self.uuid_timestamp,
         })
     }
 }
@@ -246,4 +246,44 @@ mod test {
         let shard = ctx.apply().unwrap();
         assert_eq!(shard, Shard::Direct(0));
     }
+
+    #[test]
+    fn test_uuid_timestamp() {
+        let table = ShardedTable {
+            data_type: DataType::Uuid,
+            uuid_timestamp: true,
+            mapping: Mapping::new(vec![
+                ShardedMappingConfig::Range(ShardedMappingRange {
+                    start: None,
+                    end: Some(FlexibleType::String("2026-02-01".into())),
+                    shard: 0,
+                }),
+                ShardedMappingConfig::Range(ShardedMappingRange {
+                    start: Some(FlexibleType::String("2026-02-01".into())),
+                    end: None,
+                    shard: 1,
+                }),
+            ]),
+            ..Default::default()
+        };
+
+        let shard = |value: &str| {
+            ContextBuilder::new(&table)
+                .data(value)
+                .shards(2)
+                .build()
+                .unwrap()
+                .apply()
+        };
+
+        assert_eq!(
+            shard("019bc134-793a-7abc-8def-0123456789ab").unwrap(),
+            Shard::Direct(0)
+        );
+        assert_eq!(
+            shard("019c167f-cc00-7abc-8def-0123456789ab").unwrap(),
+            Shard::Direct(1)
+        );
+        assert!(shard("11111111-1111-4111-8111-111111111111").is_err());
+    }
 }
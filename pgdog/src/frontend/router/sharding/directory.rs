@@ -0,0 +1,156 @@
+//! Directory sharding.
+//!
+//! Maps individual values, e.g. tenant IDs, to shards using a lookup table
+//! stored outside the config. The entries are loaded from Postgres or a local
+//! file by `backend::shard_directory` and replaced when they change.
+//!
+//! Directories are shared by source, so tables using the same one and
+//! config reloads don't need to load it again.
+
+use std::collections::HashMap;
+use std::sync::Arc;
+
+use arc_swap::ArcSwap;
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use pgdog_config::{FlexibleTypeRef, ShardedMappingDirectory};
+
+use super::Error;
+
+static DIRECTORIES: Lazy<Mutex<HashMap<ShardedMappingDirectory, Directory>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// Key -> shard lookup table.
+#[derive(Debug, Clone)]
+pub struct Directory {
+    config: ShardedMappingDirectory,
+    shards: Arc<ArcSwap<HashMap<String, usize>>>,
+}
+
+impl PartialEq for Directory {
+    fn eq(&self, other: &Self) -> bool {
+        self.config == other.config
+    }
+}
+
+impl Eq for Directory {}
+
+impl Directory {
+    /// Get the directory for this source. It's empty until it's loaded.
+    pub fn new(config: &ShardedMappingDirectory) -> Self {
+        DIRECTORIES
+            .lock()
+            .entry(config.clone())
+            .or_insert_with(|| Self {
+                config: config.clone(),
+                shards: Arc::new(ArcSwap::from_pointee(HashMap::new())),
+            })
+            .clone()
+    }
+
+    /// Where the directory is loaded from.
+    pub fn config(&self) -> &ShardedMappingDirectory {
+        &self.config
+    }
+
+    /// Shard of the value, if it's in the directory.
+    pub fn shard(&self, value: &FlexibleTypeRef<'_>) -> Option<usize> {
+        let shards = self.shards.load();
+
+        match value {
+            FlexibleTypeRef::Integer(value) => shards.get(&value.to_string()),
+            FlexibleTypeRef::Uuid(value) => shards.get(&value.to_string()),
+            FlexibleTypeRef::String(value) => shards.get(*value),
+        }
+        .copied()
+    }
+
+    /// Replace the entries, returning `true` if they changed.
+    pub fn replace(&self, shards: HashMap<String, usize>) -> bool {
+        if **self.shards.load() == shards {
+            return false;
+        }
+
+        self.shards.store(Arc::new(shards));
+        true
+    }
+
+    /// Number of entries.
+    pub fn len(&self) -> usize {
+        self.shards.load().len()
+    }
+
+    /// The directory has no entries.
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+}
+
+/// Parse a directory file with one `key,shard` pair per line.
+/// Empty lines and lines starting with `#` are skipped.
+pub fn parse(text: &str) -> Result<HashMap<String, usize>, Error> {
+    let mut shards = HashMap::new();
+
+    for (number, line) in text.lines().enumerate() {
+        let line = line.trim();
+        if line.is_empty() || line.starts_with('#') {
+            continue;
+        }
+
+        let (key, shard) = line
+            .rsplit_once(',')
+            .ok_or(Error::InvalidDirectoryEntry(number + 1))?;
+        let shard = shard
+            .trim()
+            .parse()
+            .map_err(|_| Error::InvalidDirectoryEntry(number + 1))?;
+        shards.insert(key.trim().to_owned(), shard);
+    }
+
+    Ok(shards)
+}
+
+#[cfg(test)]
+mod test {
+    use std::path::PathBuf;
+
+    use super::*;
+
+    fn config(path: &str) -> ShardedMappingDirectory {
+        ShardedMappingDirectory {
+            table: None,
+            path: Some(PathBuf::from(path)),
+            refresh_interval: 1_000,
+        }
+    }
+
+    #[test]
+    fn test_parse() {
+        let shards = parse("# tenants\n1,0\n\n acme , 1\n").unwrap();
+        assert_eq!(shards.len(), 2);
+        assert_eq!(shards["1"], 0);
+        assert_eq!(shards["acme"], 1);
+
+        assert!(matches!(
+            parse("1,0\n2\n"),
+            Err(Error::InvalidDirectoryEntry(2))
+        ));
+        assert!(parse("1,one").is_err());
+    }
+
+    #[test]
+    fn test_shared_directory() {
+        let directory = Directory::new(&config("test_shared_directory.csv"));
+        assert!(directory.is_empty());
+        assert_eq!(directory.shard(&FlexibleTypeRef::Integer(1)), None);
+
+        assert!(directory.replace(parse("1,0\nacme,1").unwrap()));
+        assert!(!directory.replace(parse("1,0\nacme,1").unwrap()));
+
+        // Entries are visible to every user of the same source.
+        let shared = Directory::new(&config("test_shared_directory.csv"));
+        assert_eq!(shared.shard(&FlexibleTypeRef::Integer(1)), Some(0));
+        assert_eq!(shared.shard(&FlexibleTypeRef::String("acme")), Some(1));
+        assert!(Directory::new(&config("test_other_directory.csv")).is_empty());
+    }
+}
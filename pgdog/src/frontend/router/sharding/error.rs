@@ -40,6 +40,15 @@ pub enum Error {
     #[error("sharding key value isn't valid")]
     InvalidValue,
 
+    #[error("{0} is not a UUIDv7")]
+    NotUuidV7(uuid::Uuid),
+
+    #[error("table \"{0}\" is not sharded")]
+    TableNotSharded(String),
+
+    #[error("directory entry on line {0} isn't a key and shard pair")]
+    InvalidDirectoryEntry(usize),
+
     #[error("config error: {0}")]
     ConfigError(#[from] pgdog_config::Error),
 
@@ -4,35 +4,71 @@ use sha1::{Digest, Sha1};
 use uuid::Uuid;
 
 use super::{bigint, uuid, varchar};
+use crate::config::Hasher as HasherConfig;
 
 #[derive(Copy, Clone, Debug, PartialEq)]
 pub enum Hasher {
     Postgres,
     Sha1,
+    /// Postgres hash, placed with jump consistent hashing.
+    Jump,
+}
+
+impl From<&HasherConfig> for Hasher {
+    fn from(config: &HasherConfig) -> Self {
+        match config {
+            HasherConfig::Sha1 => Hasher::Sha1,
+            HasherConfig::Postgres => Hasher::Postgres,
+            HasherConfig::Jump => Hasher::Jump,
+        }
+    }
 }
 
 impl Hasher {
     pub fn bigint(&self, value: i64) -> u64 {
         match self {
-            Hasher::Postgres => bigint(value),
+            Hasher::Postgres | Hasher::Jump => bigint(value),
             Hasher::Sha1 => Self::sha1(itoa::Buffer::new().format(value).as_bytes()),
         }
     }
 
     pub fn uuid(&self, value: Uuid) -> u64 {
         match self {
-            Hasher::Postgres => uuid(value),
+            Hasher::Postgres | Hasher::Jump => uuid(value),
             Hasher::Sha1 => Self::sha1(value.as_bytes()),
         }
     }
 
     pub fn varchar(&self, value: &[u8]) -> u64 {
         match self {
-            Hasher::Postgres => varchar(value),
+            Hasher::Postgres | Hasher::Jump => varchar(value),
             Hasher::Sha1 => Self::sha1(value),
         }
     }
 
+    /// Place the hash on one of the shards.
+    pub fn shard(&self, hash: u64, shards: usize) -> usize {
+        match self {
+            Hasher::Postgres | Hasher::Sha1 => hash as usize % shards,
+            Hasher::Jump => Self::jump(hash, shards),
+        }
+    }
+
+    /// Jump consistent hash, from "A Fast, Minimal Memory, Consistent Hash Algorithm"
+    /// by Lamping and Veach. Adding a shard only moves keys to the new shard.
+    fn jump(mut key: u64, shards: usize) -> usize {
+        let mut b: i64 = -1;
+        let mut j: i64 = 0;
+
+        while j < shards as i64 {
+            b = j;
+            key = key.wrapping_mul(2862933555777941757).wrapping_add(1);
+            j = ((b + 1) as f64 * ((1u64 << 31) as f64 / ((key >> 33) + 1) as f64)) as i64;
+        }
+
+        b as usize
+    }
+
     fn sha1(bytes: &[u8]) -> u64 {
         let mut hasher = Sha1::new();
         hasher.update(bytes);
@@ -61,4 +97,39 @@ mod test {
             assert_eq!(shard, *expected as u64);
         }
     }
+
+    #[test]
+    fn test_jump_hash() {
+        // Placement must never change, or existing data ends up on the wrong shard.
+        assert_eq!(Hasher::jump(0, 1), 0);
+        assert_eq!(Hasher::jump(1, 10), 6);
+        assert_eq!(Hasher::jump(0xDEAD_BEEF, 100), 87);
+        assert_eq!(Hasher::jump(12345, 1000), 938);
+
+        for key in 0..1000 {
+            assert_eq!(Hasher::Jump.shard(key, 1), 0);
+        }
+    }
+
+    #[test]
+    fn test_jump_hash_moves_keys_to_new_shard() {
+        let hasher = Hasher::Jump;
+        let keys = 10_000;
+        let mut moved = 0;
+
+        for id in 0..keys {
+            let hash = hasher.bigint(id);
+            let before = hasher.shard(hash, 4);
+            let after = hasher.shard(hash, 5);
+
+            if before != after {
+                // Keys only ever move to the new shard.
+                assert_eq!(after, 4);
+                moved += 1;
+            }
+        }
+
+        // About 1/5 of the keys move, compared to 4/5 with modulo.
+        assert!(moved > keys / 6 && moved < keys / 4, "moved {}", moved);
+    }
 }
@@ -4,7 +4,7 @@ use indexmap::IndexMap;
 use pgdog_config::{FlexibleType, FlexibleTypeRef, ShardedMappingConfig, ShardedMappingRange};
 
 use crate::frontend::router::parser::Shard;
-use crate::frontend::router::sharding::{Error, Value};
+use crate::frontend::router::sharding::{Directory, Error, RollingShards, Value};
 
 #[derive(Debug, Clone, Eq, PartialEq)]
 struct ListShards {
@@ -73,8 +73,10 @@ pub(crate) fn range_shard(
 /// Runtime mapping of explicit column values or ranges to shard numbers.
 #[derive(Debug, Clone, Eq, PartialEq)]
 pub struct Mapping {
+    directory: Vec<Directory>,
     list: ListShards,
     range: RangeShards,
+    rolling: Vec<RollingShards>,
     pub default: Option<usize>,
 }
 
@@ -82,6 +84,8 @@ impl Mapping {
     pub fn new(mappings: Vec<ShardedMappingConfig>) -> Option<Self> {
         let mut list = IndexMap::new();
         let mut range = Vec::new();
+        let mut rolling = Vec::new();
+        let mut directory = Vec::new();
         let mut default = None;
 
         for mapping in mappings {
@@ -95,13 +99,27 @@ impl Mapping {
                 ShardedMappingConfig::Range(r) => {
                     range.push(r);
                 }
+                ShardedMappingConfig::Rolling(r) => {
+                    // Invalid rules are reported by config validation.
+                    rolling.extend(RollingShards::new(&r));
+                }
+                ShardedMappingConfig::Directory(d) => {
+                    directory.push(Directory::new(&d));
+                }
             }
         }
 
-        if !list.is_empty() || !range.is_empty() || default.is_some() {
+        if !directory.is_empty()
+            || !list.is_empty()
+            || !range.is_empty()
+            || !rolling.is_empty()
+            || default.is_some()
+        {
             Some(Self {
+                directory,
                 list: ListShards { mapping: list },
                 range: RangeShards { mapping: range },
+                rolling,
                 default,
             })
         } else {
@@ -110,11 +128,22 @@ impl Mapping {
     }
 
     pub fn shard(&self, value: &FlexibleTypeRef<'_>) -> Option<usize> {
-        self.list
-            .shard(value)
+        self.directory
+            .iter()
+            .find_map(|directory| directory.shard(value))
+            .or_else(|| self.list.shard(value))
             .or_else(|| self.range.shard(value))
+            .or_else(|| self.rolling_shard(value))
             .or(self.default)
     }
+
+    fn rolling_shard(&self, value: &FlexibleTypeRef<'_>) -> Option<usize> {
+        let FlexibleTypeRef::String(value) = value else {
+            return None;
+        };
+
+        self.rolling.iter().find_map(|rolling| rolling.shard(value))
+    }
 }
 
 #[derive(Debug)]
@@ -143,8 +172,8 @@ impl<'a> MappingResolver<'a> {
 #[cfg(test)]
 mod tests {
     use pgdog_config::{
-        FlexibleType, FlexibleTypeRef, ShardedMappingConfig, ShardedMappingList,
-        ShardedMappingRange,
+        FlexibleType, FlexibleTypeRef, RollingInterval, ShardedMappingConfig,
+        ShardedMappingDirectory, ShardedMappingList, ShardedMappingRange, ShardedMappingRolling,
     };
     use uuid::Uuid;
 
@@ -657,5 +686,58 @@ mod tests {
             assert_eq!(shard_int(&m, 999), Some(9));
             assert_eq!(shard_int(&m, -1), Some(9)); // below first range start → default
         }
+
+        /// range + rolling + default, on timestamps.
+        /// Explicit ranges take precedence over rolling ones.
+        #[test]
+        fn range_rolling_default() {
+            let m = Mapping::new(vec![
+                str_range(None, Some("2026-01-01"), 3),
+                ShardedMappingConfig::Rolling(ShardedMappingRolling {
+                    start: "2025-12-01".into(),
+                    interval: RollingInterval::Month,
+                    shards: vec![0, 1],
+                    ddl: None,
+                    premake: 1,
+                }),
+                default(9),
+            ])
+            .unwrap();
+
+            // range hits
+            assert_eq!(shard_str(&m, "2025-06-01 10:00:00"), Some(3));
+            assert_eq!(shard_str(&m, "2025-12-31 10:00:00"), Some(3));
+
+            // rolling hits
+            assert_eq!(shard_str(&m, "2026-01-01 00:00:00"), Some(1));
+            assert_eq!(shard_str(&m, "2026-02-14 12:00:00"), Some(0));
+            assert_eq!(shard_str(&m, "2030-03-01 00:00:00"), Some(1));
+
+            // default (not a timestamp)
+            assert_eq!(shard_str(&m, "next week"), Some(9));
+        }
+
+        /// directory + range: values in the directory override the range,
+        /// e.g. tenants moved to another shard.
+        #[test]
+        fn directory_range() {
+            let config = ShardedMappingDirectory {
+                table: Some("directory_range".into()),
+                path: None,
+                refresh_interval: 1_000,
+            };
+            let m = Mapping::new(vec![
+                ShardedMappingConfig::Directory(config.clone()),
+                range(Some(0), Some(100), 0),
+            ])
+            .unwrap();
+
+            assert_eq!(shard_int(&m, 5), Some(0));
+
+            Directory::new(&config).replace([("5".to_string(), 1)].into());
+            assert_eq!(shard_int(&m, 5), Some(1));
+            assert_eq!(shard_int(&m, 6), Some(0));
+            assert_eq!(shard_int(&m, 100), None);
+        }
     }
 }
@@ -14,12 +14,15 @@ use crate::{
 pub mod benchmark_simd;
 pub mod context;
 pub mod context_builder;
+pub mod directory;
 pub mod distance_simd_rust;
 pub mod error;
 pub mod ffi;
 pub mod hasher;
 pub mod mapping;
 pub mod operator;
+pub mod relationships;
+pub mod rolling;
 pub mod schema;
 pub mod tables;
 #[cfg(test)]
@@ -29,10 +32,13 @@ pub mod vector;
 
 pub use context::*;
 pub use context_builder::*;
+pub use directory::Directory;
 pub use error::Error;
 pub use hasher::Hasher;
 pub use mapping::Mapping;
 pub use operator::*;
+pub use relationships::Relationships;
+pub use rolling::RollingShards;
 pub use schema::SchemaSharder;
 pub use tables::*;
 pub use value::*;
@@ -69,6 +75,7 @@ pub(crate) fn shard_str(
     schema: &ShardingSchema,
     centroids: &Vec<Vector>,
     centroid_probes: usize,
+    hasher: Hasher,
 ) -> Shard {
     let data_type = if value.starts_with('[') && value.ends_with(']') {
         DataType::Vector
@@ -79,7 +86,14 @@ pub(crate) fn shard_str(
     } else {
         DataType::Varchar
     };
-    shard_value(value, &data_type, schema.shards, centroids, centroid_probes)
+    shard_value(
+        value,
+        &data_type,
+        schema.shards,
+        centroids,
+        centroid_probes,
+        hasher,
+    )
 }
 
 /// Shard a value that's coming out of the query text directly.
@@ -89,17 +103,18 @@ pub(crate) fn shard_value(
     shards: usize,
     centroids: &Vec<Vector>,
     centroid_probes: usize,
+    hasher: Hasher,
 ) -> Shard {
     match data_type {
         DataType::Bigint => value
             .parse()
-            .map(|v| bigint(v) as usize % shards)
+            .map(|v| hasher.shard(hasher.bigint(v), shards))
             .ok()
             .map(Shard::Direct)
             .unwrap_or(Shard::All),
         DataType::Uuid => value
             .parse()
-            .map(|v| uuid(v) as usize % shards)
+            .map(|v| hasher.shard(hasher.uuid(v), shards))
             .ok()
             .map(Shard::Direct)
             .unwrap_or(Shard::All),
@@ -111,7 +126,7 @@ pub(crate) fn shard_value(
                     .into()
             })
             .unwrap_or(Shard::All),
-        DataType::Varchar => Shard::Direct(varchar(value.as_bytes()) as usize % shards),
+        DataType::Varchar => Shard::Direct(hasher.shard(hasher.varchar(value.as_bytes()), shards)),
     }
 }
 
@@ -121,15 +136,16 @@ pub(crate) fn shard_binary(
     shards: usize,
     centroids: &Vec<Vector>,
     centroid_probes: usize,
+    hasher: Hasher,
 ) -> Shard {
     match data_type {
         DataType::Bigint => i64::decode(bytes, Format::Binary)
             .ok()
-            .map(|i| Shard::new_direct(bigint(i) as usize % shards))
+            .map(|i| Shard::new_direct(hasher.shard(hasher.bigint(i), shards)))
             .unwrap_or(Shard::All),
         DataType::Uuid => Uuid::decode(bytes, Format::Binary)
             .ok()
-            .map(|u| Shard::new_direct(uuid(u) as usize % shards))
+            .map(|u| Shard::new_direct(hasher.shard(hasher.uuid(u), shards)))
             .unwrap_or(Shard::All),
         DataType::Vector => Vector::decode(bytes, Format::Binary)
             .ok()
@@ -139,7 +155,7 @@ pub(crate) fn shard_binary(
                     .into()
             })
             .unwrap_or(Shard::All),
-        DataType::Varchar => Shard::Direct(varchar(bytes) as usize % shards),
+        DataType::Varchar => Shard::Direct(hasher.shard(hasher.varchar(bytes), shards)),
     }
 }
 
@@ -152,6 +168,7 @@ pub fn shard_param(value: &ParameterWithFormat, table: &ShardedTable, shards: us
             shards,
             &table.centroids,
             table.centroid_probes,
+            Hasher::from(&table.hasher),
         ),
         Format::Text => value
             .text()
@@ -162,6 +179,7 @@ pub fn shard_param(value: &ParameterWithFormat, table: &ShardedTable, shards: us
                     shards,
                     &table.centroids,
                     table.centroid_probes,
+                    Hasher::from(&table.hasher),
                 )
             })
             .unwrap_or(Shard::All),
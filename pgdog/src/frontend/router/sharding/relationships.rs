@@ -0,0 +1,273 @@
+//! Routing for child tables that don't have the sharding key,
+//! but reference a parent table that does.
+//!
+//! The shard of each parent row is learned from inserts into the parent
+//! table, once they succeed, and kept in a bounded LRU cache shared by all
+//! users of the database. Queries on the child table that reference a known
+//! parent row go to its shard; the rest are broadcast, except inserts, which
+//! look the parent row up on all shards first.
+
+use std::{collections::HashMap, num::NonZeroUsize, sync::Arc};
+
+use lru::LruCache;
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use pgdog_config::RoutingRelationship;
+
+use super::Value;
+
+/// Parent row, identified by the value of the referenced column.
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+struct ParentKey {
+    table: String,
+    column: String,
+    value: String,
+}
+
+impl ParentKey {
+    fn new(relationship: &RoutingRelationship, value: &str) -> Self {
+        Self {
+            table: relationship.parent_table.clone(),
+            column: relationship.parent_column.clone(),
+            value: value.to_owned(),
+        }
+    }
+}
+
+type Shards = Arc<Mutex<LruCache<ParentKey, usize>>>;
+
+/// Parent row -> shard, by database. Kept across config reloads.
+static SHARDS: Lazy<Mutex<HashMap<String, Shards>>> = Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// Cache of the database's parent rows, resized to `limit`.
+fn shards(database: &str, limit: NonZeroUsize) -> Shards {
+    let shards = SHARDS
+        .lock()
+        .entry(database.to_owned())
+        .or_insert_with(|| Arc::new(Mutex::new(LruCache::new(limit))))
+        .clone();
+    shards.lock().resize(limit);
+    shards
+}
+
+/// Forget where the database's parent rows are, e.g.,
+/// after rows were moved to another shard.
+pub fn forget(database: &str) {
+    if let Some(shards) = SHARDS.lock().get(database) {
+        shards.lock().clear();
+    }
+}
+
+/// Parent row of a child row being inserted, whose shard we don't know.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ParentRow {
+    /// Child table.
+    pub table: String,
+    pub relationship: RoutingRelationship,
+    /// Value of the referenced column, if it could be read.
+    pub key: Option<String>,
+}
+
+/// Shard of a parent row written by a query. Learned
+/// once the query succeeds.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ParentShard {
+    pub relationship: RoutingRelationship,
+    pub key: String,
+    pub shard: usize,
+}
+
+#[derive(Debug)]
+struct Inner {
+    relationships: Vec<RoutingRelationship>,
+    shards: Shards,
+}
+
+/// Routing relationships configured for a database.
+#[derive(Debug, Clone)]
+pub struct Relationships {
+    inner: Arc<Inner>,
+}
+
+impl Default for Relationships {
+    fn default() -> Self {
+        Self {
+            inner: Arc::new(Inner {
+                relationships: vec![],
+                shards: Arc::new(Mutex::new(LruCache::new(NonZeroUsize::MIN))),
+            }),
+        }
+    }
+}
+
+impl Relationships {
+    /// Create relationships for a database, remembering the shard
+    /// of up to `limit` parent rows.
+    pub fn new(database: &str, relationships: Vec<RoutingRelationship>, limit: usize) -> Self {
+        let limit = NonZeroUsize::new(limit).unwrap_or(NonZeroUsize::MIN);
+
+        Self {
+            inner: Arc::new(Inner {
+                relationships,
+                shards: shards(database, limit),
+            }),
+        }
+    }
+
+    /// No relationships are configured.
+    pub fn is_empty(&self) -> bool {
+        self.inner.relationships.is_empty()
+    }
+
+    /// Relationship routing queries that filter on this column of a child table.
+    pub fn child(
+        &self,
+        schema: Option<&str>,
+        table: &str,
+        column: &str,
+    ) -> Option<&RoutingRelationship> {
+        self.inner
+            .relationships
+            .iter()
+            .find(|relationship| relationship.is_child(schema, table, column))
+    }
+
+    /// Table is a child table. Its rows are spread across shards
+    /// like the parent's, so it's not omnisharded.
+    pub fn is_child(&self, schema: Option<&str>, table: &str) -> bool {
+        self.inner
+            .relationships
+            .iter()
+            .any(|relationship| relationship.is_child_table(schema, table))
+    }
+
+    /// Relationships referencing this parent table.
+    pub fn parents<'a>(
+        &'a self,
+        schema: Option<&'a str>,
+        table: &'a str,
+    ) -> impl Iterator<Item = &'a RoutingRelationship> {
+        self.inner
+            .relationships
+            .iter()
+            .filter(move |relationship| relationship.is_parent(schema, table))
+    }
+
+    /// Remember the shard of a parent row.
+    pub fn learn(&self, parent: &ParentShard) {
+        self.inner.shards.lock().put(
+            ParentKey::new(&parent.relationship, &parent.key),
+            parent.shard,
+        );
+    }
+
+    /// Shard of the parent row, if we've seen it.
+    pub fn lookup(&self, relationship: &RoutingRelationship, key: &str) -> Option<usize> {
+        self.inner
+            .shards
+            .lock()
+            .get(&ParentKey::new(relationship, key))
+            .copied()
+    }
+}
+
+/// Value of the referenced column as text, so the same row matches no matter
+/// how the value was sent, e.g. `5`, `'5'` or a binary parameter.
+pub fn key(value: &Value<'_>) -> Option<String> {
+    if let Ok(Some(integer)) = value.integer() {
+        Some(integer.to_string())
+    } else if let Ok(Some(uuid)) = value.uuid() {
+        Some(uuid.to_string())
+    } else if let Ok(Some(varchar)) = value.varchar() {
+        Some(varchar.to_owned())
+    } else {
+        None
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pgdog_config::DataType;
+
+    use super::*;
+
+    fn relationship() -> RoutingRelationship {
+        RoutingRelationship {
+            database: "pgdog".into(),
+            table: "order_items".into(),
+            column: "order_id".into(),
+            parent_table: "orders".into(),
+            parent_column: "id".into(),
+            ..Default::default()
+        }
+    }
+
+    fn parent(relationship: &RoutingRelationship, key: &str, shard: usize) -> ParentShard {
+        ParentShard {
+            relationship: relationship.clone(),
+            key: key.into(),
+            shard,
+        }
+    }
+
+    #[test]
+    fn test_learn_and_lookup() {
+        let relationships = Relationships::new("test_learn_and_lookup", vec![relationship()], 2);
+        let order_items = relationships
+            .child(None, "order_items", "order_id")
+            .unwrap()
+            .clone();
+        assert!(relationships.child(None, "order_items", "id").is_none());
+        assert!(relationships.is_child(Some("public"), "order_items"));
+        assert!(!relationships.is_child(None, "orders"));
+        assert_eq!(relationships.parents(None, "orders").count(), 1);
+
+        relationships.learn(&parent(&order_items, "1", 0));
+        relationships.learn(&parent(&order_items, "2", 1));
+        assert_eq!(relationships.lookup(&order_items, "1"), Some(0));
+        assert_eq!(relationships.lookup(&order_items, "2"), Some(1));
+        assert_eq!(relationships.lookup(&order_items, "3"), None);
+
+        // Least recently used row is forgotten.
+        relationships.learn(&parent(&order_items, "3", 1));
+        assert_eq!(relationships.lookup(&order_items, "3"), Some(1));
+        assert_eq!(relationships.lookup(&order_items, "1"), None);
+    }
+
+    #[test]
+    fn test_shared_by_database() {
+        let relationship = relationship();
+        let first = Relationships::new("test_shared_by_database", vec![relationship.clone()], 10);
+        first.learn(&parent(&relationship, "1", 1));
+
+        // Another user of the database, or the same one after a reload.
+        let second = Relationships::new("test_shared_by_database", vec![relationship.clone()], 10);
+        assert_eq!(second.lookup(&relationship, "1"), Some(1));
+
+        let other = Relationships::new(
+            "test_shared_by_database_other",
+            vec![relationship.clone()],
+            10,
+        );
+        assert_eq!(other.lookup(&relationship, "1"), None);
+
+        forget("test_shared_by_database");
+        assert_eq!(first.lookup(&relationship, "1"), None);
+    }
+
+    #[test]
+    fn test_key() {
+        assert_eq!(key(&Value::new(5_i64, DataType::Bigint)), Some("5".into()));
+        assert_eq!(key(&Value::new("5", DataType::Bigint)), Some("5".into()));
+        let binary = 5_i64.to_be_bytes();
+        assert_eq!(
+            key(&Value::new(&binary[..], DataType::Bigint)),
+            Some("5".into())
+        );
+        assert_eq!(key(&Value::new("five", DataType::Bigint)), None);
+        assert_eq!(
+            key(&Value::new("a", DataType::Varchar)),
+            Some("a".to_string())
+        );
+    }
+}
@@ -0,0 +1,223 @@
+//! Rolling time ranges.
+//!
+//! Maps timestamps to shards one interval (day, week or month) at a time,
+//! cycling through a list of shards. Ranges are computed from the start,
+//! so new ones never need to be added to the config.
+
+use chrono::{DateTime, Datelike, Months, NaiveDate, NaiveDateTime, NaiveTime, TimeDelta};
+use pgdog_config::{RollingInterval, ShardedMappingRolling};
+
+/// Timestamp format used for range bounds in DDL.
+const BOUND_FORMAT: &str = "%Y-%m-%d %H:%M:%S";
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RollingShards {
+    start: NaiveDateTime,
+    interval: RollingInterval,
+    shards: Vec<usize>,
+}
+
+impl RollingShards {
+    /// Create rolling ranges from config. Returns `None` if the config is invalid:
+    /// `start` isn't a timestamp, monthly ranges don't start at the beginning of a month,
+    /// or there are no shards.
+    pub fn new(config: &ShardedMappingRolling) -> Option<Self> {
+        let start = parse_timestamp(&config.start)?;
+
+        if config.shards.is_empty() {
+            return None;
+        }
+
+        if config.interval == RollingInterval::Month
+            && (start.day() != 1 || start.time() != NaiveTime::MIN)
+        {
+            return None;
+        }
+
+        Some(Self {
+            start,
+            interval: config.interval,
+            shards: config.shards.clone(),
+        })
+    }
+
+    /// Shard for a timestamp, if it's not before the first range.
+    pub fn shard(&self, value: &str) -> Option<usize> {
+        let timestamp = parse_timestamp(value)?;
+        self.index(timestamp).map(|index| self.range_shard(index))
+    }
+
+    /// Index of the range containing the timestamp.
+    pub fn index(&self, timestamp: NaiveDateTime) -> Option<u32> {
+        if timestamp < self.start {
+            return None;
+        }
+
+        let index = match self.interval {
+            RollingInterval::Day => (timestamp - self.start).num_days(),
+            RollingInterval::Week => (timestamp - self.start).num_weeks(),
+            RollingInterval::Month => {
+                (timestamp.year() - self.start.year()) as i64 * 12 + timestamp.month() as i64
+                    - self.start.month() as i64
+            }
+        };
+
+        u32::try_from(index).ok()
+    }
+
+    /// Shard the range is assigned to.
+    pub fn range_shard(&self, index: u32) -> usize {
+        self.shards[index as usize % self.shards.len()]
+    }
+
+    /// Range bounds, start inclusive and end exclusive.
+    pub fn bounds(&self, index: u32) -> Option<(NaiveDateTime, NaiveDateTime)> {
+        let bound = |index: u32| match self.interval {
+            RollingInterval::Day => self.start.checked_add_signed(TimeDelta::days(index as i64)),
+            RollingInterval::Week => self
+                .start
+                .checked_add_signed(TimeDelta::weeks(index as i64)),
+            RollingInterval::Month => self.start.checked_add_months(Months::new(index)),
+        };
+
+        Some((bound(index)?, bound(index.checked_add(1)?)?))
+    }
+
+    /// Fill in the DDL template for the range.
+    pub fn ddl(&self, template: &str, index: u32) -> Option<String> {
+        let (start, end) = self.bounds(index)?;
+        let suffix = match self.interval {
+            RollingInterval::Month => start.format("%Y_%m"),
+            RollingInterval::Day | RollingInterval::Week => start.format("%Y_%m_%d"),
+        };
+
+        Some(
+            template
+                .replace("{start}", &start.format(BOUND_FORMAT).to_string())
+                .replace("{end}", &end.format(BOUND_FORMAT).to_string())
+                .replace("{suffix}", &suffix.to_string()),
+        )
+    }
+}
+
+/// Parse a timestamp or a date. Timestamps with a time zone
+/// are converted to UTC, others are assumed to be in UTC already.
+pub fn parse_timestamp(value: &str) -> Option<NaiveDateTime> {
+    let value = value.trim();
+
+    for format in ["%Y-%m-%d %H:%M:%S%.f%#z", "%Y-%m-%dT%H:%M:%S%.f%#z"] {
+        if let Ok(timestamp) = DateTime::parse_from_str(value, format) {
+            return Some(timestamp.naive_utc());
+        }
+    }
+
+    for format in ["%Y-%m-%d %H:%M:%S%.f", "%Y-%m-%dT%H:%M:%S%.f"] {
+        if let Ok(timestamp) = NaiveDateTime::parse_from_str(value, format) {
+            return Some(timestamp);
+        }
+    }
+
+    NaiveDate::parse_from_str(value, "%Y-%m-%d")
+        .ok()
+        .map(|date| date.and_time(NaiveTime::MIN))
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    fn rolling(start: &str, interval: RollingInterval, shards: Vec<usize>) -> RollingShards {
+        RollingShards::new(&ShardedMappingRolling {
+            start: start.into(),
+            interval,
+            shards,
+            ddl: None,
+            premake: 1,
+        })
+        .unwrap()
+    }
+
+    #[test]
+    fn test_parse_timestamp() {
+        let expected = NaiveDate::from_ymd_opt(2026, 5, 14)
+            .unwrap()
+            .and_hms_opt(10, 0, 0)
+            .unwrap();
+
+        assert_eq!(parse_timestamp("2026-05-14 10:00:00"), Some(expected));
+        assert_eq!(parse_timestamp("2026-05-14T10:00:00"), Some(expected));
+        assert_eq!(parse_timestamp("2026-05-14 12:00:00+02"), Some(expected));
+        assert_eq!(parse_timestamp("2026-05-14T10:00:00Z"), Some(expected));
+        assert_eq!(
+            parse_timestamp("2026-05-14 10:00:00.123456"),
+            expected.checked_add_signed(TimeDelta::microseconds(123456))
+        );
+        assert_eq!(
+            parse_timestamp("2026-05-14"),
+            NaiveDate::from_ymd_opt(2026, 5, 14)
+                .unwrap()
+                .and_hms_opt(0, 0, 0)
+        );
+        assert_eq!(parse_timestamp("yesterday"), None);
+    }
+
+    #[test]
+    fn test_monthly() {
+        let rolling = rolling("2026-01-01", RollingInterval::Month, vec![0, 1, 2]);
+
+        assert_eq!(rolling.shard("2025-12-31 23:59:59"), None);
+        assert_eq!(rolling.shard("2026-01-01 00:00:00"), Some(0));
+        assert_eq!(rolling.shard("2026-01-31 23:59:59"), Some(0));
+        assert_eq!(rolling.shard("2026-02-01"), Some(1));
+        assert_eq!(rolling.shard("2026-03-15"), Some(2));
+        assert_eq!(rolling.shard("2026-04-01"), Some(0));
+        assert_eq!(rolling.shard("2027-01-01"), Some(0));
+        assert_eq!(rolling.shard("2027-02-01"), Some(1));
+        assert_eq!(rolling.shard("not a timestamp"), None);
+    }
+
+    #[test]
+    fn test_daily_and_weekly() {
+        let daily = rolling("2026-05-01", RollingInterval::Day, vec![0, 1]);
+        assert_eq!(daily.shard("2026-05-01 23:00:00"), Some(0));
+        assert_eq!(daily.shard("2026-05-02 01:00:00"), Some(1));
+        assert_eq!(daily.shard("2026-05-03"), Some(0));
+
+        let weekly = rolling("2026-05-04", RollingInterval::Week, vec![3, 4]);
+        assert_eq!(weekly.shard("2026-05-10 23:59:59"), Some(3));
+        assert_eq!(weekly.shard("2026-05-11"), Some(4));
+        assert_eq!(weekly.shard("2026-05-18"), Some(3));
+    }
+
+    #[test]
+    fn test_invalid() {
+        let config = |start: &str, interval, shards| ShardedMappingRolling {
+            start: String::from(start),
+            interval,
+            shards,
+            ddl: None,
+            premake: 1,
+        };
+
+        assert!(
+            RollingShards::new(&config("2026-01-15", RollingInterval::Month, vec![0])).is_none()
+        );
+        assert!(RollingShards::new(&config("soon", RollingInterval::Day, vec![0])).is_none());
+        assert!(RollingShards::new(&config("2026-01-01", RollingInterval::Day, vec![])).is_none());
+        assert!(
+            RollingShards::new(&config("2026-01-15", RollingInterval::Week, vec![0])).is_some()
+        );
+    }
+
+    #[test]
+    fn test_ddl() {
+        let rolling = rolling("2026-11-01", RollingInterval::Month, vec![0, 1]);
+        let template = "CREATE TABLE IF NOT EXISTS events_{suffix} PARTITION OF events FOR VALUES FROM ('{start}') TO ('{end}')";
+
+        assert_eq!(
+            rolling.ddl(template, 1).unwrap(),
+            "CREATE TABLE IF NOT EXISTS events_2026_12 PARTITION OF events FOR VALUES FROM ('2026-12-01 00:00:00') TO ('2027-01-01 00:00:00')"
+        );
+        assert_eq!(rolling.range_shard(1), 1);
+    }
+}
@@ -78,6 +78,7 @@ mod tests {
             name: None, // This makes it a catch-all/default
             shard: 0,
             all: false,
+            hash: false,
         };
 
         // Create a specific schema "sales" that routes to shard 1
@@ -86,9 +87,10 @@ mod tests {
             name: Some("sales".to_string()),
             shard: 1,
             all: false,
+            hash: false,
         };
 
-        let schemas = ShardedSchemas::new(vec![catch_all, sales_schema]);
+        let schemas = ShardedSchemas::new(vec![catch_all, sales_schema], 2);
 
         // Test 1: When we resolve "sales", we should get shard 1 (specific match, not catch-all)
         let mut sharder = SchemaSharder::default();
@@ -20,6 +20,8 @@ pub struct ShardedTable {
     pub data_type: DataType,
     pub centroid_probes: usize,
     pub hasher: Hasher,
+    /// Shard UUIDv7 values by their timestamp.
+    pub uuid_timestamp: bool,
     pub mapping: Option<Mapping>,
 }
 
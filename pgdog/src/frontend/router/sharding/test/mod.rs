@@ -102,7 +102,7 @@ fn assert_shard(val: &[u8], expected_shard: usize) {
     assert_eq!(varchar(val) as usize % 3, expected_shard);
 
     let s = from_utf8(val).unwrap();
-    let shard = shard_str(s, &schema, &vec![], 0);
+    let shard = shard_str(s, &schema, &vec![], 0, Hasher::Postgres);
     assert_eq!(shard, Shard::Direct(expected_shard));
     let shard = shard_value(
         s,
@@ -110,6 +110,7 @@ fn assert_shard(val: &[u8], expected_shard: usize) {
         3,
         &vec![],
         expected_shard,
+        Hasher::Postgres,
     );
     assert_eq!(shard, Shard::Direct(expected_shard));
     let ctx = ContextBuilder::new(&table)
@@ -121,6 +122,51 @@ fn assert_shard(val: &[u8], expected_shard: usize) {
     assert_eq!(shard, Shard::Direct(expected_shard));
 }
 
+#[test]
+fn test_shard_value_jump_hasher() {
+    let table = ShardedTable {
+        data_type: DataType::Bigint,
+        hasher: crate::config::Hasher::Jump,
+        ..Default::default()
+    };
+    let schema = ShardingSchema {
+        shards: 5,
+        ..Default::default()
+    };
+    let mut modulo = 0;
+
+    for id in 0..100i64 {
+        let expected = Hasher::Jump.shard(bigint(id), 5);
+        if expected != bigint(id) as usize % 5 {
+            modulo += 1;
+        }
+
+        let value = id.to_string();
+        let text = shard_str(&value, &schema, &vec![], 0, Hasher::Jump);
+        assert_eq!(text, Shard::Direct(expected));
+
+        let binary = shard_binary(
+            &id.to_be_bytes(),
+            &table.data_type,
+            5,
+            &vec![],
+            0,
+            Hasher::from(&table.hasher),
+        );
+        assert_eq!(binary, Shard::Direct(expected));
+
+        let ctx = ContextBuilder::new(&table)
+            .data(id)
+            .shards(5)
+            .build()
+            .unwrap();
+        assert_eq!(ctx.apply().unwrap(), Shard::Direct(expected));
+    }
+
+    // Jump placement differs from modulo for most keys.
+    assert!(modulo > 0);
+}
+
 #[tokio::test]
 async fn test_binary_encoding() {
     let mut server = test_server().await;
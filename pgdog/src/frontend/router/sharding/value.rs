@@ -1,5 +1,6 @@
 use std::str::{FromStr, from_utf8};
 
+use chrono::DateTime;
 use uuid::Uuid;
 
 use super::{Error, Hasher};
@@ -153,6 +154,31 @@ impl<'a> Value<'a> {
         Ok(Some(uuid))
     }
 
+    /// Timestamp of a UUIDv7, formatted like a `varchar` key for
+    /// rolling and range mappings, e.g. `2026-05-14 10:00:00.123`.
+    pub fn uuid_timestamp(&self) -> Result<Option<String>, Error> {
+        let Some(uuid) = self.uuid()? else {
+            return Ok(None);
+        };
+
+        if uuid.get_version_num() != 7 {
+            return Err(Error::NotUuidV7(uuid));
+        }
+
+        // Milliseconds since the epoch are the first 48 bits.
+        let mut millis = [0; 8];
+        millis[2..].copy_from_slice(&uuid.as_bytes()[..6]);
+
+        Ok(
+            DateTime::from_timestamp_millis(i64::from_be_bytes(millis)).map(|timestamp| {
+                timestamp
+                    .naive_utc()
+                    .format("%Y-%m-%d %H:%M:%S%.3f")
+                    .to_string()
+            }),
+        )
+    }
+
     pub fn hash(&self, hasher: Hasher) -> Result<Option<u64>, Error> {
         match self.data_type {
             DataType::Bigint => match self.data {
@@ -205,4 +231,26 @@ mod tests {
         assert_eq!(value.uuid()?, Some(expected_uuid));
         Ok(())
     }
+
+    #[test]
+    fn test_uuid_timestamp() -> Result<(), Error> {
+        let uuid = Uuid::parse_str("019bc134-793a-7abc-8def-0123456789ab")?;
+
+        let text = Value::new("019bc134-793a-7abc-8def-0123456789ab", DataType::Uuid);
+        let binary = Value::new(&uuid.as_bytes()[..], DataType::Uuid);
+        for value in [text, binary] {
+            assert_eq!(
+                value.uuid_timestamp()?.as_deref(),
+                Some("2026-01-15 10:30:00.250")
+            );
+        }
+
+        let v4 = Value::new("11111111-1111-4111-8111-111111111111", DataType::Uuid);
+        assert!(matches!(v4.uuid_timestamp(), Err(Error::NotUuidV7(_))));
+
+        let bigint = Value::new("1234", DataType::Bigint);
+        assert_eq!(bigint.uuid_timestamp()?, None);
+
+        Ok(())
+    }
 }
@@ -64,6 +64,10 @@ impl Stats {
         self.state = State::Idle;
     }
 
+    pub(super) fn retry(&mut self) {
+        self.retries += 1;
+    }
+
     pub(super) fn query(&mut self) {
         let now = Instant::now();
         self.queries += 1;
@@ -97,6 +101,10 @@ impl Stats {
         self.locked = lock;
     }
 
+    pub(super) fn pinned(&mut self, pinned: bool) {
+        self.pinned = pinned;
+    }
+
     pub(super) fn sent(&mut self, bytes: usize) {
         self.bytes_sent += bytes;
     }
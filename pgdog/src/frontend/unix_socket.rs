@@ -0,0 +1,237 @@
+//! UNIX domain socket clients can connect to, in addition to TCP.
+
+use std::io::Result;
+#[cfg(unix)]
+use std::{
+    fs::{DirBuilder, Permissions, remove_dir_all, remove_file, rename, set_permissions},
+    io::{Error, ErrorKind},
+    os::unix::fs::{DirBuilderExt, PermissionsExt},
+    path::{Path, PathBuf},
+};
+
+#[cfg(unix)]
+use tokio::net::UnixListener;
+#[cfg(unix)]
+use tracing::info;
+#[cfg(not(unix))]
+use tracing::warn;
+
+use super::ClientAddr;
+use crate::config::General;
+use crate::net::Stream;
+
+/// Listener for clients connecting over a UNIX socket.
+#[derive(Debug)]
+pub struct UnixSocket {
+    #[cfg(unix)]
+    listener: Option<(UnixListener, PathBuf)>,
+    net_buffer: usize,
+}
+
+impl UnixSocket {
+    /// Create the socket, if `unix_socket_dir` is configured.
+    #[cfg(unix)]
+    pub(crate) fn bind(general: &General, net_buffer: usize) -> Result<Self> {
+        let Some(path) = general.unix_socket_path() else {
+            return Ok(Self {
+                listener: None,
+                net_buffer,
+            });
+        };
+
+        // Remove the socket left behind by a process that didn't shut down
+        // cleanly, but don't take it from one that's still running.
+        if std::os::unix::net::UnixStream::connect(&path).is_ok() {
+            return Err(Error::new(
+                ErrorKind::AddrInUse,
+                format!("{} is used by another process", path.display()),
+            ));
+        }
+
+        match remove_file(&path) {
+            Ok(()) => (),
+            Err(err) if err.kind() == ErrorKind::NotFound => (),
+            Err(err) => return Err(err),
+        }
+
+        // Create the socket in a directory only we can access and move it into
+        // place once it has the configured permissions, so no client can connect
+        // to it before they are applied.
+        let mut private = path.clone().into_os_string();
+        private.push(format!(".{}", std::process::id()));
+        let private = PathBuf::from(private);
+        let _ = remove_dir_all(&private);
+        DirBuilder::new().mode(0o700).create(&private)?;
+
+        let listener = Self::bind_private(&private, &path, general.unix_socket_permissions);
+        let _ = remove_dir_all(&private);
+        let listener = listener?;
+
+        info!("🐕 PgDog listening on {}", path.display());
+
+        Ok(Self {
+            listener: Some((listener, path)),
+            net_buffer,
+        })
+    }
+
+    /// Bind the socket inside `dir`, set its permissions
+    /// and move it to `path`.
+    #[cfg(unix)]
+    fn bind_private(dir: &Path, path: &Path, mode: u32) -> Result<UnixListener> {
+        let socket = dir.join("socket");
+        let listener = UnixListener::bind(&socket)?;
+        set_permissions(&socket, Permissions::from_mode(mode))?;
+        rename(&socket, path)?;
+
+        Ok(listener)
+    }
+
+    #[cfg(not(unix))]
+    pub(crate) fn bind(general: &General, net_buffer: usize) -> Result<Self> {
+        if general.unix_socket_dir.is_some() {
+            warn!("UNIX sockets are not supported on this system, ignoring \"unix_socket_dir\"");
+        }
+
+        Ok(Self { net_buffer })
+    }
+
+    /// Accept a client connection. Waits forever if the socket isn't configured.
+    ///
+    /// # Cancellation safety
+    ///
+    /// This method is cancel-safe.
+    ///
+    pub(crate) async fn accept(&self) -> Result<(Stream, ClientAddr)> {
+        #[cfg(unix)]
+        if let Some((listener, _)) = &self.listener {
+            let (stream, _) = listener.accept().await?;
+            // SO_PEERCRED, or its equivalent on this system.
+            let uid = stream.peer_cred().ok().map(|cred| cred.uid());
+            return Ok((
+                Stream::unix(stream, self.net_buffer),
+                ClientAddr::Unix { uid },
+            ));
+        }
+
+        std::future::pending().await
+    }
+}
+
+/// Name of the operating system user, used for peer authentication.
+///
+/// Looking up the user can read `/etc/passwd` or ask a directory service,
+/// so it runs on the blocking thread pool.
+#[cfg(unix)]
+pub(crate) async fn user_name(uid: u32) -> Option<String> {
+    tokio::task::spawn_blocking(move || getpwuid(uid))
+        .await
+        .ok()
+        .flatten()
+}
+
+#[cfg(unix)]
+fn getpwuid(uid: u32) -> Option<String> {
+    use std::ffi::CStr;
+
+    let mut buf = vec![0 as libc::c_char; 1024];
+
+    loop {
+        let mut passwd: libc::passwd = unsafe { std::mem::zeroed() };
+        let mut result = std::ptr::null_mut();
+
+        let code =
+            unsafe { libc::getpwuid_r(uid, &mut passwd, buf.as_mut_ptr(), buf.len(), &mut result) };
+
+        match code {
+            0 if result.is_null() => return None,
+            0 => {
+                let name = unsafe { CStr::from_ptr(passwd.pw_name) };
+                return name.to_str().ok().map(String::from);
+            }
+            // The buffer is too small for this entry.
+            libc::ERANGE if buf.len() < 1024 * 1024 => buf.resize(buf.len() * 2, 0),
+            _ => return None,
+        }
+    }
+}
+
+#[cfg(not(unix))]
+pub(crate) async fn user_name(_uid: u32) -> Option<String> {
+    None
+}
+
+#[cfg(unix)]
+impl Drop for UnixSocket {
+    fn drop(&mut self) {
+        if let Some((_, path)) = self.listener.take() {
+            let _ = remove_file(path);
+        }
+    }
+}
+
+#[cfg(all(test, unix))]
+mod test {
+    use tokio::net::UnixStream;
+
+    use super::*;
+
+    #[tokio::test]
+    async fn test_unix_socket() {
+        let dir = std::env::temp_dir().join(format!("pgdog_unix_socket_{}", std::process::id()));
+        std::fs::create_dir_all(&dir).unwrap();
+
+        let general = General {
+            unix_socket_dir: Some(dir.clone()),
+            unix_socket_permissions: 0o770,
+            port: 6999,
+            ..Default::default()
+        };
+        let path = general.unix_socket_path().unwrap();
+
+        // Left behind by a crash.
+        drop(std::os::unix::net::UnixListener::bind(&path).unwrap());
+        assert!(path.exists());
+
+        let socket = UnixSocket::bind(&general, 4096).unwrap();
+        let mode = std::fs::metadata(&path).unwrap().permissions().mode();
+        assert_eq!(mode & 0o777, 0o770);
+        // Only the socket is left in the directory.
+        assert_eq!(std::fs::read_dir(&dir).unwrap().count(), 1);
+
+        // Still in use.
+        assert_eq!(
+            UnixSocket::bind(&general, 4096).unwrap_err().kind(),
+            ErrorKind::AddrInUse
+        );
+
+        let client = tokio::spawn({
+            let path = path.clone();
+            async move { UnixStream::connect(path).await.unwrap() }
+        });
+        let (stream, addr) = socket.accept().await.unwrap();
+        assert!(stream.is_unix());
+        // The client is this process.
+        assert_eq!(
+            addr,
+            ClientAddr::Unix {
+                uid: Some(unsafe { libc::getuid() })
+            }
+        );
+        client.await.unwrap();
+
+        drop(socket);
+        assert!(!path.exists());
+
+        let general = General::default();
+        assert!(UnixSocket::bind(&general, 4096).unwrap().listener.is_none());
+
+        std::fs::remove_dir_all(&dir).unwrap();
+    }
+
+    #[tokio::test]
+    async fn test_user_name() {
+        assert_eq!(user_name(0).await.as_deref(), Some("root"));
+        assert_eq!(user_name(u32::MAX - 1).await, None);
+    }
+}
@@ -15,7 +15,9 @@ pub mod frontend;
 pub mod healthcheck;
 pub mod net;
 pub mod plugin;
+pub mod random;
 pub mod sighup;
+pub mod sigterm;
 pub mod state;
 pub mod stats;
 pub mod tasks;
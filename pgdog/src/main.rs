@@ -5,7 +5,9 @@ use std::path::Path;
 use std::process::exit;
 
 use clap::Parser;
-use pgdog::backend::databases;
+use pgdog::backend::{
+    databases, maintenance_window, rolling_ranges, sequence_cache, shard_directory, zone,
+};
 use pgdog::cli::{self, Commands};
 use pgdog::config::{self, config};
 use pgdog::frontend::client::query_engine::two_pc::Manager;
@@ -106,13 +108,19 @@ fn main() -> Result<(), Box<dyn std::error::Error>> {
 
 async fn pgdog(command: Option<Commands>) -> Result<(), Box<dyn std::error::Error>> {
     // Run atexit handlers on SIGTERM (e.g. llvm-cov profile flushing).
+    // The listener drains clients on SIGTERM and returns from here instead.
     #[cfg(unix)]
-    install_sigterm_handler();
+    if !matches!(command, None | Some(Commands::Run { .. })) {
+        install_sigterm_handler();
+    }
 
     // Preload TLS. Resulting primitives
     // are async, so doing this after Tokio launched seems prudent.
     net::tls::load()?;
 
+    // Load balancers prefer replicas in our zone.
+    zone::detect().await;
+
     // Load databases and connect if needed.
     databases::init()?;
 
@@ -134,6 +142,10 @@ async fn pgdog(command: Option<Commands>) -> Result<(), Box<dyn std::error::Erro
         pgdog::tasks::spawn("otel publisher", stats::otel_exporter::run());
     }
 
+    if config::config().config.stats_export.enabled() {
+        pgdog::tasks::spawn("stats export", stats::export::run());
+    }
+
     if let Some(healthcheck_port) = general.healthcheck_port {
         pgdog::tasks::spawn("http healthcheck server", async move {
             healthcheck::server(healthcheck_port).await
@@ -142,6 +154,9 @@ async fn pgdog(command: Option<Commands>) -> Result<(), Box<dyn std::error::Erro
 
     let stats_logger = stats::StatsLogger::new();
     prepared_statements::start_maintenance();
+    maintenance_window::start();
+    rolling_ranges::start();
+    shard_directory::start().await;
 
     if general.dry_run {
         stats_logger.spawn();
@@ -161,8 +176,29 @@ async fn pgdog(command: Option<Commands>) -> Result<(), Box<dyn std::error::Erro
                 }
             }
 
+            let sequence_cache_file = config().config.rewrite.sequence_cache_file.clone();
+            if let Some(ref path) = sequence_cache_file
+                && let Err(err) = sequence_cache::load(path)
+            {
+                warn!(
+                    "failed to load sequence cache from \"{}\": {}",
+                    path.display(),
+                    err
+                );
+            }
+
             let mut listener = Listener::new(format!("{}:{}", general.host, general.port));
             listener.listen().await?;
+
+            if let Some(ref path) = sequence_cache_file
+                && let Err(err) = sequence_cache::save(path)
+            {
+                error!(
+                    "failed to save sequence cache to \"{}\": {}",
+                    path.display(),
+                    err
+                );
+            }
         }
 
         Some(ref command) => {
@@ -215,6 +251,18 @@ async fn pgdog(command: Option<Commands>) -> Result<(), Box<dyn std::error::Erro
                 result?;
             }
 
+            if let Commands::ShardOf { .. } = command {
+                let result = cli::shard_of(command.clone());
+
+                Manager::get().shutdown().await;
+                databases::shutdown();
+
+                if let Err(err) = result {
+                    error!("{}", err);
+                    return Err(err);
+                }
+            }
+
             if let Commands::Route { .. } = command {
                 let result = cli::route(command.clone()).await;
 
@@ -243,8 +291,8 @@ async fn pgdog(command: Option<Commands>) -> Result<(), Box<dyn std::error::Erro
 /// Install a SIGTERM handler that exits the process via [`exit`], running
 /// `atexit` handlers. Without it, SIGTERM terminates the process outright,
 /// which skips the llvm-cov profile flush (no .profraw written) used by
-/// integration test coverage. Behavior is otherwise unchanged: PgDog stops
-/// immediately.
+/// integration test coverage. Commands other than the pooler itself
+/// stop immediately.
 #[cfg(unix)]
 fn install_sigterm_handler() {
     use tokio::signal::unix::{SignalKind, signal};
@@ -122,6 +122,9 @@ pub enum Error {
     /// declaring less than that can't be framed, and the peer is out of sync.
     #[error("malformed message: declared length {0} is below the minimum of 4 bytes")]
     MalformedMessageLength(i32),
+
+    #[error("{0} bytes of a partially read message are still unread")]
+    PartialMessage(usize),
 }
 
 impl Error {
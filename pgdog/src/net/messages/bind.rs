@@ -193,6 +193,19 @@ impl Bind {
         }
     }
 
+    /// Remove all parameters, keeping the portal and result formats.
+    pub fn clear_params(&mut self) {
+        self.params.clear();
+        self.codes.clear();
+        self.original = None;
+    }
+
+    /// Use the same result column formats as another Bind message.
+    pub fn set_results(&mut self, bind: &Bind) {
+        self.results = bind.results.clone();
+        self.original = None;
+    }
+
     /// Is this Bind message anonymous?
     pub fn anonymous(&self) -> bool {
         self.statement.len() == 1
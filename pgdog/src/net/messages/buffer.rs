@@ -3,7 +3,7 @@
 
 use std::io::Cursor;
 
-use bytes::{Buf, BytesMut};
+use bytes::{Buf, Bytes, BytesMut};
 use pgdog_stats::MessageBufferStats;
 use tokio::io::AsyncReadExt;
 
@@ -24,6 +24,8 @@ pub struct MessageBuffer {
     /// If specified the messages exceeding this number
     /// will be rejected and cause fatal abruption.
     size_limit_block: Option<usize>,
+    /// Bytes of the last message returned in parts that weren't read yet.
+    remaining: usize,
 }
 
 impl MessageBuffer {
@@ -38,6 +40,7 @@ impl MessageBuffer {
                 ..Default::default()
             },
             size_limit_block,
+            remaining: 0,
         }
     }
 
@@ -54,7 +57,12 @@ impl MessageBuffer {
     async fn read_internal(
         &mut self,
         stream: &mut (impl Unpin + AsyncReadExt),
+        partial_threshold: Option<usize>,
     ) -> Result<Message, Error> {
+        if self.remaining > 0 {
+            return Err(Error::PartialMessage(self.remaining));
+        }
+
         loop {
             if let Some(size) = self.message_size()? {
                 if let Some(limit) = self.size_limit_block
@@ -79,6 +87,17 @@ impl MessageBuffer {
                     return Ok(Message::new(self.buffer.split_to(size).freeze()));
                 }
 
+                // Return what we have of large rows, instead of
+                // reading them into memory. The rest is read with `read_chunk`.
+                if let Some(threshold) = partial_threshold
+                    && size > threshold
+                    && matches!(self.buffer[0], b'D' | b'd')
+                {
+                    let head = self.buffer.split().freeze();
+                    self.remaining = size - head.len();
+                    return Ok(Message::new(head).partial(self.remaining));
+                }
+
                 self.ensure_capacity(size); // Reserve at least enough space for the whole message.
             }
 
@@ -190,7 +209,56 @@ impl MessageBuffer {
         &mut self,
         stream: &mut (impl Unpin + AsyncReadExt),
     ) -> Result<Message, Error> {
-        self.read_internal(stream).await
+        self.read_internal(stream, None).await
+    }
+
+    /// Read a Postgres message off of a stream. `DataRow` and `CopyData` messages
+    /// larger than `threshold` are returned as soon as their header arrives,
+    /// see [`Message::remaining`]. The rest of the message must be read with
+    /// [`Self::read_chunk`] before reading the next one.
+    ///
+    /// # Cancellation safety
+    ///
+    /// This method is cancel-safe.
+    ///
+    pub async fn read_partial(
+        &mut self,
+        stream: &mut (impl Unpin + AsyncReadExt),
+        threshold: usize,
+    ) -> Result<Message, Error> {
+        self.read_internal(stream, Some(threshold)).await
+    }
+
+    /// Read the next part of a message returned by [`Self::read_partial`].
+    /// Returns `None` once the message has been read completely.
+    ///
+    /// # Cancellation safety
+    ///
+    /// This method is cancel-safe.
+    ///
+    pub async fn read_chunk(
+        &mut self,
+        stream: &mut (impl Unpin + AsyncReadExt),
+    ) -> Result<Option<Bytes>, Error> {
+        if self.remaining == 0 {
+            return Ok(None);
+        }
+
+        if self.buffer.is_empty() {
+            self.ensure_capacity(self.capacity / 4);
+
+            let read = eof(stream.read_buf(&mut self.buffer).await)?;
+            self.stats.bytes_used += read;
+
+            if read == 0 {
+                return Err(Error::UnexpectedEof);
+            }
+        }
+
+        let len = self.remaining.min(self.buffer.len());
+        self.remaining -= len;
+
+        Ok(Some(self.buffer.split_to(len).freeze()))
     }
 }
 
@@ -507,4 +575,39 @@ mod test {
             Err(Error::MalformedMessageLength(-1))
         ));
     }
+
+    #[tokio::test]
+    async fn test_read_partial() {
+        let mut row = crate::net::DataRow::new();
+        row.add("a".repeat(100_000));
+        let row = row.to_bytes();
+
+        let mut data = BytesMut::new();
+        data.extend_from_slice(&row);
+        data.extend_from_slice(&Sync.to_bytes());
+        let mut stream = Cursor::new(data.to_vec());
+
+        let mut buf = MessageBuffer::new(4096, None);
+        let head = buf.read_partial(&mut stream, 1024).await.unwrap();
+        assert_eq!(head.code(), 'D');
+        assert!(head.remaining() > 0);
+        assert_eq!(head.len() + head.remaining(), row.len());
+
+        // The rest of the row must be read first.
+        assert!(matches!(
+            buf.read(&mut stream).await,
+            Err(Error::PartialMessage(_))
+        ));
+
+        let mut received = BytesMut::from(head.payload().as_ref());
+        while let Some(chunk) = buf.read_chunk(&mut stream).await.unwrap() {
+            received.extend_from_slice(&chunk);
+        }
+        assert_eq!(received.freeze(), row);
+
+        // Small messages are read whole.
+        let sync = buf.read_partial(&mut stream, 1024).await.unwrap();
+        assert_eq!(sync.code(), 'S');
+        assert_eq!(sync.remaining(), 0);
+    }
 }
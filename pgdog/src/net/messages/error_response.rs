@@ -4,9 +4,9 @@ use std::fmt::Display;
 use std::time::Duration;
 
 use super::prelude::*;
-use crate::{net::c_string_buf, state::State};
+use crate::{config::config, net::c_string_buf, state::State};
 
-use crate::frontend::Error as FrontendError;
+use crate::frontend::{ClientLimit, Error as FrontendError};
 
 /// ErrorResponse (B) message.
 #[derive(Debug, Clone)]
@@ -15,9 +15,12 @@ pub struct ErrorResponse {
     pub code: String,
     pub message: String,
     pub detail: Option<String>,
+    pub hint: Option<String>,
     pub context: Option<String>,
     pub file: Option<String>,
     pub routine: Option<String>,
+    /// Shard and connection pool that returned the error. Added by PgDog.
+    pub shard: Option<String>,
 }
 
 impl Default for ErrorResponse {
@@ -27,9 +30,11 @@ impl Default for ErrorResponse {
             code: String::default(),
             message: String::default(),
             detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 }
@@ -50,9 +55,11 @@ impl ErrorResponse {
                 user, database
             ),
             detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -80,9 +87,11 @@ impl ErrorResponse {
                     "".into()
                 }
             )),
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -120,6 +129,17 @@ impl ErrorResponse {
         }
     }
 
+    pub fn shard_disabled(shard: usize) -> ErrorResponse {
+        ErrorResponse {
+            severity: "ERROR".into(),
+            code: "57P03".into(),
+            message: format!("shard {} is disabled", shard),
+            detail: Some("queries to this shard are rejected by the administrator".into()),
+            routine: Some("client::QueryEngine::route_query".into()),
+            ..Default::default()
+        }
+    }
+
     pub fn transaction_statement_mode() -> ErrorResponse {
         ErrorResponse {
             severity: "ERROR".into(),
@@ -130,6 +150,34 @@ impl ErrorResponse {
         }
     }
 
+    pub fn idle_in_transaction_timeout(duration: Duration) -> ErrorResponse {
+        ErrorResponse {
+            severity: "ERROR".into(),
+            code: "25P03".into(),
+            message: "transaction rolled back due to idle-in-transaction timeout".into(),
+            detail: Some(format!(
+                "idle_in_transaction_timeout of {}ms expired",
+                duration.as_millis()
+            )),
+            hint: Some("issue ROLLBACK to end the transaction".into()),
+            ..Default::default()
+        }
+    }
+
+    pub fn transaction_duration_exceeded(duration: Duration, limit: Duration) -> ErrorResponse {
+        ErrorResponse {
+            severity: "NOTICE".into(),
+            code: "00000".into(),
+            message: "transaction duration exceeds transaction_duration_notice".into(),
+            detail: Some(format!(
+                "transaction took {}ms, transaction_duration_notice is {}ms",
+                duration.as_millis(),
+                limit.as_millis()
+            )),
+            ..Default::default()
+        }
+    }
+
     pub fn client_idle_timeout(duration: Duration, state: &State) -> ErrorResponse {
         ErrorResponse {
             severity: "FATAL".into(),
@@ -151,9 +199,11 @@ impl ErrorResponse {
                 },
                 duration.as_millis()
             )),
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -167,22 +217,69 @@ impl ErrorResponse {
                 user, database
             ),
             detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
+        }
+    }
+
+    /// User has too many clients connected.
+    pub fn too_many_connections(user: &str, database: &str, limit: ClientLimit) -> ErrorResponse {
+        let (message, detail) = match limit {
+            ClientLimit::Database(limit) => (
+                format!(
+                    r#"too many connections for user "{}" and database "{}""#,
+                    user, database
+                ),
+                format!("max_client_connections is {}", limit),
+            ),
+            ClientLimit::User(limit) => (
+                format!(r#"too many connections for user "{}""#, user),
+                format!("max_user_client_connections is {}", limit),
+            ),
+        };
+
+        ErrorResponse {
+            severity: "FATAL".into(),
+            code: "53300".into(),
+            message,
+            detail: Some(detail),
+            ..Default::default()
         }
     }
 
     /// Pooler is shutting down.
+    ///
+    /// The hint tells clients when to reconnect and where,
+    /// e.g. `reconnect_delay_ms=5000 alternate_endpoint=pgdog-2:6432`.
     pub fn shutting_down() -> ErrorResponse {
+        let general = &config().config.general;
+        let hint = [
+            general
+                .shutdown_reconnect_delay
+                .map(|delay| format!("reconnect_delay_ms={}", delay)),
+            general
+                .shutdown_reconnect_endpoint
+                .as_ref()
+                .map(|endpoint| format!("alternate_endpoint={}", endpoint)),
+        ]
+        .into_iter()
+        .flatten()
+        .collect::<Vec<_>>()
+        .join(" ");
+
         ErrorResponse {
             severity: "FATAL".into(),
             code: "57P01".into(),
             message: "PgDog is shutting down".into(),
             detail: None,
+            hint: (!hint.is_empty()).then_some(hint),
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -192,9 +289,11 @@ impl ErrorResponse {
             code: "42601".into(),
             message: err.into(),
             detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -204,9 +303,11 @@ impl ErrorResponse {
             code: "08P01".into(),
             message: err.into(),
             detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -216,9 +317,41 @@ impl ErrorResponse {
             code: "08004".into(),
             message: "only TLS connections are allowed".into(),
             detail: None,
+            hint: None,
+            context: None,
+            file: None,
+            routine: None,
+            shard: None,
+        }
+    }
+
+    /// Client requested GSSAPI encryption, which we don't support.
+    pub fn gss_encryption_not_supported() -> ErrorResponse {
+        Self {
+            severity: "FATAL".into(),
+            code: "08P01".into(),
+            message: "GSSAPI encryption is not supported".into(),
+            detail: None,
+            hint: Some("connect with gssencmode=disable or prefer".into()),
+            context: None,
+            file: None,
+            routine: None,
+            shard: None,
+        }
+    }
+
+    /// Client was killed with `KILL CLIENT` or `KILL SERVER`.
+    pub fn killed() -> ErrorResponse {
+        Self {
+            severity: "FATAL".into(),
+            code: "57P01".into(),
+            message: "terminating connection due to administrator command".into(),
+            detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
@@ -229,23 +362,36 @@ impl ErrorResponse {
             code: "58000".into(),
             message,
             detail: None,
+            hint: None,
             context: None,
             file: None,
             routine: None,
+            shard: None,
         }
     }
 
     pub fn from_client_err(err: &FrontendError) -> Self {
         use crate::backend::Error as BackendError;
-        if let FrontendError::Backend(BackendError::ExecutionError(err)) = err {
-            *(err.clone())
-        } else {
-            Self {
+        match err {
+            FrontendError::Backend(BackendError::ExecutionError(err)) => *(err.clone()),
+            FrontendError::Killed => Self::killed(),
+            _ => Self {
                 severity: "FATAL".into(),
                 code: "58000".into(),
                 message: err.to_string(),
                 ..Default::default()
-            }
+            },
+        }
+    }
+
+    /// Too many clients are waiting for a server connection.
+    pub fn too_many_waiting_clients(limit: usize) -> ErrorResponse {
+        ErrorResponse {
+            severity: "ERROR".into(),
+            code: "53300".into(),
+            message: "too many clients waiting for a server connection".into(),
+            detail: Some(format!("max_waiting_clients is {}", limit)),
+            ..Default::default()
         }
     }
 
@@ -268,6 +414,34 @@ impl ErrorResponse {
         )
     }
 
+    /// Client tried to set `statement_timeout` higher than allowed.
+    pub fn statement_timeout_lowered(max: u64) -> Self {
+        Self {
+            severity: "NOTICE".into(),
+            code: "00000".into(),
+            message: format!(
+                "statement_timeout lowered to {}ms, the maximum allowed for this database",
+                max
+            ),
+            ..Default::default()
+        }
+    }
+
+    /// `statement_timeout` is above the maximum and the request
+    /// can't be rewritten to lower it.
+    pub fn statement_timeout_too_high(max: u64) -> Self {
+        Self {
+            severity: "ERROR".into(),
+            code: "22023".into(),
+            message: format!(
+                "statement_timeout can't be higher than {}ms, the maximum allowed for this database",
+                max
+            ),
+            routine: Some("client::QueryEngine::set".into()),
+            ..Default::default()
+        }
+    }
+
     pub fn no_transaction() -> Self {
         Self {
             severity: "WARNING".into(),
@@ -290,6 +464,19 @@ impl ErrorResponse {
         }
     }
 
+    pub fn query_size_limit_exceeded(size: usize, limit: usize) -> Self {
+        Self {
+            severity: "NOTICE".into(),
+            code: "00000".into(),
+            message: "query size exceeds query_size_limit".into(),
+            detail: Some(format!(
+                "message is {} bytes, query_size_limit is {} bytes",
+                size, limit
+            )),
+            ..Default::default()
+        }
+    }
+
     pub fn query_too_large(size: usize, limit: usize) -> Self {
         Self {
             severity: "FATAL".into(),
@@ -330,9 +517,11 @@ impl FromBytes for ErrorResponse {
                 'C' => error_response.code = value,
                 'M' => error_response.message = value,
                 'D' => error_response.detail = Some(value),
+                'H' => error_response.hint = Some(value),
                 'W' => error_response.context = Some(value),
                 'F' => error_response.file = Some(value),
                 'R' => error_response.routine = Some(value),
+                'g' => error_response.shard = Some(value),
                 _ => continue,
             }
         }
@@ -362,6 +551,11 @@ impl ToBytes for ErrorResponse {
             payload.put_string(detail);
         }
 
+        if let Some(ref hint) = self.hint {
+            payload.put_u8(b'H');
+            payload.put_string(hint);
+        }
+
         if let Some(ref context) = self.context {
             payload.put_u8(b'W');
             payload.put_string(context);
@@ -377,6 +571,11 @@ impl ToBytes for ErrorResponse {
             payload.put_string(routine);
         }
 
+        if let Some(ref shard) = self.shard {
+            payload.put_u8(b'g');
+            payload.put_string(shard);
+        }
+
         payload.put_u8(0);
 
         payload.freeze()
@@ -388,3 +587,43 @@ impl Protocol for ErrorResponse {
         'E'
     }
 }
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_error_response_hint() {
+        let error = ErrorResponse {
+            severity: "FATAL".into(),
+            code: "57P01".into(),
+            message: "PgDog is shutting down".into(),
+            hint: Some("reconnect_delay_ms=5000 alternate_endpoint=pgdog-2:6432".into()),
+            ..Default::default()
+        };
+
+        let error = ErrorResponse::from_bytes(error.to_bytes()).unwrap();
+        assert_eq!(
+            error.hint.as_deref(),
+            Some("reconnect_delay_ms=5000 alternate_endpoint=pgdog-2:6432")
+        );
+        assert_eq!(error.code, "57P01");
+    }
+
+    #[test]
+    fn test_error_response_shard() {
+        let error = ErrorResponse {
+            code: "42P01".into(),
+            message: "relation \"users\" does not exist".into(),
+            shard: Some("shard=3 pool=pgdog@127.0.0.1:5432/pgdog".into()),
+            ..Default::default()
+        };
+
+        let error = ErrorResponse::from_bytes(error.to_bytes()).unwrap();
+        assert_eq!(
+            error.shard.as_deref(),
+            Some("shard=3 pool=pgdog@127.0.0.1:5432/pgdog")
+        );
+        assert_eq!(error.code, "42P01");
+    }
+}
@@ -33,6 +33,13 @@ impl FrontendPid {
     }
 }
 
+/// Client id from `SHOW CLIENTS`.
+impl From<i32> for FrontendPid {
+    fn from(pid: i32) -> Self {
+        Self(pid)
+    }
+}
+
 impl From<&BackendKeyData> for FrontendPid {
     fn from(key: &BackendKeyData) -> Self {
         Self(key.pid())
@@ -1,5 +1,6 @@
 //! Startup, SSLRequest messages.
 
+use crate::config::config;
 use crate::net::{
     Error, c_string,
     messages::{BackendKeyData, ProtocolVersion},
@@ -93,26 +94,18 @@ impl Startup {
                         params.insert(name, value);
                     } else if name == "options" {
                         let value = value.replace('+', " ");
-                        let kvs = value.split("-c");
-                        for kv in kvs {
-                            let mut nvs = kv.split("=");
-                            let name = nvs.next();
-                            let value = nvs.next();
-
-                            if let Some(name) = name
-                                && let Some(value) = value
-                            {
-                                let name = name.trim().to_string();
-                                let value = value.trim().to_string();
-                                if !name.is_empty() && !value.is_empty() {
-                                    let value = if name == "search_path" {
-                                        search_path(&value)
-                                    } else {
-                                        ParameterValue::from(value)
-                                    };
-                                    params.insert(name, value);
-                                }
+                        for (name, value) in startup_options(&value) {
+                            if !allowed_startup_option(&name) {
+                                debug!("ignoring \"{}\" set in startup options", name);
+                                continue;
                             }
+
+                            let value = if name == "search_path" {
+                                search_path(&value)
+                            } else {
+                                ParameterValue::from(value)
+                            };
+                            params.insert(name, value);
                         }
                     } else {
                         params.insert(name, value);
@@ -287,6 +280,72 @@ impl FromBytes for SslReply {
     }
 }
 
+/// Settings passed with `-c name=value` or `--name=value` in the `options`
+/// startup parameter. Like Postgres, arguments are separated by whitespace,
+/// which can be escaped with a backslash.
+fn startup_options(value: &str) -> Vec<(String, String)> {
+    let mut args = vec![];
+    let mut arg = String::new();
+    let mut escaped = false;
+
+    for c in value.chars() {
+        if escaped {
+            arg.push(c);
+            escaped = false;
+        } else if c == '\\' {
+            escaped = true;
+        } else if c.is_whitespace() {
+            if !arg.is_empty() {
+                args.push(std::mem::take(&mut arg));
+            }
+        } else {
+            arg.push(c);
+        }
+    }
+
+    if !arg.is_empty() {
+        args.push(arg);
+    }
+
+    let mut settings = vec![];
+    let mut args = args.into_iter();
+
+    while let Some(arg) = args.next() {
+        let setting = if arg == "-c" {
+            args.next()
+        } else {
+            arg.strip_prefix("--")
+                .or_else(|| arg.strip_prefix("-c"))
+                .map(str::to_owned)
+        };
+
+        if let Some(setting) = setting
+            && let Some((name, value)) = setting.split_once('=')
+            && !name.is_empty()
+            && !value.is_empty()
+        {
+            settings.push((name.replace('-', "_"), value.to_owned()));
+        }
+    }
+
+    settings
+}
+
+/// Check that clients are allowed to change this setting
+/// with the `options` startup parameter.
+fn allowed_startup_option(name: &str) -> bool {
+    if name.starts_with("pgdog.") {
+        return true;
+    }
+
+    match config().config.general.allowed_startup_options {
+        Some(ref allowed) => allowed
+            .iter()
+            .any(|setting| setting.eq_ignore_ascii_case(name)),
+        None => true,
+    }
+}
+
 fn search_path(value: &str) -> ParameterValue {
     let value = value
         .split(",")
@@ -463,6 +522,48 @@ mod test {
         );
     }
 
+    #[test]
+    fn test_startup_options() {
+        assert_eq!(
+            startup_options(
+                "-c statement_timeout=5s -clock_timeout=1s --work-mem=64MB \
+                 -c application_name=my\\ app -c search_path=a-c,b -B 100"
+            ),
+            vec![
+                ("statement_timeout".into(), "5s".into()),
+                ("lock_timeout".into(), "1s".into()),
+                ("work_mem".into(), "64MB".into()),
+                ("application_name".into(), "my app".into()),
+                ("search_path".into(), "a-c,b".into()),
+            ]
+        );
+        assert!(startup_options("-c statement_timeout= -c").is_empty());
+    }
+
+    #[tokio::test]
+    async fn test_options_allowed() {
+        let mut config = crate::config::ConfigAndUsers::default();
+        config.config.general.allowed_startup_options = Some(vec!["statement_timeout".into()]);
+        let _config = crate::test_utils::set_config(config);
+
+        let startup =
+            startup_with_options("-c statement_timeout=5s -c work_mem=1GB -c pgdog.role=replica")
+                .await;
+
+        let Startup::Startup { params, .. } = startup else {
+            panic!("expected startup message");
+        };
+        assert_eq!(
+            params.get("statement_timeout").and_then(|v| v.as_str()),
+            Some("5s")
+        );
+        assert!(params.get("work_mem").is_none());
+        assert_eq!(
+            params.get("pgdog.role").and_then(|v| v.as_str()),
+            Some("replica")
+        );
+    }
+
     #[tokio::test]
     async fn test_cancel_roundtrip_extended_secret() {
         let cancel = Startup::Cancel {
@@ -139,17 +139,31 @@ pub struct Message {
     payload: Bytes,
     stream: bool,
     source: Source,
+    /// Bytes of this message that weren't read from the server yet.
+    remaining: usize,
 }
 
 impl MemoryUsage for Message {
     #[inline]
     fn memory_usage(&self) -> usize {
-        std::mem::size_of::<Bytes>() + self.stream.memory_usage() + std::mem::size_of::<Source>()
+        std::mem::size_of::<Bytes>()
+            + self.stream.memory_usage()
+            + std::mem::size_of::<Source>()
+            + std::mem::size_of::<usize>()
     }
 }
 
 impl std::fmt::Debug for Message {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        if self.remaining > 0 {
+            return f
+                .debug_struct("Partial")
+                .field("code", &self.code())
+                .field("len", &self.len())
+                .field("remaining", &self.remaining)
+                .finish();
+        }
+
         match self.code() {
             'Q' => Query::from_bytes(self.payload()).unwrap().fmt(f),
             'D' => match self.source {
@@ -223,6 +237,7 @@ impl FromBytes for Message {
             payload: bytes,
             stream: false,
             source: Source::default(),
+            remaining: 0,
         })
     }
 }
@@ -234,6 +249,7 @@ impl Message {
             payload,
             stream: false,
             source: Source::default(),
+            remaining: 0,
         }
     }
 
@@ -243,6 +259,18 @@ impl Message {
         self
     }
 
+    /// Only the beginning of this message was read, the rest
+    /// (`remaining` bytes) is still on the server socket.
+    pub fn partial(mut self, remaining: usize) -> Self {
+        self.remaining = remaining;
+        self
+    }
+
+    /// Bytes of this message that weren't read from the server yet.
+    pub fn remaining(&self) -> usize {
+        self.remaining
+    }
+
     /// Take the message payload.
     pub fn payload(&self) -> Bytes {
         self.payload.clone()
@@ -1,12 +1,43 @@
 use bytes::BytesMut;
+use pgdog_config::NoticeSeverity;
 
 use super::{ErrorResponse, prelude::*};
+use crate::net::c_string_buf;
 
 #[derive(Debug)]
 pub struct NoticeResponse {
     pub message: ErrorResponse,
 }
 
+impl NoticeResponse {
+    /// Get the severity of a NoticeResponse (B) without parsing all of it.
+    /// Uses the severity that isn't translated, if the server sends one.
+    pub fn severity(bytes: &Bytes) -> Option<NoticeSeverity> {
+        let mut bytes = bytes.clone();
+        if bytes.len() < 5 {
+            return None;
+        }
+        bytes.advance(5);
+
+        let mut localized = None;
+        while bytes.has_remaining() {
+            let field = bytes.get_u8();
+            if field == 0 {
+                break;
+            }
+            let value = c_string_buf(&mut bytes);
+
+            match field {
+                b'V' => return value.parse().ok(),
+                b'S' => localized = Some(value),
+                _ => (),
+            }
+        }
+
+        localized.and_then(|severity| severity.parse().ok())
+    }
+}
+
 impl FromBytes for NoticeResponse {
     fn from_bytes(bytes: Bytes) -> Result<Self, Error> {
         Ok(Self {
@@ -67,4 +98,39 @@ mod test {
         assert_eq!(notice.message.detail, Some("test detail".into()));
         assert_eq!(notice.message.routine, Some("testRoutine".into()));
     }
+
+    #[test]
+    fn test_notice_severity() {
+        let notice = |fields: &[(u8, &str)]| {
+            let mut payload = Payload::named('N');
+            for (field, value) in fields {
+                payload.put_u8(*field);
+                payload.put_string(value);
+            }
+            payload.put_u8(0);
+            payload.freeze()
+        };
+
+        let warning = notice(&[(b'S', "WARNING"), (b'V', "WARNING"), (b'M', "test")]);
+        assert_eq!(
+            NoticeResponse::severity(&warning),
+            Some(NoticeSeverity::Warning)
+        );
+
+        // Translated severity is ignored if there is one we can read.
+        let translated = notice(&[(b'S', "HINWEIS"), (b'V', "NOTICE"), (b'M', "test")]);
+        assert_eq!(
+            NoticeResponse::severity(&translated),
+            Some(NoticeSeverity::Notice)
+        );
+
+        let old_server = notice(&[(b'S', "DEBUG"), (b'M', "test")]);
+        assert_eq!(
+            NoticeResponse::severity(&old_server),
+            Some(NoticeSeverity::Debug)
+        );
+
+        let unknown = notice(&[(b'S', "HINWEIS"), (b'M', "test")]);
+        assert_eq!(NoticeResponse::severity(&unknown), None);
+    }
 }
@@ -32,14 +32,22 @@ static UNTRACKED_PARAMS: Lazy<Vec<String>> = Lazy::new(|| {
         String::from("server_version"),
         String::from("server_encoding"),
         String::from("integer_datetimes"),
-        String::from("session_authorization"),
         String::from("in_hot_standby"),
         String::from("pgdog.role"),
         String::from("pgdog.shard"),
+        String::from("pgdog.host"),
         String::from("pgdog.sharding_key"),
+        String::from("pgdog.deadline"),
+        String::from("target_session_attrs"),
     ])
 });
 
+// Parameters that change the role executing queries,
+// set with `SET SESSION AUTHORIZATION` and `SET ROLE`.
+// `RESET ALL` doesn't reset them. Changing the session authorization
+// resets the role, so it always goes first.
+static ROLE_PARAMS: [&str; 2] = ["session_authorization", "role"];
+
 /// Startup parameter.
 #[derive(Debug, Clone, PartialEq)]
 pub struct Parameter {
@@ -281,6 +289,13 @@ impl Parameters {
         self.transaction_local_params.remove(&name);
     }
 
+    /// Undo `SET LOCAL` for the rest of the transaction.
+    /// The session value is kept.
+    pub fn reset_local(&mut self, name: impl ToString) {
+        self.transaction_local_params
+            .remove(&name.to_string().to_lowercase());
+    }
+
     /// Reset all tracked parameters.
     pub fn reset_all(&mut self) {
         let mut keys: Vec<String> = self.params.keys().cloned().collect();
@@ -290,7 +305,7 @@ impl Parameters {
         keys.dedup();
 
         for key in keys {
-            if !UNTRACKED_PARAMS.contains(&key) {
+            if !UNTRACKED_PARAMS.contains(&key) && !Self::is_role(&key) {
                 self.reset(&key);
             }
         }
@@ -385,34 +400,53 @@ impl Parameters {
         }
 
         if transaction_only {
-            let mut sets = self
-                .transaction_params
-                .iter()
+            let mut sets = Self::ordered(&self.transaction_params)
                 .map(|(key, value)| query(key, value, false))
                 .collect::<Vec<_>>();
 
             sets.extend(
-                self.transaction_local_params
-                    .iter()
+                Self::ordered(&self.transaction_local_params)
                     .map(|(key, value)| query(key, value, true)),
             );
 
             sets
         } else {
-            self.params
-                .iter()
+            Self::ordered(&self.params)
                 .map(|(key, value)| query(key, value, false))
                 .collect()
         }
     }
 
     pub fn reset_queries(&self) -> Vec<Query> {
-        self.params
-            .keys()
-            .map(|name| Query::new(format!(r#"RESET "{}""#, name)))
+        Self::ordered(&self.params)
+            .map(|(name, _)| Query::new(format!(r#"RESET "{}""#, name)))
             .collect()
     }
 
+    /// Iterate over params in the order they should be set on the server.
+    fn ordered(
+        params: &BTreeMap<String, ParameterValue>,
+    ) -> impl Iterator<Item = (&String, &ParameterValue)> {
+        let (mut roles, others): (Vec<_>, Vec<_>) =
+            params.iter().partition(|(name, _)| Self::is_role(name));
+
+        // Startup parameters keep the case the client sent them in.
+        roles.sort_by_key(|(name, _)| {
+            ROLE_PARAMS
+                .iter()
+                .position(|role| name.eq_ignore_ascii_case(role))
+        });
+
+        roles.into_iter().chain(others)
+    }
+
+    /// The parameter changes the role executing queries.
+    pub fn is_role(name: &str) -> bool {
+        ROLE_PARAMS
+            .iter()
+            .any(|role| name.eq_ignore_ascii_case(role))
+    }
+
     /// Get parameter value or returned an error.
     pub fn get_required(&self, name: &str) -> Result<&str, Error> {
         self.get(name)
@@ -1017,6 +1051,81 @@ mod test {
         );
     }
 
+    #[test]
+    fn test_reset_all_preserves_roles() {
+        let mut params = Parameters::default();
+        params.insert("search_path", "public");
+        params.insert("role", "tenant_1");
+        params.insert("session_authorization", "app");
+
+        // RESET ALL doesn't reset the role in Postgres either.
+        params.reset_all();
+
+        assert_eq!(params.get("search_path"), None);
+        assert_eq!(params.get_default("role", ""), "tenant_1");
+        assert_eq!(params.get_default("session_authorization", ""), "app");
+    }
+
+    #[test]
+    fn test_role_queries_order() {
+        let mut params = Parameters::default();
+        params.insert("application_name", "app");
+        params.insert("role", "tenant_1");
+        params.insert("session_authorization", "app");
+
+        // Changing session authorization resets the role.
+        let sets = params
+            .tracked()
+            .set_queries(false)
+            .into_iter()
+            .map(|query| query.query().to_string())
+            .collect::<Vec<_>>();
+        assert_eq!(
+            sets,
+            [
+                r#"SET "session_authorization" TO "app""#,
+                r#"SET "role" TO "tenant_1""#,
+                r#"SET "application_name" TO "app""#,
+            ]
+        );
+
+        let resets = params
+            .reset_queries()
+            .into_iter()
+            .map(|query| query.query().to_string())
+            .collect::<Vec<_>>();
+        assert_eq!(
+            resets,
+            [
+                r#"RESET "session_authorization""#,
+                r#"RESET "role""#,
+                r#"RESET "application_name""#,
+            ]
+        );
+    }
+
+    #[test]
+    fn test_role_queries_order_case() {
+        // Startup parameters aren't lowercased.
+        let params = Parameters::from(vec![
+            Parameter::from(("Role", "tenant_1")),
+            Parameter::from(("SESSION_AUTHORIZATION", "app")),
+        ]);
+
+        let sets = params
+            .set_queries(false)
+            .into_iter()
+            .map(|query| query.query().to_string())
+            .collect::<Vec<_>>();
+        assert_eq!(
+            sets,
+            [
+                r#"SET "SESSION_AUTHORIZATION" TO "app""#,
+                r#"SET "Role" TO "tenant_1""#,
+            ]
+        );
+    }
+
     #[test]
     fn test_reset_all_rollback_restores_all() {
         let mut params = Parameters::default();
@@ -4,6 +4,8 @@ use bytes::{BufMut, BytesMut};
 use pin_project::pin_project;
 use tokio::io::{AsyncRead, AsyncReadExt, AsyncWrite, AsyncWriteExt, BufStream, ReadBuf};
 use tokio::net::TcpStream;
+#[cfg(unix)]
+use tokio::net::UnixStream;
 use tracing::trace;
 
 use std::io::{Error, ErrorKind};
@@ -21,6 +23,8 @@ use super::messages::{ErrorResponse, Message, Protocol, ReadyForQuery};
 enum StreamInner {
     Plain(#[pin] BufStream<TcpStream>),
     Tls(#[pin] BufStream<tokio_rustls::TlsStream<TcpStream>>),
+    #[cfg(unix)]
+    Unix(#[pin] BufStream<UnixStream>),
     DevNull,
 }
 
@@ -45,6 +49,8 @@ impl AsyncRead for Stream {
         match project.inner.project() {
             StreamInnerProjection::Plain(stream) => stream.poll_read(cx, buf),
             StreamInnerProjection::Tls(stream) => stream.poll_read(cx, buf),
+            #[cfg(unix)]
+            StreamInnerProjection::Unix(stream) => stream.poll_read(cx, buf),
             StreamInnerProjection::DevNull => std::task::Poll::Ready(Ok(())),
         }
     }
@@ -60,6 +66,8 @@ impl AsyncWrite for Stream {
         match project.inner.project() {
             StreamInnerProjection::Plain(stream) => stream.poll_write(cx, buf),
             StreamInnerProjection::Tls(stream) => stream.poll_write(cx, buf),
+            #[cfg(unix)]
+            StreamInnerProjection::Unix(stream) => stream.poll_write(cx, buf),
             StreamInnerProjection::DevNull => std::task::Poll::Ready(Ok(buf.len())),
         }
     }
@@ -72,6 +80,8 @@ impl AsyncWrite for Stream {
         match project.inner.project() {
             StreamInnerProjection::Plain(stream) => stream.poll_flush(cx),
             StreamInnerProjection::Tls(stream) => stream.poll_flush(cx),
+            #[cfg(unix)]
+            StreamInnerProjection::Unix(stream) => stream.poll_flush(cx),
             StreamInnerProjection::DevNull => std::task::Poll::Ready(Ok(())),
         }
     }
@@ -84,6 +94,8 @@ impl AsyncWrite for Stream {
         match project.inner.project() {
             StreamInnerProjection::Plain(stream) => stream.poll_shutdown(cx),
             StreamInnerProjection::Tls(stream) => stream.poll_shutdown(cx),
+            #[cfg(unix)]
+            StreamInnerProjection::Unix(stream) => stream.poll_shutdown(cx),
             StreamInnerProjection::DevNull => std::task::Poll::Ready(Ok(())),
         }
     }
@@ -105,6 +117,17 @@ impl Stream {
         }
     }
 
+    /// Wrap a UNIX socket stream.
+    #[cfg(unix)]
+    pub fn unix(stream: UnixStream, capacity: usize) -> Self {
+        Self {
+            inner: StreamInner::Unix(BufStream::with_capacity(capacity, capacity, stream)),
+            io_in_progress: false,
+            capacity,
+            tls_identity: None,
+        }
+    }
+
     /// Wrap an encrypted TCP stream.
     pub fn tls(
         stream: tokio_rustls::TlsStream<TcpStream>,
@@ -140,12 +163,22 @@ impl Stream {
         matches!(self.inner, StreamInner::Tls(_))
     }
 
-    /// Get peer address if any. We're not using UNIX sockets (yet)
-    /// so the peer address should always be available.
+    /// This is a UNIX socket stream.
+    pub fn is_unix(&self) -> bool {
+        #[cfg(unix)]
+        return matches!(self.inner, StreamInner::Unix(_));
+
+        #[cfg(not(unix))]
+        false
+    }
+
+    /// Get peer address if any. UNIX sockets don't have one.
     pub fn peer_addr(&self) -> PeerAddr {
         match &self.inner {
             StreamInner::Plain(stream) => stream.get_ref().peer_addr().ok().into(),
             StreamInner::Tls(stream) => stream.get_ref().get_ref().0.peer_addr().ok().into(),
+            #[cfg(unix)]
+            StreamInner::Unix(_) => PeerAddr { addr: None },
             StreamInner::DevNull => PeerAddr { addr: None },
         }
     }
@@ -156,6 +189,12 @@ impl Stream {
         match &mut self.inner {
             StreamInner::Plain(plain) => eof(plain.get_mut().peek(&mut buf).await)?,
             StreamInner::Tls(tls) => eof(tls.get_mut().get_mut().0.peek(&mut buf).await)?,
+            // Tokio can't peek UNIX sockets, wait for data or EOF instead.
+            #[cfg(unix)]
+            StreamInner::Unix(unix) => {
+                eof(unix.get_mut().readable().await)?;
+                0
+            }
             StreamInner::DevNull => 0,
         };
 
@@ -181,6 +220,8 @@ impl Stream {
             match &mut self.inner {
                 StreamInner::Plain(stream) => eof(stream.write_all(&bytes).await)?,
                 StreamInner::Tls(stream) => eof(stream.write_all(&bytes).await)?,
+                #[cfg(unix)]
+                StreamInner::Unix(stream) => eof(stream.write_all(&bytes).await)?,
                 StreamInner::DevNull => (),
             }
 
@@ -8,7 +8,7 @@ use std::{
     },
 };
 
-use crate::config::TlsVerifyMode;
+use crate::config::{SniRoute, TlsVerifyMode};
 use arc_swap::ArcSwapOption;
 use rustls::pki_types::{CertificateDer, PrivateKeyDer};
 use tokio_rustls::rustls::{
@@ -81,6 +81,16 @@ pub fn peer_identity(conn: &ServerConnection) -> Option<String> {
     identity_from_certs(conn.peer_certificates()?)
 }
 
+/// Get the database configured for the hostname the client sent with SNI, if any.
+pub fn sni_database(hostname: Option<&str>, routes: &[SniRoute]) -> Option<String> {
+    let hostname = hostname?;
+
+    routes
+        .iter()
+        .find(|route| route.hostname.eq_ignore_ascii_case(hostname))
+        .map(|route| route.database.clone())
+}
+
 /// Extract a hostname identity from the first certificate in the chain.
 ///
 /// Prefers the first `dNSName` in the Subject Alternative Name extension and
@@ -826,4 +836,32 @@ mod tests {
             "leaf signed by missing intermediate must be rejected"
         );
     }
+
+    #[test]
+    fn sni_database_by_hostname() {
+        let routes = vec![
+            SniRoute {
+                hostname: "tenant-a.db.example.com".into(),
+                database: "tenant_a".into(),
+            },
+            SniRoute {
+                hostname: "tenant-b.db.example.com".into(),
+                database: "tenant_b".into(),
+            },
+        ];
+
+        assert_eq!(
+            super::sni_database(Some("tenant-b.db.example.com"), &routes).as_deref(),
+            Some("tenant_b")
+        );
+        assert_eq!(
+            super::sni_database(Some("Tenant-A.db.example.com"), &routes).as_deref(),
+            Some("tenant_a")
+        );
+        assert_eq!(
+            super::sni_database(Some("tenant-c.db.example.com"), &routes),
+            None
+        );
+        assert_eq!(super::sni_database(None, &routes), None);
+    }
 }
@@ -0,0 +1,95 @@
+//! Random number generator used for routing decisions.
+//!
+//! Load balancing, omnisharded shard selection, mirror exposure and
+//! connection lifetime/healthcheck jitter draw from here instead of
+//! calling `rand::rng()` directly. With `routing_seed` configured,
+//! all of them share one seeded generator, so the sequence of decisions
+//! repeats between runs. Concurrent clients still race for the next number,
+//! so tests relying on this should send queries one at a time.
+
+use std::sync::atomic::{AtomicBool, Ordering};
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use rand::{RngCore, SeedableRng, rngs::StdRng};
+
+static RANDOM: Lazy<Random> = Lazy::new(Random::new);
+
+/// Seed the generator. `None` goes back to thread-local randomness.
+///
+/// Seeding again with the same value restarts the sequence.
+pub fn seed(seed: Option<u64>) {
+    RANDOM.seed(seed);
+}
+
+/// Run `f` with the routing random number generator.
+pub fn with_rng<T>(f: impl FnOnce(&mut dyn RngCore) -> T) -> T {
+    RANDOM.with_rng(f)
+}
+
+struct Random {
+    seeded: AtomicBool,
+    rng: Mutex<StdRng>,
+}
+
+impl Random {
+    fn new() -> Self {
+        Self {
+            seeded: AtomicBool::new(false),
+            rng: Mutex::new(StdRng::from_os_rng()),
+        }
+    }
+
+    fn seed(&self, seed: Option<u64>) {
+        let mut rng = self.rng.lock();
+        if let Some(seed) = seed {
+            *rng = StdRng::seed_from_u64(seed);
+        }
+        self.seeded.store(seed.is_some(), Ordering::Relaxed);
+    }
+
+    fn with_rng<T>(&self, f: impl FnOnce(&mut dyn RngCore) -> T) -> T {
+        // Don't serialize callers on the lock unless asked to.
+        if self.seeded.load(Ordering::Relaxed) {
+            f(&mut *self.rng.lock())
+        } else {
+            f(&mut rand::rng())
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use rand::Rng;
+
+    use super::*;
+
+    fn sample(random: &Random) -> Vec<usize> {
+        (0..10)
+            .map(|_| random.with_rng(|rng| rng.random_range(0..1000)))
+            .collect()
+    }
+
+    #[test]
+    fn test_seeded() {
+        let random = Random::new();
+
+        random.seed(Some(42));
+        let first = sample(&random);
+
+        random.seed(Some(42));
+        assert_eq!(sample(&random), first);
+
+        random.seed(Some(43));
+        assert_ne!(sample(&random), first);
+    }
+
+    #[test]
+    fn test_unseeded() {
+        let random = Random::new();
+        random.seed(Some(42));
+        random.seed(None);
+        assert!(!random.seeded.load(Ordering::Relaxed));
+        assert!(sample(&random).iter().all(|n| *n < 1000));
+    }
+}
@@ -32,6 +32,38 @@ impl OpenMetric for Clients {
     }
 }
 
+pub struct PinnedClients {
+    total: usize,
+}
+
+impl PinnedClients {
+    pub fn load() -> Metric {
+        let total = comms()
+            .clients()
+            .values()
+            .filter(|client| client.stats.pinned)
+            .count();
+        Metric::new(Self { total })
+    }
+}
+
+impl OpenMetric for PinnedClients {
+    fn name(&self) -> String {
+        "clients_pinned".into()
+    }
+
+    fn measurements(&self) -> Vec<Measurement> {
+        vec![Measurement {
+            labels: vec![],
+            measurement: self.total.into(),
+        }]
+    }
+
+    fn help(&self) -> Option<String> {
+        Some("Clients pinned to their server connection for the rest of the session.".into())
+    }
+}
+
 #[cfg(test)]
 mod test {
     use crate::{
@@ -55,6 +87,18 @@ mod test {
         assert_eq!(lines.next().unwrap(), "clients 25");
     }
 
+    #[test]
+    fn test_pinned_clients() {
+        let metric = Metric::new(PinnedClients { total: 3 }).to_string();
+        let mut lines = metric.lines();
+        assert_eq!(lines.next().unwrap(), "# TYPE clients_pinned gauge");
+        assert_eq!(
+            lines.next().unwrap(),
+            "# HELP clients_pinned Clients pinned to their server connection for the rest of the session."
+        );
+        assert_eq!(lines.next().unwrap(), "clients_pinned 3");
+    }
+
     #[test]
     fn clients_load_uses_global_state() {
         config::set(ConfigAndUsers::default()).unwrap();
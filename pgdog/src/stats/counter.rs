@@ -0,0 +1,91 @@
+//! Process-wide counters, e.g. soft limits that were exceeded.
+
+use std::sync::atomic::{AtomicU64, Ordering};
+
+use super::{Measurement, Metric, OpenMetric};
+
+/// Counter exported as a single measurement without labels.
+pub struct Counter {
+    name: &'static str,
+    help: &'static str,
+    value: AtomicU64,
+}
+
+impl Counter {
+    pub const fn new(name: &'static str, help: &'static str) -> Self {
+        Self {
+            name,
+            help,
+            value: AtomicU64::new(0),
+        }
+    }
+
+    /// Count one more.
+    pub fn increment(&self) {
+        self.value.fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// Get the current value as a metric.
+    pub fn load(&self) -> Metric {
+        Metric::new(CounterMetric {
+            name: self.name,
+            help: self.help,
+            value: self.value.load(Ordering::Relaxed),
+        })
+    }
+}
+
+struct CounterMetric {
+    name: &'static str,
+    help: &'static str,
+    value: u64,
+}
+
+impl OpenMetric for CounterMetric {
+    fn name(&self) -> String {
+        self.name.into()
+    }
+
+    fn metric_type(&self) -> String {
+        "counter".into()
+    }
+
+    fn help(&self) -> Option<String> {
+        Some(self.help.into())
+    }
+
+    fn measurements(&self) -> Vec<Measurement> {
+        vec![Measurement {
+            labels: vec![],
+            measurement: self.value.into(),
+        }]
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_counter() {
+        static COUNTER: Counter = Counter::new("test_counter_total", "Test counter.");
+
+        COUNTER.increment();
+        COUNTER.increment();
+
+        let metric = COUNTER.load();
+        assert_eq!(metric.name(), "test_counter_total");
+        assert_eq!(metric.metric_type(), "counter");
+        assert_eq!(metric.help().as_deref(), Some("Test counter."));
+
+        // The namespace prefix depends on the config other tests set.
+        let render = metric.to_string();
+        assert!(
+            render
+                .lines()
+                .last()
+                .unwrap()
+                .ends_with("test_counter_total 2")
+        );
+    }
+}
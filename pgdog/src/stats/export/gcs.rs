@@ -0,0 +1,154 @@
+//! Google Cloud Storage.
+//!
+//! Objects are uploaded with the XML API, authenticated with an access token
+//! of the service account attached to this instance (GCE, GKE Workload Identity, Cloud Run).
+
+use std::env;
+
+use pgdog_config::StatsExport;
+use serde::Deserialize;
+
+use super::{Error, object_url};
+
+/// Metadata server used when `GCE_METADATA_HOST` isn't set.
+const METADATA_HOST: &str = "metadata.google.internal";
+
+/// Scope required to write objects.
+const SCOPE: &str = "https://www.googleapis.com/auth/devstorage.read_write";
+
+/// Access token returned by the metadata server.
+#[derive(Debug, Deserialize)]
+struct AccessToken {
+    access_token: String,
+}
+
+/// GCS bucket.
+pub struct Bucket {
+    name: String,
+    endpoint: String,
+}
+
+impl Bucket {
+    pub fn new(export: &StatsExport, name: &str) -> Result<Self, Error> {
+        Ok(Self {
+            name: name.to_string(),
+            endpoint: export.endpoint(),
+        })
+    }
+
+    /// Upload an object.
+    pub async fn put(
+        &self,
+        client: &reqwest::Client,
+        key: &str,
+        body: Vec<u8>,
+    ) -> Result<(), Error> {
+        let url = object_url(&self.endpoint, &self.name, key)?;
+        let token = token(client).await?;
+
+        let response = client
+            .put(url)
+            .bearer_auth(token)
+            .header("content-type", "application/json")
+            .header("content-encoding", "gzip")
+            .body(body)
+            .send()
+            .await?;
+        let status = response.status();
+
+        if !status.is_success() {
+            return Err(Error::Upload {
+                key: key.to_string(),
+                status,
+                body: response.text().await.unwrap_or_default(),
+            });
+        }
+
+        Ok(())
+    }
+}
+
+/// Fetch an access token from the metadata server. Tokens are valid for an hour
+/// and the metadata server caches them, so we don't.
+async fn token(client: &reqwest::Client) -> Result<String, Error> {
+    let host = env::var("GCE_METADATA_HOST").unwrap_or_else(|_| METADATA_HOST.to_owned());
+    let url = format!(
+        "http://{}/computeMetadata/v1/instance/service-accounts/default/token",
+        host
+    );
+
+    let response = client
+        .get(&url)
+        .header("Metadata-Flavor", "Google")
+        .query(&[("scopes", SCOPE)])
+        .send()
+        .await?;
+
+    let status = response.status();
+    if !status.is_success() {
+        return Err(Error::Credentials(format!(
+            "metadata server returned {}",
+            status
+        )));
+    }
+
+    let token: AccessToken = response.json().await?;
+
+    Ok(token.access_token)
+}
+
+#[cfg(test)]
+mod test {
+    use wiremock::matchers::{header, method, path, query_param};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+    use crate::test_utils::set_env_var;
+    use pgdog_config::StatsExportProvider;
+
+    #[tokio::test]
+    async fn test_put() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("GET"))
+            .and(path(
+                "/computeMetadata/v1/instance/service-accounts/default/token",
+            ))
+            .and(header("Metadata-Flavor", "Google"))
+            .and(query_param("scopes", SCOPE))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "access_token": "ya29.token",
+                "expires_in": 3599,
+                "token_type": "Bearer",
+            })))
+            .mount(&server)
+            .await;
+
+        Mock::given(method("PUT"))
+            .and(path("/stats/pgdog/snapshot.json.gz"))
+            .and(header("authorization", "Bearer ya29.token"))
+            .respond_with(ResponseTemplate::new(200))
+            .expect(1)
+            .mount(&server)
+            .await;
+
+        let _host = set_env_var("GCE_METADATA_HOST", server.address().to_string());
+
+        let export = StatsExport {
+            provider: StatsExportProvider::Gcs,
+            bucket: Some("stats".into()),
+            endpoint: Some(server.uri()),
+            ..Default::default()
+        };
+
+        let bucket = Bucket::new(&export, "stats").unwrap();
+        bucket
+            .put(
+                &reqwest::Client::new(),
+                "pgdog/snapshot.json.gz",
+                vec![1, 2, 3],
+            )
+            .await
+            .unwrap();
+    }
+}
@@ -0,0 +1,291 @@
+//! Stats snapshots export to object storage.
+//!
+//! Periodically collects the output of SHOW STATS, SHOW POOLS and SHOW REPLICATION,
+//! serializes it as gzip-compressed JSON and uploads it to an S3 or GCS bucket,
+//! giving deployments without a metrics stack a durable history of their stats.
+
+pub mod gcs;
+pub mod s3;
+
+use std::time::Duration;
+
+use chrono::{DateTime, Utc};
+use flate2::{Compression, write::GzEncoder};
+use pgdog_config::{StatsExport, StatsExportProvider};
+use serde_json::{Map, Value, json};
+use thiserror::Error;
+use tokio::time::sleep;
+use tracing::{info, warn};
+
+use crate::{
+    admin::{Command, ShowPools, ShowReplication, ShowStats},
+    config::config,
+    net::messages::{DataRow, Field, FromBytes, Message, Protocol, RowDescription},
+    tasks,
+    util::instance_id,
+};
+
+#[derive(Debug, Error)]
+pub enum Error {
+    #[error("{0}")]
+    Admin(#[from] crate::admin::Error),
+
+    #[error("{0}")]
+    Net(#[from] crate::net::Error),
+
+    #[error("{0}")]
+    Io(#[from] std::io::Error),
+
+    #[error("{0}")]
+    Json(#[from] serde_json::Error),
+
+    #[error("{0}")]
+    Http(#[from] reqwest::Error),
+
+    #[error("invalid endpoint \"{0}\": {1}")]
+    Endpoint(String, url::ParseError),
+
+    #[error("credentials: {0}")]
+    Credentials(String),
+
+    #[error("upload of \"{key}\" failed with {status}: {body}")]
+    Upload {
+        key: String,
+        status: reqwest::StatusCode,
+        body: String,
+    },
+}
+
+/// Object storage bucket snapshots are written to.
+enum Bucket {
+    S3(s3::Bucket),
+    Gcs(gcs::Bucket),
+}
+
+impl Bucket {
+    async fn new(export: &StatsExport, bucket: &str) -> Result<Self, Error> {
+        Ok(match export.provider {
+            StatsExportProvider::S3 => Self::S3(s3::Bucket::new(export, bucket).await?),
+            StatsExportProvider::Gcs => Self::Gcs(gcs::Bucket::new(export, bucket)?),
+        })
+    }
+
+    async fn put(&self, client: &reqwest::Client, key: &str, body: Vec<u8>) -> Result<(), Error> {
+        match self {
+            Self::S3(bucket) => bucket.put(client, key, body).await,
+            Self::Gcs(bucket) => bucket.put(client, key, body).await,
+        }
+    }
+}
+
+/// Run the export loop. Exits only if the task is cancelled.
+pub async fn run() {
+    let client = reqwest::Client::new();
+    let export = config().config.stats_export.clone();
+    let interval = Duration::from_millis(export.interval);
+
+    let name = match export.bucket {
+        Some(ref bucket) if export.enabled() => bucket.clone(),
+        _ => return,
+    };
+
+    let bucket = match Bucket::new(&export, &name).await {
+        Ok(bucket) => bucket,
+        Err(err) => {
+            warn!("stats export: {}", err);
+            return;
+        }
+    };
+
+    info!(
+        "exporting stats snapshots to bucket \"{}\" every {:.1}s",
+        name,
+        interval.as_secs_f64(),
+    );
+
+    let shutdown = tasks::shutdown_signal();
+
+    loop {
+        tokio::select! {
+            _ = sleep(interval) => {}
+            _ = shutdown.cancelled() => break,
+        }
+
+        let now = Utc::now();
+        let key = key(&export.prefix, now);
+
+        let result = async {
+            let body = compress(&snapshot(now).await?)?;
+            bucket.put(&client, &key, body).await
+        }
+        .await;
+
+        if let Err(err) = result {
+            warn!("stats export: {}", err);
+        }
+    }
+}
+
+/// Object name of the snapshot taken at `now`.
+fn key(prefix: &str, now: DateTime<Utc>) -> String {
+    format!(
+        "{}{}-{}.json.gz",
+        prefix,
+        now.format("%Y/%m/%d/%H%M%S"),
+        instance_id()
+    )
+}
+
+/// URL of an object, addressed path-style.
+fn object_url(endpoint: &str, bucket: &str, key: &str) -> Result<url::Url, Error> {
+    let endpoint = endpoint.trim_end_matches('/');
+    let url = format!("{}/{}/{}", endpoint, encode(bucket), encode(key));
+    url::Url::parse(&url).map_err(|err| Error::Endpoint(endpoint.to_string(), err))
+}
+
+/// Percent-encode everything except unreserved characters and slashes,
+/// as required by SigV4 canonical URIs.
+fn encode(path: &str) -> String {
+    let mut encoded = String::with_capacity(path.len());
+
+    for byte in path.bytes() {
+        match byte {
+            b'A'..=b'Z' | b'a'..=b'z' | b'0'..=b'9' | b'-' | b'_' | b'.' | b'~' | b'/' => {
+                encoded.push(byte as char)
+            }
+            _ => encoded.push_str(&format!("%{:02X}", byte)),
+        }
+    }
+
+    encoded
+}
+
+/// Take a snapshot of stats, pools and replication.
+async fn snapshot(now: DateTime<Utc>) -> Result<Value, Error> {
+    Ok(json!({
+        "timestamp": now.to_rfc3339(),
+        "instance_id": instance_id(),
+        "stats": rows(ShowStats.execute().await?)?,
+        "pools": rows(ShowPools.execute().await?)?,
+        "replication": rows(ShowReplication.execute().await?)?,
+    }))
+}
+
+/// Convert the output of an admin command into JSON objects, one per row.
+fn rows(messages: Vec<Message>) -> Result<Vec<Value>, Error> {
+    let mut messages = messages.into_iter();
+
+    let description = match messages.next() {
+        Some(message) => RowDescription::from_bytes(message.payload())?,
+        None => return Ok(vec![]),
+    };
+
+    messages
+        .filter(|message| message.code() == 'D')
+        .map(|message| {
+            let row = DataRow::from_bytes(message.payload())?;
+            let object = description
+                .fields
+                .iter()
+                .enumerate()
+                .map(|(index, field)| (field.name.clone(), value(field, row.get_text(index))))
+                .collect::<Map<_, _>>();
+
+            Ok(Value::Object(object))
+        })
+        .collect()
+}
+
+/// Convert a column to JSON, keeping numbers and booleans typed.
+fn value(field: &Field, text: Option<String>) -> Value {
+    let Some(text) = text else {
+        return Value::Null;
+    };
+
+    match field.type_oid {
+        // bool
+        16 => Value::Bool(text == "t"),
+        // int2, int4, int8, float4, float8, numeric
+        20 | 21 | 23 | 700 | 701 | 1700 => serde_json::from_str::<serde_json::Number>(&text)
+            .map(Value::Number)
+            .unwrap_or(Value::String(text)),
+        _ => Value::String(text),
+    }
+}
+
+/// Gzip-compress a snapshot.
+fn compress(snapshot: &Value) -> Result<Vec<u8>, Error> {
+    let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+    serde_json::to_writer(&mut encoder, snapshot)?;
+    Ok(encoder.finish()?)
+}
+
+#[cfg(test)]
+mod test {
+    use std::io::Read;
+
+    use chrono::TimeZone;
+    use flate2::read::GzDecoder;
+
+    use super::*;
+
+    #[test]
+    fn test_key() {
+        let now = Utc.with_ymd_and_hms(2026, 3, 4, 5, 6, 7).unwrap();
+        assert_eq!(
+            key("pgdog/", now),
+            format!("pgdog/2026/03/04/050607-{}.json.gz", instance_id())
+        );
+    }
+
+    #[test]
+    fn test_object_url() {
+        let url = object_url("http://minio:9000/", "stats", "pgdog/a b+c.json.gz").unwrap();
+        assert_eq!(
+            url.as_str(),
+            "http://minio:9000/stats/pgdog/a%20b%2Bc.json.gz"
+        );
+        assert_eq!(url.path(), "/stats/pgdog/a%20b%2Bc.json.gz");
+    }
+
+    #[test]
+    fn test_rows() {
+        let messages = vec![
+            RowDescription::new(&[
+                Field::text("database"),
+                Field::numeric("total_xact_count"),
+                Field::bool("paused"),
+                Field::double("avg_wait"),
+            ])
+            .message()
+            .unwrap(),
+            DataRow::new()
+                .add("pgdog")
+                .add(15_i64)
+                .add(false)
+                .add(1.5_f64)
+                .message()
+                .unwrap(),
+        ];
+
+        let rows = rows(messages).unwrap();
+        assert_eq!(
+            rows,
+            vec![json!({
+                "database": "pgdog",
+                "total_xact_count": 15,
+                "paused": false,
+                "avg_wait": 1.5,
+            })]
+        );
+
+        let mut decoded = String::new();
+        GzDecoder::new(compress(&Value::Array(rows.clone())).unwrap().as_slice())
+            .read_to_string(&mut decoded)
+            .unwrap();
+        assert_eq!(
+            serde_json::from_str::<Value>(&decoded).unwrap(),
+            Value::Array(rows)
+        );
+    }
+}
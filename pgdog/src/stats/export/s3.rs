@@ -0,0 +1,264 @@
+//! Amazon S3 and S3-compatible services.
+//!
+//! Objects are uploaded with a single PUT signed with AWS Signature Version 4.
+
+use aws_config::BehaviorVersion;
+use aws_credential_types::{
+    Credentials,
+    provider::{ProvideCredentials, SharedCredentialsProvider},
+};
+use aws_lc_rs::{
+    digest,
+    hmac::{self, HMAC_SHA256},
+};
+use chrono::{DateTime, Utc};
+use pgdog_config::StatsExport;
+use url::Url;
+
+use super::{Error, object_url};
+
+/// S3 bucket.
+pub struct Bucket {
+    name: String,
+    endpoint: String,
+    region: String,
+    credentials: SharedCredentialsProvider,
+}
+
+impl Bucket {
+    /// Use the access key from the config if set, otherwise the default AWS credentials chain.
+    pub async fn new(export: &StatsExport, name: &str) -> Result<Self, Error> {
+        let credentials = match (&export.access_key_id, &export.secret_access_key) {
+            (Some(access_key_id), Some(secret_access_key)) => SharedCredentialsProvider::new(
+                Credentials::new(access_key_id, secret_access_key, None, None, "pgdog"),
+            ),
+            _ => aws_config::load_defaults(BehaviorVersion::latest())
+                .await
+                .credentials_provider()
+                .ok_or_else(|| Error::Credentials("no AWS credentials found".into()))?,
+        };
+
+        Ok(Self {
+            name: name.to_string(),
+            endpoint: export.endpoint(),
+            region: export.region.clone(),
+            credentials,
+        })
+    }
+
+    /// Upload an object.
+    pub async fn put(
+        &self,
+        client: &reqwest::Client,
+        key: &str,
+        body: Vec<u8>,
+    ) -> Result<(), Error> {
+        let credentials = self
+            .credentials
+            .provide_credentials()
+            .await
+            .map_err(|err| Error::Credentials(err.to_string()))?;
+
+        let url = object_url(&self.endpoint, &self.name, key)?;
+        let payload_hash = hex::encode(digest::digest(&digest::SHA256, &body));
+
+        let mut request = client
+            .put(url.clone())
+            .header("content-type", "application/json")
+            .header("content-encoding", "gzip");
+
+        for (name, value) in sign(&url, &self.region, &credentials, &payload_hash, Utc::now()) {
+            request = request.header(name, value);
+        }
+
+        let response = request.body(body).send().await?;
+        let status = response.status();
+
+        if !status.is_success() {
+            return Err(Error::Upload {
+                key: key.to_string(),
+                status,
+                body: response.text().await.unwrap_or_default(),
+            });
+        }
+
+        Ok(())
+    }
+}
+
+/// Headers authenticating a PUT request to `url`.
+fn sign(
+    url: &Url,
+    region: &str,
+    credentials: &Credentials,
+    payload_hash: &str,
+    now: DateTime<Utc>,
+) -> Vec<(&'static str, String)> {
+    let date = now.format("%Y%m%d").to_string();
+    let timestamp = now.format("%Y%m%dT%H%M%SZ").to_string();
+
+    let host = url.host_str().unwrap_or_default();
+    let host = match url.port() {
+        Some(port) => format!("{}:{}", host, port),
+        None => host.to_string(),
+    };
+
+    let mut headers = vec![
+        ("host", host),
+        ("x-amz-content-sha256", payload_hash.to_string()),
+        ("x-amz-date", timestamp.clone()),
+    ];
+
+    if let Some(token) = credentials.session_token() {
+        headers.push(("x-amz-security-token", token.to_string()));
+    }
+
+    let canonical_headers = headers
+        .iter()
+        .map(|(name, value)| format!("{}:{}\n", name, value.trim()))
+        .collect::<String>();
+    let signed_headers = headers
+        .iter()
+        .map(|(name, _)| *name)
+        .collect::<Vec<_>>()
+        .join(";");
+
+    let canonical_request = format!(
+        "PUT\n{}\n\n{}\n{}\n{}",
+        url.path(),
+        canonical_headers,
+        signed_headers,
+        payload_hash
+    );
+
+    let scope = format!("{}/{}/s3/aws4_request", date, region);
+    let string_to_sign = format!(
+        "AWS4-HMAC-SHA256\n{}\n{}\n{}",
+        timestamp,
+        scope,
+        hex::encode(digest::digest(
+            &digest::SHA256,
+            canonical_request.as_bytes()
+        ))
+    );
+
+    let key = signing_key(credentials.secret_access_key(), &date, region, "s3");
+    let key = hmac::Key::new(HMAC_SHA256, &key);
+    let signature = hex::encode(hmac::sign(&key, string_to_sign.as_bytes()));
+
+    // reqwest sets the host header itself.
+    headers.remove(0);
+    headers.push((
+        "authorization",
+        format!(
+            "AWS4-HMAC-SHA256 Credential={}/{}, SignedHeaders={}, Signature={}",
+            credentials.access_key_id(),
+            scope,
+            signed_headers,
+            signature
+        ),
+    ));
+
+    headers
+}
+
+/// Derive the SigV4 signing key for a day, region and service.
+fn signing_key(secret: &str, date: &str, region: &str, service: &str) -> Vec<u8> {
+    let mut key = format!("AWS4{}", secret).into_bytes();
+
+    for part in [date, region, service, "aws4_request"] {
+        let tag = hmac::sign(&hmac::Key::new(HMAC_SHA256, &key), part.as_bytes());
+        key = tag.as_ref().to_vec();
+    }
+
+    key
+}
+
+#[cfg(test)]
+mod test {
+    use chrono::TimeZone;
+    use wiremock::{
+        Mock, MockServer, ResponseTemplate,
+        matchers::{header, header_exists, method, path},
+    };
+
+    use super::*;
+
+    #[test]
+    fn test_signing_key() {
+        // Example from the AWS Signature Version 4 documentation.
+        let key = signing_key(
+            "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+            "20120215",
+            "us-east-1",
+            "iam",
+        );
+
+        assert_eq!(
+            hex::encode(key),
+            "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+        );
+    }
+
+    #[test]
+    fn test_sign() {
+        let credentials = Credentials::new("AKID", "secret", Some("token".into()), None, "test");
+        let url = Url::parse("http://localhost:9000/stats/pgdog/snapshot.json.gz").unwrap();
+        let now = Utc.with_ymd_and_hms(2026, 1, 2, 3, 4, 5).unwrap();
+
+        let headers = sign(&url, "us-east-1", &credentials, "abc", now);
+        let names = headers.iter().map(|(name, _)| *name).collect::<Vec<_>>();
+
+        assert_eq!(
+            names,
+            vec![
+                "x-amz-content-sha256",
+                "x-amz-date",
+                "x-amz-security-token",
+                "authorization"
+            ]
+        );
+        assert_eq!(headers[1].1, "20260102T030405Z");
+        assert!(headers[3].1.starts_with(
+            "AWS4-HMAC-SHA256 Credential=AKID/20260102/us-east-1/s3/aws4_request, \
+             SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="
+        ));
+    }
+
+    #[tokio::test]
+    async fn test_put() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("PUT"))
+            .and(path("/stats/pgdog/snapshot.json.gz"))
+            .and(header("content-encoding", "gzip"))
+            .and(header_exists("authorization"))
+            .and(header_exists("x-amz-date"))
+            .respond_with(ResponseTemplate::new(200))
+            .expect(1)
+            .mount(&server)
+            .await;
+
+        let export = StatsExport {
+            bucket: Some("stats".into()),
+            endpoint: Some(server.uri()),
+            access_key_id: Some("AKID".into()),
+            secret_access_key: Some("secret".into()),
+            ..Default::default()
+        };
+
+        let bucket = Bucket::new(&export, "stats").await.unwrap();
+        let client = reqwest::Client::new();
+
+        bucket
+            .put(&client, "pgdog/snapshot.json.gz", vec![1, 2, 3])
+            .await
+            .unwrap();
+
+        let err = bucket
+            .put(&client, "pgdog/missing.json.gz", vec![])
+            .await
+            .unwrap_err();
+        assert!(matches!(err, Error::Upload { .. }));
+    }
+}
@@ -11,11 +11,36 @@ use tokio::net::TcpListener;
 use tokio::select;
 use tracing::{info, warn};
 
-use super::{Clients, Listeners, MirrorStatsMetrics, Pools, QueryCache, TwoPc};
+use super::{
+    Clients, Listeners, LsnFeed, MirrorStatsMetrics, PinnedClients, Pools, QueryCache,
+    QuerySizeLimit, ReadFallback, TransactionDuration, TwoPc,
+};
 use crate::tasks;
 
-async fn metrics(_: Request<hyper::body::Incoming>) -> Result<Response<Full<Bytes>>, Infallible> {
+async fn handle(req: Request<hyper::body::Incoming>) -> Result<Response<Full<Bytes>>, Infallible> {
+    match req.uri().path() {
+        "/lsn" => lsn(),
+        _ => metrics(),
+    }
+}
+
+/// Per-shard LSN feed, as JSON.
+fn lsn() -> Result<Response<Full<Bytes>>, Infallible> {
+    let response = match LsnFeed::load().to_json() {
+        Ok(json) => Response::builder()
+            .header(hyper::header::CONTENT_TYPE, "application/json")
+            .body(Full::new(Bytes::from(json))),
+        Err(err) => Response::builder()
+            .status(hyper::StatusCode::INTERNAL_SERVER_ERROR)
+            .body(Full::new(Bytes::from(err.to_string()))),
+    };
+
+    Ok(response.unwrap_or_else(|_| Response::new(Full::new(Bytes::from("LSN feed unavailable")))))
+}
+
+fn metrics() -> Result<Response<Full<Bytes>>, Infallible> {
     let clients = Clients::load();
+    let pinned_clients = PinnedClients::load();
     let pools = Pools::load();
     let mirror_stats: Vec<_> = MirrorStatsMetrics::load()
         .into_iter()
@@ -34,7 +59,12 @@ async fn metrics(_: Request<hyper::body::Incoming>) -> Result<Response<Full<Byte
         .collect();
     let query_cache = query_cache.join("\n");
     let two_pc = TwoPc::load();
+    let query_size_limit = QuerySizeLimit::load();
+    let read_fallback = ReadFallback::load();
+    let transaction_duration = TransactionDuration::load();
     let metrics_data = clients.to_string()
+        + "\n"
+        + &pinned_clients.to_string()
         + "\n"
         + &pools.to_string()
         + "\n"
@@ -44,7 +74,13 @@ async fn metrics(_: Request<hyper::body::Incoming>) -> Result<Response<Full<Byte
         + "\n"
         + &query_cache
         + "\n"
-        + &two_pc.to_string();
+        + &two_pc.to_string()
+        + "\n"
+        + &query_size_limit.to_string()
+        + "\n"
+        + &read_fallback.to_string()
+        + "\n"
+        + &transaction_duration.to_string();
     let response = Response::builder()
         .header(
             hyper::header::CONTENT_TYPE,
@@ -71,7 +107,7 @@ pub async fn server(port: u16) -> std::io::Result<()> {
         let shutdown = shutdown.clone();
 
         tasks::spawn("openmetrics http server", async move {
-            let connection = http1::Builder::new().serve_connection(io, service_fn(metrics));
+            let connection = http1::Builder::new().serve_connection(io, service_fn(handle));
 
             tokio::select! {
                 result = connection => {
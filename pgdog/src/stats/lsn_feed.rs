@@ -0,0 +1,76 @@
+//! Per-shard LSN feed, served as JSON by the OpenMetrics endpoint at `/lsn`.
+//!
+//! Contains the replication state collected by the LSN monitor, including
+//! samples over the last `lsn_history` milliseconds, so external failover
+//! controllers can reuse it instead of querying the databases themselves.
+
+use std::time::SystemTime;
+
+use serde::Serialize;
+
+use crate::backend::databases::databases;
+use crate::backend::pool::lsn_history::LsnSample;
+
+/// LSN state of one server.
+#[derive(Debug, Serialize)]
+pub struct ServerLsn {
+    pub database: String,
+    pub user: String,
+    pub host: String,
+    pub port: u16,
+    pub shard: usize,
+    pub role: String,
+    /// How old the latest sample is, in milliseconds.
+    pub lsn_age_ms: Option<u64>,
+    /// Latest sample, if the LSN monitor fetched any.
+    pub current: Option<LsnSample>,
+    /// Recent samples, oldest first.
+    pub history: Vec<LsnSample>,
+}
+
+/// LSN state of all servers.
+#[derive(Debug, Serialize)]
+pub struct LsnFeed {
+    pub servers: Vec<ServerLsn>,
+}
+
+impl LsnFeed {
+    /// Collect LSN state from all pools.
+    pub fn load() -> Self {
+        let now = SystemTime::now();
+        let mut servers = vec![];
+
+        for (user, cluster) in databases().all() {
+            for (shard_num, shard) in cluster.shards().iter().enumerate() {
+                for (role, pool) in shard.pools_with_roles() {
+                    let state = pool.state();
+                    let valid = state.lsn_stats.valid();
+
+                    servers.push(ServerLsn {
+                        database: user.database.clone(),
+                        user: user.user.clone(),
+                        host: pool.addr().host.clone(),
+                        port: pool.addr().port,
+                        shard: shard_num,
+                        role: role.to_string(),
+                        lsn_age_ms: valid.then(|| {
+                            now.duration_since(state.lsn_stats.fetched)
+                                .unwrap_or_default()
+                                .as_millis() as u64
+                        }),
+                        current: valid
+                            .then(|| LsnSample::new(&state.lsn_stats, &state.replica_lag)),
+                        history: pool.lsn_history(),
+                    });
+                }
+            }
+        }
+
+        Self { servers }
+    }
+
+    /// Serialize the feed to JSON.
+    pub fn to_json(&self) -> Result<String, serde_json::Error> {
+        serde_json::to_string(self)
+    }
+}
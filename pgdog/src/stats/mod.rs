@@ -1,5 +1,7 @@
 //! Statistics.
 pub mod clients;
+pub mod counter;
+pub mod export;
 pub mod http_server;
 pub mod mirror_stats;
 pub mod open_metric;
@@ -9,14 +11,22 @@ pub mod pools;
 pub use open_metric::*;
 pub mod listeners;
 pub mod logger;
+pub mod lsn_feed;
 pub mod memory;
 pub mod query_cache;
+pub mod query_size_limit;
+pub mod read_fallback;
+pub mod transaction_duration;
 pub mod two_pc;
 
-pub use clients::Clients;
+pub use clients::{Clients, PinnedClients};
 pub use listeners::Listeners;
 pub use logger::Logger as StatsLogger;
+pub use lsn_feed::LsnFeed;
 pub use mirror_stats::MirrorStatsMetrics;
 pub use pools::{PoolMetric, Pools};
 pub use query_cache::QueryCache;
+pub use query_size_limit::QuerySizeLimit;
+pub use read_fallback::ReadFallback;
+pub use transaction_duration::TransactionDuration;
 pub use two_pc::TwoPc;
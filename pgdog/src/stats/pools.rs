@@ -51,6 +51,9 @@ impl Pools {
         let mut maxwait = vec![];
         let mut errors = vec![];
         let mut out_of_sync = vec![];
+        let mut replica_lag = vec![];
+        let mut replica_lag_bytes = vec![];
+        let mut lsn_offset_bytes = vec![];
         let mut total_xact_count = vec![];
         let mut total_xact_2pc_count = vec![];
         let mut avg_xact_count = vec![];
@@ -86,12 +89,13 @@ impl Pools {
         let mut total_sv_xact_idle = vec![];
         let mut total_auth_attempts = vec![];
         let mut avg_auth_attempts = vec![];
+        let mut shard_errors = vec![];
 
         let general = &crate::config::config().config.general;
 
         for (user, cluster) in databases().all() {
             for (shard_num, shard) in cluster.shards().iter().enumerate() {
-                for (role, pool) in shard.pools_with_roles() {
+                for (class, role, _ban, pool) in shard.pools_with_classes() {
                     let state = pool.state();
                     let labels = vec![
                         ("user".into(), user.user.clone()),
@@ -100,6 +104,7 @@ impl Pools {
                         ("port".into(), pool.addr().port.to_string()),
                         ("shard".into(), shard_num.to_string()),
                         ("role".into(), role.to_string()),
+                        ("pool_class".into(), class.to_string()),
                     ];
 
                     max_connections.push(Measurement {
@@ -137,6 +142,24 @@ impl Pools {
                         measurement: state.out_of_sync.into(),
                     });
 
+                    // Only export LSN stats we actually fetched.
+                    if state.lsn_stats.valid() {
+                        replica_lag.push(Measurement {
+                            labels: labels.clone(),
+                            measurement: state.replica_lag.duration.as_secs_f64().into(),
+                        });
+
+                        replica_lag_bytes.push(Measurement {
+                            labels: labels.clone(),
+                            measurement: state.replica_lag.bytes.into(),
+                        });
+
+                        lsn_offset_bytes.push(Measurement {
+                            labels: labels.clone(),
+                            measurement: state.lsn_stats.offset_bytes.into(),
+                        });
+                    }
+
                     let stats = state.stats;
                     let totals = stats.counts;
                     let averages = stats.averages;
@@ -316,6 +339,15 @@ impl Pools {
                         measurement: averages.auth_attempts.into(),
                     });
                 }
+
+                shard_errors.push(Measurement {
+                    labels: vec![
+                        ("user".into(), user.user.clone()),
+                        ("database".into(), user.database.clone()),
+                        ("shard".into(), shard_num.to_string()),
+                    ],
+                    measurement: shard.errors().into(),
+                });
             }
         }
 
@@ -397,6 +429,30 @@ impl Pools {
             metric_type: Some("counter".into()),
         }));
 
+        metrics.push(Metric::new(PoolMetric {
+            name: "replica_lag".into(),
+            measurements: replica_lag,
+            help: "How far the replica is behind the primary.".into(),
+            unit: Some("seconds".into()),
+            metric_type: None,
+        }));
+
+        metrics.push(Metric::new(PoolMetric {
+            name: "replica_lag_bytes".into(),
+            measurements: replica_lag_bytes,
+            help: "How many bytes of WAL the replica is behind the primary.".into(),
+            unit: None,
+            metric_type: None,
+        }));
+
+        metrics.push(Metric::new(PoolMetric {
+            name: "lsn_offset_bytes".into(),
+            measurements: lsn_offset_bytes,
+            help: "Current WAL position of the server in bytes.".into(),
+            unit: None,
+            metric_type: None,
+        }));
+
         metrics.push(Metric::new(PoolMetric {
             name: "total_xact_count".into(),
             measurements: total_xact_count,
@@ -684,6 +740,14 @@ impl Pools {
             metric_type: None,
         }));
 
+        metrics.push(Metric::new(PoolMetric {
+            name: "shard_errors".into(),
+            measurements: shard_errors,
+            help: "Total number of query and connection errors per shard.".into(),
+            unit: None,
+            metric_type: Some("counter".into()),
+        }));
+
         Pools { metrics }
     }
 
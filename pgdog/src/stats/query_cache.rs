@@ -84,6 +84,18 @@ impl QueryCache {
                 value: self.stats.fingerprints,
                 gauge: false,
             }),
+            Metric::new(QueryCacheMetric {
+                name: "query_cache_shadow_match".into(),
+                help: "Queries the shadow parser would have routed the same way".into(),
+                value: self.stats.shadow_match,
+                gauge: false,
+            }),
+            Metric::new(QueryCacheMetric {
+                name: "query_cache_shadow_mismatch".into(),
+                help: "Queries the shadow parser would have routed differently".into(),
+                value: self.stats.shadow_mismatch,
+                gauge: false,
+            }),
             Metric::new(QueryCacheMetric {
                 name: "prepared_statements".into(),
                 help: "Number of prepared statements in the cache".into(),
@@ -170,6 +182,8 @@ mod tests {
                 multi: 4,
                 parse_time: Duration::ZERO,
                 fingerprints: 8,
+                shadow_match: 9,
+                shadow_mismatch: 10,
             },
             len: 5,
             prepared_statements: 6,
@@ -188,6 +202,8 @@ mod tests {
                 "query_cache_size".to_string(),
                 "query_cache_parse_time".to_string(),
                 "query_cache_fingerprints".to_string(),
+                "query_cache_shadow_match".to_string(),
+                "query_cache_shadow_mismatch".to_string(),
                 "prepared_statements".to_string(),
                 "prepared_statements_memory_used".to_string(),
             ]
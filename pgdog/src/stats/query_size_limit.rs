@@ -0,0 +1,22 @@
+//! Queries over the soft `query_size_limit`.
+
+use super::{Metric, counter::Counter};
+
+static EXCEEDED: Counter = Counter::new(
+    "query_size_limit_exceeded_total",
+    "Total number of query messages that exceeded query_size_limit and were allowed to run.",
+);
+
+/// Record a query message that exceeded `query_size_limit`
+/// but was allowed to run.
+pub fn exceeded() {
+    EXCEEDED.increment();
+}
+
+pub struct QuerySizeLimit;
+
+impl QuerySizeLimit {
+    pub fn load() -> Metric {
+        EXCEEDED.load()
+    }
+}
@@ -0,0 +1,22 @@
+//! Reads sent to the primary because all replicas were down.
+
+use super::{Metric, counter::Counter};
+
+static FALLBACKS: Counter = Counter::new(
+    "read_fallback_to_primary_total",
+    "Total number of reads sent to the primary because all replicas were down.",
+);
+
+/// Record a read sent to the primary because
+/// all replicas were banned.
+pub fn fallback() {
+    FALLBACKS.increment();
+}
+
+pub struct ReadFallback;
+
+impl ReadFallback {
+    pub fn load() -> Metric {
+        FALLBACKS.load()
+    }
+}
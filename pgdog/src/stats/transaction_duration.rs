@@ -0,0 +1,21 @@
+//! Transactions over the soft `transaction_duration_notice`.
+
+use super::{Metric, counter::Counter};
+
+static EXCEEDED: Counter = Counter::new(
+    "transaction_duration_exceeded_total",
+    "Total number of transactions that took longer than transaction_duration_notice.",
+);
+
+/// Record a transaction that took longer than `transaction_duration_notice`.
+pub fn exceeded() {
+    EXCEEDED.increment();
+}
+
+pub struct TransactionDuration;
+
+impl TransactionDuration {
+    pub fn load() -> Metric {
+        EXCEEDED.load()
+    }
+}
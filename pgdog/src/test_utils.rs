@@ -1,6 +1,10 @@
 use std::convert::AsRef;
 use std::env;
 use std::ffi::{OsStr, OsString};
+use std::sync::Arc;
+
+use crate::backend::databases::reload_from_existing;
+use crate::config::{self, ConfigAndUsers};
 
 pub(crate) fn set_env_var<T: AsRef<OsStr>>(key: T, value: impl AsRef<OsStr>) -> EnvVarGuard<T> {
     let previous = env::var_os(&key);
@@ -40,3 +44,39 @@ impl<T: AsRef<OsStr>> Drop for EnvVarGuard<T> {
         }
     }
 }
+
+/// Change the global config for the rest of the test. The previous
+/// config is restored when the guard is dropped, even if the test fails.
+pub(crate) fn set_config(config: ConfigAndUsers) -> ConfigGuard {
+    let previous = config::config();
+    config::set(config).unwrap();
+    ConfigGuard {
+        previous,
+        reload: false,
+    }
+}
+
+#[must_use = "if unused, config will immediately revert"]
+pub(crate) struct ConfigGuard {
+    previous: Arc<ConfigAndUsers>,
+    reload: bool,
+}
+
+impl ConfigGuard {
+    /// Reload databases from the config, now and when it's restored.
+    pub(crate) fn reload(mut self) -> Self {
+        reload_from_existing().unwrap();
+        self.reload = true;
+        self
+    }
+}
+
+impl Drop for ConfigGuard {
+    fn drop(&mut self) {
+        // Don't panic while panicking.
+        let _ = config::set((*self.previous).clone());
+        if self.reload {
+            let _ = reload_from_existing();
+        }
+    }
+}
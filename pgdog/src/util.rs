@@ -6,7 +6,12 @@ use pgdog_config::MAX_DURATION;
 use rand::{Rng, distr::Alphanumeric};
 #[cfg(feature = "new_parser")]
 use std::ops::ControlFlow;
-use std::{env, future::Future, num::ParseIntError, time::Duration};
+use std::{
+    env,
+    future::Future,
+    num::ParseIntError,
+    time::{Duration, Instant},
+};
 
 use crate::net::Parameters; // 0.8
 
@@ -320,6 +325,16 @@ where
     }
 }
 
+/// Time left until a timeout that started at `since` fires.
+/// Disabled timeouts stay disabled.
+pub(crate) fn remaining(timeout: Duration, since: Instant) -> Duration {
+    if timeout == Duration::MAX || timeout == MAX_DURATION {
+        timeout
+    } else {
+        timeout.saturating_sub(since.elapsed())
+    }
+}
+
 #[cfg(feature = "new_parser")]
 pub(crate) trait ResultControlFlowExt<T, E> {
     fn break_err<B>(self) -> ControlFlow<Result<B, E>, T>;